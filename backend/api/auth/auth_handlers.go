@@ -2,11 +2,17 @@ package auth
 
 import (
 	"agent-connector/internal"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // AuthHandler authentication handler
@@ -107,8 +113,87 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Create session
-	session, err := h.userService.CreateSession(user.ID)
+	// Unusual logins are reported, and held back for a mailed code when so configured
+	login := internal.NewLoginContext(c.ClientIP(), c.GetHeader("User-Agent"), c.Request.Header)
+	anomaly, err := h.userService.DetectLoginAnomaly(user.ID, login)
+	if err != nil {
+		log.Printf("Failed to check login of user %d for anomalies: %v", user.ID, err)
+	}
+	if anomaly != nil {
+		challenge, err := h.userService.HandleLoginAnomaly(user, login, anomaly)
+		if err != nil {
+			log.Printf("Failed to hold back unusual login of user %d: %v", user.ID, err)
+		}
+		if challenge != nil {
+			h.userService.LogLogin(user.ID, login, false, "Verification required: unusual login", anomaly)
+
+			response := AuthResponse{
+				Code:    http.StatusForbidden,
+				Message: "Login verification required",
+				Data: LoginChallengeResponse{
+					ChallengeID: challenge.ChallengeID,
+					Anomalies:   anomaly.Kinds,
+					ExpiresAt:   challenge.ExpiresAt,
+				},
+				Error: &APIError{
+					Type:    "verification_required",
+					Code:    "403",
+					Message: "This login looks unusual, enter the code mailed to you at /api/v1/auth/login/verify",
+				},
+			}
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	h.completeLogin(c, user, login, anomaly)
+}
+
+// VerifyLogin complete a login held back as unusual with the code mailed to the user
+func (h *AuthHandler) VerifyLogin(c *gin.Context) {
+	var req VerifyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	challenge, user, err := h.userService.VerifyLoginChallenge(req.ChallengeID, req.Code)
+	if err != nil {
+		statusCode := http.StatusUnauthorized
+		if !errors.Is(err, internal.ErrLoginChallengeInvalid) && !errors.Is(err, internal.ErrLoginCodeMismatch) {
+			statusCode = http.StatusInternalServerError
+		}
+		response := AuthResponse{
+			Code:    statusCode,
+			Message: "Login verification failed",
+			Error: &APIError{
+				Type:    "authentication_error",
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	login := internal.NewLoginContext(c.ClientIP(), c.GetHeader("User-Agent"), c.Request.Header)
+	// the location is that of the login the code was mailed for
+	login.Country, login.Latitude, login.Longitude = challenge.Country, challenge.Latitude, challenge.Longitude
+	h.completeLogin(c, user, login, &internal.LoginAnomaly{Kinds: strings.Split(challenge.Anomalies, ",")})
+}
+
+// completeLogin create the session of an authenticated user and respond with it
+func (h *AuthHandler) completeLogin(c *gin.Context, user *internal.User, login *internal.LoginContext, anomaly *internal.LoginAnomaly) {
+	session, err := h.userService.CreateSession(user.ID, login.IP, login.UserAgent)
 	if err != nil {
 		response := AuthResponse{
 			Code:    http.StatusInternalServerError,
@@ -124,7 +209,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Record login success log
-	h.userService.LogUserLogin(user.ID, c.ClientIP(), c.GetHeader("User-Agent"), true, "Login successful")
+	h.userService.LogLogin(user.ID, login, true, "Login successful", anomaly)
 
 	// Clean up password field
 	user.Sanitize()
@@ -175,11 +260,10 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	}
 
 	// Get user statistics
-	loginLogs, _, _ := h.userService.GetUserLoginLogs(user.ID, 1, 1)
-	totalLogins, _, _ := h.userService.GetUserLoginLogs(user.ID, 1, 1000)
+	loginLogs, totalLogins, _ := h.userService.GetUserLoginLogs(user.ID, nil, 1, 1)
 
 	stats := UserStatsResponse{
-		TotalLogins:   int64(len(totalLogins)),
+		TotalLogins:   totalLogins,
 		AccountAge:    int(time.Since(user.CreatedAt).Hours() / 24),
 		LastLoginTime: user.LastLogin,
 	}
@@ -247,6 +331,9 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	UpdateInternalUserFromProfileRequest(user, &req)
 
 	if err := h.userService.UpdateUser(user); err != nil {
+		if errors.Is(err, internal.ErrVersionConflict) && h.respondWithUserConflict(c, user.ID, err) {
+			return
+		}
 		response := AuthResponse{
 			Code:    http.StatusInternalServerError,
 			Message: "Failed to update profile",
@@ -326,7 +413,8 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// GetLoginLogs get login logs
+// GetLoginLogs get login logs of the current user, filterable by from, to, result and
+// ip, as CSV with ?format=csv
 func (h *AuthHandler) GetLoginLogs(c *gin.Context) {
 	user := GetCurrentUser(c)
 	if user == nil {
@@ -343,10 +431,67 @@ func (h *AuthHandler) GetLoginLogs(c *gin.Context) {
 		return
 	}
 
+	h.respondWithLoginLogs(c, user.ID)
+}
+
+// GetUserLoginLogs get the login logs of a user (admin function), with the filters and
+// export of GetLoginLogs
+func (h *AuthHandler) GetUserLoginLogs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "User ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if _, err := h.userService.GetUserByID(uint(id)); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusNotFound,
+			Message: "User not found",
+			Error: &APIError{
+				Type:    "not_found",
+				Code:    "404",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	h.respondWithLoginLogs(c, uint(id))
+}
+
+// respondWithLoginLogs write a page of the filtered login logs of a user, or all of them
+// up to internal.MaxLoginLogExport as CSV
+func (h *AuthHandler) respondWithLoginLogs(c *gin.Context, userID uint) {
+	filter, err := internal.ParseLoginLogFilter(c.Request.URL.Query())
+	if err != nil {
+		h.respondWithListQueryError(c, err)
+		return
+	}
+
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+	export := c.Query("format") == "csv"
+	if export {
+		page, pageSize = 1, internal.MaxLoginLogExport
+	}
 
-	logs, total, err := h.userService.GetUserLoginLogs(user.ID, page, pageSize)
+	logs, total, err := h.userService.GetUserLoginLogs(userID, filter, page, pageSize)
 	if err != nil {
 		response := AuthResponse{
 			Code:    http.StatusInternalServerError,
@@ -361,6 +506,11 @@ func (h *AuthHandler) GetLoginLogs(c *gin.Context) {
 		return
 	}
 
+	if export {
+		writeLoginLogsCSV(c, userID, logs, total)
+		return
+	}
+
 	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
 
 	response := AuthPaginationResponse{
@@ -377,15 +527,284 @@ func (h *AuthHandler) GetLoginLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// writeLoginLogsCSV write login logs as a CSV attachment. X-Total-Count holds the number
+// of matching logs, more than the rows when the export was capped.
+func writeLoginLogsCSV(c *gin.Context, userID uint, logs []*internal.UserLoginLog, total int64) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=login-logs-%d-%s.csv", userID, time.Now().Format("20060102-150405")))
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "user_id", "created_at", "ip", "country", "result", "anomalies", "message", "user_agent"})
+	for _, entry := range logs {
+		result := "failure"
+		if entry.Success {
+			result = "success"
+		}
+		writer.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			strconv.FormatUint(uint64(entry.UserID), 10),
+			entry.CreatedAt.Format(time.RFC3339),
+			entry.IP,
+			entry.Country,
+			result,
+			entry.Anomalies,
+			internal.CSVText(entry.Message),
+			internal.CSVText(entry.UserAgent),
+		})
+	}
+	writer.Flush()
+}
+
+// Introspect validate a session token on behalf of other services
+func (h *AuthHandler) Introspect(c *gin.Context) {
+	var req IntrospectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	session, err := h.userService.GetSessionByToken(req.Token)
+	if err != nil {
+		if !errors.Is(err, internal.ErrSessionNotFound) && err.Error() != "session expired" {
+			response := AuthResponse{
+				Code:    http.StatusInternalServerError,
+				Message: "Failed to introspect token",
+				Error: &APIError{
+					Type:    "database_error",
+					Code:    "500",
+					Message: err.Error(),
+				},
+			}
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		// unknown or expired tokens are not an error, they are simply inactive
+		response := AuthResponse{
+			Code:    http.StatusOK,
+			Message: "Token is not active",
+			Data:    &IntrospectResponse{Active: false},
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	bindingViolated := req.ClientIP != "" && h.userService.CheckSessionBinding(session, req.ClientIP, req.UserAgent) != nil
+	if !session.User.IsActive() || session.ImpersonationRevoked() || bindingViolated {
+		response := AuthResponse{
+			Code:    http.StatusOK,
+			Message: "Token is not active",
+			Data:    &IntrospectResponse{Active: false},
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Token is active",
+		Data:    ConvertSessionToIntrospection(session),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSettings get the settings of the current user
+func (h *AuthHandler) GetSettings(c *gin.Context) {
+	settings, err := h.userService.GetUserSettings(GetCurrentUserID(c))
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get settings",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Settings retrieved successfully",
+		Data:    ConvertFromInternalSettings(settings),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateSettings update the settings of the current user
+func (h *AuthHandler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	settings, err := h.userService.GetUserSettings(GetCurrentUserID(c))
+	if err == nil {
+		UpdateInternalSettingsFromRequest(settings, &req)
+		err = h.userService.SaveUserSettings(settings)
+	}
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "update_error"
+		if errors.Is(err, internal.ErrInvalidUserSettings) {
+			statusCode, errorType = http.StatusBadRequest, "validation_error"
+		}
+
+		response := AuthResponse{
+			Code:    statusCode,
+			Message: "Failed to update settings",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Settings updated successfully",
+		Data:    ConvertFromInternalSettings(settings),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListSessions list the active sessions of the current user
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	user := GetCurrentUser(c)
+
+	sessions, err := h.userService.ListActiveSessions(user.ID)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list sessions",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Sessions retrieved successfully",
+		Data:    ConvertFromInternalSessionList(sessions, extractToken(c)),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession revoke one session of the current user
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid session ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Session ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := h.userService.RevokeSession(GetCurrentUserID(c), uint(id)); err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "session_error"
+		if errors.Is(err, internal.ErrSessionNotFound) {
+			statusCode, errorType = http.StatusNotFound, "not_found"
+		}
+
+		response := AuthResponse{
+			Code:    statusCode,
+			Message: "Failed to revoke session",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Session revoked successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeOtherSessions revoke every session of the current user except the one making the request
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	revoked, err := h.userService.RevokeOtherSessions(GetCurrentUserID(c), extractToken(c))
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to revoke sessions",
+			Error: &APIError{
+				Type:    "session_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Other sessions revoked successfully",
+		Data:    RevokeSessionsResponse{Revoked: revoked},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // -- Admin functions --
 
 // ListUsers get user list (admin function)
 func (h *AuthHandler) ListUsers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	search := c.Query("search")
+	listQuery, err := internal.ParseListQuery(c.Request.URL.Query())
+	if err != nil {
+		h.respondWithListQueryError(c, err)
+		return
+	}
 
-	users, total, err := h.userService.ListUsers(page, pageSize, search)
+	users, total, err := h.userService.ListUsers(listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		h.respondWithListQueryError(c, err)
+		return
+	}
 	if err != nil {
 		response := AuthResponse{
 			Code:    http.StatusInternalServerError,
@@ -400,15 +819,15 @@ func (h *AuthHandler) ListUsers(c *gin.Context) {
 		return
 	}
 
-	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
 
 	response := AuthPaginationResponse{
 		Code:    http.StatusOK,
 		Message: "Users retrieved successfully",
 		Data:    ConvertFromInternalUserList(users),
 		Pagination: PaginationInfo{
-			Page:       page,
-			PageSize:   pageSize,
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
 			Total:      total,
 			TotalPages: totalPages,
 		},
@@ -416,6 +835,20 @@ func (h *AuthHandler) ListUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// respondWithListQueryError return the error for invalid list parameters
+func (h *AuthHandler) respondWithListQueryError(c *gin.Context, err error) {
+	response := AuthResponse{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid list parameters",
+		Error: &APIError{
+			Type:    "validation_error",
+			Code:    "400",
+			Message: err.Error(),
+		},
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
 // CreateUser create user (admin function)
 func (h *AuthHandler) CreateUser(c *gin.Context) {
 	var req CreateUserRequest
@@ -463,6 +896,87 @@ func (h *AuthHandler) CreateUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, response)
 }
 
+// BatchCreateUsers create several users (admin function), each entry is validated and created independently
+func (h *AuthHandler) BatchCreateUsers(c *gin.Context) {
+	var req BatchCreateUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	result := &BatchResponse{Results: make([]BatchItemResult, 0, len(req.Users))}
+	for i := range req.Users {
+		if err := binding.Validator.ValidateStruct(&req.Users[i]); err != nil {
+			result.Add(i, 0, err)
+			continue
+		}
+
+		user := ConvertToInternalUserFromCreateRequest(&req.Users[i])
+		err := h.userService.CreateUser(user)
+		result.Add(i, user.ID, err)
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Users created: %d succeeded, %d failed", result.Succeeded, result.Failed),
+		Data:    result,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// BatchUpdateUserStatus update the status of several users (admin function)
+func (h *AuthHandler) BatchUpdateUserStatus(c *gin.Context) {
+	var req BatchUserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUserID := GetCurrentUserID(c)
+	status := internal.UserStatus(req.Status)
+
+	result := &BatchResponse{Results: make([]BatchItemResult, 0, len(req.IDs))}
+	for i, id := range req.IDs {
+		// an admin locking themselves out in a bulk action is almost always a mistake
+		if id == currentUserID && status != internal.UserStatusActive {
+			result.Add(i, id, errors.New("cannot change your own status"))
+			continue
+		}
+
+		if _, err := h.userService.GetUserByID(id); err != nil {
+			result.Add(i, id, err)
+			continue
+		}
+
+		result.Add(i, id, h.userService.UpdateUserStatus(id, status))
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("User status updated: %d succeeded, %d failed", result.Succeeded, result.Failed),
+		Data:    result,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // GetUser get user information (admin function)
 func (h *AuthHandler) GetUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -555,6 +1069,9 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 	UpdateInternalUserFromRequest(user, &req)
 
 	if err := h.userService.UpdateUser(user); err != nil {
+		if errors.Is(err, internal.ErrVersionConflict) && h.respondWithUserConflict(c, user.ID, err) {
+			return
+		}
 		response := AuthResponse{
 			Code:    http.StatusInternalServerError,
 			Message: "Failed to update user",
@@ -578,6 +1095,29 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// respondWithUserConflict answer 409 with the current state of the user, false when it
+// cannot be loaded
+func (h *AuthHandler) respondWithUserConflict(c *gin.Context, id uint, err error) bool {
+	current, getErr := h.userService.GetUserByID(id)
+	if getErr != nil {
+		return false
+	}
+	current.Sanitize()
+
+	response := AuthResponse{
+		Code:    http.StatusConflict,
+		Message: "User was changed by someone else",
+		Data:    ConvertFromInternalUser(current),
+		Error: &APIError{
+			Type:    "version_conflict",
+			Code:    "409",
+			Message: err.Error(),
+		},
+	}
+	c.JSON(http.StatusConflict, response)
+	return true
+}
+
 // DeleteUser delete user (admin function)
 func (h *AuthHandler) DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -668,3 +1208,233 @@ func (h *AuthHandler) UpdateUserStatus(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, response)
 }
+
+// ImpersonateUser issue a short-lived session to act as the user (admin function)
+func (h *AuthHandler) ImpersonateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "User ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	admin := GetCurrentUser(c)
+	session, err := h.userService.CreateImpersonationSession(admin, uint(id), req.Reason, c.ClientIP())
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "session_error"
+		switch {
+		case errors.Is(err, internal.ErrImpersonationNotAllowed):
+			statusCode, errorType = http.StatusForbidden, "authorization_error"
+		case errors.Is(err, internal.ErrImpersonationTarget):
+			statusCode, errorType = http.StatusBadRequest, "validation_error"
+		case err.Error() == "user not found":
+			statusCode, errorType = http.StatusNotFound, "not_found"
+		}
+
+		response := AuthResponse{
+			Code:    statusCode,
+			Message: "Failed to impersonate user",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	session.User.Sanitize()
+
+	response := AuthResponse{
+		Code:    http.StatusCreated,
+		Message: "Impersonation session created successfully",
+		Data: ImpersonationResponse{
+			Token:          session.Token,
+			ExpiresAt:      session.ExpiresAt,
+			User:           *ConvertFromInternalUser(&session.User),
+			ImpersonatorID: admin.ID,
+			Reason:         session.ImpersonationReason,
+		},
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetImpersonationLogs get the impersonation audit log of a user (admin function)
+func (h *AuthHandler) GetImpersonationLogs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "User ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	logs, total, err := h.userService.GetImpersonationLogs(uint(id), page, pageSize)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get impersonation logs",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+
+	response := AuthPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Impersonation logs retrieved successfully",
+		Data:    ConvertFromInternalImpersonationLogList(logs),
+		Pagination: PaginationInfo{
+			Page:       page,
+			PageSize:   pageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListUserSessions list the active sessions of a user (admin function)
+func (h *AuthHandler) ListUserSessions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "User ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	sessions, err := h.userService.ListActiveSessions(uint(id))
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list sessions",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Sessions retrieved successfully",
+		Data:    ConvertFromInternalSessionList(sessions, extractToken(c)),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ForceLogoutUser revoke every session of a user (admin function)
+func (h *AuthHandler) ForceLogoutUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "User ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if _, err := h.userService.GetUserByID(uint(id)); err != nil {
+		response := AuthResponse{
+			Code:    http.StatusNotFound,
+			Message: "User not found",
+			Error: &APIError{
+				Type:    "not_found",
+				Code:    "404",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	revoked, err := h.userService.RevokeAllSessions(uint(id))
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to log out user",
+			Error: &APIError{
+				Type:    "session_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	admin := GetCurrentUser(c)
+	h.userService.LogUserLogin(uint(id), c.ClientIP(), c.GetHeader("User-Agent"), true,
+		fmt.Sprintf("All sessions revoked by admin %s", admin.Username))
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "User logged out successfully",
+		Data:    RevokeSessionsResponse{Revoked: revoked},
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -2,8 +2,13 @@ package auth
 
 import (
 	"agent-connector/internal"
+	"agent-connector/pkg/jobs"
+	"agent-connector/pkg/openapi"
+	"agent-connector/pkg/serviceauth"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,8 +26,12 @@ func SetupAuthRoutes(r *gin.Engine) {
 	auth := apiV1.Group("/auth")
 	{
 		// Basic authentication interfaces
-		auth.POST("/register", authHandler.Register) // User registration
-		auth.POST("/login", authHandler.Login)       // User login
+		auth.POST("/register", authHandler.Register)        // User registration
+		auth.POST("/login", authHandler.Login)              // User login
+		auth.POST("/login/verify", authHandler.VerifyLogin) // Complete an unusual login
+
+		// Token introspection for other services
+		auth.POST("/introspect", authHandler.Introspect) // Validate session token
 
 		// Service information interfaces
 		auth.GET("/", getAuthServiceInfo) // Service information
@@ -34,11 +43,20 @@ func SetupAuthRoutes(r *gin.Engine) {
 	authProtected.Use(AuthMiddleware())
 	{
 		// User profile management
-		authProtected.POST("/logout", authHandler.Logout)                  // User logout
-		authProtected.GET("/profile", authHandler.GetProfile)              // Get profile
-		authProtected.PUT("/profile", authHandler.UpdateProfile)           // Update profile
-		authProtected.POST("/change-password", authHandler.ChangePassword) // Change password
-		authProtected.GET("/login-logs", authHandler.GetLoginLogs)         // Get login logs
+		authProtected.POST("/logout", authHandler.Logout)                                     // User logout
+		authProtected.GET("/profile", authHandler.GetProfile)                                 // Get profile
+		authProtected.PUT("/profile", authHandler.UpdateProfile)                              // Update profile
+		authProtected.POST("/change-password", NotImpersonated(), authHandler.ChangePassword) // Change password
+		authProtected.GET("/login-logs", authHandler.GetLoginLogs)                            // Get login logs
+
+		// User settings
+		authProtected.GET("/settings", authHandler.GetSettings)                       // Get settings
+		authProtected.PUT("/settings", NotImpersonated(), authHandler.UpdateSettings) // Update settings
+
+		// Session management
+		authProtected.GET("/sessions", authHandler.ListSessions)                              // List active sessions
+		authProtected.DELETE("/sessions", NotImpersonated(), authHandler.RevokeOtherSessions) // Revoke all other sessions
+		authProtected.DELETE("/sessions/:id", NotImpersonated(), authHandler.RevokeSession)   // Revoke a session
 	}
 
 	// User management routes (admin functionality)
@@ -46,12 +64,23 @@ func SetupAuthRoutes(r *gin.Engine) {
 	userManagement.Use(AuthMiddleware())
 	userManagement.Use(AdminOnly())
 	{
-		userManagement.GET("", authHandler.ListUsers)                   // Get user list
-		userManagement.POST("", authHandler.CreateUser)                 // Create user
-		userManagement.GET("/:id", authHandler.GetUser)                 // Get user information
-		userManagement.PUT("/:id", authHandler.UpdateUser)              // Update user information
-		userManagement.DELETE("/:id", authHandler.DeleteUser)           // Delete user
-		userManagement.PUT("/:id/status", authHandler.UpdateUserStatus) // Update user status
+		userManagement.GET("", authHandler.ListUsers)                          // Get user list
+		userManagement.POST("", authHandler.CreateUser)                        // Create user
+		userManagement.POST("/batch", authHandler.BatchCreateUsers)            // Create users in bulk
+		userManagement.PUT("/batch/status", authHandler.BatchUpdateUserStatus) // Update user status in bulk
+		userManagement.GET("/:id", authHandler.GetUser)                        // Get user information
+		userManagement.PUT("/:id", authHandler.UpdateUser)                     // Update user information
+		userManagement.DELETE("/:id", authHandler.DeleteUser)                  // Delete user
+		userManagement.PUT("/:id/status", authHandler.UpdateUserStatus)        // Update user status
+
+		// Session management
+		userManagement.GET("/:id/sessions", authHandler.ListUserSessions)   // List active sessions of the user
+		userManagement.POST("/:id/logout", authHandler.ForceLogoutUser)     // Revoke all sessions of the user
+		userManagement.GET("/:id/login-logs", authHandler.GetUserLoginLogs) // Login history of the user
+
+		// Impersonation for support, only from the admin's own session
+		userManagement.POST("/:id/impersonate", NotImpersonated(), authHandler.ImpersonateUser) // Act as the user
+		userManagement.GET("/:id/impersonation-logs", authHandler.GetImpersonationLogs)         // Impersonation audit log
 	}
 
 	// System management routes (admin and operator)
@@ -61,6 +90,24 @@ func SetupAuthRoutes(r *gin.Engine) {
 	{
 		system.POST("/cleanup-sessions", cleanupExpiredSessions) // Clean up expired sessions
 		system.GET("/stats", getSystemStats)                     // Get system statistics
+		system.GET("/password-hashes", getPasswordHashReport)    // Accounts by password hash parameters
+		system.GET("/jobs", listJobs)                            // Background job status
+		system.POST("/jobs/:name/run", triggerJob)               // Run a background job now
+	}
+
+	// Machine-readable API description
+	r.GET(openapi.SpecPath, openapi.GinHandler(NewOpenAPIGenerator(), r))
+}
+
+// SetupInternalRoutes sets up routes called by the other services, protected by service tokens
+func SetupInternalRoutes(r *gin.Engine, verifier *serviceauth.Verifier) {
+	authHandler := NewAuthHandler()
+
+	internalAPI := r.Group("/api/v1/internal")
+	internalAPI.Use(serviceauth.GinMiddleware(verifier))
+	{
+		internalAPI.POST("/introspect", authHandler.Introspect) // Token introspection for trusted services
+		internalAPI.GET("/users/:id", authHandler.GetUser)      // User lookup
 	}
 }
 
@@ -77,7 +124,10 @@ func getAuthServiceInfo(c *gin.Context) {
 				"public": []string{
 					"POST /api/v1/auth/register",
 					"POST /api/v1/auth/login",
+					"POST /api/v1/auth/login/verify",
+					"POST /api/v1/auth/introspect",
 					"GET  /api/v1/auth/health",
+					"GET  /openapi.json",
 				},
 				"authenticated": []string{
 					"POST /api/v1/auth/logout",
@@ -85,14 +135,33 @@ func getAuthServiceInfo(c *gin.Context) {
 					"PUT  /api/v1/auth/profile",
 					"POST /api/v1/auth/change-password",
 					"GET  /api/v1/auth/login-logs",
+					"GET  /api/v1/auth/settings",
+					"PUT  /api/v1/auth/settings",
+					"GET  /api/v1/auth/sessions",
+					"DELETE /api/v1/auth/sessions",
+					"DELETE /api/v1/auth/sessions/:id",
 				},
 				"admin_only": []string{
 					"GET    /api/v1/users",
 					"POST   /api/v1/users",
+					"POST   /api/v1/users/batch",
+					"PUT    /api/v1/users/batch/status",
 					"GET    /api/v1/users/:id",
 					"PUT    /api/v1/users/:id",
 					"DELETE /api/v1/users/:id",
 					"PUT    /api/v1/users/:id/status",
+					"GET    /api/v1/users/:id/sessions",
+					"POST   /api/v1/users/:id/logout",
+					"GET    /api/v1/users/:id/login-logs",
+					"POST   /api/v1/users/:id/impersonate",
+					"GET    /api/v1/users/:id/impersonation-logs",
+				},
+				"admin_or_operator": []string{
+					"POST /api/v1/system/cleanup-sessions",
+					"GET  /api/v1/system/stats",
+					"GET  /api/v1/system/password-hashes",
+					"GET  /api/v1/system/jobs",
+					"POST /api/v1/system/jobs/:name/run",
 				},
 			},
 			"features": []string{
@@ -102,7 +171,12 @@ func getAuthServiceInfo(c *gin.Context) {
 				"Password management",
 				"User profile management",
 				"Login audit logs",
+				"Session management and forced logout",
+				"User preferences and notification settings",
+				"Token introspection for other services",
 				"User management (admin)",
+				"Audited admin impersonation of users",
+				"Pluggable password hashing (bcrypt, argon2id) with rehash on login",
 			},
 		},
 	}
@@ -189,6 +263,116 @@ func cleanupExpiredSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// listJobs status of the background jobs of the auth service
+func listJobs(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Jobs retrieved successfully",
+		Data:    internal.Jobs.Jobs(),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// triggerJob runs a background job now, its outcome shows in the job status
+func triggerJob(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	if err := internal.Jobs.Trigger(c.Param("name")); err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "internal_error"
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		case errors.Is(err, jobs.ErrJobRunning):
+			statusCode = http.StatusConflict
+			errorType = "job_running"
+		}
+		response := AuthResponse{
+			Code:    statusCode,
+			Message: "Failed to trigger job",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	status, _ := internal.Jobs.Job(c.Param("name"))
+	response := AuthResponse{
+		Code:    http.StatusAccepted,
+		Message: "Job triggered",
+		Data:    status,
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// requireJobs answers 503 when the service runs no job scheduler
+func requireJobs(c *gin.Context) bool {
+	if internal.Jobs != nil {
+		return true
+	}
+	response := AuthResponse{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Background jobs not available",
+		Error: &APIError{
+			Type:    "service_unavailable",
+			Code:    "503",
+			Message: "this service runs no background jobs",
+		},
+	}
+	c.JSON(http.StatusServiceUnavailable, response)
+	return false
+}
+
+// getPasswordHashReport reports how many accounts use outdated password hash parameters
+func getPasswordHashReport(c *gin.Context) {
+	if internal.DB == nil {
+		response := AuthResponse{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Database not available",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "503",
+				Message: "Database connection not established",
+			},
+		}
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+
+	report, err := internal.NewUserService().GetPasswordHashReport()
+	if err != nil {
+		response := AuthResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to build password hash report",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := AuthResponse{
+		Code:    http.StatusOK,
+		Message: "Password hash report retrieved successfully",
+		Data:    report,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // getSystemStats gets system statistics
 func getSystemStats(c *gin.Context) {
 	if internal.DB == nil {
@@ -243,6 +427,20 @@ func getSystemStats(c *gin.Context) {
 	internal.DB.Model(&internal.UserLoginLog{}).Where("success = ?", false).Count(&loginStats.FailedLogins)
 	internal.DB.Model(&internal.UserLoginLog{}).Where("created_at >= ?", today).Count(&loginStats.LoginsToday)
 
+	// Upstream provider incidents, as last polled by control flow
+	providerStats := struct {
+		Incidents int                       `json:"incidents"`
+		Statuses  []internal.ProviderStatus `json:"statuses"`
+	}{Statuses: []internal.ProviderStatus{}}
+	if statuses, err := internal.NewProviderStatusService().ListProviderStatuses(c.Request.Context()); err == nil {
+		providerStats.Statuses = statuses
+		for i := range statuses {
+			if statuses[i].HasIncident() {
+				providerStats.Incidents++
+			}
+		}
+	}
+
 	response := AuthResponse{
 		Code:    http.StatusOK,
 		Message: "System statistics retrieved successfully",
@@ -250,6 +448,7 @@ func getSystemStats(c *gin.Context) {
 			"users":     userStats,
 			"sessions":  sessionStats,
 			"logins":    loginStats,
+			"providers": providerStats,
 			"timestamp": time.Now().Unix(),
 		},
 	}
@@ -11,6 +11,12 @@ import (
 // UserContextKey user context key
 const UserContextKey = "current_user"
 
+// ImpersonatorContextKey admin acting as the current user, only set on impersonation sessions
+const ImpersonatorContextKey = "impersonator"
+
+// ImpersonatedByHeader names the impersonating admin on responses to impersonation sessions
+const ImpersonatedByHeader = "X-Impersonated-By"
+
 // AuthMiddleware authentication middleware
 func AuthMiddleware() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -47,6 +53,22 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// The session only works from the client it was issued to
+		if err := userService.CheckSessionBinding(session, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+			response := AuthResponse{
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid or expired token",
+				Error: &APIError{
+					Type:    "authentication_error",
+					Code:    "401",
+					Message: err.Error(),
+				},
+			}
+			c.JSON(http.StatusUnauthorized, response)
+			c.Abort()
+			return
+		}
+
 		// Check user status
 		if !session.User.IsActive() {
 			response := AuthResponse{
@@ -65,7 +87,35 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// Store user information in context
 		c.Set(UserContextKey, &session.User)
+		userService.TouchSession(session, c.ClientIP())
+
+		if !session.IsImpersonated() {
+			c.Next()
+			return
+		}
+
+		// The session ends as soon as the admin loses the right to impersonate
+		if session.ImpersonationRevoked() {
+			userService.DeleteSession(session.Token)
+			response := AuthResponse{
+				Code:    http.StatusUnauthorized,
+				Message: "Invalid or expired token",
+				Error: &APIError{
+					Type:    "authentication_error",
+					Code:    "401",
+					Message: "impersonating admin is no longer allowed to impersonate",
+				},
+			}
+			c.JSON(http.StatusUnauthorized, response)
+			c.Abort()
+			return
+		}
+
+		// Every request of an impersonation session is tagged and audited
+		c.Set(ImpersonatorContextKey, session.Impersonator)
+		c.Header(ImpersonatedByHeader, session.Impersonator.Username)
 		c.Next()
+		userService.LogImpersonation(session, "request", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP())
 	})
 }
 
@@ -154,6 +204,29 @@ func RequirePermission(permission string) gin.HandlerFunc {
 	})
 }
 
+// NotImpersonated reject requests of impersonation sessions, for actions only the
+// user themselves may take
+func NotImpersonated() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if GetImpersonator(c) != nil {
+			response := AuthResponse{
+				Code:    http.StatusForbidden,
+				Message: "Not allowed while impersonating",
+				Error: &APIError{
+					Type:    "authorization_error",
+					Code:    "403",
+					Message: "This action is not available to impersonation sessions",
+				},
+			}
+			c.JSON(http.StatusForbidden, response)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
 // AdminOnly only admin middleware
 func AdminOnly() gin.HandlerFunc {
 	return RequireRole(internal.UserRoleAdmin)
@@ -171,8 +244,12 @@ func OptionalAuth() gin.HandlerFunc {
 		if token != "" {
 			userService := internal.NewUserService()
 			session, err := userService.GetSessionByToken(token)
-			if err == nil && session.User.IsActive() {
+			if err == nil && session.User.IsActive() && !session.ImpersonationRevoked() &&
+				userService.CheckSessionBinding(session, c.ClientIP(), c.GetHeader("User-Agent")) == nil {
 				c.Set(UserContextKey, &session.User)
+				if session.IsImpersonated() {
+					c.Set(ImpersonatorContextKey, session.Impersonator)
+				}
 			}
 		}
 		c.Next()
@@ -212,6 +289,16 @@ func GetCurrentUser(c *gin.Context) *internal.User {
 	return nil
 }
 
+// GetImpersonator get the admin acting as the current user, nil for regular sessions
+func GetImpersonator(c *gin.Context) *internal.User {
+	if impersonator, exists := c.Get(ImpersonatorContextKey); exists {
+		if u, ok := impersonator.(*internal.User); ok {
+			return u
+		}
+	}
+	return nil
+}
+
 // GetCurrentUserID get current logged in user ID
 func GetCurrentUserID(c *gin.Context) uint {
 	user := GetCurrentUser(c)
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"net/http"
+
+	"agent-connector/internal"
+	"agent-connector/pkg/jobs"
+	"agent-connector/pkg/openapi"
+	"agent-connector/pkg/serviceauth"
+)
+
+// NewOpenAPIGenerator describe the authentication API endpoints
+func NewOpenAPIGenerator() *openapi.Generator {
+	g := openapi.NewGenerator("Auth API", "1.0.0", "User authentication and management service")
+	g.AddSecurityScheme("bearerAuth", &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "Session token returned by /api/v1/auth/login",
+	})
+	g.AddSecurityScheme("serviceToken", &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        serviceauth.HeaderName,
+		Description: "Signed service-to-service token",
+	})
+
+	bearer := []string{"bearerAuth"}
+	authTags := []string{"Authentication"}
+	userTags := []string{"Users"}
+
+	g.Describe(http.MethodPost, "/api/v1/auth/register", openapi.Endpoint{
+		Summary: "Register a user", Tags: authTags, Request: RegisterRequest{}, Response: UserResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodPost, "/api/v1/auth/login", openapi.Endpoint{
+		Summary: "Log in and obtain a session token, 403 with a challenge when an unusual login needs verification", Tags: authTags, Request: LoginRequest{}, Response: LoginResponse{},
+	})
+	g.Describe(http.MethodPost, "/api/v1/auth/login/verify", openapi.Endpoint{
+		Summary: "Complete a login held back as unusual with the mailed code", Tags: authTags, Request: VerifyLoginRequest{}, Response: LoginResponse{},
+	})
+	g.Describe(http.MethodPost, "/api/v1/auth/introspect", openapi.Endpoint{
+		Summary: "Validate a session token", Tags: authTags, Request: IntrospectRequest{}, Response: IntrospectResponse{},
+	})
+	g.Describe(http.MethodPost, "/api/v1/auth/logout", openapi.Endpoint{
+		Summary: "Log out", Tags: authTags, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/auth/profile", openapi.Endpoint{
+		Summary: "Get the profile of the current user", Tags: authTags, Response: UserProfileResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPut, "/api/v1/auth/profile", openapi.Endpoint{
+		Summary: "Update the profile of the current user, 409 with the current profile when version is stale", Tags: authTags, Request: UpdateProfileRequest{}, Response: UserResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPost, "/api/v1/auth/change-password", openapi.Endpoint{
+		Summary: "Change the password of the current user", Tags: authTags, Request: ChangePasswordRequest{}, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/auth/login-logs", openapi.Endpoint{
+		Summary: "List login logs of the current user", Tags: authTags, Response: LoginLogResponse{}, Paginated: true, Security: bearer,
+		Query: []*openapi.Parameter{
+			openapi.QueryParam("page", "integer", "page number, starts at 1"),
+			openapi.QueryParam("page_size", "integer", "items per page, at most 100"),
+			openapi.QueryParam("from", "string", "start of the time range, RFC 3339 or YYYY-MM-DD"),
+			openapi.QueryParam("to", "string", "end of the time range, exclusive, RFC 3339 or YYYY-MM-DD"),
+			openapi.QueryParam("result", "string", "success or failure"),
+			openapi.QueryParam("ip", "string", "part of the client IP"),
+			openapi.QueryParam("format", "string", "csv exports the matching logs as a CSV attachment"),
+		},
+	})
+	g.Describe(http.MethodGet, "/api/v1/auth/settings", openapi.Endpoint{
+		Summary: "Get the settings of the current user", Tags: authTags, Response: SettingsResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPut, "/api/v1/auth/settings", openapi.Endpoint{
+		Summary: "Update the settings of the current user", Tags: authTags, Request: UpdateSettingsRequest{}, Response: SettingsResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/auth/sessions", openapi.Endpoint{
+		Summary: "List the active sessions of the current user", Tags: authTags, Response: []SessionResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodDelete, "/api/v1/auth/sessions", openapi.Endpoint{
+		Summary: "Revoke all sessions of the current user except this one", Tags: authTags, Response: RevokeSessionsResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodDelete, "/api/v1/auth/sessions/:id", openapi.Endpoint{
+		Summary: "Revoke a session of the current user", Tags: authTags, Security: bearer,
+	})
+
+	g.Describe(http.MethodGet, "/api/v1/users", openapi.Endpoint{
+		Summary: "List users", Tags: userTags, Response: UserResponse{}, Paginated: true, Security: bearer,
+		Query: []*openapi.Parameter{
+			openapi.QueryParam("page", "integer", "page number, starts at 1"),
+			openapi.QueryParam("page_size", "integer", "items per page, at most 100"),
+			openapi.QueryParam("search", "string", "substring match on username, email and full name"),
+			openapi.QueryParam("status", "string", "active, inactive, blocked or pending"),
+			openapi.QueryParam("type", "string", "user role"),
+			openapi.QueryParam("sort_by", "string", "username, email, role, status, last_login or created_at"),
+			openapi.QueryParam("order", "string", "asc or desc"),
+			openapi.QueryParam("created_after", "string", "RFC 3339 timestamp or YYYY-MM-DD"),
+		},
+	})
+	g.Describe(http.MethodPost, "/api/v1/users", openapi.Endpoint{
+		Summary: "Create user", Tags: userTags, Request: CreateUserRequest{}, Response: UserResponse{}, Status: http.StatusCreated, Security: bearer,
+	})
+	g.Describe(http.MethodPost, "/api/v1/users/batch", openapi.Endpoint{
+		Summary: "Create users in bulk", Tags: userTags, Request: BatchCreateUsersRequest{}, Response: BatchResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPut, "/api/v1/users/batch/status", openapi.Endpoint{
+		Summary: "Update the status of users in bulk", Tags: userTags, Request: BatchUserStatusRequest{}, Response: BatchResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/users/:id", openapi.Endpoint{
+		Summary: "Get user", Tags: userTags, Response: UserResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPut, "/api/v1/users/:id", openapi.Endpoint{
+		Summary: "Update user, 409 with the current user when version is stale", Tags: userTags, Request: UpdateUserRequest{}, Response: UserResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodDelete, "/api/v1/users/:id", openapi.Endpoint{
+		Summary: "Delete user", Tags: userTags, Security: bearer,
+	})
+	g.Describe(http.MethodPut, "/api/v1/users/:id/status", openapi.Endpoint{
+		Summary: "Update user status", Tags: userTags, Request: UpdateUserStatusRequest{}, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/users/:id/sessions", openapi.Endpoint{
+		Summary: "List the active sessions of a user", Tags: userTags, Response: []SessionResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPost, "/api/v1/users/:id/logout", openapi.Endpoint{
+		Summary: "Revoke all sessions of a user", Tags: userTags, Response: RevokeSessionsResponse{}, Security: bearer,
+	})
+	g.Describe(http.MethodPost, "/api/v1/users/:id/impersonate", openapi.Endpoint{
+		Summary: "Issue a short-lived session to act as the user", Tags: userTags,
+		Request: ImpersonateRequest{}, Response: ImpersonationResponse{}, Status: http.StatusCreated, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/users/:id/login-logs", openapi.Endpoint{
+		Summary: "List login logs of a user", Tags: userTags, Response: LoginLogResponse{}, Paginated: true, Security: bearer,
+		Query: []*openapi.Parameter{
+			openapi.QueryParam("page", "integer", "page number, starts at 1"),
+			openapi.QueryParam("page_size", "integer", "items per page, at most 100"),
+			openapi.QueryParam("from", "string", "start of the time range, RFC 3339 or YYYY-MM-DD"),
+			openapi.QueryParam("to", "string", "end of the time range, exclusive, RFC 3339 or YYYY-MM-DD"),
+			openapi.QueryParam("result", "string", "success or failure"),
+			openapi.QueryParam("ip", "string", "part of the client IP"),
+			openapi.QueryParam("format", "string", "csv exports the matching logs as a CSV attachment"),
+		},
+	})
+	g.Describe(http.MethodGet, "/api/v1/users/:id/impersonation-logs", openapi.Endpoint{
+		Summary: "List the impersonation audit log of a user", Tags: userTags, Response: ImpersonationLogResponse{}, Paginated: true, Security: bearer,
+		Query: []*openapi.Parameter{
+			openapi.QueryParam("page", "integer", "page number, starts at 1"),
+			openapi.QueryParam("page_size", "integer", "items per page, at most 100"),
+		},
+	})
+
+	g.Describe(http.MethodGet, "/api/v1/system/password-hashes", openapi.Endpoint{
+		Summary: "Count accounts by password hash algorithm and parameters, outdated hashes are replaced on next login", Tags: []string{"System"},
+		Response: internal.PasswordHashReport{}, Security: bearer,
+	})
+	g.Describe(http.MethodGet, "/api/v1/system/jobs", openapi.Endpoint{
+		Summary: "Status of the auth background jobs: schedule, next run, last error and recent runs", Tags: []string{"System"},
+		Response: []jobs.Status{}, Security: bearer,
+	})
+	g.Describe(http.MethodPost, "/api/v1/system/jobs/:name/run", openapi.Endpoint{
+		Summary: "Run a background job now, 409 while it is running", Tags: []string{"System"},
+		Response: jobs.Status{}, Status: http.StatusAccepted, Security: bearer,
+	})
+
+	g.Describe(http.MethodPost, "/api/v1/internal/introspect", openapi.Endpoint{
+		Summary: "Validate a session token on behalf of another service", Tags: []string{"Internal"},
+		Request: IntrospectRequest{}, Response: IntrospectResponse{}, Security: []string{"serviceToken"},
+	})
+	g.Describe(http.MethodGet, "/api/v1/internal/users/:id", openapi.Endpoint{
+		Summary: "Get user on behalf of another service", Tags: []string{"Internal"},
+		Response: UserResponse{}, Security: []string{"serviceToken"},
+	})
+
+	return g
+}
@@ -59,6 +59,19 @@ type LoginResponse struct {
 	User      UserResponse `json:"user"`
 }
 
+// LoginChallengeResponse an unusual login waiting for the code mailed to the user
+type LoginChallengeResponse struct {
+	ChallengeID string    `json:"challenge_id"`
+	Anomalies   []string  `json:"anomalies"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// VerifyLoginRequest complete an unusual login with the mailed code
+type VerifyLoginRequest struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	Code        string `json:"code" binding:"required,max=16"`
+}
+
 // ChangePasswordRequest change password request
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
@@ -70,6 +83,7 @@ type UpdateProfileRequest struct {
 	FullName string `json:"full_name,omitempty" binding:"max=100"`
 	Email    string `json:"email,omitempty" binding:"omitempty,email"`
 	Avatar   string `json:"avatar,omitempty" binding:"max=255"`
+	Version  *int   `json:"version,omitempty" binding:"omitempty,min=1"` // version the changes are based on, omit to skip the check
 }
 
 // UserResponse user information response
@@ -82,6 +96,9 @@ type UserResponse struct {
 	Role      string     `json:"role"`
 	Status    string     `json:"status"`
 	LastLogin *time.Time `json:"last_login"`
+	Priority  int        `json:"priority"` // queue priority of the user's dataflow requests
+	QPS       *int       `json:"qps"`      // QPS of the user's requests to each agent, null uses the defaults
+	Version   int        `json:"version"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 }
@@ -94,6 +111,8 @@ type CreateUserRequest struct {
 	FullName string `json:"full_name" binding:"max=100"`
 	Role     string `json:"role" binding:"required,oneof=admin operator user readonly"`
 	Status   string `json:"status" binding:"required,oneof=active inactive blocked pending"`
+	Priority *int   `json:"priority,omitempty" binding:"omitempty,min=0,max=100"` // queue priority, the system default when left out
+	QPS      *int   `json:"qps,omitempty" binding:"omitempty,min=1"`              // QPS per agent, the system default when left out
 }
 
 // UpdateUserRequest update user request (admin function)
@@ -104,6 +123,9 @@ type UpdateUserRequest struct {
 	Role     *string `json:"role,omitempty" binding:"omitempty,oneof=admin operator user readonly"`
 	Status   *string `json:"status,omitempty" binding:"omitempty,oneof=active inactive blocked pending"`
 	Avatar   *string `json:"avatar,omitempty" binding:"omitempty,max=255"`
+	Priority *int    `json:"priority,omitempty" binding:"omitempty,min=0,max=100"`
+	QPS      *int    `json:"qps,omitempty" binding:"omitempty,min=0"`     // 0 clears the override
+	Version  *int    `json:"version,omitempty" binding:"omitempty,min=1"` // version the changes are based on, omit to skip the check
 }
 
 // UpdateUserStatusRequest update user status request
@@ -111,6 +133,46 @@ type UpdateUserStatusRequest struct {
 	Status string `json:"status" binding:"required,oneof=active inactive blocked pending"`
 }
 
+// BatchCreateUsersRequest create several users at once (admin function)
+type BatchCreateUsersRequest struct {
+	Users []CreateUserRequest `json:"users" binding:"required,min=1,max=500"`
+}
+
+// BatchUserStatusRequest update the status of several users at once (admin function)
+type BatchUserStatusRequest struct {
+	IDs    []uint `json:"ids" binding:"required,min=1,max=500"`
+	Status string `json:"status" binding:"required,oneof=active inactive blocked pending"`
+}
+
+// BatchItemResult outcome of one item of a batch request
+type BatchItemResult struct {
+	Index   int    `json:"index"`
+	ID      uint   `json:"id,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchResponse per-item results of a batch request
+type BatchResponse struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// Add record the outcome of one item
+func (r *BatchResponse) Add(index int, id uint, err error) {
+	result := BatchItemResult{Index: index, ID: id, Success: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+		r.Failed++
+	} else {
+		r.Succeeded++
+	}
+	r.Total++
+	r.Results = append(r.Results, result)
+}
+
 // LoginLogResponse login log response
 type LoginLogResponse struct {
 	ID        uint      `json:"id"`
@@ -119,6 +181,8 @@ type LoginLogResponse struct {
 	UserAgent string    `json:"user_agent"`
 	Success   bool      `json:"success"`
 	Message   string    `json:"message"`
+	Country   string    `json:"country,omitempty"`
+	Anomalies string    `json:"anomalies,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -144,6 +208,102 @@ type SessionInfoResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 	IsExpired bool      `json:"is_expired"`
+
+	// Set on impersonation sessions
+	ImpersonatedBy      string `json:"impersonated_by,omitempty"`
+	ImpersonationReason string `json:"impersonation_reason,omitempty"`
+}
+
+// SessionResponse active session of a user, without its token
+type SessionResponse struct {
+	ID             uint       `json:"id"`
+	Device         string     `json:"device"`
+	IP             string     `json:"ip"`
+	UserAgent      string     `json:"user_agent"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActiveAt   *time.Time `json:"last_active_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	Current        bool       `json:"current"`
+	ImpersonatedBy string     `json:"impersonated_by,omitempty"`
+}
+
+// RevokeSessionsResponse number of revoked sessions
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// UpdateSettingsRequest update user settings request, omitted fields keep their value
+// and empty strings clear a default
+type UpdateSettingsRequest struct {
+	DefaultAgentID       *string `json:"default_agent_id" binding:"omitempty,max=100"`
+	DefaultModel         *string `json:"default_model" binding:"omitempty,max=100"`
+	Locale               *string `json:"locale" binding:"omitempty,max=35"`
+	EmailSecurityNotices *bool   `json:"email_security_notices"`
+}
+
+// SettingsResponse user settings
+type SettingsResponse struct {
+	DefaultAgentID       string     `json:"default_agent_id"`
+	DefaultModel         string     `json:"default_model"`
+	Locale               string     `json:"locale"`
+	EmailSecurityNotices bool       `json:"email_security_notices"`
+	UpdatedAt            *time.Time `json:"updated_at,omitempty"`
+}
+
+// ImpersonateRequest impersonation session request
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// ImpersonationResponse impersonation session, the token acts as the user until it expires
+type ImpersonationResponse struct {
+	Token          string       `json:"token"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	User           UserResponse `json:"user"`
+	ImpersonatorID uint         `json:"impersonator_id"`
+	Reason         string       `json:"reason"`
+}
+
+// ImpersonationLogResponse impersonation audit log entry
+type ImpersonationLogResponse struct {
+	ID             uint      `json:"id"`
+	SessionID      uint      `json:"session_id"`
+	ImpersonatorID uint      `json:"impersonator_id"`
+	UserID         uint      `json:"user_id"`
+	Action         string    `json:"action"`
+	Method         string    `json:"method,omitempty"`
+	Path           string    `json:"path,omitempty"`
+	Status         int       `json:"status,omitempty"`
+	IP             string    `json:"ip"`
+	Reason         string    `json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// IntrospectRequest token introspection request, accepts JSON or form body
+type IntrospectRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+
+	// Client that presented the token, forwarded by the calling service so bound
+	// sessions are checked; the binding is only checked when client_ip is set
+	ClientIP  string `json:"client_ip,omitempty" form:"client_ip"`
+	UserAgent string `json:"user_agent,omitempty" form:"user_agent"`
+}
+
+// IntrospectResponse token introspection result, inactive tokens only carry Active=false
+type IntrospectResponse struct {
+	Active          bool       `json:"active"`
+	UserID          uint       `json:"user_id,omitempty"`
+	Username        string     `json:"username,omitempty"`
+	Email           string     `json:"email,omitempty"`
+	Role            string     `json:"role,omitempty"`
+	Status          string     `json:"status,omitempty"`
+	CanManageUsers  bool       `json:"can_manage_users,omitempty"`
+	CanManageSystem bool       `json:"can_manage_system,omitempty"`
+	IssuedAt        *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn       int64      `json:"expires_in,omitempty"` // seconds until expiry
+	ImpersonatorID  uint       `json:"impersonator_id,omitempty"`
+	ImpersonatedBy  string     `json:"impersonated_by,omitempty"`
 }
 
 // ConvertFromInternalUser convert from internal user model to response structure
@@ -157,6 +317,9 @@ func ConvertFromInternalUser(user *internal.User) *UserResponse {
 		Role:      string(user.Role),
 		Status:    string(user.Status),
 		LastLogin: user.LastLogin,
+		Priority:  user.EffectivePriority(),
+		QPS:       user.QPS,
+		Version:   user.Version,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 	}
@@ -183,6 +346,8 @@ func ConvertToInternalUserFromCreateRequest(req *CreateUserRequest) *internal.Us
 		FullName: req.FullName,
 		Role:     internal.UserRole(req.Role),
 		Status:   internal.UserStatus(req.Status),
+		Priority: req.Priority,
+		QPS:      req.QPS,
 	}
 }
 
@@ -206,6 +371,18 @@ func UpdateInternalUserFromRequest(user *internal.User, req *UpdateUserRequest)
 	if req.Avatar != nil {
 		user.Avatar = *req.Avatar
 	}
+	if req.Priority != nil {
+		user.Priority = req.Priority
+	}
+	if req.QPS != nil {
+		user.QPS = req.QPS
+		if *req.QPS == 0 {
+			user.QPS = nil
+		}
+	}
+	if req.Version != nil {
+		user.Version = *req.Version
+	}
 }
 
 // UpdateInternalUserFromProfileRequest update internal user model with personal information update request data
@@ -219,6 +396,9 @@ func UpdateInternalUserFromProfileRequest(user *internal.User, req *UpdateProfil
 	if req.Avatar != "" {
 		user.Avatar = req.Avatar
 	}
+	if req.Version != nil {
+		user.Version = *req.Version
+	}
 }
 
 // ConvertFromInternalUserList convert from internal user model list to response list
@@ -239,6 +419,8 @@ func ConvertFromInternalLoginLog(log *internal.UserLoginLog) *LoginLogResponse {
 		UserAgent: log.UserAgent,
 		Success:   log.Success,
 		Message:   log.Message,
+		Country:   log.Country,
+		Anomalies: log.Anomalies,
 		CreatedAt: log.CreatedAt,
 	}
 }
@@ -254,10 +436,116 @@ func ConvertFromInternalLoginLogList(logs []*internal.UserLoginLog) []*LoginLogR
 
 // ConvertFromInternalSession convert from internal session model to session information response
 func ConvertFromInternalSession(session *internal.UserSession) *SessionInfoResponse {
-	return &SessionInfoResponse{
+	info := &SessionInfoResponse{
 		Token:     session.Token,
 		CreatedAt: session.CreatedAt,
 		ExpiresAt: session.ExpiresAt,
 		IsExpired: session.IsExpired(),
 	}
+	if session.Impersonator != nil {
+		info.ImpersonatedBy = session.Impersonator.Username
+		info.ImpersonationReason = session.ImpersonationReason
+	}
+	return info
+}
+
+// ConvertFromInternalSettings convert from internal user settings to response structure
+func ConvertFromInternalSettings(settings *internal.UserSettings) *SettingsResponse {
+	response := &SettingsResponse{
+		DefaultAgentID:       settings.DefaultAgentID,
+		DefaultModel:         settings.DefaultModel,
+		Locale:               settings.Locale,
+		EmailSecurityNotices: settings.EmailSecurityNotices,
+	}
+	if settings.ID != 0 {
+		response.UpdatedAt = &settings.UpdatedAt
+	}
+	return response
+}
+
+// UpdateInternalSettingsFromRequest apply the fields set in the request to the settings
+func UpdateInternalSettingsFromRequest(settings *internal.UserSettings, req *UpdateSettingsRequest) {
+	if req.DefaultAgentID != nil {
+		settings.DefaultAgentID = *req.DefaultAgentID
+	}
+	if req.DefaultModel != nil {
+		settings.DefaultModel = *req.DefaultModel
+	}
+	if req.Locale != nil {
+		settings.Locale = *req.Locale
+	}
+	if req.EmailSecurityNotices != nil {
+		settings.EmailSecurityNotices = *req.EmailSecurityNotices
+	}
+}
+
+// ConvertFromInternalSessionList convert sessions to responses, marking the one with currentToken
+func ConvertFromInternalSessionList(sessions []*internal.UserSession, currentToken string) []*SessionResponse {
+	result := make([]*SessionResponse, len(sessions))
+	for i, session := range sessions {
+		result[i] = &SessionResponse{
+			ID:           session.ID,
+			Device:       session.Device(),
+			IP:           session.IP,
+			UserAgent:    session.UserAgent,
+			CreatedAt:    session.CreatedAt,
+			LastActiveAt: session.LastActiveAt,
+			ExpiresAt:    session.ExpiresAt,
+			Current:      session.Token == currentToken,
+		}
+		if session.Impersonator != nil {
+			result[i].ImpersonatedBy = session.Impersonator.Username
+		}
+	}
+	return result
+}
+
+// ConvertFromInternalImpersonationLog convert from internal impersonation log model to response structure
+func ConvertFromInternalImpersonationLog(log *internal.ImpersonationLog) *ImpersonationLogResponse {
+	return &ImpersonationLogResponse{
+		ID:             log.ID,
+		SessionID:      log.SessionID,
+		ImpersonatorID: log.ImpersonatorID,
+		UserID:         log.UserID,
+		Action:         log.Action,
+		Method:         log.Method,
+		Path:           log.Path,
+		Status:         log.Status,
+		IP:             log.IP,
+		Reason:         log.Reason,
+		CreatedAt:      log.CreatedAt,
+	}
+}
+
+// ConvertFromInternalImpersonationLogList convert from internal impersonation log list to response list
+func ConvertFromInternalImpersonationLogList(logs []*internal.ImpersonationLog) []*ImpersonationLogResponse {
+	result := make([]*ImpersonationLogResponse, len(logs))
+	for i, log := range logs {
+		result[i] = ConvertFromInternalImpersonationLog(log)
+	}
+	return result
+}
+
+// ConvertSessionToIntrospection convert an active session to introspection result
+func ConvertSessionToIntrospection(session *internal.UserSession) *IntrospectResponse {
+	introspection := &IntrospectResponse{
+		Active:          true,
+		UserID:          session.User.ID,
+		Username:        session.User.Username,
+		Email:           session.User.Email,
+		Role:            string(session.User.Role),
+		Status:          string(session.User.Status),
+		CanManageUsers:  session.User.CanManageUser(),
+		CanManageSystem: session.User.CanManageSystem(),
+		IssuedAt:        &session.CreatedAt,
+		ExpiresAt:       &session.ExpiresAt,
+		ExpiresIn:       int64(time.Until(session.ExpiresAt).Seconds()),
+	}
+	if session.IsImpersonated() {
+		introspection.ImpersonatorID = *session.ImpersonatorID
+		if session.Impersonator != nil {
+			introspection.ImpersonatedBy = session.Impersonator.Username
+		}
+	}
+	return introspection
 }
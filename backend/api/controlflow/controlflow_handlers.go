@@ -1,13 +1,32 @@
 package controlflow
 
 import (
+	"agent-connector/api/dataflow"
+	"agent-connector/config"
 	"agent-connector/internal"
+	"agent-connector/pkg/acl"
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/jobs"
+	"agent-connector/pkg/mergepatch"
+	"agent-connector/pkg/queue"
+	"agent-connector/pkg/quota"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/redis/go-redis/v9"
 )
 
 var startTime = time.Now()
@@ -68,6 +87,24 @@ func (h *DashboardSystemConfigHandler) UpdateSystemConfig(c *gin.Context) {
 
 	config := ConvertToInternalSystemConfig(&req)
 	err := h.service.UpdateSystemConfig(config)
+	if errors.Is(err, internal.ErrVersionConflict) {
+		current, getErr := h.service.GetSystemConfig()
+		if getErr == nil {
+			response := ControlFlowResponse{
+				Code:    http.StatusConflict,
+				Message: "System config was changed by someone else",
+				Data:    ConvertFromInternalSystemConfig(current),
+				Error: &APIError{
+					Type:    "version_conflict",
+					Code:    "409",
+					Message: err.Error(),
+				},
+			}
+			c.JSON(http.StatusConflict, response)
+			return
+		}
+		err = getErr
+	}
 	if err != nil {
 		response := ControlFlowResponse{
 			Code:    http.StatusInternalServerError,
@@ -106,6 +143,86 @@ func (h *DashboardSystemConfigHandler) UpdateSystemConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// PatchSystemConfig apply a JSON merge patch to the system configuration
+func (h *DashboardSystemConfigHandler) PatchSystemConfig(c *gin.Context) {
+	current, err := h.service.GetSystemConfig()
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get system config",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	req := ConvertToSystemConfigRequest(current)
+	if err := bindMergePatch(c, req); err != nil {
+		respondMergePatchError(c, err)
+		return
+	}
+
+	config := ConvertToInternalSystemConfig(req)
+	err = h.service.UpdateSystemConfig(config)
+	if errors.Is(err, internal.ErrVersionConflict) {
+		current, getErr := h.service.GetSystemConfig()
+		if getErr == nil {
+			response := ControlFlowResponse{
+				Code:    http.StatusConflict,
+				Message: "System config was changed by someone else",
+				Data:    ConvertFromInternalSystemConfig(current),
+				Error: &APIError{
+					Type:    "version_conflict",
+					Code:    "409",
+					Message: err.Error(),
+				},
+			}
+			c.JSON(http.StatusConflict, response)
+			return
+		}
+		err = getErr
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update system config",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	updatedConfig, err := h.service.GetSystemConfig()
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get updated system config",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "System config updated successfully",
+		Data:    ConvertFromInternalSystemConfig(updatedConfig),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // DashboardAgentHandler Dashboard agent configuration handler
 type DashboardAgentHandler struct {
 	service *internal.AgentService
@@ -161,11 +278,16 @@ func (h *DashboardAgentHandler) GetAgent(c *gin.Context) {
 
 // ListAgents list agent configurations
 func (h *DashboardAgentHandler) ListAgents(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	search := c.Query("search")
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
 
-	agents, total, err := h.service.ListAgents(page, pageSize, search)
+	agents, total, err := h.service.ListAgents(listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
 	if err != nil {
 		response := ControlFlowResponse{
 			Code:    http.StatusInternalServerError,
@@ -180,7 +302,7 @@ func (h *DashboardAgentHandler) ListAgents(c *gin.Context) {
 		return
 	}
 
-	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
 
 	// in the list, you can choose to hide sensitive information
 	hideSecrets := c.Query("hide_secrets") == "true"
@@ -190,8 +312,8 @@ func (h *DashboardAgentHandler) ListAgents(c *gin.Context) {
 		Message: "Agents retrieved successfully",
 		Data:    ConvertFromInternalAgentList(agents, hideSecrets),
 		Pagination: PaginationInfo{
-			Page:       page,
-			PageSize:   pageSize,
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
 			Total:      total,
 			TotalPages: totalPages,
 		},
@@ -199,6 +321,30 @@ func (h *DashboardAgentHandler) ListAgents(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// bindListQuery parse search, filter, sort and pagination parameters, responds with 400 when invalid
+func bindListQuery(c *gin.Context) (*internal.ListQuery, bool) {
+	listQuery, err := internal.ParseListQuery(c.Request.URL.Query())
+	if err != nil {
+		respondWithListQueryError(c, err)
+		return nil, false
+	}
+	return listQuery, true
+}
+
+// respondWithListQueryError return the error for invalid list parameters
+func respondWithListQueryError(c *gin.Context, err error) {
+	response := ControlFlowResponse{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid list parameters",
+		Error: &APIError{
+			Type:    "validation_error",
+			Code:    "400",
+			Message: err.Error(),
+		},
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
 // CreateAgent create agent configuration
 func (h *DashboardAgentHandler) CreateAgent(c *gin.Context) {
 	var req AgentRequest
@@ -218,6 +364,9 @@ func (h *DashboardAgentHandler) CreateAgent(c *gin.Context) {
 
 	agent := ConvertToInternalAgent(&req)
 	err := h.service.CreateAgent(agent)
+	if respondAgentFieldError(c, err) {
+		return
+	}
 	if err != nil {
 		response := ControlFlowResponse{
 			Code:    http.StatusInternalServerError,
@@ -234,7 +383,7 @@ func (h *DashboardAgentHandler) CreateAgent(c *gin.Context) {
 
 	response := ControlFlowResponse{
 		Code:    http.StatusCreated,
-		Message: "Agent created successfully",
+		Message: "Agent created successfully, store the connector API key now: it will not be shown again",
 		Data:    ConvertFromInternalAgent(agent, false),
 	}
 	c.JSON(http.StatusCreated, response)
@@ -292,6 +441,27 @@ func (h *DashboardAgentHandler) UpdateAgent(c *gin.Context) {
 	UpdateInternalAgentFromRequest(agent, &req)
 
 	err = h.service.UpdateAgent(uint(id), agent)
+	if respondAgentFieldError(c, err) {
+		return
+	}
+	if errors.Is(err, internal.ErrVersionConflict) {
+		current, getErr := h.service.GetAgent(uint(id))
+		if getErr == nil {
+			response := ControlFlowResponse{
+				Code:    http.StatusConflict,
+				Message: "Agent was changed by someone else",
+				Data:    ConvertFromInternalAgent(current, false),
+				Error: &APIError{
+					Type:    "version_conflict",
+					Code:    "409",
+					Message: err.Error(),
+				},
+			}
+			c.JSON(http.StatusConflict, response)
+			return
+		}
+		err = getErr
+	}
 	if err != nil {
 		response := ControlFlowResponse{
 			Code:    http.StatusInternalServerError,
@@ -330,6 +500,105 @@ func (h *DashboardAgentHandler) UpdateAgent(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// PatchAgent apply a JSON merge patch to an agent configuration, so single fields can be
+// changed without sending the whole configuration
+func (h *DashboardAgentHandler) PatchAgent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid agent ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Agent ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	agent, err := h.service.GetAgent(uint(id))
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusNotFound,
+			Message: "Agent not found",
+			Error: &APIError{
+				Type:    "not_found",
+				Code:    "404",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	doc := ConvertToAgentPatchDocument(agent)
+	if err := bindMergePatch(c, doc); err != nil {
+		respondMergePatchError(c, err)
+		return
+	}
+	UpdateInternalAgentFromPatchDocument(agent, doc)
+
+	err = h.service.UpdateAgent(uint(id), agent)
+	if respondAgentFieldError(c, err) {
+		return
+	}
+	if errors.Is(err, internal.ErrVersionConflict) {
+		current, getErr := h.service.GetAgent(uint(id))
+		if getErr == nil {
+			response := ControlFlowResponse{
+				Code:    http.StatusConflict,
+				Message: "Agent was changed by someone else",
+				Data:    ConvertFromInternalAgent(current, false),
+				Error: &APIError{
+					Type:    "version_conflict",
+					Code:    "409",
+					Message: err.Error(),
+				},
+			}
+			c.JSON(http.StatusConflict, response)
+			return
+		}
+		err = getErr
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update agent",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	updatedAgent, err := h.service.GetAgent(uint(id))
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get updated agent",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Agent updated successfully",
+		Data:    ConvertFromInternalAgent(updatedAgent, false),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // DeleteAgent delete agent configuration
 func (h *DashboardAgentHandler) DeleteAgent(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -369,33 +638,2967 @@ func (h *DashboardAgentHandler) DeleteAgent(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// HealthCheck health check
-func HealthCheck(c *gin.Context) {
-	uptime := time.Since(startTime)
+// RotateConnectorAPIKey generate a new connector API key, the old key stops working immediately
+func (h *DashboardAgentHandler) RotateConnectorAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid agent ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Agent ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
 
-	// check database connection
-	dbStatus := DatabaseHealthStatus{Status: "ok"}
-	if internal.DB != nil {
-		sqlDB, err := internal.DB.DB()
-		if err != nil {
-			dbStatus.Status = "error"
-			dbStatus.Error = err.Error()
-		} else {
-			stats := sqlDB.Stats()
-			dbStatus.Connections = stats.OpenConnections
+	agent, err := h.service.RotateConnectorAPIKey(uint(id))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "agent not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
 		}
-	} else {
-		dbStatus.Status = "not_connected"
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to rotate connector API key",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
 	}
 
-	response := HealthCheckResponse{
-		Status:    "ok",
-		Service:   "control-flow-api",
-		Version:   "1.0.0",
-		Timestamp: time.Now().Unix(),
-		Uptime:    fmt.Sprintf("%.0f seconds", uptime.Seconds()),
-		Database:  dbStatus,
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Connector API key rotated, store it now: it will not be shown again",
+		Data:    ConvertFromInternalAgent(agent, false),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RotateSigningSecret generate a new HMAC secret for signed requests of the agent, the
+// old secret stops working immediately
+func (h *DashboardAgentHandler) RotateSigningSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid agent ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Agent ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	agent, err := h.service.RotateSigningSecret(uint(id))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "agent not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to rotate signing secret",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Signing secret rotated, store it now: it will not be shown again",
+		Data:    SigningSecretResponse{AgentID: agent.AgentID, SigningSecret: agent.SigningSecret},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAgentACL get the users, roles and keys allowed to call an agent
+func (h *DashboardAgentHandler) GetAgentACL(c *gin.Context) {
+	id, ok := agentIDParam(c)
+	if !ok {
+		return
+	}
+
+	agent, err := h.service.GetAgent(id)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusNotFound,
+			Message: "Agent not found",
+			Error: &APIError{
+				Type:    "not_found",
+				Code:    "404",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusNotFound, response)
+		return
 	}
 
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Access list retrieved successfully",
+		Data:    ConvertFromInternalAgentACL(agent),
+	}
 	c.JSON(http.StatusOK, response)
 }
+
+// UpdateAgentACL replace the access list of an agent, dataflow enforces it once the
+// agent lookup caches are invalidated
+func (h *DashboardAgentHandler) UpdateAgentACL(c *gin.Context) {
+	id, ok := agentIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req AgentACLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	h.saveAgentACL(c, id, acl.List{Users: req.Users, Roles: req.Roles, Keys: req.Keys}, "Access list updated successfully")
+}
+
+// DeleteAgentACL clear the access list of an agent, every caller with a valid key may
+// call it again
+func (h *DashboardAgentHandler) DeleteAgentACL(c *gin.Context) {
+	id, ok := agentIDParam(c)
+	if !ok {
+		return
+	}
+
+	h.saveAgentACL(c, id, acl.List{}, "Access list cleared successfully")
+}
+
+// saveAgentACL store the access list and write the response
+func (h *DashboardAgentHandler) saveAgentACL(c *gin.Context, id uint, list acl.List, message string) {
+	agent, err := h.service.SetAgentACL(id, list)
+	if respondAgentFieldError(c, err) {
+		return
+	}
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "agent not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to update access list",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: message,
+		Data:    ConvertFromInternalAgentACL(agent),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// agentIDParam the agent ID of the :id path parameter, writes the error response when
+// it is not a number
+func agentIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid agent ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Agent ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// BatchUpdateAgentStatus enable or disable several agents, each ID is processed independently
+func (h *DashboardAgentHandler) BatchUpdateAgentStatus(c *gin.Context) {
+	var req BatchAgentStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	result := &BatchResponse{Results: make([]BatchItemResult, 0, len(req.IDs))}
+	for i, id := range req.IDs {
+		result.Add(i, id, h.service.SetAgentEnabled(id, *req.Enabled))
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Agent status updated: %d succeeded, %d failed", result.Succeeded, result.Failed),
+		Data:    result,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DashboardAgentQueueConfigHandler Dashboard agent queue override handler
+type DashboardAgentQueueConfigHandler struct {
+	agentService *internal.AgentService
+	service      *internal.AgentQueueConfigService
+	queue        queue.PriorityQueue
+}
+
+// NewDashboardAgentQueueConfigHandler create Dashboard agent queue override handler,
+// priorityQueue may be nil when Redis is unavailable, overrides are then only stored
+func NewDashboardAgentQueueConfigHandler(priorityQueue queue.PriorityQueue) *DashboardAgentQueueConfigHandler {
+	return &DashboardAgentQueueConfigHandler{
+		agentService: &internal.AgentService{},
+		service:      &internal.AgentQueueConfigService{},
+		queue:        priorityQueue,
+	}
+}
+
+// GetAgentQueueConfig get agent queue configuration
+func (h *DashboardAgentQueueConfigHandler) GetAgentQueueConfig(c *gin.Context) {
+	agent, ok := h.getAgentFromParam(c)
+	if !ok {
+		return
+	}
+
+	override, err := h.service.GetAgentQueueConfig(agent.AgentID)
+	if err != nil && err.Error() != "queue config not found" {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get queue config",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Queue config retrieved successfully",
+		Data:    h.buildQueueConfigResponse(c.Request.Context(), agent.AgentID, override),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateAgentQueueConfig create or replace agent queue override and push it to the queue layer
+func (h *DashboardAgentQueueConfigHandler) UpdateAgentQueueConfig(c *gin.Context) {
+	agent, ok := h.getAgentFromParam(c)
+	if !ok {
+		return
+	}
+
+	var req AgentQueueConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	override := &internal.AgentQueueConfig{
+		AgentID:      agent.AgentID,
+		MaxQueueSize: *req.MaxQueueSize,
+		DefaultTTL:   *req.DefaultTTL,
+	}
+	if err := h.service.SaveAgentQueueConfig(override); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update queue config",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	message := "Queue config updated successfully"
+	if err := pushAgentQueueConfig(c.Request.Context(), h.queue, override); err != nil {
+		log.Printf("Failed to push queue config for agent %s: %v", agent.AgentID, err)
+		message = "Queue config saved, it will be applied on the next sync"
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: message,
+		Data:    h.buildQueueConfigResponse(c.Request.Context(), agent.AgentID, override),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteAgentQueueConfig delete agent queue override, the global defaults apply again
+func (h *DashboardAgentQueueConfigHandler) DeleteAgentQueueConfig(c *gin.Context) {
+	agent, ok := h.getAgentFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteAgentQueueConfig(agent.AgentID); err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "queue config not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to delete queue config",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	if h.queue != nil {
+		queueName := queue.NewQueueNameBuilder().WithAgent(agent.AgentID).Build()
+		if err := h.queue.ClearQueueOptions(c.Request.Context(), queueName); err != nil {
+			log.Printf("Failed to clear queue options for agent %s: %v", agent.AgentID, err)
+		}
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Queue config deleted successfully",
+		Data:    h.buildQueueConfigResponse(c.Request.Context(), agent.AgentID, nil),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getAgentFromParam resolve the agent of the :id path parameter, writes the error response on failure
+func (h *DashboardAgentQueueConfigHandler) getAgentFromParam(c *gin.Context) (*internal.Agent, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid agent ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Agent ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return nil, false
+	}
+
+	agent, err := h.agentService.GetAgent(uint(id))
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusNotFound,
+			Message: "Agent not found",
+			Error: &APIError{
+				Type:    "not_found",
+				Code:    "404",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusNotFound, response)
+		return nil, false
+	}
+
+	return agent, true
+}
+
+// buildQueueConfigResponse merge the stored override with the live state of the queue layer
+func (h *DashboardAgentQueueConfigHandler) buildQueueConfigResponse(ctx context.Context, agentID string, override *internal.AgentQueueConfig) *AgentQueueConfigResponse {
+	response := &AgentQueueConfigResponse{
+		AgentID:   agentID,
+		QueueName: queue.NewQueueNameBuilder().WithAgent(agentID).Build(),
+	}
+
+	if override != nil {
+		response.MaxQueueSize = override.MaxQueueSize
+		response.DefaultTTL = override.DefaultTTL
+		response.Override = true
+		response.UpdatedAt = &override.UpdatedAt
+	}
+
+	if h.queue == nil {
+		return response
+	}
+
+	options, err := h.queue.GetQueueOptions(ctx, response.QueueName)
+	if err != nil {
+		log.Printf("Failed to get queue options for agent %s: %v", agentID, err)
+		return response
+	}
+
+	if override == nil {
+		// no override, report the global defaults of the queue layer
+		response.MaxQueueSize = options.MaxQueueSize
+		response.DefaultTTL = options.DefaultTTL
+	}
+	response.Applied = options.Override == response.Override &&
+		options.MaxQueueSize == response.MaxQueueSize &&
+		options.DefaultTTL == response.DefaultTTL
+
+	if size, err := h.queue.Size(ctx, response.QueueName); err == nil {
+		response.CurrentSize = &size
+	}
+
+	return response
+}
+
+// pushAgentQueueConfig apply a stored override to the queue layer
+func pushAgentQueueConfig(ctx context.Context, priorityQueue queue.PriorityQueue, override *internal.AgentQueueConfig) error {
+	if priorityQueue == nil {
+		return fmt.Errorf("queue layer is not available")
+	}
+
+	queueName := queue.NewQueueNameBuilder().WithAgent(override.AgentID).Build()
+	return priorityQueue.SetQueueOptions(ctx, queueName, &queue.QueueOptions{
+		MaxQueueSize: override.MaxQueueSize,
+		DefaultTTL:   override.DefaultTTL,
+	})
+}
+
+// SyncAgentQueueConfigs push all stored overrides to the queue layer, used on startup
+func SyncAgentQueueConfigs(ctx context.Context, priorityQueue queue.PriorityQueue) error {
+	service := &internal.AgentQueueConfigService{}
+	overrides, err := service.ListAgentQueueConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to list queue configs: %w", err)
+	}
+
+	for _, override := range overrides {
+		if err := pushAgentQueueConfig(ctx, priorityQueue, override); err != nil {
+			return fmt.Errorf("failed to push queue config for agent %s: %w", override.AgentID, err)
+		}
+	}
+
+	return nil
+}
+
+// DashboardPlaygroundTokenHandler Dashboard playground token handler
+type DashboardPlaygroundTokenHandler struct {
+	service *internal.PlaygroundTokenService
+}
+
+// NewDashboardPlaygroundTokenHandler create Dashboard playground token handler
+func NewDashboardPlaygroundTokenHandler() *DashboardPlaygroundTokenHandler {
+	return &DashboardPlaygroundTokenHandler{
+		service: &internal.PlaygroundTokenService{},
+	}
+}
+
+// ListPlaygroundTokens get playground token list
+func (h *DashboardPlaygroundTokenHandler) ListPlaygroundTokens(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	tokens, total, err := h.service.ListPlaygroundTokens(listQuery, c.Query("agent_id"))
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list playground tokens",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Playground tokens retrieved successfully",
+		Data:    ConvertFromInternalPlaygroundTokenList(tokens),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// IssuePlaygroundToken issue a playground token scoped to one agent
+func (h *DashboardPlaygroundTokenHandler) IssuePlaygroundToken(c *gin.Context) {
+	var req PlaygroundTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	token := ConvertToInternalPlaygroundToken(&req)
+	if err := h.service.IssuePlaygroundToken(token); err != nil {
+		statusCode := http.StatusBadRequest
+		errorType := "validation_error"
+		if err.Error() == "agent not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to issue playground token",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Playground token issued, store it now: it will not be shown again",
+		Data:    ConvertFromInternalPlaygroundToken(token),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// RevokePlaygroundToken revoke a playground token
+func (h *DashboardPlaygroundTokenHandler) RevokePlaygroundToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid playground token ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Playground token ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := h.service.RevokePlaygroundToken(uint(id)); err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "playground token not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to revoke playground token",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Playground token revoked successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DashboardConfigSyncHandler declarative configuration sync handler
+type DashboardConfigSyncHandler struct {
+	service *internal.ConfigSyncService
+	queue   queue.PriorityQueue
+}
+
+// NewDashboardConfigSyncHandler create declarative configuration sync handler, priorityQueue may be nil
+func NewDashboardConfigSyncHandler(priorityQueue queue.PriorityQueue) *DashboardConfigSyncHandler {
+	return &DashboardConfigSyncHandler{
+		service: &internal.ConfigSyncService{},
+		queue:   priorityQueue,
+	}
+}
+
+// PlanSync compute the changes a YAML or JSON spec would make, nothing is modified
+func (h *DashboardConfigSyncHandler) PlanSync(c *gin.Context) {
+	spec, ok := h.bindSpec(c)
+	if !ok {
+		return
+	}
+
+	plan, err := h.service.Plan(spec)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "Failed to plan sync",
+			Error: &APIError{
+				Type:    "sync_error",
+				Code:    "422",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Plan: %d changes, %d agents unchanged", len(plan.Changes), plan.Unchanged),
+		Data:    plan,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ApplySync apply a spec, pass ?fingerprint= from a previous plan to refuse applying
+// when the platform changed in between
+func (h *DashboardConfigSyncHandler) ApplySync(c *gin.Context) {
+	spec, ok := h.bindSpec(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.service.Apply(spec, c.Query("fingerprint"))
+	h.respondWithResult(c, result, err, "Failed to apply sync")
+}
+
+// ImportSync apply a spec exported from another environment, refusing specs changed
+// after the export; ?fingerprint= works as with apply
+func (h *DashboardConfigSyncHandler) ImportSync(c *gin.Context) {
+	spec, ok := h.bindSpec(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.service.Import(spec, c.Query("fingerprint"))
+	h.respondWithResult(c, result, err, "Failed to import platform spec")
+}
+
+// respondWithResult push the queue settings of an applied spec and answer with the result
+func (h *DashboardConfigSyncHandler) respondWithResult(c *gin.Context, result *internal.SyncResult, err error, failure string) {
+	if err != nil {
+		statusCode := http.StatusUnprocessableEntity
+		errorType := "sync_error"
+		if errors.Is(err, internal.ErrSyncStateChanged) {
+			statusCode = http.StatusConflict
+			errorType = "state_changed"
+		}
+		if errors.Is(err, internal.ErrSpecChecksumMissing) || errors.Is(err, internal.ErrSpecChecksumMismatch) {
+			statusCode = http.StatusBadRequest
+			errorType = "validation_error"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: failure,
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	// the database is the source of truth, queue settings are pushed best effort
+	for _, change := range result.Plan.Changes {
+		if change.Resource != internal.SyncResourceQueueConfig || h.queue == nil {
+			continue
+		}
+		var err error
+		if override := change.QueueConfig(); override != nil {
+			err = pushAgentQueueConfig(c.Request.Context(), h.queue, override)
+		} else {
+			queueName := queue.NewQueueNameBuilder().WithAgent(change.AgentID).Build()
+			err = h.queue.ClearQueueOptions(c.Request.Context(), queueName)
+		}
+		if err != nil {
+			log.Printf("Failed to push queue config for agent %s: %v", change.AgentID, err)
+		}
+	}
+
+	message := fmt.Sprintf("Applied %d changes", len(result.Plan.Changes))
+	if len(result.CreatedKeys) > 0 {
+		message += ", store the connector API keys of created agents now: they will not be shown again"
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: message,
+		Data:    result,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportSync export the platform configuration as a spec for import into another
+// environment, as JSON or with ?format=yaml as a YAML document
+func (h *DashboardConfigSyncHandler) ExportSync(c *gin.Context) {
+	spec, err := h.service.Export()
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to export platform spec",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if c.Query("format") == "yaml" {
+		c.Header("Content-Disposition", `attachment; filename="platform.yaml"`)
+		c.YAML(http.StatusOK, spec)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Platform spec exported successfully",
+		Data:    spec,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DriftSync compare the platform with a spec, typically the export of the environment
+// changes are promoted from
+func (h *DashboardConfigSyncHandler) DriftSync(c *gin.Context) {
+	spec, ok := h.bindSpec(c)
+	if !ok {
+		return
+	}
+
+	drift, err := h.service.Drift(spec)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "Failed to check drift",
+			Error: &APIError{
+				Type:    "sync_error",
+				Code:    "422",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	message := "No drift detected"
+	if drift.Drifted {
+		message = "Drift detected"
+	}
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: message,
+		Data:    drift,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindSpec read the spec from the request body
+func (h *DashboardConfigSyncHandler) bindSpec(c *gin.Context) (*internal.PlatformSpec, bool) {
+	body, err := c.GetRawData()
+	if err == nil {
+		var spec *internal.PlatformSpec
+		if spec, err = internal.ParsePlatformSpec(body); err == nil {
+			return spec, true
+		}
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid sync spec",
+		Error: &APIError{
+			Type:    "validation_error",
+			Code:    "400",
+			Message: err.Error(),
+		},
+	}
+	c.JSON(http.StatusBadRequest, response)
+	return nil, false
+}
+
+// InternalAgentHandler agent lookups for other services, authenticated with service tokens
+type InternalAgentHandler struct {
+	agentService       *internal.AgentService
+	queueConfigService *internal.AgentQueueConfigService
+}
+
+// NewInternalAgentHandler create internal agent handler
+func NewInternalAgentHandler() *InternalAgentHandler {
+	return &InternalAgentHandler{
+		agentService:       &internal.AgentService{},
+		queueConfigService: &internal.AgentQueueConfigService{},
+	}
+}
+
+// GetAgentConfig get the full agent configuration by agent ID, including secrets and queue override
+func (h *InternalAgentHandler) GetAgentConfig(c *gin.Context) {
+	agent, err := h.agentService.GetAgentByAgentID(c.Param("agent_id"))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "agent not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to get agent",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	data := gin.H{
+		"agent": ConvertFromInternalAgent(agent, false),
+	}
+	if override, err := h.queueConfigService.GetAgentQueueConfig(agent.AgentID); err == nil {
+		data["queue_config"] = override
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Agent config retrieved successfully",
+		Data:    data,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// HealthCheck health check
+func HealthCheck(c *gin.Context) {
+	uptime := time.Since(startTime)
+
+	// check database connection
+	dbStatus := DatabaseHealthStatus{Status: "ok"}
+	if internal.DB != nil {
+		sqlDB, err := internal.DB.DB()
+		if err != nil {
+			dbStatus.Status = "error"
+			dbStatus.Error = err.Error()
+		} else {
+			stats := sqlDB.Stats()
+			dbStatus.Connections = stats.OpenConnections
+		}
+	} else {
+		dbStatus.Status = "not_connected"
+	}
+
+	response := HealthCheckResponse{
+		Status:    "ok",
+		Service:   "control-flow-api",
+		Version:   "1.0.0",
+		Timestamp: time.Now().Unix(),
+		Uptime:    fmt.Sprintf("%.0f seconds", uptime.Seconds()),
+		Database:  dbStatus,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DashboardNotificationChannelHandler Dashboard notification channel handler
+type DashboardNotificationChannelHandler struct {
+	service *internal.NotificationChannelService
+}
+
+// NewDashboardNotificationChannelHandler create Dashboard notification channel handler
+func NewDashboardNotificationChannelHandler() *DashboardNotificationChannelHandler {
+	return &DashboardNotificationChannelHandler{
+		service: &internal.NotificationChannelService{},
+	}
+}
+
+// ListNotificationChannels get notification channel list
+func (h *DashboardNotificationChannelHandler) ListNotificationChannels(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	channels, total, err := h.service.ListNotificationChannels(listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list notification channels",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Notification channels retrieved successfully",
+		Data:    ConvertFromInternalNotificationChannelList(channels),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateNotificationChannel create notification channel
+func (h *DashboardNotificationChannelHandler) CreateNotificationChannel(c *gin.Context) {
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	channel := ConvertToInternalNotificationChannel(&req)
+	if err := h.service.CreateNotificationChannel(channel); err != nil {
+		respondWithNotificationChannelError(c, "Failed to create notification channel", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Notification channel created successfully",
+		Data:    ConvertFromInternalNotificationChannel(channel),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetNotificationChannel get notification channel
+func (h *DashboardNotificationChannelHandler) GetNotificationChannel(c *gin.Context) {
+	id, ok := bindNotificationChannelID(c)
+	if !ok {
+		return
+	}
+
+	channel, err := h.service.GetNotificationChannel(id)
+	if err != nil {
+		respondWithNotificationChannelError(c, "Failed to get notification channel", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Notification channel retrieved successfully",
+		Data:    ConvertFromInternalNotificationChannel(channel),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateNotificationChannel update notification channel
+func (h *DashboardNotificationChannelHandler) UpdateNotificationChannel(c *gin.Context) {
+	id, ok := bindNotificationChannelID(c)
+	if !ok {
+		return
+	}
+
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	channel := ConvertToInternalNotificationChannel(&req)
+	if err := h.service.UpdateNotificationChannel(id, channel); err != nil {
+		respondWithNotificationChannelError(c, "Failed to update notification channel", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Notification channel updated successfully",
+		Data:    ConvertFromInternalNotificationChannel(channel),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteNotificationChannel delete notification channel
+func (h *DashboardNotificationChannelHandler) DeleteNotificationChannel(c *gin.Context) {
+	id, ok := bindNotificationChannelID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteNotificationChannel(id); err != nil {
+		respondWithNotificationChannelError(c, "Failed to delete notification channel", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Notification channel deleted successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TestNotificationChannel send a test message through the channel
+func (h *DashboardNotificationChannelHandler) TestNotificationChannel(c *gin.Context) {
+	id, ok := bindNotificationChannelID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.SendTestNotification(c.Request.Context(), id); err != nil {
+		if err.Error() == "notification channel not found" {
+			respondWithNotificationChannelError(c, "Failed to send test notification", err)
+			return
+		}
+
+		response := ControlFlowResponse{
+			Code:    http.StatusBadGateway,
+			Message: "Failed to send test notification",
+			Error: &APIError{
+				Type:    "delivery_error",
+				Code:    "502",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Test notification sent successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindNotificationChannelID parse the channel ID path parameter, writes the error response when invalid
+func bindNotificationChannelID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid notification channel ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Notification channel ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWithNotificationChannelError map notification channel service errors to responses
+func respondWithNotificationChannelError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusBadRequest
+	errorType := "validation_error"
+	switch err.Error() {
+	case "notification channel not found":
+		statusCode = http.StatusNotFound
+		errorType = "not_found"
+	case "notification channel name already exists":
+		statusCode = http.StatusConflict
+		errorType = "conflict"
+	}
+
+	response := ControlFlowResponse{
+		Code:    statusCode,
+		Message: message,
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(statusCode),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// DashboardMaintenanceWindowHandler Dashboard maintenance window handler
+type DashboardMaintenanceWindowHandler struct {
+	service *internal.MaintenanceWindowService
+}
+
+// NewDashboardMaintenanceWindowHandler create Dashboard maintenance window handler
+func NewDashboardMaintenanceWindowHandler() *DashboardMaintenanceWindowHandler {
+	return &DashboardMaintenanceWindowHandler{
+		service: &internal.MaintenanceWindowService{},
+	}
+}
+
+// ListMaintenanceWindows get maintenance window list
+func (h *DashboardMaintenanceWindowHandler) ListMaintenanceWindows(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	windows, total, err := h.service.ListMaintenanceWindows(listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list maintenance windows",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Maintenance windows retrieved successfully",
+		Data:    ConvertFromInternalMaintenanceWindowList(windows),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateMaintenanceWindow create maintenance window
+func (h *DashboardMaintenanceWindowHandler) CreateMaintenanceWindow(c *gin.Context) {
+	var req MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	window := ConvertToInternalMaintenanceWindow(&req)
+	if err := h.service.CreateMaintenanceWindow(window); err != nil {
+		respondWithMaintenanceWindowError(c, "Failed to create maintenance window", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Maintenance window created successfully",
+		Data:    ConvertFromInternalMaintenanceWindow(window),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetMaintenanceWindow get maintenance window
+func (h *DashboardMaintenanceWindowHandler) GetMaintenanceWindow(c *gin.Context) {
+	id, ok := bindMaintenanceWindowID(c)
+	if !ok {
+		return
+	}
+
+	window, err := h.service.GetMaintenanceWindow(id)
+	if err != nil {
+		respondWithMaintenanceWindowError(c, "Failed to get maintenance window", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Maintenance window retrieved successfully",
+		Data:    ConvertFromInternalMaintenanceWindow(window),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateMaintenanceWindow update maintenance window
+func (h *DashboardMaintenanceWindowHandler) UpdateMaintenanceWindow(c *gin.Context) {
+	id, ok := bindMaintenanceWindowID(c)
+	if !ok {
+		return
+	}
+
+	var req MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	window := ConvertToInternalMaintenanceWindow(&req)
+	if err := h.service.UpdateMaintenanceWindow(id, window); err != nil {
+		respondWithMaintenanceWindowError(c, "Failed to update maintenance window", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Maintenance window updated successfully",
+		Data:    ConvertFromInternalMaintenanceWindow(window),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteMaintenanceWindow delete maintenance window
+func (h *DashboardMaintenanceWindowHandler) DeleteMaintenanceWindow(c *gin.Context) {
+	id, ok := bindMaintenanceWindowID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteMaintenanceWindow(id); err != nil {
+		respondWithMaintenanceWindowError(c, "Failed to delete maintenance window", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Maintenance window deleted successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindMaintenanceWindowID parse the maintenance window ID path parameter, writes the error response when invalid
+func bindMaintenanceWindowID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid maintenance window ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Maintenance window ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWithMaintenanceWindowError map maintenance window service errors to responses
+func respondWithMaintenanceWindowError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusBadRequest
+	errorType := "validation_error"
+	if err.Error() == "maintenance window not found" {
+		statusCode = http.StatusNotFound
+		errorType = "not_found"
+	}
+
+	response := ControlFlowResponse{
+		Code:    statusCode,
+		Message: message,
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(statusCode),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// DashboardKeyTierHandler Dashboard key tier handler
+type DashboardKeyTierHandler struct {
+	service *internal.KeyTierService
+}
+
+// NewDashboardKeyTierHandler create Dashboard key tier handler
+func NewDashboardKeyTierHandler() *DashboardKeyTierHandler {
+	return &DashboardKeyTierHandler{
+		service: &internal.KeyTierService{},
+	}
+}
+
+// ListKeyTiers get key tier list
+func (h *DashboardKeyTierHandler) ListKeyTiers(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	tiers, total, err := h.service.ListKeyTiers(listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list key tiers",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Key tiers retrieved successfully",
+		Data:    ConvertFromInternalKeyTierList(tiers),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateKeyTier create key tier
+func (h *DashboardKeyTierHandler) CreateKeyTier(c *gin.Context) {
+	var req KeyTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	tier := ConvertToInternalKeyTier(&req)
+	if err := h.service.CreateKeyTier(tier); err != nil {
+		respondWithKeyTierError(c, "Failed to create key tier", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Key tier created successfully",
+		Data:    ConvertFromInternalKeyTier(tier),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetKeyTier get key tier
+func (h *DashboardKeyTierHandler) GetKeyTier(c *gin.Context) {
+	id, ok := bindKeyTierID(c)
+	if !ok {
+		return
+	}
+
+	tier, err := h.service.GetKeyTier(id)
+	if err != nil {
+		respondWithKeyTierError(c, "Failed to get key tier", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Key tier retrieved successfully",
+		Data:    ConvertFromInternalKeyTier(tier),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateKeyTier update key tier
+func (h *DashboardKeyTierHandler) UpdateKeyTier(c *gin.Context) {
+	id, ok := bindKeyTierID(c)
+	if !ok {
+		return
+	}
+
+	var req KeyTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	tier := ConvertToInternalKeyTier(&req)
+	if err := h.service.UpdateKeyTier(id, tier); err != nil {
+		respondWithKeyTierError(c, "Failed to update key tier", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Key tier updated successfully",
+		Data:    ConvertFromInternalKeyTier(tier),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteKeyTier delete key tier
+func (h *DashboardKeyTierHandler) DeleteKeyTier(c *gin.Context) {
+	id, ok := bindKeyTierID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteKeyTier(id); err != nil {
+		respondWithKeyTierError(c, "Failed to delete key tier", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Key tier deleted successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindKeyTierID parse the key tier ID path parameter, writes the error response when invalid
+func bindKeyTierID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid key tier ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Key tier ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWithKeyTierError map key tier service errors to responses
+func respondWithKeyTierError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusBadRequest
+	errorType := "validation_error"
+	if err.Error() == "key tier not found" {
+		statusCode = http.StatusNotFound
+		errorType = "not_found"
+	}
+
+	response := ControlFlowResponse{
+		Code:    statusCode,
+		Message: message,
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(statusCode),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// DashboardQuotaPoolHandler Dashboard quota pool handler
+type DashboardQuotaPoolHandler struct {
+	service *internal.QuotaPoolService
+	store   *quota.Store
+}
+
+// NewDashboardQuotaPoolHandler create Dashboard quota pool handler, the usage is read
+// from the Redis of the global config
+func NewDashboardQuotaPoolHandler() *DashboardQuotaPoolHandler {
+	handler := &DashboardQuotaPoolHandler{
+		service: &internal.QuotaPoolService{},
+	}
+	if cfg := config.GlobalConfig; cfg != nil && cfg.Redis.Addr != "" {
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		handler.store = quota.NewStore(client, "agent-connector:quota:")
+	}
+	return handler
+}
+
+// ListQuotaPools get quota pool list
+func (h *DashboardQuotaPoolHandler) ListQuotaPools(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	pools, total, err := h.service.ListQuotaPools(listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list quota pools",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Quota pools retrieved successfully",
+		Data:    ConvertFromInternalQuotaPoolList(pools),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateQuotaPool create quota pool
+func (h *DashboardQuotaPoolHandler) CreateQuotaPool(c *gin.Context) {
+	var req QuotaPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	pool := ConvertToInternalQuotaPool(&req)
+	if err := h.service.CreateQuotaPool(pool); err != nil {
+		respondWithQuotaPoolError(c, "Failed to create quota pool", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Quota pool created successfully",
+		Data:    ConvertFromInternalQuotaPool(pool),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetQuotaPool get quota pool
+func (h *DashboardQuotaPoolHandler) GetQuotaPool(c *gin.Context) {
+	id, ok := bindQuotaPoolID(c)
+	if !ok {
+		return
+	}
+
+	pool, err := h.service.GetQuotaPool(id)
+	if err != nil {
+		respondWithQuotaPoolError(c, "Failed to get quota pool", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Quota pool retrieved successfully",
+		Data:    ConvertFromInternalQuotaPool(pool),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateQuotaPool update quota pool, the counters of the current period are kept
+func (h *DashboardQuotaPoolHandler) UpdateQuotaPool(c *gin.Context) {
+	id, ok := bindQuotaPoolID(c)
+	if !ok {
+		return
+	}
+
+	var req QuotaPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	pool := ConvertToInternalQuotaPool(&req)
+	if err := h.service.UpdateQuotaPool(id, pool); err != nil {
+		respondWithQuotaPoolError(c, "Failed to update quota pool", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Quota pool updated successfully",
+		Data:    ConvertFromInternalQuotaPool(pool),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteQuotaPool delete quota pool
+func (h *DashboardQuotaPoolHandler) DeleteQuotaPool(c *gin.Context) {
+	id, ok := bindQuotaPoolID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteQuotaPool(id); err != nil {
+		respondWithQuotaPoolError(c, "Failed to delete quota pool", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Quota pool deleted successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetQuotaPoolUsage what the pool and the connector key of each member agent drew in
+// the current period
+func (h *DashboardQuotaPoolHandler) GetQuotaPoolUsage(c *gin.Context) {
+	id, ok := bindQuotaPoolID(c)
+	if !ok {
+		return
+	}
+
+	pool, err := h.service.GetQuotaPool(id)
+	if err != nil {
+		respondWithQuotaPoolError(c, "Failed to get quota pool", err)
+		return
+	}
+	if h.store == nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Failed to get quota pool usage",
+			Error: &APIError{
+				Type:    "service_unavailable",
+				Code:    "503",
+				Message: "Redis is not configured, quota pools are not counted",
+			},
+		}
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+
+	members, err := h.service.ListQuotaPoolMembers(pool.Name)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get quota pool usage",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	agentIDs := make([]string, len(members))
+	for i, member := range members {
+		agentIDs[i] = member.AgentID
+	}
+
+	now := time.Now()
+	used, memberUsages, err := h.store.Usage(c.Request.Context(), pool.Name, pool.Period, now, agentIDs...)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Failed to get quota pool usage",
+			Error: &APIError{
+				Type:    "service_unavailable",
+				Code:    "503",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+
+	start, end := quota.PeriodBounds(pool.Period, now)
+	usage := QuotaPoolUsageResponse{
+		Pool:         pool.Name,
+		Period:       pool.Period,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		TokenLimit:   pool.TokenLimit,
+		RequestLimit: pool.RequestLimit,
+		Used:         used,
+		Members:      make([]QuotaPoolMemberUsage, len(members)),
+	}
+	for i, member := range members {
+		usage.Members[i] = QuotaPoolMemberUsage{
+			AgentID:      member.AgentID,
+			Name:         member.Name,
+			TokenLimit:   member.PoolTokenLimit,
+			RequestLimit: member.PoolRequestLimit,
+			Used:         memberUsages[i],
+		}
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Quota pool usage retrieved successfully",
+		Data:    usage,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindQuotaPoolID parse the quota pool ID path parameter, writes the error response when invalid
+func bindQuotaPoolID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid quota pool ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Quota pool ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWithQuotaPoolError map quota pool service errors to responses
+func respondWithQuotaPoolError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusBadRequest
+	errorType := "validation_error"
+	if err.Error() == "quota pool not found" {
+		statusCode = http.StatusNotFound
+		errorType = "not_found"
+	}
+
+	response := ControlFlowResponse{
+		Code:    statusCode,
+		Message: message,
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(statusCode),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// DashboardSandboxHandler Dashboard developer sandbox handler
+type DashboardSandboxHandler struct {
+	service *internal.SandboxService
+}
+
+// NewDashboardSandboxHandler create Dashboard developer sandbox handler
+func NewDashboardSandboxHandler() *DashboardSandboxHandler {
+	return &DashboardSandboxHandler{
+		service: &internal.SandboxService{},
+	}
+}
+
+// ListSandboxAgents get the sandbox agents, of one sandbox with the owner query parameter
+func (h *DashboardSandboxHandler) ListSandboxAgents(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	agents, total, err := h.service.ListSandboxAgents(listQuery, c.Query("owner"))
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list sandbox agents",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Sandbox agents retrieved successfully",
+		Data:    ConvertFromInternalAgentList(agents, true),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateSandboxAgent create a temporary agent in a developer's sandbox
+func (h *DashboardSandboxHandler) CreateSandboxAgent(c *gin.Context) {
+	var req SandboxAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 {
+			response := ControlFlowResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid request format",
+				Error: &APIError{
+					Type:    "validation_error",
+					Code:    "400",
+					Message: "ttl must be a positive duration such as 2h",
+					Fields:  map[string]string{"ttl": "ttl must be a positive duration such as 2h"},
+				},
+			}
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		ttl = parsed
+	}
+
+	agent := ConvertToInternalSandboxAgent(&req)
+	err := h.service.CreateSandboxAgent(req.Owner, agent, ttl)
+	if respondAgentFieldError(c, err) {
+		return
+	}
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		errorType := "validation_error"
+		if errors.Is(err, internal.ErrSandboxDisabled) {
+			statusCode = http.StatusForbidden
+			errorType = "feature_not_enabled"
+		}
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to create sandbox agent",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Sandbox agent created successfully, store the connector API key now: it will not be shown again",
+		Data:    ConvertFromInternalAgent(agent, false),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// DeleteSandboxAgent delete a sandbox agent before it expires
+func (h *DashboardSandboxHandler) DeleteSandboxAgent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid agent ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Agent ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := h.service.DeleteSandboxAgent(c.Request.Context(), uint(id)); err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if err.Error() == "sandbox agent not found" {
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		}
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to delete sandbox agent",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Sandbox agent deleted successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DashboardGoldenPromptHandler Dashboard golden prompt and run handler
+type DashboardGoldenPromptHandler struct {
+	service *internal.GoldenPromptService
+	runner  *dataflow.DataflowService
+}
+
+// NewDashboardGoldenPromptHandler create Dashboard golden prompt handler
+func NewDashboardGoldenPromptHandler() *DashboardGoldenPromptHandler {
+	return &DashboardGoldenPromptHandler{
+		service: &internal.GoldenPromptService{},
+		runner:  dataflow.NewDataflowService(nil),
+	}
+}
+
+// ListGoldenPrompts get golden prompt list, of one agent with agent_id
+func (h *DashboardGoldenPromptHandler) ListGoldenPrompts(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	prompts, total, err := h.service.ListGoldenPrompts(c.Query("agent_id"), listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list golden prompts",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Golden prompts retrieved successfully",
+		Data:    ConvertFromInternalGoldenPromptList(prompts),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateGoldenPrompt create golden prompt
+func (h *DashboardGoldenPromptHandler) CreateGoldenPrompt(c *gin.Context) {
+	var req GoldenPromptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	prompt := ConvertToInternalGoldenPrompt(&req)
+	if err := h.service.CreateGoldenPrompt(prompt); err != nil {
+		respondWithGoldenError(c, "Failed to create golden prompt", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusCreated,
+		Message: "Golden prompt created successfully",
+		Data:    ConvertFromInternalGoldenPrompt(prompt),
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetGoldenPrompt get golden prompt
+func (h *DashboardGoldenPromptHandler) GetGoldenPrompt(c *gin.Context) {
+	id, ok := bindGoldenID(c, "golden prompt")
+	if !ok {
+		return
+	}
+
+	prompt, err := h.service.GetGoldenPrompt(id)
+	if err != nil {
+		respondWithGoldenError(c, "Failed to get golden prompt", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Golden prompt retrieved successfully",
+		Data:    ConvertFromInternalGoldenPrompt(prompt),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateGoldenPrompt update golden prompt, e.g. to approve a new reference answer
+func (h *DashboardGoldenPromptHandler) UpdateGoldenPrompt(c *gin.Context) {
+	id, ok := bindGoldenID(c, "golden prompt")
+	if !ok {
+		return
+	}
+
+	var req GoldenPromptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	prompt := ConvertToInternalGoldenPrompt(&req)
+	if err := h.service.UpdateGoldenPrompt(id, prompt); err != nil {
+		respondWithGoldenError(c, "Failed to update golden prompt", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Golden prompt updated successfully",
+		Data:    ConvertFromInternalGoldenPrompt(prompt),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteGoldenPrompt delete golden prompt
+func (h *DashboardGoldenPromptHandler) DeleteGoldenPrompt(c *gin.Context) {
+	id, ok := bindGoldenID(c, "golden prompt")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteGoldenPrompt(id); err != nil {
+		respondWithGoldenError(c, "Failed to delete golden prompt", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Golden prompt deleted successfully",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListGoldenRuns get golden run list, of one agent with agent_id
+func (h *DashboardGoldenPromptHandler) ListGoldenRuns(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	runs, total, err := h.service.ListGoldenRuns(c.Query("agent_id"), listQuery)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list golden runs",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Golden runs retrieved successfully",
+		Data:    ConvertFromInternalGoldenRunList(runs),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// StartGoldenRun run the golden prompts of an agent in the background, the run is
+// polled until it is no longer running
+func (h *DashboardGoldenPromptHandler) StartGoldenRun(c *gin.Context) {
+	var req GoldenRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	run, err := h.runner.StartGoldenRun(req.AgentID, internal.GoldenTriggerManual)
+	if err != nil {
+		respondWithGoldenError(c, "Failed to start golden run", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusAccepted,
+		Message: "Golden run started",
+		Data:    ConvertFromInternalGoldenRun(run),
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetGoldenRun get golden run with the answers and their diffs
+func (h *DashboardGoldenPromptHandler) GetGoldenRun(c *gin.Context) {
+	id, ok := bindGoldenID(c, "golden run")
+	if !ok {
+		return
+	}
+
+	run, err := h.service.GetGoldenRun(id)
+	if err != nil {
+		respondWithGoldenError(c, "Failed to get golden run", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Golden run retrieved successfully",
+		Data:    ConvertFromInternalGoldenRun(run),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// runOnAgentUpdate start a golden run after the configuration of an agent with
+// golden prompts changed
+func (h *DashboardGoldenPromptHandler) runOnAgentUpdate(agent *internal.Agent) {
+	has, err := h.service.HasGoldenPrompts(agent.AgentID)
+	if err != nil {
+		log.Printf("Failed to check golden prompts of agent %s: %v", agent.AgentID, err)
+		return
+	}
+	if !has {
+		return
+	}
+
+	if _, err := h.runner.StartGoldenRun(agent.AgentID, internal.GoldenTriggerAgentUpdate); err != nil {
+		log.Printf("Failed to start golden run of agent %s after its update: %v", agent.AgentID, err)
+	}
+}
+
+// bindGoldenID parse the golden prompt or run ID path parameter, writes the error response when invalid
+func bindGoldenID(c *gin.Context, resource string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid " + resource + " ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: strings.ToUpper(resource[:1]) + resource[1:] + " ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWithGoldenError map golden prompt and run service errors to responses
+func respondWithGoldenError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusBadRequest
+	errorType := "validation_error"
+	switch {
+	case err.Error() == "golden prompt not found" || err.Error() == "golden run not found":
+		statusCode = http.StatusNotFound
+		errorType = "not_found"
+	case errors.Is(err, internal.ErrGoldenRunInProgress):
+		statusCode = http.StatusConflict
+		errorType = "run_in_progress"
+	}
+
+	response := ControlFlowResponse{
+		Code:    statusCode,
+		Message: message,
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(statusCode),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// DashboardUsageHandler Dashboard usage report handler
+type DashboardUsageHandler struct {
+	service  *internal.UsageService
+	replayer *dataflow.DataflowService
+}
+
+// NewDashboardUsageHandler create Dashboard usage report handler
+func NewDashboardUsageHandler() *DashboardUsageHandler {
+	return &DashboardUsageHandler{
+		service:  &internal.UsageService{},
+		replayer: dataflow.NewDataflowService(nil),
+	}
+}
+
+// ListUsageRecords get usage record list, filterable by agent, time range and metadata tags
+func (h *DashboardUsageHandler) ListUsageRecords(c *gin.Context) {
+	listQuery, ok := bindListQuery(c)
+	if !ok {
+		return
+	}
+	filter, err := internal.ParseUsageFilter(c.Request.URL.Query())
+	if err != nil {
+		respondWithListQueryError(c, err)
+		return
+	}
+
+	records, total, err := h.service.ListUsageRecords(listQuery, filter)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		respondWithUsageRecordError(c, "Failed to list usage records", err)
+		return
+	}
+
+	totalPages := int((total + int64(listQuery.PageSize) - 1) / int64(listQuery.PageSize))
+
+	response := ControlFlowPaginationResponse{
+		Code:    http.StatusOK,
+		Message: "Usage records retrieved successfully",
+		Data:    ConvertFromInternalUsageRecordList(records),
+		Pagination: PaginationInfo{
+			Page:       listQuery.Page,
+			PageSize:   listQuery.PageSize,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUsageRecord get usage record with the stored prompt and response
+func (h *DashboardUsageHandler) GetUsageRecord(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid usage record ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Usage record ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	record, err := h.service.GetUsageRecord(uint(id))
+	if err != nil {
+		respondWithUsageRecordError(c, "Failed to get usage record", err)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage record retrieved successfully",
+		Data:    ConvertFromInternalUsageRecord(record),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ReplayUsageRecord send the stored request of a usage record again, to the same or
+// another agent, and return the new answer with a line diff against the stored one
+func (h *DashboardUsageHandler) ReplayUsageRecord(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid usage record ID",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: "Usage record ID must be a valid number",
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// the body is optional
+	var req UsageReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response := ControlFlowResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Error: &APIError{
+				Type:    "validation_error",
+				Code:    "400",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	record, err := h.service.GetUsageRecord(uint(id))
+	if err != nil {
+		respondWithUsageRecordError(c, "Failed to get usage record", err)
+		return
+	}
+
+	result, err := h.replayer.Replay(c.Request.Context(), record, req.AgentID)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		errorType := "invalid_agent"
+		if errors.Is(err, dataflow.ErrNotReplayable) {
+			statusCode = http.StatusConflict
+			errorType = "not_replayable"
+		}
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to replay usage record",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage record replayed successfully",
+		Data:    result,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// respondWithUsageRecordError map usage record service errors to responses, the records
+// of privacy mode agents are forbidden
+func respondWithUsageRecordError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusInternalServerError
+	errorType := "database_error"
+	switch {
+	case err.Error() == "usage record not found":
+		statusCode = http.StatusNotFound
+		errorType = "not_found"
+	case errors.Is(err, internal.ErrAggregateOnly):
+		statusCode = http.StatusForbidden
+		errorType = "aggregate_only"
+	}
+
+	response := ControlFlowResponse{
+		Code:    statusCode,
+		Message: message,
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(statusCode),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// ReencryptUsageContent run the re-encryption job now, moving stored content to the
+// agents' current data keys and the active master key
+func (h *DashboardUsageHandler) ReencryptUsageContent(c *gin.Context) {
+	result, err := internal.ReencryptUsageContent(c.Request.Context())
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "database_error"
+		if errors.Is(err, internal.ErrContentEncryptionDisabled) {
+			statusCode = http.StatusConflict
+			errorType = "encryption_disabled"
+		}
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to re-encrypt usage content",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage content re-encrypted successfully",
+		Data:    result,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUsageSummary aggregate usage and cost by agent or metadata tags, as JSON or,
+// with format=csv, as a CSV download for charge-back
+func (h *DashboardUsageHandler) GetUsageSummary(c *gin.Context) {
+	filter, err := internal.ParseUsageFilter(c.Request.URL.Query())
+	if err != nil {
+		respondWithListQueryError(c, err)
+		return
+	}
+
+	groupBy := c.DefaultQuery("group_by", "agent")
+	summaries, err := h.service.SummarizeUsage(filter, groupBy)
+	if errors.Is(err, internal.ErrInvalidListQuery) {
+		respondWithListQueryError(c, err)
+		return
+	}
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to summarize usage",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	report := NewUsageReportResponse(groupBy, filter, config.GlobalConfig.Usage.Currency, summaries)
+	if c.Query("format") == "csv" {
+		writeUsageReportCSV(c, report)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage summary retrieved successfully",
+		Data:    report,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUsageQuality get the average judge scores per agent, day and rubric of the
+// requests the filter selects
+func (h *DashboardUsageHandler) GetUsageQuality(c *gin.Context) {
+	filter, err := internal.ParseUsageFilter(c.Request.URL.Query())
+	if err != nil {
+		respondWithListQueryError(c, err)
+		return
+	}
+
+	points, err := h.service.QualityTrend(filter)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get usage quality",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+	if points == nil {
+		points = []*internal.UsageQualityPoint{}
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage quality retrieved successfully",
+		Data:    &UsageQualityResponse{From: filter.From, To: filter.To, Points: points},
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUsageForecast get the projected 30-day usage and budget runway of the agents,
+// as of the last forecast run
+func (h *DashboardUsageHandler) GetUsageForecast(c *gin.Context) {
+	forecasts, err := h.service.ListUsageForecasts(c.Query("agent_id"))
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get usage forecast",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage forecast retrieved successfully",
+		Data:    NewUsageForecastResponse(config.GlobalConfig.Usage.Currency, forecasts),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RefreshUsageForecast refit the usage trends of all agents now
+func (h *DashboardUsageHandler) RefreshUsageForecast(c *gin.Context) {
+	forecasts, err := h.service.RefreshUsageForecasts(c.Request.Context())
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to refresh usage forecast",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Usage forecast refreshed successfully",
+		Data:    NewUsageForecastResponse(config.GlobalConfig.Usage.Currency, forecasts),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// writeUsageReportCSV write the report as a CSV attachment, one row per group and a total row
+func writeUsageReportCSV(c *gin.Context, report *UsageReportResponse) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=usage-report-%s.csv", time.Now().Format("20060102-150405")))
+	c.Status(http.StatusOK)
+
+	dimensions := strings.Split(report.GroupBy, ",")
+	header := append([]string{}, dimensions...)
+	header = append(header, "requests", "failed", "client_cancelled", "prompt_tokens", "completion_tokens", "total_tokens", "cost", "currency", "avg_duration_ms")
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(header)
+
+	writeRow := func(summary *internal.UsageSummary) {
+		// groups are agent names or client-supplied metadata values
+		row := []string{internal.CSVText(summary.Group)}
+		if len(dimensions) > 1 {
+			row = append(row, internal.CSVText(summary.Subgroup))
+		}
+		row = append(row,
+			strconv.FormatInt(summary.Requests, 10),
+			strconv.FormatInt(summary.Failed, 10),
+			strconv.FormatInt(summary.ClientCancelled, 10),
+			strconv.FormatInt(summary.PromptTokens, 10),
+			strconv.FormatInt(summary.CompletionTokens, 10),
+			strconv.FormatInt(summary.TotalTokens, 10),
+			strconv.FormatFloat(summary.Cost, 'f', 6, 64),
+			report.Currency,
+			strconv.FormatFloat(summary.AvgDurationMs, 'f', 1, 64),
+		)
+		writer.Write(row)
+	}
+	for _, summary := range report.Groups {
+		writeRow(summary)
+	}
+	writeRow(&report.Total)
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Failed to write usage report CSV: %v", err)
+	}
+}
+
+// mergePatchContentType media type of JSON merge patches (RFC 7396)
+const mergePatchContentType = "application/merge-patch+json"
+
+// errUnsupportedPatchType the PATCH body is neither a merge patch nor plain JSON
+var errUnsupportedPatchType = errors.New("PATCH requests take " + mergePatchContentType + " or application/json")
+
+// bindMergePatch apply the JSON merge patch in the request body to doc, which holds the
+// current state of the resource, and validate the result. Members the patch sets to null
+// fall back to their zero value, unknown members are rejected.
+func bindMergePatch(c *gin.Context, doc interface{}) error {
+	switch c.ContentType() {
+	case mergePatchContentType, binding.MIMEJSON:
+	default:
+		return errUnsupportedPatchType
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read merge patch: %w", err)
+	}
+	current, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal current state: %w", err)
+	}
+	patched, err := mergepatch.Apply(current, patch)
+	if err != nil {
+		return err
+	}
+
+	// decode into an empty document so removed members do not keep their current value
+	target := reflect.ValueOf(doc).Elem()
+	target.Set(reflect.Zero(target.Type()))
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(doc); err != nil {
+		return fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return binding.Validator.ValidateStruct(doc)
+}
+
+// respondMergePatchError reject a merge patch bindMergePatch could not apply
+func respondMergePatchError(c *gin.Context, err error) {
+	status, errorType := http.StatusBadRequest, "validation_error"
+	if errors.Is(err, errUnsupportedPatchType) {
+		status, errorType = http.StatusUnsupportedMediaType, "unsupported_media_type"
+	}
+	response := ControlFlowResponse{
+		Code:    status,
+		Message: "Invalid merge patch",
+		Error: &APIError{
+			Type:    errorType,
+			Code:    strconv.Itoa(status),
+			Message: err.Error(),
+		},
+	}
+	c.JSON(status, response)
+}
+
+// respondAgentFieldError reject an agent configuration the service found invalid, naming
+// the offending field; false when err is not about a field
+func respondAgentFieldError(c *gin.Context, err error) bool {
+	var fieldErr *agent.FieldError
+	if !errors.As(err, &fieldErr) {
+		return false
+	}
+	response := ControlFlowResponse{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid agent configuration",
+		Error: &APIError{
+			Type:    "validation_error",
+			Code:    "400",
+			Message: fieldErr.Message,
+			Fields:  map[string]string{fieldErr.Field: fieldErr.Message},
+		},
+	}
+	c.JSON(http.StatusBadRequest, response)
+	return true
+}
+
+// DashboardJobHandler background job handler
+type DashboardJobHandler struct{}
+
+// NewDashboardJobHandler create background job handler
+func NewDashboardJobHandler() *DashboardJobHandler {
+	return &DashboardJobHandler{}
+}
+
+// defaultJobRunLimit and maxJobRunLimit stored runs listed by default and at most
+const (
+	defaultJobRunLimit = 50
+	maxJobRunLimit     = 500
+)
+
+// ListJobs status of the background jobs of control flow: schedule, next run, last
+// run and error, and the recent runs
+func (h *DashboardJobHandler) ListJobs(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Jobs retrieved successfully",
+		Data:    internal.Jobs.Jobs(),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TriggerJob run a background job now; it runs in the background, its outcome shows
+// in the job status
+func (h *DashboardJobHandler) TriggerJob(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	if err := internal.Jobs.Trigger(c.Param("name")); err != nil {
+		statusCode := http.StatusInternalServerError
+		errorType := "internal_error"
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			statusCode = http.StatusNotFound
+			errorType = "not_found"
+		case errors.Is(err, jobs.ErrJobRunning):
+			statusCode = http.StatusConflict
+			errorType = "job_running"
+		}
+		response := ControlFlowResponse{
+			Code:    statusCode,
+			Message: "Failed to trigger job",
+			Error: &APIError{
+				Type:    errorType,
+				Code:    strconv.Itoa(statusCode),
+				Message: err.Error(),
+			},
+		}
+		c.JSON(statusCode, response)
+		return
+	}
+
+	status, _ := internal.Jobs.Job(c.Param("name"))
+	response := ControlFlowResponse{
+		Code:    http.StatusAccepted,
+		Message: "Job triggered",
+		Data:    status,
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// ListJobRuns stored runs of the background jobs of every service, newest first,
+// filterable by service and job
+func (h *DashboardJobHandler) ListJobRuns(c *gin.Context) {
+	limit := defaultJobRunLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxJobRunLimit {
+			response := ControlFlowResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid list parameters",
+				Error: &APIError{
+					Type:    "validation_error",
+					Code:    "400",
+					Message: fmt.Sprintf("limit must be between 1 and %d", maxJobRunLimit),
+				},
+			}
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := internal.ListJobRuns(c.Query("service"), c.Query("job"), limit)
+	if err != nil {
+		response := ControlFlowResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list job runs",
+			Error: &APIError{
+				Type:    "database_error",
+				Code:    "500",
+				Message: err.Error(),
+			},
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := ControlFlowResponse{
+		Code:    http.StatusOK,
+		Message: "Job runs retrieved successfully",
+		Data:    runs,
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// requireJobs answer 503 when the service runs no job scheduler
+func requireJobs(c *gin.Context) bool {
+	if internal.Jobs != nil {
+		return true
+	}
+	response := ControlFlowResponse{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Background jobs not available",
+		Error: &APIError{
+			Type:    "service_unavailable",
+			Code:    "503",
+			Message: "this service runs no background jobs",
+		},
+	}
+	c.JSON(http.StatusServiceUnavailable, response)
+	return false
+}
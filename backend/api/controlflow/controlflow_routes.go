@@ -1,13 +1,30 @@
 package controlflow
 
 import (
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/openapi"
+	"agent-connector/pkg/queue"
+	"agent-connector/pkg/serviceauth"
+
 	"github.com/gin-gonic/gin"
 )
 
-// SetupControlFlowRoutes setup control flow API routes
-func SetupControlFlowRoutes(router *gin.Engine) {
+// SetupControlFlowRoutes setup control flow API routes, priorityQueue is optional
+func SetupControlFlowRoutes(router *gin.Engine, priorityQueue queue.PriorityQueue) {
 	systemConfigHandler := NewDashboardSystemConfigHandler()
 	agentHandler := NewDashboardAgentHandler()
+	queueConfigHandler := NewDashboardAgentQueueConfigHandler(priorityQueue)
+	playgroundTokenHandler := NewDashboardPlaygroundTokenHandler()
+	syncHandler := NewDashboardConfigSyncHandler(priorityQueue)
+	notificationChannelHandler := NewDashboardNotificationChannelHandler()
+	maintenanceWindowHandler := NewDashboardMaintenanceWindowHandler()
+	keyTierHandler := NewDashboardKeyTierHandler()
+	quotaPoolHandler := NewDashboardQuotaPoolHandler()
+	sandboxHandler := NewDashboardSandboxHandler()
+	goldenPromptHandler := NewDashboardGoldenPromptHandler()
+	usageHandler := NewDashboardUsageHandler()
+	jobHandler := NewDashboardJobHandler()
 
 	v1 := router.Group("/api/v1/controlflow")
 	{
@@ -16,6 +33,7 @@ func SetupControlFlowRoutes(router *gin.Engine) {
 		{
 			systemConfig.GET("", systemConfigHandler.GetSystemConfig)
 			systemConfig.PUT("", systemConfigHandler.UpdateSystemConfig)
+			systemConfig.PATCH("", systemConfigHandler.PatchSystemConfig)
 		}
 
 		// Agent configuration
@@ -23,12 +41,135 @@ func SetupControlFlowRoutes(router *gin.Engine) {
 		{
 			agents.GET("", agentHandler.ListAgents)
 			agents.POST("", agentHandler.CreateAgent)
+			agents.PUT("/batch/status", agentHandler.BatchUpdateAgentStatus)
 			agents.GET("/:id", agentHandler.GetAgent)
 			agents.PUT("/:id", agentHandler.UpdateAgent)
+			agents.PATCH("/:id", agentHandler.PatchAgent)
 			agents.DELETE("/:id", agentHandler.DeleteAgent)
+			agents.POST("/:id/rotate-key", agentHandler.RotateConnectorAPIKey)
+			agents.POST("/:id/rotate-signing-secret", agentHandler.RotateSigningSecret)
+
+			// Per-agent access lists
+			agents.GET("/:id/acl", agentHandler.GetAgentACL)
+			agents.PUT("/:id/acl", agentHandler.UpdateAgentACL)
+			agents.DELETE("/:id/acl", agentHandler.DeleteAgentACL)
+
+			// Per-agent queue overrides
+			agents.GET("/:id/queue-config", queueConfigHandler.GetAgentQueueConfig)
+			agents.PUT("/:id/queue-config", queueConfigHandler.UpdateAgentQueueConfig)
+			agents.DELETE("/:id/queue-config", queueConfigHandler.DeleteAgentQueueConfig)
+		}
+
+		// Playground tokens for demos and trials
+		playgroundTokens := v1.Group("/playground-tokens")
+		{
+			playgroundTokens.GET("", playgroundTokenHandler.ListPlaygroundTokens)
+			playgroundTokens.POST("", playgroundTokenHandler.IssuePlaygroundToken)
+			playgroundTokens.DELETE("/:id", playgroundTokenHandler.RevokePlaygroundToken)
+		}
+
+		// Slack / Teams notification channels
+		notificationChannels := v1.Group("/notification-channels")
+		{
+			notificationChannels.GET("", notificationChannelHandler.ListNotificationChannels)
+			notificationChannels.POST("", notificationChannelHandler.CreateNotificationChannel)
+			notificationChannels.GET("/:id", notificationChannelHandler.GetNotificationChannel)
+			notificationChannels.PUT("/:id", notificationChannelHandler.UpdateNotificationChannel)
+			notificationChannels.DELETE("/:id", notificationChannelHandler.DeleteNotificationChannel)
+			notificationChannels.POST("/:id/test", notificationChannelHandler.TestNotificationChannel)
+		}
+
+		// Maintenance windows, per agent or global
+		maintenanceWindows := v1.Group("/maintenance-windows")
+		{
+			maintenanceWindows.GET("", maintenanceWindowHandler.ListMaintenanceWindows)
+			maintenanceWindows.POST("", maintenanceWindowHandler.CreateMaintenanceWindow)
+			maintenanceWindows.GET("/:id", maintenanceWindowHandler.GetMaintenanceWindow)
+			maintenanceWindows.PUT("/:id", maintenanceWindowHandler.UpdateMaintenanceWindow)
+			maintenanceWindows.DELETE("/:id", maintenanceWindowHandler.DeleteMaintenanceWindow)
+		}
+
+		// Key tiers, the features an agent's connector key may use
+		keyTiers := v1.Group("/tiers")
+		{
+			keyTiers.GET("", keyTierHandler.ListKeyTiers)
+			keyTiers.POST("", keyTierHandler.CreateKeyTier)
+			keyTiers.GET("/:id", keyTierHandler.GetKeyTier)
+			keyTiers.PUT("/:id", keyTierHandler.UpdateKeyTier)
+			keyTiers.DELETE("/:id", keyTierHandler.DeleteKeyTier)
+		}
+
+		// Quota pools shared by the connector keys of a team
+		quotaPools := v1.Group("/quota-pools")
+		{
+			quotaPools.GET("", quotaPoolHandler.ListQuotaPools)
+			quotaPools.POST("", quotaPoolHandler.CreateQuotaPool)
+			quotaPools.GET("/:id", quotaPoolHandler.GetQuotaPool)
+			quotaPools.PUT("/:id", quotaPoolHandler.UpdateQuotaPool)
+			quotaPools.DELETE("/:id", quotaPoolHandler.DeleteQuotaPool)
+			quotaPools.GET("/:id/usage", quotaPoolHandler.GetQuotaPoolUsage)
+		}
+
+		// Developer sandbox of temporary agents, kept apart from the production agents
+		sandbox := v1.Group("/sandbox")
+		{
+			sandbox.GET("/agents", sandboxHandler.ListSandboxAgents)
+			sandbox.POST("/agents", sandboxHandler.CreateSandboxAgent)
+			sandbox.DELETE("/agents/:id", sandboxHandler.DeleteSandboxAgent)
+		}
+
+		// Golden prompts with approved answers, rerun to catch regressions
+		goldenPrompts := v1.Group("/golden-prompts")
+		{
+			goldenPrompts.GET("", goldenPromptHandler.ListGoldenPrompts)
+			goldenPrompts.POST("", goldenPromptHandler.CreateGoldenPrompt)
+			goldenPrompts.GET("/:id", goldenPromptHandler.GetGoldenPrompt)
+			goldenPrompts.PUT("/:id", goldenPromptHandler.UpdateGoldenPrompt)
+			goldenPrompts.DELETE("/:id", goldenPromptHandler.DeleteGoldenPrompt)
+		}
+		goldenRuns := v1.Group("/golden-runs")
+		{
+			goldenRuns.GET("", goldenPromptHandler.ListGoldenRuns)
+			goldenRuns.POST("", goldenPromptHandler.StartGoldenRun)
+			goldenRuns.GET("/:id", goldenPromptHandler.GetGoldenRun)
+		}
+
+		// Usage reports
+		usage := v1.Group("/usage")
+		{
+			usage.GET("", usageHandler.ListUsageRecords)
+			usage.GET("/summary", usageHandler.GetUsageSummary)
+			usage.GET("/quality", usageHandler.GetUsageQuality)
+			usage.POST("/reencrypt", usageHandler.ReencryptUsageContent)
+			usage.GET("/forecast", usageHandler.GetUsageForecast)
+			usage.POST("/forecast/refresh", usageHandler.RefreshUsageForecast)
+			usage.GET("/:id", usageHandler.GetUsageRecord)
+			usage.POST("/:id/replay", usageHandler.ReplayUsageRecord)
+		}
+
+		// Declarative configuration sync (plan/apply, export/import between environments)
+		sync := v1.Group("/sync")
+		{
+			sync.POST("/plan", syncHandler.PlanSync)
+			sync.POST("/apply", syncHandler.ApplySync)
+			sync.GET("/export", syncHandler.ExportSync)
+			sync.POST("/import", syncHandler.ImportSync)
+			sync.POST("/drift", syncHandler.DriftSync)
+		}
+
+		// Background jobs
+		jobRoutes := v1.Group("/jobs")
+		{
+			jobRoutes.GET("", jobHandler.ListJobs)
+			jobRoutes.GET("/runs", jobHandler.ListJobRuns)
+			jobRoutes.POST("/:name/run", jobHandler.TriggerJob)
 		}
 	}
 
+	if cfg := config.GlobalConfig; cfg != nil && cfg.API.GoldenRunOnUpdate {
+		internal.OnAgentUpdated(goldenPromptHandler.runOnAgentUpdate)
+	}
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -36,4 +177,18 @@ func SetupControlFlowRoutes(router *gin.Engine) {
 			"message": "Control Flow API is running",
 		})
 	})
+
+	// Machine-readable API description
+	router.GET(openapi.SpecPath, openapi.GinHandler(NewOpenAPIGenerator(), router))
+}
+
+// SetupInternalRoutes setup routes called by the other services, protected by service tokens
+func SetupInternalRoutes(router *gin.Engine, verifier *serviceauth.Verifier) {
+	internalAgentHandler := NewInternalAgentHandler()
+
+	internalAPI := router.Group("/api/v1/internal")
+	internalAPI.Use(serviceauth.GinMiddleware(verifier))
+	{
+		internalAPI.GET("/agents/:agent_id", internalAgentHandler.GetAgentConfig)
+	}
 }
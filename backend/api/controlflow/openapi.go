@@ -0,0 +1,344 @@
+package controlflow
+
+import (
+	"net/http"
+
+	"agent-connector/api/dataflow"
+	"agent-connector/internal"
+	"agent-connector/pkg/jobs"
+	"agent-connector/pkg/openapi"
+	"agent-connector/pkg/serviceauth"
+)
+
+// listQueryParameters query parameters shared by the list endpoints
+var listQueryParameters = []*openapi.Parameter{
+	openapi.QueryParam("page", "integer", "page number, starts at 1"),
+	openapi.QueryParam("page_size", "integer", "items per page, at most 100"),
+	openapi.QueryParam("search", "string", "substring match on the searchable columns"),
+	openapi.QueryParam("status", "string", "status filter"),
+	openapi.QueryParam("type", "string", "type filter"),
+	openapi.QueryParam("sort_by", "string", "sort column"),
+	openapi.QueryParam("order", "string", "asc or desc"),
+	openapi.QueryParam("created_after", "string", "RFC 3339 timestamp or YYYY-MM-DD"),
+}
+
+// NewOpenAPIGenerator describe the control flow API endpoints
+func NewOpenAPIGenerator() *openapi.Generator {
+	g := openapi.NewGenerator("Control Flow API", "1.0.0", "Agent, queue, playground token, notification channel, maintenance window, golden prompt and usage management")
+	g.AddSecurityScheme("serviceToken", &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        serviceauth.HeaderName,
+		Description: "Signed service-to-service token",
+	})
+
+	const prefix = "/api/v1/controlflow"
+	systemTags := []string{"System Config"}
+	agentTags := []string{"Agents"}
+	playgroundTags := []string{"Playground Tokens"}
+
+	g.Describe(http.MethodGet, prefix+"/system-config", openapi.Endpoint{
+		Summary: "Get system configuration", Tags: systemTags, Response: SystemConfigResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/system-config", openapi.Endpoint{
+		Summary: "Update system configuration, 409 with the current one when version is stale", Tags: systemTags, Request: SystemConfigRequest{}, Response: SystemConfigResponse{},
+	})
+	g.Describe(http.MethodPatch, prefix+"/system-config", openapi.Endpoint{
+		Summary: "Change system configuration fields with a JSON merge patch (RFC 7396), null resets a field", Tags: systemTags, Request: SystemConfigRequest{}, Response: SystemConfigResponse{},
+	})
+
+	g.Describe(http.MethodGet, prefix+"/agents", openapi.Endpoint{
+		Summary: "List agents", Tags: agentTags, Response: AgentResponse{}, Paginated: true,
+		Query: append([]*openapi.Parameter{openapi.QueryParam("hide_secrets", "boolean", "omit source API keys")}, listQueryParameters...),
+	})
+	g.Describe(http.MethodPost, prefix+"/agents", openapi.Endpoint{
+		Summary: "Create agent, the connector API key is only returned here", Tags: agentTags,
+		Request: AgentRequest{}, Response: AgentResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodPut, prefix+"/agents/batch/status", openapi.Endpoint{
+		Summary: "Enable or disable several agents", Tags: agentTags, Request: BatchAgentStatusRequest{}, Response: BatchResponse{},
+	})
+	g.Describe(http.MethodGet, prefix+"/agents/:id", openapi.Endpoint{
+		Summary: "Get agent", Tags: agentTags, Response: AgentResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/agents/:id", openapi.Endpoint{
+		Summary: "Update agent, 409 with the current agent when version is stale", Tags: agentTags, Request: AgentUpdateRequest{}, Response: AgentResponse{},
+	})
+	g.Describe(http.MethodPatch, prefix+"/agents/:id", openapi.Endpoint{
+		Summary: "Change agent fields with a JSON merge patch (RFC 7396), null resets a field", Tags: agentTags, Request: AgentPatchDocument{}, Response: AgentResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/agents/:id", openapi.Endpoint{
+		Summary: "Delete agent", Tags: agentTags,
+	})
+	g.Describe(http.MethodPost, prefix+"/agents/:id/rotate-key", openapi.Endpoint{
+		Summary: "Rotate the connector API key", Tags: agentTags, Response: AgentResponse{},
+	})
+	g.Describe(http.MethodPost, prefix+"/agents/:id/rotate-signing-secret", openapi.Endpoint{
+		Summary: "Rotate the HMAC secret of signed requests", Tags: agentTags, Response: SigningSecretResponse{},
+	})
+	g.Describe(http.MethodGet, prefix+"/agents/:id/acl", openapi.Endpoint{
+		Summary: "Get the users, roles and keys allowed to call an agent", Tags: agentTags, Response: AgentACLResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/agents/:id/acl", openapi.Endpoint{
+		Summary: "Replace the access list of an agent, empty lists allow every caller", Tags: agentTags, Request: AgentACLRequest{}, Response: AgentACLResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/agents/:id/acl", openapi.Endpoint{
+		Summary: "Clear the access list of an agent", Tags: agentTags, Response: AgentACLResponse{},
+	})
+	g.Describe(http.MethodGet, prefix+"/agents/:id/queue-config", openapi.Endpoint{
+		Summary: "Get the queue override of an agent", Tags: agentTags, Response: AgentQueueConfigResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/agents/:id/queue-config", openapi.Endpoint{
+		Summary: "Set the queue override of an agent", Tags: agentTags, Request: AgentQueueConfigRequest{}, Response: AgentQueueConfigResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/agents/:id/queue-config", openapi.Endpoint{
+		Summary: "Remove the queue override of an agent", Tags: agentTags, Response: AgentQueueConfigResponse{},
+	})
+
+	g.Describe(http.MethodGet, prefix+"/playground-tokens", openapi.Endpoint{
+		Summary: "List playground tokens", Tags: playgroundTags, Response: PlaygroundTokenResponse{}, Paginated: true,
+		Query: append([]*openapi.Parameter{openapi.QueryParam("agent_id", "string", "only tokens of this agent")}, listQueryParameters...),
+	})
+	g.Describe(http.MethodPost, prefix+"/playground-tokens", openapi.Endpoint{
+		Summary: "Issue a playground token, the token is only returned here", Tags: playgroundTags,
+		Request: PlaygroundTokenRequest{}, Response: PlaygroundTokenResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodDelete, prefix+"/playground-tokens/:id", openapi.Endpoint{
+		Summary: "Revoke a playground token", Tags: playgroundTags,
+	})
+
+	notificationTags := []string{"Notification Channels"}
+	g.Describe(http.MethodGet, prefix+"/notification-channels", openapi.Endpoint{
+		Summary: "List notification channels", Tags: notificationTags, Response: NotificationChannelResponse{}, Paginated: true,
+		Query: listQueryParameters,
+	})
+	g.Describe(http.MethodPost, prefix+"/notification-channels", openapi.Endpoint{
+		Summary: "Create a Slack, Teams or email notification channel", Tags: notificationTags,
+		Request: NotificationChannelRequest{}, Response: NotificationChannelResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodGet, prefix+"/notification-channels/:id", openapi.Endpoint{
+		Summary: "Get notification channel", Tags: notificationTags, Response: NotificationChannelResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/notification-channels/:id", openapi.Endpoint{
+		Summary: "Update notification channel, an empty webhook_url keeps the stored one", Tags: notificationTags,
+		Request: NotificationChannelRequest{}, Response: NotificationChannelResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/notification-channels/:id", openapi.Endpoint{
+		Summary: "Delete notification channel", Tags: notificationTags,
+	})
+	g.Describe(http.MethodPost, prefix+"/notification-channels/:id/test", openapi.Endpoint{
+		Summary: "Send a test message through the channel, to every recipient of an email channel", Tags: notificationTags,
+	})
+
+	maintenanceTags := []string{"Maintenance Windows"}
+	g.Describe(http.MethodGet, prefix+"/maintenance-windows", openapi.Endpoint{
+		Summary: "List maintenance windows, status is scheduled, active or ended", Tags: maintenanceTags,
+		Response: MaintenanceWindowResponse{}, Paginated: true, Query: listQueryParameters,
+	})
+	g.Describe(http.MethodPost, prefix+"/maintenance-windows", openapi.Endpoint{
+		Summary: "Schedule maintenance of an agent, or of all agents without agent_id", Tags: maintenanceTags,
+		Request: MaintenanceWindowRequest{}, Response: MaintenanceWindowResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodGet, prefix+"/maintenance-windows/:id", openapi.Endpoint{
+		Summary: "Get maintenance window", Tags: maintenanceTags, Response: MaintenanceWindowResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/maintenance-windows/:id", openapi.Endpoint{
+		Summary: "Update maintenance window, e.g. to end it early or extend it", Tags: maintenanceTags,
+		Request: MaintenanceWindowRequest{}, Response: MaintenanceWindowResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/maintenance-windows/:id", openapi.Endpoint{
+		Summary: "Delete maintenance window", Tags: maintenanceTags,
+	})
+
+	tierTags := []string{"Key Tiers"}
+	g.Describe(http.MethodGet, prefix+"/tiers", openapi.Endpoint{
+		Summary: "List key tiers", Tags: tierTags, Response: KeyTierResponse{}, Paginated: true, Query: listQueryParameters,
+	})
+	g.Describe(http.MethodPost, prefix+"/tiers", openapi.Endpoint{
+		Summary: "Create a key tier with the features its keys may use: streaming, tools and vision", Tags: tierTags,
+		Request: KeyTierRequest{}, Response: KeyTierResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodGet, prefix+"/tiers/:id", openapi.Endpoint{
+		Summary: "Get key tier", Tags: tierTags, Response: KeyTierResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/tiers/:id", openapi.Endpoint{
+		Summary: "Update key tier, a tier agents use cannot be renamed", Tags: tierTags,
+		Request: KeyTierRequest{}, Response: KeyTierResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/tiers/:id", openapi.Endpoint{
+		Summary: "Delete key tier, refused while agents use it", Tags: tierTags,
+	})
+
+	poolTags := []string{"Quota Pools"}
+	g.Describe(http.MethodGet, prefix+"/quota-pools", openapi.Endpoint{
+		Summary: "List quota pools", Tags: poolTags, Response: QuotaPoolResponse{}, Paginated: true, Query: listQueryParameters,
+	})
+	g.Describe(http.MethodPost, prefix+"/quota-pools", openapi.Endpoint{
+		Summary: "Create a quota pool, a token and request budget per day or month shared by the keys of its agents", Tags: poolTags,
+		Request: QuotaPoolRequest{}, Response: QuotaPoolResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodGet, prefix+"/quota-pools/:id", openapi.Endpoint{
+		Summary: "Get quota pool", Tags: poolTags, Response: QuotaPoolResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/quota-pools/:id", openapi.Endpoint{
+		Summary: "Update quota pool, a pool agents draw from cannot be renamed", Tags: poolTags,
+		Request: QuotaPoolRequest{}, Response: QuotaPoolResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/quota-pools/:id", openapi.Endpoint{
+		Summary: "Delete quota pool, refused while agents draw from it", Tags: poolTags,
+	})
+	g.Describe(http.MethodGet, prefix+"/quota-pools/:id/usage", openapi.Endpoint{
+		Summary: "What the pool and each member key drew in the current period", Tags: poolTags, Response: QuotaPoolUsageResponse{},
+	})
+
+	sandboxTags := []string{"Sandbox"}
+	g.Describe(http.MethodGet, prefix+"/sandbox/agents", openapi.Endpoint{
+		Summary: "List sandbox agents, of one sandbox with owner", Tags: sandboxTags,
+		Response: AgentResponse{}, Paginated: true,
+		Query: append(append([]*openapi.Parameter{}, listQueryParameters...), openapi.QueryParam("owner", "string", "only the agents of this developer's sandbox")),
+	})
+	g.Describe(http.MethodPost, prefix+"/sandbox/agents", openapi.Endpoint{
+		Summary: "Create a temporary agent in a developer's sandbox, held to the sandbox limits and deleted when it expires", Tags: sandboxTags,
+		Request: SandboxAgentRequest{}, Response: AgentResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodDelete, prefix+"/sandbox/agents/:id", openapi.Endpoint{
+		Summary: "Delete a sandbox agent with its keys and Redis state before it expires", Tags: sandboxTags,
+	})
+
+	goldenTags := []string{"Golden Prompts"}
+	goldenAgentQuery := openapi.QueryParam("agent_id", "string", "only those of this agent")
+	g.Describe(http.MethodGet, prefix+"/golden-prompts", openapi.Endpoint{
+		Summary: "List golden prompts, status is enabled or disabled", Tags: goldenTags,
+		Response: GoldenPromptResponse{}, Paginated: true,
+		Query: append(append([]*openapi.Parameter{}, listQueryParameters...), goldenAgentQuery),
+	})
+	g.Describe(http.MethodPost, prefix+"/golden-prompts", openapi.Endpoint{
+		Summary: "Create a golden prompt of an agent with its approved reference answer", Tags: goldenTags,
+		Request: GoldenPromptRequest{}, Response: GoldenPromptResponse{}, Status: http.StatusCreated,
+	})
+	g.Describe(http.MethodGet, prefix+"/golden-prompts/:id", openapi.Endpoint{
+		Summary: "Get golden prompt", Tags: goldenTags, Response: GoldenPromptResponse{},
+	})
+	g.Describe(http.MethodPut, prefix+"/golden-prompts/:id", openapi.Endpoint{
+		Summary: "Update golden prompt, e.g. to approve a new reference answer", Tags: goldenTags,
+		Request: GoldenPromptRequest{}, Response: GoldenPromptResponse{},
+	})
+	g.Describe(http.MethodDelete, prefix+"/golden-prompts/:id", openapi.Endpoint{
+		Summary: "Delete golden prompt, results of past runs are kept", Tags: goldenTags,
+	})
+	g.Describe(http.MethodGet, prefix+"/golden-runs", openapi.Endpoint{
+		Summary: "List golden runs without results, status is running, passed, regressed or failed, type is manual or agent_update", Tags: goldenTags,
+		Response: GoldenRunResponse{}, Paginated: true,
+		Query: append(append([]*openapi.Parameter{}, listQueryParameters...), goldenAgentQuery),
+	})
+	g.Describe(http.MethodPost, prefix+"/golden-runs", openapi.Endpoint{
+		Summary: "Run the enabled golden prompts of an agent in the background; 409 while a run of the agent is in progress", Tags: goldenTags,
+		Request: GoldenRunRequest{}, Response: GoldenRunResponse{}, Status: http.StatusAccepted,
+	})
+	g.Describe(http.MethodGet, prefix+"/golden-runs/:id", openapi.Endpoint{
+		Summary: "Get golden run with every answer, its similarity and its line diff against the reference", Tags: goldenTags,
+		Response: GoldenRunResponse{},
+	})
+
+	usageTags := []string{"Usage"}
+	usageFilterParameters := []*openapi.Parameter{
+		openapi.QueryParam("agent_id", "string", "only requests to this agent"),
+		openapi.QueryParam("from", "string", "start of the time range, RFC 3339 or YYYY-MM-DD"),
+		openapi.QueryParam("to", "string", "exclusive end of the time range, RFC 3339 or YYYY-MM-DD"),
+		openapi.QueryParam("tag", "string", "metadata filter key:value, repeat to require several tags"),
+	}
+	g.Describe(http.MethodGet, prefix+"/usage", openapi.Endpoint{
+		Summary: "List usage records, status is success, failed or client_cancelled", Tags: usageTags,
+		Response: UsageRecordResponse{}, Paginated: true,
+		Query: append(append([]*openapi.Parameter{}, listQueryParameters...), usageFilterParameters...),
+	})
+	g.Describe(http.MethodGet, prefix+"/usage/:id", openapi.Endpoint{
+		Summary: "Get usage record with the stored prompt and response", Tags: usageTags,
+		Response: UsageRecordResponse{},
+	})
+	g.Describe(http.MethodPost, prefix+"/usage/:id/replay", openapi.Endpoint{
+		Summary: "Send the stored request again, to the record's agent or agent_id, and diff the answer against the stored one; 409 when the request was not stored in full", Tags: usageTags,
+		Request: UsageReplayRequest{}, Response: dataflow.ReplayResult{},
+	})
+	g.Describe(http.MethodGet, prefix+"/usage/summary", openapi.Endpoint{
+		Summary: "Aggregate usage and cost by agent or metadata keys for charge-back", Tags: usageTags,
+		Response: UsageReportResponse{},
+		Query: append([]*openapi.Parameter{
+			openapi.QueryParam("group_by", "string", "agent (default) or metadata.<key>, up to two comma separated, e.g. metadata.project,agent"),
+			openapi.QueryParam("format", "string", "json (default) or csv for a CSV download"),
+		}, usageFilterParameters...),
+	})
+	g.Describe(http.MethodGet, prefix+"/usage/quality", openapi.Endpoint{
+		Summary: "Average judge scores per agent, day and rubric of the sampled responses", Tags: usageTags,
+		Response: UsageQualityResponse{},
+		Query:    usageFilterParameters,
+	})
+
+	g.Describe(http.MethodPost, prefix+"/usage/reencrypt", openapi.Endpoint{
+		Summary: "Move stored prompt and response text to the current data keys, 409 when encryption is off", Tags: usageTags,
+		Response: internal.ReencryptResult{},
+	})
+	g.Describe(http.MethodGet, prefix+"/usage/forecast", openapi.Endpoint{
+		Summary: "Projected 30-day requests, tokens and cost per agent and days until the monthly budget is used up", Tags: usageTags,
+		Response: UsageForecastResponse{},
+		Query:    []*openapi.Parameter{openapi.QueryParam("agent_id", "string", "only the forecast of this agent")},
+	})
+	g.Describe(http.MethodPost, prefix+"/usage/forecast/refresh", openapi.Endpoint{
+		Summary: "Refit the usage forecasts of all agents now instead of waiting for the next run", Tags: usageTags,
+		Response: UsageForecastResponse{},
+	})
+
+	syncTags := []string{"Sync"}
+	g.Describe(http.MethodPost, prefix+"/sync/plan", openapi.Endpoint{
+		Summary: "Plan the changes of a declarative spec (YAML or JSON body)", Tags: syncTags,
+		Request: internal.PlatformSpec{}, Response: internal.SyncPlan{},
+	})
+	g.Describe(http.MethodPost, prefix+"/sync/apply", openapi.Endpoint{
+		Summary: "Apply a declarative spec (YAML or JSON body)", Tags: syncTags,
+		Query:   []*openapi.Parameter{openapi.QueryParam("fingerprint", "string", "fingerprint of a previous plan, apply fails with 409 when the state changed")},
+		Request: internal.PlatformSpec{}, Response: internal.SyncResult{},
+	})
+	g.Describe(http.MethodGet, prefix+"/sync/export", openapi.Endpoint{
+		Summary: "Export the configuration as a spec with its checksum, source API keys left out", Tags: syncTags,
+		Query:    []*openapi.Parameter{openapi.QueryParam("format", "string", "yaml for a YAML document instead of JSON")},
+		Response: internal.PlatformSpec{},
+	})
+	g.Describe(http.MethodPost, prefix+"/sync/import", openapi.Endpoint{
+		Summary: "Apply an exported spec, fails with 400 when it was changed after the export", Tags: syncTags,
+		Query:   []*openapi.Parameter{openapi.QueryParam("fingerprint", "string", "fingerprint of a previous plan, import fails with 409 when the state changed")},
+		Request: internal.PlatformSpec{}, Response: internal.SyncResult{},
+	})
+	g.Describe(http.MethodPost, prefix+"/sync/drift", openapi.Endpoint{
+		Summary: "Compare the configuration with a spec, such as the export of another environment", Tags: syncTags,
+		Request: internal.PlatformSpec{}, Response: internal.SyncDrift{},
+	})
+
+	jobTags := []string{"Jobs"}
+	g.Describe(http.MethodGet, prefix+"/jobs", openapi.Endpoint{
+		Summary: "Status of the control flow background jobs: schedule, next run, last error and recent runs", Tags: jobTags,
+		Response: []jobs.Status{},
+	})
+	g.Describe(http.MethodGet, prefix+"/jobs/runs", openapi.Endpoint{
+		Summary: "Stored runs of the background jobs of every service, newest first", Tags: jobTags,
+		Query: []*openapi.Parameter{
+			openapi.QueryParam("service", "string", "control-flow-api, auth-api or dataflow-api"),
+			openapi.QueryParam("job", "string", "job name"),
+			openapi.QueryParam("limit", "integer", "runs returned, 50 by default and at most 500"),
+		},
+		Response: []internal.JobRun{},
+	})
+	g.Describe(http.MethodPost, prefix+"/jobs/:name/run", openapi.Endpoint{
+		Summary: "Run a background job now, 409 while it is running", Tags: jobTags,
+		Response: jobs.Status{}, Status: http.StatusAccepted,
+	})
+
+	g.Describe(http.MethodGet, "/api/v1/internal/agents/:agent_id", openapi.Endpoint{
+		Summary: "Get agent configuration including secrets", Tags: []string{"Internal"},
+		Response: map[string]interface{}{}, Security: []string{"serviceToken"},
+	})
+	g.Describe(http.MethodGet, "/health", openapi.Endpoint{
+		Summary: "Health check", Tags: []string{"System"}, Response: map[string]interface{}{}, Raw: true,
+	})
+
+	return g
+}
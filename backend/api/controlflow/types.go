@@ -2,7 +2,10 @@ package controlflow
 
 import (
 	"agent-connector/internal"
+	"agent-connector/pkg/quota"
+	"agent-connector/pkg/textdiff"
 	"agent-connector/pkg/types"
+	"strings"
 	"time"
 )
 
@@ -16,10 +19,11 @@ type ControlFlowResponse struct {
 
 // APIError API error structure
 type APIError struct {
-	Type    string `json:"type"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Type    string            `json:"type"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details string            `json:"details,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"` // message per rejected request field
 }
 
 // ControlFlowPaginationResponse control flow API pagination response structure
@@ -41,27 +45,77 @@ type PaginationInfo struct {
 
 // SystemConfigRequest system configuration request structure
 type SystemConfigRequest struct {
-	// Currently no configurable fields, but keeping structure for future use
+	RateLimitMode           string `json:"rate_limit_mode" binding:"omitempty,oneof=enforce monitor off"`           // empty keeps enforcing
+	ImpersonationTTLMinutes int    `json:"impersonation_ttl_minutes" binding:"min=0"`                               // 0 keeps the configured lifetime
+	DefaultQPS              int    `json:"default_qps" binding:"min=0"`                                             // QPS of each user of an agent without an override, 0 keeps security.default_rate_limit
+	DefaultPriority         int    `json:"default_priority" binding:"min=0,max=100"`                                // queue priority of users without one, 0 keeps 50
+	LoginAnomalySensitivity string `json:"login_anomaly_sensitivity" binding:"omitempty,oneof=off low medium high"` // empty keeps security.login_anomaly_sensitivity
+	Version                 int    `json:"version" binding:"min=0"`                                                 // version the change is based on, 0 skips the check
 }
 
 // SystemConfigResponse system configuration response structure
 type SystemConfigResponse struct {
-	ID        uint      `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                      uint      `json:"id"`
+	RateLimitMode           string    `json:"rate_limit_mode"`
+	ImpersonationTTLMinutes int       `json:"impersonation_ttl_minutes"`
+	DefaultQPS              int       `json:"default_qps"`
+	DefaultPriority         int       `json:"default_priority"`
+	LoginAnomalySensitivity string    `json:"login_anomaly_sensitivity"`
+	Version                 int       `json:"version"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
 }
 
 // AgentRequest agent configuration request structure
 type AgentRequest struct {
-	Name             string `json:"name" binding:"required"`
-	Type             string `json:"type" binding:"required,oneof=openai dify-chat dify-workflow"`
-	URL              string `json:"url" binding:"required,url"`
-	SourceAPIKey     string `json:"source_api_key" binding:"required"`
-	QPS              int    `json:"qps" binding:"min=1"`
-	Enabled          bool   `json:"enabled"`
-	Description      string `json:"description"`
-	SupportStreaming bool   `json:"support_streaming"`
-	ResponseFormat   string `json:"response_format" binding:"oneof=openai dify"`
+	Name                string  `json:"name" binding:"required"`
+	Type                string  `json:"type" binding:"required,oneof=openai dify-chat dify-workflow mock"`
+	URL                 string  `json:"url" binding:"required_unless=Type mock,omitempty,url"` // options of mock agents
+	SourceAPIKey        string  `json:"source_api_key" binding:"required_unless=Type mock"`
+	QPS                 int     `json:"qps" binding:"min=1"`
+	Enabled             bool    `json:"enabled"`
+	Description         string  `json:"description"`
+	SupportStreaming    bool    `json:"support_streaming"`
+	ResponseFormat      string  `json:"response_format" binding:"oneof=openai dify"`
+	PromptPrice         float64 `json:"prompt_price" binding:"min=0"`     // cost per 1K prompt tokens
+	CompletionPrice     float64 `json:"completion_price" binding:"min=0"` // cost per 1K completion tokens
+	MonthlyBudget       float64 `json:"monthly_budget" binding:"min=0"`   // planned cost per calendar month, 0 means none
+	HedgeAgentID        string  `json:"hedge_agent_id"`                   // agent raced against this one when the first byte is late
+	HedgeAfterMs        int     `json:"hedge_after_ms" binding:"min=0"`
+	ContinueOnInterrupt bool    `json:"continue_on_interrupt"`                                                       // re-prompt the agent when its stream breaks off
+	ContextWindow       int     `json:"context_window" binding:"min=0"`                                              // prompt and completion tokens, 0 disables the check
+	ContextOverflow     string  `json:"context_overflow" binding:"omitempty,oneof=reject truncate_oldest summarize"` // what to do with prompts beyond the window
+	PriorityOverride    bool    `json:"priority_override"`                                                           // connector key requests may set X-Priority
+	QPSSharing          bool    `json:"qps_sharing"`                                                                 // share the QPS among the agent's users by priority
+	UserQPS             int     `json:"user_qps" binding:"min=0"`                                                    // QPS of each user of the connector key, overrides the user and system defaults, 0 inherits
+	RecordMode          string  `json:"record_mode" binding:"omitempty,oneof=record replay"`                         // capture upstream exchanges as fixtures or answer from them
+	PrivacyMode         bool    `json:"privacy_mode"`                                                                // never store prompts, usage analytics only as k-anonymized summaries
+	MaxTemperature      float64 `json:"max_temperature" binding:"min=0,max=2"`                                       // highest temperature clients may request, 0 disables the cap
+	MaxTokensCap        int     `json:"max_tokens_cap" binding:"min=0"`                                              // highest max_tokens clients may request, 0 disables the cap
+	ForbiddenParameters string  `json:"forbidden_parameters" binding:"max=500"`                                      // comma separated, e.g. logit_bias,top_logprobs
+	MaxMessages         int     `json:"max_messages" binding:"min=0"`                                                // most messages of a chat request, 0 inherits the endpoint limit
+	MaxMessageBytes     int     `json:"max_message_bytes" binding:"min=0"`                                           // largest message or Dify query in bytes, 0 inherits the endpoint limit
+	MaxInputs           int     `json:"max_inputs" binding:"min=0"`                                                  // most Dify inputs of a request, 0 inherits the endpoint limit
+	GuardrailPolicy     string  `json:"guardrail_policy" binding:"omitempty,oneof=clamp reject"`                     // clamp or reject requests beyond the caps
+	OutputFilter        string  `json:"output_filter" binding:"max=100"`                                             // comma separated redaction rules applied to answers, e.g. email,credit_card
+	BlockedWords        string  `json:"blocked_words" binding:"max=1000"`                                            // comma separated words the output filter matches
+	OutputFilterAction  string  `json:"output_filter_action" binding:"omitempty,oneof=redact block"`                 // mask the matches or withhold the answer
+	RequireSignature    bool    `json:"require_signature"`                                                           // requests with the connector key must be HMAC signed
+	StreamTokenRate     int     `json:"stream_token_rate" binding:"min=0"`                                           // tokens per second streamed to clients, 0 disables pacing
+	Passthrough         bool    `json:"passthrough"`                                                                 // forward OpenAI routes the connector does not implement verbatim
+	Tier                string  `json:"tier" binding:"max=50"`                                                       // key tier limiting the features of the connector key, empty allows all
+	AccessSchedule      string  `json:"access_schedule" binding:"max=500"`                                           // windows the connector key may be used in, e.g. Mon-Fri 09:00-18:00, empty allows any time
+	AccessTimezone      string  `json:"access_timezone" binding:"max=64"`                                            // IANA time zone of the schedule, e.g. Europe/Berlin, empty means UTC
+	QuotaPool           string  `json:"quota_pool" binding:"max=50"`                                                 // quota pool the connector key draws from, empty has no shared quota
+	PoolTokenLimit      int64   `json:"pool_token_limit" binding:"min=0"`                                            // tokens of the pool the key may use per period, 0 leaves only the pool limit
+	PoolRequestLimit    int64   `json:"pool_request_limit" binding:"min=0"`                                          // requests of the pool the key may make per period, 0 leaves only the pool limit
+}
+
+// AgentPatchDocument agent configuration a JSON merge patch is applied to, members removed
+// by the patch fall back to their zero value
+type AgentPatchDocument struct {
+	AgentRequest
+	Version int `json:"version" binding:"min=0"` // version the patch is based on, 0 skips the check
 }
 
 // AgentResponse agent configuration response structure
@@ -70,30 +124,472 @@ type AgentResponse struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
 
-	URL              string    `json:"url"`
-	SourceAPIKey     string    `json:"source_api_key,omitempty"` // in some cases, it may be necessary to hide
-	ConnectorAPIKey  string    `json:"connector_api_key"`
-	AgentID          string    `json:"agent_id"`
-	QPS              int       `json:"qps"`
-	Enabled          bool      `json:"enabled"`
-	Description      string    `json:"description"`
-	SupportStreaming bool      `json:"support_streaming"`
-	ResponseFormat   string    `json:"response_format"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	URL                 string     `json:"url"`
+	SourceAPIKey        string     `json:"source_api_key,omitempty"`    // in some cases, it may be necessary to hide
+	ConnectorAPIKey     string     `json:"connector_api_key,omitempty"` // only returned once, when the key is generated
+	ConnectorKeyPrefix  string     `json:"connector_key_prefix"`
+	AgentID             string     `json:"agent_id"`
+	QPS                 int        `json:"qps"`
+	Enabled             bool       `json:"enabled"`
+	Description         string     `json:"description"`
+	SupportStreaming    bool       `json:"support_streaming"`
+	ResponseFormat      string     `json:"response_format"`
+	PromptPrice         float64    `json:"prompt_price"`
+	CompletionPrice     float64    `json:"completion_price"`
+	MonthlyBudget       float64    `json:"monthly_budget"`
+	HedgeAgentID        string     `json:"hedge_agent_id"`
+	HedgeAfterMs        int        `json:"hedge_after_ms"`
+	ContinueOnInterrupt bool       `json:"continue_on_interrupt"`
+	ContextWindow       int        `json:"context_window"`
+	ContextOverflow     string     `json:"context_overflow"`
+	PriorityOverride    bool       `json:"priority_override"`
+	QPSSharing          bool       `json:"qps_sharing"`
+	UserQPS             int        `json:"user_qps"`
+	RecordMode          string     `json:"record_mode"`
+	PrivacyMode         bool       `json:"privacy_mode"`
+	MaxTemperature      float64    `json:"max_temperature"`
+	MaxTokensCap        int        `json:"max_tokens_cap"`
+	ForbiddenParameters string     `json:"forbidden_parameters"`
+	MaxMessages         int        `json:"max_messages"`
+	MaxMessageBytes     int        `json:"max_message_bytes"`
+	MaxInputs           int        `json:"max_inputs"`
+	GuardrailPolicy     string     `json:"guardrail_policy"`
+	OutputFilter        string     `json:"output_filter"`
+	BlockedWords        string     `json:"blocked_words"`
+	OutputFilterAction  string     `json:"output_filter_action"`
+	RequireSignature    bool       `json:"require_signature"`
+	SigningSecretSet    bool       `json:"signing_secret_set"` // the secret itself is only returned when it is rotated
+	StreamTokenRate     int        `json:"stream_token_rate"`
+	Passthrough         bool       `json:"passthrough"`
+	Tier                string     `json:"tier"`
+	AccessSchedule      string     `json:"access_schedule"`
+	AccessTimezone      string     `json:"access_timezone"`
+	QuotaPool           string     `json:"quota_pool"`
+	PoolTokenLimit      int64      `json:"pool_token_limit"`
+	PoolRequestLimit    int64      `json:"pool_request_limit"`
+	Namespace           string     `json:"namespace"`            // sandbox:<owner> for sandbox agents, empty in production
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"` // when a sandbox agent is deleted
+	Version             int        `json:"version"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 // AgentUpdateRequest agent update request structure
 type AgentUpdateRequest struct {
-	Name             *string `json:"name,omitempty"`
-	Type             *string `json:"type,omitempty" binding:"omitempty,oneof=openai dify-chat dify-workflow"`
-	URL              *string `json:"url,omitempty" binding:"omitempty,url"`
-	SourceAPIKey     *string `json:"source_api_key,omitempty"`
-	QPS              *int    `json:"qps,omitempty" binding:"omitempty,min=1"`
-	Enabled          *bool   `json:"enabled,omitempty"`
-	Description      *string `json:"description,omitempty"`
-	SupportStreaming *bool   `json:"support_streaming,omitempty"`
-	ResponseFormat   *string `json:"response_format,omitempty" binding:"omitempty,oneof=openai dify"`
+	Name                *string  `json:"name,omitempty"`
+	Type                *string  `json:"type,omitempty" binding:"omitempty,oneof=openai dify-chat dify-workflow mock"`
+	URL                 *string  `json:"url,omitempty" binding:"omitempty,url"`
+	SourceAPIKey        *string  `json:"source_api_key,omitempty"`
+	QPS                 *int     `json:"qps,omitempty" binding:"omitempty,min=1"`
+	Enabled             *bool    `json:"enabled,omitempty"`
+	Description         *string  `json:"description,omitempty"`
+	SupportStreaming    *bool    `json:"support_streaming,omitempty"`
+	ResponseFormat      *string  `json:"response_format,omitempty" binding:"omitempty,oneof=openai dify"`
+	PromptPrice         *float64 `json:"prompt_price,omitempty" binding:"omitempty,min=0"`
+	CompletionPrice     *float64 `json:"completion_price,omitempty" binding:"omitempty,min=0"`
+	MonthlyBudget       *float64 `json:"monthly_budget,omitempty" binding:"omitempty,min=0"`
+	HedgeAgentID        *string  `json:"hedge_agent_id,omitempty"`
+	HedgeAfterMs        *int     `json:"hedge_after_ms,omitempty" binding:"omitempty,min=0"`
+	ContinueOnInterrupt *bool    `json:"continue_on_interrupt,omitempty"`
+	ContextWindow       *int     `json:"context_window,omitempty" binding:"omitempty,min=0"`
+	ContextOverflow     *string  `json:"context_overflow,omitempty" binding:"omitempty,oneof=reject truncate_oldest summarize"`
+	PriorityOverride    *bool    `json:"priority_override,omitempty"`
+	QPSSharing          *bool    `json:"qps_sharing,omitempty"`
+	UserQPS             *int     `json:"user_qps,omitempty" binding:"omitempty,min=0"`
+	RecordMode          *string  `json:"record_mode,omitempty" binding:"omitempty,oneof=off record replay"`
+	PrivacyMode         *bool    `json:"privacy_mode,omitempty"`
+	MaxTemperature      *float64 `json:"max_temperature,omitempty" binding:"omitempty,min=0,max=2"`
+	MaxTokensCap        *int     `json:"max_tokens_cap,omitempty" binding:"omitempty,min=0"`
+	ForbiddenParameters *string  `json:"forbidden_parameters,omitempty" binding:"omitempty,max=500"`
+	MaxMessages         *int     `json:"max_messages,omitempty" binding:"omitempty,min=0"`
+	MaxMessageBytes     *int     `json:"max_message_bytes,omitempty" binding:"omitempty,min=0"`
+	MaxInputs           *int     `json:"max_inputs,omitempty" binding:"omitempty,min=0"`
+	GuardrailPolicy     *string  `json:"guardrail_policy,omitempty" binding:"omitempty,oneof=clamp reject"`
+	OutputFilter        *string  `json:"output_filter,omitempty" binding:"omitempty,max=100"`
+	BlockedWords        *string  `json:"blocked_words,omitempty" binding:"omitempty,max=1000"`
+	OutputFilterAction  *string  `json:"output_filter_action,omitempty" binding:"omitempty,oneof=redact block"`
+	RequireSignature    *bool    `json:"require_signature,omitempty"`
+	StreamTokenRate     *int     `json:"stream_token_rate,omitempty" binding:"omitempty,min=0"`
+	Passthrough         *bool    `json:"passthrough,omitempty"`
+	Tier                *string  `json:"tier,omitempty" binding:"omitempty,max=50"`
+	AccessSchedule      *string  `json:"access_schedule,omitempty" binding:"omitempty,max=500"`
+	AccessTimezone      *string  `json:"access_timezone,omitempty" binding:"omitempty,max=64"`
+	QuotaPool           *string  `json:"quota_pool,omitempty" binding:"omitempty,max=50"`
+	PoolTokenLimit      *int64   `json:"pool_token_limit,omitempty" binding:"omitempty,min=0"`
+	PoolRequestLimit    *int64   `json:"pool_request_limit,omitempty" binding:"omitempty,min=0"`
+	Version             *int     `json:"version,omitempty" binding:"omitempty,min=1"` // version the changes are based on, omit to skip the check
+}
+
+// SigningSecretResponse the new HMAC secret of an agent, returned only once
+type SigningSecretResponse struct {
+	AgentID       string `json:"agent_id"`
+	SigningSecret string `json:"signing_secret"`
+}
+
+// BatchAgentStatusRequest enable or disable several agents at once
+type BatchAgentStatusRequest struct {
+	IDs     []uint `json:"ids" binding:"required,min=1,max=500"`
+	Enabled *bool  `json:"enabled" binding:"required"`
+}
+
+// BatchItemResult outcome of one item of a batch request
+type BatchItemResult struct {
+	Index   int    `json:"index"`
+	ID      uint   `json:"id,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchResponse per-item results of a batch request
+type BatchResponse struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// Add record the outcome of one item
+func (r *BatchResponse) Add(index int, id uint, err error) {
+	result := BatchItemResult{Index: index, ID: id, Success: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+		r.Failed++
+	} else {
+		r.Succeeded++
+	}
+	r.Total++
+	r.Results = append(r.Results, result)
+}
+
+// AgentQueueConfigRequest agent queue override request structure
+type AgentQueueConfigRequest struct {
+	MaxQueueSize *int64 `json:"max_queue_size" binding:"required,min=0"`
+	DefaultTTL   *int64 `json:"default_ttl" binding:"required,min=0"`
+}
+
+// AgentQueueConfigResponse agent queue override response structure
+type AgentQueueConfigResponse struct {
+	AgentID      string     `json:"agent_id"`
+	QueueName    string     `json:"queue_name"`
+	MaxQueueSize int64      `json:"max_queue_size"`
+	DefaultTTL   int64      `json:"default_ttl"`
+	Override     bool       `json:"override"`               // whether a per-agent override is stored
+	Applied      bool       `json:"applied"`                // whether the queue layer reflects the stored values
+	CurrentSize  *int64     `json:"current_size,omitempty"` // only present when the queue layer is reachable
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// AgentACLRequest agent access list request structure, empty lists allow every caller
+type AgentACLRequest struct {
+	Users []string `json:"users"` // platform usernames
+	Roles []string `json:"roles"` // user groups: admin, operator, user or readonly
+	Keys  []string `json:"keys"`  // connector key or playground token prefixes, full keys are cut to their prefix
+}
+
+// AgentACLResponse agent access list response structure
+type AgentACLResponse struct {
+	AgentID    string   `json:"agent_id"`
+	Users      []string `json:"users"`
+	Roles      []string `json:"roles"`
+	Keys       []string `json:"keys"`
+	Restricted bool     `json:"restricted"` // whether the list limits who may call the agent
+}
+
+// PlaygroundTokenRequest playground token issue request structure
+type PlaygroundTokenRequest struct {
+	Name      string `json:"name" binding:"required"`
+	AgentID   string `json:"agent_id" binding:"required"`
+	QPS       int    `json:"qps" binding:"required,min=1,max=10"`
+	MaxTokens int    `json:"max_tokens" binding:"min=0"`
+	ExpiresIn int64  `json:"expires_in" binding:"required,min=60"` // validity in seconds
+}
+
+// PlaygroundTokenResponse playground token response structure
+type PlaygroundTokenResponse struct {
+	ID          uint       `json:"id"`
+	Name        string     `json:"name"`
+	Token       string     `json:"token,omitempty"` // only returned once, when the token is issued
+	TokenPrefix string     `json:"token_prefix"`
+	AgentID     string     `json:"agent_id"`
+	QPS         int        `json:"qps"`
+	MaxTokens   int        `json:"max_tokens"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Revoked     bool       `json:"revoked"`
+	Active      bool       `json:"active"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NotificationChannelRequest notification channel create/update request structure
+type NotificationChannelRequest struct {
+	Name           string                         `json:"name" binding:"required"`
+	Type           string                         `json:"type" binding:"required,oneof=slack teams email"`
+	WebhookURL     string                         `json:"webhook_url"` // slack and teams only, empty keeps the stored URL on update
+	EventTypes     []string                       `json:"event_types" binding:"required,min=1"`
+	AgentIDs       []string                       `json:"agent_ids"` // empty means all agents
+	Enabled        *bool                          `json:"enabled"`
+	Recipients     []NotificationRecipientRequest `json:"recipients" binding:"dive"` // email only
+	DigestInterval int                            `json:"digest_interval"`           // minutes, email only, defaults to 60
+}
+
+// NotificationRecipientRequest email channel recipient
+type NotificationRecipientRequest struct {
+	Email      string   `json:"email" binding:"required,email"`
+	EventTypes []string `json:"event_types"` // empty means the event types of the channel
+	Digest     bool     `json:"digest"`      // collect notifications into one mail per digest interval
+}
+
+// NotificationRecipientResponse email channel recipient response structure
+type NotificationRecipientResponse struct {
+	Email      string   `json:"email"`
+	EventTypes []string `json:"event_types"`
+	Digest     bool     `json:"digest"`
+}
+
+// NotificationChannelResponse notification channel response structure
+type NotificationChannelResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	WebhookURL string     `json:"webhook_url"` // masked, the path carries the webhook secret
+	EventTypes []string   `json:"event_types"`
+	AgentIDs   []string   `json:"agent_ids"`
+	Enabled    bool       `json:"enabled"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	Recipients     []*NotificationRecipientResponse `json:"recipients,omitempty"`
+	DigestInterval int                              `json:"digest_interval,omitempty"`
+}
+
+// MaintenanceWindowRequest maintenance window create/update request structure
+type MaintenanceWindowRequest struct {
+	Name     string    `json:"name" binding:"required"`
+	AgentID  string    `json:"agent_id"` // empty means all agents
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+	Message  string    `json:"message" binding:"max=500"` // returned to clients during the maintenance
+}
+
+// MaintenanceWindowResponse maintenance window response structure
+type MaintenanceWindowResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	AgentID   string    `json:"agent_id"`
+	Global    bool      `json:"global"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"` // scheduled, active or ended
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// KeyTierRequest key tier create/update request structure, a feature left out is disabled
+type KeyTierRequest struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	Description string `json:"description" binding:"max=500"`
+	Streaming   bool   `json:"streaming"` // streamed responses
+	Tools       bool   `json:"tools"`     // tools and function calling
+	Vision      bool   `json:"vision"`    // image inputs
+}
+
+// KeyTierResponse key tier response structure
+type KeyTierResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Streaming   bool      `json:"streaming"`
+	Tools       bool      `json:"tools"`
+	Vision      bool      `json:"vision"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// QuotaPoolRequest quota pool create/update request structure
+type QuotaPoolRequest struct {
+	Name         string `json:"name" binding:"required,max=50"`
+	Description  string `json:"description" binding:"max=500"`
+	Period       string `json:"period" binding:"omitempty,oneof=day month"` // budget period in UTC, month when empty
+	TokenLimit   int64  `json:"token_limit" binding:"min=0"`                // tokens of all keys together per period, 0 means unlimited
+	RequestLimit int64  `json:"request_limit" binding:"min=0"`              // requests of all keys together per period, 0 means unlimited
+}
+
+// SandboxAgentRequest sandbox agent create request structure, the sandbox sets the
+// limits of the agent
+type SandboxAgentRequest struct {
+	Owner            string `json:"owner" binding:"required"` // the developer whose sandbox gets the agent
+	Name             string `json:"name" binding:"required"`
+	Type             string `json:"type" binding:"required,oneof=openai dify-chat dify-workflow mock"`
+	URL              string `json:"url" binding:"required_unless=Type mock,omitempty,url"`
+	SourceAPIKey     string `json:"source_api_key" binding:"required_unless=Type mock"`
+	Description      string `json:"description"`
+	SupportStreaming bool   `json:"support_streaming"`
+	ResponseFormat   string `json:"response_format" binding:"omitempty,oneof=openai dify"` // openai when empty
+	QPS              int    `json:"qps" binding:"min=0"`                                   // sandbox.qps when 0, never above it
+	MaxTokensCap     int    `json:"max_tokens_cap" binding:"min=0"`                        // sandbox.max_tokens when 0, never above it
+	TTL              string `json:"ttl"`                                                   // lifetime such as 2h, sandbox.default_ttl when empty
+}
+
+// QuotaPoolResponse quota pool response structure
+type QuotaPoolResponse struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Period       string    `json:"period"`
+	TokenLimit   int64     `json:"token_limit"`
+	RequestLimit int64     `json:"request_limit"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// QuotaPoolUsageResponse what a quota pool and each of its keys drew in the current period
+type QuotaPoolUsageResponse struct {
+	Pool         string                 `json:"pool"`
+	Period       string                 `json:"period"`
+	PeriodStart  time.Time              `json:"period_start"`
+	PeriodEnd    time.Time              `json:"period_end"`
+	TokenLimit   int64                  `json:"token_limit"`
+	RequestLimit int64                  `json:"request_limit"`
+	Used         quota.Usage            `json:"used"`
+	Members      []QuotaPoolMemberUsage `json:"members"`
+}
+
+// QuotaPoolMemberUsage what the connector key of an agent drew from its pool
+type QuotaPoolMemberUsage struct {
+	AgentID      string      `json:"agent_id"`
+	Name         string      `json:"name"`
+	TokenLimit   int64       `json:"token_limit"`   // sub-limit of the key, 0 leaves only the pool limit
+	RequestLimit int64       `json:"request_limit"` // sub-limit of the key, 0 leaves only the pool limit
+	Used         quota.Usage `json:"used"`
+}
+
+// UsageRecordResponse usage record response structure
+type UsageRecordResponse struct {
+	ID                uint                  `json:"id"`
+	AgentID           string                `json:"agent_id"`
+	PlaygroundTokenID *uint                 `json:"playground_token_id,omitempty"`
+	Path              string                `json:"path"`
+	Stream            bool                  `json:"stream"`
+	Success           bool                  `json:"success"`
+	Outcome           string                `json:"outcome"`
+	Error             string                `json:"error,omitempty"`
+	DurationMs        int64                 `json:"duration_ms"`
+	PromptTokens      int                   `json:"prompt_tokens"`
+	CompletionTokens  int                   `json:"completion_tokens"`
+	TotalTokens       int                   `json:"total_tokens"`
+	Cost              float64               `json:"cost"`
+	Metadata          map[string]string     `json:"metadata"`
+	Content           *UsageContentResponse `json:"content,omitempty"` // only on the record detail
+	Scores            []*UsageScoreResponse `json:"scores,omitempty"`  // only on the record detail
+	CreatedAt         time.Time             `json:"created_at"`
+}
+
+// UsageScoreResponse judge score of a usage record's response on one rubric
+type UsageScoreResponse struct {
+	Rubric       string    `json:"rubric"`
+	Score        float64   `json:"score"` // 1 (poor) to 5 (excellent)
+	Reason       string    `json:"reason"`
+	JudgeAgentID string    `json:"judge_agent_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UsageQualityResponse average judge scores per agent, day and rubric
+type UsageQualityResponse struct {
+	From   *time.Time                    `json:"from,omitempty"`
+	To     *time.Time                    `json:"to,omitempty"`
+	Points []*internal.UsageQualityPoint `json:"points"`
+}
+
+// UsageContentResponse stored prompt and response text of a usage record
+type UsageContentResponse struct {
+	Request    string `json:"request"`
+	Response   string `json:"response"`
+	Parameters string `json:"parameters,omitempty"` // request fields besides the prompt, as JSON
+	Truncated  bool   `json:"truncated"`
+}
+
+// GoldenPromptRequest golden prompt create/update request structure
+type GoldenPromptRequest struct {
+	AgentID       string  `json:"agent_id" binding:"required"`
+	Name          string  `json:"name" binding:"required,max=100"`
+	Prompt        string  `json:"prompt" binding:"required"`            // user message, Dify query or workflow inputs as a JSON object
+	Inputs        string  `json:"inputs"`                               // Dify chat inputs as a JSON object
+	Reference     string  `json:"reference" binding:"required"`         // approved reference answer
+	MinSimilarity float64 `json:"min_similarity" binding:"min=0,max=1"` // defaults to 0.8
+	Enabled       *bool   `json:"enabled"`                              // defaults to true
+}
+
+// GoldenPromptResponse golden prompt response structure
+type GoldenPromptResponse struct {
+	ID            uint      `json:"id"`
+	AgentID       string    `json:"agent_id"`
+	Name          string    `json:"name"`
+	Prompt        string    `json:"prompt"`
+	Inputs        string    `json:"inputs,omitempty"`
+	Reference     string    `json:"reference"`
+	MinSimilarity float64   `json:"min_similarity"`
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// GoldenRunRequest golden run start request structure
+type GoldenRunRequest struct {
+	AgentID string `json:"agent_id" binding:"required"`
+}
+
+// GoldenRunResponse golden run response structure, results only on a single run
+type GoldenRunResponse struct {
+	ID         uint                    `json:"id"`
+	AgentID    string                  `json:"agent_id"`
+	Trigger    string                  `json:"trigger"` // manual or agent_update
+	Status     string                  `json:"status"`  // running, passed, regressed or failed
+	Total      int                     `json:"total"`
+	Passed     int                     `json:"passed"`
+	Regressed  int                     `json:"regressed"`
+	Errored    int                     `json:"errored"`
+	StartedAt  time.Time               `json:"started_at"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	Results    []*GoldenResultResponse `json:"results,omitempty"`
+}
+
+// GoldenResultResponse answer to one golden prompt with its line diff against the reference
+type GoldenResultResponse struct {
+	PromptID      uint            `json:"prompt_id"`
+	PromptName    string          `json:"prompt_name"`
+	Passed        bool            `json:"passed"`
+	Similarity    float64         `json:"similarity"`
+	MinSimilarity float64         `json:"min_similarity"`
+	DurationMs    int64           `json:"duration_ms"`
+	Error         string          `json:"error,omitempty"`
+	Reference     string          `json:"reference"`
+	Response      string          `json:"response"`
+	Diff          []textdiff.Line `json:"diff"`
+}
+
+// UsageReplayRequest usage record replay request structure, the record's agent is
+// used when no agent is given
+type UsageReplayRequest struct {
+	AgentID string `json:"agent_id"`
+}
+
+// UsageReportResponse usage and cost aggregated by the requested dimensions
+type UsageReportResponse struct {
+	GroupBy  string                   `json:"group_by"`
+	From     *time.Time               `json:"from,omitempty"`
+	To       *time.Time               `json:"to,omitempty"`
+	Currency string                   `json:"currency"`
+	Groups   []*internal.UsageSummary `json:"groups"`
+	Total    internal.UsageSummary    `json:"total"`
+}
+
+// UsageForecastResponse projected usage of the agents for capacity and budget planning
+type UsageForecastResponse struct {
+	Currency  string                    `json:"currency"`
+	Forecasts []*internal.UsageForecast `json:"forecasts"`
 }
 
 // HealthCheckResponse health check response
@@ -117,15 +613,40 @@ type DatabaseHealthStatus struct {
 // ConvertFromInternalSystemConfig convert from internal model to response structure
 func ConvertFromInternalSystemConfig(config *internal.SystemConfig) *SystemConfigResponse {
 	return &SystemConfigResponse{
-		ID:        config.ID,
-		CreatedAt: config.CreatedAt,
-		UpdatedAt: config.UpdatedAt,
+		ID:                      config.ID,
+		RateLimitMode:           config.RateLimitMode,
+		ImpersonationTTLMinutes: config.ImpersonationTTLMinutes,
+		DefaultQPS:              config.DefaultQPS,
+		DefaultPriority:         config.DefaultPriority,
+		LoginAnomalySensitivity: config.LoginAnomalySensitivity,
+		Version:                 config.Version,
+		CreatedAt:               config.CreatedAt,
+		UpdatedAt:               config.UpdatedAt,
 	}
 }
 
 // ConvertToInternalSystemConfig convert from request structure to internal model
 func ConvertToInternalSystemConfig(req *SystemConfigRequest) *internal.SystemConfig {
-	return &internal.SystemConfig{}
+	return &internal.SystemConfig{
+		RateLimitMode:           req.RateLimitMode,
+		ImpersonationTTLMinutes: req.ImpersonationTTLMinutes,
+		DefaultQPS:              req.DefaultQPS,
+		DefaultPriority:         req.DefaultPriority,
+		LoginAnomalySensitivity: req.LoginAnomalySensitivity,
+		Version:                 req.Version,
+	}
+}
+
+// ConvertToSystemConfigRequest the current configuration as a request, for merge patches
+func ConvertToSystemConfigRequest(config *internal.SystemConfig) *SystemConfigRequest {
+	return &SystemConfigRequest{
+		RateLimitMode:           config.RateLimitMode,
+		ImpersonationTTLMinutes: config.ImpersonationTTLMinutes,
+		DefaultQPS:              config.DefaultQPS,
+		DefaultPriority:         config.DefaultPriority,
+		LoginAnomalySensitivity: config.LoginAnomalySensitivity,
+		Version:                 config.Version,
+	}
 }
 
 // ConvertFromInternalAgent convert from internal model to response structure
@@ -135,16 +656,53 @@ func ConvertFromInternalAgent(agent *internal.Agent, hideSecrets bool) *AgentRes
 		Name: agent.Name,
 		Type: string(agent.Type),
 
-		URL:              agent.URL,
-		ConnectorAPIKey:  agent.ConnectorAPIKey,
-		AgentID:          agent.AgentID,
-		QPS:              agent.QPS,
-		Enabled:          agent.Enabled,
-		Description:      agent.Description,
-		SupportStreaming: agent.SupportStreaming,
-		ResponseFormat:   agent.ResponseFormat,
-		CreatedAt:        agent.CreatedAt,
-		UpdatedAt:        agent.UpdatedAt,
+		URL:                 agent.URL,
+		ConnectorAPIKey:     agent.ConnectorAPIKey,
+		ConnectorKeyPrefix:  agent.ConnectorKeyPrefix,
+		AgentID:             agent.AgentID,
+		QPS:                 agent.QPS,
+		Enabled:             agent.Enabled,
+		Description:         agent.Description,
+		SupportStreaming:    agent.SupportStreaming,
+		ResponseFormat:      agent.ResponseFormat,
+		PromptPrice:         agent.PromptPrice,
+		CompletionPrice:     agent.CompletionPrice,
+		MonthlyBudget:       agent.MonthlyBudget,
+		HedgeAgentID:        agent.HedgeAgentID,
+		HedgeAfterMs:        agent.HedgeAfterMs,
+		ContinueOnInterrupt: agent.ContinueOnInterrupt,
+		ContextWindow:       agent.ContextWindow,
+		ContextOverflow:     agent.ContextOverflow,
+		PriorityOverride:    agent.PriorityOverride,
+		QPSSharing:          agent.QPSSharing,
+		UserQPS:             agent.UserQPS,
+		RecordMode:          agent.RecordMode,
+		PrivacyMode:         agent.PrivacyMode,
+		MaxTemperature:      agent.MaxTemperature,
+		MaxTokensCap:        agent.MaxTokensCap,
+		ForbiddenParameters: agent.ForbiddenParameters,
+		MaxMessages:         agent.MaxMessages,
+		MaxMessageBytes:     agent.MaxMessageBytes,
+		MaxInputs:           agent.MaxInputs,
+		GuardrailPolicy:     agent.GuardrailPolicy,
+		OutputFilter:        agent.OutputFilter,
+		BlockedWords:        agent.BlockedWords,
+		OutputFilterAction:  agent.OutputFilterAction,
+		RequireSignature:    agent.RequireSignature,
+		SigningSecretSet:    agent.SigningSecret != "",
+		StreamTokenRate:     agent.StreamTokenRate,
+		Passthrough:         agent.Passthrough,
+		Tier:                agent.Tier,
+		AccessSchedule:      agent.AccessSchedule,
+		AccessTimezone:      agent.AccessTimezone,
+		QuotaPool:           agent.QuotaPool,
+		PoolTokenLimit:      agent.PoolTokenLimit,
+		PoolRequestLimit:    agent.PoolRequestLimit,
+		Namespace:           agent.Namespace,
+		ExpiresAt:           agent.ExpiresAt,
+		Version:             agent.Version,
+		CreatedAt:           agent.CreatedAt,
+		UpdatedAt:           agent.UpdatedAt,
 	}
 
 	// decide whether to hide sensitive information based on the need
@@ -158,16 +716,121 @@ func ConvertFromInternalAgent(agent *internal.Agent, hideSecrets bool) *AgentRes
 // ConvertToInternalAgent convert from request structure to internal model
 func ConvertToInternalAgent(req *AgentRequest) *internal.Agent {
 	return &internal.Agent{
-		Name:             req.Name,
-		Type:             types.AgentType(req.Type),
-		URL:              req.URL,
-		SourceAPIKey:     req.SourceAPIKey,
-		QPS:              req.QPS,
-		Enabled:          req.Enabled,
-		Description:      req.Description,
-		SupportStreaming: req.SupportStreaming,
-		ResponseFormat:   req.ResponseFormat,
+		Name:                req.Name,
+		Type:                types.AgentType(req.Type),
+		URL:                 req.URL,
+		SourceAPIKey:        req.SourceAPIKey,
+		QPS:                 req.QPS,
+		Enabled:             req.Enabled,
+		Description:         req.Description,
+		SupportStreaming:    req.SupportStreaming,
+		ResponseFormat:      req.ResponseFormat,
+		PromptPrice:         req.PromptPrice,
+		CompletionPrice:     req.CompletionPrice,
+		MonthlyBudget:       req.MonthlyBudget,
+		HedgeAgentID:        req.HedgeAgentID,
+		HedgeAfterMs:        req.HedgeAfterMs,
+		ContinueOnInterrupt: req.ContinueOnInterrupt,
+		ContextWindow:       req.ContextWindow,
+		ContextOverflow:     req.ContextOverflow,
+		PriorityOverride:    req.PriorityOverride,
+		QPSSharing:          req.QPSSharing,
+		UserQPS:             req.UserQPS,
+		RecordMode:          req.RecordMode,
+		PrivacyMode:         req.PrivacyMode,
+		MaxTemperature:      req.MaxTemperature,
+		MaxTokensCap:        req.MaxTokensCap,
+		ForbiddenParameters: req.ForbiddenParameters,
+		MaxMessages:         req.MaxMessages,
+		MaxMessageBytes:     req.MaxMessageBytes,
+		MaxInputs:           req.MaxInputs,
+		GuardrailPolicy:     req.GuardrailPolicy,
+		OutputFilter:        req.OutputFilter,
+		BlockedWords:        req.BlockedWords,
+		OutputFilterAction:  req.OutputFilterAction,
+		RequireSignature:    req.RequireSignature,
+		StreamTokenRate:     req.StreamTokenRate,
+		Passthrough:         req.Passthrough,
+		Tier:                req.Tier,
+		AccessSchedule:      req.AccessSchedule,
+		AccessTimezone:      req.AccessTimezone,
+		QuotaPool:           req.QuotaPool,
+		PoolTokenLimit:      req.PoolTokenLimit,
+		PoolRequestLimit:    req.PoolRequestLimit,
+	}
+}
+
+// ConvertToAgentPatchDocument the current agent configuration, for merge patches
+func ConvertToAgentPatchDocument(agent *internal.Agent) *AgentPatchDocument {
+	return &AgentPatchDocument{
+		AgentRequest: AgentRequest{
+			Name:                agent.Name,
+			Type:                string(agent.Type),
+			URL:                 agent.URL,
+			SourceAPIKey:        agent.SourceAPIKey,
+			QPS:                 agent.QPS,
+			Enabled:             agent.Enabled,
+			Description:         agent.Description,
+			SupportStreaming:    agent.SupportStreaming,
+			ResponseFormat:      agent.ResponseFormat,
+			PromptPrice:         agent.PromptPrice,
+			CompletionPrice:     agent.CompletionPrice,
+			MonthlyBudget:       agent.MonthlyBudget,
+			HedgeAgentID:        agent.HedgeAgentID,
+			HedgeAfterMs:        agent.HedgeAfterMs,
+			ContinueOnInterrupt: agent.ContinueOnInterrupt,
+			ContextWindow:       agent.ContextWindow,
+			ContextOverflow:     agent.ContextOverflow,
+			PriorityOverride:    agent.PriorityOverride,
+			QPSSharing:          agent.QPSSharing,
+			UserQPS:             agent.UserQPS,
+			RecordMode:          agent.RecordMode,
+			PrivacyMode:         agent.PrivacyMode,
+			MaxTemperature:      agent.MaxTemperature,
+			MaxTokensCap:        agent.MaxTokensCap,
+			ForbiddenParameters: agent.ForbiddenParameters,
+			MaxMessages:         agent.MaxMessages,
+			MaxMessageBytes:     agent.MaxMessageBytes,
+			MaxInputs:           agent.MaxInputs,
+			GuardrailPolicy:     agent.GuardrailPolicy,
+			OutputFilter:        agent.OutputFilter,
+			BlockedWords:        agent.BlockedWords,
+			OutputFilterAction:  agent.OutputFilterAction,
+			RequireSignature:    agent.RequireSignature,
+			StreamTokenRate:     agent.StreamTokenRate,
+			Passthrough:         agent.Passthrough,
+			Tier:                agent.Tier,
+			AccessSchedule:      agent.AccessSchedule,
+			AccessTimezone:      agent.AccessTimezone,
+			QuotaPool:           agent.QuotaPool,
+			PoolTokenLimit:      agent.PoolTokenLimit,
+			PoolRequestLimit:    agent.PoolRequestLimit,
+		},
+		Version: agent.Version,
+	}
+}
+
+// UpdateInternalAgentFromPatchDocument update internal model with every field of a patched document
+func UpdateInternalAgentFromPatchDocument(agent *internal.Agent, doc *AgentPatchDocument) {
+	patched := ConvertToInternalAgent(&doc.AgentRequest)
+	patched.ID = agent.ID
+	patched.AgentID = agent.AgentID
+	patched.ConnectorKeyPrefix = agent.ConnectorKeyPrefix
+	patched.ConnectorKeyHash = agent.ConnectorKeyHash
+	patched.LegacyConnectorAPIKey = agent.LegacyConnectorAPIKey
+	patched.SigningSecret = agent.SigningSecret
+	patched.AllowedUsers = agent.AllowedUsers
+	patched.AllowedRoles = agent.AllowedRoles
+	patched.AllowedKeys = agent.AllowedKeys
+	patched.Namespace = agent.Namespace
+	patched.ExpiresAt = agent.ExpiresAt
+	patched.Version = agent.Version
+	if doc.Version != 0 {
+		patched.Version = doc.Version
 	}
+	patched.CreatedAt = agent.CreatedAt
+	patched.UpdatedAt = agent.UpdatedAt
+	*agent = *patched
 }
 
 // UpdateInternalAgentFromRequest update internal model with request data
@@ -199,6 +862,109 @@ func UpdateInternalAgentFromRequest(agent *internal.Agent, req *AgentUpdateReque
 	if req.ResponseFormat != nil {
 		agent.ResponseFormat = *req.ResponseFormat
 	}
+	if req.PromptPrice != nil {
+		agent.PromptPrice = *req.PromptPrice
+	}
+	if req.CompletionPrice != nil {
+		agent.CompletionPrice = *req.CompletionPrice
+	}
+	if req.MonthlyBudget != nil {
+		agent.MonthlyBudget = *req.MonthlyBudget
+	}
+	if req.HedgeAgentID != nil {
+		agent.HedgeAgentID = *req.HedgeAgentID
+	}
+	if req.HedgeAfterMs != nil {
+		agent.HedgeAfterMs = *req.HedgeAfterMs
+	}
+	if req.ContinueOnInterrupt != nil {
+		agent.ContinueOnInterrupt = *req.ContinueOnInterrupt
+	}
+	if req.ContextWindow != nil {
+		agent.ContextWindow = *req.ContextWindow
+	}
+	if req.ContextOverflow != nil {
+		agent.ContextOverflow = *req.ContextOverflow
+	}
+	if req.PriorityOverride != nil {
+		agent.PriorityOverride = *req.PriorityOverride
+	}
+	if req.QPSSharing != nil {
+		agent.QPSSharing = *req.QPSSharing
+	}
+	if req.UserQPS != nil {
+		agent.UserQPS = *req.UserQPS
+	}
+	if req.RecordMode != nil {
+		// "off" clears the mode
+		agent.RecordMode = *req.RecordMode
+		if agent.RecordMode == "off" {
+			agent.RecordMode = ""
+		}
+	}
+	if req.PrivacyMode != nil {
+		agent.PrivacyMode = *req.PrivacyMode
+	}
+	if req.MaxTemperature != nil {
+		agent.MaxTemperature = *req.MaxTemperature
+	}
+	if req.MaxTokensCap != nil {
+		agent.MaxTokensCap = *req.MaxTokensCap
+	}
+	if req.ForbiddenParameters != nil {
+		agent.ForbiddenParameters = *req.ForbiddenParameters
+	}
+	if req.MaxMessages != nil {
+		agent.MaxMessages = *req.MaxMessages
+	}
+	if req.MaxMessageBytes != nil {
+		agent.MaxMessageBytes = *req.MaxMessageBytes
+	}
+	if req.MaxInputs != nil {
+		agent.MaxInputs = *req.MaxInputs
+	}
+	if req.GuardrailPolicy != nil {
+		agent.GuardrailPolicy = *req.GuardrailPolicy
+	}
+	if req.OutputFilter != nil {
+		agent.OutputFilter = *req.OutputFilter
+	}
+	if req.BlockedWords != nil {
+		agent.BlockedWords = *req.BlockedWords
+	}
+	if req.OutputFilterAction != nil {
+		agent.OutputFilterAction = *req.OutputFilterAction
+	}
+	if req.RequireSignature != nil {
+		agent.RequireSignature = *req.RequireSignature
+	}
+	if req.StreamTokenRate != nil {
+		agent.StreamTokenRate = *req.StreamTokenRate
+	}
+	if req.Passthrough != nil {
+		agent.Passthrough = *req.Passthrough
+	}
+	if req.Tier != nil {
+		agent.Tier = *req.Tier
+	}
+	if req.AccessSchedule != nil {
+		agent.AccessSchedule = *req.AccessSchedule
+	}
+	if req.AccessTimezone != nil {
+		agent.AccessTimezone = *req.AccessTimezone
+	}
+	if req.QuotaPool != nil {
+		agent.QuotaPool = *req.QuotaPool
+	}
+	if req.PoolTokenLimit != nil {
+		agent.PoolTokenLimit = *req.PoolTokenLimit
+	}
+	if req.PoolRequestLimit != nil {
+		agent.PoolRequestLimit = *req.PoolRequestLimit
+	}
+	if req.Version != nil {
+		agent.Version = *req.Version
+	}
 }
 
 // ConvertFromInternalAgentList convert from internal model list to response list
@@ -209,3 +975,431 @@ func ConvertFromInternalAgentList(agents []*internal.Agent, hideSecrets bool) []
 	}
 	return result
 }
+
+// ConvertFromInternalAgentACL convert the access list of an agent to response structure
+func ConvertFromInternalAgentACL(agent *internal.Agent) *AgentACLResponse {
+	list := agent.ACL()
+	return &AgentACLResponse{
+		AgentID:    agent.AgentID,
+		Users:      append([]string{}, list.Users...),
+		Roles:      append([]string{}, list.Roles...),
+		Keys:       append([]string{}, list.Keys...),
+		Restricted: !list.Empty(),
+	}
+}
+
+// ConvertToInternalPlaygroundToken convert from request structure to internal model
+func ConvertToInternalPlaygroundToken(req *PlaygroundTokenRequest) *internal.PlaygroundToken {
+	return &internal.PlaygroundToken{
+		Name:      req.Name,
+		AgentID:   req.AgentID,
+		QPS:       req.QPS,
+		MaxTokens: req.MaxTokens,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresIn) * time.Second),
+	}
+}
+
+// ConvertFromInternalPlaygroundToken convert from internal model to response structure
+func ConvertFromInternalPlaygroundToken(token *internal.PlaygroundToken) *PlaygroundTokenResponse {
+	return &PlaygroundTokenResponse{
+		ID:          token.ID,
+		Name:        token.Name,
+		Token:       token.Token,
+		TokenPrefix: token.TokenPrefix,
+		AgentID:     token.AgentID,
+		QPS:         token.QPS,
+		MaxTokens:   token.MaxTokens,
+		ExpiresAt:   token.ExpiresAt,
+		Revoked:     token.Revoked,
+		Active:      token.IsActive(),
+		LastUsedAt:  token.LastUsedAt,
+		CreatedAt:   token.CreatedAt,
+	}
+}
+
+// ConvertFromInternalPlaygroundTokenList convert from internal model list to response list
+func ConvertFromInternalPlaygroundTokenList(tokens []*internal.PlaygroundToken) []*PlaygroundTokenResponse {
+	result := make([]*PlaygroundTokenResponse, len(tokens))
+	for i, token := range tokens {
+		result[i] = ConvertFromInternalPlaygroundToken(token)
+	}
+	return result
+}
+
+// ConvertToInternalNotificationChannel convert from request structure to internal model
+func ConvertToInternalNotificationChannel(req *NotificationChannelRequest) *internal.NotificationChannel {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	var recipients []internal.NotificationRecipient
+	for _, recipient := range req.Recipients {
+		recipients = append(recipients, internal.NotificationRecipient{
+			Email:      recipient.Email,
+			EventTypes: strings.Join(recipient.EventTypes, ","),
+			Digest:     recipient.Digest,
+		})
+	}
+
+	return &internal.NotificationChannel{
+		Name:       req.Name,
+		Type:       req.Type,
+		WebhookURL: req.WebhookURL,
+		EventTypes: strings.Join(req.EventTypes, ","),
+		AgentIDs:   strings.Join(req.AgentIDs, ","),
+		Enabled:    enabled,
+
+		Recipients:     recipients,
+		DigestInterval: req.DigestInterval,
+	}
+}
+
+// ConvertFromInternalNotificationChannel convert from internal model to response structure
+func ConvertFromInternalNotificationChannel(channel *internal.NotificationChannel) *NotificationChannelResponse {
+	agentIDs := channel.AgentIDList()
+	if agentIDs == nil {
+		agentIDs = []string{}
+	}
+
+	response := &NotificationChannelResponse{
+		ID:         channel.ID,
+		Name:       channel.Name,
+		Type:       channel.Type,
+		WebhookURL: channel.MaskedWebhookURL(),
+		EventTypes: channel.EventTypeList(),
+		AgentIDs:   agentIDs,
+		Enabled:    channel.Enabled,
+		LastSentAt: channel.LastSentAt,
+		LastError:  channel.LastError,
+		CreatedAt:  channel.CreatedAt,
+		UpdatedAt:  channel.UpdatedAt,
+	}
+
+	if channel.IsEmail() {
+		response.DigestInterval = channel.DigestInterval
+		for i := range channel.Recipients {
+			recipient := &channel.Recipients[i]
+			eventTypes := recipient.EventTypeList()
+			if eventTypes == nil {
+				eventTypes = []string{}
+			}
+			response.Recipients = append(response.Recipients, &NotificationRecipientResponse{
+				Email:      recipient.Email,
+				EventTypes: eventTypes,
+				Digest:     recipient.Digest,
+			})
+		}
+	}
+	return response
+}
+
+// ConvertFromInternalNotificationChannelList convert from internal model list to response list
+func ConvertFromInternalNotificationChannelList(channels []*internal.NotificationChannel) []*NotificationChannelResponse {
+	result := make([]*NotificationChannelResponse, len(channels))
+	for i, channel := range channels {
+		result[i] = ConvertFromInternalNotificationChannel(channel)
+	}
+	return result
+}
+
+// ConvertToInternalMaintenanceWindow convert from request structure to internal model
+func ConvertToInternalMaintenanceWindow(req *MaintenanceWindowRequest) *internal.MaintenanceWindow {
+	return &internal.MaintenanceWindow{
+		Name:     req.Name,
+		AgentID:  req.AgentID,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Message:  req.Message,
+	}
+}
+
+// ConvertFromInternalMaintenanceWindow convert from internal model to response structure
+func ConvertFromInternalMaintenanceWindow(window *internal.MaintenanceWindow) *MaintenanceWindowResponse {
+	return &MaintenanceWindowResponse{
+		ID:        window.ID,
+		Name:      window.Name,
+		AgentID:   window.AgentID,
+		Global:    window.IsGlobal(),
+		StartsAt:  window.StartsAt,
+		EndsAt:    window.EndsAt,
+		Message:   window.Message,
+		Status:    window.Status(time.Now()),
+		CreatedAt: window.CreatedAt,
+		UpdatedAt: window.UpdatedAt,
+	}
+}
+
+// ConvertFromInternalMaintenanceWindowList convert from internal model list to response list
+func ConvertFromInternalMaintenanceWindowList(windows []*internal.MaintenanceWindow) []*MaintenanceWindowResponse {
+	result := make([]*MaintenanceWindowResponse, len(windows))
+	for i, window := range windows {
+		result[i] = ConvertFromInternalMaintenanceWindow(window)
+	}
+	return result
+}
+
+// ConvertToInternalGoldenPrompt convert from request structure to internal model
+func ConvertToInternalGoldenPrompt(req *GoldenPromptRequest) *internal.GoldenPrompt {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &internal.GoldenPrompt{
+		AgentID:       req.AgentID,
+		Name:          req.Name,
+		Prompt:        req.Prompt,
+		Inputs:        req.Inputs,
+		Reference:     req.Reference,
+		MinSimilarity: req.MinSimilarity,
+		Enabled:       enabled,
+	}
+}
+
+// ConvertFromInternalGoldenPrompt convert from internal model to response structure
+func ConvertFromInternalGoldenPrompt(prompt *internal.GoldenPrompt) *GoldenPromptResponse {
+	return &GoldenPromptResponse{
+		ID:            prompt.ID,
+		AgentID:       prompt.AgentID,
+		Name:          prompt.Name,
+		Prompt:        prompt.Prompt,
+		Inputs:        prompt.Inputs,
+		Reference:     prompt.Reference,
+		MinSimilarity: prompt.MinSimilarity,
+		Enabled:       prompt.Enabled,
+		CreatedAt:     prompt.CreatedAt,
+		UpdatedAt:     prompt.UpdatedAt,
+	}
+}
+
+// ConvertFromInternalGoldenPromptList convert from internal model list to response list
+func ConvertFromInternalGoldenPromptList(prompts []*internal.GoldenPrompt) []*GoldenPromptResponse {
+	result := make([]*GoldenPromptResponse, len(prompts))
+	for i, prompt := range prompts {
+		result[i] = ConvertFromInternalGoldenPrompt(prompt)
+	}
+	return result
+}
+
+// ConvertFromInternalGoldenRun convert from internal model to response structure,
+// diffing every answer against its reference
+func ConvertFromInternalGoldenRun(run *internal.GoldenRun) *GoldenRunResponse {
+	response := &GoldenRunResponse{
+		ID:         run.ID,
+		AgentID:    run.AgentID,
+		Trigger:    run.Trigger,
+		Status:     run.Status,
+		Total:      run.Total,
+		Passed:     run.Passed,
+		Regressed:  run.Regressed,
+		Errored:    run.Errored,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+	}
+	for _, result := range run.Results {
+		diff := []textdiff.Line{}
+		if result.Error == "" {
+			diff = textdiff.Lines(result.Reference, result.Response)
+		}
+		response.Results = append(response.Results, &GoldenResultResponse{
+			PromptID:      result.PromptID,
+			PromptName:    result.PromptName,
+			Passed:        result.Passed,
+			Similarity:    result.Similarity,
+			MinSimilarity: result.MinSimilarity,
+			DurationMs:    result.DurationMs,
+			Error:         result.Error,
+			Reference:     result.Reference,
+			Response:      result.Response,
+			Diff:          diff,
+		})
+	}
+	return response
+}
+
+// ConvertFromInternalGoldenRunList convert from internal model list to response list
+func ConvertFromInternalGoldenRunList(runs []*internal.GoldenRun) []*GoldenRunResponse {
+	result := make([]*GoldenRunResponse, len(runs))
+	for i, run := range runs {
+		result[i] = ConvertFromInternalGoldenRun(run)
+	}
+	return result
+}
+
+// ConvertToInternalKeyTier convert from request structure to internal model
+func ConvertToInternalKeyTier(req *KeyTierRequest) *internal.KeyTier {
+	return &internal.KeyTier{
+		Name:        req.Name,
+		Description: req.Description,
+		Streaming:   req.Streaming,
+		Tools:       req.Tools,
+		Vision:      req.Vision,
+	}
+}
+
+// ConvertFromInternalKeyTier convert from internal model to response structure
+func ConvertFromInternalKeyTier(tier *internal.KeyTier) *KeyTierResponse {
+	return &KeyTierResponse{
+		ID:          tier.ID,
+		Name:        tier.Name,
+		Description: tier.Description,
+		Streaming:   tier.Streaming,
+		Tools:       tier.Tools,
+		Vision:      tier.Vision,
+		CreatedAt:   tier.CreatedAt,
+		UpdatedAt:   tier.UpdatedAt,
+	}
+}
+
+// ConvertFromInternalKeyTierList convert from internal model list to response list
+func ConvertFromInternalKeyTierList(tiers []*internal.KeyTier) []*KeyTierResponse {
+	result := make([]*KeyTierResponse, len(tiers))
+	for i, tier := range tiers {
+		result[i] = ConvertFromInternalKeyTier(tier)
+	}
+	return result
+}
+
+// ConvertToInternalQuotaPool convert from request structure to internal model
+func ConvertToInternalQuotaPool(req *QuotaPoolRequest) *internal.QuotaPool {
+	return &internal.QuotaPool{
+		Name:         req.Name,
+		Description:  req.Description,
+		Period:       req.Period,
+		TokenLimit:   req.TokenLimit,
+		RequestLimit: req.RequestLimit,
+	}
+}
+
+// ConvertFromInternalQuotaPool convert from internal model to response structure
+func ConvertFromInternalQuotaPool(pool *internal.QuotaPool) *QuotaPoolResponse {
+	return &QuotaPoolResponse{
+		ID:           pool.ID,
+		Name:         pool.Name,
+		Description:  pool.Description,
+		Period:       pool.Period,
+		TokenLimit:   pool.TokenLimit,
+		RequestLimit: pool.RequestLimit,
+		CreatedAt:    pool.CreatedAt,
+		UpdatedAt:    pool.UpdatedAt,
+	}
+}
+
+// ConvertFromInternalQuotaPoolList convert from internal model list to response list
+func ConvertFromInternalQuotaPoolList(pools []*internal.QuotaPool) []*QuotaPoolResponse {
+	result := make([]*QuotaPoolResponse, len(pools))
+	for i, pool := range pools {
+		result[i] = ConvertFromInternalQuotaPool(pool)
+	}
+	return result
+}
+
+// ConvertToInternalSandboxAgent convert sandbox agent request to internal model
+func ConvertToInternalSandboxAgent(req *SandboxAgentRequest) *internal.Agent {
+	responseFormat := req.ResponseFormat
+	if responseFormat == "" {
+		responseFormat = types.ResponseFormatOpenAI
+	}
+	return &internal.Agent{
+		Name:             req.Name,
+		Type:             types.AgentType(req.Type),
+		URL:              req.URL,
+		SourceAPIKey:     req.SourceAPIKey,
+		QPS:              req.QPS,
+		Enabled:          true,
+		Description:      req.Description,
+		SupportStreaming: req.SupportStreaming,
+		ResponseFormat:   responseFormat,
+		MaxTokensCap:     req.MaxTokensCap,
+	}
+}
+
+// ConvertFromInternalUsageRecord convert from internal model to response structure
+func ConvertFromInternalUsageRecord(record *internal.UsageRecord) *UsageRecordResponse {
+	response := &UsageRecordResponse{
+		ID:                record.ID,
+		AgentID:           record.AgentID,
+		PlaygroundTokenID: record.PlaygroundTokenID,
+		Path:              record.Path,
+		Stream:            record.Stream,
+		Success:           record.Success,
+		Outcome:           record.Outcome,
+		Error:             record.Error,
+		DurationMs:        record.DurationMs,
+		PromptTokens:      record.PromptTokens,
+		CompletionTokens:  record.CompletionTokens,
+		TotalTokens:       record.TotalTokens,
+		Cost:              record.Cost,
+		Metadata:          record.MetadataMap(),
+		CreatedAt:         record.CreatedAt,
+	}
+	if record.Content != nil {
+		response.Content = &UsageContentResponse{
+			Request:    record.Content.Request,
+			Response:   record.Content.Response,
+			Parameters: record.Content.Parameters,
+			Truncated:  record.Content.Truncated,
+		}
+	}
+	for _, score := range record.Scores {
+		response.Scores = append(response.Scores, &UsageScoreResponse{
+			Rubric:       score.Rubric,
+			Score:        score.Score,
+			Reason:       score.Reason,
+			JudgeAgentID: score.JudgeAgentID,
+			CreatedAt:    score.CreatedAt,
+		})
+	}
+	return response
+}
+
+// ConvertFromInternalUsageRecordList convert from internal model list to response list
+func ConvertFromInternalUsageRecordList(records []*internal.UsageRecord) []*UsageRecordResponse {
+	result := make([]*UsageRecordResponse, len(records))
+	for i, record := range records {
+		result[i] = ConvertFromInternalUsageRecord(record)
+	}
+	return result
+}
+
+// NewUsageForecastResponse wrap the forecasts with the report currency
+func NewUsageForecastResponse(currency string, forecasts []*internal.UsageForecast) *UsageForecastResponse {
+	if forecasts == nil {
+		forecasts = []*internal.UsageForecast{}
+	}
+	return &UsageForecastResponse{
+		Currency:  currency,
+		Forecasts: forecasts,
+	}
+}
+
+// NewUsageReportResponse build the report with the totals over all groups
+func NewUsageReportResponse(groupBy string, filter *internal.UsageFilter, currency string, summaries []*internal.UsageSummary) *UsageReportResponse {
+	report := &UsageReportResponse{
+		GroupBy:  groupBy,
+		From:     filter.From,
+		To:       filter.To,
+		Currency: currency,
+		Groups:   summaries,
+	}
+	if report.Groups == nil {
+		report.Groups = []*internal.UsageSummary{}
+	}
+
+	var totalDuration float64
+	for _, summary := range summaries {
+		report.Total.Requests += summary.Requests
+		report.Total.Failed += summary.Failed
+		report.Total.ClientCancelled += summary.ClientCancelled
+		report.Total.PromptTokens += summary.PromptTokens
+		report.Total.CompletionTokens += summary.CompletionTokens
+		report.Total.TotalTokens += summary.TotalTokens
+		report.Total.Cost += summary.Cost
+		totalDuration += summary.AvgDurationMs * float64(summary.Requests)
+	}
+	report.Total.Group = "total"
+	if report.Total.Requests > 0 {
+		report.Total.AvgDurationMs = totalDuration / float64(report.Total.Requests)
+	}
+	return report
+}
@@ -0,0 +1,134 @@
+package dataflow
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/pkg/accesswindow"
+	"agent-connector/pkg/events"
+)
+
+// offHoursReportInterval how often off-hours attempts of an agent are published as an
+// event; every attempt is logged, the event carries the attempts since the last one
+const offHoursReportInterval = 10 * time.Minute
+
+// offHoursReport attempts of an agent not yet published
+type offHoursReport struct {
+	reportedAt time.Time
+	attempts   int
+}
+
+// offHoursReports attempts outside the access windows, by agent
+var offHoursReports = struct {
+	sync.Mutex
+	agents map[string]*offHoursReport
+}{agents: make(map[string]*offHoursReport)}
+
+// AccessWindowMiddleware rejects requests with a connector key outside the access windows
+// of its agent. Playground tokens carry their own expiry and are not restricted.
+func (m *DataFlowMiddleware) AccessWindowMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authInfo, err := GetAuthInfoFromContext(c)
+		if err != nil {
+			m.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			c.Abort()
+			return
+		}
+		if authInfo.Playground != nil || authInfo.Agent == nil || authInfo.Agent.AccessSchedule == "" {
+			c.Next()
+			return
+		}
+
+		schedule, err := accesswindow.Parse(authInfo.Agent.AccessSchedule, authInfo.Agent.AccessTimezone)
+		if err != nil {
+			// The schedule was valid when it was saved, e.g. the time zone database changed;
+			// refuse rather than let the key through at any time
+			log.Printf("Invalid access schedule of agent %s: %v", authInfo.AgentID, err)
+			m.respondWithError(c, http.StatusForbidden, "outside_access_window", "The access schedule of this API key cannot be evaluated, contact the administrator")
+			c.Abort()
+			return
+		}
+
+		now := time.Now()
+		if schedule.Allows(now) {
+			c.Next()
+			return
+		}
+
+		nextAllowed := schedule.NextAllowed(now)
+		reportOffHoursAttempt(authInfo.AgentID, schedule, c, now)
+		m.respondWithOutsideAccessWindow(c, schedule, now, nextAllowed)
+		c.Abort()
+	}
+}
+
+// respondWithOutsideAccessWindow return 403 with the schedule and when the key can be used again
+func (m *DataFlowMiddleware) respondWithOutsideAccessWindow(c *gin.Context, schedule *accesswindow.Schedule, now, nextAllowed time.Time) {
+	timezone := schedule.Location().String()
+	message := fmt.Sprintf("This API key can only be used %s (%s)", schedule, timezone)
+	details := gin.H{
+		"schedule":   schedule.String(),
+		"timezone":   timezone,
+		"local_time": now.In(schedule.Location()).Format(time.RFC3339),
+	}
+	if !nextAllowed.IsZero() {
+		retryAfter := max(int(math.Ceil(nextAllowed.Sub(now).Seconds())), 1)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		message += fmt.Sprintf(", it can be used again at %s", nextAllowed.Format(time.RFC3339))
+		details["next_allowed_at"] = nextAllowed.Format(time.RFC3339)
+		details["retry_after_seconds"] = retryAfter
+	}
+
+	response := DataFlowResponse{
+		Code:    http.StatusForbidden,
+		Message: "Outside access window",
+		Error: &APIError{
+			Type:    "outside_access_window",
+			Code:    "403",
+			Message: message,
+			Details: details,
+		},
+	}
+	c.JSON(http.StatusForbidden, response)
+}
+
+// reportOffHoursAttempt log an attempt outside the access windows and publish a
+// key.off_hours_attempt event, at most once per offHoursReportInterval and agent
+func reportOffHoursAttempt(agentID string, schedule *accesswindow.Schedule, c *gin.Context, now time.Time) {
+	log.Printf("Access window: rejected request of agent %s from %s to %s %s outside %q (%s)",
+		agentID, c.ClientIP(), c.Request.Method, c.Request.URL.Path, schedule, schedule.Location())
+
+	offHoursReports.Lock()
+	report, ok := offHoursReports.agents[agentID]
+	if !ok {
+		report = &offHoursReport{}
+		offHoursReports.agents[agentID] = report
+	}
+	report.attempts++
+	if ok && now.Sub(report.reportedAt) < offHoursReportInterval {
+		offHoursReports.Unlock()
+		return
+	}
+	attempts := report.attempts
+	report.attempts = 0
+	report.reportedAt = now
+	offHoursReports.Unlock()
+
+	events.Emit(events.TypeKeyOffHoursAttempt, agentID, map[string]interface{}{
+		"agent_id":   agentID,
+		"schedule":   schedule.String(),
+		"timezone":   schedule.Location().String(),
+		"local_time": now.In(schedule.Location()).Format(time.RFC3339),
+		"client_ip":  c.ClientIP(),
+		"method":     c.Request.Method,
+		"path":       c.Request.URL.Path,
+		"attempts":   attempts,
+	})
+}
@@ -0,0 +1,33 @@
+package dataflow
+
+import (
+	"log"
+
+	"agent-connector/internal"
+	"agent-connector/pkg/acl"
+)
+
+// callerAllowed whether the access list of the agent lets the request through: the
+// platform user authenticated with X-User-Token, that user's role, or the prefix of
+// the connector key or playground token. The body's user field matches nothing.
+func callerAllowed(authInfo *AuthInfo) bool {
+	list := authInfo.Agent.ACL
+	if list.Empty() {
+		return true
+	}
+
+	caller := acl.Caller{KeyPrefix: internal.ConnectorKeyPrefix(authInfo.APIKey)}
+	if authInfo.Playground != nil {
+		caller.KeyPrefix = authInfo.Playground.TokenPrefix
+	}
+	if authInfo.Playground == nil {
+		caller.User = authInfo.User
+		caller.Role = authInfo.UserRole
+	}
+	if list.Allows(caller) {
+		return true
+	}
+
+	log.Printf("Access list of agent %s denied user %q with key %s", authInfo.AgentID, caller.User, caller.KeyPrefix)
+	return false
+}
@@ -0,0 +1,238 @@
+package dataflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/providerstatus"
+	"agent-connector/pkg/recorder"
+	"agent-connector/pkg/types"
+)
+
+// managedAgents installed by InitAgentManager, nil when the agent manager is disabled
+var managedAgents *ManagedAgents
+
+// ManagedAgents keeps a pkg/agent manager in step with the stored agents. Requests are
+// still forwarded by the backends, the manager health checks the upstreams, learns
+// from every forwarded call and tells which agents are down.
+type ManagedAgents struct {
+	manager  *agent.DefaultAgentManager
+	interval time.Duration
+
+	// fingerprints upstream settings of the registered agents, by agent ID
+	mu           sync.Mutex
+	fingerprints map[string]string
+
+	// providers the polled provider of each registered agent, by agent ID, and the
+	// provider statuses as of the last sync; requests read them while a sync may be
+	// waiting for replaced agents to drain, so they have a lock of their own
+	providerMu sync.RWMutex
+	providers  map[string]string
+	statuses   []internal.ProviderStatus
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// InitAgentManager load the enabled agents into an agent manager and keep reloading
+// them at the configured interval, nil when the interval is 0
+func InitAgentManager() (*ManagedAgents, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.API.AgentSyncInterval <= 0 {
+		return nil, nil
+	}
+
+	manager, err := agent.NewAgentManager(agent.DefaultAgentManagerConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent manager: %w", err)
+	}
+	m := &ManagedAgents{
+		manager:      manager,
+		interval:     cfg.API.AgentSyncInterval,
+		fingerprints: make(map[string]string),
+		providers:    make(map[string]string),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if err := m.sync(); err != nil {
+		manager.Close()
+		return nil, err
+	}
+
+	managedAgents = m
+	go m.run()
+	return m, nil
+}
+
+// Close stop reloading and close the managed agents
+func (m *ManagedAgents) Close() error {
+	close(m.stop)
+	<-m.done
+	managedAgents = nil
+	return m.manager.Close()
+}
+
+// run reload the agents until Close is called
+func (m *ManagedAgents) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.sync(); err != nil {
+				log.Printf("Agent manager sync failed: %v", err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// sync register new and changed agents and drop disabled and deleted ones; mock agents
+// and agents replaying fixtures have no upstream and are left out
+func (m *ManagedAgents) sync() error {
+	stored, err := (&internal.AgentService{}).ListEnabledAgents()
+	if err != nil {
+		return fmt.Errorf("failed to load agents: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loadProviderStatuses()
+
+	wanted := make(map[string]bool, len(stored))
+	for _, storedAgent := range stored {
+		if storedAgent.Type == types.AgentTypeMock || storedAgent.RecordMode == string(recorder.ModeReplay) {
+			continue
+		}
+		wanted[storedAgent.AgentID] = true
+
+		provider := providerstatus.ProviderOfURL(storedAgent.URL)
+		m.setProvider(storedAgent.AgentID, provider)
+		lowered := m.lowersPriority(provider)
+
+		fingerprint := fmt.Sprintf("%s|%s|%s|%s|%t", storedAgent.Type, storedAgent.Name, storedAgent.URL, storedAgent.SourceAPIKey, lowered)
+		if m.fingerprints[storedAgent.AgentID] == fingerprint {
+			continue
+		}
+		managed, err := newManagedAgent(storedAgent, lowered)
+		if err != nil {
+			log.Printf("Agent %s is not managed: %v", storedAgent.AgentID, err)
+			continue
+		}
+		if _, registered := m.fingerprints[storedAgent.AgentID]; registered {
+			// swapped in place, the old client finishes its health check before it is closed
+			err = m.manager.UpdateAgent(managed)
+		} else {
+			err = m.manager.RegisterAgent(managed)
+		}
+		if err != nil {
+			// registered again from scratch at the next sync
+			m.manager.UnregisterAgent(storedAgent.AgentID)
+			delete(m.fingerprints, storedAgent.AgentID)
+			log.Printf("Agent %s is not managed: %v", storedAgent.AgentID, err)
+			continue
+		}
+		m.fingerprints[storedAgent.AgentID] = fingerprint
+	}
+
+	for agentID := range m.fingerprints {
+		if !wanted[agentID] {
+			m.manager.UnregisterAgent(agentID)
+			delete(m.fingerprints, agentID)
+		}
+	}
+	m.dropProviders(wanted)
+	return nil
+}
+
+// Priorities of the managed agents, agents of a provider reporting an incident are
+// lowered when provider_status.lower_priority is set
+const (
+	managedAgentPriority         = 50
+	managedAgentIncidentPriority = 10
+)
+
+// newManagedAgent the pkg/agent client of a stored agent, lowered when its provider
+// reports an incident
+func newManagedAgent(stored *internal.Agent, lowered bool) (agent.Agent, error) {
+	base := agent.AgentConfig{
+		ID:       stored.AgentID,
+		Name:     stored.Name,
+		Enabled:  true,
+		Priority: managedAgentPriority,
+	}
+	if lowered {
+		base.Priority = managedAgentIncidentPriority
+	}
+	switch stored.Type {
+	case types.AgentTypeOpenAI:
+		base.Type = agent.AgentTypeOpenAI
+		return agent.NewOpenAIAgent(&agent.OpenAIConfig{
+			AgentConfig: base,
+			BaseURL:     stored.URL,
+			APIKey:      stored.SourceAPIKey,
+		})
+	case types.AgentTypeDifyChat, types.AgentTypeDifyWorkflow:
+		base.Type = agent.AgentTypeDify
+		appType := "chatbot"
+		if stored.Type == types.AgentTypeDifyWorkflow {
+			appType = "workflow"
+		}
+		// Dify resolves the app from its API key
+		return agent.NewDifyAgent(&agent.DifyConfig{
+			AgentConfig: base,
+			BaseURL:     stored.URL,
+			APIKey:      stored.SourceAPIKey,
+			AppID:       stored.AgentID,
+			AppType:     appType,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported agent type: %s", stored.Type)
+	}
+}
+
+// observeManagedCall record a forwarded call with the agent manager
+func observeManagedCall(agentID string, resp *http.Response, responseTime time.Duration, err error) {
+	m := managedAgents
+	if m == nil {
+		return
+	}
+	// agents the manager does not hold, e.g. mock agents, are skipped
+	m.manager.ObserveResult(agentID, resp, responseTime, err)
+}
+
+// managedAgentDown whether the health checks of the agent manager found the agent's
+// upstream down; unknown agents and agents not checked yet count as up
+func managedAgentDown(agentID string) bool {
+	m := managedAgents
+	if m == nil {
+		return false
+	}
+	status, ok := m.manager.KnownStatus(agentID)
+	return ok && !status.Health
+}
+
+// managedAgentMetrics metrics of every managed agent for the health endpoint, nil when
+// the agent manager is disabled
+func managedAgentMetrics(ctx context.Context) map[string]*agent.AgentMetrics {
+	m := managedAgents
+	if m == nil {
+		return nil
+	}
+	// agents whose first status is still pending are left out rather than waited for
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	metrics, _ := m.manager.GetAllAgentMetrics(ctx)
+	return metrics
+}
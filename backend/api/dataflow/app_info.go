@@ -0,0 +1,180 @@
+package dataflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/pkg/ttlcache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// appInfoCacheSize app descriptions kept per process
+const appInfoCacheSize = 1000
+
+// errAppInfoNotSupported the agent's app has no such description
+var errAppInfoNotSupported = errors.New("not supported by the agent")
+
+var (
+	appInfoCacheOnce sync.Once
+	appInfoCache     *ttlcache.Cache[string, json.RawMessage]
+)
+
+// appInfos the cache of app descriptions, nil when api.dify_app_info_ttl disables it
+func appInfos() *ttlcache.Cache[string, json.RawMessage] {
+	appInfoCacheOnce.Do(func() {
+		if cfg := config.GlobalConfig; cfg != nil && cfg.API.DifyAppInfoTTL > 0 {
+			appInfoCache = ttlcache.New[string, json.RawMessage](cfg.API.DifyAppInfoTTL, appInfoCacheSize)
+		}
+	})
+	return appInfoCache
+}
+
+// FetchAppInfo the parameters or meta of the agent's app as the upstream returns them,
+// cached per agent and upstream URL; cached reports whether it came from the cache
+func (s *DataflowService) FetchAppInfo(ctx context.Context, agentID, resource, user string) (json.RawMessage, bool, error) {
+	return s.fetchDescription(ctx, agentID, resource, func(backend backends.AgentBackend, agentInfo *backends.AgentInfo) (*http.Request, error) {
+		describer, ok := backend.(backends.AppDescriber)
+		if !ok {
+			return nil, nil
+		}
+		return describer.BuildAppInfoRequest(ctx, resource, user, agentInfo)
+	})
+}
+
+// FetchSuggestedQuestions the follow-up questions the agent suggests after a message of
+// the user, cached like the app descriptions since they do not change
+func (s *DataflowService) FetchSuggestedQuestions(ctx context.Context, agentID, messageID, user string) (json.RawMessage, bool, error) {
+	return s.fetchDescription(ctx, agentID, "suggested:"+messageID+":"+user, func(backend backends.AgentBackend, agentInfo *backends.AgentInfo) (*http.Request, error) {
+		suggester, ok := backend.(backends.FollowUpSuggester)
+		if !ok {
+			return nil, nil
+		}
+		return suggester.BuildSuggestedQuestionsRequest(ctx, messageID, user, agentInfo)
+	})
+}
+
+// fetchDescription answer from the cache or send the request build makes for the
+// agent's backend; a nil request means the agent does not support it
+func (s *DataflowService) fetchDescription(ctx context.Context, agentID, resource string, build func(backends.AgentBackend, *backends.AgentInfo) (*http.Request, error)) (json.RawMessage, bool, error) {
+	agentInfo, err := s.getAgentInfo(agentID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get agent info: %w", err)
+	}
+	if !agentInfo.Enabled {
+		return nil, false, fmt.Errorf("agent %s is disabled", agentID)
+	}
+
+	// the URL is part of the key, an agent pointed at another app does not get the old one's
+	cache := appInfos()
+	key := strings.Join([]string{agentID, agentInfo.URL, resource}, "\x00")
+	if cache != nil {
+		if body, ok := cache.Get(key); ok {
+			return body, true, nil
+		}
+	}
+
+	backend, err := s.factory.CreateBackend(backends.DetermineAgentType(agentInfo.Type))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create backend: %w", err)
+	}
+	httpReq, err := build(backend, agentInfo)
+	if err != nil {
+		return nil, false, err
+	}
+	if httpReq == nil {
+		return nil, false, errAppInfoNotSupported
+	}
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reach agent: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, backends.UpstreamError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !json.Valid(body) {
+		return nil, false, errors.New("agent returned an invalid JSON response")
+	}
+
+	if cache != nil {
+		cache.Set(key, body)
+	}
+	return body, false, nil
+}
+
+// HandleDifyParameters handle the Dify app parameters request: input form, opening
+// statement, suggested questions and the features the app enables
+func (h *DataFlowAPIHandler) HandleDifyParameters(c *gin.Context) {
+	h.handleAppInfo(c, backends.AppInfoParameters)
+}
+
+// HandleDifyMeta handle the Dify app meta request, the icons of the app's tools
+func (h *DataFlowAPIHandler) HandleDifyMeta(c *gin.Context) {
+	h.handleAppInfo(c, backends.AppInfoMeta)
+}
+
+// handleAppInfo answer with one description of the app behind the agent
+func (h *DataFlowAPIHandler) handleAppInfo(c *gin.Context, resource string) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	body, cached, err := h.service.FetchAppInfo(c.Request.Context(), authInfo.AgentID, resource, c.Query("user"))
+	h.respondWithDescription(c, body, cached, err)
+}
+
+// HandleDifySuggestedQuestions handle the request for the questions Dify suggests after
+// an answer; user must be the one who sent the message
+func (h *DataFlowAPIHandler) HandleDifySuggestedQuestions(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	user := c.Query("user")
+	if user == "" {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "The user query parameter is required")
+		return
+	}
+
+	body, cached, err := h.service.FetchSuggestedQuestions(c.Request.Context(), authInfo.AgentID, c.Param("message_id"), user)
+	h.respondWithDescription(c, body, cached, err)
+}
+
+// respondWithDescription write the upstream JSON unchanged, X-Cache tells whether it was cached
+func (h *DataFlowAPIHandler) respondWithDescription(c *gin.Context, body json.RawMessage, cached bool, err error) {
+	if errors.Is(err, errAppInfoNotSupported) {
+		h.respondWithError(c, http.StatusNotFound, "not_found", c.Request.URL.Path+" is "+err.Error())
+		return
+	}
+	if err != nil {
+		statusCode, errorType := processingErrorStatus(err)
+		h.respondWithError(c, statusCode, errorType, err.Error())
+		return
+	}
+
+	if cached {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
@@ -2,30 +2,31 @@ package dataflow
 
 import (
 	"agent-connector/internal"
+	"agent-connector/pkg/acl"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
 
+// selectAgentHint how a client picks the agent of a request, for requests that name none
+const selectAgentHint = "name an agent with agent_id in the path, query or body, or set default_agent_id in the settings of the user of X-User-Token (PUT /api/v1/auth/settings)"
+
 // DataFlowAuthService data flow API authentication service
 type DataFlowAuthService struct {
-	agentService *internal.AgentService
+	playgroundTokenService *internal.PlaygroundTokenService
 }
 
 // NewDataFlowAuthService create data flow API authentication service
 func NewDataFlowAuthService() *DataFlowAuthService {
 	return &DataFlowAuthService{
-		agentService: &internal.AgentService{},
+		playgroundTokenService: &internal.PlaygroundTokenService{},
 	}
 }
 
 // AuthenticateRequest authenticate request
 func (s *DataFlowAuthService) AuthenticateRequest(agentID, apiKey string) (*AuthInfo, error) {
 	// parameter validation
-	if agentID == "" {
-		return nil, errors.New("agent_id is required")
-	}
-
 	if apiKey == "" {
 		return nil, errors.New("api_key is required")
 	}
@@ -33,46 +34,192 @@ func (s *DataFlowAuthService) AuthenticateRequest(agentID, apiKey string) (*Auth
 	// clean API key format (remove Bearer prefix)
 	apiKey = s.cleanAPIKey(apiKey)
 
-	// find agent by agent ID
-	agent, err := s.findAgentByAgentID(agentID)
-	if err != nil {
-		return nil, err
+	if internal.IsPlaygroundToken(apiKey) {
+		return s.authenticatePlaygroundToken(agentID, apiKey)
 	}
 
-	// validate API key
-	if agent.ConnectorAPIKey != apiKey {
-		return nil, errors.New("invalid api_key")
+	// find agent by agent ID, or by the key prefix when no agent ID is given
+	var agent *internal.Agent
+	var err error
+	explicit := agentID != ""
+	if explicit {
+		agent, err = s.findAgentByAgentID(agentID)
+		if err != nil {
+			return nil, err
+		}
+
+		// validate API key against the stored hash
+		if !agent.VerifyConnectorAPIKey(apiKey) {
+			return nil, errors.New("invalid api_key")
+		}
+	} else {
+		agent, err = internal.LookupAgentByConnectorAPIKey(apiKey)
+		if err != nil {
+			return nil, errors.New("invalid api_key")
+		}
+		agentID = agent.AgentID
 	}
 
 	// check if agent is enabled
 	if !agent.Enabled {
+		if !explicit {
+			return nil, errors.New("agent of the api_key is disabled, " + selectAgentHint)
+		}
 		return nil, errors.New("agent is disabled")
 	}
+	if agent.Expired() {
+		return nil, errors.New("agent expired")
+	}
 
 	// build authentication information
 	authInfo := &AuthInfo{
 		AgentID:   agentID,
 		APIKey:    apiKey,
 		Timestamp: time.Now(),
-		Agent: &AgentInfo{
-			ID:               agent.ID,
-			Name:             agent.Name,
-			Type:             string(agent.Type),
-			URL:              agent.URL,
-			SourceAPIKey:     agent.SourceAPIKey,
-			QPS:              agent.QPS,
-			Enabled:          agent.Enabled,
-			SupportStreaming: agent.SupportStreaming,
-			ResponseFormat:   agent.ResponseFormat,
+		Agent:     newAgentInfo(agent),
+	}
+
+	return authInfo, nil
+}
+
+// errDefaultAgentNotBound the default agent of the user is neither the agent of the
+// connector key nor lists the user in its access list
+var errDefaultAgentNotBound = errors.New("default agent is not bound to the api_key or user")
+
+// AuthenticateDefaultAgent authenticate a request that names no agent and route it to
+// the default agent of the platform user authenticated with X-User-Token. The default
+// agent is only used when the connector key was issued for it, or when its access list
+// names the user or the user's role; otherwise errDefaultAgentNotBound is returned.
+// Playground tokens stay bound to their own agent.
+func (s *DataFlowAuthService) AuthenticateDefaultAgent(apiKey, username, role, defaultAgentID string) (*AuthInfo, error) {
+	if apiKey == "" {
+		return nil, errors.New("api_key is required")
+	}
+	apiKey = s.cleanAPIKey(apiKey)
+
+	if internal.IsPlaygroundToken(apiKey) {
+		return s.authenticatePlaygroundToken("", apiKey)
+	}
+	keyAgent, err := internal.LookupAgentByConnectorAPIKey(apiKey)
+	if err != nil {
+		return nil, errors.New("invalid api_key")
+	}
+	if keyAgent.AgentID == defaultAgentID {
+		return s.AuthenticateRequest("", apiKey)
+	}
+
+	agent, err := s.findAgentByAgentID(defaultAgentID)
+	if err != nil {
+		return nil, fmt.Errorf("default agent %s of user %s not found, update default_agent_id with PUT /api/v1/auth/settings", defaultAgentID, username)
+	}
+	if !agent.Enabled {
+		return nil, fmt.Errorf("default agent %s of user %s is disabled, update default_agent_id with PUT /api/v1/auth/settings", defaultAgentID, username)
+	}
+	if agent.Expired() {
+		return nil, fmt.Errorf("default agent %s of user %s expired, update default_agent_id with PUT /api/v1/auth/settings", defaultAgentID, username)
+	}
+	// an empty access list lets every caller through, the user has to be named in it
+	if list := agent.ACL(); list.Empty() || !list.Allows(acl.Caller{User: username, Role: role}) {
+		return nil, errDefaultAgentNotBound
+	}
+
+	return &AuthInfo{
+		AgentID:   agent.AgentID,
+		APIKey:    apiKey,
+		Timestamp: time.Now(),
+		Agent:     newAgentInfo(agent),
+	}, nil
+}
+
+// authenticatePlaygroundToken authenticate a request made with a playground token,
+// the token only grants access to the agent it was issued for
+func (s *DataFlowAuthService) authenticatePlaygroundToken(agentID, token string) (*AuthInfo, error) {
+	playgroundToken, err := s.playgroundTokenService.AuthenticatePlaygroundToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if agentID != "" && agentID != playgroundToken.AgentID {
+		return nil, errors.New("playground token is not valid for this agent")
+	}
+
+	agent, err := s.findAgentByAgentID(playgroundToken.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !agent.Enabled {
+		return nil, errors.New("agent is disabled")
+	}
+	if agent.Expired() {
+		return nil, errors.New("agent expired")
+	}
+
+	authInfo := &AuthInfo{
+		AgentID:   agent.AgentID,
+		APIKey:    token,
+		Timestamp: time.Now(),
+		Agent:     newAgentInfo(agent),
+		Playground: &PlaygroundScope{
+			TokenID:     playgroundToken.ID,
+			TokenPrefix: playgroundToken.TokenPrefix,
+			QPS:         playgroundToken.QPS,
+			MaxTokens:   playgroundToken.MaxTokens,
+			ExpiresAt:   playgroundToken.ExpiresAt,
 		},
 	}
 
 	return authInfo, nil
 }
 
-// findAgentByAgentID find agent by agent ID
+// newAgentInfo build agent information from the stored agent
+func newAgentInfo(agent *internal.Agent) *AgentInfo {
+	return &AgentInfo{
+		ID:                  agent.ID,
+		Name:                agent.Name,
+		Type:                string(agent.Type),
+		URL:                 agent.URL,
+		SourceAPIKey:        agent.SourceAPIKey,
+		QPS:                 agent.QPS,
+		Enabled:             agent.Enabled,
+		SupportStreaming:    agent.SupportStreaming,
+		ResponseFormat:      agent.ResponseFormat,
+		PromptPrice:         agent.PromptPrice,
+		CompletionPrice:     agent.CompletionPrice,
+		HedgeAgentID:        agent.HedgeAgentID,
+		HedgeAfterMs:        agent.HedgeAfterMs,
+		ContinueOnInterrupt: agent.ContinueOnInterrupt,
+		ContextWindow:       agent.ContextWindow,
+		ContextOverflow:     agent.ContextOverflow,
+		PriorityOverride:    agent.PriorityOverride,
+		QPSSharing:          agent.QPSSharing,
+		UserQPS:             agent.UserQPS,
+		RecordMode:          agent.RecordMode,
+		MaxTemperature:      agent.MaxTemperature,
+		MaxTokensCap:        agent.MaxTokensCap,
+		MaxMessages:         agent.MaxMessages,
+		MaxMessageBytes:     agent.MaxMessageBytes,
+		MaxInputs:           agent.MaxInputs,
+		ForbiddenParameters: agent.ForbiddenParameterList(),
+		GuardrailPolicy:     agent.GuardrailPolicy,
+		OutputFilter:        agent.OutputFilterRules(),
+		BlockedWords:        agent.BlockedWordList(),
+		OutputFilterAction:  agent.OutputFilterAction,
+		RequireSignature:    agent.RequireSignature,
+		SigningSecret:       agent.SigningSecret,
+		StreamTokenRate:     agent.StreamTokenRate,
+		Tier:                agent.Tier,
+		AccessSchedule:      agent.AccessSchedule,
+		AccessTimezone:      agent.AccessTimezone,
+		ACL:                 agent.ACL(),
+		QuotaPool:           agent.QuotaPool,
+		PoolLimits:          agent.PoolLimits(),
+	}
+}
+
+// findAgentByAgentID find agent by agent ID, through the lookup cache
 func (s *DataFlowAuthService) findAgentByAgentID(agentID string) (*internal.Agent, error) {
-	return s.agentService.GetAgentByAgentID(agentID)
+	return internal.LookupAgentByAgentID(agentID)
 }
 
 // cleanAPIKey clean API key format
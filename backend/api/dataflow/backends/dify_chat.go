@@ -9,6 +9,7 @@ import (
 	"agent-connector/pkg/types"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -27,6 +28,11 @@ func (b *DifyChatBackend) GetType() types.AgentType {
 
 // ValidateRequest validates the request for Dify Chat backend
 func (b *DifyChatBackend) ValidateRequest(req *BackendRequest) error {
+	// OpenAI style requests send their last user message, Dify keeps the history
+	// of the conversation
+	if req.Query == "" {
+		req.Query = lastUserMessage(req.Messages)
+	}
 	if req.Query == "" {
 		return fmt.Errorf("query field is required for Dify Chat backend")
 	}
@@ -95,7 +101,7 @@ func (b *DifyChatBackend) ProcessBlockingResponse(resp *http.Response) (interfac
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("agent returned error status: %d", resp.StatusCode)
+		return nil, UpstreamError(resp)
 	}
 
 	var response interface{}
@@ -109,14 +115,84 @@ func (b *DifyChatBackend) ProcessBlockingResponse(resp *http.Response) (interfac
 // ProcessStreamingResponse processes the response for streaming requests
 func (b *DifyChatBackend) ProcessStreamingResponse(resp *http.Response) (io.ReadCloser, error) {
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, fmt.Errorf("agent returned error status: %d", resp.StatusCode)
+		return nil, UpstreamError(resp)
 	}
 
 	return resp.Body, nil
 }
 
+// BuildStopRequest builds the request to Dify's stop API for a chat message task
+func (b *DifyChatBackend) BuildStopRequest(ctx context.Context, taskID, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	return buildDifyStopRequest(ctx, "/v1/chat-messages/"+url.PathEscape(taskID)+"/stop", user, agentInfo)
+}
+
+// buildDifyStopRequest builds a stop request; Dify only stops tasks of the user that started them
+func buildDifyStopRequest(ctx context.Context, endpoint, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{"user": user})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	fullURL := strings.TrimSuffix(agentInfo.URL, "/") + endpoint
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+agentInfo.SourceAPIKey)
+
+	return httpReq, nil
+}
+
+// BuildAppInfoRequest builds the request to Dify's parameters or meta API
+func (b *DifyChatBackend) BuildAppInfoRequest(ctx context.Context, resource, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	switch resource {
+	case AppInfoParameters, AppInfoMeta:
+		return buildDifyGetRequest(ctx, "/v1/"+resource, user, agentInfo)
+	default:
+		return nil, nil
+	}
+}
+
+// BuildProbeRequest builds an app parameters request, answered for valid app API keys only
+func (b *DifyChatBackend) BuildProbeRequest(ctx context.Context, agentInfo *AgentInfo) (*http.Request, error) {
+	return buildDifyGetRequest(ctx, "/v1/parameters", ProbeUser, agentInfo)
+}
+
+// BuildSuggestedQuestionsRequest builds the request to Dify's suggested questions API;
+// Dify only answers for messages of the user that sent them
+func (b *DifyChatBackend) BuildSuggestedQuestionsRequest(ctx context.Context, messageID, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	return buildDifyGetRequest(ctx, "/v1/messages/"+url.PathEscape(messageID)+"/suggested", user, agentInfo)
+}
+
+// buildDifyGetRequest builds a GET request for the user, who Dify requires on every call
+func buildDifyGetRequest(ctx context.Context, endpoint, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	fullURL := strings.TrimSuffix(agentInfo.URL, "/") + endpoint
+	if user != "" {
+		fullURL += "?" + url.Values{"user": {user}}.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+agentInfo.SourceAPIKey)
+
+	return httpReq, nil
+}
+
 // GetEndpoint returns the endpoint path for Dify Chat API
 func (b *DifyChatBackend) GetEndpoint() string {
 	return "/v1/chat-messages"
 }
+
+// lastUserMessage the content of the latest user message, empty when there is none
+func lastUserMessage(messages []ChatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
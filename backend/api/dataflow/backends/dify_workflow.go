@@ -9,6 +9,7 @@ import (
 	"agent-connector/pkg/types"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -89,7 +90,7 @@ func (b *DifyWorkflowBackend) ProcessBlockingResponse(resp *http.Response) (inte
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("agent returned error status: %d", resp.StatusCode)
+		return nil, UpstreamError(resp)
 	}
 
 	var response interface{}
@@ -103,13 +104,30 @@ func (b *DifyWorkflowBackend) ProcessBlockingResponse(resp *http.Response) (inte
 // ProcessStreamingResponse processes the response for streaming requests
 func (b *DifyWorkflowBackend) ProcessStreamingResponse(resp *http.Response) (io.ReadCloser, error) {
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, fmt.Errorf("agent returned error status: %d", resp.StatusCode)
+		return nil, UpstreamError(resp)
 	}
 
 	return resp.Body, nil
 }
 
+// BuildStopRequest builds the request to Dify's stop API for a workflow task
+func (b *DifyWorkflowBackend) BuildStopRequest(ctx context.Context, taskID, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	return buildDifyStopRequest(ctx, "/v1/workflows/tasks/"+url.PathEscape(taskID)+"/stop", user, agentInfo)
+}
+
+// BuildAppInfoRequest builds the request to Dify's parameters API, workflow apps have no meta
+func (b *DifyWorkflowBackend) BuildAppInfoRequest(ctx context.Context, resource, user string, agentInfo *AgentInfo) (*http.Request, error) {
+	if resource != AppInfoParameters {
+		return nil, nil
+	}
+	return buildDifyGetRequest(ctx, "/v1/parameters", user, agentInfo)
+}
+
+// BuildProbeRequest builds an app parameters request, answered for valid app API keys only
+func (b *DifyWorkflowBackend) BuildProbeRequest(ctx context.Context, agentInfo *AgentInfo) (*http.Request, error) {
+	return buildDifyGetRequest(ctx, "/v1/parameters", ProbeUser, agentInfo)
+}
+
 // GetEndpoint returns the endpoint path for Dify Workflow API
 func (b *DifyWorkflowBackend) GetEndpoint() string {
 	return "/v1/workflows/run"
@@ -0,0 +1,65 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"agent-connector/pkg/agent"
+)
+
+// maxErrorBodySize bytes of an upstream error body read for the provider's message
+const maxErrorBodySize = 64 << 10
+
+// upstreamErrorBody the error fields of OpenAI ({"error": {...}}) and Dify
+// ({"code": ..., "message": ...}) error responses
+type upstreamErrorBody struct {
+	Error   json.RawMessage `json:"error"`
+	Code    interface{}     `json:"code"`
+	Message string          `json:"message"`
+}
+
+// UpstreamError the typed error of an upstream error response, classified by its
+// status and the provider's error code; the body is read and closed
+func UpstreamError(resp *http.Response) error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	var code, errType, message string
+	var body upstreamErrorBody
+	if json.Unmarshal(data, &body) == nil {
+		code, message = codeString(body.Code), body.Message
+
+		var nested struct {
+			Code    interface{} `json:"code"`
+			Type    string      `json:"type"`
+			Message string      `json:"message"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(body.Error, &nested) == nil && nested.Message != "":
+			code, errType, message = codeString(nested.Code), nested.Type, nested.Message
+		case json.Unmarshal(body.Error, &text) == nil && text != "":
+			message = text
+		}
+	}
+
+	text := fmt.Sprintf("agent returned error status: %d", resp.StatusCode)
+	if message != "" {
+		text += ": " + message
+	}
+	return agent.NewAgentError(resp.StatusCode, code, errType, text)
+}
+
+// codeString a provider error code, which some providers send as a number
+func codeString(code interface{}) string {
+	switch value := code.(type) {
+	case string:
+		return value
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return ""
+	}
+}
@@ -19,6 +19,8 @@ func (f *DefaultBackendFactory) CreateBackend(agentType types.AgentType) (AgentB
 		return NewDifyChatBackend(), nil
 	case types.AgentTypeDifyWorkflow:
 		return NewDifyWorkflowBackend(), nil
+	case types.AgentTypeMock:
+		return NewMockBackend(), nil
 	default:
 		return nil, fmt.Errorf("unsupported agent type: %s", agentType)
 	}
@@ -36,6 +38,8 @@ func DetermineAgentType(agentType string) types.AgentType {
 		return types.AgentTypeDifyChat
 	case "dify-workflow":
 		return types.AgentTypeDifyWorkflow
+	case "mock":
+		return types.AgentTypeMock
 	default:
 		return types.AgentTypeOpenAI
 	}
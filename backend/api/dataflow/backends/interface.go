@@ -28,6 +28,42 @@ type AgentBackend interface {
 	GetEndpoint() string
 }
 
+// TaskStopper is implemented by backends whose upstream can stop a running generation
+type TaskStopper interface {
+	// BuildStopRequest builds the request that stops the upstream task of a streaming response
+	BuildStopRequest(ctx context.Context, taskID, user string, agentInfo *AgentInfo) (*http.Request, error)
+}
+
+// App descriptions an AppDescriber can fetch
+const (
+	AppInfoParameters = "parameters" // input form, opening statement and enabled features
+	AppInfoMeta       = "meta"       // tool icons
+)
+
+// AppDescriber is implemented by backends whose upstream describes the app behind the agent
+type AppDescriber interface {
+	// BuildAppInfoRequest builds the request for one description of the app, nil when the
+	// app has no such description
+	BuildAppInfoRequest(ctx context.Context, resource, user string, agentInfo *AgentInfo) (*http.Request, error)
+}
+
+// FollowUpSuggester is implemented by backends whose upstream suggests follow-up questions
+type FollowUpSuggester interface {
+	// BuildSuggestedQuestionsRequest builds the request for the questions suggested after a message
+	BuildSuggestedQuestionsRequest(ctx context.Context, messageID, user string, agentInfo *AgentInfo) (*http.Request, error)
+}
+
+// Prober is implemented by backends that can check the agent's upstream without
+// generating anything
+type Prober interface {
+	// BuildProbeRequest builds a cheap request the upstream answers with 200 when the
+	// agent's URL and API key are right
+	BuildProbeRequest(ctx context.Context, agentInfo *AgentInfo) (*http.Request, error)
+}
+
+// ProbeUser the user Dify sees on probe requests
+const ProbeUser = "agent-connector-probe"
+
 // Import BackendType from unified types package
 // BackendType is now defined in pkg/types/backend_types.go
 
@@ -54,6 +90,38 @@ type BackendRequest struct {
 	// Dify Workflow fields
 	WorkflowID string                 `json:"workflow_id,omitempty"`
 	Data       map[string]interface{} `json:"data,omitempty"`
+
+	// Client metadata, ForwardMetadata is the configured subset sent upstream
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	ForwardMetadata map[string]string `json:"-"`
+
+	// Locale preferred language of the answer, sent upstream as Accept-Language
+	Locale string `json:"-"`
+
+	// AuthenticatedUser platform user authenticated with the X-User-Token header, empty
+	// when the request carries no session token; User above is only the client's label
+	AuthenticatedUser string `json:"-"`
+
+	// SessionID client session of the X-Session-ID header, a Dify chat request without
+	// conversation ID continues the session's conversation
+	SessionID string `json:"-"`
+
+	// HedgedTo is set when the response came from the agent's hedge agent
+	HedgedTo string `json:"-"`
+
+	// Warnings describe changes the connector made to the request, e.g. a trimmed context
+	Warnings []string `json:"-"`
+
+	// ConnectorTokens tokens of the calls the connector made on its own for the request,
+	// e.g. to summarize dropped messages; billed with the request
+	ConnectorTokens TokenCount `json:"-"`
+}
+
+// TokenCount tokens a call used
+type TokenCount struct {
+	Prompt     int
+	Completion int
+	Total      int
 }
 
 // ChatMessage represents a chat message
@@ -64,15 +132,23 @@ type ChatMessage struct {
 
 // AgentInfo represents agent configuration
 type AgentInfo struct {
-	ID               uint
-	Name             string
-	Type             string
-	URL              string
-	SourceAPIKey     string
-	QPS              int
-	Enabled          bool
-	SupportStreaming bool
-	ResponseFormat   string
+	ID                  uint
+	Name                string
+	Type                string
+	URL                 string
+	SourceAPIKey        string
+	QPS                 int
+	Enabled             bool
+	SupportStreaming    bool
+	ResponseFormat      string
+	HedgeAgentID        string
+	HedgeAfterMs        int
+	ContinueOnInterrupt bool
+	ContextWindow       int    // prompt and completion tokens, 0 disables the check
+	ContextOverflow     string // reject, truncate_oldest or summarize
+	RecordMode          string // record or replay upstream fixtures, empty sends requests upstream
+	StreamTokenRate     int    // tokens per second streamed to clients, 0 disables pacing
+	UserQPS             int    // QPS of each user of the connector key, 0 inherits the user and system defaults
 }
 
 // BackendFactory creates backend instances
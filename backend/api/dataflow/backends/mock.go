@@ -0,0 +1,72 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"agent-connector/pkg/mockagent"
+	"agent-connector/pkg/types"
+)
+
+// MockBackend implements AgentBackend for mock agents; it speaks the OpenAI format to
+// the in-process mock transport, which answers from the options in the agent URL
+type MockBackend struct {
+	*OpenAIBackend
+}
+
+// NewMockBackend creates a new mock backend
+func NewMockBackend() *MockBackend {
+	return &MockBackend{OpenAIBackend: NewOpenAIBackend()}
+}
+
+// GetType returns the backend type
+func (b *MockBackend) GetType() types.AgentType {
+	return types.AgentTypeMock
+}
+
+// ValidateRequest accepts OpenAI messages or a Dify style query, so clients of any
+// agent type can be pointed at a mock
+func (b *MockBackend) ValidateRequest(req *BackendRequest) error {
+	if len(req.Messages) == 0 && req.Query != "" {
+		req.Messages = []ChatMessage{{Role: "user", Content: req.Query}}
+	}
+	if req.Model == "" {
+		req.Model = "mock"
+	}
+	return b.OpenAIBackend.ValidateRequest(req)
+}
+
+// BuildForwardRequest builds the request for the mock transport, the options of the
+// agent URL travel in the query
+func (b *MockBackend) BuildForwardRequest(ctx context.Context, req *BackendRequest, agentInfo *AgentInfo) (*http.Request, error) {
+	options, err := url.Parse(agentInfo.URL)
+	if err != nil || options.Scheme != mockagent.Scheme {
+		return nil, fmt.Errorf("invalid mock agent URL: %s", agentInfo.URL)
+	}
+
+	reqBody := map[string]interface{}{
+		"model":    req.Model,
+		"messages": req.Messages,
+		"stream":   req.Stream,
+	}
+	if req.User != "" {
+		reqBody["user"] = req.User
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	target := url.URL{Scheme: mockagent.Scheme, Host: "local", Path: b.GetEndpoint(), RawQuery: options.RawQuery}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", target.String(), bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return httpReq, nil
+}
@@ -67,6 +67,9 @@ func (b *OpenAIBackend) BuildForwardRequest(ctx context.Context, req *BackendReq
 	if req.Temperature != nil {
 		reqBody["temperature"] = *req.Temperature
 	}
+	if req.User != "" {
+		reqBody["user"] = req.User
+	}
 
 	// Serialize request body
 	jsonData, err := json.Marshal(reqBody)
@@ -90,12 +93,23 @@ func (b *OpenAIBackend) BuildForwardRequest(ctx context.Context, req *BackendReq
 	return httpReq, nil
 }
 
+// BuildProbeRequest builds a model list request, which needs a valid API key but no model
+func (b *OpenAIBackend) BuildProbeRequest(ctx context.Context, agentInfo *AgentInfo) (*http.Request, error) {
+	fullURL := strings.TrimSuffix(agentInfo.URL, "/") + "/v1/models"
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+agentInfo.SourceAPIKey)
+	return httpReq, nil
+}
+
 // ProcessBlockingResponse processes the response for blocking requests
 func (b *OpenAIBackend) ProcessBlockingResponse(resp *http.Response) (interface{}, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("agent returned error status: %d", resp.StatusCode)
+		return nil, UpstreamError(resp)
 	}
 
 	var response interface{}
@@ -109,8 +123,7 @@ func (b *OpenAIBackend) ProcessBlockingResponse(resp *http.Response) (interface{
 // ProcessStreamingResponse processes the response for streaming requests
 func (b *OpenAIBackend) ProcessStreamingResponse(resp *http.Response) (io.ReadCloser, error) {
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, fmt.Errorf("agent returned error status: %d", resp.StatusCode)
+		return nil, UpstreamError(resp)
 	}
 
 	return resp.Body, nil
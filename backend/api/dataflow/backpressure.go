@@ -0,0 +1,159 @@
+package dataflow
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/queue"
+)
+
+const (
+	// latencySmoothing weight of the newest request in the average request duration
+	latencySmoothing = 0.2
+
+	// maxRetryAfterSeconds upper bound of the suggested retry delay
+	maxRetryAfterSeconds = 60
+)
+
+// BackpressureHint load of an agent queue and what it means for the client, the queue
+// holds the requests in flight to the agent
+type BackpressureHint struct {
+	QueueDepth        int64   `json:"queue_depth"`
+	MaxQueueSize      int64   `json:"max_queue_size,omitempty"`
+	Saturation        float64 `json:"saturation,omitempty"`     // queue depth over max queue size
+	QueuePosition     int64   `json:"queue_position,omitempty"` // 1-based, in priority order
+	EstimatedWaitMs   int64   `json:"estimated_wait_ms"`
+	RetryAfterSeconds int     `json:"retry_after_seconds"`
+}
+
+// setHeaders write the hint as X-Queue-* and X-Backpressure-* response headers
+func (h *BackpressureHint) setHeaders(header http.Header) {
+	header.Set("X-Queue-Depth", strconv.FormatInt(h.QueueDepth, 10))
+	if h.MaxQueueSize > 0 {
+		header.Set("X-Queue-Max-Size", strconv.FormatInt(h.MaxQueueSize, 10))
+	}
+	if h.QueuePosition > 0 {
+		header.Set("X-Queue-Position", strconv.FormatInt(h.QueuePosition, 10))
+	}
+	header.Set("X-Estimated-Wait-Ms", strconv.FormatInt(h.EstimatedWaitMs, 10))
+	header.Set("X-Backpressure-Retry-After", strconv.Itoa(h.RetryAfterSeconds))
+}
+
+// requestLatencyTracker smoothed duration of the requests of each agent, measured
+// from queue admission to release
+type requestLatencyTracker struct {
+	mu      sync.Mutex
+	average map[string]time.Duration
+}
+
+// agentRequestLatency is shared by every middleware instance of the process
+var agentRequestLatency = &requestLatencyTracker{average: make(map[string]time.Duration)}
+
+// observe fold the duration of a finished request into the agent's average
+func (t *requestLatencyTracker) observe(agentID string, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	average, ok := t.average[agentID]
+	if !ok {
+		t.average[agentID] = duration
+		return
+	}
+	t.average[agentID] = average + time.Duration(latencySmoothing*float64(duration-average))
+}
+
+// get the average request duration of the agent, 0 before the first request finished
+func (t *requestLatencyTracker) get(agentID string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.average[agentID]
+}
+
+// slotInterval how often a slot of the agent queue frees up: the depth requests in
+// flight each take the average duration; without a measured duration the agent QPS
+// is the drain rate
+func slotInterval(agentID string, depth int64, qps int) time.Duration {
+	if average := agentRequestLatency.get(agentID); average > 0 && depth > 0 {
+		return average / time.Duration(depth)
+	}
+	if qps > 0 {
+		return time.Second / time.Duration(qps)
+	}
+	return time.Second
+}
+
+// retryAfterSeconds round a delay up to whole seconds between 1 and the upper bound
+func retryAfterSeconds(delay time.Duration) int {
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	if seconds > maxRetryAfterSeconds {
+		return maxRetryAfterSeconds
+	}
+	return seconds
+}
+
+// queueFullHint the hint for a request rejected by a full queue: it can retry once
+// the next slot frees up
+func queueFullHint(agentID string, queueFullErr *queue.QueueFullError, qps int) *BackpressureHint {
+	interval := slotInterval(agentID, queueFullErr.CurrentSize, qps)
+	hint := &BackpressureHint{
+		QueueDepth:        queueFullErr.CurrentSize,
+		MaxQueueSize:      queueFullErr.MaxQueueSize,
+		EstimatedWaitMs:   interval.Milliseconds(),
+		RetryAfterSeconds: retryAfterSeconds(interval),
+	}
+	if queueFullErr.MaxQueueSize > 0 {
+		hint.Saturation = float64(queueFullErr.CurrentSize) / float64(queueFullErr.MaxQueueSize)
+	}
+	return hint
+}
+
+// admittedHint the hint for an admitted request, nil while the queue is below the
+// configured backpressure ratio. The wait counts the slots ahead of the request, the
+// retry delay the slots to free before the queue drops below the ratio again.
+func admittedHint(ctx context.Context, pq queue.PriorityQueue, agentID, queueName, requestID string, qps int) *BackpressureHint {
+	ratio := config.GlobalConfig.API.BackpressureRatio
+	if ratio <= 0 {
+		return nil
+	}
+
+	options, err := pq.GetQueueOptions(ctx, queueName)
+	if err != nil || options.MaxQueueSize <= 0 {
+		return nil
+	}
+	depth, err := pq.Size(ctx, queueName)
+	if err != nil {
+		return nil
+	}
+	saturation := float64(depth) / float64(options.MaxQueueSize)
+	if saturation < ratio {
+		return nil
+	}
+
+	position, err := pq.Position(ctx, queueName, requestID)
+	if err != nil {
+		position = depth
+	}
+	interval := slotInterval(agentID, depth, qps)
+	ahead := position - 1
+	if ahead < 0 {
+		ahead = 0
+	}
+	overload := depth - int64(math.Floor(ratio*float64(options.MaxQueueSize))) + 1
+
+	return &BackpressureHint{
+		QueueDepth:        depth,
+		MaxQueueSize:      options.MaxQueueSize,
+		Saturation:        saturation,
+		QueuePosition:     position,
+		EstimatedWaitMs:   (interval * time.Duration(ahead)).Milliseconds(),
+		RetryAfterSeconds: retryAfterSeconds(interval * time.Duration(overload)),
+	}
+}
@@ -0,0 +1,258 @@
+package dataflow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader request header naming a chat request, echoed in the response; the ID
+// stops the request through the cancel endpoint
+const requestIDHeader = "X-Request-ID"
+
+// Stop timeouts
+const (
+	// upstreamStopTimeout bounds the call to the upstream stop API
+	upstreamStopTimeout = 5 * time.Second
+	// cancelWaitTimeout how long the cancel endpoint waits for the request to wind down
+	cancelWaitTimeout = 5 * time.Second
+)
+
+// errGenerationStopped the request was stopped through the cancel endpoint
+var errGenerationStopped = errors.New("generation stopped")
+
+// inflightContextKey context key of the tracked request
+type inflightContextKey struct{}
+
+// inflightRequest a chat request that can be stopped while it runs
+type inflightRequest struct {
+	id        string
+	agentID   string
+	stream    bool
+	startedAt time.Time
+	cancel    context.CancelCauseFunc
+	done      chan struct{}
+
+	// length of the response text forwarded so far
+	generated atomic.Int64
+
+	mu        sync.Mutex
+	taskID    string // upstream task of a Dify stream
+	user      string
+	stopper   backends.TaskStopper
+	agentInfo *backends.AgentInfo
+}
+
+// observe count the text of a forwarded stream chunk and remember the upstream task
+func (r *inflightRequest) observe(payload interface{}) {
+	r.generated.Add(int64(len(responseText(payload))))
+
+	body, _ := payload.(map[string]interface{})
+	if taskID, ok := body["task_id"].(string); ok && taskID != "" {
+		r.mu.Lock()
+		r.taskID = taskID
+		r.mu.Unlock()
+	}
+}
+
+// setUpstream remember the backend and agent that answer the request for the stop API
+func (r *inflightRequest) setUpstream(backend backends.AgentBackend, agentInfo *backends.AgentInfo, user string) {
+	stopper, ok := backend.(backends.TaskStopper)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopper = stopper
+	r.agentInfo = agentInfo
+	r.user = user
+}
+
+// stopUpstream ask the upstream to stop the task, reports whether it accepted
+func (r *inflightRequest) stopUpstream(client *http.Client) bool {
+	r.mu.Lock()
+	stopper, agentInfo, taskID, user := r.stopper, r.agentInfo, r.taskID, r.user
+	r.mu.Unlock()
+	if stopper == nil || taskID == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamStopTimeout)
+	defer cancel()
+
+	httpReq, err := stopper.BuildStopRequest(ctx, taskID, user, agentInfo)
+	if err != nil {
+		log.Printf("Failed to stop task %s of agent %s: %v", taskID, r.agentID, err)
+		return false
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		log.Printf("Failed to stop task %s of agent %s: %v", taskID, r.agentID, err)
+		return false
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		log.Printf("Agent %s refused to stop task %s: status %d", r.agentID, taskID, resp.StatusCode)
+		return false
+	}
+	return true
+}
+
+// inflightRegistry the running chat requests of this instance by API key and request ID
+type inflightRegistry struct {
+	mu       sync.Mutex
+	requests map[string]*inflightRequest
+}
+
+// inflightRequests shared by the handlers of all route setups
+var inflightRequests = &inflightRegistry{requests: make(map[string]*inflightRequest)}
+
+// registryKey scope request IDs to the API key, so a key only reaches its own requests
+func registryKey(apiKey, requestID string) string {
+	return apiKey + "\x00" + requestID
+}
+
+// add register a request, false when the ID is already taken
+func (r *inflightRegistry) add(apiKey string, request *inflightRequest) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := registryKey(apiKey, request.id)
+	if _, exists := r.requests[key]; exists {
+		return false
+	}
+	r.requests[key] = request
+	return true
+}
+
+// remove unregister a finished request
+func (r *inflightRegistry) remove(apiKey string, request *inflightRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := registryKey(apiKey, request.id)
+	if r.requests[key] == request {
+		delete(r.requests, key)
+	}
+}
+
+// get the running request of the key with the ID, nil when there is none
+func (r *inflightRegistry) get(apiKey, requestID string) *inflightRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests[registryKey(apiKey, requestID)]
+}
+
+// newRequestID generate a collision-safe request ID
+func newRequestID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("req_%d", time.Now().UnixNano())
+	}
+	return "req_" + hex.EncodeToString(buf)
+}
+
+// trackRequest make the request stoppable: it gets the client's X-Request-ID or a
+// generated one, echoed in the response, and a cancellable context. The returned
+// function unregisters it when the handler is done.
+func (h *DataFlowAPIHandler) trackRequest(c *gin.Context, req *backends.BackendRequest) func() {
+	ctx, cancel := context.WithCancelCause(c.Request.Context())
+	request := &inflightRequest{
+		id:        c.GetHeader(requestIDHeader),
+		agentID:   req.AgentID,
+		stream:    req.Stream,
+		startedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	// a client ID already in use gets a generated one, the response header tells which
+	if request.id == "" || len(request.id) > 128 || !inflightRequests.add(req.APIKey, request) {
+		request.id = newRequestID()
+		inflightRequests.add(req.APIKey, request)
+	}
+
+	c.Header(requestIDHeader, request.id)
+	original := c.Request
+	c.Request = c.Request.WithContext(context.WithValue(ctx, inflightContextKey{}, request))
+
+	return func() {
+		inflightRequests.remove(req.APIKey, request)
+		close(request.done)
+		cancel(nil)
+		c.Request = original
+	}
+}
+
+// trackedRequest the stoppable request running in ctx, nil when it is not tracked
+func trackedRequest(ctx context.Context) *inflightRequest {
+	request, _ := ctx.Value(inflightContextKey{}).(*inflightRequest)
+	return request
+}
+
+// HandleCancelRequest stop a running chat request of the caller's API key: Dify agents
+// are asked to stop the task, then the request's context is cancelled so the upstream
+// call ends. Answers with the length of the content generated until then.
+func (h *DataFlowAPIHandler) HandleCancelRequest(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	requestID := c.Param("request_id")
+	request := inflightRequests.get(authInfo.APIKey, requestID)
+	if request == nil {
+		h.respondWithError(c, http.StatusNotFound, "request_not_found", "No running request "+requestID)
+		return
+	}
+
+	upstreamStopped := request.stopUpstream(h.service.httpClient)
+	request.cancel(errGenerationStopped)
+
+	finished := true
+	select {
+	case <-request.done:
+	case <-time.After(cancelWaitTimeout):
+		finished = false
+	}
+
+	c.JSON(http.StatusOK, CancelRequestResponse{
+		RequestID:              request.id,
+		AgentID:                request.agentID,
+		Stream:                 request.stream,
+		Status:                 "cancelled",
+		Finished:               finished,
+		UpstreamStopped:        upstreamStopped,
+		GeneratedContentLength: request.generated.Load(),
+		DurationMs:             time.Since(request.startedAt).Milliseconds(),
+	})
+}
+
+// writeGenerationStopped end a stopped stream with an event telling how much was sent
+func writeGenerationStopped(w http.ResponseWriter, requestID string, generated int64) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"event":                    "generation_stopped",
+		"request_id":               requestID,
+		"generated_content_length": generated,
+	})
+	if events, err := newSSEWriter(w); err == nil {
+		events.writeEvent("generation_stopped", data)
+	}
+}
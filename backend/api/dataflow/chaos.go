@@ -0,0 +1,182 @@
+package dataflow
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/chaos"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errStreamDropped write error of an event stream cut by chaos injection
+var errStreamDropped = errors.New("stream dropped by chaos injection")
+
+var (
+	chaosOnce           sync.Once
+	sharedChaosInjector *chaos.Injector
+)
+
+// chaosInjector the fault injector of the process, nil unless chaos is enabled outside
+// production and the rules are valid
+func chaosInjector() *chaos.Injector {
+	chaosOnce.Do(func() {
+		if config.GlobalConfig == nil || !config.GlobalConfig.Chaos.Enabled {
+			return
+		}
+		if config.GlobalConfig.App.Environment == "production" {
+			log.Printf("Chaos injection is enabled but ignored in production")
+			return
+		}
+
+		rules, err := chaos.ParseRules(config.GlobalConfig.Chaos.Rules)
+		if err != nil {
+			log.Printf("Chaos injection disabled: %v", err)
+			return
+		}
+		sharedChaosInjector = chaos.NewInjector(rules)
+		log.Printf("⚠️  Chaos injection enabled with %d rules", len(rules))
+	})
+	return sharedChaosInjector
+}
+
+// ChaosMiddleware injects latency, 5xx errors, rate limits and dropped streams into
+// requests matching the chaos rules; injected responses carry X-Chaos-Injected
+func (m *DataFlowMiddleware) ChaosMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		injector := chaosInjector()
+		if injector == nil {
+			c.Next()
+			return
+		}
+
+		authInfo, err := GetAuthInfoFromContext(c)
+		if err != nil {
+			m.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			c.Abort()
+			return
+		}
+
+		fault := injector.Decide(authInfo.AgentID, c.Request.URL.Path)
+		if fault.None() {
+			c.Next()
+			return
+		}
+		c.Header("X-Chaos-Injected", fault.String())
+
+		if fault.Latency > 0 {
+			timer := time.NewTimer(fault.Latency)
+			select {
+			case <-timer.C:
+			case <-c.Request.Context().Done():
+				timer.Stop()
+				c.Abort()
+				return
+			}
+		}
+
+		switch {
+		case fault.ErrorStatus != 0:
+			m.respondWithChaosError(c, fault.ErrorStatus)
+			c.Abort()
+			return
+		case fault.RateLimited:
+			m.respondWithChaosRateLimit(c, fault.RetryAfter)
+			c.Abort()
+			return
+		}
+
+		if fault.DropAfter >= 0 {
+			c.Writer = &droppingWriter{ResponseWriter: c.Writer, remaining: fault.DropAfter, hijack: c.Request.ProtoMajor == 1}
+		}
+		c.Next()
+	}
+}
+
+// droppingWriter cuts an event stream after a number of bytes: the connection is
+// closed when it can be hijacked (HTTP/1), otherwise the stream just ends early.
+// Other responses pass through untouched.
+type droppingWriter struct {
+	gin.ResponseWriter
+	remaining int
+	hijack    bool // HTTP/2 connections cannot be hijacked
+	dropped   bool
+}
+
+// Write implements io.Writer
+func (w *droppingWriter) Write(data []byte) (int, error) {
+	if w.dropped {
+		return 0, errStreamDropped
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return w.ResponseWriter.Write(data)
+	}
+	if len(data) <= w.remaining {
+		w.remaining -= len(data)
+		return w.ResponseWriter.Write(data)
+	}
+
+	n, _ := w.ResponseWriter.Write(data[:w.remaining])
+	w.drop()
+	return n, errStreamDropped
+}
+
+// WriteString implements io.StringWriter
+func (w *droppingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush implements http.Flusher, nothing reaches the client after the drop
+func (w *droppingWriter) Flush() {
+	if !w.dropped {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// drop send what was written so far and close the connection
+func (w *droppingWriter) drop() {
+	w.dropped = true
+	w.ResponseWriter.Flush()
+	if w.hijack {
+		if conn, _, err := w.ResponseWriter.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+	log.Printf("Chaos injection dropped an event stream")
+}
+
+// respondWithChaosError answer with an injected server error
+func (m *DataFlowMiddleware) respondWithChaosError(c *gin.Context, statusCode int) {
+	response := DataFlowResponse{
+		Code:    statusCode,
+		Message: "Error",
+		Error: &APIError{
+			Type:    "chaos_injected_error",
+			Code:    strconv.Itoa(statusCode),
+			Message: "Error injected by chaos testing",
+		},
+	}
+	c.JSON(statusCode, response)
+}
+
+// respondWithChaosRateLimit answer with an injected rate limit
+func (m *DataFlowMiddleware) respondWithChaosRateLimit(c *gin.Context, retryAfter int) {
+	response := DataFlowResponse{
+		Code:    http.StatusTooManyRequests,
+		Message: "Rate limit exceeded",
+		Error: &APIError{
+			Type:    "rate_limit_exceeded",
+			Code:    "429",
+			Message: "Rate limit injected by chaos testing",
+		},
+	}
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, response)
+}
@@ -0,0 +1,321 @@
+package dataflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"agent-connector/config"
+)
+
+// streamChunkingHeader selects re-batching of a stream's text chunks, e.g.
+// "sentence; min_bytes=120; flush_interval=500ms"
+const streamChunkingHeader = "X-Stream-Chunking"
+
+const (
+	// maxChunkMinBytes and maxChunkFlushInterval bound what a request may ask for, so a
+	// stream never holds back more than a paragraph or for longer than a few seconds
+	maxChunkMinBytes      = 4096
+	maxChunkFlushInterval = 5 * time.Second
+)
+
+// chunk boundaries re-batched text is split at
+const (
+	chunkBoundaryBytes    = "bytes"    // anywhere once min_bytes are collected
+	chunkBoundaryWord     = "word"     // after whitespace
+	chunkBoundarySentence = "sentence" // after a sentence end or a line break
+)
+
+// streamChunking how the text chunks of a stream are re-batched
+type streamChunking struct {
+	boundary      string
+	minBytes      int
+	flushInterval time.Duration
+	filter        *outputFilter // applied to the collected text before it is sent
+}
+
+// parseStreamChunking read the chunking header value: a boundary followed by optional
+// min_bytes and flush_interval parameters, the configured values otherwise; nil for an
+// empty value or "off"
+func parseStreamChunking(value string) (*streamChunking, error) {
+	parts := strings.Split(value, ";")
+	boundary := strings.ToLower(strings.TrimSpace(parts[0]))
+	switch boundary {
+	case "", "off":
+		return nil, nil
+	case chunkBoundaryBytes, chunkBoundaryWord, chunkBoundarySentence:
+	default:
+		return nil, fmt.Errorf("unknown chunk boundary %q, expected bytes, word, sentence or off", boundary)
+	}
+
+	chunking := &streamChunking{
+		boundary:      boundary,
+		minBytes:      config.GlobalConfig.API.StreamChunkMinBytes,
+		flushInterval: config.GlobalConfig.API.StreamChunkFlushInterval,
+	}
+	for _, part := range parts[1:] {
+		name, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid chunking parameter %q", strings.TrimSpace(part))
+		}
+		switch strings.TrimSpace(name) {
+		case "min_bytes":
+			minBytes, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil || minBytes < 1 || minBytes > maxChunkMinBytes {
+				return nil, fmt.Errorf("min_bytes must be between 1 and %d", maxChunkMinBytes)
+			}
+			chunking.minBytes = minBytes
+		case "flush_interval":
+			interval, err := time.ParseDuration(strings.TrimSpace(raw))
+			if err != nil || interval <= 0 || interval > maxChunkFlushInterval {
+				return nil, fmt.Errorf("flush_interval must be a duration up to %s", maxChunkFlushInterval)
+			}
+			chunking.flushInterval = interval
+		default:
+			return nil, fmt.Errorf("unknown chunking parameter %q", strings.TrimSpace(name))
+		}
+	}
+	chunking.minBytes = min(max(chunking.minBytes, 1), maxChunkMinBytes)
+	if chunking.flushInterval <= 0 || chunking.flushInterval > maxChunkFlushInterval {
+		chunking.flushInterval = maxChunkFlushInterval
+	}
+	return chunking, nil
+}
+
+// String the effective settings in header form, echoed to the client
+func (c *streamChunking) String() string {
+	return fmt.Sprintf("%s; min_bytes=%d; flush_interval=%s", c.boundary, c.minBytes, c.flushInterval)
+}
+
+// withFilter the chunking of a stream the agent's output filter applies to: text is
+// collected up to sentence ends, so a value is not split across chunks and missed.
+// Without chunking every sentence is sent as soon as it ends.
+func (c *streamChunking) withFilter(filter *outputFilter) *streamChunking {
+	if filter == nil {
+		return c
+	}
+	filtered := &streamChunking{
+		boundary:      chunkBoundarySentence,
+		minBytes:      1,
+		flushInterval: maxChunkFlushInterval,
+		filter:        filter,
+	}
+	if c != nil {
+		filtered.minBytes = c.minBytes
+		filtered.flushInterval = c.flushInterval
+	}
+	return filtered
+}
+
+// chunkBatcher forwards the chunks of a stream, collecting the text of consecutive text
+// chunks into larger chunks that end at the chosen boundary. Collected text is sent once
+// it reaches min_bytes at a boundary, when it is flush_interval old, before any chunk
+// without plain text and when the stream ends. Sent chunks are the last collected chunk
+// with the collected text, so ids and models stay those of the upstream. Without
+// chunking every chunk is forwarded as it is.
+type chunkBatcher struct {
+	mu       sync.Mutex
+	events   *sseWriter
+	chunking *streamChunking
+
+	template map[string]interface{} // last collected chunk
+	pending  strings.Builder
+	timer    *time.Timer
+	err      error // of a timed flush, reported on the next write
+	closed   bool
+}
+
+// newChunkBatcher forward to events, re-batched when chunking is set
+func newChunkBatcher(events *sseWriter, chunking *streamChunking) *chunkBatcher {
+	return &chunkBatcher{events: events, chunking: chunking}
+}
+
+// write forward a decoded chunk, data is its encoded form
+func (b *chunkBatcher) write(payload interface{}, data []byte) error {
+	if b.chunking == nil {
+		return b.events.writeEvent("", data)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+
+	body, text, ok := chunkText(payload)
+	if !ok {
+		if err := b.flushLocked(b.pending.Len()); err != nil {
+			return err
+		}
+		if body, isObject := payload.(map[string]interface{}); isObject && b.chunking.filter != nil && b.chunking.filter.filterStreamChunk(body) {
+			var err error
+			if data, err = json.Marshal(body); err != nil {
+				return err
+			}
+		}
+		return b.events.writeEvent("", data)
+	}
+
+	b.template = body
+	b.pending.WriteString(text)
+	if b.timer == nil && b.pending.Len() > 0 {
+		b.timer = time.AfterFunc(b.chunking.flushInterval, b.flushTimed)
+	}
+	if b.pending.Len() < b.chunking.minBytes {
+		return nil
+	}
+	if cut := chunkBoundary(b.pending.String(), b.chunking.boundary); cut >= b.chunking.minBytes {
+		return b.flushLocked(cut)
+	}
+	return nil
+}
+
+// close send the text still collected; nothing is written after close
+func (b *chunkBatcher) close() error {
+	if b.chunking == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.err != nil {
+		return b.err
+	}
+	return b.flushLocked(b.pending.Len())
+}
+
+// flushTimed send the collected text once it waited flush_interval, boundary or not
+func (b *chunkBatcher) flushTimed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timer = nil
+	if b.closed || b.err != nil {
+		return
+	}
+	b.err = b.flushLocked(b.pending.Len())
+}
+
+// flushLocked send the first n bytes of the collected text as one chunk, keeping the
+// rest for the next one
+func (b *chunkBatcher) flushLocked(n int) error {
+	if n == 0 {
+		return nil
+	}
+	text := b.pending.String()
+	b.pending.Reset()
+	b.pending.WriteString(text[n:])
+	if b.timer != nil && b.pending.Len() == 0 {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	chunk := text[:n]
+	if filter := b.chunking.filter; filter != nil {
+		// text of a blocked answer is withheld for the rest of the stream
+		if filter.withheld {
+			return nil
+		}
+		var annotation *contentAnnotation
+		chunk, annotation = filter.apply(chunkTextField(b.template), chunk)
+		if annotation != nil {
+			filter.withheld = annotation.Action == annotationBlocked
+			b.template[connectorAnnotationsField] = []*contentAnnotation{annotation}
+			defer delete(b.template, connectorAnnotationsField)
+		}
+	}
+
+	setChunkText(b.template, chunk)
+	data, err := json.Marshal(b.template)
+	if err != nil {
+		return err
+	}
+	return b.events.writeEvent("", data)
+}
+
+// chunkText the text of a chunk that only carries text: an OpenAI delta of a single
+// choice with nothing but content, e.g. no role or tool calls, and no finish reason, or
+// a Dify message answer
+func chunkText(payload interface{}) (map[string]interface{}, string, bool) {
+	body, ok := payload.(map[string]interface{})
+	if !ok {
+		return nil, "", false
+	}
+
+	if choices, ok := body["choices"].([]interface{}); ok {
+		if len(choices) != 1 {
+			return nil, "", false
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		delta, _ := choice["delta"].(map[string]interface{})
+		content, ok := delta["content"].(string)
+		if !ok || len(delta) != 1 || choice["finish_reason"] != nil {
+			return nil, "", false
+		}
+		return body, content, true
+	}
+
+	switch body["event"] {
+	case "message", "agent_message":
+		answer, ok := body["answer"].(string)
+		return body, answer, ok
+	}
+	return nil, "", false
+}
+
+// setChunkText replace the text of a chunk chunkText accepted
+func setChunkText(body map[string]interface{}, text string) {
+	if choices, ok := body["choices"].([]interface{}); ok {
+		choice, _ := choices[0].(map[string]interface{})
+		delta, _ := choice["delta"].(map[string]interface{})
+		delta["content"] = text
+		return
+	}
+	body["answer"] = text
+}
+
+// chunkTextField the field of a chunk chunkText accepted holding its text
+func chunkTextField(body map[string]interface{}) string {
+	if _, ok := body["choices"]; ok {
+		return "choices[0].delta.content"
+	}
+	return "answer"
+}
+
+// chunkBoundary the length of the longest prefix of text that ends at a boundary, 0
+// when there is none. A period, question or exclamation mark ends a sentence only when
+// followed by whitespace, so "3.5" is not split; CJK sentence marks and line breaks end
+// one right away.
+func chunkBoundary(text, boundary string) int {
+	switch boundary {
+	case chunkBoundaryBytes:
+		return len(text)
+	case chunkBoundaryWord:
+		for i := len(text); i > 0; {
+			r, size := utf8.DecodeLastRuneInString(text[:i])
+			if unicode.IsSpace(r) {
+				return i
+			}
+			i -= size
+		}
+	case chunkBoundarySentence:
+		for i := len(text); i > 0; {
+			r, size := utf8.DecodeLastRuneInString(text[:i])
+			switch r {
+			case '\n', '。', '！', '？':
+				return i
+			case '.', '!', '?':
+				if next, nextSize := utf8.DecodeRuneInString(text[i:]); i < len(text) && unicode.IsSpace(next) {
+					return i + nextSize
+				}
+			}
+			i -= size
+		}
+	}
+	return 0
+}
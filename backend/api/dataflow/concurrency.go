@@ -0,0 +1,121 @@
+package dataflow
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/config"
+	"agent-connector/pkg/metrics"
+)
+
+// defaultMetricsPeakWindow how far back the peak gauges look when none is configured
+const defaultMetricsPeakWindow = time.Minute
+
+// concurrencyGauges saturation of the agents per agent and endpoint, shared by every
+// handler and middleware instance of the process
+type concurrencyGauges struct {
+	inFlight  *metrics.GaugeVec
+	streaming *metrics.GaugeVec
+	queued    *metrics.GaugeVec
+}
+
+var (
+	concurrencyOnce  sync.Once
+	agentConcurrency *concurrencyGauges
+)
+
+// concurrency the gauges of the process, created on first use so the peak window
+// comes from the loaded config
+func concurrency() *concurrencyGauges {
+	concurrencyOnce.Do(func() {
+		agentConcurrency = newConcurrencyGauges()
+	})
+	return agentConcurrency
+}
+
+// newConcurrencyGauges create the gauges with the configured peak window
+func newConcurrencyGauges() *concurrencyGauges {
+	window := defaultMetricsPeakWindow
+	if cfg := config.GlobalConfig; cfg != nil && cfg.API.MetricsPeakWindow > 0 {
+		window = cfg.API.MetricsPeakWindow
+	}
+	return &concurrencyGauges{
+		inFlight: metrics.NewGaugeVec("agent_connector_requests_in_flight",
+			"Chat requests being processed", window, "agent_id", "endpoint"),
+		streaming: metrics.NewGaugeVec("agent_connector_streams_open",
+			"Streaming responses being forwarded", window, "agent_id", "endpoint"),
+		queued: metrics.NewGaugeVec("agent_connector_queue_slots_held",
+			"Requests holding a slot of their agent's admission queue", window, "agent_id", "endpoint"),
+	}
+}
+
+// trackConcurrency count the request in gauges until the returned function is called
+func trackConcurrency(c *gin.Context, gauges *metrics.GaugeVec, agentID string) func() {
+	gauge := gauges.With(agentID, routePattern(c))
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// ConcurrencyStats current and peak saturation of one agent endpoint
+type ConcurrencyStats struct {
+	AgentID       string `json:"agent_id"`
+	Endpoint      string `json:"endpoint"`
+	InFlight      int64  `json:"in_flight"`
+	Streaming     int64  `json:"streaming"`
+	Queued        int64  `json:"queued"`
+	PeakInFlight  int64  `json:"peak_in_flight"`
+	PeakStreaming int64  `json:"peak_streaming"`
+	PeakQueued    int64  `json:"peak_queued"`
+}
+
+// stats every agent endpoint that saw a request, ordered by agent and endpoint
+func (g *concurrencyGauges) stats() []ConcurrencyStats {
+	var stats []ConcurrencyStats
+	index := make(map[string]int)
+	entry := func(values []string) *ConcurrencyStats {
+		key := strings.Join(values, " ")
+		i, ok := index[key]
+		if !ok {
+			i = len(stats)
+			index[key] = i
+			stats = append(stats, ConcurrencyStats{AgentID: values[0], Endpoint: values[1]})
+		}
+		return &stats[i]
+	}
+
+	g.inFlight.Each(func(values []string, gauge *metrics.Gauge) {
+		s := entry(values)
+		s.InFlight, s.PeakInFlight = gauge.Value(), gauge.Peak()
+	})
+	g.streaming.Each(func(values []string, gauge *metrics.Gauge) {
+		s := entry(values)
+		s.Streaming, s.PeakStreaming = gauge.Value(), gauge.Peak()
+	})
+	g.queued.Each(func(values []string, gauge *metrics.Gauge) {
+		s := entry(values)
+		s.Queued, s.PeakQueued = gauge.Value(), gauge.Peak()
+	})
+	return stats
+}
+
+// HandleMetrics serve the gauges and the upstream latency histograms in the Prometheus
+// text format
+func (h *DataFlowAPIHandler) HandleMetrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", metrics.ContentType)
+	g := concurrency()
+	for _, gauges := range []*metrics.GaugeVec{g.inFlight, g.streaming, g.queued} {
+		if err := gauges.Write(c.Writer); err != nil {
+			return
+		}
+	}
+	for _, histograms := range []*metrics.HistogramVec{upstreamLatency.firstToken, upstreamLatency.total} {
+		if err := histograms.Write(c.Writer); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package dataflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/textlimit"
+)
+
+// connectorWarningHeader carries the warnings of a request, see BackendRequest.Warnings
+const connectorWarningHeader = "X-Connector-Warning"
+
+// errContextOverflow the prompt does not fit into the agent's context window, the same
+// kind an agent reports when it rejects a prompt as too long
+var errContextOverflow = agent.ErrContextLength
+
+const (
+	// messageOverheadTokens tokens a chat message costs beyond its content
+	messageOverheadTokens = 4
+
+	// summaryMaxTokens completion tokens of the summary replacing dropped messages
+	summaryMaxTokens = 256
+)
+
+// summaryPrompt instruction of the summarization request
+const summaryPrompt = "Summarize the following earlier part of a conversation in a few sentences. " +
+	"Keep names, numbers, decisions and open questions. Answer with the summary only."
+
+// estimateMessagesTokens rough token count of chat messages
+func estimateMessagesTokens(messages []backends.ChatMessage) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += textlimit.EstimateTokens(message.Content) + messageOverheadTokens
+	}
+	return tokens
+}
+
+// estimatePromptTokens rough token count of everything the request sends as prompt
+func estimatePromptTokens(req *backends.BackendRequest) int {
+	tokens := estimateMessagesTokens(req.Messages) + textlimit.EstimateTokens(req.Query)
+	for _, inputs := range []map[string]interface{}{req.Inputs, req.Data} {
+		if len(inputs) > 0 {
+			encoded, _ := json.Marshal(inputs)
+			tokens += textlimit.EstimateTokens(string(encoded))
+		}
+	}
+	return tokens
+}
+
+// fitContext apply the agent's context overflow policy to a prompt beyond its context
+// window, noting in the request warnings what was trimmed
+func (s *DataflowService) fitContext(ctx context.Context, req *backends.BackendRequest, backend backends.AgentBackend, agentInfo *backends.AgentInfo) error {
+	if agentInfo.ContextWindow <= 0 {
+		return nil
+	}
+
+	budget := agentInfo.ContextWindow
+	if req.MaxTokens != nil {
+		budget -= *req.MaxTokens
+	}
+	tokens := estimatePromptTokens(req)
+	if tokens <= budget {
+		return nil
+	}
+
+	overflow := fmt.Errorf("%w: prompt of about %d tokens exceeds the %d tokens the context window of agent %s leaves for it",
+		errContextOverflow, tokens, budget, req.AgentID)
+	policy := agentInfo.ContextOverflow
+	if policy == "" || policy == internal.ContextOverflowReject || budget <= 0 || len(req.Messages) == 0 {
+		return overflow
+	}
+
+	// Only message history can be trimmed, everything else must fit as it is
+	fixed := tokens - estimateMessagesTokens(req.Messages)
+	messageBudget := budget - fixed
+
+	if policy == internal.ContextOverflowSummarize {
+		summaryBudget := messageBudget - summaryMaxTokens - messageOverheadTokens
+		if kept, dropped := dropOldestMessages(req.Messages, summaryBudget); kept != nil {
+			summary, err := s.summarizeMessages(ctx, req, backend, agentInfo, dropped)
+			if err == nil {
+				req.Messages = insertSummary(kept, summary)
+				req.Warnings = append(req.Warnings, fmt.Sprintf(
+					"context_summarized: %d oldest messages were replaced by a summary to fit the context window of %d tokens, prompt reduced from about %d to %d tokens",
+					len(dropped), agentInfo.ContextWindow, tokens, estimatePromptTokens(req)))
+				return nil
+			}
+			log.Printf("Summarizing the context of agent %s failed, truncating instead: %v", req.AgentID, err)
+		}
+	}
+
+	kept, dropped := dropOldestMessages(req.Messages, messageBudget)
+	if kept == nil {
+		return overflow
+	}
+	req.Messages = kept
+	req.Warnings = append(req.Warnings, fmt.Sprintf(
+		"context_truncated: %d oldest messages were dropped to fit the context window of %d tokens, prompt reduced from about %d to %d tokens",
+		len(dropped), agentInfo.ContextWindow, tokens, estimatePromptTokens(req)))
+	return nil
+}
+
+// dropOldestMessages drop the oldest messages until the rest fits into budget tokens;
+// system messages and the last message are always kept, nil when they alone do not fit
+func dropOldestMessages(messages []backends.ChatMessage, budget int) (kept, dropped []backends.ChatMessage) {
+	tokens := estimateMessagesTokens(messages)
+	drop := make([]bool, len(messages))
+	for i := 0; i < len(messages)-1 && tokens > budget; i++ {
+		if messages[i].Role == "system" {
+			continue
+		}
+		drop[i] = true
+		tokens -= textlimit.EstimateTokens(messages[i].Content) + messageOverheadTokens
+	}
+	if tokens > budget {
+		return nil, nil
+	}
+
+	for i, message := range messages {
+		if drop[i] {
+			dropped = append(dropped, message)
+		} else {
+			kept = append(kept, message)
+		}
+	}
+	return kept, dropped
+}
+
+// insertSummary add the summary of the dropped messages after the leading system messages
+func insertSummary(messages []backends.ChatMessage, summary string) []backends.ChatMessage {
+	at := 0
+	for at < len(messages) && messages[at].Role == "system" {
+		at++
+	}
+
+	result := make([]backends.ChatMessage, 0, len(messages)+1)
+	result = append(result, messages[:at]...)
+	result = append(result, backends.ChatMessage{Role: "system", Content: "Summary of the earlier conversation: " + summary})
+	return append(result, messages[at:]...)
+}
+
+// summarizeMessages ask the agent for a short summary of the dropped messages; the
+// transcript keeps its most recent part when it is itself too long for the agent. The
+// summary request is rate limited and drawn from the quota pool like the request, and
+// its tokens are billed with it.
+func (s *DataflowService) summarizeMessages(ctx context.Context, req *backends.BackendRequest, backend backends.AgentBackend, agentInfo *backends.AgentInfo, dropped []backends.ChatMessage) (string, error) {
+	var transcript strings.Builder
+	for _, message := range dropped {
+		fmt.Fprintf(&transcript, "%s: %s\n", message.Role, message.Content)
+	}
+	text := transcript.String()
+	budget := agentInfo.ContextWindow - summaryMaxTokens - textlimit.EstimateTokens(summaryPrompt) - 2*messageOverheadTokens
+	if budget <= 0 {
+		return "", errors.New("context window too small for a summary")
+	}
+	text, _ = textlimit.TailTokens(text, budget)
+
+	maxTokens := summaryMaxTokens
+	summaryReq := &backends.BackendRequest{
+		AgentID:           req.AgentID,
+		Model:             req.Model,
+		User:              req.User,
+		AuthenticatedUser: req.AuthenticatedUser,
+		MaxTokens:         &maxTokens,
+		Messages: []backends.ChatMessage{
+			{Role: "system", Content: summaryPrompt},
+			{Role: "user", Content: text},
+		},
+	}
+	if err := s.checkRateLimit(ctx, summaryReq, agentInfo); err != nil {
+		return "", err
+	}
+	if err := admitConnectorCall(ctx, req.AgentID); err != nil {
+		return "", err
+	}
+
+	resp, backend, err := s.execute(ctx, summaryReq, backend, agentInfo)
+	if err != nil {
+		return "", err
+	}
+	response, err := backend.ProcessBlockingResponse(resp)
+	var usage TokenUsage
+	usage.observe(response)
+	req.ConnectorTokens.Prompt += usage.PromptTokens
+	req.ConnectorTokens.Completion += usage.CompletionTokens
+	req.ConnectorTokens.Total += usage.TotalTokens
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(responseText(response))
+	if summary == "" {
+		return "", errors.New("agent returned an empty summary")
+	}
+	return summary, nil
+}
+
+// setWarningHeaders announce the changes made to the request, one header per warning
+func setWarningHeaders(header http.Header, req *backends.BackendRequest) {
+	for _, warning := range req.Warnings {
+		header.Add(connectorWarningHeader, warning)
+	}
+}
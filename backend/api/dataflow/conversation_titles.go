@@ -0,0 +1,175 @@
+package dataflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/textlimit"
+)
+
+// conversationTitles the titles of client sessions
+var conversationTitles = &internal.ConversationTitleService{}
+
+const (
+	// titleTextBytes text of the first exchange the title agent reads, per side
+	titleTextBytes = 2000
+
+	// titleMaxTokens completion tokens of a title
+	titleMaxTokens = 24
+
+	// titleMaxRunes longest title stored
+	titleMaxRunes = 80
+
+	// titleTimeout longest the title agent may take
+	titleTimeout = 30 * time.Second
+
+	// titleUser the user the title agent sees, Dify requires one
+	titleUser = "agent-connector-title"
+
+	// titleUsagePath the path the usage of title requests is recorded under
+	titleUsagePath = "internal:conversation-title"
+)
+
+// titlePrompt instruction of the title request, sent as part of the user message so
+// agents without system messages, e.g. Dify chat apps, follow it too
+const titlePrompt = "Write a short title of at most six words for the conversation below. " +
+	"Use the language of the conversation. Answer with the title only, without quotes or punctuation at the end."
+
+// titlesPending sessions being titled, so concurrent turns do not title a session twice
+var titlesPending sync.Map
+
+// conversationTitler collects the first exchange of a session while it is forwarded,
+// blocking or streamed, and has the configured title agent name the session once the
+// exchange completed. The title is written in the background and never delays the answer.
+type conversationTitler struct {
+	service   *DataflowService
+	apiKey    string
+	sessionID string
+	agentID   string
+	prompt    string
+	answer    strings.Builder
+}
+
+// startConversationTitle a titler of the request's session, nil when titles are disabled,
+// the request names no session or belongs to a privacy mode agent, whose text must not
+// leave the exchange
+func (s *DataflowService) startConversationTitle(req *backends.BackendRequest) *conversationTitler {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.API.TitleAgentID == "" || req.SessionID == "" || req.AgentID == cfg.API.TitleAgentID {
+		return nil
+	}
+	if agent, err := internal.LookupAgentByAgentID(req.AgentID); err != nil || agent.PrivacyMode {
+		return nil
+	}
+
+	prompt := req.Query
+	for i := len(req.Messages) - 1; i >= 0 && prompt == ""; i-- {
+		if req.Messages[i].Role == "user" {
+			prompt = req.Messages[i].Content
+		}
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return nil
+	}
+	prompt, _ = textlimit.TruncateBytes(prompt, titleTextBytes)
+	return &conversationTitler{
+		service:   s,
+		apiKey:    req.APIKey,
+		sessionID: req.SessionID,
+		agentID:   req.AgentID,
+		prompt:    prompt,
+	}
+}
+
+// observe take the text of a decoded response or stream chunk
+func (t *conversationTitler) observe(payload interface{}) {
+	if t == nil || t.answer.Len() >= titleTextBytes {
+		return
+	}
+	t.answer.WriteString(responseText(payload))
+}
+
+// finish title the session in the background when the exchange succeeded and the
+// session has no title yet
+func (t *conversationTitler) finish(err error) {
+	if t == nil || err != nil || strings.TrimSpace(t.answer.String()) == "" {
+		return
+	}
+	key := t.apiKey + "\x00" + t.sessionID
+	if _, pending := titlesPending.LoadOrStore(key, true); pending {
+		return
+	}
+	go func() {
+		defer titlesPending.Delete(key)
+		if err := t.title(); err != nil {
+			log.Printf("Failed to title session %s: %v", t.sessionID, err)
+		}
+	}()
+}
+
+// title ask the title agent for a title of the exchange and store it redacted; the
+// title request is recorded as usage of the title agent
+func (t *conversationTitler) title() error {
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+
+	existing, err := conversationTitles.GetConversationTitle(ctx, t.apiKey, t.sessionID)
+	if err != nil || existing != nil {
+		return err
+	}
+
+	cfg := config.GlobalConfig.API
+	maxTokens := titleMaxTokens
+	answer, _ := textlimit.TruncateBytes(t.answer.String(), titleTextBytes)
+	titleReq := &backends.BackendRequest{
+		AgentID:   cfg.TitleAgentID,
+		Model:     cfg.TitleModel,
+		User:      titleUser,
+		MaxTokens: &maxTokens,
+		Messages: []backends.ChatMessage{
+			{Role: "user", Content: fmt.Sprintf("%s\n\nUser: %s\n\nAssistant: %s", titlePrompt, t.prompt, answer)},
+		},
+	}
+	start := time.Now()
+	response, err := t.service.ProcessRequest(ctx, titleReq)
+	var usage TokenUsage
+	usage.observe(response)
+	recordInternalUsage(cfg.TitleAgentID, titleUsagePath, start, usage, err)
+	if err != nil {
+		return err
+	}
+
+	title := cleanTitle(textRedactor().Redact(responseText(response)))
+	if title == "" {
+		return fmt.Errorf("title agent %s returned an empty title", cfg.TitleAgentID)
+	}
+	return conversationTitles.SaveConversationTitle(ctx, t.apiKey, &internal.ConversationTitle{
+		SessionID:    t.sessionID,
+		AgentID:      t.agentID,
+		Title:        title,
+		TitleAgentID: cfg.TitleAgentID,
+	})
+}
+
+// cleanTitle the first line of the answer without surrounding quotes, a "Title:" label
+// or a final full stop, cut to titleMaxRunes
+func cleanTitle(text string) string {
+	title := strings.TrimSpace(text)
+	if line, _, found := strings.Cut(title, "\n"); found {
+		title = strings.TrimSpace(line)
+	}
+	if label, rest, found := strings.Cut(title, ":"); found && strings.EqualFold(strings.TrimSpace(label), "title") {
+		title = strings.TrimSpace(rest)
+	}
+	title = strings.Trim(title, "\"'`*#“”「」 ")
+	title = strings.TrimRight(title, ".。")
+	title, _ = textlimit.TruncateRunes(title, titleMaxRunes)
+	return strings.TrimSpace(title)
+}
@@ -0,0 +1,185 @@
+package dataflow
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/types"
+)
+
+// conversationMappings the Dify conversations of client sessions
+var conversationMappings = &internal.ConversationMappingService{}
+
+// ConversationsDeletedResponse result of forgetting the conversations of a session
+type ConversationsDeletedResponse struct {
+	SessionID string `json:"session_id"`
+	Deleted   int64  `json:"deleted"`
+}
+
+// SessionConversationsResponse the title of a session and the Dify conversations it continues
+type SessionConversationsResponse struct {
+	SessionID     string                     `json:"session_id"`
+	Title         string                     `json:"title,omitempty"` // empty until the first exchange was titled
+	TitledAt      *time.Time                 `json:"titled_at,omitempty"`
+	Conversations []*SessionConversationItem `json:"conversations"`
+}
+
+// SessionConversationItem the Dify conversation a session continues on an agent
+type SessionConversationItem struct {
+	AgentID        string    `json:"agent_id"`
+	ConversationID string    `json:"conversation_id"`
+	User           string    `json:"user"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// conversationSession one turn of a session's Dify conversation. Dify creates the
+// conversation ID on the first turn, so a chat request with X-Session-ID and no
+// conversation ID is sent with the conversation the session continues, and the ID Dify
+// answers with is remembered for the next turn.
+type conversationSession struct {
+	agentID   string
+	apiKey    string
+	sessionID string
+	user      string
+
+	mapped   string // conversation stored for the session
+	sent     string // conversation sent upstream
+	received string // conversation of the answer
+}
+
+// startConversationSession look up the conversation of the request's session, nil when
+// the request is no Dify chat turn of a session; lookup errors start a new conversation
+func startConversationSession(ctx context.Context, req *backends.BackendRequest, backendType types.AgentType) *conversationSession {
+	if backendType != types.AgentTypeDifyChat || req.SessionID == "" {
+		return nil
+	}
+
+	session := &conversationSession{agentID: req.AgentID, apiKey: req.APIKey, sessionID: req.SessionID, user: req.User}
+	mapped, err := conversationMappings.GetConversationID(ctx, req.AgentID, req.APIKey, req.SessionID, req.User)
+	if err != nil {
+		log.Printf("Failed to load conversation of session %s: %v", req.SessionID, err)
+	}
+	session.mapped = mapped
+
+	// a conversation ID of the client wins and becomes the session's conversation
+	if req.ConversationID == "" {
+		req.ConversationID = mapped
+	}
+	session.sent = req.ConversationID
+	return session
+}
+
+// observe take the conversation ID of a Dify answer or stream event
+func (s *conversationSession) observe(payload interface{}) {
+	if s.received != "" {
+		return
+	}
+	if body, ok := payload.(map[string]interface{}); ok {
+		if conversationID, ok := body["conversation_id"].(string); ok {
+			s.received = conversationID
+		}
+	}
+}
+
+// finish store the conversation the session continues with. A stored conversation Dify
+// no longer knows is forgotten, the next turn starts a new one.
+func (s *conversationSession) finish(ctx context.Context, req *backends.BackendRequest, err error) {
+	if s == nil {
+		return
+	}
+	// the request may have been cancelled, the mapping is still updated
+	ctx = context.WithoutCancel(ctx)
+
+	var agentErr *agent.AgentError
+	if errors.As(err, &agentErr) && agentErr.StatusCode == http.StatusNotFound && s.sent != "" && s.sent == s.mapped {
+		if err := conversationMappings.DeleteConversationMapping(ctx, s.agentID, s.apiKey, s.sessionID); err != nil {
+			log.Printf("Failed to drop conversation of session %s: %v", s.sessionID, err)
+		}
+		return
+	}
+
+	// a hedge agent answered with a conversation of its own, unknown to the agent
+	if req.HedgedTo != "" || s.received == "" || s.received == s.mapped {
+		return
+	}
+	if err := conversationMappings.SaveConversationID(ctx, s.agentID, s.apiKey, s.sessionID, s.user, s.received); err != nil {
+		log.Printf("Failed to store conversation of session %s: %v", s.sessionID, err)
+	}
+}
+
+// HandleGetSessionConversations handle getting the title of a session and the Dify
+// conversations it continues
+func (h *DataFlowAPIHandler) HandleGetSessionConversations(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	sessionID := c.Param("session_id")
+	if !sessionIDPattern.MatchString(sessionID) {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid session ID: letters, digits, _ . : - and at most 128 characters")
+		return
+	}
+
+	ctx := c.Request.Context()
+	title, err := conversationTitles.GetConversationTitle(ctx, authInfo.APIKey, sessionID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	mappings, err := conversationMappings.ListConversationMappings(ctx, authInfo.APIKey, sessionID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	response := SessionConversationsResponse{SessionID: sessionID, Conversations: make([]*SessionConversationItem, len(mappings))}
+	if title != nil {
+		response.Title = title.Title
+		response.TitledAt = &title.CreatedAt
+	}
+	for i, mapping := range mappings {
+		response.Conversations[i] = &SessionConversationItem{
+			AgentID:        mapping.AgentID,
+			ConversationID: mapping.ConversationID,
+			User:           mapping.User,
+			UpdatedAt:      mapping.UpdatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleDeleteSessionConversations handle forgetting the Dify conversations and the title
+// of a session, its next chat turn starts a new conversation
+func (h *DataFlowAPIHandler) HandleDeleteSessionConversations(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	sessionID := c.Param("session_id")
+	if !sessionIDPattern.MatchString(sessionID) {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid session ID: letters, digits, _ . : - and at most 128 characters")
+		return
+	}
+
+	deleted, err := conversationMappings.DeleteConversationMappings(c.Request.Context(), authInfo.APIKey, sessionID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	// the next exchange titles the session again
+	if _, err := conversationTitles.DeleteConversationTitle(c.Request.Context(), authInfo.APIKey, sessionID); err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ConversationsDeletedResponse{SessionID: sessionID, Deleted: deleted})
+}
@@ -0,0 +1,285 @@
+package dataflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request outcomes recorded in events and usage records
+const (
+	outcomeSuccess         = "success"
+	outcomeFailed          = "failed"
+	outcomeClientCancelled = internal.UsageOutcomeClientCancelled
+	outcomeStopped         = "stopped"
+)
+
+// errClientCancelled the client went away before the response was complete
+var errClientCancelled = errors.New("client disconnected")
+
+// requestOutcome classify a finished request; requests whose client went away are
+// client_cancelled rather than failed, requests past their route timeout failed
+func requestOutcome(c *gin.Context, err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, errRouteTimeout) || errors.Is(context.Cause(c.Request.Context()), errRouteTimeout):
+		return outcomeFailed
+	case errors.Is(err, errGenerationStopped):
+		return outcomeStopped
+	case errors.Is(err, errClientCancelled) || c.Request.Context().Err() != nil:
+		return outcomeClientCancelled
+	default:
+		return outcomeFailed
+	}
+}
+
+// emitRequestCompleted publish the outcome of a proxied request
+func emitRequestCompleted(c *gin.Context, req *backends.BackendRequest, start time.Time, err error) {
+	outcome := requestOutcome(c, err)
+	data := map[string]interface{}{
+		"agent_id":    req.AgentID,
+		"path":        routePattern(c),
+		"stream":      req.Stream,
+		"success":     err == nil,
+		"outcome":     outcome,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		data["error"] = textRedactor().Redact(err.Error())
+	}
+	if len(req.Metadata) > 0 {
+		data["metadata"] = req.Metadata
+	}
+	if req.HedgedTo != "" {
+		data["hedged_to"] = req.HedgedTo
+	}
+	if authInfo, authErr := GetAuthInfoFromContext(c); authErr == nil && authInfo.Playground != nil {
+		data["playground_token_id"] = authInfo.Playground.TokenID
+	}
+
+	events.Emit(events.TypeRequestCompleted, req.AgentID, data)
+	if outcome != outcomeClientCancelled {
+		agentErrorRates.observe(req.AgentID, err == nil)
+	}
+}
+
+// emitQuotaExceeded publish a rejected request, limit names the limit that was hit
+func emitQuotaExceeded(agentID, limit string, details map[string]interface{}) {
+	data := map[string]interface{}{
+		"agent_id": agentID,
+		"limit":    limit,
+	}
+	for key, value := range details {
+		data[key] = value
+	}
+
+	events.Emit(events.TypeQuotaExceeded, agentID, data)
+}
+
+// agentHealthTracker remembers the last observed upstream health of each agent,
+// emits agent.health_changed on transitions and agent.unhealthy when an agent
+// stays down longer than the configured delay
+type agentHealthTracker struct {
+	mu             sync.Mutex
+	healthy        map[string]bool
+	unhealthySince map[string]time.Time
+}
+
+// upstreamHealth is shared by every handler instance of the process
+var upstreamHealth = &agentHealthTracker{
+	healthy:        make(map[string]bool),
+	unhealthySince: make(map[string]time.Time),
+}
+
+// observe record the outcome of an upstream call; agents start out healthy,
+// so the first success is not reported
+func (t *agentHealthTracker) observe(agentID string, resp *http.Response, err error) {
+	healthy := err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError
+
+	t.mu.Lock()
+	previous, seen := t.healthy[agentID]
+	t.healthy[agentID] = healthy
+	if !seen {
+		previous = true
+	}
+	var since time.Time
+	if previous != healthy {
+		if healthy {
+			delete(t.unhealthySince, agentID)
+		} else {
+			since = time.Now()
+			t.unhealthySince[agentID] = since
+		}
+	}
+	t.mu.Unlock()
+
+	if previous == healthy {
+		return
+	}
+
+	data := map[string]interface{}{
+		"agent_id": agentID,
+		"healthy":  healthy,
+	}
+	if err != nil {
+		data["reason"] = err.Error()
+	} else if resp != nil {
+		data["status_code"] = resp.StatusCode
+	}
+	events.Emit(events.TypeAgentHealthChanged, agentID, data)
+
+	if !healthy {
+		t.scheduleUnhealthyAlert(agentID, since)
+	}
+}
+
+// scheduleUnhealthyAlert emit agent.unhealthy once the delay passed, unless the
+// agent recovered or went down again in between
+func (t *agentHealthTracker) scheduleUnhealthyAlert(agentID string, since time.Time) {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.Events.UnhealthyAlertAfter <= 0 {
+		return
+	}
+	delay := cfg.Events.UnhealthyAlertAfter
+
+	time.AfterFunc(delay, func() {
+		t.mu.Lock()
+		current, ok := t.unhealthySince[agentID]
+		t.mu.Unlock()
+		if !ok || !current.Equal(since) {
+			return
+		}
+
+		events.Emit(events.TypeAgentUnhealthy, agentID, map[string]interface{}{
+			"agent_id":        agentID,
+			"unhealthy_for":   time.Since(since).Round(time.Second).String(),
+			"unhealthy_since": since.UTC().Format(time.RFC3339),
+		})
+	})
+}
+
+// queueWarningResetRatio usage below which the queue warning of an agent may fire again
+const queueWarningResetRatio = 0.8
+
+// queueUsageMonitor emits quota.warning when an agent queue fills up to the
+// configured share of its limit, once until usage drops again
+type queueUsageMonitor struct {
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+// agentQueueUsage is shared by every middleware instance of the process
+var agentQueueUsage = &queueUsageMonitor{warned: make(map[string]bool)}
+
+// observe check the queue usage after a request was admitted
+func (m *queueUsageMonitor) observe(ctx context.Context, pq queue.PriorityQueue, agentID, queueName string) {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.Events.QuotaWarningRatio <= 0 {
+		return
+	}
+	ratio := cfg.Events.QuotaWarningRatio
+	// skip the extra queue round trips when nobody listens
+	if _, noop := events.Default().(events.NoopPublisher); noop {
+		return
+	}
+
+	options, err := pq.GetQueueOptions(ctx, queueName)
+	if err != nil || options.MaxQueueSize <= 0 {
+		return
+	}
+	size, err := pq.Size(ctx, queueName)
+	if err != nil {
+		return
+	}
+	usage := float64(size) / float64(options.MaxQueueSize)
+
+	m.mu.Lock()
+	warn := false
+	switch {
+	case usage >= ratio && !m.warned[agentID]:
+		m.warned[agentID] = true
+		warn = true
+	case usage < queueWarningResetRatio*ratio:
+		delete(m.warned, agentID)
+	}
+	m.mu.Unlock()
+
+	if warn {
+		events.Emit(events.TypeQuotaWarning, agentID, map[string]interface{}{
+			"agent_id":       agentID,
+			"limit":          "queue",
+			"queue_name":     queueName,
+			"current_size":   size,
+			"max_queue_size": options.MaxQueueSize,
+		})
+	}
+}
+
+const (
+	errorRateWindow      = time.Minute
+	errorRateMinRequests = 20
+	errorRateThreshold   = 0.5
+)
+
+// errorRateWindowStats request counters of one agent in the current window
+type errorRateWindowStats struct {
+	start   time.Time
+	total   int
+	failed  int
+	alerted bool
+}
+
+// errorRateMonitor emits agent.error_rate_high once per window when at least half
+// of an agent's requests failed, ignoring windows with too few requests to judge
+type errorRateMonitor struct {
+	mu     sync.Mutex
+	agents map[string]*errorRateWindowStats
+}
+
+// agentErrorRates is shared by every handler instance of the process
+var agentErrorRates = &errorRateMonitor{agents: make(map[string]*errorRateWindowStats)}
+
+// observe count a finished request
+func (m *errorRateMonitor) observe(agentID string, success bool) {
+	now := time.Now()
+
+	m.mu.Lock()
+	stats, ok := m.agents[agentID]
+	if !ok || now.Sub(stats.start) >= errorRateWindow {
+		stats = &errorRateWindowStats{start: now}
+		m.agents[agentID] = stats
+	}
+	stats.total++
+	if !success {
+		stats.failed++
+	}
+
+	rate := float64(stats.failed) / float64(stats.total)
+	alert := !stats.alerted && stats.total >= errorRateMinRequests && rate >= errorRateThreshold
+	if alert {
+		stats.alerted = true
+	}
+	total, failed := stats.total, stats.failed
+	m.mu.Unlock()
+
+	if alert {
+		events.Emit(events.TypeAgentErrorRateHigh, agentID, map[string]interface{}{
+			"agent_id":       agentID,
+			"error_rate":     rate,
+			"failed":         failed,
+			"total":          total,
+			"window_seconds": int(errorRateWindow.Seconds()),
+		})
+	}
+}
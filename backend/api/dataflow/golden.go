@@ -0,0 +1,118 @@
+package dataflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/textdiff"
+	"agent-connector/pkg/types"
+)
+
+// goldenRunUser the user golden prompts are sent as, so their usage can be told apart upstream
+const goldenRunUser = "agent-connector-golden"
+
+// StartGoldenRun run the enabled golden prompts of the agent in the background and
+// compare the answers to their references; returns the run as it was started, its
+// results are stored when it finishes. Runs bypass hedging, rate limits and usage
+// recording like replays.
+func (s *DataflowService) StartGoldenRun(agentID, trigger string) (*internal.GoldenRun, error) {
+	service := &internal.GoldenPromptService{}
+	run, prompts, err := service.StartGoldenRun(agentID, trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	started := *run
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), internal.GoldenRunTimeout)
+		defer cancel()
+
+		results := s.runGoldenPrompts(ctx, agentID, prompts)
+		if err := service.FinishGoldenRun(run, results); err != nil {
+			log.Printf("Failed to store golden run %d of agent %s: %v", run.ID, agentID, err)
+			return
+		}
+		if run.Regressed > 0 {
+			log.Printf("Golden run %d of agent %s: %d of %d answers regressed", run.ID, agentID, run.Regressed, run.Total)
+		}
+	}()
+	return &started, nil
+}
+
+// runGoldenPrompts send the prompts one after the other and score every answer
+func (s *DataflowService) runGoldenPrompts(ctx context.Context, agentID string, prompts []*internal.GoldenPrompt) []*internal.GoldenResult {
+	results := make([]*internal.GoldenResult, 0, len(prompts))
+
+	agentInfo, err := s.getAgentInfo(agentID)
+	if err == nil && !agentInfo.Enabled {
+		err = fmt.Errorf("agent %s is disabled", agentID)
+	}
+
+	for _, prompt := range prompts {
+		result := &internal.GoldenResult{
+			PromptID:      prompt.ID,
+			PromptName:    prompt.Name,
+			Reference:     prompt.Reference,
+			MinSimilarity: prompt.MinSimilarity,
+		}
+		results = append(results, result)
+		if err != nil {
+			result.Error = goldenError(err)
+			continue
+		}
+
+		req, buildErr := goldenRequest(prompt, agentInfo)
+		if buildErr != nil {
+			result.Error = goldenError(buildErr)
+			continue
+		}
+
+		start := time.Now()
+		response, sendErr := s.sendReplay(ctx, req, agentInfo)
+		result.DurationMs = time.Since(start).Milliseconds()
+		if sendErr != nil {
+			result.Error = goldenError(sendErr)
+			continue
+		}
+
+		// redacted like stored answers, references are compared against what an admin sees
+		result.Response = textRedactor().Redact(responseText(response))
+		result.Similarity = textdiff.Similarity(prompt.Reference, result.Response)
+		result.Passed = result.Similarity >= prompt.MinSimilarity
+	}
+	return results
+}
+
+// goldenRequest the blocking request a golden prompt is sent as for the agent's type
+func goldenRequest(prompt *internal.GoldenPrompt, agentInfo *backends.AgentInfo) (*backends.BackendRequest, error) {
+	req := &backends.BackendRequest{AgentID: prompt.AgentID, User: goldenRunUser}
+
+	switch backends.DetermineAgentType(agentInfo.Type) {
+	case types.AgentTypeDifyChat:
+		req.Query = prompt.Prompt
+		req.ResponseMode = "blocking"
+		if prompt.Inputs != "" {
+			if err := json.Unmarshal([]byte(prompt.Inputs), &req.Inputs); err != nil {
+				return nil, fmt.Errorf("invalid inputs: %w", err)
+			}
+		}
+	case types.AgentTypeDifyWorkflow:
+		req.ResponseMode = "blocking"
+		if err := json.Unmarshal([]byte(prompt.Prompt), &req.Data); err != nil {
+			return nil, fmt.Errorf("invalid workflow inputs: %w", err)
+		}
+	default:
+		req.Messages = []backends.ChatMessage{{Role: "user", Content: prompt.Prompt}}
+	}
+	return req, nil
+}
+
+// goldenError the error of a result, redacted like replay errors
+func goldenError(err error) string {
+	return textRedactor().Redact(err.Error())
+}
@@ -0,0 +1,153 @@
+package dataflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/textlimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxParameterNameLength characters of a parameter name quoted in errors and warnings
+const maxParameterNameLength = 64
+
+// guardrailViolation a request beyond the agent's parameter caps under the reject policy
+type guardrailViolation struct {
+	errorType string
+	message   string
+}
+
+// clearParameter unset a parameter of the backend request, for the parameters the
+// connector forwards; anything else is never sent upstream
+var clearParameter = map[string]func(req *backends.BackendRequest){
+	"model":           func(req *backends.BackendRequest) { req.Model = "" },
+	"max_tokens":      func(req *backends.BackendRequest) { req.MaxTokens = nil },
+	"temperature":     func(req *backends.BackendRequest) { req.Temperature = nil },
+	"user":            func(req *backends.BackendRequest) { req.User = "" },
+	"conversation_id": func(req *backends.BackendRequest) { req.ConversationID = "" },
+}
+
+// bodyParameters the top-level fields of a JSON body bound with ShouldBindBodyWith
+func bodyParameters(c *gin.Context) []string {
+	body, ok := c.Get(gin.BodyBytesKey)
+	if !ok {
+		return nil
+	}
+	raw, _ := body.([]byte)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	return mapKeys(fields)
+}
+
+// mapKeys the sorted keys of a decoded JSON object
+func mapKeys[V any](fields map[string]V) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyGuardrails enforce the agent's parameter caps on the request; sent names the
+// parameters of the client's body. Writes the error response and returns false when
+// the request is rejected.
+func (h *DataFlowAPIHandler) applyGuardrails(c *gin.Context, authInfo *AuthInfo, req *backends.BackendRequest, sent []string) bool {
+	agentInfo := authInfo.Agent
+	if req.AgentID != authInfo.AgentID || agentInfo == nil {
+		agent, err := internal.LookupAgentByAgentID(req.AgentID)
+		if err != nil {
+			// unknown agents are reported when the request is processed
+			return true
+		}
+		agentInfo = newAgentInfo(agent)
+	}
+
+	if violation := enforceGuardrails(agentInfo, req, sent); violation != nil {
+		h.respondWithError(c, http.StatusBadRequest, violation.errorType, violation.message)
+		return false
+	}
+	return true
+}
+
+// enforceGuardrails drop forbidden parameters and lower temperature and max_tokens to
+// the agent's caps, adding a warning for each change; under the reject policy the first
+// violation is returned instead. Chat requests without max_tokens get the cap.
+func enforceGuardrails(agentInfo *AgentInfo, req *backends.BackendRequest, sent []string) *guardrailViolation {
+	reject := agentInfo.GuardrailPolicy == internal.GuardrailPolicyReject
+
+	for _, parameter := range sent {
+		if !forbiddenParameter(agentInfo, parameter) {
+			continue
+		}
+		// the name is echoed in the error or a warning header, clients choose its length
+		name := textlimit.Ellipsize(parameter, maxParameterNameLength)
+		if reject {
+			return &guardrailViolation{
+				errorType: "parameter_not_allowed",
+				message:   fmt.Sprintf("Parameter %s is not allowed for agent %s", name, req.AgentID),
+			}
+		}
+		if clear, ok := clearParameter[strings.ToLower(parameter)]; ok {
+			clear(req)
+		}
+		req.Warnings = append(req.Warnings, fmt.Sprintf("parameter_dropped: %s is not allowed for this agent", name))
+	}
+
+	if agentInfo.MaxTemperature > 0 && req.Temperature != nil && *req.Temperature > agentInfo.MaxTemperature {
+		requested, limit := formatFloat(*req.Temperature), formatFloat(agentInfo.MaxTemperature)
+		if reject {
+			return &guardrailViolation{
+				errorType: "parameter_limit_exceeded",
+				message:   fmt.Sprintf("temperature %s exceeds the limit of %s for agent %s", requested, limit, req.AgentID),
+			}
+		}
+		maxTemperature := agentInfo.MaxTemperature
+		req.Temperature = &maxTemperature
+		req.Warnings = append(req.Warnings, fmt.Sprintf("parameter_clamped: temperature %s lowered to the limit of %s", requested, limit))
+	}
+
+	if agentInfo.MaxTokensCap > 0 {
+		switch {
+		case req.MaxTokens == nil && len(req.Messages) > 0:
+			maxTokens := agentInfo.MaxTokensCap
+			req.MaxTokens = &maxTokens
+		case req.MaxTokens != nil && *req.MaxTokens > agentInfo.MaxTokensCap:
+			if reject {
+				return &guardrailViolation{
+					errorType: "parameter_limit_exceeded",
+					message:   fmt.Sprintf("max_tokens %d exceeds the limit of %d for agent %s", *req.MaxTokens, agentInfo.MaxTokensCap, req.AgentID),
+				}
+			}
+			req.Warnings = append(req.Warnings, fmt.Sprintf("parameter_clamped: max_tokens %d lowered to the limit of %d", *req.MaxTokens, agentInfo.MaxTokensCap))
+			maxTokens := agentInfo.MaxTokensCap
+			req.MaxTokens = &maxTokens
+		}
+	}
+	return nil
+}
+
+// forbiddenParameter whether the agent forbids the parameter, names compare case-insensitively
+func forbiddenParameter(agentInfo *AgentInfo, parameter string) bool {
+	for _, forbidden := range agentInfo.ForbiddenParameters {
+		if strings.EqualFold(forbidden, parameter) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFloat shortest representation of a parameter value
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
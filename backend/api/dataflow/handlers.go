@@ -1,24 +1,39 @@
 package dataflow
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/agent"
 	"agent-connector/pkg/ratelimiter"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // DataFlowAPIHandler new data flow API handler using backend architecture
 type DataFlowAPIHandler struct {
-	service *DataflowService
+	service  *DataflowService
+	streams  *streamLimiter
+	sessions *sessionVariableStore
+
+	// limiters of the middleware, read for the usage report
+	rateLimits *AgentRateLimiterManager
+	admission  *DataFlowMiddleware
 }
 
 // NewDataFlowAPIHandler create new data flow API handler
 func NewDataFlowAPIHandler(rateLimiter *ratelimiter.RedisRateLimiter) *DataFlowAPIHandler {
 	return &DataFlowAPIHandler{
-		service: NewDataflowService(rateLimiter),
+		service:  NewDataflowService(rateLimiter),
+		streams:  newStreamLimiter(),
+		sessions: newSessionVariableStore(),
 	}
 }
 
@@ -31,19 +46,14 @@ func (h *DataFlowAPIHandler) HandleOpenAIChat(c *gin.Context) {
 		return
 	}
 
+	// Enforce the features of the key tier
+	if !h.applyTierFeatures(c, authInfo, bodyFields(c)) {
+		return
+	}
+
 	// Parse OpenAI request
-	var req struct {
-		AgentID  string `json:"agent_id,omitempty"`
-		Model    string `json:"model"`
-		Messages []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"messages"`
-		MaxTokens   *int     `json:"max_tokens,omitempty"`
-		Temperature *float64 `json:"temperature,omitempty"`
-		Stream      bool     `json:"stream,omitempty"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req OpenAIChatRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid request format: "+err.Error())
 		return
 	}
@@ -72,6 +82,32 @@ func (h *DataFlowAPIHandler) HandleOpenAIChat(c *gin.Context) {
 		MaxTokens:   req.MaxTokens,
 		Temperature: req.Temperature,
 		Stream:      req.Stream,
+		User:        req.User,
+
+		AuthenticatedUser: authInfo.User,
+	}
+
+	// Reject oversized payloads before anything is done with them
+	if !h.applyRequestLimits(c, authInfo, backendReq) {
+		return
+	}
+
+	if !h.applyRequestMetadata(c, backendReq, req.Metadata) {
+		return
+	}
+
+	h.applyUserDefaults(c, backendReq)
+
+	h.applySessionVariables(c, backendReq)
+
+	// Enforce playground token limits
+	if !h.applyPlaygroundScope(c, authInfo, backendReq) {
+		return
+	}
+
+	// Enforce the agent's parameter caps
+	if !h.applyGuardrails(c, authInfo, backendReq, bodyParameters(c)) {
+		return
 	}
 
 	// Process request
@@ -91,16 +127,14 @@ func (h *DataFlowAPIHandler) HandleDifyChat(c *gin.Context) {
 		return
 	}
 
+	// Enforce the features of the key tier
+	if !h.applyTierFeatures(c, authInfo, bodyFields(c)) {
+		return
+	}
+
 	// Parse Dify request
-	var req struct {
-		AgentID        string                 `json:"agent_id,omitempty"`
-		Query          string                 `json:"query"`
-		ConversationID string                 `json:"conversation_id,omitempty"`
-		User           string                 `json:"user"`
-		Inputs         map[string]interface{} `json:"inputs,omitempty"`
-		ResponseMode   string                 `json:"response_mode,omitempty"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req DifyChatRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid request format: "+err.Error())
 		return
 	}
@@ -121,6 +155,31 @@ func (h *DataFlowAPIHandler) HandleDifyChat(c *gin.Context) {
 		Inputs:         req.Inputs,
 		ResponseMode:   req.ResponseMode,
 		Stream:         req.ResponseMode == "streaming",
+
+		AuthenticatedUser: authInfo.User,
+	}
+
+	// Reject oversized payloads before anything is done with them
+	if !h.applyRequestLimits(c, authInfo, backendReq) {
+		return
+	}
+
+	if !h.applyRequestMetadata(c, backendReq, req.Metadata) {
+		return
+	}
+
+	h.applyUserDefaults(c, backendReq)
+
+	h.applySessionVariables(c, backendReq)
+
+	// Enforce playground token limits
+	if !h.applyPlaygroundScope(c, authInfo, backendReq) {
+		return
+	}
+
+	// Enforce the agent's parameter caps
+	if !h.applyGuardrails(c, authInfo, backendReq, bodyParameters(c)) {
+		return
 	}
 
 	// Process request
@@ -140,14 +199,14 @@ func (h *DataFlowAPIHandler) HandleDifyWorkflow(c *gin.Context) {
 		return
 	}
 
-	// Parse Dify workflow request
-	var req struct {
-		AgentID      string                 `json:"agent_id,omitempty"`
-		Inputs       map[string]interface{} `json:"inputs"`
-		User         string                 `json:"user"`
-		ResponseMode string                 `json:"response_mode,omitempty"`
+	// Enforce the features of the key tier
+	if !h.applyTierFeatures(c, authInfo, bodyFields(c)) {
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+
+	// Parse Dify workflow request
+	var req DifyWorkflowRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid request format: "+err.Error())
 		return
 	}
@@ -166,6 +225,31 @@ func (h *DataFlowAPIHandler) HandleDifyWorkflow(c *gin.Context) {
 		Data:         req.Inputs,
 		ResponseMode: req.ResponseMode,
 		Stream:       req.ResponseMode == "streaming",
+
+		AuthenticatedUser: authInfo.User,
+	}
+
+	// Reject oversized payloads before anything is done with them
+	if !h.applyRequestLimits(c, authInfo, backendReq) {
+		return
+	}
+
+	if !h.applyRequestMetadata(c, backendReq, req.Metadata) {
+		return
+	}
+
+	h.applyUserDefaults(c, backendReq)
+
+	h.applySessionVariables(c, backendReq)
+
+	// Enforce playground token limits
+	if !h.applyPlaygroundScope(c, authInfo, backendReq) {
+		return
+	}
+
+	// Enforce the agent's parameter caps
+	if !h.applyGuardrails(c, authInfo, backendReq, bodyParameters(c)) {
+		return
 	}
 
 	// Process request
@@ -192,10 +276,17 @@ func (h *DataFlowAPIHandler) HandleChat(c *gin.Context) {
 		return
 	}
 
+	// Enforce the features of the key tier
+	if !h.applyTierFeatures(c, authInfo, legacyReq) {
+		return
+	}
+
 	// Convert legacy request to backend request
 	backendReq := &backends.BackendRequest{
 		AgentID: authInfo.AgentID,
 		APIKey:  authInfo.APIKey,
+
+		AuthenticatedUser: authInfo.User,
 	}
 
 	// Override agent_id if provided in request
@@ -203,13 +294,27 @@ func (h *DataFlowAPIHandler) HandleChat(c *gin.Context) {
 		backendReq.AgentID = agentID
 	}
 
-	// Try to determine the format and convert
-	if messages, ok := legacyReq["messages"]; ok {
+	// Convert by the negotiated format, or the one detected from the fields
+	format, detected, err := legacyChatFormat(c, legacyReq)
+	if err != nil {
+		errorType := "invalid_format"
+		if errors.Is(err, errAmbiguousLegacyFormat) {
+			errorType = "ambiguous_format"
+		}
+		h.respondWithError(c, http.StatusBadRequest, errorType, err.Error())
+		return
+	}
+	if detected {
+		logLegacyDetection(c, authInfo, format)
+	}
+	setLegacyDeprecationHeaders(c.Writer.Header(), format)
+
+	if format == legacyFormatOpenAI {
 		// OpenAI format
 		if model, ok := legacyReq["model"].(string); ok {
 			backendReq.Model = model
 		}
-		if messagesSlice, ok := messages.([]interface{}); ok {
+		if messagesSlice, ok := legacyReq["messages"].([]interface{}); ok {
 			for _, msg := range messagesSlice {
 				if msgMap, ok := msg.(map[string]interface{}); ok {
 					role, _ := msgMap["role"].(string)
@@ -224,9 +329,9 @@ func (h *DataFlowAPIHandler) HandleChat(c *gin.Context) {
 		if stream, ok := legacyReq["stream"].(bool); ok {
 			backendReq.Stream = stream
 		}
-	} else if query, ok := legacyReq["query"].(string); ok {
+	} else {
 		// Dify format
-		backendReq.Query = query
+		backendReq.Query, _ = legacyReq["query"].(string)
 		if user, ok := legacyReq["user"].(string); ok {
 			backendReq.User = user
 		}
@@ -239,6 +344,37 @@ func (h *DataFlowAPIHandler) HandleChat(c *gin.Context) {
 		}
 	}
 
+	// Reject oversized payloads before anything is done with them
+	if !h.applyRequestLimits(c, authInfo, backendReq) {
+		return
+	}
+
+	if rawMetadata, ok := legacyReq["metadata"].(map[string]interface{}); ok {
+		metadata := make(map[string]string, len(rawMetadata))
+		for key, value := range rawMetadata {
+			if text, ok := value.(string); ok {
+				metadata[key] = text
+			}
+		}
+		if !h.applyRequestMetadata(c, backendReq, metadata) {
+			return
+		}
+	}
+
+	h.applyUserDefaults(c, backendReq)
+
+	h.applySessionVariables(c, backendReq)
+
+	// Enforce playground token limits
+	if !h.applyPlaygroundScope(c, authInfo, backendReq) {
+		return
+	}
+
+	// Enforce the agent's parameter caps
+	if !h.applyGuardrails(c, authInfo, backendReq, mapKeys(legacyReq)) {
+		return
+	}
+
 	// Process request
 	if backendReq.Stream || backendReq.ResponseMode == "streaming" {
 		h.handleStreamingRequest(c, backendReq)
@@ -247,45 +383,170 @@ func (h *DataFlowAPIHandler) HandleChat(c *gin.Context) {
 	}
 }
 
+// applyPlaygroundScope pin playground requests to the token's agent and cap max_tokens,
+// writes the error response and returns false when the request is outside the scope
+func (h *DataFlowAPIHandler) applyPlaygroundScope(c *gin.Context, authInfo *AuthInfo, req *backends.BackendRequest) bool {
+	scope := authInfo.Playground
+	if scope == nil {
+		return true
+	}
+
+	if req.AgentID != authInfo.AgentID {
+		h.respondWithError(c, http.StatusForbidden, "playground_scope_violation", "Playground token is not valid for agent "+req.AgentID)
+		return false
+	}
+
+	if scope.MaxTokens > 0 && (req.MaxTokens == nil || *req.MaxTokens > scope.MaxTokens) {
+		maxTokens := scope.MaxTokens
+		req.MaxTokens = &maxTokens
+	}
+
+	return true
+}
+
 // HealthCheck handle health check request
 func (h *DataFlowAPIHandler) HealthCheck(c *gin.Context) {
+	// A Redis or database outage degrades the service but it keeps serving, so it stays 200
+	status := "ok"
+	if redisStatus().Degraded() || internal.DatabaseDown() {
+		status = "degraded"
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "ok",
-		"service":   "dataflow-backend",
-		"timestamp": gin.H{},
+		"status":       status,
+		"service":      "dataflow-backend",
+		"timestamp":    gin.H{},
+		"redis":        redisStatus().status(),
+		"database":     internal.DatabaseStatus(),
+		"usage_writer": internal.CurrentUsageWriterStats(),
+		"lookup_cache": internal.LookupCacheStats(),
+		"agents":       managedAgentMetrics(c.Request.Context()),
+		"providers":    providerHealthReport(),
+		"concurrency":  concurrency().stats(),
 	})
 }
 
 // handleStreamingRequest handle streaming request
 func (h *DataFlowAPIHandler) handleStreamingRequest(c *gin.Context, req *backends.BackendRequest) {
+	chunking, err := parseStreamChunking(c.GetHeader(streamChunkingHeader))
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid "+streamChunkingHeader+" header: "+err.Error())
+		return
+	}
+
+	chunking = chunking.withFilter(requestOutputFilter(c, req))
+
+	recordRouting(c)
+	setRoutingHeaders(c.Request.Context(), c.Writer.Header(), req, "")
+	defer h.trackRequest(c, req)()
+	defer trackConcurrency(c, concurrency().inFlight, req.AgentID)()
+
+	// Hold a stream slot of the caller while the stream is open
+	if h.streams != nil {
+		release, err := h.streams.Acquire(c.Request.Context(), req)
+		var limitErr *StreamLimitError
+		if errors.As(err, &limitErr) {
+			emitQuotaExceeded(req.AgentID, "concurrent_streams", map[string]interface{}{
+				"scope": limitErr.Scope,
+				"limit": limitErr.Limit,
+			})
+			h.respondWithStreamLimit(c, limitErr)
+			return
+		}
+		defer release()
+	}
+	defer trackConcurrency(c, concurrency().streaming, req.AgentID)()
+
 	// Set SSE response headers
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
+	setSSEHeaders(c.Writer.Header())
 	c.Header("Access-Control-Allow-Headers", "Cache-Control")
 
 	// Process streaming request
-	err := h.service.ProcessStreamingRequest(c.Request.Context(), req, c.Writer)
-	if err != nil {
-		h.writeSSEError(c, "processing_error", err.Error())
+	start := time.Now()
+	content := newContentTee()
+	usage, err := h.service.ProcessStreamingRequest(c.Request.Context(), req, c.Writer, content, chunking)
+	usage.addConnectorTokens(req)
+	emitRequestCompleted(c, req, start, err)
+	recordUsage(c, req, start, usage, content, err)
+	chargeQuotaPool(c, usage)
+	if errors.Is(err, errGenerationStopped) {
+		tracked := trackedRequest(c.Request.Context())
+		writeGenerationStopped(c.Writer, tracked.id, tracked.generated.Load())
+		return
+	}
+	if err != nil && requestOutcome(c, err) != outcomeClientCancelled {
+		statusCode, errorType := processingErrorStatus(err)
+		if !c.Writer.Written() {
+			c.Status(statusCode)
+		}
+		h.writeSSEError(c, errorType, err.Error())
 		return
 	}
 }
 
 // handleBlockingRequest handle blocking request
 func (h *DataFlowAPIHandler) handleBlockingRequest(c *gin.Context, req *backends.BackendRequest) {
+	recordRouting(c)
+	defer h.trackRequest(c, req)()
+	defer trackConcurrency(c, concurrency().inFlight, req.AgentID)()
+
 	// Process request
+	start := time.Now()
 	response, err := h.service.ProcessRequest(c.Request.Context(), req)
+	if err != nil && errors.Is(context.Cause(c.Request.Context()), errGenerationStopped) {
+		err = fmt.Errorf("%w: %v", errGenerationStopped, err)
+	}
+	emitRequestCompleted(c, req, start, err)
+
+	var usage TokenUsage
+	usage.observe(response)
+	usage.addConnectorTokens(req)
+	content := newContentTee()
+	content.observe(response)
+	recordUsage(c, req, start, usage, content, err)
+	chargeQuotaPool(c, usage)
+	setRoutingHeaders(c.Request.Context(), c.Writer.Header(), req, responseModel(response))
 	if err != nil {
-		h.respondWithError(c, http.StatusInternalServerError, "processing_error", err.Error())
+		statusCode, errorType := processingErrorStatus(err)
+		h.respondWithError(c, statusCode, errorType, err.Error())
 		return
 	}
 
-	// Return response
+	// Filter the answer recorded as the agent sent it, the annotations tell the client what changed
+	var annotations []*contentAnnotation
+	body, isObject := response.(map[string]interface{})
+	if filter := requestOutputFilter(c, req); filter != nil && isObject {
+		annotations = filter.filterBody(body)
+	}
+
+	// Return response, with the warnings and annotations in the body metadata when it is a JSON object
+	if req.HedgedTo != "" {
+		c.Header(hedgedAgentHeader, req.HedgedTo)
+	}
+	setWarningHeaders(c.Writer.Header(), req)
+	if isObject && len(req.Warnings) > 0 {
+		body["connector_warnings"] = req.Warnings
+	}
+	if len(annotations) > 0 {
+		body[connectorAnnotationsField] = annotations
+	}
 	c.JSON(http.StatusOK, response)
 }
 
+// processingErrorStatus the status and error type of a failed request: agent errors
+// get the stable status and code of their kind, anything else is a processing error
+func processingErrorStatus(err error) (int, string) {
+	if errors.Is(err, errGenerationStopped) {
+		return http.StatusConflict, "generation_stopped"
+	}
+	if errors.Is(err, errUserRateLimited) {
+		return http.StatusTooManyRequests, "rate_limit_exceeded"
+	}
+	if statusCode := agent.HTTPStatus(err); statusCode != 0 {
+		return statusCode, agent.ErrorCode(err)
+	}
+	return http.StatusInternalServerError, "processing_error"
+}
+
 // writeSSEError write SSE error
 func (h *DataFlowAPIHandler) writeSSEError(c *gin.Context, errorType, message string) {
 	errorData := map[string]interface{}{
@@ -296,8 +557,9 @@ func (h *DataFlowAPIHandler) writeSSEError(c *gin.Context, errorType, message st
 	}
 
 	jsonData, _ := json.Marshal(errorData)
-	c.Writer.Write([]byte("data: " + string(jsonData) + "\n\n"))
-	c.Writer.Flush()
+	if events, err := newSSEWriter(c.Writer); err == nil {
+		events.writeEvent("", jsonData)
+	}
 }
 
 // respondWithError respond with error
@@ -0,0 +1,257 @@
+package dataflow
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/recorder"
+)
+
+// hedgedAgentHeader names the hedge agent that answered instead of the requested agent
+const hedgedAgentHeader = "X-Hedged-Agent"
+
+// upstreamCall an in-flight request to one agent
+type upstreamCall struct {
+	agentID string
+	backend backends.AgentBackend
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+}
+
+// hedgedBody response body that reads through the first-byte buffer and cancels
+// the call's context once closed
+type hedgedBody struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+// Close close the upstream body and release the call's context
+func (b *hedgedBody) Close() error {
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
+
+// execute send the request to the agent; when the agent has a hedge agent and no
+// first byte arrives within its hedge delay, the request is also sent to the hedge
+// agent and the first response wins, returning the backend that must decode it
+func (s *DataflowService) execute(ctx context.Context, req *backends.BackendRequest, backend backends.AgentBackend, agentInfo *backends.AgentInfo) (*http.Response, backends.AgentBackend, error) {
+	if agentInfo.HedgeAgentID == "" || agentInfo.HedgeAfterMs <= 0 {
+		httpReq, err := backend.BuildForwardRequest(ctx, req, agentInfo)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to build forward request: %w", err)
+		}
+		setMetadataHeaders(httpReq, req)
+		if err := checkForwardHeaders(httpReq); err != nil {
+			return nil, nil, fmt.Errorf("failed to build forward request: %w", err)
+		}
+		httpReq = withRecordMode(httpReq, req.AgentID, agentInfo)
+
+		start := time.Now()
+		resp, err := s.httpClient.Do(httpReq)
+		if ctx.Err() == nil {
+			upstreamHealth.observe(req.AgentID, resp, err)
+			observeManagedCall(req.AgentID, resp, time.Since(start), err)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to execute request: %w", agent.TransportError(err))
+		}
+		return resp, backend, nil
+	}
+
+	results := make(chan *upstreamCall, 2)
+	primary, err := s.startCall(ctx, req, backend, agentInfo, results)
+	if err != nil {
+		return nil, nil, err
+	}
+	pending := []*upstreamCall{primary}
+
+	// an agent the health checks found down, or lowered for an incident of its
+	// provider, is hedged right away
+	hedgeAfter := time.Duration(agentInfo.HedgeAfterMs) * time.Millisecond
+	if managedAgentDown(req.AgentID) || managedAgentDeprioritized(req.AgentID) {
+		hedgeAfter = 0
+	}
+	timer := time.NewTimer(hedgeAfter)
+	defer timer.Stop()
+
+	hedged := false
+	var firstErr error
+	for {
+		select {
+		case call := <-results:
+			pending = removeCall(pending, call)
+			if call.err == nil {
+				for _, loser := range pending {
+					loser.cancel()
+				}
+				go discardCalls(results, len(pending))
+				if call != primary {
+					req.HedgedTo = call.agentID
+				}
+				return call.resp, call.backend, nil
+			}
+
+			call.cancel()
+			if firstErr == nil {
+				firstErr = call.err
+			}
+			// the other agent would reject the request as well, no need to wait for it
+			if rejectsRequest(call.err) {
+				for _, loser := range pending {
+					loser.cancel()
+				}
+				go discardCalls(results, len(pending))
+				return nil, nil, fmt.Errorf("failed to execute request: %w", call.err)
+			}
+			if len(pending) == 0 {
+				return nil, nil, fmt.Errorf("failed to execute request: %w", firstErr)
+			}
+		case <-timer.C:
+			if hedged {
+				continue
+			}
+			hedged = true
+			if call := s.startHedge(ctx, req, agentInfo, results); call != nil {
+				pending = append(pending, call)
+			}
+		}
+	}
+}
+
+// startHedge send a copy of the request to the hedge agent, nil when the hedge agent
+// cannot take it
+func (s *DataflowService) startHedge(ctx context.Context, req *backends.BackendRequest, agentInfo *backends.AgentInfo, results chan<- *upstreamCall) *upstreamCall {
+	hedgeInfo, err := s.getAgentInfo(agentInfo.HedgeAgentID)
+	if err != nil {
+		log.Printf("Skipping hedge of agent %s: %v", req.AgentID, err)
+		return nil
+	}
+	if !hedgeInfo.Enabled || (req.Stream && !hedgeInfo.SupportStreaming) {
+		return nil
+	}
+
+	backend, err := s.factory.CreateBackend(backends.DetermineAgentType(hedgeInfo.Type))
+	if err != nil {
+		log.Printf("Skipping hedge of agent %s: %v", req.AgentID, err)
+		return nil
+	}
+
+	hedgeReq := *req
+	hedgeReq.AgentID = agentInfo.HedgeAgentID
+	if err := backend.ValidateRequest(&hedgeReq); err != nil {
+		log.Printf("Skipping hedge of agent %s: %v", req.AgentID, err)
+		return nil
+	}
+	if err := s.checkRateLimit(ctx, &hedgeReq, hedgeInfo); err != nil {
+		return nil
+	}
+
+	call, err := s.startCall(ctx, &hedgeReq, backend, hedgeInfo, results)
+	if err != nil {
+		log.Printf("Skipping hedge of agent %s: %v", req.AgentID, err)
+		return nil
+	}
+	return call
+}
+
+// startCall send the request in the background and deliver the call to results
+// once the first byte of the response body arrived or the request failed; an error
+// response counts as a failed call, so a hedge call can still win the race
+func (s *DataflowService) startCall(ctx context.Context, req *backends.BackendRequest, backend backends.AgentBackend, agentInfo *backends.AgentInfo, results chan<- *upstreamCall) (*upstreamCall, error) {
+	callCtx, cancel := context.WithCancel(ctx)
+	httpReq, err := backend.BuildForwardRequest(callCtx, req, agentInfo)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to build forward request: %w", err)
+	}
+	setMetadataHeaders(httpReq, req)
+	if err := checkForwardHeaders(httpReq); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to build forward request: %w", err)
+	}
+	httpReq = withRecordMode(httpReq, req.AgentID, agentInfo)
+
+	call := &upstreamCall{agentID: req.AgentID, backend: backend, cancel: cancel}
+	go func() {
+		start := time.Now()
+		resp, err := s.httpClient.Do(httpReq)
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			// the health trackers read the status only, the body goes into the error
+			if callCtx.Err() == nil {
+				upstreamHealth.observe(call.agentID, resp, nil)
+				observeManagedCall(call.agentID, resp, time.Since(start), nil)
+			}
+			call.err = backends.UpstreamError(resp)
+			results <- call
+			return
+		}
+		if err != nil {
+			err = agent.TransportError(err)
+		} else {
+			buffered := bufio.NewReader(resp.Body)
+			if _, peekErr := buffered.Peek(1); peekErr != nil && !errors.Is(peekErr, io.EOF) {
+				resp.Body.Close()
+				resp, err = nil, peekErr
+			} else {
+				resp.Body = &hedgedBody{Reader: buffered, body: resp.Body, cancel: cancel}
+			}
+		}
+
+		// A call cancelled because the other agent won or the client went away says
+		// nothing about the agent's health
+		if callCtx.Err() == nil {
+			upstreamHealth.observe(call.agentID, resp, err)
+			observeManagedCall(call.agentID, resp, time.Since(start), err)
+		}
+		call.resp, call.err = resp, err
+		results <- call
+	}()
+	return call, nil
+}
+
+// rejectsRequest whether the upstream turned down the request itself, an error any
+// other agent would answer with too
+func rejectsRequest(err error) bool {
+	return errors.Is(err, agent.ErrInvalidRequest) || errors.Is(err, agent.ErrContextLength)
+}
+
+// withRecordMode route the request through the fixtures of the agent when it
+// records or replays its upstream traffic
+func withRecordMode(httpReq *http.Request, agentID string, agentInfo *backends.AgentInfo) *http.Request {
+	if agentInfo.RecordMode == "" {
+		return httpReq
+	}
+	return httpReq.WithContext(recorder.WithSession(httpReq.Context(), agentID, recorder.Mode(agentInfo.RecordMode)))
+}
+
+// removeCall drop the finished call from the pending calls
+func removeCall(pending []*upstreamCall, call *upstreamCall) []*upstreamCall {
+	remaining := pending[:0]
+	for _, p := range pending {
+		if p != call {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
+
+// discardCalls close the responses of the calls that lost the race
+func discardCalls(results <-chan *upstreamCall, count int) {
+	for i := 0; i < count; i++ {
+		call := <-results
+		if call.resp != nil {
+			call.resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package dataflow
+
+import (
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/pkg/metrics"
+)
+
+// upstreamLatency latency of successful upstream requests by provider and model,
+// shared by every service instance of the process
+var upstreamLatency = struct {
+	firstToken *metrics.HistogramVec
+	total      *metrics.HistogramVec
+}{
+	firstToken: metrics.NewHistogramVec("agent_connector_upstream_time_to_first_token_seconds",
+		"Time from sending a streaming request upstream to the first content chunk", metrics.LatencyBuckets, "provider", "model"),
+	total: metrics.NewHistogramVec("agent_connector_upstream_duration_seconds",
+		"Time from sending a request upstream to the end of its response", metrics.LatencyBuckets, "provider", "model"),
+}
+
+// upstreamLabels the provider and model of a request: the type of the agent that
+// answered, which is the hedge agent for hedged requests, and the requested model
+func (s *DataflowService) upstreamLabels(req *backends.BackendRequest, agentInfo *backends.AgentInfo) (string, string) {
+	provider := agentInfo.Type
+	if req.HedgedTo != "" {
+		if hedgeInfo, err := s.getAgentInfo(req.HedgedTo); err == nil {
+			provider = hedgeInfo.Type
+		}
+	}
+	model := req.Model
+	if model == "" {
+		model = "default"
+	}
+	return provider, model
+}
+
+// observeUpstreamLatency record a successful upstream request sent at start; a zero
+// firstToken is not recorded, blocking requests and streams without content have none
+func (s *DataflowService) observeUpstreamLatency(req *backends.BackendRequest, agentInfo *backends.AgentInfo, start, firstToken time.Time) {
+	provider, model := s.upstreamLabels(req, agentInfo)
+	if !firstToken.IsZero() {
+		upstreamLatency.firstToken.With(provider, model).Observe(firstToken.Sub(start).Seconds())
+	}
+	upstreamLatency.total.With(provider, model).Observe(time.Since(start).Seconds())
+}
+
+// firstTokenTimer chunkObserver noting when the first chunk with content arrived
+type firstTokenTimer struct {
+	at time.Time
+}
+
+// observe note the time of the first chunk that carries text
+func (t *firstTokenTimer) observe(payload interface{}) {
+	if t.at.IsZero() && responseText(payload) != "" {
+		t.at = time.Now()
+	}
+}
@@ -0,0 +1,146 @@
+package dataflow
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/config"
+	"agent-connector/pkg/ttlcache"
+)
+
+const (
+	legacyFormatOpenAI = "openai"
+	legacyFormatDify   = "dify"
+)
+
+// legacyChatSuccessors the dedicated endpoint replacing /api/v1/chat for each format
+var legacyChatSuccessors = map[string]string{
+	legacyFormatOpenAI: "/api/v1/openai/chat/completions",
+	legacyFormatDify:   "/api/v1/dify/chat-messages",
+}
+
+var (
+	// errUnknownLegacyFormat the client asked for a format the legacy endpoint does not speak
+	errUnknownLegacyFormat = errors.New("unknown format, expected openai or dify")
+
+	// errAmbiguousLegacyFormat the payload has the fields of both formats or of neither
+	errAmbiguousLegacyFormat = errors.New("cannot tell the request format: send either messages (openai) or query (dify), or set the format query parameter")
+)
+
+// legacyDetectionLog clients already logged for relying on format detection, so
+// each is logged once an hour
+var legacyDetectionLog = ttlcache.New[string, bool](time.Hour, 10000)
+
+// legacyChatFormat the format of a legacy chat payload: the format query parameter,
+// then the profile of the Accept header, then detection from the fields. Detection
+// falls back to openai for ambiguous payloads, strict mode rejects them.
+func legacyChatFormat(c *gin.Context, body map[string]interface{}) (format string, detected bool, err error) {
+	if format, ok, err := negotiatedLegacyFormat(c); ok || err != nil {
+		return format, false, err
+	}
+
+	_, hasMessages := body["messages"]
+	query, _ := body["query"].(string)
+	hasQuery := query != ""
+	switch {
+	case hasMessages && !hasQuery:
+		return legacyFormatOpenAI, true, nil
+	case hasQuery && !hasMessages:
+		return legacyFormatDify, true, nil
+	}
+
+	if config.GlobalConfig != nil && config.GlobalConfig.API.LegacyChatStrict {
+		return "", true, errAmbiguousLegacyFormat
+	}
+	return legacyFormatOpenAI, true, nil
+}
+
+// negotiatedLegacyFormat the format the client asked for, ok is false when it did not
+func negotiatedLegacyFormat(c *gin.Context) (string, bool, error) {
+	if format := strings.ToLower(strings.TrimSpace(c.Query("format"))); format != "" {
+		if _, known := legacyChatSuccessors[format]; !known {
+			return "", true, fmt.Errorf("%w: format=%s", errUnknownLegacyFormat, format)
+		}
+		return format, true, nil
+	}
+
+	// Accept: application/json; profile="openai", the profile may also be a URI ending in the format
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || params["profile"] == "" {
+			continue
+		}
+		format := strings.ToLower(path.Base(strings.TrimRight(params["profile"], "/")))
+		if _, known := legacyChatSuccessors[format]; !known {
+			return "", true, fmt.Errorf("%w: profile %s", errUnknownLegacyFormat, params["profile"])
+		}
+		return format, true, nil
+	}
+	return "", false, nil
+}
+
+// logLegacyDetection note a client whose legacy requests only work through format
+// detection, so it can be asked to migrate before the sunset
+func logLegacyDetection(c *gin.Context, authInfo *AuthInfo, format string) {
+	client := authInfo.AgentID + " " + c.ClientIP() + " " + c.Request.UserAgent()
+	if _, logged := legacyDetectionLog.Get(client); logged {
+		return
+	}
+	legacyDetectionLog.Set(client, true)
+	log.Printf("Legacy /api/v1/chat format detected as %s for agent %s, client %s, user agent %q; it should move to %s",
+		format, authInfo.AgentID, c.ClientIP(), c.Request.UserAgent(), legacyChatSuccessors[format])
+}
+
+// setLegacyDeprecationHeaders announce the deprecation, the sunset date when one is
+// configured and the endpoint to use instead
+func setLegacyDeprecationHeaders(header http.Header, format string) {
+	header.Set("Deprecation", "true")
+	if config.GlobalConfig != nil {
+		if sunset, err := config.GlobalConfig.API.LegacyChatSunsetTime(); err == nil && !sunset.IsZero() {
+			header.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+	if successor, ok := legacyChatSuccessors[format]; ok {
+		header.Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+	}
+}
+
+// LegacySunsetMiddleware answers 410 with migration hints once the configured
+// sunset of the legacy chat endpoint has passed
+func (m *DataFlowMiddleware) LegacySunsetMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.GlobalConfig == nil {
+			c.Next()
+			return
+		}
+		sunset, err := config.GlobalConfig.API.LegacyChatSunsetTime()
+		if err != nil || sunset.IsZero() || time.Now().Before(sunset) {
+			c.Next()
+			return
+		}
+
+		c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		response := DataFlowResponse{
+			Code:    http.StatusGone,
+			Message: "Endpoint retired",
+			Error: &APIError{
+				Type:    "endpoint_sunset",
+				Code:    "410",
+				Message: "POST /api/v1/chat was retired, send OpenAI requests to " + legacyChatSuccessors[legacyFormatOpenAI] + " and Dify requests to " + legacyChatSuccessors[legacyFormatDify],
+				Details: gin.H{
+					"sunset":    sunset,
+					"migration": legacyChatSuccessors,
+				},
+			},
+		}
+		c.AbortWithStatusJSON(http.StatusGone, response)
+	}
+}
@@ -1,15 +1,25 @@
 package dataflow
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/queue"
 	"agent-connector/pkg/ratelimiter"
+	"agent-connector/pkg/requestsign"
 )
 
 // AgentRateLimiterManager manages rate limiters for different agents
@@ -55,7 +65,8 @@ func (m *AgentRateLimiterManager) GetOrCreateLimiter(agentID string, qps int) (r
 		},
 	}
 
-	newLimiter, err := ratelimiter.NewRateLimiter(ratelimiter.RedisType, config)
+	// Not checking the connection, while Redis is down requests are limited locally
+	newLimiter, err := ratelimiter.OpenRedisRateLimiter(config)
 	if err != nil {
 		return nil, err
 	}
@@ -85,17 +96,64 @@ func (m *AgentRateLimiterManager) Close() error {
 	return nil
 }
 
+// newAdmissionQueue creates the priority queue used to bound pending requests per agent,
+// returns nil when Redis is not reachable, see queue()
+func newAdmissionQueue() queue.PriorityQueue {
+	redisAddr := config.GlobalConfig.Redis.Addr
+	if redisAddr == "" {
+		redisAddr = "localhost:6379" // fallback default
+	}
+
+	queueConfig := queue.DefaultQueueConfig()
+	queueConfig.Redis = queue.DefaultRedisQueueConfig(redisAddr)
+	queueConfig.Redis.Password = config.GlobalConfig.Redis.Password
+	queueConfig.Redis.DB = config.GlobalConfig.Redis.DB
+
+	priorityQueue, err := queue.NewPriorityQueue(queue.RedisType, queueConfig)
+	if err != nil {
+		log.Printf("Queue admission disabled: %v", err)
+		return nil
+	}
+	return priorityQueue
+}
+
+// queue the admission queue, nil while Redis is unreachable so requests are admitted
+// without queueing; a queue that could not be created before is created once Redis is back
+func (m *DataFlowMiddleware) queue() queue.PriorityQueue {
+	if m == nil || redisStatus().Degraded() {
+		return nil
+	}
+
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	if m.admissionQueue == nil && time.Now().After(m.queueRetryAt) {
+		m.admissionQueue = newAdmissionQueue()
+		m.queueRetryAt = time.Now().Add(redisStatus().interval)
+	}
+	return m.admissionQueue
+}
+
 // DataFlowMiddleware contains middleware dependencies
 type DataFlowMiddleware struct {
 	authService        *DataFlowAuthService
 	rateLimiterManager *AgentRateLimiterManager
+	admissionQueue     queue.PriorityQueue // see queue()
+	queueMu            sync.Mutex
+	queueRetryAt       time.Time
+	maintenance        *internal.MaintenanceChecker
+	signatures         *requestsign.Verifier
+	replayGuard        *signatureReplayGuard
 }
 
 // NewDataFlowMiddleware creates a new middleware instance
 func NewDataFlowMiddleware() *DataFlowMiddleware {
+	signatures, replayGuard := newSignatureVerifier()
 	return &DataFlowMiddleware{
 		authService:        NewDataFlowAuthService(),
 		rateLimiterManager: NewAgentRateLimiterManager(),
+		maintenance:        internal.NewMaintenanceChecker(),
+		signatures:         signatures,
+		replayGuard:        replayGuard,
 	}
 }
 
@@ -103,10 +161,7 @@ func NewDataFlowMiddleware() *DataFlowMiddleware {
 func (m *DataFlowMiddleware) AuthenticationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// get AgentID from URL parameters or JSON body
-		agentID := c.Param("agent_id")
-		if agentID == "" {
-			agentID = c.Query("agent_id")
-		}
+		agentID := requestedAgent(c)
 
 		// get API Key from header
 		apiKey := c.GetHeader("Authorization")
@@ -114,20 +169,82 @@ func (m *DataFlowMiddleware) AuthenticationMiddleware() gin.HandlerFunc {
 			apiKey = c.GetHeader("X-API-Key")
 		}
 
-		// authenticate request
-		authInfo, err := m.authService.AuthenticateRequest(agentID, apiKey)
+		// the platform user behind the request, only known from its session token
+		user, role, err := authenticatedUser(c)
 		if err != nil {
 			m.respondWithError(c, http.StatusUnauthorized, "authentication_failed", err.Error())
 			c.Abort()
 			return
 		}
 
+		// authenticate request, one naming no agent goes to the default agent of its
+		// authenticated user or else to the agent of the key
+		var authInfo *AuthInfo
+		var defaultAgentID string
+		if agentID == "" {
+			defaultAgentID = userDefaultAgent(user)
+		}
+		if defaultAgentID != "" {
+			authInfo, err = m.authService.AuthenticateDefaultAgent(apiKey, user, role, defaultAgentID)
+			if errors.Is(err, errDefaultAgentNotBound) {
+				log.Printf("Default agent %s of user %s is not bound to the key, using the key's agent", defaultAgentID, user)
+				defaultAgentID = ""
+				authInfo, err = m.authService.AuthenticateRequest("", apiKey)
+			}
+		} else {
+			authInfo, err = m.authService.AuthenticateRequest(agentID, apiKey)
+		}
+		if err != nil {
+			m.respondWithError(c, http.StatusUnauthorized, "authentication_failed", err.Error())
+			c.Abort()
+			return
+		}
+		authInfo.User = user
+		authInfo.UserRole = role
+
+		// the key is valid, the agent's access list decides whether its caller may use it
+		if !callerAllowed(authInfo) {
+			m.respondWithError(c, http.StatusForbidden, "access_denied", "The user or API key is not allowed to call this agent")
+			c.Abort()
+			return
+		}
+
+		// remember how the agent was chosen, for the routing headers
+		switch {
+		case authInfo.Playground != nil || (agentID == "" && defaultAgentID == ""):
+			authInfo.Route = routeAPIKey
+		case defaultAgentID != "":
+			authInfo.Route = routeUserDefault
+		default:
+			authInfo.Route = routeAgentID
+		}
+
 		// store auth info in context for later use
 		c.Set("authInfo", authInfo)
 		c.Next()
 	}
 }
 
+// MaintenanceMiddleware rejects requests to agents under scheduled maintenance
+func (m *DataFlowMiddleware) MaintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authInfo, err := GetAuthInfoFromContext(c)
+		if err != nil {
+			m.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			c.Abort()
+			return
+		}
+
+		if window := m.maintenance.Active(authInfo.AgentID); window != nil {
+			m.respondWithMaintenance(c, window)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // RateLimitMiddleware handles rate limiting for dataflow API
 func (m *DataFlowMiddleware) RateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -146,35 +263,256 @@ func (m *DataFlowMiddleware) RateLimitMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// agent-level rate limiting
+		// agent-level rate limiting, the mode comes from the live system config
+		mode := internal.CurrentSystemConfig().RateLimitMode
 		if m.rateLimiterManager != nil {
-			agentLimiter, err := m.rateLimiterManager.GetOrCreateLimiter(authInfo.AgentID, authInfo.Agent.QPS)
-			if err != nil {
-				m.respondWithError(c, http.StatusInternalServerError, "rate_limit_error", "Failed to get agent rate limiter: "+err.Error())
+			if mode != internal.RateLimitModeOff && !m.allowAgentRequest(c, authInfo, mode) {
 				c.Abort()
 				return
 			}
 
-			// Check rate limit
-			agentKey := fmt.Sprintf("agent:%s", authInfo.AgentID)
-			allowed, err := agentLimiter.Allow(c.Request.Context(), agentKey)
-			if err != nil {
-				m.respondWithError(c, http.StatusInternalServerError, "rate_limit_error", "Rate limit check failed: "+err.Error())
-				c.Abort()
-				return
+			// playground tokens have their own, tighter limit on top of the agent limit
+			if authInfo.Playground != nil {
+				if !m.allowPlaygroundRequest(c, authInfo.AgentID, authInfo.Playground) {
+					c.Abort()
+					return
+				}
 			}
+		}
+
+		// the key's share of its team quota, on top of the rate limits
+		if !m.allowPoolRequest(c, authInfo) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allowAgentRequest check the agent's QPS limit, writes the error response when denied;
+// in monitor mode requests over the limit are logged and let through
+func (m *DataFlowMiddleware) allowAgentRequest(c *gin.Context, authInfo *AuthInfo, mode string) bool {
+	agentLimiter, err := m.rateLimiterManager.GetOrCreateLimiter(authInfo.AgentID, authInfo.Agent.QPS)
+	if err != nil {
+		m.respondWithError(c, http.StatusInternalServerError, "rate_limit_error", "Failed to get agent rate limiter: "+err.Error())
+		return false
+	}
+
+	// with sharing on, each active user gets a part of the QPS by priority; while Redis
+	// is down the agent falls back to one local bucket
+	health := redisStatus()
+	if shared, ok := agentLimiter.(ratelimiter.WeightedRateLimiter); ok && authInfo.Agent.QPSSharing && !health.Degraded() {
+		return m.allowSharedAgentRequest(c, authInfo, shared, mode)
+	}
+
+	// Check rate limit
+	agentKey := fmt.Sprintf("agent:%s", authInfo.AgentID)
+	allowed := false
+	if health.Degraded() {
+		allowed = health.allowLocal(agentKey, authInfo.Agent.QPS)
+	} else if allowed, err = agentLimiter.Allow(c.Request.Context(), agentKey); err != nil {
+		health.markDown(err)
+		allowed = health.allowLocal(agentKey, authInfo.Agent.QPS)
+	}
+	if allowed {
+		return true
+	}
 
-			if !allowed {
-				m.respondWithError(c, http.StatusTooManyRequests, "rate_limit_exceeded", "Agent rate limit exceeded")
+	emitQuotaExceeded(authInfo.AgentID, "agent_qps", map[string]interface{}{"qps": authInfo.Agent.QPS, "mode": mode})
+	if mode == internal.RateLimitModeMonitor {
+		log.Printf("Agent %s is over its limit of %d QPS, let through in monitor mode", authInfo.AgentID, authInfo.Agent.QPS)
+		return true
+	}
+	m.respondWithError(c, http.StatusTooManyRequests, "rate_limit_exceeded", "Agent rate limit exceeded")
+	return false
+}
+
+// allowPlaygroundRequest check the rate limit of a playground token, writes the error response when denied
+func (m *DataFlowMiddleware) allowPlaygroundRequest(c *gin.Context, agentID string, scope *PlaygroundScope) bool {
+	limiterKey := fmt.Sprintf("playground:%d", scope.TokenID)
+	limiter, err := m.rateLimiterManager.GetOrCreateLimiter(limiterKey, scope.QPS)
+	if err != nil {
+		m.respondWithError(c, http.StatusInternalServerError, "rate_limit_error", "Failed to get playground rate limiter: "+err.Error())
+		return false
+	}
+
+	allowed := false
+	if health := redisStatus(); health.Degraded() {
+		allowed = health.allowLocal(limiterKey, scope.QPS)
+	} else if allowed, err = limiter.Allow(c.Request.Context(), limiterKey); err != nil {
+		health.markDown(err)
+		allowed = health.allowLocal(limiterKey, scope.QPS)
+	}
+
+	if !allowed {
+		emitQuotaExceeded(agentID, "playground_qps", map[string]interface{}{
+			"qps":                 scope.QPS,
+			"playground_token_id": scope.TokenID,
+		})
+		c.Header("X-RateLimit-Playground-QPS", strconv.Itoa(scope.QPS))
+		c.Header("Retry-After", "1")
+		m.respondWithError(c, http.StatusTooManyRequests, "rate_limit_exceeded", "Playground token rate limit exceeded")
+		return false
+	}
+
+	return true
+}
+
+// QueueAdmissionMiddleware tracks pending requests in the agent queue and rejects
+// requests when the queue is full, honoring per-agent overrides from control-flow
+func (m *DataFlowMiddleware) QueueAdmissionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admissionQueue := m.queue()
+		if admissionQueue == nil {
+			c.Next()
+			return
+		}
+
+		authInfo, err := GetAuthInfoFromContext(c)
+		if err != nil {
+			m.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			c.Abort()
+			return
+		}
+
+		priority, err := requestPriority(c, authInfo)
+		if err != nil {
+			statusCode := http.StatusBadRequest
+			errorType := "invalid_priority"
+			if errors.Is(err, errPriorityOverrideForbidden) {
+				statusCode = http.StatusForbidden
+				errorType = "priority_override_forbidden"
+			}
+			m.respondWithError(c, statusCode, errorType, err.Error())
+			c.Abort()
+			return
+		}
+		c.Header("X-Queue-Priority", strconv.Itoa(int(priority)))
+
+		queueName := queue.NewQueueNameBuilder().WithAgent(authInfo.AgentID).Build()
+		request, err := queue.NewRequestBuilder().
+			WithID(newAdmissionID()).
+			WithUserID(m.authService.GetUserIDFromAPIKey(authInfo.APIKey)).
+			WithAgentID(authInfo.AgentID).
+			WithPriority(priority).
+			WithMetadata("path", c.Request.URL.Path).
+			Build()
+		if err != nil {
+			m.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			c.Abort()
+			return
+		}
+
+		if err := admissionQueue.Enqueue(c.Request.Context(), queueName, request); err != nil {
+			if queueFullErr, ok := queue.AsQueueFull(err); ok {
+				emitQuotaExceeded(authInfo.AgentID, "queue", map[string]interface{}{
+					"queue_name":     queueFullErr.QueueName,
+					"current_size":   queueFullErr.CurrentSize,
+					"max_queue_size": queueFullErr.MaxQueueSize,
+				})
+				m.respondWithQueueFull(c, queueFullErr, queueFullHint(authInfo.AgentID, queueFullErr, authInfo.Agent.QPS))
 				c.Abort()
 				return
 			}
+			// Redis went away: admit the request unqueued rather than fail it
+			log.Printf("Queue admission skipped for %s: %v", queueName, err)
+			redisStatus().markDown(err)
+			c.Next()
+			return
 		}
 
+		admittedAt := time.Now()
+		c.Set(queueAdmittedAtKey, admittedAt)
+		releaseQueued := trackConcurrency(c, concurrency().queued, authInfo.AgentID)
+		agentQueueUsage.observe(c.Request.Context(), admissionQueue, authInfo.AgentID, queueName)
+		if hint := admittedHint(c.Request.Context(), admissionQueue, authInfo.AgentID, queueName, request.ID, authInfo.Agent.QPS); hint != nil {
+			hint.setHeaders(c.Writer.Header())
+		}
+
+		// release the slot even if the client went away
+		defer func() {
+			releaseQueued()
+			agentRequestLatency.observe(authInfo.AgentID, time.Since(admittedAt))
+			if err := admissionQueue.Remove(context.Background(), queueName, request.ID); err != nil {
+				log.Printf("Failed to release queue slot %s on %s: %v", request.ID, queueName, err)
+			}
+		}()
+
 		c.Next()
 	}
 }
 
+// newAdmissionID generate a collision-safe ID for a queue slot
+func newAdmissionID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("adm_%d", time.Now().UnixNano())
+	}
+	return "adm_" + hex.EncodeToString(buf)
+}
+
+// queueFullDetails the diagnostics of the full queue with the backpressure hint
+type queueFullDetails struct {
+	*queue.QueueFullError
+	Backpressure *BackpressureHint `json:"backpressure"`
+}
+
+// respondWithQueueFull return 429 with the diagnostics of the full queue, Retry-After
+// is the time until the next slot is expected to free up
+func (m *DataFlowMiddleware) respondWithQueueFull(c *gin.Context, queueFullErr *queue.QueueFullError, hint *BackpressureHint) {
+	hint.setHeaders(c.Writer.Header())
+	c.Header("X-Queue-Name", queueFullErr.QueueName)
+	c.Header("X-Queue-Size", strconv.FormatInt(queueFullErr.CurrentSize, 10))
+	c.Header("X-Queue-Max-Size", strconv.FormatInt(queueFullErr.MaxQueueSize, 10))
+	c.Header("Retry-After", strconv.Itoa(hint.RetryAfterSeconds))
+
+	response := DataFlowResponse{
+		Code:    http.StatusTooManyRequests,
+		Message: "Queue full",
+		Error: &APIError{
+			Type:    "queue_full",
+			Code:    "429",
+			Message: fmt.Sprintf("Agent queue is full (%d/%d pending requests)", queueFullErr.CurrentSize, queueFullErr.MaxQueueSize),
+			Details: queueFullDetails{QueueFullError: queueFullErr, Backpressure: hint},
+		},
+	}
+	c.JSON(http.StatusTooManyRequests, response)
+}
+
+// respondWithMaintenance return 503 with the end of the maintenance as ETA
+func (m *DataFlowMiddleware) respondWithMaintenance(c *gin.Context, window *internal.MaintenanceWindow) {
+	retryAfter := int(math.Ceil(time.Until(window.EndsAt).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	message := window.Message
+	if message == "" {
+		message = "Agent is under scheduled maintenance"
+	}
+
+	response := DataFlowResponse{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Under maintenance",
+		Error: &APIError{
+			Type:    "maintenance",
+			Code:    "503",
+			Message: message,
+			Details: gin.H{
+				"maintenance_id":      window.ID,
+				"name":                window.Name,
+				"global":              window.IsGlobal(),
+				"starts_at":           window.StartsAt,
+				"eta":                 window.EndsAt,
+				"retry_after_seconds": retryAfter,
+			},
+		},
+	}
+	c.JSON(http.StatusServiceUnavailable, response)
+}
+
 // respondWithError return error response
 func (m *DataFlowMiddleware) respondWithError(c *gin.Context, statusCode int, errorType, message string) {
 	response := DataFlowResponse{
@@ -210,6 +548,12 @@ func (m *DataFlowMiddleware) respondWithRateLimit(c *gin.Context, agentQPS int)
 
 // Close closes the middleware resources
 func (m *DataFlowMiddleware) Close() error {
+	if m.admissionQueue != nil {
+		m.admissionQueue.Close()
+	}
+	if m.replayGuard != nil {
+		m.replayGuard.client.Close()
+	}
 	if m.rateLimiterManager != nil {
 		return m.rateLimiterManager.Close()
 	}
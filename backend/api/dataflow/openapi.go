@@ -0,0 +1,97 @@
+package dataflow
+
+import (
+	"net/http"
+
+	"agent-connector/pkg/openapi"
+)
+
+// NewOpenAPIGenerator describe the data flow API endpoints
+func NewOpenAPIGenerator() *openapi.Generator {
+	g := openapi.NewGenerator("Data Flow API", "1.0.0",
+		"Unified agent access. Streaming requests answer with text/event-stream chunks of the documented response type.")
+	g.AddSecurityScheme("bearerAuth", &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "Connector API key of the agent, or a playground token",
+	})
+	g.AddSecurityScheme("apiKey", &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-API-Key",
+		Description: "Connector API key of the agent, or a playground token",
+	})
+
+	security := []string{"bearerAuth", "apiKey"}
+	agentQuery := []*openapi.Parameter{
+		openapi.QueryParam("agent_id", "string", "agent to call, optional when the key identifies the agent"),
+	}
+
+	g.Describe(http.MethodPost, "/api/v1/openai/chat/completions", openapi.Endpoint{
+		Summary: "OpenAI compatible chat completion", Tags: []string{"OpenAI"},
+		Request: OpenAIChatRequest{}, Response: OpenAIResponse{}, Raw: true, Query: agentQuery, Security: security,
+	})
+	g.Describe(http.MethodPost, "/api/v1/dify/chat-messages", openapi.Endpoint{
+		Summary: "Dify chat message", Tags: []string{"Dify"},
+		Request: DifyChatRequest{}, Response: DifyResponse{}, Raw: true, Query: agentQuery, Security: security,
+	})
+	g.Describe(http.MethodPost, "/api/v1/dify/workflows/run", openapi.Endpoint{
+		Summary: "Run a Dify workflow", Tags: []string{"Dify"},
+		Request: DifyWorkflowRequest{}, Response: map[string]interface{}{}, Raw: true, Query: agentQuery, Security: security,
+	})
+	g.Describe(http.MethodGet, "/api/v1/dify/parameters", openapi.Endpoint{
+		Summary: "Input form, opening statement and features of the Dify app, as Dify returns them", Tags: []string{"Dify"},
+		Security: security, Query: append([]*openapi.Parameter{openapi.QueryParam("user", "string", "end user passed to Dify")}, agentQuery...),
+	})
+	g.Describe(http.MethodGet, "/api/v1/dify/meta", openapi.Endpoint{
+		Summary: "Tool icons of the Dify chat app, as Dify returns them", Tags: []string{"Dify"},
+		Security: security, Query: append([]*openapi.Parameter{openapi.QueryParam("user", "string", "end user passed to Dify")}, agentQuery...),
+	})
+	g.Describe(http.MethodGet, "/api/v1/dify/messages/:message_id/suggested", openapi.Endpoint{
+		Summary: "Questions Dify suggests after a message", Tags: []string{"Dify"},
+		Security: security, Query: append([]*openapi.Parameter{openapi.QueryParam("user", "string", "user who sent the message, required")}, agentQuery...),
+	})
+	g.Describe(http.MethodPost, "/api/v1/chat", openapi.Endpoint{
+		Summary: "Legacy unified chat endpoint, deprecated", Tags: []string{"Legacy"},
+		Request: DataFlowRequest{}, Response: map[string]interface{}{}, Raw: true, Security: security,
+		Query: append([]*openapi.Parameter{
+			openapi.QueryParam("format", "string", "openai or dify, detected from the fields when omitted"),
+		}, agentQuery...),
+	})
+	g.Describe(http.MethodPost, "/api/v1/requests/:request_id/cancel", openapi.Endpoint{
+		Summary: "Stop a running chat request of the key, identified by its X-Request-ID", Tags: []string{"Requests"},
+		Response: CancelRequestResponse{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodGet, "/api/v1/sessions/:session_id/variables", openapi.Endpoint{
+		Summary: "Variables of a session of the key, injected into requests with its X-Session-ID", Tags: []string{"Sessions"},
+		Response: SessionVariablesResponse{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodPut, "/api/v1/sessions/:session_id/variables", openapi.Endpoint{
+		Summary: "Set variables of a session, merged with the stored ones; null removes a variable", Tags: []string{"Sessions"},
+		Request: SessionVariablesRequest{}, Response: SessionVariablesResponse{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodDelete, "/api/v1/sessions/:session_id/variables", openapi.Endpoint{
+		Summary: "Drop all variables of a session", Tags: []string{"Sessions"}, Security: security,
+	})
+	g.Describe(http.MethodGet, "/api/v1/sessions/:session_id/conversations", openapi.Endpoint{
+		Summary: "Title of a session and the Dify conversations it continues", Tags: []string{"Sessions"},
+		Response: SessionConversationsResponse{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodDelete, "/api/v1/sessions/:session_id/conversations", openapi.Endpoint{
+		Summary: "Forget the Dify conversations and the title of a session, its next chat turn starts a new one", Tags: []string{"Sessions"},
+		Response: ConversationsDeletedResponse{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodGet, "/api/v1/usage/me", openapi.Endpoint{
+		Summary: "Rate limit, quotas, recent requests and cost this month of the calling key", Tags: []string{"Usage"},
+		Response: UsageMeResponse{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodGet, "/api/v1/health", openapi.Endpoint{
+		Summary: "Health check", Tags: []string{"System"}, Response: map[string]interface{}{}, Raw: true, Security: security,
+	})
+	g.Describe(http.MethodGet, "/metrics", openapi.Endpoint{
+		Summary: "Concurrency gauges per agent and endpoint in the Prometheus text format", Tags: []string{"System"},
+		Response: "", Raw: true,
+	})
+
+	return g
+}
@@ -0,0 +1,196 @@
+package dataflow
+
+import (
+	"fmt"
+	"slices"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+// connectorAnnotationsField the response and stream chunk member holding the annotations
+const connectorAnnotationsField = "connector_annotations"
+
+// Annotation actions
+const (
+	annotationRedacted = "redacted" // the matched values were masked
+	annotationBlocked  = "blocked"  // the text was withheld
+)
+
+// blockedWordsCategory the category of the agent's blocked words
+const blockedWordsCategory = "blocked_words"
+
+// contentAnnotation tells the client that a filter changed a text of the answer, so it
+// can show a notice instead of an answer that was silently altered
+type contentAnnotation struct {
+	Filter         string             `json:"filter"`          // output_filter
+	Action         string             `json:"action"`          // redacted or blocked
+	Field          string             `json:"field"`           // the changed text, e.g. choices[0].message.content
+	Spans          []redact.Span      `json:"spans,omitempty"` // replacements in the returned text, not for blocked text
+	CategoryScores map[string]float64 `json:"category_scores"` // categories that fired, rule matches are certain and score 1
+}
+
+// outputFilter the agent's output filter, applied to the answers of one request
+type outputFilter struct {
+	redactor *redact.Redactor
+	block    bool
+	withheld bool // a blocked stream sends no more text
+}
+
+// newOutputFilter the output filter of the agent, nil when it has none
+func newOutputFilter(agentInfo *AgentInfo) *outputFilter {
+	var rules []redact.Rule
+	for _, name := range redact.BuiltinRuleNames() {
+		if slices.Contains(agentInfo.OutputFilter, name) {
+			rule, _ := redact.Builtin(name)
+			rules = append(rules, rule)
+		}
+	}
+	if rule, ok := redact.WordsRule(agentInfo.BlockedWords); ok {
+		rule.Name = blockedWordsCategory
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &outputFilter{
+		redactor: redact.New(rules...),
+		block:    agentInfo.OutputFilterAction == internal.OutputFilterBlock,
+	}
+}
+
+// requestOutputFilter the output filter of the agent the request is sent to
+func requestOutputFilter(c *gin.Context, req *backends.BackendRequest) *outputFilter {
+	var agentInfo *AgentInfo
+	if authInfo, err := GetAuthInfoFromContext(c); err == nil && authInfo.AgentID == req.AgentID {
+		agentInfo = authInfo.Agent
+	}
+	if agentInfo == nil {
+		agent, err := internal.LookupAgentByAgentID(req.AgentID)
+		if err != nil {
+			return nil
+		}
+		agentInfo = newAgentInfo(agent)
+	}
+	return newOutputFilter(agentInfo)
+}
+
+// apply filter a text of the answer, field names it in the annotation; the text is
+// returned unchanged without an annotation when nothing matched
+func (f *outputFilter) apply(field, text string) (string, *contentAnnotation) {
+	filtered, spans := f.redactor.RedactSpans(text)
+	if len(spans) == 0 {
+		return text, nil
+	}
+
+	annotation := &contentAnnotation{
+		Filter:         "output_filter",
+		Action:         annotationRedacted,
+		Field:          field,
+		Spans:          spans,
+		CategoryScores: make(map[string]float64),
+	}
+	for _, span := range spans {
+		annotation.CategoryScores[span.Rule] = 1
+	}
+	if f.block {
+		annotation.Action = annotationBlocked
+		annotation.Spans = nil
+		return "", annotation
+	}
+	return filtered, annotation
+}
+
+// filterBody filter the texts of a decoded response or stream chunk in place: OpenAI
+// message or delta content, Dify answers and string workflow outputs. A blocked OpenAI
+// choice finishes with the content_filter reason.
+func (f *outputFilter) filterBody(body map[string]interface{}) []*contentAnnotation {
+	var annotations []*contentAnnotation
+	filterField := func(container map[string]interface{}, key, field string) bool {
+		text, ok := container[key].(string)
+		if !ok || text == "" {
+			return false
+		}
+		filtered, annotation := f.apply(field, text)
+		if annotation == nil {
+			return false
+		}
+		container[key] = filtered
+		annotations = append(annotations, annotation)
+		return annotation.Action == annotationBlocked
+	}
+
+	if choices, ok := body["choices"].([]interface{}); ok {
+		for i, choice := range choices {
+			choiceMap, _ := choice.(map[string]interface{})
+			for _, member := range []string{"delta", "message"} {
+				message, ok := choiceMap[member].(map[string]interface{})
+				if ok && filterField(message, "content", fmt.Sprintf("choices[%d].%s.content", i, member)) {
+					choiceMap["finish_reason"] = "content_filter"
+				}
+			}
+		}
+		return annotations
+	}
+
+	filterField(body, "answer", "answer")
+	data, _ := body["data"].(map[string]interface{})
+	if outputs, ok := data["outputs"].(map[string]interface{}); ok {
+		for _, name := range mapKeys(outputs) {
+			filterField(outputs, name, "data.outputs."+name)
+		}
+	}
+	return annotations
+}
+
+// withholdText clear the texts of a stream chunk sent after the answer was blocked
+func withholdText(body map[string]interface{}) {
+	if choices, ok := body["choices"].([]interface{}); ok {
+		for _, choice := range choices {
+			choiceMap, _ := choice.(map[string]interface{})
+			if delta, ok := choiceMap["delta"].(map[string]interface{}); ok {
+				if _, ok := delta["content"].(string); ok {
+					delta["content"] = ""
+				}
+			}
+			if choiceMap["finish_reason"] != nil {
+				choiceMap["finish_reason"] = "content_filter"
+			}
+		}
+		return
+	}
+	if _, ok := body["answer"].(string); ok {
+		body["answer"] = ""
+	}
+	data, _ := body["data"].(map[string]interface{})
+	if outputs, ok := data["outputs"].(map[string]interface{}); ok {
+		for name, value := range outputs {
+			if _, ok := value.(string); ok {
+				outputs[name] = ""
+			}
+		}
+	}
+}
+
+// filterStreamChunk filter a stream chunk the batcher forwards as it is, true when it
+// was changed and must be encoded again
+func (f *outputFilter) filterStreamChunk(body map[string]interface{}) bool {
+	if f.withheld {
+		withholdText(body)
+		return true
+	}
+	annotations := f.filterBody(body)
+	if len(annotations) == 0 {
+		return false
+	}
+	for _, annotation := range annotations {
+		if annotation.Action == annotationBlocked {
+			f.withheld = true
+		}
+	}
+	body[connectorAnnotationsField] = annotations
+	return true
+}
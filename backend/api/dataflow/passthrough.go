@@ -0,0 +1,278 @@
+package dataflow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/requestsign"
+	"agent-connector/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// openAIPassthroughPrefix OpenAI routes below it the connector does not implement are
+	// forwarded to passthrough agents
+	openAIPassthroughPrefix = "/api/v1/openai/"
+
+	// openAIPassthroughRoute route pattern passthrough requests are reported under
+	openAIPassthroughRoute = "/api/v1/openai/*path"
+
+	// passthroughUsageLimit bytes of a JSON response kept to read its usage
+	passthroughUsageLimit = 1 << 20
+)
+
+// passthroughRequestHeaders client headers meant for the connector, not the upstream.
+// Accept-Encoding is dropped so the transport negotiates and undoes the compression,
+// the usage is read from the plain response.
+var passthroughRequestHeaders = []string{
+	"Authorization", "X-API-Key", userTokenHeader, requestIDHeader, priorityHeader,
+	requestsign.TimestampHeader, requestsign.SignatureHeader, requestsign.ContentHashHeader,
+	"Accept-Encoding",
+}
+
+// hopByHopHeaders headers of one connection, never forwarded by a proxy
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// errPassthroughNotFound a request outside the dataflow routes that is not forwarded
+var errPassthroughNotFound = errors.New("endpoint not found")
+
+// errPassthroughPath a passthrough path that would leave the agent's /v1/ routes
+var errPassthroughPath = errors.New("path must not contain '..' segments")
+
+// isOpenAIPassthrough report whether the request is one forwarded verbatim, an OpenAI
+// route without a handler of its own
+func isOpenAIPassthrough(c *gin.Context) bool {
+	return c.FullPath() == "" && strings.HasPrefix(c.Request.URL.Path, openAIPassthroughPrefix)
+}
+
+// routePattern the route the request matched, the passthrough route for requests
+// forwarded verbatim
+func routePattern(c *gin.Context) string {
+	if isOpenAIPassthrough(c) {
+		return openAIPassthroughRoute
+	}
+	return c.FullPath()
+}
+
+// passthroughOnly the first handler of the unmatched routes: anything but the OpenAI
+// routes answers 404 before authentication
+func (h *DataFlowAPIHandler) passthroughOnly(c *gin.Context) {
+	if !isOpenAIPassthrough(c) {
+		h.respondWithError(c, http.StatusNotFound, "not_found", fmt.Sprintf("%s %s: %v", c.Request.Method, c.Request.URL.Path, errPassthroughNotFound))
+		c.Abort()
+	}
+}
+
+// HandleOpenAIPassthrough forward a request to an OpenAI route the connector does not
+// implement to the agent verbatim, with the connector key swapped for the agent's key.
+// Only agents with passthrough enabled are forwarded to; usage is read from the JSON or
+// event stream response and recorded like that of chat requests.
+func (h *DataFlowAPIHandler) HandleOpenAIPassthrough(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	agent, err := internal.LookupAgentByAgentID(authInfo.AgentID)
+	if err != nil || agent.Type != types.AgentTypeOpenAI || !agent.Passthrough {
+		h.respondWithError(c, http.StatusNotFound, "not_found",
+			fmt.Sprintf("%s %s is not supported for agent %s, enable passthrough on the agent to forward it", c.Request.Method, c.Request.URL.Path, authInfo.AgentID))
+		return
+	}
+	if authInfo.Playground != nil {
+		h.respondWithError(c, http.StatusForbidden, "playground_scope_violation", "Playground tokens cannot use passthrough endpoints")
+		return
+	}
+
+	upstreamPath, err := passthroughPath(c.Request.URL.Path)
+	if err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", fmt.Sprintf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err))
+		return
+	}
+
+	req := &backends.BackendRequest{AgentID: agent.AgentID, APIKey: authInfo.APIKey}
+
+	// JSON bodies are checked against the key tier, anything else is forwarded unread
+	var body io.Reader = c.Request.Body
+	if c.ContentType() == binding.MIMEJSON {
+		fields := bodyFields(c)
+		if !h.applyTierFeatures(c, authInfo, fields) {
+			return
+		}
+		req.Stream, _ = fields["stream"].(bool)
+		if cached, ok := c.Get(gin.BodyBytesKey); ok {
+			raw, _ := cached.([]byte)
+			body = bytes.NewReader(raw)
+		}
+	}
+
+	defer h.trackRequest(c, req)()
+	defer trackConcurrency(c, concurrency().inFlight, req.AgentID)()
+
+	if req.Stream && h.streams != nil {
+		release, err := h.streams.Acquire(c.Request.Context(), req)
+		var limitErr *StreamLimitError
+		if errors.As(err, &limitErr) {
+			emitQuotaExceeded(req.AgentID, "concurrent_streams", map[string]interface{}{
+				"scope": limitErr.Scope,
+				"limit": limitErr.Limit,
+			})
+			h.respondWithStreamLimit(c, limitErr)
+			return
+		}
+		defer release()
+	}
+
+	start := time.Now()
+	usage, err := h.forwardPassthrough(c, agent, upstreamPath, body)
+	emitRequestCompleted(c, req, start, err)
+	recordUsage(c, req, start, usage, nil, err)
+	chargeQuotaPool(c, usage)
+	if err != nil && !c.Writer.Written() {
+		h.respondWithError(c, http.StatusBadGateway, "upstream_error", err.Error())
+	}
+}
+
+// passthroughPath the path below the agent's /v1/ a passthrough request is forwarded to,
+// cleaned; paths with '..' segments are rejected rather than resolved
+func passthroughPath(requestPath string) (string, error) {
+	rest := strings.TrimPrefix(requestPath, openAIPassthroughPrefix)
+	for _, segment := range strings.Split(rest, "/") {
+		if segment == ".." {
+			return "", errPassthroughPath
+		}
+	}
+	return strings.TrimPrefix(path.Clean("/"+rest), "/"), nil
+}
+
+// forwardPassthrough send the request to upstreamPath below the agent's /v1/ and copy
+// the response back as it arrives; an error status of the upstream is returned as an
+// error after it was copied
+func (h *DataFlowAPIHandler) forwardPassthrough(c *gin.Context, agent *internal.Agent, upstreamPath string, body io.Reader) (TokenUsage, error) {
+	var usage TokenUsage
+
+	target := strings.TrimSuffix(agent.URL, "/") + "/v1/" + upstreamPath
+	if c.Request.URL.RawQuery != "" {
+		target += "?" + c.Request.URL.RawQuery
+	}
+	upstreamReq, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, target, body)
+	if err != nil {
+		return usage, fmt.Errorf("failed to create request: %w", err)
+	}
+	upstreamReq.Header = c.Request.Header.Clone()
+	for _, name := range append(passthroughRequestHeaders, hopByHopHeaders...) {
+		upstreamReq.Header.Del(name)
+	}
+	upstreamReq.Header.Set("Authorization", "Bearer "+agent.SourceAPIKey)
+
+	// the route timeout bounds the request, not the client
+	client := &http.Client{Transport: h.service.httpClient.Transport}
+	resp, err := client.Do(upstreamReq)
+	if err != nil {
+		return usage, fmt.Errorf("failed to reach agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	header := c.Writer.Header()
+	for name, values := range resp.Header {
+		header[name] = values
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	c.Status(resp.StatusCode)
+
+	stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if stream {
+		defer trackConcurrency(c, concurrency().streaming, agent.AgentID)()
+		err = copyPassthroughStream(c, resp.Body, &usage)
+	} else {
+		err = copyPassthroughBody(c, resp.Body, &usage)
+	}
+	if err != nil {
+		return usage, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return usage, fmt.Errorf("agent answered with status %d", resp.StatusCode)
+	}
+	return usage, nil
+}
+
+// copyPassthroughBody copy a response in one piece, reading the usage of JSON bodies
+// up to passthroughUsageLimit
+func copyPassthroughBody(c *gin.Context, body io.Reader, usage *TokenUsage) error {
+	var kept bytes.Buffer
+	if _, err := io.Copy(c.Writer, io.TeeReader(body, &limitedBuffer{buffer: &kept, limit: passthroughUsageLimit})); err != nil {
+		return fmt.Errorf("failed to forward response: %w", err)
+	}
+
+	var payload interface{}
+	if json.Unmarshal(kept.Bytes(), &payload) == nil {
+		usage.observe(payload)
+	}
+	return nil
+}
+
+// copyPassthroughStream forward an event stream line by line, flushing every event and
+// taking the usage from the data lines that carry it
+func copyPassthroughStream(c *gin.Context, body io.Reader, usage *TokenUsage) error {
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, writeErr := c.Writer.Write(line); writeErr != nil {
+				return fmt.Errorf("failed to forward stream: %w", writeErr)
+			}
+			if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+				var payload interface{}
+				if json.Unmarshal(bytes.TrimSpace(data), &payload) == nil {
+					usage.observe(payload)
+				}
+			}
+			if len(bytes.TrimSpace(line)) == 0 {
+				c.Writer.Flush()
+			}
+		}
+		if err == io.EOF {
+			c.Writer.Flush()
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+	}
+}
+
+// limitedBuffer io.Writer keeping the first limit bytes written, the rest is discarded
+type limitedBuffer struct {
+	buffer *bytes.Buffer
+	limit  int
+}
+
+// Write keep what fits, always reporting the whole write so the copy continues
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buffer.Len(); room > 0 {
+		if len(p) > room {
+			b.buffer.Write(p[:room])
+		} else {
+			b.buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+package dataflow
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/internal"
+	"agent-connector/pkg/queue"
+)
+
+const (
+	// priorityHeader request header privileged keys set the queue priority with
+	priorityHeader = "X-Priority"
+
+	// userLimitCacheTTL how long looked up user limits are reused, changes of a user's
+	// priority or QPS reach dataflow within this time; system defaults apply at once
+	userLimitCacheTTL = time.Minute
+)
+
+var (
+	// errPriorityOverrideForbidden the key may not set the queue priority
+	errPriorityOverrideForbidden = errors.New("this API key may not set the request priority")
+
+	// errInvalidPriority the requested priority is outside the user priority range
+	errInvalidPriority = fmt.Errorf("%s must be a number from %d to %d", priorityHeader, internal.MinUserPriority, internal.MaxUserPriority)
+)
+
+// cachedUserLimits looked up overrides of a user, nil for unknown users
+type cachedUserLimits struct {
+	limits    *internal.UserLimits
+	expiresAt time.Time
+}
+
+// userLimitCache rate limit overrides of platform users by username, shared by every
+// middleware and service instance of the process
+type userLimitCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedUserLimits
+	users   *internal.UserService
+}
+
+var userLimits = &userLimitCache{
+	entries: make(map[string]cachedUserLimits),
+	users:   internal.NewUserService(),
+}
+
+// get the overrides of the user, nil for names that are no active platform user
+func (c *userLimitCache) get(username string) *internal.UserLimits {
+	if username == "" {
+		return nil
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[username]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.limits
+	}
+
+	limits, err := c.users.GetUserLimitsByUsername(username)
+	if err != nil {
+		// keep serving the last known limits while the database is unavailable
+		log.Printf("Failed to load limits of user %s: %v", username, err)
+		return entry.limits
+	}
+
+	c.mu.Lock()
+	// drop expired entries now and then so unknown user names do not pile up
+	if len(c.entries) > 10000 {
+		for name, cached := range c.entries {
+			if now.After(cached.expiresAt) {
+				delete(c.entries, name)
+			}
+		}
+	}
+	c.entries[username] = cachedUserLimits{limits: limits, expiresAt: now.Add(userLimitCacheTTL)}
+	c.mu.Unlock()
+	return limits
+}
+
+// requestPriority the queue priority of the request: X-Priority for keys of agents
+// with priority_override, else the priority of the platform user authenticated with
+// X-User-Token, else the system default priority. The body's user field is not
+// trusted, any client could name a privileged user in it.
+func requestPriority(c *gin.Context, authInfo *AuthInfo) (queue.Priority, error) {
+	if value := c.GetHeader(priorityHeader); value != "" {
+		if authInfo.Playground != nil || !authInfo.Agent.PriorityOverride {
+			return 0, errPriorityOverrideForbidden
+		}
+		priority, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || priority < internal.MinUserPriority || priority > internal.MaxUserPriority {
+			return 0, errInvalidPriority
+		}
+		return queue.Priority(priority), nil
+	}
+
+	return queue.Priority(internal.ResolveUserPriority(userLimits.get(authInfo.User))), nil
+}
@@ -0,0 +1,116 @@
+package dataflow
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/internal"
+)
+
+// providerStatuses the provider statuses polled by control flow
+var providerStatuses = internal.NewProviderStatusService()
+
+// providerHealth the status of a provider with the managed agents it serves, for the
+// health endpoint
+type providerHealth struct {
+	internal.ProviderStatus
+	Agents []string `json:"agents"`
+}
+
+// loadProviderStatuses refresh the provider statuses, keeping the previous ones when
+// they cannot be read
+func (m *ManagedAgents) loadProviderStatuses() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	statuses, err := providerStatuses.ListProviderStatuses(ctx)
+	if err != nil {
+		log.Printf("Failed to load provider statuses: %v", err)
+		return
+	}
+
+	m.providerMu.Lock()
+	defer m.providerMu.Unlock()
+	m.statuses = statuses
+}
+
+// setProvider remember the provider of a managed agent
+func (m *ManagedAgents) setProvider(agentID, provider string) {
+	m.providerMu.Lock()
+	defer m.providerMu.Unlock()
+	m.providers[agentID] = provider
+}
+
+// dropProviders forget the providers of the agents no longer managed
+func (m *ManagedAgents) dropProviders(wanted map[string]bool) {
+	m.providerMu.Lock()
+	defer m.providerMu.Unlock()
+	for agentID := range m.providers {
+		if !wanted[agentID] {
+			delete(m.providers, agentID)
+		}
+	}
+}
+
+// providerIncident whether the provider reports an incident; called with providerMu held
+func (m *ManagedAgents) providerIncident(provider string) bool {
+	if provider == "" {
+		return false
+	}
+	for i := range m.statuses {
+		if m.statuses[i].Provider == provider {
+			return m.statuses[i].HasIncident()
+		}
+	}
+	return false
+}
+
+// lowersPriority whether the agents of the provider are lowered for an incident
+func (m *ManagedAgents) lowersPriority(provider string) bool {
+	cfg := config.GlobalConfig
+	if cfg == nil || !cfg.ProviderStatus.LowerPriority {
+		return false
+	}
+	m.providerMu.RLock()
+	defer m.providerMu.RUnlock()
+	return m.providerIncident(provider)
+}
+
+// managedAgentDeprioritized whether the agent's provider reports an incident and agents
+// of providers with incidents are lowered, so its requests are hedged right away
+func managedAgentDeprioritized(agentID string) bool {
+	m := managedAgents
+	if m == nil {
+		return false
+	}
+	m.providerMu.RLock()
+	provider := m.providers[agentID]
+	m.providerMu.RUnlock()
+	return m.lowersPriority(provider)
+}
+
+// providerHealthReport the provider statuses as of the last sync with the managed agents
+// of each provider, nil when the agent manager is disabled
+func providerHealthReport() []providerHealth {
+	m := managedAgents
+	if m == nil {
+		return nil
+	}
+	m.providerMu.RLock()
+	defer m.providerMu.RUnlock()
+
+	report := make([]providerHealth, 0, len(m.statuses))
+	for _, status := range m.statuses {
+		entry := providerHealth{ProviderStatus: status, Agents: []string{}}
+		for agentID, provider := range m.providers {
+			if provider == status.Provider {
+				entry.Agents = append(entry.Agents, agentID)
+			}
+		}
+		sort.Strings(entry.Agents)
+		report = append(report, entry)
+	}
+	return report
+}
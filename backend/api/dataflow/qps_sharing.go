@@ -0,0 +1,72 @@
+package dataflow
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/internal"
+	"agent-connector/pkg/ratelimiter"
+)
+
+// anonymousConsumer the share of requests without an authenticated user
+const anonymousConsumer = "-"
+
+// shareConsumer who the request counts against and with what weight: the platform user
+// authenticated with X-User-Token at the request priority, priority 0 still weighs 1 so
+// no user is starved. The body's user field is not trusted: a new name on every request
+// would get a fresh share each time, and naming another user would spend theirs.
+func shareConsumer(c *gin.Context, authInfo *AuthInfo) (string, float64) {
+	consumer := authInfo.User
+	if consumer == "" {
+		consumer = anonymousConsumer
+	}
+
+	priority, err := requestPriority(c, authInfo)
+	if err != nil {
+		// the queue admission rejects the request, count it at the normal priority until then
+		priority = internal.DefaultUserPriority
+	}
+	if priority < 1 {
+		priority = 1
+	}
+	return consumer, float64(priority)
+}
+
+// allowSharedAgentRequest check the request against the user's share of the agent QPS,
+// writes the error response when denied; in monitor mode requests over the share are
+// logged and let through
+func (m *DataFlowMiddleware) allowSharedAgentRequest(c *gin.Context, authInfo *AuthInfo, limiter ratelimiter.WeightedRateLimiter, mode string) bool {
+	consumer, weight := shareConsumer(c, authInfo)
+	result, err := limiter.AllowWeighted(c.Request.Context(), fmt.Sprintf("agent:%s", authInfo.AgentID), ratelimiter.WeightedRequest{
+		Consumer: consumer,
+		Weight:   weight,
+		Capacity: float64(authInfo.Agent.QPS),
+	})
+	if err != nil {
+		m.respondWithError(c, http.StatusInternalServerError, "rate_limit_error", "Rate limit check failed: "+err.Error())
+		return false
+	}
+	if result.Allowed {
+		return true
+	}
+
+	emitQuotaExceeded(authInfo.AgentID, "agent_qps", map[string]interface{}{
+		"qps":   authInfo.Agent.QPS,
+		"user":  consumer,
+		"share": result.Share,
+		"mode":  mode,
+	})
+	if mode == internal.RateLimitModeMonitor {
+		log.Printf("User %s is over its share of %.2f QPS of agent %s, let through in monitor mode", consumer, result.Share, authInfo.AgentID)
+		return true
+	}
+	c.Header("X-RateLimit-Agent-QPS", strconv.Itoa(authInfo.Agent.QPS))
+	c.Header("X-RateLimit-Share-QPS", strconv.FormatFloat(result.Share, 'f', 2, 64))
+	c.Header("Retry-After", "1")
+	m.respondWithError(c, http.StatusTooManyRequests, "rate_limit_exceeded", "Agent rate limit exceeded for this user's share")
+	return false
+}
@@ -0,0 +1,52 @@
+package dataflow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"agent-connector/internal"
+)
+
+// shareRequest a gin context for a chat request whose body names the user
+func shareRequest(bodyUser string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	body := `{"messages":[{"role":"user","content":"hi"}],"user":"` + bodyUser + `"}`
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/openai/chat/completions", strings.NewReader(body))
+	return c
+}
+
+func TestShareConsumerIgnoresBodyUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authInfo := &AuthInfo{AgentID: "agent-1", Agent: &AgentInfo{}}
+
+	// a new user field on every request still draws from the same anonymous share
+	for _, bodyUser := range []string{"alice", "bob", "mallory-1", "mallory-2"} {
+		consumer, weight := shareConsumer(shareRequest(bodyUser), authInfo)
+		assert.Equal(t, anonymousConsumer, consumer, "body user %q", bodyUser)
+		assert.Equal(t, float64(internal.DefaultUserPriority), weight)
+	}
+}
+
+func TestShareConsumerUsesAuthenticatedUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userLimits.mu.Lock()
+	userLimits.entries["carol"] = cachedUserLimits{expiresAt: time.Now().Add(time.Hour)}
+	userLimits.mu.Unlock()
+	defer func() {
+		userLimits.mu.Lock()
+		delete(userLimits.entries, "carol")
+		userLimits.mu.Unlock()
+	}()
+
+	authInfo := &AuthInfo{AgentID: "agent-1", Agent: &AgentInfo{}, User: "carol"}
+	for _, bodyUser := range []string{"", "carol", "dave"} {
+		consumer, _ := shareConsumer(shareRequest(bodyUser), authInfo)
+		assert.Equal(t, "carol", consumer, "body user %q", bodyUser)
+	}
+}
@@ -0,0 +1,174 @@
+package dataflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/internal"
+	"agent-connector/pkg/quota"
+)
+
+var (
+	quotaStoreOnce  sync.Once
+	quotaStoreState *quota.Store
+)
+
+// quotaPools the budget counters of the quota pools, on the Redis connection of the
+// health check; nil without a Redis configuration
+func quotaPools() *quota.Store {
+	quotaStoreOnce.Do(func() {
+		if client := redisStatus().client; client != nil {
+			quotaStoreState = quota.NewStore(client, "agent-connector:quota:")
+		}
+	})
+	return quotaStoreState
+}
+
+// requestQuotaPool the quota pool the key of the request draws from, nil when it has
+// none or the pool cannot be loaded
+func requestQuotaPool(authInfo *AuthInfo) *internal.QuotaPool {
+	if authInfo.Agent == nil || authInfo.Agent.QuotaPool == "" || quotaPools() == nil {
+		return nil
+	}
+	pool, err := internal.LookupQuotaPool(authInfo.Agent.QuotaPool)
+	if err != nil {
+		log.Printf("Failed to load quota pool %s of agent %s: %v", authInfo.Agent.QuotaPool, authInfo.AgentID, err)
+		return nil
+	}
+	return pool
+}
+
+// allowPoolRequest draw the request from the quota pool of the key, writes the error
+// response when a budget of the pool or of the key is used up. Requests are let
+// through while Redis is down, the pool cannot be counted then.
+func (m *DataFlowMiddleware) allowPoolRequest(c *gin.Context, authInfo *AuthInfo) bool {
+	pool := requestQuotaPool(authInfo)
+	if pool == nil || redisStatus().Degraded() {
+		return true
+	}
+
+	err := quotaPools().Admit(c.Request.Context(), pool.Name, authInfo.AgentID, pool.Period, pool.Limits(), authInfo.Agent.PoolLimits, time.Now())
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		emitQuotaExceeded(authInfo.AgentID, "quota_pool", map[string]interface{}{
+			"pool":     exceeded.Pool,
+			"scope":    exceeded.Scope,
+			"resource": exceeded.Resource,
+			"quota":    exceeded.Limit,
+			"used":     exceeded.Used,
+		})
+		m.respondWithPoolQuota(c, exceeded)
+		return false
+	}
+	if err != nil {
+		redisStatus().markDown(err)
+		log.Printf("Quota pool check failed, admitting request: %v", err)
+	}
+	return true
+}
+
+// admitConnectorCall draw a call the connector makes on its own for a request to the
+// agent, e.g. to summarize dropped messages, from the quota pool of the agent's key; an
+// *quota.ExceededError when a budget is used up. Its tokens are charged with the request.
+func admitConnectorCall(ctx context.Context, agentID string) error {
+	if quotaPools() == nil || redisStatus().Degraded() {
+		return nil
+	}
+	agent, err := internal.LookupAgentByAgentID(agentID)
+	if err != nil || agent.QuotaPool == "" {
+		return nil
+	}
+	pool, err := internal.LookupQuotaPool(agent.QuotaPool)
+	if err != nil {
+		log.Printf("Failed to load quota pool %s of agent %s: %v", agent.QuotaPool, agentID, err)
+		return nil
+	}
+
+	err = quotaPools().Admit(ctx, pool.Name, agentID, pool.Period, pool.Limits(), agent.PoolLimits(), time.Now())
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return exceeded
+	}
+	if err != nil {
+		redisStatus().markDown(err)
+		log.Printf("Quota pool check failed, admitting call: %v", err)
+	}
+	return nil
+}
+
+// chargeQuotaPool add the tokens of a finished request to the quota pool of its key
+func chargeQuotaPool(c *gin.Context, usage TokenUsage) {
+	if usage.TotalTokens <= 0 {
+		return
+	}
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		return
+	}
+	pool := requestQuotaPool(authInfo)
+	if pool == nil {
+		return
+	}
+
+	// the request context may already be cancelled by the client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := quotaPools().Charge(ctx, pool.Name, authInfo.AgentID, pool.Period, int64(usage.TotalTokens), time.Now()); err != nil {
+		log.Printf("Failed to charge %d tokens of agent %s: %v", usage.TotalTokens, authInfo.AgentID, err)
+	}
+}
+
+// poolUsageQuotas what the pool and the key drew in the current period, for the
+// limits that are set
+func poolUsageQuotas(ctx context.Context, authInfo *AuthInfo) []UsageQuota {
+	pool := requestQuotaPool(authInfo)
+	if pool == nil {
+		return nil
+	}
+	poolUsage, keyUsages, err := quotaPools().Usage(ctx, pool.Name, pool.Period, time.Now(), authInfo.AgentID)
+	if err != nil {
+		log.Printf("Failed to read quota pool %s: %v", pool.Name, err)
+		return nil
+	}
+
+	var quotas []UsageQuota
+	add := func(name string, used, limit int64) {
+		if limit > 0 {
+			quotas = append(quotas, UsageQuota{Name: name, Used: used, Limit: limit})
+		}
+	}
+	add("pool_tokens", poolUsage.Tokens, pool.TokenLimit)
+	add("pool_requests", poolUsage.Requests, pool.RequestLimit)
+	add("key_pool_tokens", keyUsages[0].Tokens, authInfo.Agent.PoolLimits.Tokens)
+	add("key_pool_requests", keyUsages[0].Requests, authInfo.Agent.PoolLimits.Requests)
+	return quotas
+}
+
+// respondWithPoolQuota return 429 when a budget of the quota pool is used up, with
+// Retry-After set to the start of the next period
+func (m *DataFlowMiddleware) respondWithPoolQuota(c *gin.Context, exceeded *quota.ExceededError) {
+	retryAfter := max(int(math.Ceil(time.Until(exceeded.ResetAt).Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.Header("X-Quota-Pool", exceeded.Pool)
+
+	response := DataFlowResponse{
+		Code:    http.StatusTooManyRequests,
+		Message: "Quota exceeded",
+		Error: &APIError{
+			Type:    "quota_exceeded",
+			Code:    "429",
+			Message: fmt.Sprintf("The %s, it resets at %s", exceeded.Error(), exceeded.ResetAt.Format(time.RFC3339)),
+			Details: exceeded,
+		},
+	}
+	c.JSON(http.StatusTooManyRequests, response)
+}
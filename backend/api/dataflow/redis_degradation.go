@@ -0,0 +1,163 @@
+package dataflow
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"agent-connector/config"
+	"agent-connector/pkg/ratelimiter"
+)
+
+const (
+	// defaultRedisHealthCheckInterval how often Redis is pinged when none is configured
+	defaultRedisHealthCheckInterval = 5 * time.Second
+
+	// defaultDegradedQPSRatio share of a QPS limit an instance allows on its own when
+	// none is configured
+	defaultDegradedQPSRatio = 0.5
+)
+
+// redisHealth tracks whether the Redis dataflow shares its rate limits and queues
+// through is reachable. While it is not, dataflow runs degraded instead of failing:
+// rate limits are checked in process memory at a conservative share of their QPS, the
+// queue admission, stream limits and signature replay checks are skipped, and the
+// health check reports "degraded". A failed Redis call marks the outage at once; a
+// background ping every health_check_interval notices when Redis is back and restores
+// the shared limits.
+type redisHealth struct {
+	client   *redis.Client
+	interval time.Duration
+	ratio    float64
+	local    *ratelimiter.LocalRateLimiter
+
+	degraded  atomic.Bool
+	mu        sync.Mutex
+	since     time.Time
+	lastError string
+}
+
+var (
+	redisHealthOnce  sync.Once
+	redisHealthState *redisHealth
+)
+
+// redisStatus the Redis health of the process, started on first use; without a
+// configuration Redis is assumed to be reachable
+func redisStatus() *redisHealth {
+	redisHealthOnce.Do(func() {
+		redisHealthState = newRedisHealth(config.GlobalConfig)
+		if redisHealthState.client != nil {
+			redisHealthState.check()
+			go redisHealthState.run()
+		}
+	})
+	return redisHealthState
+}
+
+// newRedisHealth create the tracker from the configuration, not yet checking Redis
+func newRedisHealth(cfg *config.Config) *redisHealth {
+	local, _ := ratelimiter.NewLocalRateLimiter(&ratelimiter.Config{Rate: 1, Burst: 1})
+	h := &redisHealth{
+		interval: defaultRedisHealthCheckInterval,
+		ratio:    defaultDegradedQPSRatio,
+		local:    local,
+	}
+	if cfg == nil {
+		return h
+	}
+
+	if cfg.Redis.HealthCheckInterval > 0 {
+		h.interval = cfg.Redis.HealthCheckInterval
+	}
+	if cfg.Redis.DegradedQPSRatio > 0 {
+		h.ratio = math.Min(cfg.Redis.DegradedQPSRatio, 1)
+	}
+	redisAddr := cfg.Redis.Addr
+	if redisAddr == "" {
+		redisAddr = "localhost:6379" // fallback default
+	}
+	h.client = redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	return h
+}
+
+// Degraded whether Redis is currently considered unreachable
+func (h *redisHealth) Degraded() bool {
+	return h.degraded.Load()
+}
+
+// markDown enter degraded mode after a failed Redis call
+func (h *redisHealth) markDown(err error) {
+	h.mu.Lock()
+	h.lastError = err.Error()
+	h.mu.Unlock()
+	if h.degraded.CompareAndSwap(false, true) {
+		h.mu.Lock()
+		h.since = time.Now()
+		h.mu.Unlock()
+		log.Printf("Redis is unreachable, dataflow is degraded: rate limits are local at %.0f%% of their QPS, queues and stream limits are off: %v", h.ratio*100, err)
+	}
+}
+
+// markUp leave degraded mode once Redis answers again
+func (h *redisHealth) markUp() {
+	if h.degraded.CompareAndSwap(true, false) {
+		h.mu.Lock()
+		since := h.since
+		h.mu.Unlock()
+		log.Printf("Redis is reachable again after %s, shared limits and queues are restored", time.Since(since).Round(time.Second))
+	}
+}
+
+// check ping Redis once and update the state
+func (h *redisHealth) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), min(h.interval, 2*time.Second))
+	defer cancel()
+	if err := h.client.Ping(ctx).Err(); err != nil {
+		h.markDown(err)
+		return
+	}
+	h.markUp()
+}
+
+// run check Redis every interval for the life of the process
+func (h *redisHealth) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.check()
+	}
+}
+
+// allowLocal check a limit of qps in process memory at the degraded share, at least
+// one request per second, without bursts beyond it
+func (h *redisHealth) allowLocal(key string, qps int) bool {
+	rate := math.Max(math.Floor(float64(qps)*h.ratio), 1)
+	allowed, err := h.local.AllowRate(context.Background(), "degraded:"+key, rate, int(rate), 1)
+	return err == nil && allowed
+}
+
+// status the Redis part of the health check
+func (h *redisHealth) status() gin.H {
+	if !h.Degraded() {
+		return gin.H{"status": "ok"}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return gin.H{
+		"status":          "degraded",
+		"degraded_since":  h.since,
+		"last_error":      h.lastError,
+		"local_qps_ratio": h.ratio,
+	}
+}
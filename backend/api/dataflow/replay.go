@@ -0,0 +1,196 @@
+package dataflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/textdiff"
+	"agent-connector/pkg/textlimit"
+)
+
+// Prompt fields a stored request text belongs to
+const (
+	promptMessages = "messages"
+	promptQuery    = "query"
+	promptData     = "data"
+)
+
+// Replay errors
+var (
+	// ErrNotReplayable the usage record lacks the stored request needed to replay it
+	ErrNotReplayable = errors.New("usage record cannot be replayed")
+	// ErrReplayAgent the replay target agent does not exist or is disabled
+	ErrReplayAgent = errors.New("replay agent is not available")
+)
+
+// replayParameters the request fields besides the prompt, stored next to the usage
+// content; Prompt tells which field the stored request text fills
+type replayParameters struct {
+	Prompt string `json:"prompt"`
+	backends.BackendRequest
+	ForwardMetadata map[string]string `json:"forward_metadata,omitempty"`
+	Locale          string            `json:"locale,omitempty"`
+}
+
+// ReplayResult the answer of a replayed request next to the stored one
+type ReplayResult struct {
+	RecordID          uint            `json:"record_id"`
+	OriginalAgentID   string          `json:"original_agent_id"`
+	AgentID           string          `json:"agent_id"`
+	Success           bool            `json:"success"`
+	Error             string          `json:"error,omitempty"`
+	DurationMs        int64           `json:"duration_ms"`
+	PromptTokens      int             `json:"prompt_tokens"`
+	CompletionTokens  int             `json:"completion_tokens"`
+	TotalTokens       int             `json:"total_tokens"`
+	OriginalResponse  string          `json:"original_response"`
+	OriginalTruncated bool            `json:"original_truncated"`
+	Response          string          `json:"response"`
+	Changed           bool            `json:"changed"`
+	Diff              []textdiff.Line `json:"diff"`
+}
+
+// requestParameters the request without its prompt as stored with the usage record
+func requestParameters(req *backends.BackendRequest) string {
+	parameters := replayParameters{
+		BackendRequest:  *req,
+		ForwardMetadata: req.ForwardMetadata,
+		Locale:          req.Locale,
+	}
+	switch {
+	case len(req.Messages) > 0:
+		parameters.Prompt = promptMessages
+	case req.Query != "":
+		parameters.Prompt = promptQuery
+	case len(req.Data) > 0:
+		parameters.Prompt = promptData
+	}
+	parameters.Messages, parameters.Query, parameters.Data = nil, "", nil
+
+	encoded, err := json.Marshal(parameters)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// replayRequest rebuild the request of a usage record from its stored prompt and parameters
+func replayRequest(record *internal.UsageRecord) (*backends.BackendRequest, error) {
+	content := record.Content
+	if content == nil {
+		return nil, fmt.Errorf("%w: no content was stored", ErrNotReplayable)
+	}
+	if content.Parameters == "" {
+		return nil, fmt.Errorf("%w: the request parameters were not stored", ErrNotReplayable)
+	}
+	// a prompt that filled the size limit was cut, replaying it would send another request
+	if content.Truncated && len(content.Request)+textlimit.MaxClusterBytes > config.GlobalConfig.Usage.MaxContentBytes {
+		return nil, fmt.Errorf("%w: the stored prompt was truncated", ErrNotReplayable)
+	}
+
+	var parameters replayParameters
+	if err := json.Unmarshal([]byte(content.Parameters), &parameters); err != nil {
+		return nil, fmt.Errorf("%w: invalid parameters: %v", ErrNotReplayable, err)
+	}
+
+	req := parameters.BackendRequest
+	req.ForwardMetadata = parameters.ForwardMetadata
+	req.Locale = parameters.Locale
+	switch parameters.Prompt {
+	case promptMessages:
+		if err := json.Unmarshal([]byte(content.Request), &req.Messages); err != nil {
+			return nil, fmt.Errorf("%w: invalid messages: %v", ErrNotReplayable, err)
+		}
+	case promptQuery:
+		req.Query = content.Request
+	case promptData:
+		if err := json.Unmarshal([]byte(content.Request), &req.Data); err != nil {
+			return nil, fmt.Errorf("%w: invalid workflow data: %v", ErrNotReplayable, err)
+		}
+	}
+
+	// the answer is compared as a whole, streamed requests are replayed blocking
+	req.Stream = false
+	if req.ResponseMode == "streaming" {
+		req.ResponseMode = "blocking"
+	}
+	return &req, nil
+}
+
+// Replay send the stored request of a usage record again, to the agent that answered
+// it or to agentID, and diff the new answer against the stored one. The agent's URL
+// and key are looked up again, hedging and rate limits do not apply and the replay
+// is not recorded as usage. A failing upstream call is reported in the result.
+func (s *DataflowService) Replay(ctx context.Context, record *internal.UsageRecord, agentID string) (*ReplayResult, error) {
+	req, err := replayRequest(record)
+	if err != nil {
+		return nil, err
+	}
+	if agentID == "" {
+		agentID = record.AgentID
+	}
+	req.AgentID = agentID
+
+	agentInfo, err := s.getAgentInfo(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReplayAgent, err)
+	}
+	if !agentInfo.Enabled {
+		return nil, fmt.Errorf("%w: agent %s is disabled", ErrReplayAgent, agentID)
+	}
+
+	result := &ReplayResult{
+		RecordID:          record.ID,
+		OriginalAgentID:   record.AgentID,
+		AgentID:           agentID,
+		OriginalResponse:  record.Content.Response,
+		OriginalTruncated: record.Content.Truncated,
+	}
+
+	start := time.Now()
+	response, err := s.sendReplay(ctx, req, agentInfo)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = textRedactor().Redact(err.Error())
+	} else {
+		var usage TokenUsage
+		usage.observe(response)
+		result.Success = true
+		result.PromptTokens, result.CompletionTokens, result.TotalTokens = usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens
+		// redacted like the stored answer, so masked text does not show up as a change
+		result.Response = textRedactor().Redact(responseText(response))
+	}
+
+	result.Diff = textdiff.Lines(result.OriginalResponse, result.Response)
+	result.Changed = textdiff.Changed(result.Diff)
+	return result, nil
+}
+
+// sendReplay send one blocking request straight to the agent
+func (s *DataflowService) sendReplay(ctx context.Context, req *backends.BackendRequest, agentInfo *backends.AgentInfo) (interface{}, error) {
+	backend, err := s.factory.CreateBackend(backends.DetermineAgentType(agentInfo.Type))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backend: %w", err)
+	}
+	if err := backend.ValidateRequest(req); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+
+	httpReq, err := backend.BuildForwardRequest(ctx, req, agentInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build forward request: %w", err)
+	}
+	setMetadataHeaders(httpReq, req)
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	return backend.ProcessBlockingResponse(resp)
+}
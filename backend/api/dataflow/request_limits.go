@@ -0,0 +1,119 @@
+package dataflow
+
+import (
+	"fmt"
+	"net/http"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request limits a payload can exceed
+const (
+	limitMaxMessages     = "max_messages"
+	limitMaxMessageBytes = "max_message_bytes"
+	limitMaxInputs       = "max_inputs"
+)
+
+// RequestLimitError a request payload beyond one of the request limits
+type RequestLimitError struct {
+	Limit   string `json:"limit"`
+	Max     int    `json:"max"`
+	Actual  int    `json:"actual"`
+	Message *int   `json:"message,omitempty"` // index of the oversized message
+}
+
+// Error implements error
+func (e *RequestLimitError) Error() string {
+	switch {
+	case e.Limit == limitMaxMessages:
+		return fmt.Sprintf("request has %d messages, at most %d are allowed", e.Actual, e.Max)
+	case e.Limit == limitMaxMessageBytes && e.Message != nil:
+		return fmt.Sprintf("message %d has %d bytes, at most %d are allowed", *e.Message, e.Actual, e.Max)
+	case e.Limit == limitMaxMessageBytes:
+		return fmt.Sprintf("query has %d bytes, at most %d are allowed", e.Actual, e.Max)
+	default:
+		return fmt.Sprintf("request has %d inputs, at most %d are allowed", e.Actual, e.Max)
+	}
+}
+
+// requestLimits the caps of a request: those the agent sets, the ones of the route for
+// the rest
+func requestLimits(route string, agentInfo *AgentInfo) config.RequestLimitsConfig {
+	var limits config.RequestLimitsConfig
+	if cfg := config.GlobalConfig; cfg != nil {
+		limits = cfg.API.RequestLimitsFor(route)
+	}
+	if agentInfo == nil {
+		return limits
+	}
+	if agentInfo.MaxMessages > 0 {
+		limits.MaxMessages = agentInfo.MaxMessages
+	}
+	if agentInfo.MaxMessageBytes > 0 {
+		limits.MaxMessageBytes = agentInfo.MaxMessageBytes
+	}
+	if agentInfo.MaxInputs > 0 {
+		limits.MaxInputs = agentInfo.MaxInputs
+	}
+	return limits
+}
+
+// checkRequestLimits the first limit the request exceeds, nil when it is within all
+func checkRequestLimits(limits config.RequestLimitsConfig, req *backends.BackendRequest) *RequestLimitError {
+	if limits.MaxMessages > 0 && len(req.Messages) > limits.MaxMessages {
+		return &RequestLimitError{Limit: limitMaxMessages, Max: limits.MaxMessages, Actual: len(req.Messages)}
+	}
+	if limits.MaxMessageBytes > 0 {
+		for i, message := range req.Messages {
+			if len(message.Content) > limits.MaxMessageBytes {
+				index := i
+				return &RequestLimitError{Limit: limitMaxMessageBytes, Max: limits.MaxMessageBytes, Actual: len(message.Content), Message: &index}
+			}
+		}
+		if len(req.Query) > limits.MaxMessageBytes {
+			return &RequestLimitError{Limit: limitMaxMessageBytes, Max: limits.MaxMessageBytes, Actual: len(req.Query)}
+		}
+	}
+	// Dify chat inputs, or the inputs of a workflow run
+	inputs := len(req.Inputs) + len(req.Data)
+	if limits.MaxInputs > 0 && inputs > limits.MaxInputs {
+		return &RequestLimitError{Limit: limitMaxInputs, Max: limits.MaxInputs, Actual: inputs}
+	}
+	return nil
+}
+
+// applyRequestLimits reject a payload beyond the request limits of its agent and route
+// before anything is done with it. Writes the error response and returns false when
+// the request is rejected.
+func (h *DataFlowAPIHandler) applyRequestLimits(c *gin.Context, authInfo *AuthInfo, req *backends.BackendRequest) bool {
+	agentInfo := authInfo.Agent
+	if req.AgentID != authInfo.AgentID || agentInfo == nil {
+		agent, err := internal.LookupAgentByAgentID(req.AgentID)
+		if err != nil {
+			// unknown agents are reported when the request is processed
+			agentInfo = nil
+		} else {
+			agentInfo = newAgentInfo(agent)
+		}
+	}
+
+	limitErr := checkRequestLimits(requestLimits(c.FullPath(), agentInfo), req)
+	if limitErr == nil {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, DataFlowResponse{
+		Code:    http.StatusBadRequest,
+		Message: "Request limit exceeded",
+		Error: &APIError{
+			Type:    "request_limit_exceeded",
+			Code:    "400",
+			Message: limitErr.Error(),
+			Details: limitErr,
+		},
+	})
+	return false
+}
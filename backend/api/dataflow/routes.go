@@ -1,6 +1,7 @@
 package dataflow
 
 import (
+	"agent-connector/config"
 	"agent-connector/pkg/ratelimiter"
 
 	"github.com/gin-gonic/gin"
@@ -13,13 +14,20 @@ func SetupBackendRoutes(router *gin.Engine, rateLimiter *ratelimiter.RedisRateLi
 
 	// Create middleware
 	middleware := NewDataFlowMiddleware()
+	handler.rateLimits = middleware.rateLimiterManager
+	handler.admission = middleware
 
 	// Create API group
 	api := router.Group("/api/v1")
 
 	// Apply middleware
 	api.Use(middleware.AuthenticationMiddleware())
+	api.Use(middleware.SignatureMiddleware())
+	api.Use(middleware.AccessWindowMiddleware())
+	api.Use(middleware.MaintenanceMiddleware())
 	api.Use(middleware.RateLimitMiddleware())
+	api.Use(middleware.QueueAdmissionMiddleware())
+	api.Use(middleware.ChaosMiddleware())
 
 	// OpenAI Compatible Routes
 	openai := api.Group("/openai")
@@ -35,10 +43,61 @@ func SetupBackendRoutes(router *gin.Engine, rateLimiter *ratelimiter.RedisRateLi
 
 		// Workflow API
 		dify.POST("/workflows/run", handler.HandleDifyWorkflow)
+
+		// App descriptions for client UIs, cached
+		dify.GET("/parameters", handler.HandleDifyParameters)
+		dify.GET("/meta", handler.HandleDifyMeta)
+		dify.GET("/messages/:message_id/suggested", handler.HandleDifySuggestedQuestions)
 	}
 
 	// Health check
 	api.GET("/health", handler.HealthCheck)
+
+	// Other OpenAI routes are forwarded verbatim to agents with passthrough enabled
+	router.NoRoute(
+		handler.passthroughOnly,
+		middleware.AuthenticationMiddleware(),
+		middleware.SignatureMiddleware(),
+		middleware.AccessWindowMiddleware(),
+		middleware.MaintenanceMiddleware(),
+		middleware.RateLimitMiddleware(),
+		middleware.QueueAdmissionMiddleware(),
+		middleware.ChaosMiddleware(),
+		handler.HandleOpenAIPassthrough,
+	)
+
+	// Stopping a running request skips the rate limit and queue the request itself went through
+	requests := router.Group("/api/v1/requests")
+	requests.Use(middleware.AuthenticationMiddleware())
+	requests.Use(middleware.SignatureMiddleware())
+	requests.POST("/:request_id/cancel", handler.HandleCancelRequest)
+
+	// Session variables and conversations are state of the client, kept outside the request limits
+	sessions := router.Group("/api/v1/sessions")
+	sessions.Use(middleware.AuthenticationMiddleware())
+	sessions.Use(middleware.SignatureMiddleware())
+	sessions.Use(middleware.AccessWindowMiddleware())
+	sessions.GET("/:session_id/variables", handler.HandleGetSessionVariables)
+	sessions.PUT("/:session_id/variables", handler.HandleSetSessionVariables)
+	sessions.DELETE("/:session_id/variables", handler.HandleDeleteSessionVariables)
+	sessions.GET("/:session_id/conversations", handler.HandleGetSessionConversations)
+	sessions.DELETE("/:session_id/conversations", handler.HandleDeleteSessionConversations)
+
+	// Reading the usage does not count against the limits it reports
+	usage := router.Group("/api/v1/usage")
+	usage.Use(middleware.AuthenticationMiddleware())
+	usage.Use(middleware.SignatureMiddleware())
+	usage.Use(middleware.AccessWindowMiddleware())
+	usage.GET("/me", handler.HandleUsageMe)
+
+	// Saturation gauges for autoscaling, scraped without an API key
+	if cfg := config.GlobalConfig; cfg != nil && cfg.API.EnableMetrics {
+		metricsPath := cfg.API.MetricsPath
+		if metricsPath == "" {
+			metricsPath = "/metrics"
+		}
+		router.GET(metricsPath, handler.HandleMetrics)
+	}
 }
 
 // SetupLegacyRoutes setup legacy routes for backward compatibility
@@ -52,9 +111,15 @@ func SetupLegacyRoutes(router *gin.Engine, rateLimiter *ratelimiter.RedisRateLim
 	// Create API group
 	api := router.Group("/api/v1")
 
-	// Apply middleware
+	// Apply middleware, a retired endpoint answers before anything else runs
+	api.Use(middleware.LegacySunsetMiddleware())
 	api.Use(middleware.AuthenticationMiddleware())
+	api.Use(middleware.SignatureMiddleware())
+	api.Use(middleware.AccessWindowMiddleware())
+	api.Use(middleware.MaintenanceMiddleware())
 	api.Use(middleware.RateLimitMiddleware())
+	api.Use(middleware.QueueAdmissionMiddleware())
+	api.Use(middleware.ChaosMiddleware())
 
 	// Legacy unified endpoint
 	api.POST("/chat", legacyHandler.HandleChat)
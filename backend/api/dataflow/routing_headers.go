@@ -0,0 +1,103 @@
+package dataflow
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routingHeadersRequest the request header a client opts in to the routing headers with
+const routingHeadersRequest = "X-AC-Routing"
+
+// Routing headers describing how the request was routed
+const (
+	routingAgentHeader     = "X-AC-Agent-Id"      // the agent that answered
+	routingModelHeader     = "X-AC-Model"         // the model of the answer, or else the requested one
+	routingStrategyHeader  = "X-AC-Strategy"      // how the agent was chosen
+	routingQueueWaitHeader = "X-AC-Queue-Wait-Ms" // from admission to the agent queue to the upstream call
+)
+
+// Routing strategies, how the agent of a request was chosen
+const (
+	routeAgentID     = "agent_id"     // named by the request
+	routeAPIKey      = "api_key"      // the agent of the connector key or playground token
+	routeUserDefault = "user_default" // the default agent of the platform user
+	routeHedge       = "hedge"        // the hedge agent answered first
+)
+
+// queueAdmittedAtKey the gin context key of the time the request joined the agent queue
+const queueAdmittedAtKey = "queueAdmittedAt"
+
+// routingDecision how a request was routed, kept in its context when the client asked
+// for the routing headers
+type routingDecision struct {
+	strategy  string
+	queued    bool
+	queueWait time.Duration
+}
+
+// routingContextKey context key of the routing decision
+type routingContextKey struct{}
+
+// wantsRoutingHeaders whether the client opted in to the routing headers
+func wantsRoutingHeaders(c *gin.Context) bool {
+	value := strings.ToLower(strings.TrimSpace(c.GetHeader(routingHeadersRequest)))
+	return value == "1" || value == "true"
+}
+
+// recordRouting keep the routing decision of a request about to be sent upstream in its
+// context, when the client opted in to the routing headers; the time in the queue ends here
+func recordRouting(c *gin.Context) {
+	if !wantsRoutingHeaders(c) {
+		return
+	}
+	decision := &routingDecision{strategy: routeAPIKey}
+	if authInfo, err := GetAuthInfoFromContext(c); err == nil && authInfo.Route != "" {
+		decision.strategy = authInfo.Route
+	}
+	if value, ok := c.Get(queueAdmittedAtKey); ok {
+		if admittedAt, ok := value.(time.Time); ok {
+			decision.queued = true
+			decision.queueWait = time.Since(admittedAt)
+		}
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), routingContextKey{}, decision))
+}
+
+// setRoutingHeaders write the routing headers of the request, when its client opted in;
+// model is the model of the answer, empty for the requested one
+func setRoutingHeaders(ctx context.Context, header http.Header, req *backends.BackendRequest, model string) {
+	decision, _ := ctx.Value(routingContextKey{}).(*routingDecision)
+	if decision == nil {
+		return
+	}
+
+	agentID, strategy := req.AgentID, decision.strategy
+	if req.HedgedTo != "" {
+		agentID, strategy = req.HedgedTo, routeHedge
+	}
+	header.Set(routingAgentHeader, agentID)
+	header.Set(routingStrategyHeader, strategy)
+	if model == "" {
+		model = req.Model
+	}
+	if model != "" {
+		header.Set(routingModelHeader, model)
+	}
+	if decision.queued {
+		header.Set(routingQueueWaitHeader, strconv.FormatInt(decision.queueWait.Milliseconds(), 10))
+	}
+}
+
+// responseModel the model named by a decoded OpenAI response, empty when there is none
+func responseModel(response interface{}) string {
+	body, _ := response.(map[string]interface{})
+	model, _ := body["model"].(string)
+	return model
+}
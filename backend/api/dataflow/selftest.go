@@ -0,0 +1,172 @@
+package dataflow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+	"agent-connector/pkg/recorder"
+	"agent-connector/pkg/types"
+)
+
+const (
+	// selfTestTimeout bounds the probe of one agent
+	selfTestTimeout = 10 * time.Second
+
+	// selfTestConcurrency agents probed at the same time
+	selfTestConcurrency = 8
+)
+
+// SelfTestResult outcome of probing one agent; the status is one of the validation
+// check results
+type SelfTestResult struct {
+	AgentID    string `json:"agent_id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+	Message    string `json:"message,omitempty"`
+}
+
+// SelfTestReport readiness of every enabled agent, Ready is false when a probe failed
+type SelfTestReport struct {
+	Ready     bool              `json:"ready"`
+	Agents    []*SelfTestResult `json:"agents"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// ExitCode process exit code for the report, 1 when an agent is not ready
+func (r *SelfTestReport) ExitCode() int {
+	if r.Ready {
+		return 0
+	}
+	return 1
+}
+
+// WriteMatrix the report as a table with one agent per line
+func (r *SelfTestReport) WriteMatrix(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "AGENT\tTYPE\tSTATUS\tHTTP\tLATENCY\tMESSAGE")
+	for _, result := range r.Agents {
+		httpStatus := "-"
+		if result.HTTPStatus != 0 {
+			httpStatus = fmt.Sprint(result.HTTPStatus)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%dms\t%s\n",
+			result.AgentID, result.Type, result.Status, httpStatus, result.LatencyMs, result.Message)
+	}
+	return table.Flush()
+}
+
+// RunSelfTest probe the upstream of every enabled agent with a request that needs its
+// URL and API key but generates nothing. Mock agents and agents replaying fixtures have
+// no upstream and are skipped.
+func RunSelfTest(ctx context.Context) (*SelfTestReport, error) {
+	agents, err := (&internal.AgentService{}).ListEnabledAgents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agents: %w", err)
+	}
+
+	report := &SelfTestReport{Ready: true, Agents: make([]*SelfTestResult, len(agents)), CheckedAt: time.Now()}
+	factory := backends.NewDefaultBackendFactory()
+	client := &http.Client{Timeout: selfTestTimeout}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, selfTestConcurrency)
+	for i, agent := range agents {
+		wg.Add(1)
+		go func(i int, agent *internal.Agent) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			report.Agents[i] = probeAgent(ctx, client, factory, agent)
+		}(i, agent)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Agents, func(i, j int) bool {
+		return report.Agents[i].AgentID < report.Agents[j].AgentID
+	})
+	for _, result := range report.Agents {
+		if result.Status == internal.ValidationFailed {
+			report.Ready = false
+		}
+	}
+	return report, nil
+}
+
+// probeAgent send the probe of the agent's backend and classify the answer
+func probeAgent(ctx context.Context, client *http.Client, factory backends.BackendFactory, agent *internal.Agent) *SelfTestResult {
+	result := &SelfTestResult{AgentID: agent.AgentID, Name: agent.Name, Type: string(agent.Type), Status: internal.ValidationPassed}
+
+	switch {
+	case agent.Type == types.AgentTypeMock:
+		result.Status, result.Message = internal.ValidationSkipped, "mock agent, answered in process"
+		return result
+	case agent.RecordMode == string(recorder.ModeReplay):
+		result.Status, result.Message = internal.ValidationSkipped, "replays recorded fixtures"
+		return result
+	}
+
+	backend, err := factory.CreateBackend(backends.DetermineAgentType(string(agent.Type)))
+	if err != nil {
+		result.Status, result.Message = internal.ValidationFailed, err.Error()
+		return result
+	}
+	prober, ok := backend.(backends.Prober)
+	if !ok {
+		result.Status, result.Message = internal.ValidationSkipped, "no probe for this agent type"
+		return result
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+	httpReq, err := prober.BuildProbeRequest(probeCtx, &backends.AgentInfo{
+		ID:           agent.ID,
+		Name:         agent.Name,
+		Type:         string(agent.Type),
+		URL:          agent.URL,
+		SourceAPIKey: agent.SourceAPIKey,
+	})
+	if err != nil {
+		result.Status, result.Message = internal.ValidationFailed, err.Error()
+		return result
+	}
+
+	started := time.Now()
+	resp, err := client.Do(httpReq)
+	result.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Status, result.Message = internal.ValidationFailed, fmt.Sprintf("upstream unreachable: %v", err)
+		return result
+	}
+	result.HTTPStatus = resp.StatusCode
+	if resp.StatusCode == http.StatusOK {
+		resp.Body.Close()
+		return result
+	}
+
+	result.Status = internal.ValidationFailed
+	upstreamErr := backends.UpstreamError(resp)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		// the key was accepted, the upstream only limits it right now
+		result.Status = internal.ValidationWarning
+		result.Message = fmt.Sprintf("rate limited by the upstream (%v)", upstreamErr)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		result.Message = fmt.Sprintf("credentials rejected, check the source API key (%v)", upstreamErr)
+	case http.StatusNotFound:
+		result.Message = fmt.Sprintf("endpoint not found, check the URL (%v)", upstreamErr)
+	default:
+		result.Message = upstreamErr.Error()
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +13,12 @@ import (
 	"time"
 
 	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/mockagent"
 	"agent-connector/pkg/ratelimiter"
+	"agent-connector/pkg/recorder"
+	"agent-connector/pkg/textlimit"
 )
 
 // DataflowService handles dataflow operations with different agent backends
@@ -25,12 +31,22 @@ type DataflowService struct {
 
 // NewDataflowService creates a new dataflow service
 func NewDataflowService(rateLimiter *ratelimiter.RedisRateLimiter) *DataflowService {
+	// mock agents are answered in process
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.RegisterProtocol(mockagent.Scheme, mockagent.NewTransport())
+
+	fixturesDir := "fixtures/upstream"
+	if config.GlobalConfig != nil && config.GlobalConfig.API.FixturesDir != "" {
+		fixturesDir = config.GlobalConfig.API.FixturesDir
+	}
+
 	return &DataflowService{
 		factory:     backends.NewDefaultBackendFactory(),
 		rateLimiter: rateLimiter,
 		authService: NewDataFlowAuthService(),
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: recorder.NewTransport(transport, fixturesDir),
 		},
 	}
 }
@@ -62,47 +78,64 @@ func (s *DataflowService) ProcessRequest(ctx context.Context, req *backends.Back
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
+	// Continue the Dify conversation of the client's session
+	conversation := startConversationSession(ctx, req, backendType)
+	titler := s.startConversationTitle(req)
+
 	// Check rate limit
-	if err := s.checkRateLimit(ctx, req.AgentID); err != nil {
-		return nil, fmt.Errorf("rate limit exceeded: %w", err)
+	if err := s.checkRateLimit(ctx, req, agentInfo); err != nil {
+		return nil, err
 	}
 
-	// Build forward request
-	httpReq, err := backend.BuildForwardRequest(ctx, req, agentInfo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build forward request: %w", err)
+	// Fit the prompt into the agent's context window
+	if err := s.fitContext(ctx, req, backend, agentInfo); err != nil {
+		return nil, err
 	}
 
-	// Execute request
-	resp, err := s.httpClient.Do(httpReq)
+	// Execute request, hedged when the agent has a hedge agent
+	start := time.Now()
+	resp, backend, err := s.execute(ctx, req, backend, agentInfo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
 
 	// Process response based on streaming mode
 	if req.Stream || req.ResponseMode == "streaming" {
 		return s.processStreamingResponse(backend, resp)
-	} else {
-		return backend.ProcessBlockingResponse(resp)
 	}
+	response, err := backend.ProcessBlockingResponse(resp)
+	if err == nil {
+		s.observeUpstreamLatency(req, agentInfo, start, time.Time{})
+	}
+	if conversation != nil {
+		conversation.observe(response)
+		conversation.finish(ctx, req, err)
+	}
+	if titler != nil {
+		titler.observe(response)
+		titler.finish(err)
+	}
+	return response, err
 }
 
-// ProcessStreamingRequest processes a streaming dataflow request
-func (s *DataflowService) ProcessStreamingRequest(ctx context.Context, req *backends.BackendRequest, w http.ResponseWriter) error {
+// ProcessStreamingRequest processes a streaming dataflow request, returning the token
+// usage the agent reported in the stream; content receives the streamed text, which is
+// re-batched for the client when chunking is set
+func (s *DataflowService) ProcessStreamingRequest(ctx context.Context, req *backends.BackendRequest, w http.ResponseWriter, content *contentTee, chunking *streamChunking) (TokenUsage, error) {
 	// Get agent information
 	agentInfo, err := s.getAgentInfo(req.AgentID)
 	if err != nil {
-		return fmt.Errorf("failed to get agent info: %w", err)
+		return TokenUsage{}, fmt.Errorf("failed to get agent info: %w", err)
 	}
 
 	// Check if agent is enabled
 	if !agentInfo.Enabled {
-		return fmt.Errorf("agent %s is disabled", req.AgentID)
+		return TokenUsage{}, fmt.Errorf("agent %s is disabled", req.AgentID)
 	}
 
 	// Check if agent supports streaming
 	if !agentInfo.SupportStreaming {
-		return fmt.Errorf("agent %s does not support streaming", req.AgentID)
+		return TokenUsage{}, fmt.Errorf("agent %s does not support streaming", req.AgentID)
 	}
 
 	// Determine backend type
@@ -111,7 +144,7 @@ func (s *DataflowService) ProcessStreamingRequest(ctx context.Context, req *back
 	// Create backend instance
 	backend, err := s.factory.CreateBackend(backendType)
 	if err != nil {
-		return fmt.Errorf("failed to create backend: %w", err)
+		return TokenUsage{}, fmt.Errorf("failed to create backend: %w", err)
 	}
 
 	// Ensure streaming mode
@@ -120,42 +153,97 @@ func (s *DataflowService) ProcessStreamingRequest(ctx context.Context, req *back
 
 	// Validate request for this backend
 	if err := backend.ValidateRequest(req); err != nil {
-		return fmt.Errorf("request validation failed: %w", err)
+		return TokenUsage{}, fmt.Errorf("request validation failed: %w", err)
 	}
 
+	// Continue the Dify conversation of the client's session
+	conversation := startConversationSession(ctx, req, backendType)
+	titler := s.startConversationTitle(req)
+
 	// Check rate limit
-	if err := s.checkRateLimit(ctx, req.AgentID); err != nil {
-		return fmt.Errorf("rate limit exceeded: %w", err)
+	if err := s.checkRateLimit(ctx, req, agentInfo); err != nil {
+		return TokenUsage{}, err
 	}
 
-	// Build forward request
-	httpReq, err := backend.BuildForwardRequest(ctx, req, agentInfo)
-	if err != nil {
-		return fmt.Errorf("failed to build forward request: %w", err)
+	// Fit the prompt into the agent's context window
+	if err := s.fitContext(ctx, req, backend, agentInfo); err != nil {
+		return TokenUsage{}, err
 	}
 
-	// Execute request
-	resp, err := s.httpClient.Do(httpReq)
+	// Execute request, hedged when the agent has a hedge agent
+	start := time.Now()
+	resp, backend, err := s.execute(ctx, req, backend, agentInfo)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return TokenUsage{}, err
 	}
 	defer resp.Body.Close()
 
+	// Remember the answering agent so the stream can be stopped upstream
+	tracked := trackedRequest(ctx)
+	if tracked != nil {
+		upstreamInfo := agentInfo
+		if req.HedgedTo != "" {
+			if hedgeInfo, err := s.getAgentInfo(req.HedgedTo); err == nil {
+				upstreamInfo = hedgeInfo
+			}
+		}
+		tracked.setUpstream(backend, upstreamInfo, req.User)
+	}
+
 	// Process streaming response
 	streamReader, err := backend.ProcessStreamingResponse(resp)
 	if err != nil {
-		return fmt.Errorf("failed to process streaming response: %w", err)
+		conversation.finish(ctx, req, err)
+		return TokenUsage{}, fmt.Errorf("failed to process streaming response: %w", err)
 	}
 	defer streamReader.Close()
 
 	// Set response headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	setSSEHeaders(w.Header())
+	if req.HedgedTo != "" {
+		w.Header().Set(hedgedAgentHeader, req.HedgedTo)
+	}
+	setRoutingHeaders(ctx, w.Header(), req, "")
+	setWarningHeaders(w.Header(), req)
+	if chunking != nil {
+		w.Header().Set(streamChunkingHeader, chunking.String())
+	}
 
-	// Stream response
-	return s.streamResponse(streamReader, w)
+	// Stream response, recovering when the upstream breaks off; a stream cut because the
+	// client went away stops here, closing the upstream body cancels the agent's generation
+	var usage TokenUsage
+	firstToken := &firstTokenTimer{}
+	observers := []chunkObserver{&usage, content, firstToken}
+	if tracked != nil {
+		observers = append(observers, tracked)
+	}
+	// pace the stream after the observers above have seen the chunk
+	if conversation != nil {
+		observers = append(observers, conversation)
+		defer func() { conversation.finish(ctx, req, nil) }()
+	}
+	if titler != nil {
+		observers = append(observers, titler)
+	}
+	if pacer := newStreamPacer(ctx, agentInfo.StreamTokenRate); pacer != nil {
+		observers = append(observers, pacer)
+	}
+	progress := &streamProgress{keepText: agentInfo.ContinueOnInterrupt}
+	err = s.streamResponse(streamReader, w, chunking, append(observers, progress)...)
+	if err != nil && ctx.Err() != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, errRouteTimeout) || errors.Is(cause, errGenerationStopped) {
+			return usage, fmt.Errorf("%w after %d bytes of content", cause, progress.length)
+		}
+		return usage, fmt.Errorf("%w after %d bytes of content", errClientCancelled, progress.length)
+	}
+	if errors.Is(err, errStreamInterrupted) {
+		err = s.recoverStream(ctx, req, agentInfo, w, chunking, err, progress, observers...)
+	}
+	if err == nil {
+		s.observeUpstreamLatency(req, agentInfo, start, firstToken.at)
+	}
+	titler.finish(err)
+	return usage, err
 }
 
 // getAgentInfo retrieves agent information from database using existing auth service
@@ -166,54 +254,105 @@ func (s *DataflowService) getAgentInfo(agentID string) (*backends.AgentInfo, err
 	authInfo, err := s.authService.AuthenticateRequest(agentID, "dummy_key")
 	if err != nil {
 		// If authentication fails, try to get agent directly
-		agent, err := s.authService.agentService.GetAgentByAgentID(agentID)
+		agent, err := s.authService.findAgentByAgentID(agentID)
 		if err != nil {
 			return nil, fmt.Errorf("agent not found: %w", err)
 		}
 
 		return &backends.AgentInfo{
-			ID:               agent.ID,
-			Name:             agent.Name,
-			Type:             string(agent.Type),
-			URL:              agent.URL,
-			SourceAPIKey:     agent.SourceAPIKey,
-			QPS:              agent.QPS,
-			Enabled:          agent.Enabled,
-			SupportStreaming: agent.SupportStreaming,
-			ResponseFormat:   agent.ResponseFormat,
+			ID:                  agent.ID,
+			Name:                agent.Name,
+			Type:                string(agent.Type),
+			URL:                 agent.URL,
+			SourceAPIKey:        agent.SourceAPIKey,
+			QPS:                 agent.QPS,
+			Enabled:             agent.Enabled,
+			SupportStreaming:    agent.SupportStreaming,
+			ResponseFormat:      agent.ResponseFormat,
+			HedgeAgentID:        agent.HedgeAgentID,
+			HedgeAfterMs:        agent.HedgeAfterMs,
+			ContinueOnInterrupt: agent.ContinueOnInterrupt,
+			ContextWindow:       agent.ContextWindow,
+			ContextOverflow:     agent.ContextOverflow,
+			RecordMode:          agent.RecordMode,
+			StreamTokenRate:     agent.StreamTokenRate,
+			UserQPS:             agent.UserQPS,
 		}, nil
 	}
 
 	return &backends.AgentInfo{
-		ID:               authInfo.Agent.ID,
-		Name:             authInfo.Agent.Name,
-		Type:             authInfo.Agent.Type,
-		URL:              authInfo.Agent.URL,
-		SourceAPIKey:     authInfo.Agent.SourceAPIKey,
-		QPS:              authInfo.Agent.QPS,
-		Enabled:          authInfo.Agent.Enabled,
-		SupportStreaming: authInfo.Agent.SupportStreaming,
-		ResponseFormat:   authInfo.Agent.ResponseFormat,
+		ID:                  authInfo.Agent.ID,
+		Name:                authInfo.Agent.Name,
+		Type:                authInfo.Agent.Type,
+		URL:                 authInfo.Agent.URL,
+		SourceAPIKey:        authInfo.Agent.SourceAPIKey,
+		QPS:                 authInfo.Agent.QPS,
+		Enabled:             authInfo.Agent.Enabled,
+		SupportStreaming:    authInfo.Agent.SupportStreaming,
+		ResponseFormat:      authInfo.Agent.ResponseFormat,
+		HedgeAgentID:        authInfo.Agent.HedgeAgentID,
+		HedgeAfterMs:        authInfo.Agent.HedgeAfterMs,
+		ContinueOnInterrupt: authInfo.Agent.ContinueOnInterrupt,
+		ContextWindow:       authInfo.Agent.ContextWindow,
+		ContextOverflow:     authInfo.Agent.ContextOverflow,
+		RecordMode:          authInfo.Agent.RecordMode,
+		StreamTokenRate:     authInfo.Agent.StreamTokenRate,
+		UserQPS:             authInfo.Agent.UserQPS,
 	}, nil
 }
 
-// checkRateLimit checks if the request is within rate limits
-func (s *DataflowService) checkRateLimit(ctx context.Context, agentID string) error {
+// errUserRateLimited the request is over the default limit of its agent or user
+var errUserRateLimited = errors.New("user rate limit exceeded")
+
+// checkRateLimit checks if the request is within the default limits: every request
+// takes a token from its agent's default bucket, and requests of a platform user
+// authenticated with X-User-Token also from that user's bucket at the agent. The body's
+// user field picks no bucket, as any client can set it. The QPS is resolved per request,
+// see internal.ResolveUserQPS.
+func (s *DataflowService) checkRateLimit(ctx context.Context, req *backends.BackendRequest, agentInfo *backends.AgentInfo) error {
 	if s.rateLimiter == nil {
 		return nil // No rate limiting configured
 	}
+	mode := internal.CurrentSystemConfig().RateLimitMode
+	if mode == internal.RateLimitModeOff {
+		return nil
+	}
 
-	allowed, err := s.rateLimiter.Allow(ctx, agentID)
-	if err != nil {
-		log.Printf("Rate limiter error: %v", err)
-		return nil // Allow request if rate limiter fails
+	if qps := internal.ResolveUserQPS(agentInfo.UserQPS, nil); qps > 0 && !s.allowRate(ctx, "default-qps:"+req.AgentID, qps) {
+		if mode == internal.RateLimitModeMonitor {
+			log.Printf("Agent %s is over the default limit of %d QPS, let through in monitor mode", req.AgentID, qps)
+		} else {
+			return fmt.Errorf("%w: %d QPS of agent %s", errUserRateLimited, qps, req.AgentID)
+		}
 	}
 
-	if !allowed {
-		return fmt.Errorf("rate limit exceeded for agent %s", agentID)
+	user := req.AuthenticatedUser
+	if user == "" {
+		return nil
+	}
+	qps := internal.ResolveUserQPS(agentInfo.UserQPS, userLimits.get(user))
+	if qps <= 0 || s.allowRate(ctx, fmt.Sprintf("user-qps:%s:%s", req.AgentID, user), qps) {
+		return nil
 	}
+	if mode == internal.RateLimitModeMonitor {
+		log.Printf("User %q of agent %s is over the limit of %d QPS, let through in monitor mode", user, req.AgentID, qps)
+		return nil
+	}
+	return fmt.Errorf("%w: %d QPS of user %s at agent %s", errUserRateLimited, qps, user, req.AgentID)
+}
 
-	return nil
+// allowRate take a token from the bucket, from the local limiter while Redis is down
+func (s *DataflowService) allowRate(ctx context.Context, key string, qps int) bool {
+	if redisStatus().Degraded() {
+		return redisStatus().allowLocal(key, qps)
+	}
+	allowed, err := s.rateLimiter.AllowRate(ctx, key, float64(qps), qps*2, 1)
+	if err != nil {
+		log.Printf("Rate limiter error: %v", err)
+		redisStatus().markDown(err)
+		return redisStatus().allowLocal(key, qps)
+	}
+	return allowed
 }
 
 // processStreamingResponse processes streaming response for non-HTTP streaming
@@ -225,15 +364,25 @@ func (s *DataflowService) processStreamingResponse(backend backends.AgentBackend
 	return streamReader, nil
 }
 
-// streamResponse streams the response to the client
-func (s *DataflowService) streamResponse(reader io.ReadCloser, w http.ResponseWriter) error {
+// maxLoggedChunkLength characters of an invalid stream chunk that are logged
+const maxLoggedChunkLength = 200
+
+// chunkObserver learns from every JSON chunk of a forwarded stream
+type chunkObserver interface {
+	observe(payload interface{})
+}
+
+// streamResponse streams the response to the client, passing each chunk to the observers
+// before it is forwarded, re-batched when chunking is set
+func (s *DataflowService) streamResponse(reader io.ReadCloser, w http.ResponseWriter, chunking *streamChunking, observers ...chunkObserver) error {
 	defer reader.Close()
 
 	scanner := bufio.NewScanner(reader)
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		return fmt.Errorf("streaming not supported")
+	events, err := newSSEWriter(w)
+	if err != nil {
+		return err
 	}
+	batcher := newChunkBatcher(events, chunking)
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -255,33 +404,41 @@ func (s *DataflowService) streamResponse(reader io.ReadCloser, w http.ResponseWr
 			// Try to parse as JSON to validate
 			var jsonData interface{}
 			if err := json.Unmarshal([]byte(dataContent), &jsonData); err != nil {
-				log.Printf("Invalid JSON in stream: %s", dataContent)
+				log.Printf("Invalid JSON in stream: %s", textlimit.Ellipsize(textRedactor().Redact(dataContent), maxLoggedChunkLength))
 				continue
 			}
+			for _, observer := range observers {
+				observer.observe(jsonData)
+			}
 
-			// Write the line as-is
-			if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
-				return fmt.Errorf("failed to write response: %w", err)
+			// Forward the data as-is, one flushed event per chunk
+			if err := batcher.write(jsonData, []byte(dataContent)); err != nil {
+				return fmt.Errorf("%w: %v", errClientCancelled, err)
 			}
 		} else {
 			// For non-SSE format, assume it's JSON data
 			var jsonData interface{}
 			if err := json.Unmarshal([]byte(line), &jsonData); err != nil {
-				log.Printf("Invalid JSON in stream: %s", line)
+				log.Printf("Invalid JSON in stream: %s", textlimit.Ellipsize(textRedactor().Redact(line), maxLoggedChunkLength))
 				continue
 			}
+			for _, observer := range observers {
+				observer.observe(jsonData)
+			}
 
 			// Write in SSE format
-			if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
-				return fmt.Errorf("failed to write response: %w", err)
+			if err := batcher.write(jsonData, []byte(line)); err != nil {
+				return fmt.Errorf("%w: %v", errClientCancelled, err)
 			}
 		}
-
-		flusher.Flush()
 	}
 
+	// Send the collected text first, also ahead of an interruption notice
+	if err := batcher.close(); err != nil {
+		return fmt.Errorf("%w: %v", errClientCancelled, err)
+	}
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading stream: %w", err)
+		return fmt.Errorf("%w: %v", errStreamInterrupted, err)
 	}
 
 	return nil
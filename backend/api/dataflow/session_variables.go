@@ -0,0 +1,367 @@
+package dataflow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/pkg/textlimit"
+)
+
+// sessionIDHeader request header naming the session whose variables are injected
+const sessionIDHeader = "X-Session-ID"
+
+// Session variable limits
+const (
+	maxSessionVariables     = 100
+	maxSessionVariableName  = 64
+	maxSessionVariableValue = 8 << 10
+)
+
+// errTooManySessionVariables setting the variables would exceed maxSessionVariables
+var errTooManySessionVariables = fmt.Errorf("a session holds at most %d variables", maxSessionVariables)
+
+var (
+	// sessionIDPattern session IDs become part of a Redis key
+	sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+
+	// sessionVariableNamePattern names usable as template placeholders and Dify inputs
+	sessionVariableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// sessionPlaceholderPattern {{name}} references in message text
+	sessionPlaceholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// SessionVariablesRequest variables to set in a session, a null value removes one
+type SessionVariablesRequest struct {
+	Variables map[string]json.RawMessage `json:"variables" binding:"required"`
+}
+
+// SessionVariablesResponse the variables of a session
+type SessionVariablesResponse struct {
+	SessionID string                 `json:"session_id"`
+	Variables map[string]interface{} `json:"variables"`
+	ExpiresIn int64                  `json:"expires_in"` // seconds until the session is dropped without changes
+}
+
+// sessionVariableStore key/value variables per API key and session shared by all
+// dataflow instances; every session is a Redis hash of JSON values expiring ttl after
+// its last change
+type sessionVariableStore struct {
+	client    *redis.Client
+	ttl       time.Duration
+	keyPrefix string
+}
+
+// newSessionVariableStore create the store from the global config, nil when it is
+// switched off or Redis is not reachable
+func newSessionVariableStore() *sessionVariableStore {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.API.SessionVariableTTL <= 0 {
+		return nil
+	}
+
+	redisAddr := cfg.Redis.Addr
+	if redisAddr == "" {
+		redisAddr = "localhost:6379" // fallback default
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		log.Printf("Session variables disabled: %v", err)
+		return nil
+	}
+
+	return &sessionVariableStore{
+		client:    client,
+		ttl:       cfg.API.SessionVariableTTL,
+		keyPrefix: "agent-connector:session-vars:",
+	}
+}
+
+// key the hash of a session, scoped to the API key so a key only reaches its own
+// sessions; the API key is stored as a hash
+func (s *sessionVariableStore) key(apiKey, sessionID string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return s.keyPrefix + hex.EncodeToString(sum[:16]) + ":" + sessionID
+}
+
+// Get the variables of a session, empty when it has none
+func (s *sessionVariableStore) Get(ctx context.Context, apiKey, sessionID string) (map[string]interface{}, error) {
+	fields, err := s.client.HGetAll(ctx, s.key(apiKey, sessionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	variables := make(map[string]interface{}, len(fields))
+	for name, raw := range fields {
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			continue
+		}
+		variables[name] = value
+	}
+	return variables, nil
+}
+
+// Set merge variables into a session and restart its expiry; null values remove
+// the variable
+func (s *sessionVariableStore) Set(ctx context.Context, apiKey, sessionID string, variables map[string]json.RawMessage) error {
+	key := s.key(apiKey, sessionID)
+
+	values := make(map[string]interface{})
+	var removed []string
+	for name, raw := range variables {
+		if string(raw) == "null" {
+			removed = append(removed, name)
+			continue
+		}
+		values[name] = string(raw)
+	}
+
+	// the limit counts the variables the session ends up with
+	if len(values) > 0 {
+		existing, err := s.client.HKeys(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		count := len(values)
+		for _, name := range existing {
+			if _, updated := values[name]; !updated && !containsString(removed, name) {
+				count++
+			}
+		}
+		if count > maxSessionVariables {
+			return errTooManySessionVariables
+		}
+	}
+
+	pipe := s.client.TxPipeline()
+	if len(removed) > 0 {
+		pipe.HDel(ctx, key, removed...)
+	}
+	if len(values) > 0 {
+		pipe.HSet(ctx, key, values)
+	}
+	pipe.PExpire(ctx, key, s.ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Delete drop all variables of a session
+func (s *sessionVariableStore) Delete(ctx context.Context, apiKey, sessionID string) error {
+	return s.client.Del(ctx, s.key(apiKey, sessionID)).Err()
+}
+
+// containsString report whether values holds value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSessionVariables check names and sizes of variables to set
+func validateSessionVariables(variables map[string]json.RawMessage) error {
+	if len(variables) > maxSessionVariables {
+		return fmt.Errorf("at most %d variables can be set at once", maxSessionVariables)
+	}
+	for name, raw := range variables {
+		if len(name) > maxSessionVariableName || !sessionVariableNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q: letters, digits and underscores, at most %d characters", textlimit.Ellipsize(name, maxSessionVariableName), maxSessionVariableName)
+		}
+		if len(raw) > maxSessionVariableValue {
+			return fmt.Errorf("value of variable %s exceeds %d bytes", name, maxSessionVariableValue)
+		}
+	}
+	return nil
+}
+
+// applySessionVariables inject the variables of the session named by X-Session-ID:
+// Dify inputs the request leaves out are filled from them and {{name}} placeholders
+// of the messages and query are replaced. Redis errors leave the request as it is.
+// The session is kept on the request to continue its Dify conversation.
+func (h *DataFlowAPIHandler) applySessionVariables(c *gin.Context, req *backends.BackendRequest) {
+	sessionID := c.GetHeader(sessionIDHeader)
+	if sessionID == "" || !sessionIDPattern.MatchString(sessionID) {
+		return
+	}
+	req.SessionID = sessionID
+	if h.sessions == nil {
+		return
+	}
+
+	variables, err := h.sessions.Get(c.Request.Context(), req.APIKey, sessionID)
+	if err != nil {
+		log.Printf("Failed to load variables of session %s: %v", sessionID, err)
+		return
+	}
+	if len(variables) == 0 {
+		return
+	}
+
+	// OpenAI messages only take placeholders, a Dify request without query is a workflow run
+	switch {
+	case len(req.Messages) > 0:
+	case req.Query != "":
+		req.Inputs = mergeSessionInputs(req.Inputs, variables)
+	default:
+		req.Data = mergeSessionInputs(req.Data, variables)
+	}
+
+	req.Query = expandSessionPlaceholders(req.Query, variables)
+	for i := range req.Messages {
+		req.Messages[i].Content = expandSessionPlaceholders(req.Messages[i].Content, variables)
+	}
+}
+
+// mergeSessionInputs the inputs with the variables they do not set themselves
+func mergeSessionInputs(inputs, variables map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(inputs)+len(variables))
+	for name, value := range variables {
+		merged[name] = value
+	}
+	for name, value := range inputs {
+		merged[name] = value
+	}
+	return merged
+}
+
+// expandSessionPlaceholders replace the {{name}} placeholders of known variables,
+// unknown ones are left for the upstream template
+func expandSessionPlaceholders(text string, variables map[string]interface{}) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	return sessionPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := sessionPlaceholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := variables[name]
+		if !ok {
+			return placeholder
+		}
+		if text, ok := value.(string); ok {
+			return text
+		}
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	})
+}
+
+// bindSessionID the session of the path, false after answering when it is unusable
+func (h *DataFlowAPIHandler) bindSessionID(c *gin.Context) (string, bool) {
+	if h.sessions == nil {
+		h.respondWithError(c, http.StatusServiceUnavailable, "service_unavailable", "Session variables are not enabled")
+		return "", false
+	}
+	sessionID := c.Param("session_id")
+	if !sessionIDPattern.MatchString(sessionID) {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid session ID: letters, digits, _ . : - and at most 128 characters")
+		return "", false
+	}
+	return sessionID, true
+}
+
+// HandleGetSessionVariables handle the request for the variables of a session
+func (h *DataFlowAPIHandler) HandleGetSessionVariables(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	sessionID, ok := h.bindSessionID(c)
+	if !ok {
+		return
+	}
+	h.respondWithSessionVariables(c, authInfo.APIKey, sessionID)
+}
+
+// HandleSetSessionVariables handle setting variables of a session, merged with the
+// ones it already has
+func (h *DataFlowAPIHandler) HandleSetSessionVariables(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	sessionID, ok := h.bindSessionID(c)
+	if !ok {
+		return
+	}
+
+	var req SessionVariablesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", "Invalid request format: "+err.Error())
+		return
+	}
+	if err := validateSessionVariables(req.Variables); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if err := h.sessions.Set(c.Request.Context(), authInfo.APIKey, sessionID, req.Variables); err != nil {
+		if errors.Is(err, errTooManySessionVariables) {
+			h.respondWithError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", "Failed to store session variables: "+err.Error())
+		return
+	}
+	h.respondWithSessionVariables(c, authInfo.APIKey, sessionID)
+}
+
+// HandleDeleteSessionVariables handle dropping all variables of a session
+func (h *DataFlowAPIHandler) HandleDeleteSessionVariables(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	sessionID, ok := h.bindSessionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.Delete(c.Request.Context(), authInfo.APIKey, sessionID); err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete session variables: "+err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondWithSessionVariables answer with the stored variables of the session
+func (h *DataFlowAPIHandler) respondWithSessionVariables(c *gin.Context, apiKey, sessionID string) {
+	ctx := c.Request.Context()
+	variables, err := h.sessions.Get(ctx, apiKey, sessionID)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", "Failed to load session variables: "+err.Error())
+		return
+	}
+
+	var expiresIn int64
+	if ttl, err := h.sessions.client.PTTL(ctx, h.sessions.key(apiKey, sessionID)).Result(); err == nil && ttl > 0 {
+		expiresIn = int64(ttl / time.Second)
+	}
+	c.JSON(http.StatusOK, SessionVariablesResponse{SessionID: sessionID, Variables: variables, ExpiresIn: expiresIn})
+}
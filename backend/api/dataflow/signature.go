@@ -0,0 +1,127 @@
+package dataflow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"agent-connector/config"
+	"agent-connector/pkg/requestsign"
+)
+
+// defaultSignatureWindow how far the timestamp of a signed request may be off when none is configured
+const defaultSignatureWindow = 5 * time.Minute
+
+// signatureReplayGuard remembers the signatures seen within the replay window across
+// all dataflow instances, so a captured signed request cannot be sent again
+type signatureReplayGuard struct {
+	client    *redis.Client
+	ttl       time.Duration
+	keyPrefix string
+}
+
+// newSignatureReplayGuard create the replay guard on the shared Redis client, nil when
+// there is none; while Redis is down only the timestamp window is checked
+func newSignatureReplayGuard(window time.Duration) *signatureReplayGuard {
+	client := redisStatus().client
+	if client == nil {
+		return nil
+	}
+	if redisStatus().Degraded() {
+		log.Printf("Signature replay protection waits for Redis, only the timestamp window is checked until then")
+	}
+
+	return &signatureReplayGuard{
+		client: client,
+		// a timestamp may be up to a window in the future, so it stays valid for two
+		ttl:       2 * window,
+		keyPrefix: "agent-connector:signatures:",
+	}
+}
+
+// firstUse true the first time the signature is presented for the agent
+func (g *signatureReplayGuard) firstUse(ctx context.Context, agentID, signature string) (bool, error) {
+	return g.client.SetNX(ctx, g.keyPrefix+agentID+":"+signature, 1, g.ttl).Result()
+}
+
+// newSignatureVerifier create the verifier with the configured replay window
+func newSignatureVerifier() (*requestsign.Verifier, *signatureReplayGuard) {
+	window := defaultSignatureWindow
+	if config.GlobalConfig == nil {
+		return requestsign.NewVerifier(window), nil
+	}
+	if config.GlobalConfig.API.SignatureWindow > 0 {
+		window = config.GlobalConfig.API.SignatureWindow
+	}
+	return requestsign.NewVerifier(window), newSignatureReplayGuard(window)
+}
+
+// SignatureMiddleware verifies HMAC signed requests: required for agents with
+// require_signature, and checked whenever a signature is sent and the agent has a
+// secret. Playground tokens are never signed.
+func (m *DataFlowMiddleware) SignatureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authInfo, err := GetAuthInfoFromContext(c)
+		if err != nil {
+			m.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			c.Abort()
+			return
+		}
+
+		agent := authInfo.Agent
+		signed := requestsign.Signed(c.Request.Header)
+		if authInfo.Playground != nil || (!agent.RequireSignature && !(signed && agent.SigningSecret != "")) {
+			c.Next()
+			return
+		}
+		if agent.SigningSecret == "" {
+			m.respondWithError(c, http.StatusUnauthorized, "signature_not_configured",
+				"Agent requires signed requests but has no signing secret, rotate it in control flow")
+			c.Abort()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				m.respondWithError(c, http.StatusBadRequest, "invalid_request", "Failed to read request body: "+err.Error())
+				c.Abort()
+				return
+			}
+		}
+
+		_, err = m.signatures.Verify(c.Request.Header, c.Request.Method, c.Request.URL.RequestURI(), body, []byte(agent.SigningSecret))
+		if err != nil {
+			errorType := "invalid_signature"
+			if errors.Is(err, requestsign.ErrMissingSignature) {
+				errorType = "signature_required"
+			}
+			m.respondWithError(c, http.StatusUnauthorized, errorType, err.Error())
+			c.Abort()
+			return
+		}
+
+		if m.replayGuard != nil && !redisStatus().Degraded() {
+			first, err := m.replayGuard.firstUse(c.Request.Context(), authInfo.AgentID, c.GetHeader(requestsign.SignatureHeader))
+			if err != nil {
+				redisStatus().markDown(err)
+				log.Printf("Signature replay check of agent %s failed, admitting request: %v", authInfo.AgentID, err)
+			} else if !first {
+				m.respondWithError(c, http.StatusUnauthorized, "signature_replayed", "This signed request was already received")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package dataflow
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+
+	"agent-connector/config"
+)
+
+// defaultStreamBufferSize write buffer of a stream when none is configured
+const defaultStreamBufferSize = 4096
+
+// setSSEHeaders mark the response as an event stream that proxies must not buffer
+func setSSEHeaders(header http.Header) {
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	header.Set("Access-Control-Allow-Origin", "*")
+}
+
+// sseWriter writes server-sent events, each one assembled in the write buffer and
+// flushed to the client as a whole, so no event waits in a buffer for the next one
+type sseWriter struct {
+	buffer  *bufio.Writer
+	flusher http.Flusher
+}
+
+// newSSEWriter create an event writer on the response, which must support flushing
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported")
+	}
+
+	size := defaultStreamBufferSize
+	if config.GlobalConfig != nil && config.GlobalConfig.Services.DataFlowAPI.StreamBufferSize > 0 {
+		size = config.GlobalConfig.Services.DataFlowAPI.StreamBufferSize
+	}
+	return &sseWriter{buffer: bufio.NewWriterSize(w, size), flusher: flusher}, nil
+}
+
+// writeEvent write one event with its data and flush it, event may be empty for the
+// default message event
+func (s *sseWriter) writeEvent(event string, data []byte) error {
+	if event != "" {
+		fmt.Fprintf(s.buffer, "event: %s\n", event)
+	}
+	s.buffer.WriteString("data: ")
+	s.buffer.Write(data)
+	s.buffer.WriteString("\n\n")
+	return s.flush()
+}
+
+// flush send the buffered event to the client
+func (s *sseWriter) flush() error {
+	if err := s.buffer.Flush(); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,238 @@
+package dataflow
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+)
+
+// defaultStreamHeartbeatTTL how long an open stream counts without a heartbeat when none is configured
+const defaultStreamHeartbeatTTL = 30 * time.Second
+
+// acquireStreamLuaScript drops the streams whose heartbeat expired from every set,
+// fails with the 1-based index of the first set at its limit, otherwise adds the
+// stream to all sets.
+// KEYS: stream sets; ARGV: now ms, expiry ms, ttl ms, stream id, limit per set
+const acquireStreamLuaScript = `
+local now = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+	if redis.call('ZCARD', key) >= tonumber(ARGV[4 + i]) then
+		return i
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call('ZADD', key, ARGV[2], ARGV[4])
+	redis.call('PEXPIRE', key, ARGV[3])
+end
+return 0
+`
+
+// streamLimitScope one counter a stream is limited by
+type streamLimitScope struct {
+	name  string // api_key or user
+	key   string
+	limit int
+}
+
+// StreamLimitError the caller already has the maximum number of open streams
+type StreamLimitError struct {
+	Scope string `json:"scope"`
+	Limit int    `json:"limit"`
+}
+
+// Error implements error
+func (e *StreamLimitError) Error() string {
+	return fmt.Sprintf("too many concurrent streams for this %s (limit %d)", e.Scope, e.Limit)
+}
+
+// streamLimiter caps the simultaneously open streams per API key and per user across
+// all dataflow instances; every open stream is a member of a Redis sorted set scored
+// with its heartbeat expiry, so streams of a crashed instance free their slot on their own
+type streamLimiter struct {
+	client    *redis.Client
+	acquire   *redis.Script
+	perKey    int
+	perUser   int
+	ttl       time.Duration
+	keyPrefix string
+}
+
+// newStreamLimiter create the stream limiter from the global config, nil when the
+// limits are off; while Redis is not reachable streams are not limited
+func newStreamLimiter() *streamLimiter {
+	cfg := config.GlobalConfig
+	if cfg == nil || (cfg.API.MaxStreamsPerKey <= 0 && cfg.API.MaxStreamsPerUser <= 0) {
+		return nil
+	}
+
+	redisAddr := cfg.Redis.Addr
+	if redisAddr == "" {
+		redisAddr = "localhost:6379" // fallback default
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	if redisStatus().Degraded() {
+		log.Printf("Stream limits wait for Redis, streams are not limited until then")
+	}
+
+	ttl := cfg.API.StreamHeartbeatTTL
+	if ttl <= 0 {
+		ttl = defaultStreamHeartbeatTTL
+	}
+	return &streamLimiter{
+		client:    client,
+		acquire:   redis.NewScript(acquireStreamLuaScript),
+		perKey:    cfg.API.MaxStreamsPerKey,
+		perUser:   cfg.API.MaxStreamsPerUser,
+		ttl:       ttl,
+		keyPrefix: "agent-connector:streams:",
+	}
+}
+
+// scopes the counters that apply to the request, the API key is stored as a hash. The
+// user counter is that of the user authenticated with X-User-Token, not the body's user
+// field, which any client could change or point at another user.
+func (l *streamLimiter) scopes(req *backends.BackendRequest) []streamLimitScope {
+	var scopes []streamLimitScope
+	if l.perKey > 0 && req.APIKey != "" {
+		sum := sha256.Sum256([]byte(req.APIKey))
+		scopes = append(scopes, streamLimitScope{
+			name:  "api_key",
+			key:   l.keyPrefix + "key:" + hex.EncodeToString(sum[:16]),
+			limit: l.perKey,
+		})
+	}
+	if l.perUser > 0 && req.AuthenticatedUser != "" {
+		scopes = append(scopes, streamLimitScope{
+			name:  "user",
+			key:   l.keyPrefix + "user:" + req.AgentID + ":" + req.AuthenticatedUser,
+			limit: l.perUser,
+		})
+	}
+	return scopes
+}
+
+// Acquire take a stream slot for the request and keep it alive until release is
+// called; a *StreamLimitError when a limit is reached. Redis errors admit the stream.
+func (l *streamLimiter) Acquire(ctx context.Context, req *backends.BackendRequest) (release func(), err error) {
+	scopes := l.scopes(req)
+	if len(scopes) == 0 || redisStatus().Degraded() {
+		return func() {}, nil
+	}
+
+	streamID := newStreamID()
+	now := time.Now()
+	keys := make([]string, len(scopes))
+	args := []interface{}{now.UnixMilli(), now.Add(l.ttl).UnixMilli(), l.ttl.Milliseconds(), streamID}
+	for i, scope := range scopes {
+		keys[i] = scope.key
+		args = append(args, scope.limit)
+	}
+
+	exceeded, err := l.acquire.Run(ctx, l.client, keys, args...).Int()
+	if err != nil {
+		redisStatus().markDown(err)
+		log.Printf("Stream limit check failed, admitting stream: %v", err)
+		return func() {}, nil
+	}
+	if exceeded > 0 {
+		scope := scopes[exceeded-1]
+		return nil, &StreamLimitError{Scope: scope.name, Limit: scope.limit}
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	go l.heartbeat(heartbeatCtx, keys, streamID)
+
+	return func() {
+		stopHeartbeat()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, key := range keys {
+			if err := l.client.ZRem(ctx, key, streamID).Err(); err != nil {
+				log.Printf("Failed to release stream slot %s on %s: %v", streamID, key, err)
+			}
+		}
+	}, nil
+}
+
+// OpenForKey the number of streams of the API key open across all instances and the
+// per-key limit, 0 open when the key is not limited
+func (l *streamLimiter) OpenForKey(ctx context.Context, apiKey string) (int64, int, error) {
+	for _, scope := range l.scopes(&backends.BackendRequest{APIKey: apiKey}) {
+		if scope.name != "api_key" {
+			continue
+		}
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		open, err := l.client.ZCount(ctx, scope.key, "("+now, "+inf").Result()
+		return open, scope.limit, err
+	}
+	return 0, 0, nil
+}
+
+// heartbeat push the expiry of the stream forward until ctx is done
+func (l *streamLimiter) heartbeat(ctx context.Context, keys []string, streamID string) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			expiry := float64(time.Now().Add(l.ttl).UnixMilli())
+			pipe := l.client.Pipeline()
+			for _, key := range keys {
+				pipe.ZAddXX(ctx, key, redis.Z{Score: expiry, Member: streamID})
+				pipe.PExpire(ctx, key, l.ttl)
+			}
+			if _, err := pipe.Exec(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Stream heartbeat of %s failed: %v", streamID, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newStreamID generate a collision-safe ID for a stream slot
+func newStreamID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("str_%d", time.Now().UnixNano())
+	}
+	return "str_" + hex.EncodeToString(buf)
+}
+
+// respondWithStreamLimit return 429 when the caller has too many open streams
+func (h *DataFlowAPIHandler) respondWithStreamLimit(c *gin.Context, limitErr *StreamLimitError) {
+	c.Header("X-Stream-Limit", strconv.Itoa(limitErr.Limit))
+	c.Header("X-Stream-Limit-Scope", limitErr.Scope)
+	c.Header("Retry-After", "5")
+
+	response := DataFlowResponse{
+		Code:    http.StatusTooManyRequests,
+		Message: "Too many concurrent streams",
+		Error: &APIError{
+			Type:    "stream_limit_exceeded",
+			Code:    "429",
+			Message: fmt.Sprintf("Too many concurrent streams for this %s (limit %d), close one before opening another", limitErr.Scope, limitErr.Limit),
+			Details: limitErr,
+		},
+	}
+	c.JSON(http.StatusTooManyRequests, response)
+}
@@ -0,0 +1,54 @@
+package dataflow
+
+import (
+	"context"
+	"time"
+
+	"agent-connector/pkg/textlimit"
+)
+
+// streamPacer chunkObserver that holds back chunks so the stream does not exceed the
+// agent's token rate; a second's worth of tokens may go out at once, e.g. the first
+// chunks of an answer, after that the stream follows the rate
+type streamPacer struct {
+	ctx    context.Context
+	rate   float64 // tokens per second
+	start  time.Time
+	tokens int
+}
+
+// newStreamPacer nil when the agent has no token rate, the methods accept a nil pacer
+func newStreamPacer(ctx context.Context, tokensPerSecond int) *streamPacer {
+	if tokensPerSecond <= 0 {
+		return nil
+	}
+	return &streamPacer{ctx: ctx, rate: float64(tokensPerSecond)}
+}
+
+// observe wait until the chunk's tokens fit the rate, called before it is forwarded
+func (p *streamPacer) observe(payload interface{}) {
+	if p == nil {
+		return
+	}
+	tokens := textlimit.EstimateTokens(responseText(payload))
+	if tokens == 0 {
+		return
+	}
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	p.tokens += tokens
+
+	due := p.start.Add(time.Duration((float64(p.tokens)/p.rate - 1) * float64(time.Second)))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.ctx.Done():
+	}
+}
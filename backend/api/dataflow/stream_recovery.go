@@ -0,0 +1,126 @@
+package dataflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/textlimit"
+)
+
+// errStreamInterrupted the upstream stream broke off before the response was complete
+var errStreamInterrupted = errors.New("upstream stream interrupted")
+
+// continuationTailLength bytes of the partial answer quoted in the continuation prompt
+const continuationTailLength = 80
+
+// streamProgress the response text forwarded to the client so far
+type streamProgress struct {
+	length   int
+	keepText bool // keep the text itself for a continuation attempt
+	text     strings.Builder
+}
+
+// observe count the text of a stream chunk
+func (p *streamProgress) observe(payload interface{}) {
+	text := responseText(payload)
+	p.length += len(text)
+	if p.keepText {
+		p.text.WriteString(text)
+	}
+}
+
+// recoverStream tell the client that the upstream stream broke off and, when the agent
+// allows it, ask the agent once to continue the partial answer within the same response.
+// The continuation is rate limited and fitted to the context window before it is sent.
+func (s *DataflowService) recoverStream(ctx context.Context, req *backends.BackendRequest, agentInfo *backends.AgentInfo, w http.ResponseWriter, chunking *streamChunking, cause error, progress *streamProgress, observers ...chunkObserver) error {
+	continuing := agentInfo.ContinueOnInterrupt && len(req.Messages) > 0 && progress.length > 0 && ctx.Err() == nil
+	writeStreamInterrupted(w, progress.length, continuing, cause)
+	events.Emit(events.TypeStreamInterrupted, req.AgentID, map[string]interface{}{
+		"agent_id":               req.AgentID,
+		"partial_content_length": progress.length,
+		"continuing":             continuing,
+		"error":                  cause.Error(),
+	})
+	if !continuing {
+		return cause
+	}
+
+	// A hedged stream may have come from another agent type, so rebuild the backend
+	backend, err := s.factory.CreateBackend(backends.DetermineAgentType(agentInfo.Type))
+	if err != nil {
+		log.Printf("Continuation of interrupted stream of agent %s failed: %v", req.AgentID, err)
+		return cause
+	}
+
+	// The continuation is limited like the request, and the partial answer it quotes may
+	// push it over the context window
+	continued := *req
+	continued.Messages = continuationMessages(req.Messages, progress.text.String())
+	err = s.checkRateLimit(ctx, &continued, agentInfo)
+	if err == nil {
+		err = admitConnectorCall(ctx, req.AgentID)
+	}
+	if err == nil {
+		err = s.fitContext(ctx, &continued, backend, agentInfo)
+		req.ConnectorTokens = continued.ConnectorTokens
+	}
+	if err != nil {
+		log.Printf("Continuation of interrupted stream of agent %s failed: %v", req.AgentID, err)
+		return cause
+	}
+	resp, backend, err := s.execute(ctx, &continued, backend, agentInfo)
+	if err != nil {
+		log.Printf("Continuation of interrupted stream of agent %s failed: %v", req.AgentID, err)
+		return cause
+	}
+	defer resp.Body.Close()
+
+	streamReader, err := backend.ProcessStreamingResponse(resp)
+	if err != nil {
+		log.Printf("Continuation of interrupted stream of agent %s failed: %v", req.AgentID, err)
+		return cause
+	}
+
+	progress.keepText = false
+	observers = append(observers, progress)
+	if err := s.streamResponse(streamReader, w, chunking, observers...); err != nil {
+		if errors.Is(err, errStreamInterrupted) {
+			writeStreamInterrupted(w, progress.length, false, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// continuationMessages the original conversation followed by the partial answer and
+// a prompt to continue it
+func continuationMessages(messages []backends.ChatMessage, partial string) []backends.ChatMessage {
+	tail, _ := textlimit.TailBytes(partial, continuationTailLength)
+
+	continued := make([]backends.ChatMessage, 0, len(messages)+2)
+	continued = append(continued, messages...)
+	return append(continued,
+		backends.ChatMessage{Role: "assistant", Content: partial},
+		backends.ChatMessage{Role: "user", Content: fmt.Sprintf("Your previous answer was cut off after %q. Continue exactly from there without repeating anything.", tail)},
+	)
+}
+
+// writeStreamInterrupted send the structured stream_interrupted event to the client
+func writeStreamInterrupted(w http.ResponseWriter, partialLength int, continuing bool, cause error) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"event":                  "stream_interrupted",
+		"partial_content_length": partialLength,
+		"continuing":             continuing,
+		"message":                cause.Error(),
+	})
+	if events, err := newSSEWriter(w); err == nil {
+		events.writeEvent("stream_interrupted", data)
+	}
+}
@@ -0,0 +1,123 @@
+package dataflow
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"agent-connector/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// toolParameters request fields that ask for tools or function calling
+var toolParameters = []string{"tools", "tool_choice", "functions", "function_call"}
+
+// imagePartTypes content part types of image inputs in OpenAI messages
+var imagePartTypes = map[string]bool{"image_url": true, "input_image": true, "image": true}
+
+// FeatureNotEnabledError details of a request using a feature its key tier switches off
+type FeatureNotEnabledError struct {
+	Feature string `json:"feature"`
+	Tier    string `json:"tier"`
+}
+
+// bodyFields the JSON body decoded as an object, cached for the typed binding that
+// follows; nil when it is not a JSON object, the typed binding reports that
+func bodyFields(c *gin.Context) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// requestedFeatures the features of a key tier a request body uses, for the OpenAI and
+// Dify formats alike
+func requestedFeatures(body map[string]interface{}) []string {
+	var features []string
+
+	if stream, _ := body["stream"].(bool); stream || body["response_mode"] == "streaming" {
+		features = append(features, internal.FeatureStreaming)
+	}
+
+	for _, parameter := range toolParameters {
+		if body[parameter] != nil {
+			features = append(features, internal.FeatureTools)
+			break
+		}
+	}
+
+	if hasImageInput(body) {
+		features = append(features, internal.FeatureVision)
+	}
+	return features
+}
+
+// hasImageInput report whether OpenAI message content parts or Dify files carry images
+func hasImageInput(body map[string]interface{}) bool {
+	messages, _ := body["messages"].([]interface{})
+	for _, message := range messages {
+		message, _ := message.(map[string]interface{})
+		parts, _ := message["content"].([]interface{})
+		for _, part := range parts {
+			part, _ := part.(map[string]interface{})
+			if partType, _ := part["type"].(string); imagePartTypes[partType] {
+				return true
+			}
+		}
+	}
+
+	files, _ := body["files"].([]interface{})
+	for _, file := range files {
+		file, _ := file.(map[string]interface{})
+		if file["type"] == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTierFeatures reject requests using a feature the key tier of the authenticated
+// agent switches off. Writes the error response and returns false when the request
+// is rejected.
+func (h *DataFlowAPIHandler) applyTierFeatures(c *gin.Context, authInfo *AuthInfo, body map[string]interface{}) bool {
+	if authInfo.Agent == nil || authInfo.Agent.Tier == "" || body == nil {
+		return true
+	}
+	features := requestedFeatures(body)
+	if len(features) == 0 {
+		return true
+	}
+
+	tier, err := internal.LookupKeyTier(authInfo.Agent.Tier)
+	if err != nil {
+		log.Printf("Failed to load key tier %s of agent %s: %v", authInfo.Agent.Tier, authInfo.AgentID, err)
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", "Failed to load the key tier")
+		return false
+	}
+
+	for _, feature := range features {
+		if !tier.Allows(feature) {
+			h.respondWithFeatureNotEnabled(c, &FeatureNotEnabledError{Feature: feature, Tier: tier.Name})
+			return false
+		}
+	}
+	return true
+}
+
+// respondWithFeatureNotEnabled the response to a request using a feature outside its key tier
+func (h *DataFlowAPIHandler) respondWithFeatureNotEnabled(c *gin.Context, featureErr *FeatureNotEnabledError) {
+	response := DataFlowResponse{
+		Code:    http.StatusForbidden,
+		Message: "Feature not enabled",
+		Error: &APIError{
+			Type:    "feature_not_enabled",
+			Code:    "403",
+			Message: fmt.Sprintf("Feature %s is not enabled for the %s tier of this key", featureErr.Feature, featureErr.Tier),
+			Details: featureErr,
+		},
+	}
+	c.JSON(http.StatusForbidden, response)
+}
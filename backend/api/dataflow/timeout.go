@@ -0,0 +1,251 @@
+package dataflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errRouteTimeout the request ran past the timeout of its route
+var errRouteTimeout = errors.New("route timeout exceeded")
+
+// writeDeadlineGrace time beyond the route timeout left to write the timeout response
+const writeDeadlineGrace = 5 * time.Second
+
+// chatRoutes answer in one piece or, when the client asks for it, as an event stream
+var chatRoutes = map[string]bool{
+	"/api/v1/openai/chat/completions": true,
+	"/api/v1/dify/chat-messages":      true,
+	"/api/v1/chat":                    true,
+	openAIPassthroughRoute:            true,
+}
+
+// longRoutes run long even without streaming
+var longRoutes = map[string]bool{
+	"/api/v1/dify/workflows/run": true,
+}
+
+// routeTimeouts deadlines of the dataflow routes
+type routeTimeouts struct {
+	request time.Duration // health, service description and other short routes
+	chat    time.Duration // chat routes until their response turns into an event stream
+	stream  time.Duration // event streams and workflows
+}
+
+// forRoute the timeout of a route and whether it is extended to the stream timeout
+// once the response turns into an event stream
+func (t routeTimeouts) forRoute(route string) (time.Duration, bool) {
+	switch {
+	case longRoutes[route]:
+		return t.stream, false
+	case chatRoutes[route]:
+		return t.chat, t.stream > t.chat
+	default:
+		return t.request, false
+	}
+}
+
+// RouteTimeoutMiddleware bounds every request by the timeout of its route instead of
+// the server-wide write timeout. Like http.TimeoutHandler it answers 503 when the
+// handler has not started its response in time and cancels the request context, but
+// it does not buffer the response, so event streams are forwarded as they are written.
+func RouteTimeoutMiddleware(cfg config.APIConfig) gin.HandlerFunc {
+	timeouts := routeTimeouts{
+		request: cfg.RequestTimeout,
+		chat:    cfg.ChatTimeout,
+		stream:  cfg.StreamTimeout,
+	}
+
+	return func(c *gin.Context) {
+		timeout, extendOnStream := timeouts.forRoute(routePattern(c))
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithCancelCause(c.Request.Context())
+		defer cancel(nil)
+
+		// The route timeout replaces the server's write deadline for this request
+		controller := http.NewResponseController(c.Writer)
+		controller.SetWriteDeadline(start.Add(timeout + writeDeadlineGrace))
+
+		original := c.Writer
+		writer := &timeoutWriter{
+			ResponseWriter: original,
+			header:         original.Header().Clone(),
+			streaming:      make(chan struct{}),
+		}
+		c.Writer = writer
+		c.Request = c.Request.WithContext(ctx)
+		defer func() { c.Writer = original }()
+
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+				close(done)
+			}()
+			c.Next()
+		}()
+
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+
+		streaming := writer.streaming
+		for {
+			select {
+			case <-done:
+				repanic(c, original, panicked)
+				return
+			case <-streaming:
+				streaming = nil
+				if extendOnStream {
+					deadline.Reset(timeouts.stream - time.Since(start))
+					controller.SetWriteDeadline(start.Add(timeouts.stream + writeDeadlineGrace))
+				}
+			case <-deadline.C:
+				writer.timeout(timeout)
+				cancel(errRouteTimeout)
+				<-done
+				repanic(c, original, panicked)
+				return
+			}
+		}
+	}
+}
+
+// repanic raise a panic of the handler goroutine again in the request goroutine, so
+// the recovery middleware handles it
+func repanic(c *gin.Context, original gin.ResponseWriter, panicked <-chan interface{}) {
+	select {
+	case p := <-panicked:
+		c.Writer = original
+		panic(p)
+	default:
+	}
+}
+
+// timeoutWriter passes the response through to the client while it can still answer
+// with a timeout in place of a response that did not start yet
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu          sync.Mutex
+	header      http.Header
+	wroteHeader bool
+	timedOut    bool
+	streaming   chan struct{} // closed once the response is an event stream
+}
+
+// Header headers of the response, sent with the first write
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader record the status code, the headers are sent with the first write
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeaderLocked(code)
+}
+
+// WriteHeaderNow send the status code and headers
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.writeHeaderLocked(w.ResponseWriter.Status())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Write write to the client, failing with http.ErrHandlerTimeout after a timeout response
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.writeHeaderLocked(http.StatusOK)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString write to the client, failing with http.ErrHandlerTimeout after a timeout response
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.writeHeaderLocked(http.StatusOK)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Flush send buffered data to the client
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.writeHeaderLocked(http.StatusOK)
+	w.ResponseWriter.Flush()
+}
+
+// writeHeaderLocked copy the headers to the client response once, noting whether it
+// is an event stream
+func (w *timeoutWriter) writeHeaderLocked(code int) {
+	if w.wroteHeader || w.timedOut {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	if strings.HasPrefix(w.header.Get("Content-Type"), "text/event-stream") {
+		close(w.streaming)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// timeout answer 503 when the handler has not started its response; a response
+// already under way is left to the handler, which sees the cancelled context
+func (w *timeoutWriter) timeout(after time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wroteHeader {
+		return
+	}
+	w.timedOut = true
+
+	body, _ := json.Marshal(DataFlowResponse{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Request timed out",
+		Error: &APIError{
+			Type:    "request_timeout",
+			Code:    strconv.Itoa(http.StatusServiceUnavailable),
+			Message: fmt.Sprintf("No response within %s", after),
+		},
+	})
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(body)
+}
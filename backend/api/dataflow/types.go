@@ -3,6 +3,9 @@ package dataflow
 import (
 	"encoding/json"
 	"time"
+
+	"agent-connector/pkg/acl"
+	"agent-connector/pkg/quota"
 )
 
 // DataFlowRequest data flow API common request structure
@@ -27,6 +30,58 @@ type DataFlowRequest struct {
 	ResponseMode string `json:"response_mode,omitempty"` // "streaming" or "blocking"
 }
 
+// CancelRequestResponse result of stopping a running request
+type CancelRequestResponse struct {
+	RequestID string `json:"request_id"`
+	AgentID   string `json:"agent_id"`
+	Stream    bool   `json:"stream"`
+	Status    string `json:"status"`
+
+	// Finished is false when the request was still winding down when the answer was sent
+	Finished bool `json:"finished"`
+
+	// UpstreamStopped is true when the agent's stop API accepted the stop (Dify streams)
+	UpstreamStopped bool `json:"upstream_stopped"`
+
+	// GeneratedContentLength bytes of response text sent to the client before the stop
+	GeneratedContentLength int64 `json:"generated_content_length"`
+	DurationMs             int64 `json:"duration_ms"`
+}
+
+// OpenAIChatRequest OpenAI compatible chat completion request
+type OpenAIChatRequest struct {
+	AgentID     string        `json:"agent_id,omitempty"`
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	MaxTokens   *int          `json:"max_tokens,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
+	User        string        `json:"user,omitempty"`
+
+	// Metadata tags the request in usage records, see config usage.metadata_passthrough
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// DifyChatRequest Dify chat message request
+type DifyChatRequest struct {
+	AgentID        string                 `json:"agent_id,omitempty"`
+	Query          string                 `json:"query"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	User           string                 `json:"user"`
+	Inputs         map[string]interface{} `json:"inputs,omitempty"`
+	ResponseMode   string                 `json:"response_mode,omitempty"` // "streaming" or "blocking"
+	Metadata       map[string]string      `json:"metadata,omitempty"`
+}
+
+// DifyWorkflowRequest Dify workflow run request
+type DifyWorkflowRequest struct {
+	AgentID      string                 `json:"agent_id,omitempty"`
+	Inputs       map[string]interface{} `json:"inputs"`
+	User         string                 `json:"user"`
+	ResponseMode string                 `json:"response_mode,omitempty"` // "streaming" or "blocking"
+	Metadata     map[string]string      `json:"metadata,omitempty"`
+}
+
 // ChatMessage OpenAI format message structure
 type ChatMessage struct {
 	Role    string `json:"role"` // "system", "user", "assistant"
@@ -43,9 +98,10 @@ type DataFlowResponse struct {
 
 // APIError API error structure
 type APIError struct {
-	Type    string `json:"type"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Type    string      `json:"type"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 // OpenAI Compatible Response Structures
@@ -116,19 +172,69 @@ type AuthInfo struct {
 	APIKey    string
 	Agent     *AgentInfo
 	Timestamp time.Time
+
+	// Playground is set when the request uses a playground token instead of the connector API key
+	Playground *PlaygroundScope
+
+	// Route how the agent was chosen: agent_id, api_key or user_default
+	Route string
+
+	// User and UserRole the platform user authenticated with X-User-Token, empty
+	// when the request carries no session token
+	User     string
+	UserRole string
+}
+
+// PlaygroundScope limits attached to a playground token
+type PlaygroundScope struct {
+	TokenID     uint
+	TokenPrefix string
+	QPS         int
+	MaxTokens   int // 0 means no cap
+	ExpiresAt   time.Time
 }
 
 // AgentInfo agent information
 type AgentInfo struct {
-	ID               uint
-	Name             string
-	Type             string
-	URL              string
-	SourceAPIKey     string
-	QPS              int
-	Enabled          bool
-	SupportStreaming bool
-	ResponseFormat   string
+	ID                  uint
+	Name                string
+	Type                string
+	URL                 string
+	SourceAPIKey        string
+	QPS                 int
+	Enabled             bool
+	SupportStreaming    bool
+	ResponseFormat      string
+	PromptPrice         float64 // per 1K tokens
+	CompletionPrice     float64 // per 1K tokens
+	HedgeAgentID        string
+	HedgeAfterMs        int
+	ContinueOnInterrupt bool
+	ContextWindow       int
+	ContextOverflow     string
+	PriorityOverride    bool   // requests with the connector key may set their queue priority
+	QPSSharing          bool   // the QPS is shared among the agent's users by priority
+	UserQPS             int    // QPS of each user of the connector key, 0 inherits the user and system defaults
+	RecordMode          string // record or replay upstream fixtures, empty sends requests upstream
+	MaxTemperature      float64
+	MaxTokensCap        int
+	MaxMessages         int // 0 inherits the endpoint limit, like the two below
+	MaxMessageBytes     int
+	MaxInputs           int
+	ForbiddenParameters []string
+	GuardrailPolicy     string
+	OutputFilter        []string     // redaction rules applied to answers
+	BlockedWords        []string     // words the output filter matches
+	OutputFilterAction  string       // redact or block
+	RequireSignature    bool         // requests with the connector key must be HMAC signed
+	SigningSecret       string       // empty until control flow generates one
+	StreamTokenRate     int          // tokens per second streamed to clients, 0 disables pacing
+	Tier                string       // key tier of the connector key, empty allows every feature
+	AccessSchedule      string       // weekly windows the connector key may be used in, empty allows any time
+	AccessTimezone      string       // IANA time zone of the schedule, empty means UTC
+	ACL                 acl.List     // users, roles and keys allowed to call the agent, empty allows every caller
+	QuotaPool           string       // quota pool the key draws from, empty has no shared quota
+	PoolLimits          quota.Limits // sub-limits of the key in its pool
 }
 
 // StreamData streaming data wrapper
@@ -0,0 +1,360 @@
+package dataflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/redact"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http/httpguts"
+)
+
+// TokenUsage token counts reported by the upstream agent
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// addConnectorTokens add the tokens of the calls the connector made on its own for the
+// request, see BackendRequest.ConnectorTokens
+func (u *TokenUsage) addConnectorTokens(req *backends.BackendRequest) {
+	u.PromptTokens += req.ConnectorTokens.Prompt
+	u.CompletionTokens += req.ConnectorTokens.Completion
+	u.TotalTokens += req.ConnectorTokens.Total
+}
+
+// observe take the usage from a decoded response or stream chunk; OpenAI reports it
+// under "usage", Dify under "metadata.usage"
+func (u *TokenUsage) observe(payload interface{}) {
+	body, ok := payload.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	usage, ok := body["usage"].(map[string]interface{})
+	if !ok {
+		metadata, _ := body["metadata"].(map[string]interface{})
+		if usage, ok = metadata["usage"].(map[string]interface{}); !ok {
+			return
+		}
+	}
+
+	u.PromptTokens = intValue(usage["prompt_tokens"])
+	u.CompletionTokens = intValue(usage["completion_tokens"])
+	u.TotalTokens = intValue(usage["total_tokens"])
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+}
+
+// contentTee captures the response text while it is forwarded to the client, up to
+// the configured size, so streamed responses are stored without buffering them first
+type contentTee struct {
+	builder   strings.Builder
+	limit     int
+	truncated bool
+}
+
+// newContentTee nil when content recording is disabled; the methods accept a nil tee
+func newContentTee() *contentTee {
+	usage := config.GlobalConfig.Usage
+	if !usage.Record || !usage.StoreContent {
+		return nil
+	}
+	return &contentTee{limit: usage.MaxContentBytes}
+}
+
+// observe take the text of a decoded response or stream chunk
+func (t *contentTee) observe(payload interface{}) {
+	if t == nil {
+		return
+	}
+	t.write(responseText(payload))
+}
+
+// responseText text of a decoded response or stream chunk: OpenAI message or delta
+// content, Dify answers and workflow outputs
+func responseText(payload interface{}) string {
+	body, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	if choices, ok := body["choices"].([]interface{}); ok {
+		var text strings.Builder
+		for _, choice := range choices {
+			choiceMap, _ := choice.(map[string]interface{})
+			for _, field := range []string{"delta", "message"} {
+				if message, ok := choiceMap[field].(map[string]interface{}); ok {
+					content, _ := message["content"].(string)
+					text.WriteString(content)
+				}
+			}
+		}
+		return text.String()
+	}
+
+	if answer, ok := body["answer"].(string); ok {
+		return answer
+	}
+
+	data, _ := body["data"].(map[string]interface{})
+	if outputs, ok := data["outputs"]; ok && outputs != nil {
+		if encoded, err := json.Marshal(outputs); err == nil {
+			return string(encoded)
+		}
+	}
+	return ""
+}
+
+// write append text until the limit is reached; the chunk crossing it is kept whole
+// and SetContent cuts the text to the exact size
+func (t *contentTee) write(text string) {
+	if t.truncated || text == "" {
+		return
+	}
+	if t.builder.Len()+len(text) > t.limit {
+		t.truncated = true
+	}
+	t.builder.WriteString(text)
+}
+
+// requestContent the prompt of the request as stored with the usage record
+func requestContent(req *backends.BackendRequest) string {
+	switch {
+	case len(req.Messages) > 0:
+		if encoded, err := json.Marshal(req.Messages); err == nil {
+			return string(encoded)
+		}
+	case req.Query != "":
+		return req.Query
+	case len(req.Data) > 0:
+		if encoded, err := json.Marshal(req.Data); err == nil {
+			return string(encoded)
+		}
+	}
+	return ""
+}
+
+// intValue read a JSON number
+func intValue(value interface{}) int {
+	if number, ok := value.(float64); ok {
+		return int(number)
+	}
+	return 0
+}
+
+// applyRequestMetadata validate the client metadata and select the keys forwarded
+// upstream; a forwarded "user" fills the provider's user field when the client left
+// it empty. Writes the error response and returns false when the metadata is invalid.
+func (h *DataFlowAPIHandler) applyRequestMetadata(c *gin.Context, req *backends.BackendRequest, metadata map[string]string) bool {
+	if len(metadata) == 0 {
+		return true
+	}
+
+	if err := internal.ValidateRequestMetadata(metadata); err != nil {
+		h.respondWithError(c, http.StatusBadRequest, "invalid_metadata", err.Error())
+		return false
+	}
+	req.Metadata = metadata
+
+	for _, key := range strings.Split(config.GlobalConfig.Usage.MetadataPassthrough, ",") {
+		key = strings.TrimSpace(key)
+		value, ok := metadata[key]
+		if key == "" || !ok {
+			continue
+		}
+
+		if req.ForwardMetadata == nil {
+			req.ForwardMetadata = make(map[string]string)
+		}
+		req.ForwardMetadata[key] = value
+	}
+
+	if user, ok := req.ForwardMetadata["user"]; ok && req.User == "" {
+		req.User = user
+	}
+	return true
+}
+
+// setMetadataHeaders send the forwarded metadata as X-Metadata-<key> headers,
+// except "user" which travels in the request body, and the locale as Accept-Language
+func setMetadataHeaders(httpReq *http.Request, req *backends.BackendRequest) {
+	if req.Locale != "" {
+		httpReq.Header.Set("Accept-Language", req.Locale)
+	}
+	for key, value := range req.ForwardMetadata {
+		if key == "user" {
+			continue
+		}
+		httpReq.Header.Set("X-Metadata-"+key, value)
+	}
+}
+
+// checkForwardHeaders reject a forward request whose headers the transport would refuse
+// to send, so the failure counts as a bad request rather than against the upstream
+func checkForwardHeaders(httpReq *http.Request) error {
+	for name, values := range httpReq.Header {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("%w: invalid header name %q", agent.ErrInvalidRequest, name)
+		}
+		for _, value := range values {
+			if !httpguts.ValidHeaderFieldValue(value) {
+				return fmt.Errorf("%w: invalid value of header %s", agent.ErrInvalidRequest, name)
+			}
+		}
+	}
+	return nil
+}
+
+// redactorOnce builds contentRedactor from the configuration on first use
+var (
+	redactorOnce    sync.Once
+	contentRedactor *redact.Redactor
+)
+
+// textRedactor masks sensitive values of prompt and response text before it is stored
+// or logged; nil when redaction is disabled. An invalid configuration falls back to
+// the built-in rules rather than storing unmasked text.
+func textRedactor() *redact.Redactor {
+	redactorOnce.Do(func() {
+		settings := config.GlobalConfig.Redaction
+		if !settings.Enabled {
+			return
+		}
+
+		var err error
+		contentRedactor, err = redact.NewFromConfig(redact.Config{
+			Rules:    splitConfigList(settings.Rules),
+			Patterns: settings.Patterns,
+			Words:    splitConfigList(settings.Words),
+		})
+		if err != nil {
+			log.Printf("Invalid redaction configuration, using the built-in rules: %v", err)
+			contentRedactor, _ = redact.NewFromConfig(redact.Config{})
+		}
+	})
+	return contentRedactor
+}
+
+// splitConfigList split a comma separated configuration value
+func splitConfigList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// usageService is shared by every handler instance of the process
+var usageService = &internal.UsageService{}
+
+// recordInternalUsage store the usage of a call the gateway makes on its own rather than
+// for a client request, e.g. to title a session, billed to the agent that answered; path
+// names the kind of call
+func recordInternalUsage(agentID, path string, start time.Time, usage TokenUsage, err error) {
+	cfg := config.GlobalConfig
+	if cfg == nil || !cfg.Usage.Record {
+		return
+	}
+
+	record := &internal.UsageRecord{
+		AgentID:          agentID,
+		Path:             path,
+		Success:          err == nil,
+		Outcome:          outcomeSuccess,
+		DurationMs:       time.Since(start).Milliseconds(),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if err != nil {
+		record.Outcome = outcomeFailed
+		record.Error = textRedactor().Redact(err.Error())
+	}
+	if agent, agentErr := internal.LookupAgentByAgentID(agentID); agentErr == nil {
+		record.ApplyPricing(agent.PromptPrice, agent.CompletionPrice)
+	}
+	if err := usageService.WriteUsage(record, nil); err != nil && !errors.Is(err, internal.ErrUsageDeferred) {
+		log.Printf("Failed to record usage of agent %s: %v", agentID, err)
+	}
+}
+
+// recordUsage store the usage record of a finished request, with the captured content
+// when content recording is enabled
+func recordUsage(c *gin.Context, req *backends.BackendRequest, start time.Time, usage TokenUsage, content *contentTee, err error) {
+	if !config.GlobalConfig.Usage.Record {
+		return
+	}
+
+	// Hedged requests are billed to the agent that answered
+	agentID := req.AgentID
+	if req.HedgedTo != "" {
+		agentID = req.HedgedTo
+	}
+
+	record := &internal.UsageRecord{
+		AgentID:          agentID,
+		Path:             routePattern(c),
+		Stream:           req.Stream,
+		Success:          err == nil,
+		Outcome:          requestOutcome(c, err),
+		DurationMs:       time.Since(start).Milliseconds(),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if err != nil {
+		record.Error = textRedactor().Redact(err.Error())
+	}
+	if authInfo, authErr := GetAuthInfoFromContext(c); authErr == nil {
+		if authInfo.Playground != nil {
+			tokenID := authInfo.Playground.TokenID
+			record.PlaygroundTokenID = &tokenID
+		}
+		if authInfo.AgentID == agentID && authInfo.Agent != nil {
+			record.ApplyPricing(authInfo.Agent.PromptPrice, authInfo.Agent.CompletionPrice)
+		} else if agent, agentErr := internal.LookupAgentByAgentID(agentID); agentErr == nil {
+			record.ApplyPricing(agent.PromptPrice, agent.CompletionPrice)
+		}
+	}
+	record.SetMetadata(req.Metadata)
+	if content != nil {
+		redactor := textRedactor()
+		record.SetContent(redactor.Redact(requestContent(req)), redactor.Redact(content.builder.String()),
+			redactor.Redact(requestParameters(req)), content.truncated, content.limit)
+	}
+
+	// Kept before storing, the stored content may be encrypted in place
+	var request, response string
+	if record.Content != nil {
+		request, response = record.Content.Request, record.Content.Response
+	}
+
+	// records of privacy mode agents are stored without content and never sampled
+	written := func(record *internal.UsageRecord) {
+		if err == nil && response != "" && record.Content != nil {
+			evaluate(record, request, response)
+		}
+	}
+	if err := usageService.WriteUsage(record, written); err != nil {
+		// deferred records are written once the database is back, without evaluation
+		if !errors.Is(err, internal.ErrUsageDeferred) {
+			log.Printf("Failed to record usage of agent %s: %v", agentID, err)
+		}
+	}
+}
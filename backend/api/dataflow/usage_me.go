@@ -0,0 +1,195 @@
+package dataflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/queue"
+)
+
+// UsageMeResponse usage of the calling API key, for the usage meters of downstream apps
+type UsageMeResponse struct {
+	AgentID        string              `json:"agent_id"`
+	Playground     bool                `json:"playground"` // the numbers are those of the playground token
+	RateLimit      UsageRateLimit      `json:"rate_limit"`
+	Quotas         []UsageQuota        `json:"quotas"`
+	RecentRequests UsageRecentRequests `json:"recent_requests"`
+	Period         UsagePeriod         `json:"period"`
+	GeneratedAt    time.Time           `json:"generated_at"`
+}
+
+// UsageRateLimit the QPS limit the requests of the key count against
+type UsageRateLimit struct {
+	Mode  string `json:"mode"` // enforce, monitor or off
+	QPS   int    `json:"qps"`
+	Burst int    `json:"burst"`
+
+	// Remaining requests that can be sent right now, absent when the limiter is not reachable
+	Remaining *float64 `json:"remaining,omitempty"`
+
+	// Shared is true when the agent QPS is split among its users by priority
+	Shared bool `json:"shared"`
+}
+
+// UsageQuota a concurrency limit and how much of it is in use, Limit 0 means unlimited
+type UsageQuota struct {
+	Name  string `json:"name"` // concurrent_streams, queue, or pool_ and key_pool_ tokens and requests
+	Used  int64  `json:"used"`
+	Limit int64  `json:"limit"`
+}
+
+// UsageRecentRequests request counts of the last hour and day
+type UsageRecentRequests struct {
+	LastHour      int64 `json:"last_hour"`
+	LastDay       int64 `json:"last_day"`
+	FailedLastDay int64 `json:"failed_last_day"`
+}
+
+// UsagePeriod consumption of the current calendar month, UTC
+type UsagePeriod struct {
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end"`
+	Requests         int64     `json:"requests"`
+	Failed           int64     `json:"failed"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	Cost             float64   `json:"cost"`
+	Currency         string    `json:"currency"`
+}
+
+// HandleUsageMe report the rate limit, quotas, recent requests and cost of the month
+// of the calling key; playground tokens see their own limit and requests only
+func (h *DataFlowAPIHandler) HandleUsageMe(c *gin.Context) {
+	authInfo, err := GetAuthInfoFromContext(c)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now().UTC()
+	response := UsageMeResponse{
+		AgentID:     authInfo.AgentID,
+		Playground:  authInfo.Playground != nil,
+		RateLimit:   h.usageRateLimit(ctx, authInfo),
+		Quotas:      h.usageQuotas(ctx, authInfo),
+		GeneratedAt: now,
+	}
+
+	filter := &internal.UsageFilter{AgentID: authInfo.AgentID}
+	if authInfo.Playground != nil {
+		tokenID := authInfo.Playground.TokenID
+		filter.PlaygroundTokenID = &tokenID
+	}
+
+	response.Period.Start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	response.Period.End = response.Period.Start.AddDate(0, 1, 0)
+	response.Period.Currency = config.GlobalConfig.Usage.Currency
+	month, err := summarizeUsageSince(filter, response.Period.Start)
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "usage_error", "Failed to summarize usage: "+err.Error())
+		return
+	}
+	response.Period.Requests = month.Requests
+	response.Period.Failed = month.Failed
+	response.Period.PromptTokens = month.PromptTokens
+	response.Period.CompletionTokens = month.CompletionTokens
+	response.Period.TotalTokens = month.TotalTokens
+	response.Period.Cost = month.Cost
+
+	day, err := summarizeUsageSince(filter, now.Add(-24*time.Hour))
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "usage_error", "Failed to summarize usage: "+err.Error())
+		return
+	}
+	hour, err := summarizeUsageSince(filter, now.Add(-time.Hour))
+	if err != nil {
+		h.respondWithError(c, http.StatusInternalServerError, "usage_error", "Failed to summarize usage: "+err.Error())
+		return
+	}
+	response.RecentRequests = UsageRecentRequests{
+		LastHour:      hour.Requests,
+		LastDay:       day.Requests,
+		FailedLastDay: day.Failed,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// summarizeUsageSince the usage matching filter from since on, zero when there is none;
+// a key sees its own totals even when its agent is in privacy mode
+func summarizeUsageSince(filter *internal.UsageFilter, since time.Time) (internal.UsageSummary, error) {
+	scoped := *filter
+	scoped.From = &since
+	return usageService.SummarizeOwnUsage(&scoped)
+}
+
+// usageRateLimit the limit of the key with the tokens left in its bucket, the agent's
+// or the playground token's
+func (h *DataFlowAPIHandler) usageRateLimit(ctx context.Context, authInfo *AuthInfo) UsageRateLimit {
+	mode := internal.CurrentSystemConfig().RateLimitMode
+	if mode == "" {
+		mode = internal.RateLimitModeEnforce
+	}
+	limit := UsageRateLimit{Mode: mode, QPS: authInfo.Agent.QPS, Shared: authInfo.Agent.QPSSharing}
+	limiterID, bucketKey := authInfo.AgentID, fmt.Sprintf("agent:%s", authInfo.AgentID)
+	if authInfo.Playground != nil {
+		limit.QPS, limit.Shared = authInfo.Playground.QPS, false
+		limiterID = fmt.Sprintf("playground:%d", authInfo.Playground.TokenID)
+		bucketKey = limiterID
+	}
+	limit.Burst = limit.QPS * 2
+
+	if h.rateLimits == nil || mode == internal.RateLimitModeOff || limit.Shared {
+		return limit
+	}
+	limiter, err := h.rateLimits.GetOrCreateLimiter(limiterID, limit.QPS)
+	if err != nil {
+		return limit
+	}
+	if bucket, ok := limiter.(interface {
+		GetTokens(ctx context.Context, key string) (float64, error)
+	}); ok {
+		if tokens, err := bucket.GetTokens(ctx, bucketKey); err == nil {
+			limit.Remaining = &tokens
+		} else {
+			log.Printf("Failed to read rate limit tokens of %s: %v", bucketKey, err)
+		}
+	}
+	return limit
+}
+
+// usageQuotas the open streams of the key, the agent queue in use and the quota pool
+// drawn from, left out when the limit is not tracked
+func (h *DataFlowAPIHandler) usageQuotas(ctx context.Context, authInfo *AuthInfo) []UsageQuota {
+	quotas := []UsageQuota{}
+	if h.streams != nil {
+		open, limit, err := h.streams.OpenForKey(ctx, authInfo.APIKey)
+		if err != nil {
+			log.Printf("Failed to count open streams of agent %s: %v", authInfo.AgentID, err)
+		} else if limit > 0 {
+			quotas = append(quotas, UsageQuota{Name: "concurrent_streams", Used: open, Limit: int64(limit)})
+		}
+	}
+
+	if admissionQueue := h.admission.queue(); admissionQueue != nil {
+		queueName := queue.NewQueueNameBuilder().WithAgent(authInfo.AgentID).Build()
+		depth, err := admissionQueue.Size(ctx, queueName)
+		if err == nil {
+			quota := UsageQuota{Name: "queue", Used: depth}
+			if options, err := admissionQueue.GetQueueOptions(ctx, queueName); err == nil {
+				quota.Limit = options.MaxQueueSize
+			}
+			quotas = append(quotas, quota)
+		}
+	}
+	return append(quotas, poolUsageQuotas(ctx, authInfo)...)
+}
@@ -0,0 +1,122 @@
+package dataflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/authclient"
+	"agent-connector/pkg/serviceauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userTokenHeader carries the platform session token of the user behind a request. The
+// body's user field is only a label; routing, access lists, priority and per-user limits
+// apply to the user authenticated here.
+const userTokenHeader = "X-User-Token"
+
+// userSessionStore looks up session tokens and checks the client they are bound to
+type userSessionStore interface {
+	GetSessionByToken(token string) (*internal.UserSession, error)
+	CheckSessionBinding(session *internal.UserSession, ip, userAgent string) error
+}
+
+// userSessions looks up the session tokens of X-User-Token when the auth API is not called
+var userSessions userSessionStore = internal.NewUserService()
+
+// authAPIClient calls the auth API's internal routes, authenticated with service tokens
+// that dataflow issues with security.service_token_ttl
+var (
+	authAPIOnce   sync.Once
+	authAPIClient *authclient.Client
+)
+
+// authAPI the auth API client, nil when no service auth keys are configured; session
+// tokens are then read from the database
+func authAPI() *authclient.Client {
+	authAPIOnce.Do(func() {
+		cfg := config.GlobalConfig
+		if cfg == nil || cfg.Security.ServiceAuthKeys == "" {
+			return
+		}
+		keyRing, err := serviceauth.ParseKeyRing(cfg.Security.ServiceAuthKeys, cfg.Security.ServiceAuthActiveKey)
+		if err != nil {
+			log.Printf("Invalid service auth keys, reading user sessions from the database: %v", err)
+			return
+		}
+		issuer, err := serviceauth.NewIssuer(keyRing, serviceauth.ServiceDataFlowAPI, cfg.Security.ServiceTokenTTL)
+		if err != nil {
+			log.Printf("Failed to create service token issuer, reading user sessions from the database: %v", err)
+			return
+		}
+
+		scheme := "http"
+		if cfg.Services.AuthAPI.EnableTLS {
+			scheme = "https"
+		}
+		client, err := authclient.NewClient(&authclient.Config{
+			BaseURL:       scheme + "://" + cfg.GetServiceAddr("auth"),
+			ServiceIssuer: issuer,
+		})
+		if err != nil {
+			log.Printf("Failed to create auth API client, reading user sessions from the database: %v", err)
+			return
+		}
+		authAPIClient = client
+	})
+	return authAPIClient
+}
+
+// authenticatedUser the username and role of the active platform user whose session
+// token the request carries in X-User-Token, empty when it carries none. The token is
+// checked by the auth API when service tokens are configured, else in the database;
+// like the auth API, sessions bound to another client and impersonations whose admin
+// may no longer impersonate are rejected.
+func authenticatedUser(c *gin.Context) (username, role string, err error) {
+	token := authclient.TokenFromHeader(c.GetHeader(userTokenHeader))
+	if token == "" {
+		return "", "", nil
+	}
+
+	if client := authAPI(); client != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		// the auth API reports sessions of inactive users, revoked impersonations and
+		// sessions bound to another client as inactive
+		introspection, err := client.IntrospectFor(ctx, token, &authclient.ClientInfo{
+			IP:        c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to check %s: %w", userTokenHeader, err)
+		}
+		if !introspection.Active {
+			return "", "", errors.New("invalid " + userTokenHeader)
+		}
+		return introspection.Username, introspection.Role, nil
+	}
+
+	session, err := userSessions.GetSessionByToken(token)
+	if err != nil {
+		if errors.Is(err, internal.ErrSessionNotFound) {
+			return "", "", errors.New("invalid " + userTokenHeader)
+		}
+		return "", "", err
+	}
+	if err := userSessions.CheckSessionBinding(session, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+		return "", "", fmt.Errorf("invalid %s: %w", userTokenHeader, err)
+	}
+	if !session.User.IsActive() {
+		return "", "", errors.New("user of " + userTokenHeader + " is not active")
+	}
+	if session.ImpersonationRevoked() {
+		return "", "", errors.New("invalid " + userTokenHeader + ": impersonating admin is no longer allowed to impersonate")
+	}
+	return session.User.Username, string(session.User.Role), nil
+}
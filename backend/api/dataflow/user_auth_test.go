@@ -0,0 +1,88 @@
+package dataflow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent-connector/internal"
+)
+
+// fakeUserSessions sessions by token, bound to the client IP in boundIP
+type fakeUserSessions struct {
+	sessions map[string]*internal.UserSession
+	boundIP  map[string]string
+}
+
+func (f *fakeUserSessions) GetSessionByToken(token string) (*internal.UserSession, error) {
+	session, ok := f.sessions[token]
+	if !ok {
+		return nil, internal.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (f *fakeUserSessions) CheckSessionBinding(session *internal.UserSession, ip, userAgent string) error {
+	if bound, ok := f.boundIP[session.Token]; ok && bound != ip {
+		return internal.ErrSessionBindingViolated
+	}
+	return nil
+}
+
+// userTokenRequest a gin context for a request with the session token from the client IP
+func userTokenRequest(token, clientIP string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/openai/chat/completions", nil)
+	c.Request.RemoteAddr = clientIP + ":40000"
+	c.Request.Header.Set(userTokenHeader, "Bearer "+token)
+	return c
+}
+
+func TestAuthenticatedUserSessionChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adminID := uint(1)
+	expires := time.Now().Add(time.Hour)
+	fake := &fakeUserSessions{
+		sessions: map[string]*internal.UserSession{
+			"bound": {
+				Token:     "bound",
+				ExpiresAt: expires,
+				User:      internal.User{Username: "alice", Role: internal.UserRoleUser, Status: internal.UserStatusActive},
+			},
+			"impersonated": {
+				Token:          "impersonated",
+				ExpiresAt:      expires,
+				ImpersonatorID: &adminID,
+				// the admin was demoted since the impersonation started
+				Impersonator: &internal.User{Username: "root", Role: internal.UserRoleUser, Status: internal.UserStatusActive},
+				User:         internal.User{Username: "bob", Role: internal.UserRoleUser, Status: internal.UserStatusActive},
+			},
+		},
+		boundIP: map[string]string{"bound": "203.0.113.7"},
+	}
+	previous := userSessions
+	userSessions = fake
+	defer func() { userSessions = previous }()
+
+	username, role, err := authenticatedUser(userTokenRequest("bound", "203.0.113.7"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", username)
+	assert.Equal(t, string(internal.UserRoleUser), role)
+
+	// the same session from another client does not authenticate
+	_, _, err = authenticatedUser(userTokenRequest("bound", "198.51.100.9"))
+	assert.ErrorIs(t, err, internal.ErrSessionBindingViolated)
+
+	_, _, err = authenticatedUser(userTokenRequest("impersonated", "203.0.113.7"))
+	assert.Error(t, err, "revoked impersonation authenticated")
+
+	fake.sessions["impersonated"].Impersonator.Role = internal.UserRoleAdmin
+	username, _, err = authenticatedUser(userTokenRequest("impersonated", "203.0.113.7"))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", username)
+}
@@ -0,0 +1,80 @@
+package dataflow
+
+import (
+	"bytes"
+	"io"
+	"log"
+
+	"agent-connector/api/dataflow/backends"
+	"agent-connector/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// applyUserDefaults fill the fields a request leaves out from the settings of the
+// platform user authenticated with X-User-Token; the body's user field names no one,
+// any client could apply another user's defaults with it. The default agent was already
+// resolved by the authentication middleware, see requestedAgent.
+func (h *DataFlowAPIHandler) applyUserDefaults(c *gin.Context, req *backends.BackendRequest) {
+	req.Locale = c.GetHeader("Accept-Language")
+	if req.AuthenticatedUser == "" {
+		return
+	}
+
+	settings, err := internal.LookupUserSettingsByUsername(req.AuthenticatedUser)
+	if err != nil {
+		log.Printf("Failed to load settings of user %s: %v", req.AuthenticatedUser, err)
+		return
+	}
+	if settings == nil {
+		return
+	}
+
+	if req.Model == "" {
+		req.Model = settings.DefaultModel
+	}
+	if req.Locale == "" {
+		req.Locale = settings.Locale
+	}
+}
+
+// requestedAgent the agent a request names in the path, the agent_id query parameter or
+// the agent_id field of its JSON body. The body stays readable for the handlers.
+func requestedAgent(c *gin.Context) string {
+	agentID := c.Param("agent_id")
+	if agentID == "" {
+		agentID = c.Query("agent_id")
+	}
+	if c.Request.Body == nil || c.ContentType() != binding.MIMEJSON {
+		return agentID
+	}
+
+	body := bodyFields(c)
+	if raw, ok := c.Get(gin.BodyBytesKey); ok {
+		// handlers binding the body directly read it once more
+		cached, _ := raw.([]byte)
+		c.Request.Body = io.NopCloser(bytes.NewReader(cached))
+	}
+	if agentID == "" {
+		agentID, _ = body["agent_id"].(string)
+	}
+	return agentID
+}
+
+// userDefaultAgent the default agent in the settings of a platform user, empty when the
+// user is unknown or has none; only called for users authenticated with X-User-Token
+func userDefaultAgent(username string) string {
+	if username == "" {
+		return ""
+	}
+	settings, err := internal.LookupUserSettingsByUsername(username)
+	if err != nil {
+		log.Printf("Failed to load settings of user %s: %v", username, err)
+		return ""
+	}
+	if settings == nil {
+		return ""
+	}
+	return settings.DefaultAgentID
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// envelope response structure shared by the platform APIs
+type envelope struct {
+	Code       int             `json:"code"`
+	Message    string          `json:"message"`
+	Data       json.RawMessage `json:"data"`
+	Pagination *pagination     `json:"pagination"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// pagination list pagination information
+type pagination struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// apiClient minimal client for one platform service
+type apiClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func newAPIClient(baseURL, token string) *apiClient {
+	return &apiClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do send a JSON request and decode the envelope, body may be nil and query may be empty
+func (c *apiClient) do(method, path string, query url.Values, body interface{}) (*envelope, error) {
+	if body == nil {
+		return c.doRaw(method, path, query, "", nil)
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.doRaw(method, path, query, "application/json", payload)
+}
+
+// doRaw send a request with a pre-encoded body and decode the envelope
+func (c *apiClient) doRaw(method, path string, query url.Values, contentType string, body []byte) (*envelope, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	var result envelope
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("unexpected response from %s %s (HTTP %d): %w", method, path, resp.StatusCode, err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		if result.Error != nil {
+			return nil, fmt.Errorf("%s: %s (%s)", result.Message, result.Error.Message, result.Error.Type)
+		}
+		return nil, fmt.Errorf("%s (HTTP %d)", result.Message, resp.StatusCode)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Profile connection settings of one platform installation
+type Profile struct {
+	AuthURL        string `json:"auth_url"`
+	ControlFlowURL string `json:"control_flow_url"`
+	Username       string `json:"username,omitempty"`
+	Token          string `json:"token,omitempty"`
+}
+
+// CLIConfig acctl configuration file
+type CLIConfig struct {
+	Current  string              `json:"current"`
+	Profiles map[string]*Profile `json:"profiles"`
+
+	path string
+}
+
+// defaultProfile settings matching the default service ports
+func defaultProfile() *Profile {
+	return &Profile{
+		AuthURL:        "http://localhost:8083",
+		ControlFlowURL: "http://localhost:8081",
+	}
+}
+
+// configPath resolve the configuration file, ACCTL_CONFIG overrides ~/.acctl/config.json
+func configPath() (string, error) {
+	if path := os.Getenv("ACCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, ".acctl", "config.json"), nil
+}
+
+// loadCLIConfig read the configuration file, a missing file yields a "default" profile
+func loadCLIConfig() (*CLIConfig, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &CLIConfig{
+		Current:  "default",
+		Profiles: map[string]*Profile{"default": defaultProfile()},
+		path:     path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*Profile)
+	}
+	return cfg, nil
+}
+
+// Save write the configuration file, it holds session tokens so it is only readable by the owner
+func (c *CLIConfig) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o600)
+}
+
+// Profile get a profile by name, empty name means the current profile
+func (c *CLIConfig) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = c.Current
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found, create it with: acctl profile set %s", name, name)
+	}
+	return profile, nil
+}
+
+// ProfileNames list profile names in order
+func (c *CLIConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,635 @@
+// Command acctl administers an Agent-Connector installation through the auth and control flow APIs.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `acctl - Agent-Connector administration CLI
+
+Usage:
+  acctl [-profile name] [-o table|json] <command> [arguments]
+
+Commands:
+  login [-username name]                  log in, the password is read from ACCTL_PASSWORD or stdin
+  logout                                  log out and forget the session token
+  profile list                            list profiles
+  profile use <name>                      switch the current profile
+  profile set <name> [-auth-url url] [-control-flow-url url]
+                                          create or update a profile
+  agents list [-search s] [-status enabled|disabled] [-type t] [-sort-by col] [-order asc|desc] [-page n] [-page-size n]
+  agents get <id>
+  agents create -name n -type openai|dify-chat|dify-workflow -url u -source-api-key k [-qps n] [-response-format openai|dify] [-streaming]
+  agents rotate-key <id>                  generate a new connector API key
+  agents enable <id>...                   enable agents
+  agents disable <id>...                  disable agents
+  agents delete <id>
+  rate-limit set <id> <qps>               set the QPS limit of an agent
+  queue get <id>                          show the queue settings and depth of an agent
+  queue set <id> -max-size n -ttl seconds set a per-agent queue override
+  queue clear <id>                        remove the per-agent queue override
+  queue watch <id> [-interval 2s]         poll the queue depth of an agent
+  sync plan -f spec.yaml                  show the changes a declarative spec would make
+  sync apply -f spec.yaml [-auto-approve] apply a declarative spec after confirming its plan
+  users list [-search s] [-status s] [-type role] [-page n] [-page-size n]
+`
+
+// cli shared state of a command invocation
+type cli struct {
+	config      *CLIConfig
+	profileName string
+	profile     *Profile
+	out         *printer
+}
+
+func main() {
+	global := flag.NewFlagSet("acctl", flag.ExitOnError)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	profileName := global.String("profile", "", "profile to use, defaults to the current profile")
+	format := global.String("o", "table", "output format: table or json")
+	global.Parse(os.Args[1:])
+
+	if *format != "table" && *format != "json" {
+		fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	config, err := loadCLIConfig()
+	if err != nil {
+		fail(err)
+	}
+
+	c := &cli{config: config, profileName: *profileName, out: &printer{format: *format}}
+	if err := c.run(args[0], args[1:]); err != nil {
+		fail(err)
+	}
+}
+
+// run dispatch a command
+func (c *cli) run(command string, args []string) error {
+	if command == "profile" {
+		return c.runProfile(args)
+	}
+
+	profile, err := c.config.Profile(c.profileName)
+	if err != nil {
+		return err
+	}
+	c.profile = profile
+
+	switch command {
+	case "login":
+		return c.login(args)
+	case "logout":
+		return c.logout()
+	case "agents":
+		return c.runAgents(args)
+	case "rate-limit":
+		return c.runRateLimit(args)
+	case "queue":
+		return c.runQueue(args)
+	case "sync":
+		return c.runSync(args)
+	case "users":
+		return c.runUsers(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, run acctl help", command)
+	}
+}
+
+func (c *cli) authAPI() *apiClient {
+	return newAPIClient(c.profile.AuthURL, c.profile.Token)
+}
+
+func (c *cli) controlFlowAPI() *apiClient {
+	return newAPIClient(c.profile.ControlFlowURL, c.profile.Token)
+}
+
+// -- profiles --
+
+func (c *cli) runProfile(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: acctl profile list|use|set")
+	}
+
+	switch args[0] {
+	case "list":
+		for _, name := range c.config.ProfileNames() {
+			marker := " "
+			if name == c.config.Current {
+				marker = "*"
+			}
+			profile := c.config.Profiles[name]
+			fmt.Printf("%s %s\tauth=%s control-flow=%s user=%s\n", marker, name, profile.AuthURL, profile.ControlFlowURL, formatCell(profile.Username))
+		}
+		return nil
+	case "use":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: acctl profile use <name>")
+		}
+		if _, err := c.config.Profile(args[1]); err != nil {
+			return err
+		}
+		c.config.Current = args[1]
+		return c.config.Save()
+	case "set":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: acctl profile set <name> [-auth-url url] [-control-flow-url url]")
+		}
+		name := args[1]
+		profile, ok := c.config.Profiles[name]
+		if !ok {
+			profile = defaultProfile()
+			c.config.Profiles[name] = profile
+		}
+
+		fs := flag.NewFlagSet("profile set", flag.ExitOnError)
+		authURL := fs.String("auth-url", profile.AuthURL, "auth API base URL")
+		controlFlowURL := fs.String("control-flow-url", profile.ControlFlowURL, "control flow API base URL")
+		fs.Parse(args[2:])
+
+		profile.AuthURL = *authURL
+		profile.ControlFlowURL = *controlFlowURL
+		return c.config.Save()
+	default:
+		return fmt.Errorf("unknown profile command %q", args[0])
+	}
+}
+
+// -- session --
+
+func (c *cli) login(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	username := fs.String("username", c.profile.Username, "username")
+	fs.Parse(args)
+
+	if *username == "" {
+		return fmt.Errorf("username is required")
+	}
+
+	password := os.Getenv("ACCTL_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	resp, err := newAPIClient(c.profile.AuthURL, "").do(http.MethodPost, "/api/v1/auth/login", nil, map[string]string{
+		"username": *username,
+		"password": password,
+	})
+	if err != nil {
+		return err
+	}
+
+	var login struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := decodeData(resp, &login); err != nil {
+		return err
+	}
+
+	c.profile.Username = *username
+	c.profile.Token = login.Token
+	if err := c.config.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in as %s, session expires at %s\n", *username, login.ExpiresAt.Local().Format(time.RFC3339))
+	return nil
+}
+
+func (c *cli) logout() error {
+	if c.profile.Token != "" {
+		if _, err := c.authAPI().do(http.MethodPost, "/api/v1/auth/logout", nil, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+	c.profile.Token = ""
+	return c.config.Save()
+}
+
+// -- agents --
+
+var agentColumns = []string{"id", "agent_id", "name", "type", "qps", "enabled", "connector_key_prefix"}
+
+func (c *cli) runAgents(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: acctl agents list|get|create|rotate-key|enable|disable|delete")
+	}
+
+	api := c.controlFlowAPI()
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("agents list", flag.ExitOnError)
+		query := listFlags(fs)
+		fs.Parse(args[1:])
+
+		values := query()
+		values.Set("hide_secrets", "true")
+		resp, err := api.do(http.MethodGet, "/api/v1/controlflow/agents", values, nil)
+		if err != nil {
+			return err
+		}
+		if err := c.out.print(resp.Data, agentColumns); err != nil {
+			return err
+		}
+		c.out.printPagination(resp.Pagination)
+		return nil
+	case "get":
+		id, err := idArg(args, 1)
+		if err != nil {
+			return err
+		}
+		resp, err := api.do(http.MethodGet, "/api/v1/controlflow/agents/"+id, nil, nil)
+		if err != nil {
+			return err
+		}
+		return c.out.print(resp.Data, append(agentColumns, "url", "support_streaming", "response_format"))
+	case "create":
+		fs := flag.NewFlagSet("agents create", flag.ExitOnError)
+		name := fs.String("name", "", "agent name")
+		agentType := fs.String("type", "openai", "openai, dify-chat or dify-workflow")
+		agentURL := fs.String("url", "", "upstream URL")
+		sourceKey := fs.String("source-api-key", "", "upstream API key")
+		qps := fs.Int("qps", 10, "QPS limit")
+		responseFormat := fs.String("response-format", "openai", "openai or dify")
+		streaming := fs.Bool("streaming", true, "whether the agent supports streaming")
+		description := fs.String("description", "", "description")
+		fs.Parse(args[1:])
+
+		resp, err := api.do(http.MethodPost, "/api/v1/controlflow/agents", nil, map[string]interface{}{
+			"name":              *name,
+			"type":              *agentType,
+			"url":               *agentURL,
+			"source_api_key":    *sourceKey,
+			"qps":               *qps,
+			"enabled":           true,
+			"description":       *description,
+			"support_streaming": *streaming,
+			"response_format":   *responseFormat,
+		})
+		if err != nil {
+			return err
+		}
+		return c.printNewKey(resp)
+	case "rotate-key":
+		id, err := idArg(args, 1)
+		if err != nil {
+			return err
+		}
+		resp, err := api.do(http.MethodPost, "/api/v1/controlflow/agents/"+id+"/rotate-key", nil, nil)
+		if err != nil {
+			return err
+		}
+		return c.printNewKey(resp)
+	case "enable", "disable":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: acctl agents %s <id>...", args[0])
+		}
+		ids := make([]uint, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid agent ID %q", arg)
+			}
+			ids = append(ids, uint(id))
+		}
+		resp, err := api.do(http.MethodPut, "/api/v1/controlflow/agents/batch/status", nil, map[string]interface{}{
+			"ids":     ids,
+			"enabled": args[0] == "enable",
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, resp.Message)
+		var result struct {
+			Results json.RawMessage `json:"results"`
+		}
+		if err := decodeData(resp, &result); err != nil {
+			return err
+		}
+		return c.out.print(result.Results, []string{"id", "success", "error"})
+	case "delete":
+		id, err := idArg(args, 1)
+		if err != nil {
+			return err
+		}
+		resp, err := api.do(http.MethodDelete, "/api/v1/controlflow/agents/"+id, nil, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp.Message)
+		return nil
+	default:
+		return fmt.Errorf("unknown agents command %q", args[0])
+	}
+}
+
+// printNewKey show an agent together with its one-time connector API key
+func (c *cli) printNewKey(resp *envelope) error {
+	if err := c.out.print(resp.Data, []string{"id", "agent_id", "name", "connector_api_key"}); err != nil {
+		return err
+	}
+	if c.out.format == "table" {
+		fmt.Fprintln(os.Stderr, "\nStore the connector API key now, it will not be shown again.")
+	}
+	return nil
+}
+
+// -- rate limits --
+
+func (c *cli) runRateLimit(args []string) error {
+	if len(args) != 3 || args[0] != "set" {
+		return fmt.Errorf("usage: acctl rate-limit set <id> <qps>")
+	}
+
+	qps, err := strconv.Atoi(args[2])
+	if err != nil || qps < 1 {
+		return fmt.Errorf("qps must be a positive integer")
+	}
+
+	resp, err := c.controlFlowAPI().do(http.MethodPut, "/api/v1/controlflow/agents/"+args[1], nil, map[string]interface{}{
+		"qps": qps,
+	})
+	if err != nil {
+		return err
+	}
+	return c.out.print(resp.Data, []string{"id", "agent_id", "name", "qps"})
+}
+
+// -- queues --
+
+var queueColumns = []string{"agent_id", "queue_name", "current_size", "max_queue_size", "default_ttl", "override", "applied"}
+
+func (c *cli) runQueue(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: acctl queue get|set|clear|watch <id>")
+	}
+
+	api := c.controlFlowAPI()
+	path := "/api/v1/controlflow/agents/" + args[1] + "/queue-config"
+
+	switch args[0] {
+	case "get":
+		resp, err := api.do(http.MethodGet, path, nil, nil)
+		if err != nil {
+			return err
+		}
+		return c.out.print(resp.Data, queueColumns)
+	case "set":
+		fs := flag.NewFlagSet("queue set", flag.ExitOnError)
+		maxSize := fs.Int64("max-size", 0, "max queued requests, 0 means unlimited")
+		ttl := fs.Int64("ttl", 0, "queued request TTL in seconds, 0 means no expiry")
+		fs.Parse(args[2:])
+
+		resp, err := api.do(http.MethodPut, path, nil, map[string]int64{
+			"max_queue_size": *maxSize,
+			"default_ttl":    *ttl,
+		})
+		if err != nil {
+			return err
+		}
+		return c.out.print(resp.Data, queueColumns)
+	case "clear":
+		resp, err := api.do(http.MethodDelete, path, nil, nil)
+		if err != nil {
+			return err
+		}
+		return c.out.print(resp.Data, queueColumns)
+	case "watch":
+		fs := flag.NewFlagSet("queue watch", flag.ExitOnError)
+		interval := fs.Duration("interval", 2*time.Second, "poll interval")
+		fs.Parse(args[2:])
+
+		for {
+			resp, err := api.do(http.MethodGet, path, nil, nil)
+			if err != nil {
+				return err
+			}
+			var status struct {
+				CurrentSize  *int64 `json:"current_size"`
+				MaxQueueSize int64  `json:"max_queue_size"`
+			}
+			if err := decodeData(resp, &status); err != nil {
+				return err
+			}
+
+			size := "unknown"
+			if status.CurrentSize != nil {
+				size = strconv.FormatInt(*status.CurrentSize, 10)
+			}
+			limit := "unlimited"
+			if status.MaxQueueSize > 0 {
+				limit = strconv.FormatInt(status.MaxQueueSize, 10)
+			}
+			fmt.Printf("%s  pending=%s max=%s\n", time.Now().Format("15:04:05"), size, limit)
+			time.Sleep(*interval)
+		}
+	default:
+		return fmt.Errorf("unknown queue command %q", args[0])
+	}
+}
+
+// -- declarative sync --
+
+func (c *cli) runSync(args []string) error {
+	if len(args) == 0 || (args[0] != "plan" && args[0] != "apply") {
+		return fmt.Errorf("usage: acctl sync plan|apply -f spec.yaml")
+	}
+
+	fs := flag.NewFlagSet("sync "+args[0], flag.ExitOnError)
+	file := fs.String("f", "", "spec file, - reads stdin; ${VAR} references are expanded from the environment")
+	autoApprove := fs.Bool("auto-approve", false, "apply without asking for confirmation")
+	fs.Parse(args[1:])
+
+	if *file == "" {
+		return fmt.Errorf("a spec file is required (-f)")
+	}
+	if args[0] == "apply" && c.out.format == "json" && !*autoApprove {
+		return fmt.Errorf("-o json apply needs -auto-approve, run sync plan first to review the changes")
+	}
+	var raw []byte
+	var err error
+	if *file == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read spec: %w", err)
+	}
+	spec := []byte(os.ExpandEnv(string(raw)))
+
+	api := c.controlFlowAPI()
+	resp, err := api.doRaw(http.MethodPost, "/api/v1/controlflow/sync/plan", nil, "application/yaml", spec)
+	if err != nil {
+		return err
+	}
+
+	var plan struct {
+		Fingerprint string `json:"fingerprint"`
+		Changes     []struct {
+			Action   string                     `json:"action"`
+			Resource string                     `json:"resource"`
+			Name     string                     `json:"name"`
+			Fields   map[string]json.RawMessage `json:"fields"`
+		} `json:"changes"`
+	}
+	if err := decodeData(resp, &plan); err != nil {
+		return err
+	}
+
+	if args[0] == "plan" || c.out.format == "table" {
+		if c.out.format == "json" {
+			return c.out.print(resp.Data, nil)
+		}
+		for _, change := range plan.Changes {
+			symbol := map[string]string{"create": "+", "update": "~", "delete": "-"}[change.Action]
+			fmt.Printf("%s %s %q\n", symbol, change.Resource, change.Name)
+			fields := make([]string, 0, len(change.Fields))
+			for field := range change.Fields {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				fmt.Printf("    %s: %s\n", field, change.Fields[field])
+			}
+		}
+		fmt.Printf("\n%s\n", resp.Message)
+	}
+
+	if args[0] == "plan" || len(plan.Changes) == 0 {
+		return nil
+	}
+
+	if !*autoApprove {
+		fmt.Fprint(os.Stderr, "\nApply these changes? Only 'yes' is accepted: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(line) != "yes" {
+			return fmt.Errorf("apply cancelled")
+		}
+	}
+
+	resp, err = api.doRaw(http.MethodPost, "/api/v1/controlflow/sync/apply",
+		url.Values{"fingerprint": {plan.Fingerprint}}, "application/yaml", spec)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		CreatedKeys json.RawMessage `json:"created_keys"`
+	}
+	if err := decodeData(resp, &result); err != nil {
+		return err
+	}
+	if c.out.format == "json" {
+		return c.out.print(resp.Data, nil)
+	}
+
+	fmt.Println(resp.Message)
+	if len(result.CreatedKeys) > 0 && string(result.CreatedKeys) != "null" {
+		return c.out.print(result.CreatedKeys, []string{"name", "agent_id", "connector_api_key"})
+	}
+	return nil
+}
+
+// -- users --
+
+func (c *cli) runUsers(args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("usage: acctl users list")
+	}
+
+	fs := flag.NewFlagSet("users list", flag.ExitOnError)
+	query := listFlags(fs)
+	fs.Parse(args[1:])
+
+	resp, err := c.authAPI().do(http.MethodGet, "/api/v1/users", query(), nil)
+	if err != nil {
+		return err
+	}
+	if err := c.out.print(resp.Data, []string{"id", "username", "email", "role", "status", "last_login"}); err != nil {
+		return err
+	}
+	c.out.printPagination(resp.Pagination)
+	return nil
+}
+
+// -- helpers --
+
+// listFlags register the shared list flags, the returned function builds the query once parsed
+func listFlags(fs *flag.FlagSet) func() url.Values {
+	search := fs.String("search", "", "search term")
+	status := fs.String("status", "", "status filter")
+	typ := fs.String("type", "", "type filter")
+	sortBy := fs.String("sort-by", "", "sort column")
+	order := fs.String("order", "", "asc or desc")
+	page := fs.Int("page", 1, "page number")
+	pageSize := fs.Int("page-size", 20, "items per page")
+
+	return func() url.Values {
+		values := url.Values{}
+		values.Set("page", strconv.Itoa(*page))
+		values.Set("page_size", strconv.Itoa(*pageSize))
+		for key, value := range map[string]string{
+			"search":  *search,
+			"status":  *status,
+			"type":    *typ,
+			"sort_by": *sortBy,
+			"order":   *order,
+		} {
+			if value != "" {
+				values.Set(key, value)
+			}
+		}
+		return values
+	}
+}
+
+// idArg get a numeric ID argument
+func idArg(args []string, index int) (string, error) {
+	if len(args) <= index {
+		return "", fmt.Errorf("missing ID argument")
+	}
+	if _, err := strconv.ParseUint(args[index], 10, 32); err != nil {
+		return "", fmt.Errorf("invalid ID %q", args[index])
+	}
+	return args[index], nil
+}
+
+// decodeData decode the data field of a response
+func decodeData(resp *envelope, out interface{}) error {
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("response has no data")
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "acctl:", err)
+	os.Exit(1)
+}
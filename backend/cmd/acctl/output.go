@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes command results as JSON or as a table
+type printer struct {
+	format string // "table" or "json"
+}
+
+// print render data, columns select the fields shown in table mode
+func (p *printer) print(data json.RawMessage, columns []string) error {
+	if p.format == "json" {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		// single object, print it as one row
+		var row map[string]interface{}
+		if err := json.Unmarshal(data, &row); err != nil {
+			return fmt.Errorf("cannot render response as a table: %w", err)
+		}
+		rows = []map[string]interface{}{row}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = formatCell(row[column])
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+// printPagination summarize the list position in table mode
+func (p *printer) printPagination(page *pagination) {
+	if p.format == "json" || page == nil {
+		return
+	}
+	fmt.Printf("\npage %d/%d, %d total\n", page.Page, page.TotalPages, page.Total)
+}
+
+// formatCell render a JSON value for a table cell
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
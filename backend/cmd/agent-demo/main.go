@@ -124,12 +124,15 @@ func basicAgentCreationDemo(openaiKey, difyKey, difyBaseURL, difyAppID string) {
 func agentManagerDemo(ctx context.Context, openaiKey, difyKey, difyBaseURL, difyAppID string) {
 	// Create agent manager
 	config := &agent.AgentManagerConfig{
-		LoadBalancingStrategy: agent.Priority,
-		EnableHealthChecks:    true,
-		HealthCheckInterval:   30 * time.Second,
-		DefaultTimeout:        10 * time.Second,
-		MaxRetries:            3,
-		EnableMetrics:         true,
+		LoadBalancingStrategy:  agent.Priority,
+		EnableHealthChecks:     true,
+		HealthCheckInterval:    30 * time.Second,
+		DefaultTimeout:         10 * time.Second,
+		MaxRetries:             3,
+		StatusCacheTTL:         agent.DefaultStatusCacheTTL,
+		StatusCacheJitter:      agent.DefaultStatusCacheJitter,
+		ProviderLimitThreshold: agent.DefaultProviderLimitThreshold,
+		EnableMetrics:          true,
 	}
 
 	manager, err := agent.NewAgentManager(config)
@@ -272,7 +275,7 @@ func configurationBuildersDemo() {
 		WithInitialDelay(2 * time.Second).
 		WithMaxDelay(60 * time.Second).
 		WithMultiplier(2.0).
-		WithRetryableErrors([]string{"timeout", "rate_limit", "service_unavailable"}).
+		WithRetryableErrors([]string{agent.ErrorCodeUpstreamTimeout, agent.ErrorCodeRateLimited, agent.ErrorCodeUpstreamUnavailable}).
 		Build()
 
 	fmt.Printf("✓ Built retry policy: MaxRetries=%d, InitialDelay=%v\n",
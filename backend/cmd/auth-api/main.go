@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,12 +14,25 @@ import (
 	"agent-connector/api/auth"
 	"agent-connector/config"
 	"agent-connector/internal"
+	"agent-connector/pkg/i18n"
+	"agent-connector/pkg/serviceauth"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	validateOnly := flag.Bool("validate", false, "check configuration, database, Redis and agents, print a JSON report and exit")
+	flag.Parse()
+
+	if *validateOnly {
+		report := internal.ValidateDeployment(context.Background(), "auth-api")
+		if err := report.Write(os.Stdout); err != nil {
+			log.Fatalf("Failed to write validation report: %v", err)
+		}
+		os.Exit(report.ExitCode())
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -35,6 +49,45 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Initialize platform event publisher, used for impersonation notices
+	eventPublisher, err := internal.InitEventPublisher("auth-api")
+	if err != nil {
+		log.Printf("Warning: event publishing disabled, stored events wait in the outbox: %v", err)
+	} else {
+		defer eventPublisher.Close()
+
+		// Deliver the events stored together with the changes they announce
+		outboxDispatcher := internal.StartOutboxDispatcher()
+		defer outboxDispatcher.Close()
+	}
+
+	// Apply system config changes made in control flow without a restart
+	configSync, err := internal.InitSystemConfigSync()
+	if err != nil {
+		log.Printf("Warning: live system config disabled: %v", err)
+	} else {
+		defer configSync.Close()
+		syncCtx, syncCancel := context.WithCancel(context.Background())
+		defer syncCancel()
+		go configSync.Run(syncCtx)
+	}
+
+	// Background jobs, triggered by hand under /api/v1/system/jobs
+	scheduler := internal.InitJobs("auth-api")
+	defer scheduler.Close()
+	if err := internal.RegisterSessionCleanupJob(scheduler, cfg.Jobs.SessionCleanup); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
+	scheduler.Start()
+
+	// Announce user changes to the lookup cache of the dataflow service
+	lookupInvalidation, err := internal.InitLookupInvalidation()
+	if err != nil {
+		log.Printf("Warning: cached user lookups will refresh after their TTL: %v", err)
+	} else {
+		defer lookupInvalidation.Close()
+	}
+
 	// Set Gin mode
 	if cfg.App.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -49,6 +102,9 @@ func main() {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
+	// Messages in the language of Accept-Language
+	router.Use(i18n.Middleware())
+
 	// CORS configuration
 	if cfg.API.EnableCORS {
 		corsConfig := cors.DefaultConfig()
@@ -63,6 +119,22 @@ func main() {
 	// Set up routes
 	auth.SetupAuthRoutes(router)
 
+	// Internal routes for service-to-service calls
+	if cfg.Security.ServiceAuthKeys != "" {
+		keyRing, err := serviceauth.ParseKeyRing(cfg.Security.ServiceAuthKeys, cfg.Security.ServiceAuthActiveKey)
+		if err != nil {
+			log.Fatalf("Invalid service auth keys: %v", err)
+		}
+
+		verifier, err := serviceauth.NewVerifier(keyRing, serviceauth.ServiceAuthAPI)
+		if err != nil {
+			log.Fatalf("Failed to create service token verifier: %v", err)
+		}
+		auth.SetupInternalRoutes(router, verifier)
+	} else {
+		log.Println("Warning: SERVICE_AUTH_KEYS not set, internal service routes are disabled")
+	}
+
 	// Root path
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -91,7 +91,7 @@ func main() {
 	})
 
 	// Set routes
-	controlflow.SetupControlFlowRoutes(r)
+	controlflow.SetupControlFlowRoutes(r, nil)
 
 	// Get port, default 8081
 	port := os.Getenv("PORT")
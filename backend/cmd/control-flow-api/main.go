@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,12 +16,27 @@ import (
 	"agent-connector/api/controlflow"
 	"agent-connector/config"
 	"agent-connector/internal"
+	"agent-connector/pkg/i18n"
+	"agent-connector/pkg/queue"
+	"agent-connector/pkg/serviceauth"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	validateOnly := flag.Bool("validate", false, "check configuration, database, Redis and agents, print a JSON report and exit")
+	seedFile := flag.String("bootstrap", "", "apply a first-run seed file (admin and agents), print the result and exit; ${VAR} references are expanded from the environment")
+	flag.Parse()
+
+	if *validateOnly {
+		report := internal.ValidateDeployment(context.Background(), "control-flow-api")
+		if err := report.Write(os.Stdout); err != nil {
+			log.Fatalf("Failed to write validation report: %v", err)
+		}
+		os.Exit(report.ExitCode())
+	}
+
 	// load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -34,6 +52,91 @@ func main() {
 	if err := internal.InitDatabase(); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
+	if _, err := internal.InitUsageStore(); err != nil {
+		log.Fatal("Failed to initialize usage storage:", err)
+	}
+
+	if *seedFile != "" {
+		os.Exit(runBootstrap(*seedFile))
+	}
+
+	// Initialize platform event publisher
+	eventPublisher, err := internal.InitEventPublisher("control-flow-api")
+	if err != nil {
+		log.Printf("Warning: event publishing disabled, stored events wait in the outbox: %v", err)
+	} else {
+		defer eventPublisher.Close()
+
+		// Deliver the events stored together with the changes they announce
+		outboxDispatcher := internal.StartOutboxDispatcher()
+		defer outboxDispatcher.Close()
+	}
+
+	// Publish system config changes to the other services
+	configSync, err := internal.InitSystemConfigSync()
+	if err != nil {
+		log.Printf("Warning: system config changes will apply after a restart: %v", err)
+	} else {
+		defer configSync.Close()
+	}
+
+	// Announce agent changes to the lookup cache of the dataflow service
+	lookupInvalidation, err := internal.InitLookupInvalidation()
+	if err != nil {
+		log.Printf("Warning: cached agent lookups will refresh after their TTL: %v", err)
+	} else {
+		defer lookupInvalidation.Close()
+	}
+
+	// Initialize encryption of stored usage content
+	contentKeyring, err := internal.InitContentEncryption()
+	if err != nil {
+		log.Fatalf("Failed to initialize content encryption: %v", err)
+	}
+
+	// Background jobs, triggered by hand under /api/v1/controlflow/jobs
+	scheduler := internal.InitJobs("control-flow-api")
+	defer scheduler.Close()
+	if contentKeyring != nil {
+		if err := internal.RegisterReencryptionJob(scheduler, contentKeyring, cfg.Encryption.ReencryptInterval); err != nil {
+			log.Fatalf("Failed to register job: %v", err)
+		}
+	}
+	// Usage forecasting for capacity and budget planning
+	if err := internal.RegisterUsageForecastJob(scheduler, cfg.Usage.ForecastInterval); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
+	if err := internal.RegisterJobRunPurgeJob(scheduler); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
+	if err := internal.RegisterSandboxCleanupJob(scheduler, cfg.Jobs.SandboxCleanup); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
+	// Incidents reported by the status pages of the upstream providers
+	if err := internal.RegisterProviderStatusJob(scheduler, cfg.Jobs.ProviderStatus); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
+	scheduler.Start()
+
+	// Initialize priority queue, used to push per-agent queue overrides
+	queueConfig := queue.DefaultQueueConfig()
+	queueConfig.Redis = queue.DefaultRedisQueueConfig(cfg.Redis.Addr)
+	queueConfig.Redis.Password = cfg.Redis.Password
+	queueConfig.Redis.DB = cfg.Redis.DB
+
+	priorityQueue, err := queue.NewPriorityQueue(queue.RedisType, queueConfig)
+	if err != nil {
+		log.Printf("Warning: queue layer unavailable, queue overrides will only be stored: %v", err)
+		priorityQueue = nil
+	} else {
+		defer priorityQueue.Close()
+
+		syncCtx, syncCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := controlflow.SyncAgentQueueConfigs(syncCtx, priorityQueue); err != nil {
+			log.Printf("Warning: failed to sync queue overrides: %v", err)
+		}
+		syncCancel()
+	}
 
 	// Set Gin mode
 	if cfg.App.Environment == "production" {
@@ -49,18 +152,37 @@ func main() {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
+	// Messages in the language of Accept-Language
+	router.Use(i18n.Middleware())
+
 	// CORS configuration
 	if cfg.API.EnableCORS {
 		corsConfig := cors.DefaultConfig()
 		corsConfig.AllowOrigins = []string{cfg.API.AllowedOrigins}
-		corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+		corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 		corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"}
 		corsConfig.AllowCredentials = true
 		router.Use(cors.New(corsConfig))
 	}
 
 	// Set routes
-	controlflow.SetupControlFlowRoutes(router)
+	controlflow.SetupControlFlowRoutes(router, priorityQueue)
+
+	// Internal routes for service-to-service calls
+	if cfg.Security.ServiceAuthKeys != "" {
+		keyRing, err := serviceauth.ParseKeyRing(cfg.Security.ServiceAuthKeys, cfg.Security.ServiceAuthActiveKey)
+		if err != nil {
+			log.Fatalf("Invalid service auth keys: %v", err)
+		}
+
+		verifier, err := serviceauth.NewVerifier(keyRing, serviceauth.ServiceControlFlowAPI)
+		if err != nil {
+			log.Fatalf("Failed to create service token verifier: %v", err)
+		}
+		controlflow.SetupInternalRoutes(router, verifier)
+	} else {
+		log.Println("Warning: SERVICE_AUTH_KEYS not set, internal service routes are disabled")
+	}
 
 	// Root path
 	router.GET("/", func(c *gin.Context) {
@@ -109,3 +231,35 @@ func main() {
 		log.Println("Control Flow API Server gracefully stopped")
 	}
 }
+
+// runBootstrap apply the seed file and print the result as JSON, returns the exit code
+func runBootstrap(path string) int {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read seed file: %v", err)
+		return 1
+	}
+	spec, err := internal.ParseSeedSpec([]byte(os.ExpandEnv(string(raw))))
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+
+	bootstrapService := &internal.BootstrapService{}
+	result, err := bootstrapService.Bootstrap(spec)
+	if err != nil {
+		log.Printf("Bootstrap failed: %v", err)
+		if errors.Is(err, internal.ErrAlreadyBootstrapped) {
+			return 3
+		}
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Printf("Failed to write bootstrap result: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -4,8 +4,9 @@ import (
 	"agent-connector/api/dataflow"
 	"agent-connector/config"
 	"agent-connector/internal"
-	"agent-connector/pkg/ratelimiter"
+	"agent-connector/pkg/gateway"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,9 +16,23 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
+	validateOnly := flag.Bool("validate", false, "check configuration, database, Redis and agents, print a JSON report and exit")
+	selfTest := flag.Bool("selftest", false, "probe every enabled agent after startup and exit before serving when one is not ready")
+	flag.Parse()
+
+	if *validateOnly {
+		report := internal.ValidateDeployment(context.Background(), "dataflow-api")
+		if err := report.Write(os.Stdout); err != nil {
+			log.Fatalf("Failed to write validation report: %v", err)
+		}
+		os.Exit(report.ExitCode())
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -41,45 +56,37 @@ func main() {
 		gin.SetMode(gin.DebugMode)
 	}
 
-	// Initialize database
-	if err := internal.InitDatabase(); err != nil {
-		log.Fatalf("❌ Failed to initialize database: %v", err)
-	}
-	fmt.Println("✅ Database initialized successfully")
-
-	// Initialize Redis rate limiter
-	rateLimiterConfig := &ratelimiter.Config{
-		Rate:  float64(cfg.Security.DefaultRateLimit),
-		Burst: cfg.Security.DefaultRateLimit * 2,
-		Redis: &ratelimiter.RedisConfig{
-			Addr:            cfg.Redis.Addr,
-			Password:        cfg.Redis.Password,
-			DB:              cfg.Redis.DB,
-			PoolSize:        10,
-			MinIdleConns:    2,
-			ConnMaxIdleTime: 30 * time.Minute,
-		},
-	}
-
-	redisRateLimiter, err := ratelimiter.NewRedisRateLimiter(rateLimiterConfig)
+	// Connect the database and Redis and build the dataflow pipeline
+	gw, err := gateway.New(
+		gateway.WithConfig(cfg),
+		gateway.WithMiddleware(corsMiddleware(), loggingMiddleware()),
+		gateway.WithLegacyRoutes(),
+		gateway.WithLogf(func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		}),
+	)
 	if err != nil {
-		log.Fatalf("❌ Failed to initialize Redis rate limiter: %v", err)
+		log.Fatalf("❌ %v", err)
+	}
+	router := gw.Engine()
+	fmt.Println("✅ Backend and legacy routes initialized")
+
+	// Probe the agents' upstreams before traffic is admitted
+	if *selfTest {
+		report, err := dataflow.RunSelfTest(context.Background())
+		if err != nil {
+			gw.Close()
+			log.Fatalf("❌ Self-test failed: %v", err)
+		}
+		fmt.Println("\n🩺 Agent readiness:")
+		report.WriteMatrix(os.Stdout)
+		if !report.Ready {
+			gw.Close()
+			fmt.Println("❌ Self-test failed, fix the agents above before serving traffic")
+			os.Exit(report.ExitCode())
+		}
+		fmt.Println("✅ Self-test passed")
 	}
-	fmt.Println("✅ Redis rate limiter initialized successfully")
-
-	// Create Gin router
-	router := gin.New()
-
-	// Setup middlewares
-	setupMiddlewares(router, cfg)
-
-	// Setup new Backend routes
-	dataflow.SetupBackendRoutes(router, redisRateLimiter)
-	fmt.Println("✅ New Backend architecture routes initialized")
-
-	// Setup legacy routes for backward compatibility
-	dataflow.SetupLegacyRoutes(router, redisRateLimiter)
-	fmt.Println("✅ Legacy routes initialized for backward compatibility")
 
 	// Add root path information
 	router.GET("/", func(c *gin.Context) {
@@ -92,9 +99,11 @@ func main() {
 			"endpoints": map[string]interface{}{
 				"health":        "/api/v1/health",
 				"openai_chat":   "/api/v1/openai/chat/completions",
+				"openai_proxy":  "/api/v1/openai/* (forwarded verbatim to agents with passthrough)",
 				"dify_chat":     "/api/v1/dify/chat-messages",
 				"dify_workflow": "/api/v1/dify/workflows/run",
 				"legacy_chat":   "/api/v1/chat (deprecated, use specific endpoints)",
+				"openapi":       "/openapi.json",
 				"documentation": "https://docs.agent-connector.com/dataflow-api",
 			},
 			"authentication": map[string]string{
@@ -117,28 +126,32 @@ func main() {
 		})
 	})
 
+	// HTTP/2 is negotiated over TLS, h2c serves it to clients and proxies without TLS
+	var handler http.Handler = router
+	dataConfig := cfg.Services.DataFlowAPI
+	if dataConfig.EnableHTTP2 && !dataConfig.EnableTLS {
+		handler = h2c.NewHandler(router, &http2.Server{})
+	}
+
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         cfg.GetServiceAddr("data"),
-		Handler:      router,
+		Handler:      handler,
 		ReadTimeout:  cfg.Services.DataFlowAPI.ReadTimeout,
 		WriteTimeout: cfg.Services.DataFlowAPI.WriteTimeout,
 		IdleTimeout:  cfg.Services.DataFlowAPI.IdleTimeout,
 	}
 
-	// Gracefully shutdown
+	// Gracefully shutdown, main waits for it so buffered usage and events are written
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		<-c
 
 		fmt.Println("\n🛑 Shutting down Data Flow API server...")
 
-		// Close rate limiter
-		if redisRateLimiter != nil {
-			redisRateLimiter.Close()
-		}
-
 		// Give server 5 seconds to complete existing requests
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -148,6 +161,10 @@ func main() {
 		} else {
 			fmt.Println("✅ Data Flow API server gracefully stopped")
 		}
+
+		// Write the usage records and events of the requests that just completed
+		gw.Close()
+		fmt.Println("✅ Buffered usage records written")
 	}()
 
 	// Print API endpoints information
@@ -158,15 +175,20 @@ func main() {
 	fmt.Println("📋 Ready to handle agent requests with new Backend architecture")
 	fmt.Println("💡 Use Ctrl+C to gracefully shutdown the server")
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if dataConfig.EnableTLS {
+		err = server.ListenAndServeTLS(dataConfig.TLSCertPath, dataConfig.TLSKeyPath)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("❌ Failed to start server: %v", err)
 	}
+	<-stopped
 }
 
-// setupMiddlewares setup common middlewares
-func setupMiddlewares(router *gin.Engine, cfg *config.Config) {
-	// CORS middleware
-	router.Use(func(c *gin.Context) {
+// corsMiddleware allow browser clients of any origin
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key")
@@ -178,10 +200,12 @@ func setupMiddlewares(router *gin.Engine, cfg *config.Config) {
 		}
 
 		c.Next()
-	})
+	}
+}
 
-	// Logging middleware
-	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+// loggingMiddleware access log of the requests
+func loggingMiddleware() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		return fmt.Sprintf("[DataFlow-Backend] %s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
 			param.ClientIP,
 			param.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
@@ -193,15 +217,6 @@ func setupMiddlewares(router *gin.Engine, cfg *config.Config) {
 			param.Request.UserAgent(),
 			param.ErrorMessage,
 		)
-	}))
-
-	// Recovery middleware
-	router.Use(gin.Recovery())
-
-	// Request body size limit
-	router.Use(func(c *gin.Context) {
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.API.MaxRequestBodySize)
-		c.Next()
 	})
 }
 
@@ -209,6 +224,7 @@ func setupMiddlewares(router *gin.Engine, cfg *config.Config) {
 func printAPIEndpoints(cfg *config.Config) {
 	fmt.Println("\n📡 Available API Endpoints (New Backend Architecture):")
 	fmt.Println("├── GET  /                                    - Service information")
+	fmt.Println("├── GET  /openapi.json                        - OpenAPI 3 specification")
 	fmt.Println("├── GET  /api/v1/health                       - Health check")
 	fmt.Println("├── POST /api/v1/openai/chat/completions      - OpenAI compatible interface")
 	fmt.Println("├── POST /api/v1/dify/chat-messages           - Dify Chat interface")
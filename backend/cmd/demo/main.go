@@ -39,7 +39,10 @@ func basicDemo() {
 		Burst: 3,   // Allow burst of 3 requests
 	}
 
-	limiter := ratelimiter.NewLocalRateLimiter(config)
+	limiter, err := ratelimiter.NewLocalRateLimiter(config)
+	if err != nil {
+		log.Fatalf("Failed to create rate limiter: %v", err)
+	}
 	defer limiter.Close()
 
 	ctx := context.Background()
@@ -70,7 +73,10 @@ func multipleKeysDemo() {
 		Burst: 2,    // Allow burst of 2 requests
 	}
 
-	limiter := ratelimiter.NewLocalRateLimiter(config)
+	limiter, err := ratelimiter.NewLocalRateLimiter(config)
+	if err != nil {
+		log.Fatalf("Failed to create rate limiter: %v", err)
+	}
 	defer limiter.Close()
 
 	ctx := context.Background()
@@ -106,7 +112,10 @@ func burstDemo() {
 		Burst: 5,   // Allow burst of 5 requests
 	}
 
-	limiter := ratelimiter.NewLocalRateLimiter(config)
+	limiter, err := ratelimiter.NewLocalRateLimiter(config)
+	if err != nil {
+		log.Fatalf("Failed to create rate limiter: %v", err)
+	}
 	defer limiter.Close()
 
 	ctx := context.Background()
@@ -158,7 +167,10 @@ func waitDemo() {
 		Burst: 1,   // Allow burst of 1 request
 	}
 
-	limiter := ratelimiter.NewLocalRateLimiter(config)
+	limiter, err := ratelimiter.NewLocalRateLimiter(config)
+	if err != nil {
+		log.Fatalf("Failed to create rate limiter: %v", err)
+	}
 	defer limiter.Close()
 
 	ctx := context.Background()
@@ -192,7 +204,10 @@ func reservationDemo() {
 		Burst: 2,   // Allow burst of 2 requests
 	}
 
-	limiter := ratelimiter.NewLocalRateLimiter(config)
+	limiter, err := ratelimiter.NewLocalRateLimiter(config)
+	if err != nil {
+		log.Fatalf("Failed to create rate limiter: %v", err)
+	}
 	defer limiter.Close()
 
 	ctx := context.Background()
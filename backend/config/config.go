@@ -33,6 +33,39 @@ type Config struct {
 
 	// API configuration
 	API APIConfig `yaml:"api" json:"api"`
+
+	// Platform events configuration
+	Events EventsConfig `yaml:"events" json:"events"`
+
+	// SMTP configuration for alert emails
+	SMTP SMTPConfig `yaml:"smtp" json:"smtp"`
+
+	// Usage recording configuration
+	Usage UsageConfig `yaml:"usage" json:"usage"`
+
+	// Redaction of sensitive values in stored and logged text
+	Redaction RedactionConfig `yaml:"redaction" json:"redaction"`
+
+	// Encryption of stored prompt and response text
+	Encryption EncryptionConfig `yaml:"encryption" json:"encryption"`
+
+	// Fault injection for resilience tests
+	Chaos ChaosConfig `yaml:"chaos" json:"chaos"`
+
+	// In-process cache of the agent and user lookups made on every dataflow request
+	LookupCache LookupCacheConfig `yaml:"lookup_cache" json:"lookup_cache"`
+
+	// Scoring of sampled responses by a judge model
+	Evaluation EvaluationConfig `yaml:"evaluation" json:"evaluation"`
+
+	// Background jobs of the services
+	Jobs JobsConfig `yaml:"jobs" json:"jobs"`
+
+	// Developer sandbox of temporary agents
+	Sandbox SandboxConfig `yaml:"sandbox" json:"sandbox"`
+
+	// Status pages of the upstream providers
+	ProviderStatus ProviderStatusConfig `yaml:"provider_status" json:"provider_status"`
 }
 
 // AppConfig application basic configuration
@@ -58,6 +91,10 @@ type DatabaseConfig struct {
 	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" json:"conn_max_idle_time"`
 	SSLMode         string        `yaml:"ssl_mode" json:"ssl_mode"`
 	Timezone        string        `yaml:"timezone" json:"timezone"`
+	// ReplicaDSN read replica serving list and report queries, empty to read from the primary
+	ReplicaDSN string `yaml:"replica_dsn" json:"-"`
+	// ReplicaCheckInterval how often the replica is pinged to detect outages and recovery
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" json:"replica_check_interval"`
 }
 
 // RedisConfig Redis configuration
@@ -72,6 +109,10 @@ type RedisConfig struct {
 	ReadTimeout     time.Duration `yaml:"read_timeout" json:"read_timeout"`
 	WriteTimeout    time.Duration `yaml:"write_timeout" json:"write_timeout"`
 	KeyPrefix       string        `yaml:"key_prefix" json:"key_prefix"`
+
+	// Degradation of dataflow while Redis is unreachable
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" json:"health_check_interval"` // how often Redis is pinged to detect outages and recovery
+	DegradedQPSRatio    float64       `yaml:"degraded_qps_ratio" json:"degraded_qps_ratio"`       // share of each QPS limit an instance allows on its own while Redis is down
 }
 
 // ServicesConfig services configuration
@@ -91,6 +132,13 @@ type ServiceConfig struct {
 	EnableTLS    bool          `yaml:"enable_tls" json:"enable_tls"`
 	TLSCertPath  string        `yaml:"tls_cert_path" json:"tls_cert_path"`
 	TLSKeyPath   string        `yaml:"tls_key_path" json:"tls_key_path"`
+
+	// EnableHTTP2 serves HTTP/2 without TLS as well (h2c), with TLS it is always on
+	EnableHTTP2 bool `yaml:"enable_http2" json:"enable_http2"`
+
+	// StreamBufferSize write buffer in bytes of each event stream, every event is
+	// flushed as soon as it is complete
+	StreamBufferSize int `yaml:"stream_buffer_size" json:"stream_buffer_size"`
 }
 
 // SecurityConfig security configuration
@@ -104,6 +152,36 @@ type SecurityConfig struct {
 	SessionTimeout    time.Duration `yaml:"session_timeout" json:"session_timeout"`
 	MaxLoginAttempts  int           `yaml:"max_login_attempts" json:"max_login_attempts"`
 	LockoutDuration   time.Duration `yaml:"lockout_duration" json:"lockout_duration"`
+
+	// Service-to-service authentication, keys in "kid1:secret1,kid2:secret2" format
+	ServiceAuthKeys      string        `yaml:"service_auth_keys" json:"-"`
+	ServiceAuthActiveKey string        `yaml:"service_auth_active_key" json:"service_auth_active_key"`
+	ServiceTokenTTL      time.Duration `yaml:"service_token_ttl" json:"service_token_ttl"`
+
+	// Lifetime of the sessions admins issue to act as another user
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl" json:"impersonation_ttl"`
+
+	// Password hashing: bcrypt or argon2id, BcryptCost applies to bcrypt. Hashes made
+	// with other parameters are replaced on the next successful login
+	PasswordHashAlgorithm string `yaml:"password_hash_algorithm" json:"password_hash_algorithm"`
+	Argon2Time            uint32 `yaml:"argon2_time" json:"argon2_time"`             // Passes over the memory
+	Argon2MemoryKiB       uint32 `yaml:"argon2_memory_kib" json:"argon2_memory_kib"` // Memory in KiB
+	Argon2Threads         uint8  `yaml:"argon2_threads" json:"argon2_threads"`       // Parallelism
+
+	// Binding of sessions to the client they were issued to: off, audit, user_agent or
+	// strict. The client network is the address masked to the prefix length
+	SessionBinding           string `yaml:"session_binding" json:"session_binding"`
+	SessionBindingIPv4Prefix int    `yaml:"session_binding_ipv4_prefix" json:"session_binding_ipv4_prefix"`
+	SessionBindingIPv6Prefix int    `yaml:"session_binding_ipv6_prefix" json:"session_binding_ipv6_prefix"`
+
+	// Detection of unusual logins: off, low, medium or high. The country and coordinates
+	// of a login are read from headers a trusted proxy sets, e.g. CF-IPCountry
+	LoginAnomalySensitivity string        `yaml:"login_anomaly_sensitivity" json:"login_anomaly_sensitivity"`
+	LoginAnomalyLookback    time.Duration `yaml:"login_anomaly_lookback" json:"login_anomaly_lookback"` // How far back logins count as known
+	LoginAnomalyVerify      bool          `yaml:"login_anomaly_verify" json:"login_anomaly_verify"`     // Require a mailed code for unusual logins
+	LoginCountryHeader      string        `yaml:"login_country_header" json:"login_country_header"`
+	LoginLatitudeHeader     string        `yaml:"login_latitude_header" json:"login_latitude_header"`
+	LoginLongitudeHeader    string        `yaml:"login_longitude_header" json:"login_longitude_header"`
 }
 
 // LoggingConfig logging configuration
@@ -120,19 +198,325 @@ type LoggingConfig struct {
 
 // APIConfig API related configuration
 type APIConfig struct {
-	EnableCORS         bool          `yaml:"enable_cors" json:"enable_cors"`
-	AllowedOrigins     string        `yaml:"allowed_origins" json:"allowed_origins"`
-	AllowedMethods     string        `yaml:"allowed_methods" json:"allowed_methods"`
-	AllowedHeaders     string        `yaml:"allowed_headers" json:"allowed_headers"`
-	MaxRequestBodySize int64         `yaml:"max_request_body_size" json:"max_request_body_size"` // bytes
-	RequestTimeout     time.Duration `yaml:"request_timeout" json:"request_timeout"`
-	EnableMetrics      bool          `yaml:"enable_metrics" json:"enable_metrics"`
-	MetricsPath        string        `yaml:"metrics_path" json:"metrics_path"`
+	EnableCORS               bool          `yaml:"enable_cors" json:"enable_cors"`
+	AllowedOrigins           string        `yaml:"allowed_origins" json:"allowed_origins"`
+	AllowedMethods           string        `yaml:"allowed_methods" json:"allowed_methods"`
+	AllowedHeaders           string        `yaml:"allowed_headers" json:"allowed_headers"`
+	MaxRequestBodySize       int64         `yaml:"max_request_body_size" json:"max_request_body_size"` // bytes
+	RequestTimeout           time.Duration `yaml:"request_timeout" json:"request_timeout"`             // short dataflow routes, e.g. health
+	ChatTimeout              time.Duration `yaml:"chat_timeout" json:"chat_timeout"`                   // dataflow chat routes until a stream starts
+	StreamTimeout            time.Duration `yaml:"stream_timeout" json:"stream_timeout"`               // dataflow event streams and workflows
+	MaxStreamsPerKey         int           `yaml:"max_streams_per_key" json:"max_streams_per_key"`     // open streams per API key, 0 means unlimited
+	MaxStreamsPerUser        int           `yaml:"max_streams_per_user" json:"max_streams_per_user"`   // open streams per request user of an agent, 0 means unlimited
+	StreamHeartbeatTTL       time.Duration `yaml:"stream_heartbeat_ttl" json:"stream_heartbeat_ttl"`   // open streams without a heartbeat stop counting after this
+	BackpressureRatio        float64       `yaml:"backpressure_ratio" json:"backpressure_ratio"`       // agent queue usage from which responses carry backpressure hints, 0 disables
+	FixturesDir              string        `yaml:"fixtures_dir" json:"fixtures_dir"`                   // upstream exchanges of agents in record or replay mode
+	AgentSyncInterval        time.Duration `yaml:"agent_sync_interval" json:"agent_sync_interval"`     // how often dataflow reloads the agents of its agent manager, 0 disables the manager
+	EnableMetrics            bool          `yaml:"enable_metrics" json:"enable_metrics"`
+	MetricsPath              string        `yaml:"metrics_path" json:"metrics_path"`
+	MetricsPeakWindow        time.Duration `yaml:"metrics_peak_window" json:"metrics_peak_window"`                 // how far back the _peak concurrency gauges look
+	LegacyChatStrict         bool          `yaml:"legacy_chat_strict" json:"legacy_chat_strict"`                   // reject /api/v1/chat payloads whose format cannot be told apart
+	LegacyChatSunset         string        `yaml:"legacy_chat_sunset" json:"legacy_chat_sunset"`                   // RFC 3339 or YYYY-MM-DD from which /api/v1/chat answers 410, empty keeps it
+	SignatureWindow          time.Duration `yaml:"signature_window" json:"signature_window"`                       // how far the timestamp of a signed request may be off, signatures are single-use within it
+	DifyAppInfoTTL           time.Duration `yaml:"dify_app_info_ttl" json:"dify_app_info_ttl"`                     // how long Dify app parameters and meta are cached, 0 disables the cache
+	SessionVariableTTL       time.Duration `yaml:"session_variable_ttl" json:"session_variable_ttl"`               // how long session variables live after their last change, 0 disables the store
+	TitleAgentID             string        `yaml:"title_agent_id" json:"title_agent_id"`                           // agent of a cheap model titling sessions after their first exchange, empty disables titles
+	TitleModel               string        `yaml:"title_model" json:"title_model"`                                 // model the title agent is asked for, empty for its default
+	GoldenRunOnUpdate        bool          `yaml:"golden_run_on_update" json:"golden_run_on_update"`               // run an agent's golden prompts after its configuration changed
+	StreamChunkMinBytes      int           `yaml:"stream_chunk_min_bytes" json:"stream_chunk_min_bytes"`           // text re-batched stream chunks collect before they are sent, unless the request names its own
+	StreamChunkFlushInterval time.Duration `yaml:"stream_chunk_flush_interval" json:"stream_chunk_flush_interval"` // longest a re-batched stream holds back text, unless the request names its own
+
+	// RequestLimits caps on the payload of chat and workflow requests, checked before
+	// dispatch; EndpointRequestLimits override them per route, e.g. for
+	// /api/v1/dify/workflows/run, and agents can set their own
+	RequestLimits         RequestLimitsConfig            `yaml:"request_limits" json:"request_limits"`
+	EndpointRequestLimits map[string]RequestLimitsConfig `yaml:"endpoint_request_limits" json:"endpoint_request_limits"`
+}
+
+// RequestLimitsConfig caps on a request payload, 0 disables a cap
+type RequestLimitsConfig struct {
+	MaxMessages     int `yaml:"max_messages" json:"max_messages"`           // messages of an OpenAI chat request
+	MaxMessageBytes int `yaml:"max_message_bytes" json:"max_message_bytes"` // content of one message, or a Dify query
+	MaxInputs       int `yaml:"max_inputs" json:"max_inputs"`               // entries of Dify chat or workflow inputs
+}
+
+// RequestLimitsFor the caps of a route: those the endpoint sets, the global ones for the rest
+func (c *APIConfig) RequestLimitsFor(route string) RequestLimitsConfig {
+	limits := c.RequestLimits
+	endpoint, ok := c.EndpointRequestLimits[route]
+	if !ok {
+		return limits
+	}
+	if endpoint.MaxMessages != 0 {
+		limits.MaxMessages = endpoint.MaxMessages
+	}
+	if endpoint.MaxMessageBytes != 0 {
+		limits.MaxMessageBytes = endpoint.MaxMessageBytes
+	}
+	if endpoint.MaxInputs != 0 {
+		limits.MaxInputs = endpoint.MaxInputs
+	}
+	return limits
+}
+
+// LegacyChatSunsetTime the parsed legacy chat sunset, zero when none is set; a date
+// without a time is midnight UTC
+func (c *APIConfig) LegacyChatSunsetTime() (time.Time, error) {
+	if c.LegacyChatSunset == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, c.LegacyChatSunset); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", c.LegacyChatSunset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("legacy chat sunset %q must be RFC 3339 or YYYY-MM-DD", c.LegacyChatSunset)
+	}
+	return t, nil
+}
+
+// UsageConfig per-request usage records written by dataflow
+type UsageConfig struct {
+	// Record stores a usage record with the client metadata for every proxied request
+	Record bool `yaml:"record" json:"record"`
+
+	// MetadataPassthrough comma separated metadata keys forwarded to the upstream agent
+	MetadataPassthrough string `yaml:"metadata_passthrough" json:"metadata_passthrough"`
+
+	// Currency of the agent token prices, shown in cost reports
+	Currency string `yaml:"currency" json:"currency"`
+
+	// StoreContent keeps the prompt and response text with the usage record,
+	// streamed responses are captured while they are forwarded
+	StoreContent bool `yaml:"store_content" json:"store_content"`
+
+	// MaxContentBytes caps the stored prompt and response text each
+	MaxContentBytes int `yaml:"max_content_bytes" json:"max_content_bytes"`
+
+	// PrivacyMinGroupSize the fewest requests a usage summary group of privacy mode
+	// agents needs to be reported, smaller groups are suppressed
+	PrivacyMinGroupSize int `yaml:"privacy_min_group_size" json:"privacy_min_group_size"`
+
+	// ForecastInterval how often control-flow refits the per-agent usage forecasts, 0 disables the job
+	ForecastInterval time.Duration `yaml:"forecast_interval" json:"forecast_interval"`
+
+	// ForecastHistoryDays days of daily usage the forecast trends are fitted to
+	ForecastHistoryDays int `yaml:"forecast_history_days" json:"forecast_history_days"`
+
+	// OutageBuffer usage records held in memory while the database is unreachable,
+	// written once it is back; further records are dropped
+	OutageBuffer int `yaml:"outage_buffer" json:"outage_buffer"`
+
+	// Writer batched writes of usage records off the request path
+	Writer UsageWriterConfig `yaml:"writer" json:"writer"`
+
+	// Storage where usage records with their content and scores are kept: "mysql", the
+	// relational database, or "clickhouse"
+	Storage string `yaml:"storage" json:"storage"`
+
+	// ClickHouse analytics database used with storage "clickhouse"
+	ClickHouse ClickHouseConfig `yaml:"clickhouse" json:"clickhouse"`
+}
+
+// ClickHouseConfig connection to a ClickHouse server over its HTTP interface
+type ClickHouseConfig struct {
+	URL      string `yaml:"url" json:"url"` // e.g. http://localhost:8123
+	Database string `yaml:"database" json:"database"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"-"`
+
+	// TimeZone IANA zone daily usage is counted in, the local zone of the service when empty
+	TimeZone string `yaml:"time_zone" json:"time_zone"`
+}
+
+// UsageWriterConfig batched asynchronous writer of usage records in the dataflow service
+type UsageWriterConfig struct {
+	// Enabled writes usage records in batches from a background goroutine, otherwise
+	// each request writes its record before it returns
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// BufferSize usage records waiting to be written, in memory
+	BufferSize int `yaml:"buffer_size" json:"buffer_size"`
+
+	// BatchSize usage records written with one insert
+	BatchSize int `yaml:"batch_size" json:"batch_size"`
+
+	// FlushInterval longest time a usage record waits for its batch to fill up
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval"`
+
+	// Overflow what happens to records when the buffer is full: "drop" counts and
+	// discards them, "redis" spills them to a Redis list written once there is room
+	Overflow string `yaml:"overflow" json:"overflow"`
+}
+
+// RedactionConfig masking of sensitive values before prompt and response text is
+// persisted or logged
+type RedactionConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Rules comma separated built-in rules (email, phone, api_key, credit_card), all when empty
+	Rules string `yaml:"rules" json:"rules"`
+
+	// Patterns additional regular expressions to mask
+	Patterns []string `yaml:"patterns" json:"patterns"`
+
+	// Words comma separated words to mask, e.g. a profanity list
+	Words string `yaml:"words" json:"words"`
+}
+
+// EncryptionConfig envelope encryption of stored prompt and response text, each
+// agent gets its own data keys which are wrapped by a master key
+type EncryptionConfig struct {
+	// MasterKeys "kid:base64key" pairs of 32 byte keys, encryption is off when empty
+	MasterKeys string `yaml:"master_keys" json:"-"`
+
+	// ActiveMasterKey ID of the master key new data keys are wrapped with
+	ActiveMasterKey string `yaml:"active_master_key" json:"active_master_key"`
+
+	// DataKeyRotation age after which an agent gets a new data key
+	DataKeyRotation time.Duration `yaml:"data_key_rotation" json:"data_key_rotation"`
+
+	// ReencryptInterval how often control flow moves content to the current keys, 0 disables
+	ReencryptInterval time.Duration `yaml:"reencrypt_interval" json:"reencrypt_interval"`
+}
+
+// JobsConfig background jobs of the services. Schedules are cron expressions, descriptors
+// like @daily or @every <duration>; an empty schedule leaves the job to manual runs.
+type JobsConfig struct {
+	// History runs of each job kept in memory for its status
+	History int `yaml:"history" json:"history"`
+
+	// RunRetention how long the stored runs of all jobs are kept
+	RunRetention time.Duration `yaml:"run_retention" json:"run_retention"`
+
+	// SessionCleanup schedule of the expired user session purge in auth
+	SessionCleanup string `yaml:"session_cleanup" json:"session_cleanup"`
+
+	// SelfTest schedule of the dataflow probes of every enabled agent, empty disables them
+	SelfTest string `yaml:"selftest" json:"selftest"`
+
+	// SandboxCleanup schedule of the deletion of expired sandbox agents in control flow
+	SandboxCleanup string `yaml:"sandbox_cleanup" json:"sandbox_cleanup"`
+
+	// ProviderStatus schedule of the provider status page polls in control flow
+	ProviderStatus string `yaml:"provider_status" json:"provider_status"`
+}
+
+// SandboxConfig developer sandbox: temporary agents in a namespace of their owner, with
+// strict limits, deleted once they expire
+type SandboxConfig struct {
+	// MaxAgents live sandbox agents per namespace, 0 disables the sandbox
+	MaxAgents int `yaml:"max_agents" json:"max_agents"`
+
+	// DefaultTTL lifetime of sandbox agents created without one
+	DefaultTTL time.Duration `yaml:"default_ttl" json:"default_ttl"`
+
+	// MaxTTL longest lifetime of a sandbox agent
+	MaxTTL time.Duration `yaml:"max_ttl" json:"max_ttl"`
+
+	// QPS highest QPS of a sandbox agent
+	QPS int `yaml:"qps" json:"qps"`
+
+	// MaxTokens highest max_tokens of the requests to a sandbox agent
+	MaxTokens int `yaml:"max_tokens" json:"max_tokens"`
+}
+
+// ProviderStatusConfig polling of the status pages of the providers behind the agents,
+// whose incidents are shown with the agent health and the dashboard statistics
+type ProviderStatusConfig struct {
+	// OpenAIURL Statuspage summary of OpenAI, empty skips OpenAI
+	OpenAIURL string `yaml:"openai_url" json:"openai_url"`
+
+	// AzureURL status feed of Azure, empty skips Azure
+	AzureURL string `yaml:"azure_url" json:"azure_url"`
+
+	// MaxAge how long a polled status counts, older ones are treated as unknown
+	MaxAge time.Duration `yaml:"max_age" json:"max_age"`
+
+	// LowerPriority lower the priority of the agents of a provider reporting an
+	// incident, and hedge their requests right away
+	LowerPriority bool `yaml:"lower_priority" json:"lower_priority"`
+}
+
+// ChaosConfig fault injection into dataflow requests, used to exercise client retries,
+// failover and circuit breakers; ignored in production
+type ChaosConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Rules JSON array of fault rules matched by agent and endpoint, see pkg/chaos
+	Rules string `yaml:"rules" json:"rules"`
+}
+
+// LookupCacheConfig cache of agents and user settings in the dataflow service,
+// entries are invalidated when control flow changes them
+type LookupCacheConfig struct {
+	// TTL how long a lookup is reused, 0 disables the cache
+	TTL time.Duration `yaml:"ttl" json:"ttl"`
+
+	// MaxEntries upper bound of each cached lookup
+	MaxEntries int `yaml:"max_entries" json:"max_entries"`
+
+	// StaleTTL how long past the TTL a lookup is still used while the database is
+	// unreachable, 0 fails requests during outages
+	StaleTTL time.Duration `yaml:"stale_ttl" json:"stale_ttl"`
+}
+
+// EvaluationConfig asynchronous scoring of sampled responses by a judge agent, the
+// scores are stored with the usage records
+type EvaluationConfig struct {
+	// JudgeAgentID agent whose model scores the responses, empty disables evaluation
+	JudgeAgentID string `yaml:"judge_agent_id" json:"judge_agent_id"`
+
+	// SampleRate share of the successful requests with stored content that are scored
+	SampleRate float64 `yaml:"sample_rate" json:"sample_rate"`
+
+	// Rubrics criteria by name with the instruction the judge scores them by,
+	// helpfulness and safety when empty
+	Rubrics map[string]string `yaml:"rubrics" json:"rubrics"`
+
+	// Workers concurrent judge requests per dataflow instance
+	Workers int `yaml:"workers" json:"workers"`
+
+	// QueueSize sampled responses waiting for the judge, further samples are dropped
+	QueueSize int `yaml:"queue_size" json:"queue_size"`
+}
+
+// EventsConfig platform event publishing configuration
+type EventsConfig struct {
+	Broker     string `yaml:"broker" json:"broker"` // none, log, redis
+	Stream     string `yaml:"stream" json:"stream"` // Redis stream key
+	MaxLen     int64  `yaml:"max_len" json:"max_len"`
+	BufferSize int    `yaml:"buffer_size" json:"buffer_size"`
+
+	// Notifications posts subscribed events to the notification channels (Slack, Teams, email)
+	Notifications bool `yaml:"notifications" json:"notifications"`
+
+	// UnhealthyAlertAfter delay after which a still failing agent raises agent.unhealthy
+	UnhealthyAlertAfter time.Duration `yaml:"unhealthy_alert_after" json:"unhealthy_alert_after"`
+
+	// QuotaWarningRatio share of a limit at which quota.warning is raised
+	QuotaWarningRatio float64 `yaml:"quota_warning_ratio" json:"quota_warning_ratio"`
+}
+
+// SMTPConfig SMTP server used by email notification channels
+type SMTPConfig struct {
+	Host        string `yaml:"host" json:"host"`
+	Port        int    `yaml:"port" json:"port"`
+	Username    string `yaml:"username" json:"username"`
+	Password    string `yaml:"password" json:"-"`
+	From        string `yaml:"from" json:"from"`
+	ImplicitTLS bool   `yaml:"implicit_tls" json:"implicit_tls"` // TLS from the first byte (port 465), otherwise STARTTLS when offered
 }
 
 // Global configuration instance
 var GlobalConfig *Config
 
+// DefaultJWTSecret placeholder JWT secret used when none is configured, never valid in production
+const DefaultJWTSecret = "your-secret-key-please-change-in-production"
+
+// MinProductionJWTSecretLength shortest JWT secret accepted in production
+const MinProductionJWTSecretLength = 32
+
 // Load loads configuration
 func Load() (*Config, error) {
 	// Try to load .env file
@@ -152,19 +536,20 @@ func Load() (*Config, error) {
 			Debug:       true,
 		},
 		Database: DatabaseConfig{
-			Driver:          "mysql",
-			Host:            "localhost",
-			Port:            3306,
-			Username:        "root",
-			Password:        "",
-			Database:        "agent_connector",
-			Charset:         "utf8mb4",
-			MaxOpenConns:    100,
-			MaxIdleConns:    10,
-			ConnMaxLifetime: time.Hour,
-			ConnMaxIdleTime: 10 * time.Minute,
-			SSLMode:         "disable",
-			Timezone:        "Asia/Shanghai",
+			Driver:               "mysql",
+			Host:                 "localhost",
+			Port:                 3306,
+			Username:             "root",
+			Password:             "",
+			Database:             "agent_connector",
+			Charset:              "utf8mb4",
+			MaxOpenConns:         100,
+			MaxIdleConns:         10,
+			ConnMaxLifetime:      time.Hour,
+			ConnMaxIdleTime:      10 * time.Minute,
+			SSLMode:              "disable",
+			Timezone:             "Asia/Shanghai",
+			ReplicaCheckInterval: 10 * time.Second,
 		},
 		Redis: RedisConfig{
 			Addr:            "localhost:6379",
@@ -177,6 +562,9 @@ func Load() (*Config, error) {
 			ReadTimeout:     3 * time.Second,
 			WriteTimeout:    3 * time.Second,
 			KeyPrefix:       "agent_connector",
+
+			HealthCheckInterval: 5 * time.Second,
+			DegradedQPSRatio:    0.5,
 		},
 		Services: ServicesConfig{
 			AuthAPI: ServiceConfig{
@@ -202,10 +590,12 @@ func Load() (*Config, error) {
 				WriteTimeout: 10 * time.Minute,
 				IdleTimeout:  2 * time.Minute,
 				EnableTLS:    false,
+
+				StreamBufferSize: 4096,
 			},
 		},
 		Security: SecurityConfig{
-			JWTSecret:         "your-secret-key-please-change-in-production",
+			JWTSecret:         DefaultJWTSecret,
 			JWTExpiration:     24 * time.Hour,
 			PasswordMinLength: 6,
 			EnableRateLimit:   true,
@@ -214,6 +604,20 @@ func Load() (*Config, error) {
 			SessionTimeout:    24 * time.Hour,
 			MaxLoginAttempts:  5,
 			LockoutDuration:   15 * time.Minute,
+			ServiceTokenTTL:   time.Minute,
+			ImpersonationTTL:  15 * time.Minute,
+
+			PasswordHashAlgorithm: "bcrypt",
+			Argon2Time:            3,
+			Argon2MemoryKiB:       64 * 1024,
+			Argon2Threads:         2,
+
+			SessionBinding:           "off",
+			SessionBindingIPv4Prefix: 24,
+			SessionBindingIPv6Prefix: 48,
+
+			LoginAnomalySensitivity: "medium",
+			LoginAnomalyLookback:    90 * 24 * time.Hour,
 		},
 		Logging: LoggingConfig{
 			Level:      "info",
@@ -226,14 +630,103 @@ func Load() (*Config, error) {
 			Compress:   true,
 		},
 		API: APIConfig{
-			EnableCORS:         true,
-			AllowedOrigins:     "*",
-			AllowedMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-			AllowedHeaders:     "Origin,Content-Type,Accept,Authorization,X-API-Key",
-			MaxRequestBodySize: 10 << 20, // 10MB
-			RequestTimeout:     30 * time.Second,
-			EnableMetrics:      true,
-			MetricsPath:        "/metrics",
+			EnableCORS:               true,
+			AllowedOrigins:           "*",
+			AllowedMethods:           "GET,POST,PUT,DELETE,OPTIONS",
+			AllowedHeaders:           "Origin,Content-Type,Accept,Authorization,X-API-Key",
+			MaxRequestBodySize:       10 << 20, // 10MB
+			RequestTimeout:           30 * time.Second,
+			ChatTimeout:              2 * time.Minute,
+			StreamTimeout:            10 * time.Minute,
+			StreamHeartbeatTTL:       30 * time.Second,
+			BackpressureRatio:        0.8,
+			FixturesDir:              "fixtures/upstream",
+			AgentSyncInterval:        30 * time.Second,
+			EnableMetrics:            true,
+			MetricsPath:              "/metrics",
+			MetricsPeakWindow:        time.Minute,
+			SignatureWindow:          5 * time.Minute,
+			DifyAppInfoTTL:           5 * time.Minute,
+			SessionVariableTTL:       24 * time.Hour,
+			StreamChunkMinBytes:      64,
+			StreamChunkFlushInterval: 250 * time.Millisecond,
+			RequestLimits: RequestLimitsConfig{
+				MaxMessages:     1000,
+				MaxMessageBytes: 1 << 20, // 1MB
+				MaxInputs:       256,
+			},
+		},
+		Events: EventsConfig{
+			Broker:     "none",
+			Stream:     "agent-connector:events",
+			MaxLen:     100000,
+			BufferSize: 1024,
+
+			Notifications: true,
+
+			UnhealthyAlertAfter: 5 * time.Minute,
+			QuotaWarningRatio:   0.9,
+		},
+		SMTP: SMTPConfig{
+			Port: 587,
+		},
+		Usage: UsageConfig{
+			Record:              true,
+			MetadataPassthrough: "user,trace_id",
+			Currency:            "USD",
+			MaxContentBytes:     65536,
+			PrivacyMinGroupSize: 5,
+			ForecastInterval:    6 * time.Hour,
+			ForecastHistoryDays: 28,
+			OutageBuffer:        10000,
+			Writer: UsageWriterConfig{
+				Enabled:       true,
+				BufferSize:    10000,
+				BatchSize:     200,
+				FlushInterval: time.Second,
+				Overflow:      "drop",
+			},
+			Storage: "mysql",
+			ClickHouse: ClickHouseConfig{
+				URL:      "http://localhost:8123",
+				Database: "agent_connector",
+				Username: "default",
+			},
+		},
+		Redaction: RedactionConfig{
+			Enabled: true,
+		},
+		Encryption: EncryptionConfig{
+			DataKeyRotation:   30 * 24 * time.Hour,
+			ReencryptInterval: 24 * time.Hour,
+		},
+		LookupCache: LookupCacheConfig{
+			TTL:        30 * time.Second,
+			MaxEntries: 10000,
+			StaleTTL:   5 * time.Minute,
+		},
+		Evaluation: EvaluationConfig{
+			SampleRate: 0.05,
+			Workers:    2,
+			QueueSize:  1000,
+		},
+		Jobs: JobsConfig{
+			History:        20,
+			RunRetention:   30 * 24 * time.Hour,
+			SessionCleanup: "@hourly",
+			SandboxCleanup: "@every 10m",
+		},
+		Sandbox: SandboxConfig{
+			MaxAgents:  5,
+			DefaultTTL: 24 * time.Hour,
+			MaxTTL:     7 * 24 * time.Hour,
+			QPS:        2,
+			MaxTokens:  1024,
+		},
+		ProviderStatus: ProviderStatusConfig{
+			OpenAIURL: "https://status.openai.com/api/v2/summary.json",
+			AzureURL:  "https://azure.status.microsoft/en-us/status/feed/",
+			MaxAge:    30 * time.Minute,
 		},
 	}
 
@@ -286,6 +779,14 @@ func loadFromEnv(config *Config) {
 	if env := os.Getenv("DB_NAME"); env != "" {
 		config.Database.Database = env
 	}
+	if env := os.Getenv("DB_REPLICA_DSN"); env != "" {
+		config.Database.ReplicaDSN = env
+	}
+	if env := os.Getenv("DB_REPLICA_CHECK_INTERVAL"); env != "" {
+		if interval, err := time.ParseDuration(env); err == nil {
+			config.Database.ReplicaCheckInterval = interval
+		}
+	}
 
 	// Redis configuration
 	if env := os.Getenv("REDIS_ADDR"); env != "" {
@@ -299,6 +800,16 @@ func loadFromEnv(config *Config) {
 			config.Redis.DB = db
 		}
 	}
+	if env := os.Getenv("REDIS_HEALTH_CHECK_INTERVAL"); env != "" {
+		if interval, err := time.ParseDuration(env); err == nil {
+			config.Redis.HealthCheckInterval = interval
+		}
+	}
+	if env := os.Getenv("REDIS_DEGRADED_QPS_RATIO"); env != "" {
+		if ratio, err := strconv.ParseFloat(env, 64); err == nil {
+			config.Redis.DegradedQPSRatio = ratio
+		}
+	}
 
 	// Services configuration
 	if env := os.Getenv("AUTH_API_PORT"); env != "" {
@@ -316,11 +827,476 @@ func loadFromEnv(config *Config) {
 			config.Services.DataFlowAPI.Port = port
 		}
 	}
+	if env := os.Getenv("DATA_FLOW_API_HTTP2"); env != "" {
+		config.Services.DataFlowAPI.EnableHTTP2 = env == "true"
+	}
+	if env := os.Getenv("DATA_FLOW_STREAM_BUFFER_SIZE"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Services.DataFlowAPI.StreamBufferSize = size
+		}
+	}
+
+	// Dataflow route timeouts
+	if env := os.Getenv("REQUEST_TIMEOUT"); env != "" {
+		if timeout, err := time.ParseDuration(env); err == nil {
+			config.API.RequestTimeout = timeout
+		}
+	}
+	if env := os.Getenv("CHAT_TIMEOUT"); env != "" {
+		if timeout, err := time.ParseDuration(env); err == nil {
+			config.API.ChatTimeout = timeout
+		}
+	}
+	if env := os.Getenv("STREAM_TIMEOUT"); env != "" {
+		if timeout, err := time.ParseDuration(env); err == nil {
+			config.API.StreamTimeout = timeout
+		}
+	}
+
+	// Concurrent stream limits
+	if env := os.Getenv("MAX_STREAMS_PER_KEY"); env != "" {
+		if limit, err := strconv.Atoi(env); err == nil {
+			config.API.MaxStreamsPerKey = limit
+		}
+	}
+	if env := os.Getenv("MAX_STREAMS_PER_USER"); env != "" {
+		if limit, err := strconv.Atoi(env); err == nil {
+			config.API.MaxStreamsPerUser = limit
+		}
+	}
+	if env := os.Getenv("STREAM_HEARTBEAT_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.API.StreamHeartbeatTTL = ttl
+		}
+	}
+	if env := os.Getenv("BACKPRESSURE_RATIO"); env != "" {
+		if ratio, err := strconv.ParseFloat(env, 64); err == nil {
+			config.API.BackpressureRatio = ratio
+		}
+	}
+	if env := os.Getenv("UPSTREAM_FIXTURES_DIR"); env != "" {
+		config.API.FixturesDir = env
+	}
+	if env := os.Getenv("AGENT_SYNC_INTERVAL"); env != "" {
+		if interval, err := time.ParseDuration(env); err == nil {
+			config.API.AgentSyncInterval = interval
+		}
+	}
+	if env := os.Getenv("LEGACY_CHAT_STRICT"); env != "" {
+		config.API.LegacyChatStrict = env == "true"
+	}
+	if env := os.Getenv("LEGACY_CHAT_SUNSET"); env != "" {
+		config.API.LegacyChatSunset = env
+	}
+	if env := os.Getenv("REQUEST_SIGNATURE_WINDOW"); env != "" {
+		if window, err := time.ParseDuration(env); err == nil {
+			config.API.SignatureWindow = window
+		}
+	}
+	if env := os.Getenv("DIFY_APP_INFO_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.API.DifyAppInfoTTL = ttl
+		}
+	}
+	if env := os.Getenv("SESSION_VARIABLE_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.API.SessionVariableTTL = ttl
+		}
+	}
+	if env := os.Getenv("CONVERSATION_TITLE_AGENT_ID"); env != "" {
+		config.API.TitleAgentID = env
+	}
+	if env := os.Getenv("CONVERSATION_TITLE_MODEL"); env != "" {
+		config.API.TitleModel = env
+	}
+	if env := os.Getenv("GOLDEN_RUN_ON_UPDATE"); env != "" {
+		config.API.GoldenRunOnUpdate = env == "true"
+	}
+	if env := os.Getenv("STREAM_CHUNK_MIN_BYTES"); env != "" {
+		if minBytes, err := strconv.Atoi(env); err == nil {
+			config.API.StreamChunkMinBytes = minBytes
+		}
+	}
+	if env := os.Getenv("STREAM_CHUNK_FLUSH_INTERVAL"); env != "" {
+		if interval, err := time.ParseDuration(env); err == nil {
+			config.API.StreamChunkFlushInterval = interval
+		}
+	}
+	if env := os.Getenv("REQUEST_MAX_MESSAGES"); env != "" {
+		if maxMessages, err := strconv.Atoi(env); err == nil {
+			config.API.RequestLimits.MaxMessages = maxMessages
+		}
+	}
+	if env := os.Getenv("REQUEST_MAX_MESSAGE_BYTES"); env != "" {
+		if maxBytes, err := strconv.Atoi(env); err == nil {
+			config.API.RequestLimits.MaxMessageBytes = maxBytes
+		}
+	}
+	if env := os.Getenv("REQUEST_MAX_INPUTS"); env != "" {
+		if maxInputs, err := strconv.Atoi(env); err == nil {
+			config.API.RequestLimits.MaxInputs = maxInputs
+		}
+	}
+	if env := os.Getenv("ENABLE_METRICS"); env != "" {
+		config.API.EnableMetrics = env == "true"
+	}
+	if env := os.Getenv("METRICS_PATH"); env != "" {
+		config.API.MetricsPath = env
+	}
+	if env := os.Getenv("METRICS_PEAK_WINDOW"); env != "" {
+		if window, err := time.ParseDuration(env); err == nil {
+			config.API.MetricsPeakWindow = window
+		}
+	}
 
 	// Security configuration
 	if env := os.Getenv("JWT_SECRET"); env != "" {
 		config.Security.JWTSecret = env
 	}
+	if env := os.Getenv("SERVICE_AUTH_KEYS"); env != "" {
+		config.Security.ServiceAuthKeys = env
+	}
+	if env := os.Getenv("SERVICE_AUTH_ACTIVE_KEY"); env != "" {
+		config.Security.ServiceAuthActiveKey = env
+	}
+	if env := os.Getenv("SERVICE_TOKEN_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.Security.ServiceTokenTTL = ttl
+		}
+	}
+	if env := os.Getenv("IMPERSONATION_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.Security.ImpersonationTTL = ttl
+		}
+	}
+	if env := os.Getenv("PASSWORD_HASH_ALGORITHM"); env != "" {
+		config.Security.PasswordHashAlgorithm = env
+	}
+	if env := os.Getenv("BCRYPT_COST"); env != "" {
+		if cost, err := strconv.Atoi(env); err == nil {
+			config.Security.BcryptCost = cost
+		}
+	}
+	if env := os.Getenv("ARGON2_TIME"); env != "" {
+		if passes, err := strconv.ParseUint(env, 10, 32); err == nil {
+			config.Security.Argon2Time = uint32(passes)
+		}
+	}
+	if env := os.Getenv("ARGON2_MEMORY_KIB"); env != "" {
+		if memory, err := strconv.ParseUint(env, 10, 32); err == nil {
+			config.Security.Argon2MemoryKiB = uint32(memory)
+		}
+	}
+	if env := os.Getenv("ARGON2_THREADS"); env != "" {
+		if threads, err := strconv.ParseUint(env, 10, 8); err == nil {
+			config.Security.Argon2Threads = uint8(threads)
+		}
+	}
+	if env := os.Getenv("SESSION_BINDING"); env != "" {
+		config.Security.SessionBinding = env
+	}
+	if env := os.Getenv("SESSION_BINDING_IPV4_PREFIX"); env != "" {
+		if prefix, err := strconv.Atoi(env); err == nil {
+			config.Security.SessionBindingIPv4Prefix = prefix
+		}
+	}
+	if env := os.Getenv("SESSION_BINDING_IPV6_PREFIX"); env != "" {
+		if prefix, err := strconv.Atoi(env); err == nil {
+			config.Security.SessionBindingIPv6Prefix = prefix
+		}
+	}
+	if env := os.Getenv("LOGIN_ANOMALY_SENSITIVITY"); env != "" {
+		config.Security.LoginAnomalySensitivity = env
+	}
+	if env := os.Getenv("LOGIN_ANOMALY_LOOKBACK"); env != "" {
+		if lookback, err := time.ParseDuration(env); err == nil {
+			config.Security.LoginAnomalyLookback = lookback
+		}
+	}
+	if env := os.Getenv("LOGIN_ANOMALY_VERIFY"); env != "" {
+		config.Security.LoginAnomalyVerify = env == "true"
+	}
+	if env := os.Getenv("LOGIN_COUNTRY_HEADER"); env != "" {
+		config.Security.LoginCountryHeader = env
+	}
+	if env := os.Getenv("LOGIN_LATITUDE_HEADER"); env != "" {
+		config.Security.LoginLatitudeHeader = env
+	}
+	if env := os.Getenv("LOGIN_LONGITUDE_HEADER"); env != "" {
+		config.Security.LoginLongitudeHeader = env
+	}
+
+	// Events configuration
+	if env := os.Getenv("EVENTS_BROKER"); env != "" {
+		config.Events.Broker = env
+	}
+	if env := os.Getenv("EVENTS_STREAM"); env != "" {
+		config.Events.Stream = env
+	}
+	if env := os.Getenv("EVENTS_STREAM_MAX_LEN"); env != "" {
+		if maxLen, err := strconv.ParseInt(env, 10, 64); err == nil {
+			config.Events.MaxLen = maxLen
+		}
+	}
+	if env := os.Getenv("EVENTS_BUFFER_SIZE"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Events.BufferSize = size
+		}
+	}
+	if env := os.Getenv("EVENTS_NOTIFICATIONS"); env != "" {
+		config.Events.Notifications = env == "true"
+	}
+	if env := os.Getenv("EVENTS_UNHEALTHY_ALERT_AFTER"); env != "" {
+		if delay, err := time.ParseDuration(env); err == nil {
+			config.Events.UnhealthyAlertAfter = delay
+		}
+	}
+	if env := os.Getenv("EVENTS_QUOTA_WARNING_RATIO"); env != "" {
+		if ratio, err := strconv.ParseFloat(env, 64); err == nil {
+			config.Events.QuotaWarningRatio = ratio
+		}
+	}
+
+	// SMTP configuration
+	if env := os.Getenv("SMTP_HOST"); env != "" {
+		config.SMTP.Host = env
+	}
+	if env := os.Getenv("SMTP_PORT"); env != "" {
+		if port, err := strconv.Atoi(env); err == nil {
+			config.SMTP.Port = port
+		}
+	}
+	if env := os.Getenv("SMTP_USERNAME"); env != "" {
+		config.SMTP.Username = env
+	}
+	if env := os.Getenv("SMTP_PASSWORD"); env != "" {
+		config.SMTP.Password = env
+	}
+	if env := os.Getenv("SMTP_FROM"); env != "" {
+		config.SMTP.From = env
+	}
+	if env := os.Getenv("SMTP_IMPLICIT_TLS"); env != "" {
+		config.SMTP.ImplicitTLS = env == "true"
+	}
+
+	// Usage configuration
+	if env := os.Getenv("USAGE_RECORDING"); env != "" {
+		config.Usage.Record = env == "true"
+	}
+	if env, ok := os.LookupEnv("METADATA_PASSTHROUGH_KEYS"); ok {
+		config.Usage.MetadataPassthrough = env
+	}
+	if env := os.Getenv("USAGE_CURRENCY"); env != "" {
+		config.Usage.Currency = env
+	}
+	if env := os.Getenv("USAGE_STORE_CONTENT"); env != "" {
+		config.Usage.StoreContent = env == "true"
+	}
+	if env := os.Getenv("USAGE_MAX_CONTENT_BYTES"); env != "" {
+		if bytes, err := strconv.Atoi(env); err == nil {
+			config.Usage.MaxContentBytes = bytes
+		}
+	}
+	if env := os.Getenv("USAGE_PRIVACY_MIN_GROUP_SIZE"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Usage.PrivacyMinGroupSize = size
+		}
+	}
+	if env := os.Getenv("USAGE_FORECAST_INTERVAL"); env != "" {
+		if interval, err := time.ParseDuration(env); err == nil {
+			config.Usage.ForecastInterval = interval
+		}
+	}
+	if env := os.Getenv("USAGE_FORECAST_HISTORY_DAYS"); env != "" {
+		if days, err := strconv.Atoi(env); err == nil {
+			config.Usage.ForecastHistoryDays = days
+		}
+	}
+	if env := os.Getenv("USAGE_OUTAGE_BUFFER"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Usage.OutageBuffer = size
+		}
+	}
+	if env := os.Getenv("USAGE_WRITER_ENABLED"); env != "" {
+		config.Usage.Writer.Enabled = env == "true"
+	}
+	if env := os.Getenv("USAGE_WRITER_BUFFER_SIZE"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Usage.Writer.BufferSize = size
+		}
+	}
+	if env := os.Getenv("USAGE_WRITER_BATCH_SIZE"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Usage.Writer.BatchSize = size
+		}
+	}
+	if env := os.Getenv("USAGE_WRITER_FLUSH_INTERVAL"); env != "" {
+		if interval, err := time.ParseDuration(env); err == nil {
+			config.Usage.Writer.FlushInterval = interval
+		}
+	}
+	if env := os.Getenv("USAGE_WRITER_OVERFLOW"); env != "" {
+		config.Usage.Writer.Overflow = env
+	}
+	if env := os.Getenv("USAGE_STORAGE"); env != "" {
+		config.Usage.Storage = env
+	}
+	if env := os.Getenv("CLICKHOUSE_URL"); env != "" {
+		config.Usage.ClickHouse.URL = env
+	}
+	if env := os.Getenv("CLICKHOUSE_DATABASE"); env != "" {
+		config.Usage.ClickHouse.Database = env
+	}
+	if env := os.Getenv("CLICKHOUSE_USERNAME"); env != "" {
+		config.Usage.ClickHouse.Username = env
+	}
+	if env := os.Getenv("CLICKHOUSE_PASSWORD"); env != "" {
+		config.Usage.ClickHouse.Password = env
+	}
+	if env := os.Getenv("CLICKHOUSE_TIME_ZONE"); env != "" {
+		config.Usage.ClickHouse.TimeZone = env
+	}
+
+	// Redaction configuration
+	if env := os.Getenv("REDACTION_ENABLED"); env != "" {
+		config.Redaction.Enabled = env == "true"
+	}
+	if env := os.Getenv("REDACTION_RULES"); env != "" {
+		config.Redaction.Rules = env
+	}
+	if env := os.Getenv("REDACTION_WORDS"); env != "" {
+		config.Redaction.Words = env
+	}
+
+	// Encryption configuration
+	if env := os.Getenv("CONTENT_ENCRYPTION_KEYS"); env != "" {
+		config.Encryption.MasterKeys = env
+	}
+	if env := os.Getenv("CONTENT_ENCRYPTION_ACTIVE_KEY"); env != "" {
+		config.Encryption.ActiveMasterKey = env
+	}
+	if env := os.Getenv("CONTENT_DATA_KEY_ROTATION"); env != "" {
+		if duration, err := time.ParseDuration(env); err == nil {
+			config.Encryption.DataKeyRotation = duration
+		}
+	}
+	if env := os.Getenv("CONTENT_REENCRYPT_INTERVAL"); env != "" {
+		if duration, err := time.ParseDuration(env); err == nil {
+			config.Encryption.ReencryptInterval = duration
+		}
+	}
+
+	// Chaos configuration
+	if env := os.Getenv("CHAOS_ENABLED"); env != "" {
+		config.Chaos.Enabled = env == "true"
+	}
+	if env := os.Getenv("CHAOS_RULES"); env != "" {
+		config.Chaos.Rules = env
+	}
+
+	// Lookup cache configuration
+	if env := os.Getenv("LOOKUP_CACHE_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.LookupCache.TTL = ttl
+		}
+	}
+	if env := os.Getenv("LOOKUP_CACHE_MAX_ENTRIES"); env != "" {
+		if maxEntries, err := strconv.Atoi(env); err == nil {
+			config.LookupCache.MaxEntries = maxEntries
+		}
+	}
+	if env := os.Getenv("LOOKUP_CACHE_STALE_TTL"); env != "" {
+		if staleTTL, err := time.ParseDuration(env); err == nil {
+			config.LookupCache.StaleTTL = staleTTL
+		}
+	}
+
+	// Evaluation configuration
+	if env := os.Getenv("EVALUATION_JUDGE_AGENT_ID"); env != "" {
+		config.Evaluation.JudgeAgentID = env
+	}
+	if env := os.Getenv("EVALUATION_SAMPLE_RATE"); env != "" {
+		if rate, err := strconv.ParseFloat(env, 64); err == nil {
+			config.Evaluation.SampleRate = rate
+		}
+	}
+	if env := os.Getenv("EVALUATION_WORKERS"); env != "" {
+		if workers, err := strconv.Atoi(env); err == nil {
+			config.Evaluation.Workers = workers
+		}
+	}
+	if env := os.Getenv("EVALUATION_QUEUE_SIZE"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil {
+			config.Evaluation.QueueSize = size
+		}
+	}
+
+	// Background jobs configuration
+	if env := os.Getenv("JOBS_HISTORY"); env != "" {
+		if history, err := strconv.Atoi(env); err == nil {
+			config.Jobs.History = history
+		}
+	}
+	if env := os.Getenv("JOBS_RUN_RETENTION"); env != "" {
+		if retention, err := time.ParseDuration(env); err == nil {
+			config.Jobs.RunRetention = retention
+		}
+	}
+	if env, ok := os.LookupEnv("JOBS_SESSION_CLEANUP"); ok {
+		config.Jobs.SessionCleanup = env
+	}
+	if env := os.Getenv("JOBS_SELFTEST"); env != "" {
+		config.Jobs.SelfTest = env
+	}
+	if env, ok := os.LookupEnv("JOBS_SANDBOX_CLEANUP"); ok {
+		config.Jobs.SandboxCleanup = env
+	}
+	if env := os.Getenv("JOBS_PROVIDER_STATUS"); env != "" {
+		config.Jobs.ProviderStatus = env
+	}
+
+	// Developer sandbox configuration
+	if env := os.Getenv("SANDBOX_MAX_AGENTS"); env != "" {
+		if maxAgents, err := strconv.Atoi(env); err == nil {
+			config.Sandbox.MaxAgents = maxAgents
+		}
+	}
+	if env := os.Getenv("SANDBOX_DEFAULT_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.Sandbox.DefaultTTL = ttl
+		}
+	}
+	if env := os.Getenv("SANDBOX_MAX_TTL"); env != "" {
+		if ttl, err := time.ParseDuration(env); err == nil {
+			config.Sandbox.MaxTTL = ttl
+		}
+	}
+	if env := os.Getenv("SANDBOX_QPS"); env != "" {
+		if qps, err := strconv.Atoi(env); err == nil {
+			config.Sandbox.QPS = qps
+		}
+	}
+	if env := os.Getenv("SANDBOX_MAX_TOKENS"); env != "" {
+		if maxTokens, err := strconv.Atoi(env); err == nil {
+			config.Sandbox.MaxTokens = maxTokens
+		}
+	}
+
+	// Provider status configuration
+	if env, ok := os.LookupEnv("PROVIDER_STATUS_OPENAI_URL"); ok {
+		config.ProviderStatus.OpenAIURL = env
+	}
+	if env, ok := os.LookupEnv("PROVIDER_STATUS_AZURE_URL"); ok {
+		config.ProviderStatus.AzureURL = env
+	}
+	if env := os.Getenv("PROVIDER_STATUS_MAX_AGE"); env != "" {
+		if maxAge, err := time.ParseDuration(env); err == nil {
+			config.ProviderStatus.MaxAge = maxAge
+		}
+	}
+	if env := os.Getenv("PROVIDER_STATUS_LOWER_PRIORITY"); env != "" {
+		config.ProviderStatus.LowerPriority = env == "true"
+	}
 }
 
 // validateConfig validates configuration
@@ -334,6 +1310,30 @@ func validateConfig(config *Config) error {
 	if config.Database.Database == "" {
 		return fmt.Errorf("database name is required")
 	}
+	if _, err := config.API.LegacyChatSunsetTime(); err != nil {
+		return err
+	}
+	switch config.Security.PasswordHashAlgorithm {
+	case "", "bcrypt", "argon2id":
+	default:
+		return fmt.Errorf("invalid password hash algorithm %q, expected bcrypt or argon2id", config.Security.PasswordHashAlgorithm)
+	}
+	switch config.Security.SessionBinding {
+	case "", "off", "audit", "user_agent", "strict":
+	default:
+		return fmt.Errorf("invalid session binding %q, expected off, audit, user_agent or strict", config.Security.SessionBinding)
+	}
+	if prefix := config.Security.SessionBindingIPv4Prefix; prefix < 0 || prefix > 32 {
+		return fmt.Errorf("session binding IPv4 prefix must be between 0 and 32, got %d", prefix)
+	}
+	if prefix := config.Security.SessionBindingIPv6Prefix; prefix < 0 || prefix > 128 {
+		return fmt.Errorf("session binding IPv6 prefix must be between 0 and 128, got %d", prefix)
+	}
+	switch config.Security.LoginAnomalySensitivity {
+	case "", "off", "low", "medium", "high":
+	default:
+		return fmt.Errorf("invalid login anomaly sensitivity %q, expected off, low, medium or high", config.Security.LoginAnomalySensitivity)
+	}
 	return nil
 }
 
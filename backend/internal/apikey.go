@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+)
+
+// connectorKeyPrefixLength number of leading key characters kept in plaintext for lookup,
+// "sk-conn_" plus 8 random characters
+const connectorKeyPrefixLength = 16
+
+// HashConnectorAPIKey hash a connector API key for storage.
+// Connector keys are 32 random characters, so a single SHA-256 is enough to make a leaked
+// table useless while keeping the per-request check cheap; slow hashes only help low-entropy secrets.
+func HashConnectorAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// ConnectorKeyPrefix get the lookup prefix of a connector API key
+func ConnectorKeyPrefix(apiKey string) string {
+	if len(apiKey) <= connectorKeyPrefixLength {
+		return apiKey
+	}
+	return apiKey[:connectorKeyPrefixLength]
+}
+
+// SetConnectorAPIKey set a new connector API key, only the prefix and hash are persisted
+func (a *Agent) SetConnectorAPIKey(apiKey string) {
+	a.ConnectorAPIKey = apiKey
+	a.ConnectorKeyPrefix = ConnectorKeyPrefix(apiKey)
+	a.ConnectorKeyHash = HashConnectorAPIKey(apiKey)
+	a.LegacyConnectorAPIKey = nil
+}
+
+// VerifyConnectorAPIKey check a presented key against the stored hash in constant time
+func (a *Agent) VerifyConnectorAPIKey(apiKey string) bool {
+	if a.ConnectorKeyHash == "" || apiKey == "" {
+		return false
+	}
+	presented := HashConnectorAPIKey(apiKey)
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(a.ConnectorKeyHash)) == 1
+}
+
+// migrateConnectorAPIKeys replace plaintext connector API keys stored by older versions with prefix and hash
+func migrateConnectorAPIKeys() error {
+	var agents []*Agent
+	err := DB.Unscoped().
+		Where("connector_api_key IS NOT NULL AND connector_api_key <> ''").
+		Find(&agents).Error
+	if err != nil {
+		return err
+	}
+
+	for _, agent := range agents {
+		agent.SetConnectorAPIKey(*agent.LegacyConnectorAPIKey)
+		err := DB.Unscoped().Model(&Agent{}).Where("id = ?", agent.ID).Updates(map[string]interface{}{
+			"connector_key_prefix": agent.ConnectorKeyPrefix,
+			"connector_key_hash":   agent.ConnectorKeyHash,
+			"connector_api_key":    nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(agents) > 0 {
+		log.Printf("Migrated %d plaintext connector API keys to hashed storage", len(agents))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"agent-connector/config"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ErrAlreadyBootstrapped returned when the first-run seed was applied before
+var ErrAlreadyBootstrapped = errors.New("platform is already bootstrapped")
+
+// SeedSpec first-run setup of the platform: the initial admin and optionally agents,
+// the agents use the same format as the declarative platform spec
+type SeedSpec struct {
+	Admin  SeedAdmin   `yaml:"admin" json:"admin"`
+	Agents []AgentSpec `yaml:"agents" json:"agents"`
+}
+
+// SeedAdmin the initial admin account
+type SeedAdmin struct {
+	Username string `yaml:"username" json:"username"`
+	Email    string `yaml:"email" json:"email"`
+	Password string `yaml:"password" json:"password"`
+	FullName string `yaml:"full_name" json:"full_name"`
+}
+
+// BootstrapResult what the bootstrap changed, Agents holds the plaintext connector
+// keys of the seeded agents, they are not shown again
+type BootstrapResult struct {
+	Admin                string      `json:"admin"`
+	AdminCreated         bool        `json:"admin_created"`
+	DefaultAdminDisabled bool        `json:"default_admin_disabled"`
+	Agents               *SyncResult `json:"agents,omitempty"`
+	BootstrappedAt       time.Time   `json:"bootstrapped_at"`
+}
+
+// ParseSeedSpec parse a YAML (or JSON) seed file, unknown fields are rejected to catch typos
+func ParseSeedSpec(data []byte) (*SeedSpec, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var spec SeedSpec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid seed: %w", err)
+	}
+
+	if spec.Admin.Username == "" || spec.Admin.Email == "" {
+		return nil, errors.New("invalid seed: admin username and email are required")
+	}
+	minLength := 6
+	if config.GlobalConfig != nil && config.GlobalConfig.Security.PasswordMinLength > 0 {
+		minLength = config.GlobalConfig.Security.PasswordMinLength
+	}
+	if len(spec.Admin.Password) < minLength {
+		return nil, fmt.Errorf("invalid seed: admin password must be at least %d characters", minLength)
+	}
+	if spec.Admin.Password == defaultAdminPassword {
+		return nil, errors.New("invalid seed: admin password must not be the default password")
+	}
+	if err := validateAgentSpecs(spec.Agents); err != nil {
+		return nil, fmt.Errorf("invalid seed: %w", err)
+	}
+
+	return &spec, nil
+}
+
+// BootstrapService first-run setup service
+type BootstrapService struct{}
+
+// Bootstrap apply the seed once: make sure the system config exists, create or reset
+// the admin, disable the default admin while it still has the default password and
+// create the agents. The system config is stamped last, so a failed run can be
+// repeated; every step is idempotent.
+func (s *BootstrapService) Bootstrap(spec *SeedSpec) (*BootstrapResult, error) {
+	var systemConfig SystemConfig
+	if err := DB.FirstOrCreate(&systemConfig).Error; err != nil {
+		return nil, fmt.Errorf("failed to load system config: %v", err)
+	}
+	if systemConfig.BootstrappedAt != nil {
+		return nil, ErrAlreadyBootstrapped
+	}
+
+	result := &BootstrapResult{Admin: spec.Admin.Username}
+	created, err := s.seedAdmin(&spec.Admin)
+	if err != nil {
+		return nil, err
+	}
+	result.AdminCreated = created
+
+	if spec.Admin.Username != defaultAdminUsername {
+		disabled, err := s.disableDefaultAdmin()
+		if err != nil {
+			return nil, err
+		}
+		result.DefaultAdminDisabled = disabled
+	}
+
+	if len(spec.Agents) > 0 {
+		// agents are matched by name, a repeated run creates only the missing ones
+		syncService := &ConfigSyncService{}
+		agents, err := syncService.Apply(&PlatformSpec{Agents: spec.Agents}, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed agents: %w", err)
+		}
+		result.Agents = agents
+	}
+
+	now := time.Now()
+	if err := DB.Model(&systemConfig).Update("bootstrapped_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to mark platform as bootstrapped: %v", err)
+	}
+	result.BootstrappedAt = now
+	return result, nil
+}
+
+// seedAdmin create the admin, or make an existing user of that name an active admin
+// with the seeded password; true when the user was created
+func (s *BootstrapService) seedAdmin(admin *SeedAdmin) (bool, error) {
+	users := NewUserService()
+
+	var existing User
+	err := DB.Where("username = ?", admin.Username).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user := &User{
+			Username: admin.Username,
+			Email:    admin.Email,
+			Password: admin.Password,
+			FullName: admin.FullName,
+			Role:     UserRoleAdmin,
+			Status:   UserStatusActive,
+		}
+		if err := users.CreateUser(user); err != nil {
+			return false, fmt.Errorf("failed to create admin %s: %w", admin.Username, err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+
+	hashedPassword, err := passwordHasher().Hash(admin.Password)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash password: %v", err)
+	}
+	updates := map[string]interface{}{
+		"email":    admin.Email,
+		"password": hashedPassword,
+		"role":     UserRoleAdmin,
+		"status":   UserStatusActive,
+	}
+	if admin.FullName != "" {
+		updates["full_name"] = admin.FullName
+	}
+	if err := DB.Model(&existing).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to update admin %s: %v", admin.Username, err)
+	}
+	invalidateUserLookups(existing.ID)
+	return false, nil
+}
+
+// disableDefaultAdmin deactivate the admin created on first start as long as nobody
+// changed its password, true when it was disabled
+func (s *BootstrapService) disableDefaultAdmin() (bool, error) {
+	var defaultAdmin User
+	err := DB.Where("username = ? AND status = ?", defaultAdminUsername, UserStatusActive).First(&defaultAdmin).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	if passwordHasher().Verify(defaultAdmin.Password, defaultAdminPassword) != nil {
+		return false, nil
+	}
+
+	if err := DB.Model(&defaultAdmin).Update("status", UserStatusInactive).Error; err != nil {
+		return false, fmt.Errorf("failed to disable default admin: %v", err)
+	}
+	invalidateUserLookups(defaultAdmin.ID)
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrSpecChecksumMismatch returned by import when a spec no longer matches the checksum
+// it was exported with
+var ErrSpecChecksumMismatch = errors.New("spec does not match its checksum, it was changed after the export")
+
+// ErrSpecChecksumMissing returned by import for specs without a checksum
+var ErrSpecChecksumMissing = errors.New("spec has no checksum, import takes exported specs, apply hand-written ones")
+
+// driftStandInKey source API key of agents a drift check compares without one
+const driftStandInKey = "drift-check"
+
+// SyncDrift differences between a spec and the platform, Checksum and SpecChecksum
+// identify both configurations so environments can be compared without a spec
+type SyncDrift struct {
+	Drifted      bool         `json:"drifted"`
+	Checksum     string       `json:"checksum"`
+	SpecChecksum string       `json:"spec_checksum"`
+	Changes      []SyncChange `json:"changes"`
+}
+
+// ComputeChecksum checksum of the declared agents and queue overrides. Defaults are
+// filled in first, so a spec omitting them sums like its export; source API keys and
+// prune are left out, they are no configuration that moves between environments.
+func (s *PlatformSpec) ComputeChecksum() string {
+	agents := make([]AgentSpec, len(s.Agents))
+	for i, agentSpec := range s.Agents {
+		agents[i] = exportAgentSpec(agentSpec.toAgent(), agentSpec.Queue)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+
+	data, _ := json.Marshal(agents)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// exportAgentSpec the spec of an agent with every field set, without its source API key
+func exportAgentSpec(agent *Agent, queue *QueueSpec) AgentSpec {
+	enabled := agent.Enabled
+	supportStreaming := agent.SupportStreaming
+	return AgentSpec{
+		Name:             agent.Name,
+		Type:             string(agent.Type),
+		URL:              agent.URL,
+		QPS:              agent.QPS,
+		Enabled:          &enabled,
+		Description:      agent.Description,
+		SupportStreaming: &supportStreaming,
+		ResponseFormat:   agent.ResponseFormat,
+		Queue:            queue,
+	}
+}
+
+// Export the spec of the current platform configuration, ready to be imported into
+// another environment. Source API keys are left out: the importing environment keeps
+// the keys of its agents and new agents need theirs added to the spec.
+func (s *ConfigSyncService) Export() (*PlatformSpec, error) {
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+	return exportState(state), nil
+}
+
+// exportState the spec of a loaded state, agents sorted by name
+func exportState(state *syncState) *PlatformSpec {
+	names := make([]string, 0, len(state.agents))
+	for name := range state.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	spec := &PlatformSpec{Agents: make([]AgentSpec, 0, len(names))}
+	for _, name := range names {
+		agent := state.agents[name]
+		var queue *QueueSpec
+		if config := state.queueConfigs[agent.AgentID]; config != nil {
+			queue = &QueueSpec{MaxQueueSize: config.MaxQueueSize, DefaultTTL: config.DefaultTTL}
+		}
+		spec.Agents = append(spec.Agents, exportAgentSpec(agent, queue))
+	}
+	spec.Checksum = spec.ComputeChecksum()
+	return spec
+}
+
+// Import apply an exported spec, refusing specs changed since the export. The expected
+// fingerprint works as with Apply.
+func (s *ConfigSyncService) Import(spec *PlatformSpec, expectedFingerprint string) (*SyncResult, error) {
+	if spec.Checksum == "" {
+		return nil, ErrSpecChecksumMissing
+	}
+	if spec.Checksum != spec.ComputeChecksum() {
+		return nil, ErrSpecChecksumMismatch
+	}
+	return s.Apply(spec, expectedFingerprint)
+}
+
+// Drift compare the platform with a spec, such as the export of another environment.
+// The changes are those an apply with prune would make, agents missing from the spec
+// count as drift.
+func (s *ConfigSyncService) Drift(spec *PlatformSpec) (*SyncDrift, error) {
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	// exports carry no source API keys, agents new to this environment are compared
+	// with a stand-in key so they validate
+	pruning := *spec
+	pruning.Prune = true
+	pruning.Agents = append([]AgentSpec(nil), spec.Agents...)
+	keyless := make(map[string]bool)
+	for i := range pruning.Agents {
+		agentSpec := &pruning.Agents[i]
+		if _, exists := state.agents[agentSpec.Name]; !exists && agentSpec.SourceAPIKey == "" {
+			agentSpec.SourceAPIKey = driftStandInKey
+			keyless[agentSpec.Name] = true
+		}
+	}
+
+	plan, err := s.plan(&pruning, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare spec: %w", err)
+	}
+	for i := range plan.Changes {
+		if change := &plan.Changes[i]; keyless[change.Name] {
+			delete(change.Fields, "source_api_key")
+		}
+	}
+
+	return &SyncDrift{
+		Drifted:      len(plan.Changes) > 0,
+		Checksum:     exportState(state).Checksum,
+		SpecChecksum: spec.ComputeChecksum(),
+		Changes:      plan.Changes,
+	}, nil
+}
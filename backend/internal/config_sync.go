@@ -0,0 +1,481 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"agent-connector/pkg/types"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// PlatformSpec declarative description of the platform configuration
+type PlatformSpec struct {
+	Agents []AgentSpec `yaml:"agents" json:"agents"`
+
+	// Prune deletes agents that exist on the platform but are missing from the spec
+	Prune bool `yaml:"prune" json:"prune"`
+
+	// Checksum of the declared configuration, set by export and verified by import
+	Checksum string `yaml:"checksum,omitempty" json:"checksum,omitempty"`
+}
+
+// AgentSpec desired state of one agent, agents are matched by name
+type AgentSpec struct {
+	Name             string     `yaml:"name" json:"name"`
+	Type             string     `yaml:"type" json:"type"`
+	URL              string     `yaml:"url" json:"url"`
+	SourceAPIKey     string     `yaml:"source_api_key,omitempty" json:"source_api_key,omitempty"` // empty keeps the key of an existing agent
+	QPS              int        `yaml:"qps" json:"qps"`
+	Enabled          *bool      `yaml:"enabled" json:"enabled"`
+	Description      string     `yaml:"description" json:"description"`
+	SupportStreaming *bool      `yaml:"support_streaming" json:"support_streaming"`
+	ResponseFormat   string     `yaml:"response_format" json:"response_format"`
+	Queue            *QueueSpec `yaml:"queue,omitempty" json:"queue,omitempty"`
+}
+
+// QueueSpec desired queue override of an agent, omitting it removes the override
+type QueueSpec struct {
+	MaxQueueSize int64 `yaml:"max_queue_size" json:"max_queue_size"`
+	DefaultTTL   int64 `yaml:"default_ttl" json:"default_ttl"`
+}
+
+// Sync actions and resources
+const (
+	SyncActionCreate = "create"
+	SyncActionUpdate = "update"
+	SyncActionDelete = "delete"
+
+	SyncResourceAgent       = "agent"
+	SyncResourceQueueConfig = "queue_config"
+)
+
+// SyncFieldChange old and new value of a field, secrets are masked
+type SyncFieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// SyncChange one change needed to reach the desired state
+type SyncChange struct {
+	Action   string                     `json:"action"`
+	Resource string                     `json:"resource"`
+	Name     string                     `json:"name"`
+	AgentID  string                     `json:"agent_id,omitempty"`
+	Fields   map[string]SyncFieldChange `json:"fields,omitempty"`
+
+	agent *Agent
+	queue *AgentQueueConfig
+}
+
+// SyncPlan changes needed to reach the desired state, Fingerprint identifies the
+// platform state the plan was computed against
+type SyncPlan struct {
+	Fingerprint string       `json:"fingerprint"`
+	Changes     []SyncChange `json:"changes"`
+	Unchanged   int          `json:"unchanged"`
+}
+
+// SyncCreatedKey connector API key of an agent created by apply, only returned once
+type SyncCreatedKey struct {
+	Name            string `json:"name"`
+	AgentID         string `json:"agent_id"`
+	ConnectorAPIKey string `json:"connector_api_key"`
+}
+
+// SyncResult outcome of applying a plan
+type SyncResult struct {
+	Plan        *SyncPlan        `json:"plan"`
+	CreatedKeys []SyncCreatedKey `json:"created_keys,omitempty"`
+}
+
+// ErrSyncStateChanged returned by apply when the platform changed since the plan was computed
+var ErrSyncStateChanged = errors.New("platform state changed since the plan was computed")
+
+// ParsePlatformSpec parse a YAML (or JSON) platform spec, unknown fields are rejected to catch typos
+func ParsePlatformSpec(data []byte) (*PlatformSpec, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var spec PlatformSpec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	if err := validateAgentSpecs(spec.Agents); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	return &spec, nil
+}
+
+// validateAgentSpecs every agent needs a unique name and non-negative queue settings
+func validateAgentSpecs(agents []AgentSpec) error {
+	seen := make(map[string]bool)
+	for i := range agents {
+		agent := &agents[i]
+		if agent.Name == "" {
+			return fmt.Errorf("agents[%d] has no name", i)
+		}
+		if seen[agent.Name] {
+			return fmt.Errorf("agent %q is declared twice", agent.Name)
+		}
+		seen[agent.Name] = true
+
+		if agent.Queue != nil && (agent.Queue.MaxQueueSize < 0 || agent.Queue.DefaultTTL < 0) {
+			return fmt.Errorf("agent %q has a negative queue setting", agent.Name)
+		}
+	}
+	return nil
+}
+
+// toAgent build the agent described by the spec, defaults match the dashboard
+func (s *AgentSpec) toAgent() *Agent {
+	agent := &Agent{
+		Name:             s.Name,
+		Type:             types.AgentType(s.Type),
+		URL:              s.URL,
+		SourceAPIKey:     s.SourceAPIKey,
+		QPS:              s.QPS,
+		Enabled:          true,
+		Description:      s.Description,
+		SupportStreaming: true,
+		ResponseFormat:   s.ResponseFormat,
+	}
+	if s.Enabled != nil {
+		agent.Enabled = *s.Enabled
+	}
+	if s.SupportStreaming != nil {
+		agent.SupportStreaming = *s.SupportStreaming
+	}
+	if agent.ResponseFormat == "" {
+		agent.ResponseFormat = "openai"
+	}
+	return agent
+}
+
+// ConfigSyncService computes and applies declarative configuration changes
+type ConfigSyncService struct {
+	agentService       AgentService
+	queueConfigService AgentQueueConfigService
+}
+
+// syncState current agents and queue overrides
+type syncState struct {
+	agents       map[string]*Agent // by name
+	queueConfigs map[string]*AgentQueueConfig
+	fingerprint  string
+}
+
+// loadState read the current platform state
+func (s *ConfigSyncService) loadState() (*syncState, error) {
+	var agents []*Agent
+	// sandbox agents are not part of the promoted configuration
+	if err := DB.Where("namespace = ?", "").Order("id").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	queueConfigs, err := s.queueConfigService.ListAgentQueueConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &syncState{
+		agents:       make(map[string]*Agent, len(agents)),
+		queueConfigs: make(map[string]*AgentQueueConfig, len(queueConfigs)),
+	}
+	hash := sha256.New()
+	for _, agent := range agents {
+		if _, duplicate := state.agents[agent.Name]; duplicate {
+			return nil, fmt.Errorf("agent name %q is used by several agents, rename them before using sync", agent.Name)
+		}
+		state.agents[agent.Name] = agent
+		fmt.Fprintf(hash, "agent|%d|%s|%d\n", agent.ID, agent.AgentID, agent.UpdatedAt.UnixNano())
+	}
+	for _, config := range queueConfigs {
+		state.queueConfigs[config.AgentID] = config
+		fmt.Fprintf(hash, "queue|%s|%d|%d\n", config.AgentID, config.MaxQueueSize, config.DefaultTTL)
+	}
+	state.fingerprint = hex.EncodeToString(hash.Sum(nil))[:16]
+
+	return state, nil
+}
+
+// Plan compute the changes needed to reach the spec without modifying anything
+func (s *ConfigSyncService) Plan(spec *PlatformSpec) (*SyncPlan, error) {
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(spec, state)
+}
+
+// plan diff the spec against a loaded state
+func (s *ConfigSyncService) plan(spec *PlatformSpec, state *syncState) (*SyncPlan, error) {
+	plan := &SyncPlan{Fingerprint: state.fingerprint, Changes: []SyncChange{}}
+	declared := make(map[string]bool, len(spec.Agents))
+
+	for i := range spec.Agents {
+		agentSpec := &spec.Agents[i]
+		declared[agentSpec.Name] = true
+		existing, exists := state.agents[agentSpec.Name]
+		desired := agentSpec.toAgent()
+		if exists && desired.SourceAPIKey == "" {
+			// exports leave the upstream keys out, every environment keeps its own
+			desired.SourceAPIKey = existing.SourceAPIKey
+		}
+		if err := s.agentService.validateAgent(desired); err != nil {
+			return nil, fmt.Errorf("agent %q: %w", agentSpec.Name, err)
+		}
+
+		if !exists {
+			plan.Changes = append(plan.Changes, SyncChange{
+				Action:   SyncActionCreate,
+				Resource: SyncResourceAgent,
+				Name:     agentSpec.Name,
+				Fields:   diffAgent(&Agent{}, desired),
+				agent:    desired,
+			})
+			if agentSpec.Queue != nil {
+				plan.Changes = append(plan.Changes, queueChange(SyncActionCreate, agentSpec.Name, "", nil, agentSpec.Queue))
+			}
+			continue
+		}
+
+		if fields := diffAgent(existing, desired); len(fields) > 0 {
+			desired.ID = existing.ID
+			plan.Changes = append(plan.Changes, SyncChange{
+				Action:   SyncActionUpdate,
+				Resource: SyncResourceAgent,
+				Name:     agentSpec.Name,
+				AgentID:  existing.AgentID,
+				Fields:   fields,
+				agent:    desired,
+			})
+		} else {
+			plan.Unchanged++
+		}
+
+		current := state.queueConfigs[existing.AgentID]
+		switch {
+		case agentSpec.Queue == nil && current != nil:
+			plan.Changes = append(plan.Changes, queueChange(SyncActionDelete, agentSpec.Name, existing.AgentID, current, nil))
+		case agentSpec.Queue != nil && current == nil:
+			plan.Changes = append(plan.Changes, queueChange(SyncActionCreate, agentSpec.Name, existing.AgentID, nil, agentSpec.Queue))
+		case agentSpec.Queue != nil && (current.MaxQueueSize != agentSpec.Queue.MaxQueueSize || current.DefaultTTL != agentSpec.Queue.DefaultTTL):
+			plan.Changes = append(plan.Changes, queueChange(SyncActionUpdate, agentSpec.Name, existing.AgentID, current, agentSpec.Queue))
+		}
+	}
+
+	if spec.Prune {
+		names := make([]string, 0, len(state.agents))
+		for name := range state.agents {
+			if !declared[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			agent := state.agents[name]
+			plan.Changes = append(plan.Changes, SyncChange{
+				Action:   SyncActionDelete,
+				Resource: SyncResourceAgent,
+				Name:     name,
+				AgentID:  agent.AgentID,
+				agent:    agent,
+			})
+			if current := state.queueConfigs[agent.AgentID]; current != nil {
+				plan.Changes = append(plan.Changes, queueChange(SyncActionDelete, name, agent.AgentID, current, nil))
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply compute the plan and apply it in one transaction, expectedFingerprint may be
+// empty, otherwise the plan must still be computed against the same state
+func (s *ConfigSyncService) Apply(spec *PlatformSpec, expectedFingerprint string) (*SyncResult, error) {
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if expectedFingerprint != "" && expectedFingerprint != state.fingerprint {
+		return nil, ErrSyncStateChanged
+	}
+
+	plan, err := s.plan(spec, state)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{Plan: plan}
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if err := s.applyChange(tx, change, result); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("%s %s %q: %w", change.Action, change.Resource, change.Name, err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	for _, change := range plan.Changes {
+		if change.Resource == SyncResourceAgent && change.Action != SyncActionCreate {
+			invalidateAgentLookups(change.agent.ID)
+		}
+		if change.Resource == SyncResourceAgent && change.Action == SyncActionUpdate {
+			agentUpdated(change.agent)
+		}
+	}
+	return result, nil
+}
+
+// applyChange execute one change inside the apply transaction
+func (s *ConfigSyncService) applyChange(tx *gorm.DB, change *SyncChange, result *SyncResult) error {
+	switch change.Resource {
+	case SyncResourceAgent:
+		switch change.Action {
+		case SyncActionCreate:
+			change.agent.AgentID = s.agentService.generateAgentID()
+			change.agent.SetConnectorAPIKey(s.agentService.generateConnectorAPIKey())
+			if err := tx.Create(change.agent).Error; err != nil {
+				return err
+			}
+			if err := enqueueAgentKeyCreated(tx, change.agent, "sync"); err != nil {
+				return err
+			}
+			change.AgentID = change.agent.AgentID
+			result.CreatedKeys = append(result.CreatedKeys, SyncCreatedKey{
+				Name:            change.Name,
+				AgentID:         change.agent.AgentID,
+				ConnectorAPIKey: change.agent.ConnectorAPIKey,
+			})
+		case SyncActionUpdate:
+			return tx.Model(&Agent{}).Where("id = ?", change.agent.ID).Updates(map[string]interface{}{
+				"type":              change.agent.Type,
+				"url":               change.agent.URL,
+				"source_api_key":    change.agent.SourceAPIKey,
+				"qps":               change.agent.QPS,
+				"enabled":           change.agent.Enabled,
+				"description":       change.agent.Description,
+				"support_streaming": change.agent.SupportStreaming,
+				"response_format":   change.agent.ResponseFormat,
+				"version":           bumpVersion(),
+			}).Error
+		case SyncActionDelete:
+			return tx.Delete(&Agent{}, change.agent.ID).Error
+		}
+	case SyncResourceQueueConfig:
+		if change.AgentID == "" {
+			// queue of an agent created earlier in this plan
+			change.AgentID = createdAgentID(result, change.Name)
+		}
+		change.queue.AgentID = change.AgentID
+		switch change.Action {
+		case SyncActionCreate, SyncActionUpdate:
+			return tx.Where("agent_id = ?", change.AgentID).
+				Assign(map[string]interface{}{
+					"max_queue_size": change.queue.MaxQueueSize,
+					"default_ttl":    change.queue.DefaultTTL,
+				}).
+				FirstOrCreate(&AgentQueueConfig{AgentID: change.AgentID}).Error
+		case SyncActionDelete:
+			return tx.Where("agent_id = ?", change.AgentID).Delete(&AgentQueueConfig{}).Error
+		}
+	}
+	return nil
+}
+
+// QueueConfig desired queue override of a queue change, nil for deletions
+func (c *SyncChange) QueueConfig() *AgentQueueConfig {
+	if c.Resource != SyncResourceQueueConfig || c.Action == SyncActionDelete {
+		return nil
+	}
+	return c.queue
+}
+
+// createdAgentID agent ID assigned to an agent created by the current apply
+func createdAgentID(result *SyncResult, name string) string {
+	for _, key := range result.CreatedKeys {
+		if key.Name == name {
+			return key.AgentID
+		}
+	}
+	return ""
+}
+
+// queueChange build a queue override change
+func queueChange(action, name, agentID string, current *AgentQueueConfig, desired *QueueSpec) SyncChange {
+	change := SyncChange{
+		Action:   action,
+		Resource: SyncResourceQueueConfig,
+		Name:     name,
+		AgentID:  agentID,
+		Fields:   make(map[string]SyncFieldChange),
+		queue:    &AgentQueueConfig{AgentID: agentID},
+	}
+
+	var from, to QueueSpec
+	if current != nil {
+		from = QueueSpec{MaxQueueSize: current.MaxQueueSize, DefaultTTL: current.DefaultTTL}
+	}
+	if desired != nil {
+		to = *desired
+		change.queue.MaxQueueSize = desired.MaxQueueSize
+		change.queue.DefaultTTL = desired.DefaultTTL
+	}
+	if from.MaxQueueSize != to.MaxQueueSize || current == nil || desired == nil {
+		change.Fields["max_queue_size"] = SyncFieldChange{From: from.MaxQueueSize, To: to.MaxQueueSize}
+	}
+	if from.DefaultTTL != to.DefaultTTL || current == nil || desired == nil {
+		change.Fields["default_ttl"] = SyncFieldChange{From: from.DefaultTTL, To: to.DefaultTTL}
+	}
+	return change
+}
+
+// diffAgent list the declared fields that differ, the source API key is never echoed
+func diffAgent(current, desired *Agent) map[string]SyncFieldChange {
+	fields := make(map[string]SyncFieldChange)
+	compare := func(name string, from, to interface{}) {
+		a, _ := json.Marshal(from)
+		b, _ := json.Marshal(to)
+		if !bytes.Equal(a, b) {
+			fields[name] = SyncFieldChange{From: from, To: to}
+		}
+	}
+
+	compare("type", string(current.Type), string(desired.Type))
+	compare("url", current.URL, desired.URL)
+	if current.SourceAPIKey != desired.SourceAPIKey {
+		fields["source_api_key"] = SyncFieldChange{From: maskSecret(current.SourceAPIKey), To: maskSecret(desired.SourceAPIKey)}
+	}
+	compare("qps", current.QPS, desired.QPS)
+	compare("enabled", current.Enabled, desired.Enabled)
+	compare("description", current.Description, desired.Description)
+	compare("support_streaming", current.SupportStreaming, desired.SupportStreaming)
+	compare("response_format", current.ResponseFormat, desired.ResponseFormat)
+	return fields
+}
+
+// maskSecret keep only a hint of a secret for plan output
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "********"
+	}
+	return secret[:4] + "****" + secret[len(secret)-2:]
+}
@@ -0,0 +1,433 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/envelope"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// reencryptBatchSize usage records re-encrypted per query
+	reencryptBatchSize = 200
+
+	// contentKeyCheckInterval how long a keyring uses its cached current key before it
+	// checks again that no other process retired it
+	contentKeyCheckInterval = 30 * time.Second
+
+	// retiredKeyGrace how long a retired data key is kept although no content uses it,
+	// well above contentKeyCheckInterval so content a keyring wrote before it noticed
+	// the retirement can still be decrypted
+	retiredKeyGrace = time.Hour
+)
+
+// ErrContentEncryptionDisabled no master key is configured
+var ErrContentEncryptionDisabled = errors.New("content encryption is not configured")
+
+// contentKeyring encrypts usage content when a master key is configured, nil otherwise
+var contentKeyring *ContentKeyring
+
+// ContentKeyring envelope encryption of stored usage content, every agent (tenant)
+// has its own data key which is replaced once it is older than the rotation period
+type ContentKeyring struct {
+	masterKeys *envelope.MasterKeys
+	rotation   time.Duration
+
+	mu       sync.Mutex
+	current  map[string]*ContentKey // current key by agent id
+	checked  map[string]time.Time   // when the current key was last read by agent id
+	dataKeys map[uint][]byte        // unwrapped data keys by content key id
+}
+
+// ReencryptResult outcome of one re-encryption run
+type ReencryptResult struct {
+	RewrappedKeys       int `json:"rewrapped_keys"`
+	ReencryptedContents int `json:"reencrypted_contents"`
+	FailedContents      int `json:"failed_contents"`
+	DeletedKeys         int `json:"deleted_keys"`
+}
+
+// InitContentEncryption create the keyring configured in the global config and use it
+// for usage content, nil when no master key is configured
+func InitContentEncryption() (*ContentKeyring, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	if cfg.Encryption.MasterKeys == "" {
+		return nil, nil
+	}
+
+	masterKeys, err := envelope.ParseMasterKeys(cfg.Encryption.MasterKeys, cfg.Encryption.ActiveMasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content encryption keys: %w", err)
+	}
+
+	contentKeyring = NewContentKeyring(masterKeys, cfg.Encryption.DataKeyRotation)
+	return contentKeyring, nil
+}
+
+// NewContentKeyring create content keyring, a rotation of 0 never replaces data keys
+func NewContentKeyring(masterKeys *envelope.MasterKeys, rotation time.Duration) *ContentKeyring {
+	return &ContentKeyring{
+		masterKeys: masterKeys,
+		rotation:   rotation,
+		current:    make(map[string]*ContentKey),
+		checked:    make(map[string]time.Time),
+		dataKeys:   make(map[uint][]byte),
+	}
+}
+
+// contentContext authenticated data binding content to its agent, so a row moved to
+// another agent's record does not decrypt
+func contentContext(agentID string) string {
+	return "usage-content:" + agentID
+}
+
+// encrypt seal the request and response text and the parameters with the agent's current data key
+func (k *ContentKeyring) encrypt(agentID string, content *UsageRecordContent) error {
+	key, dataKey, err := k.currentKey(agentID)
+	if err != nil {
+		return err
+	}
+
+	request, err := envelope.Seal(dataKey, []byte(content.Request), contentContext(agentID))
+	if err != nil {
+		return err
+	}
+	response, err := envelope.Seal(dataKey, []byte(content.Response), contentContext(agentID))
+	if err != nil {
+		return err
+	}
+	// records stored before the parameters were kept have none to seal
+	parameters := ""
+	if content.Parameters != "" {
+		if parameters, err = envelope.Seal(dataKey, []byte(content.Parameters), contentContext(agentID)); err != nil {
+			return err
+		}
+	}
+
+	content.Request, content.Response, content.Parameters, content.KeyID = request, response, parameters, key.ID
+	return nil
+}
+
+// decrypt open the request and response text and the parameters in place, plaintext content is left as is
+func (k *ContentKeyring) decrypt(agentID string, content *UsageRecordContent) error {
+	if content.KeyID == 0 {
+		return nil
+	}
+
+	dataKey, err := k.dataKey(content.KeyID)
+	if err != nil {
+		return err
+	}
+
+	request, err := envelope.Open(dataKey, content.Request, contentContext(agentID))
+	if err != nil {
+		return err
+	}
+	response, err := envelope.Open(dataKey, content.Response, contentContext(agentID))
+	if err != nil {
+		return err
+	}
+	var parameters []byte
+	if content.Parameters != "" {
+		if parameters, err = envelope.Open(dataKey, content.Parameters, contentContext(agentID)); err != nil {
+			return err
+		}
+	}
+
+	content.Request, content.Response, content.Parameters, content.KeyID = string(request), string(response), string(parameters), 0
+	return nil
+}
+
+// sealText encrypt one text of the agent with its current data key, bound to context;
+// returns the sealed text and the id of the content key
+func (k *ContentKeyring) sealText(agentID, text, context string) (string, uint, error) {
+	key, dataKey, err := k.currentKey(agentID)
+	if err != nil {
+		return "", 0, err
+	}
+	sealed, err := envelope.Seal(dataKey, []byte(text), context)
+	if err != nil {
+		return "", 0, err
+	}
+	return sealed, key.ID, nil
+}
+
+// openText decrypt a text sealed with sealText
+func (k *ContentKeyring) openText(keyID uint, sealed, context string) (string, error) {
+	dataKey, err := k.dataKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	text, err := envelope.Open(dataKey, sealed, context)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// currentKey the agent's data key for new content, created when the agent has none or
+// its key is due for rotation. The cached key is read again after contentKeyCheckInterval,
+// as the keyring of another process may have retired it.
+func (k *ContentKeyring) currentKey(agentID string) (*ContentKey, []byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key := k.current[agentID]; key != nil && !k.due(key) && time.Since(k.checked[agentID]) < contentKeyCheckInterval {
+		return key, k.dataKeys[key.ID], nil
+	}
+
+	key, err := activeContentKey(DB, agentID)
+	if err == nil && !k.due(key) {
+		dataKey, err := k.unwrap(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		k.current[agentID], k.checked[agentID] = key, time.Now()
+		return key, dataKey, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	return k.rotateLocked(agentID)
+}
+
+// activeContentKey the agent's data key that is not retired
+func activeContentKey(db *gorm.DB, agentID string) (*ContentKey, error) {
+	var key ContentKey
+	if err := db.Where("agent_id = ? AND retired_at IS NULL", agentID).Order("id DESC").First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// due report whether the key is older than the rotation period
+func (k *ContentKeyring) due(key *ContentKey) bool {
+	return k.rotation > 0 && time.Since(key.CreatedAt) >= k.rotation
+}
+
+// rotateLocked create a new data key for the agent and retire its previous ones. The
+// agent row is locked meanwhile, so the keyrings of dataflow and control flow cannot
+// both create an active key; one that lost the race uses the key of the other.
+func (k *ContentKeyring) rotateLocked(agentID string) (*ContentKey, []byte, error) {
+	dataKey, err := envelope.GenerateDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	masterKeyID, wrapped, err := k.masterKeys.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := &ContentKey{AgentID: agentID, MasterKeyID: masterKeyID, WrappedKey: wrapped}
+	rotated := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		// a deleted agent serves no requests, only the re-encryption job writes its content
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("agent_id = ?", agentID).First(&Agent{}).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		active, err := activeContentKey(tx, agentID)
+		if err == nil && !k.due(active) {
+			key = active
+			return nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Model(&ContentKey{}).
+			Where("agent_id = ? AND retired_at IS NULL", agentID).
+			Update("retired_at", time.Now()).Error; err != nil {
+			return err
+		}
+		rotated = true
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create content key: %w", err)
+	}
+
+	if rotated {
+		k.dataKeys[key.ID] = dataKey
+	} else if dataKey, err = k.unwrap(key); err != nil {
+		return nil, nil, err
+	}
+	k.current[agentID], k.checked[agentID] = key, time.Now()
+	return key, dataKey, nil
+}
+
+// dataKey the unwrapped data key of a content key, cached after the first use
+func (k *ContentKeyring) dataKey(id uint) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if dataKey, ok := k.dataKeys[id]; ok {
+		return dataKey, nil
+	}
+
+	var key ContentKey
+	if err := DB.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("content key %d not found", id)
+		}
+		return nil, err
+	}
+	return k.unwrap(&key)
+}
+
+// unwrap open the wrapped data key and cache it, the caller holds mu
+func (k *ContentKeyring) unwrap(key *ContentKey) ([]byte, error) {
+	if dataKey, ok := k.dataKeys[key.ID]; ok {
+		return dataKey, nil
+	}
+
+	dataKey, err := k.masterKeys.UnwrapKey(key.MasterKeyID, key.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap content key %d: %w", key.ID, err)
+	}
+	k.dataKeys[key.ID] = dataKey
+	return dataKey, nil
+}
+
+// Reencrypt rewrap the data keys of retired master keys with the active one, move
+// plaintext content and content under retired data keys to the agents' current keys,
+// then delete the data keys retired for longer than retiredKeyGrace that no content or
+// conversation title is encrypted with anymore. Content in the analytics usage storage is left as it is.
+func (k *ContentKeyring) Reencrypt(ctx context.Context) (*ReencryptResult, error) {
+	result := &ReencryptResult{}
+
+	rewrapped, err := k.rewrapKeys()
+	if err != nil {
+		return result, err
+	}
+	result.RewrappedKeys = rewrapped
+
+	// content stored in the analytics database keeps its data keys, so they are never
+	// deleted; rewrapping them with the active master key is all that applies
+	if !usageStoreIsRelational() {
+		return result, nil
+	}
+
+	retired := DB.Model(&ContentKey{}).Select("id").Where("retired_at IS NOT NULL")
+	stale := DB.Model(&UsageRecordContent{}).Select("usage_record_id").Where("key_id = 0 OR key_id IN (?)", retired)
+
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var records []*UsageRecord
+		err := DB.Preload("Content").
+			Where("id > ? AND id IN (?)", lastID, stale).
+			Order("id").Limit(reencryptBatchSize).
+			Find(&records).Error
+		if err != nil {
+			return result, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		for _, record := range records {
+			lastID = record.ID
+			if record.Content == nil {
+				continue
+			}
+			if err := k.reencryptContent(record); err != nil {
+				log.Printf("Failed to re-encrypt content of usage record %d: %v", record.ID, err)
+				result.FailedContents++
+				continue
+			}
+			result.ReencryptedContents++
+		}
+	}
+
+	deleted := DB.Where("retired_at < ? AND id NOT IN (?) AND id NOT IN (?)", time.Now().Add(-retiredKeyGrace),
+		DB.Model(&UsageRecordContent{}).Distinct("key_id"),
+		DB.Model(&ConversationTitle{}).Distinct("key_id")).Delete(&ContentKey{})
+	if deleted.Error != nil {
+		return result, deleted.Error
+	}
+	result.DeletedKeys = int(deleted.RowsAffected)
+
+	return result, nil
+}
+
+// reencryptContent decrypt the record's content with its old key and store it under
+// the agent's current key
+func (k *ContentKeyring) reencryptContent(record *UsageRecord) error {
+	content := record.Content
+	if err := k.decrypt(record.AgentID, content); err != nil {
+		return err
+	}
+	if err := k.encrypt(record.AgentID, content); err != nil {
+		return err
+	}
+
+	return DB.Model(content).Updates(map[string]interface{}{
+		"request":    content.Request,
+		"response":   content.Response,
+		"parameters": content.Parameters,
+		"key_id":     content.KeyID,
+	}).Error
+}
+
+// rewrapKeys wrap the data keys of inactive master keys with the active master key,
+// so old master keys can be removed from the configuration
+func (k *ContentKeyring) rewrapKeys() (int, error) {
+	var keys []*ContentKey
+	if err := DB.Where("master_key_id <> ?", k.masterKeys.ActiveID()).Find(&keys).Error; err != nil {
+		return 0, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	rewrapped := 0
+	for _, key := range keys {
+		dataKey, err := k.unwrap(key)
+		if err != nil {
+			log.Printf("Failed to rewrap content key %d: %v", key.ID, err)
+			continue
+		}
+		masterKeyID, wrapped, err := k.masterKeys.WrapKey(dataKey)
+		if err != nil {
+			return rewrapped, err
+		}
+		err = DB.Model(key).Updates(map[string]interface{}{
+			"master_key_id": masterKeyID,
+			"wrapped_key":   wrapped,
+		}).Error
+		if err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+// ReencryptUsageContent run the re-encryption job once with the configured keyring
+func ReencryptUsageContent(ctx context.Context) (*ReencryptResult, error) {
+	if contentKeyring == nil {
+		return nil, ErrContentEncryptionDisabled
+	}
+	return contentKeyring.Reencrypt(ctx)
+}
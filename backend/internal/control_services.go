@@ -1,9 +1,20 @@
 package internal
 
 import (
+	"agent-connector/pkg/accesswindow"
+	"agent-connector/pkg/acl"
+	agentpkg "agent-connector/pkg/agent"
+	"agent-connector/pkg/mockagent"
+	"agent-connector/pkg/recorder"
+	"agent-connector/pkg/redact"
 	"agent-connector/pkg/types"
+	"crypto/rand"
 	"errors"
-	"time"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
 
 	"gorm.io/gorm"
 )
@@ -25,21 +36,49 @@ func (s *SystemConfigService) GetSystemConfig() (*SystemConfig, error) {
 	return &config, nil
 }
 
-// UpdateSystemConfig update system configuration
+// UpdateSystemConfig update system configuration, the other services apply the change live
 func (s *SystemConfigService) UpdateSystemConfig(config *SystemConfig) error {
+	switch config.RateLimitMode {
+	case "", RateLimitModeEnforce, RateLimitModeMonitor, RateLimitModeOff:
+	default:
+		return fmt.Errorf("invalid rate limit mode %q, expected enforce, monitor or off", config.RateLimitMode)
+	}
+	if config.ImpersonationTTLMinutes < 0 {
+		return errors.New("impersonation TTL cannot be negative")
+	}
+	if config.DefaultQPS < 0 {
+		return errors.New("default QPS cannot be negative")
+	}
+	if config.DefaultPriority < 0 || config.DefaultPriority > MaxUserPriority {
+		return fmt.Errorf("default priority must be between 1 and %d, 0 keeps %d", MaxUserPriority, DefaultUserPriority)
+	}
+	if !ValidLoginAnomalySensitivity(config.LoginAnomalySensitivity) {
+		return fmt.Errorf("invalid login anomaly sensitivity %q, expected off, low, medium or high", config.LoginAnomalySensitivity)
+	}
+
 	var existingConfig SystemConfig
 	err := DB.First(&existingConfig).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// create new configuration
-		return DB.Create(config).Error
-	} else if err != nil {
+		err = DB.Create(config).Error
+	} else if err == nil {
+		// update existing configuration, keeping what the request does not carry; without
+		// a version the update is based on the stored one
+		config.ID = existingConfig.ID
+		config.BootstrappedAt = existingConfig.BootstrappedAt
+		config.CreatedAt = existingConfig.CreatedAt
+		if config.Version == 0 {
+			config.Version = existingConfig.Version
+		}
+		err = updateVersioned(DB, config, &config.Version)
+	}
+	if err != nil {
 		return err
 	}
 
-	// update existing configuration
-	config.ID = existingConfig.ID
-	return DB.Save(config).Error
+	publishSystemConfig(config)
+	return nil
 }
 
 // AgentService agent service
@@ -68,12 +107,17 @@ func (s *AgentService) generateConnectorAPIKey() string {
 	return "sk-conn_" + generateRandomString(32)
 }
 
-// generateRandomString generate random string
+// generateRandomString generate random string from a cryptographically secure source
 func generateRandomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	max := big.NewInt(int64(len(charset)))
 	result := make([]byte, length)
 	for i := range result {
-		result[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(fmt.Sprintf("crypto/rand unavailable: %v", err))
+		}
+		result[i] = charset[n.Int64()]
 	}
 	return string(result)
 }
@@ -91,25 +135,53 @@ func (s *AgentService) GetAgent(id uint) (*Agent, error) {
 	return &agent, nil
 }
 
+// agentListSpec searchable, filterable and sortable columns of the agent list
+var agentListSpec = listQuerySpec{
+	searchColumns: []string{"name", "agent_id", "description"},
+	typeColumn:    "type",
+	sortColumns: map[string]string{
+		"name":       "name",
+		"type":       "type",
+		"qps":        "qps",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	defaultSort: "created_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch status {
+		case "enabled":
+			return db.Where("enabled = ?", true), nil
+		case "disabled":
+			return db.Where("enabled = ?", false), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
 // ListAgents get agent list
-func (s *AgentService) ListAgents(page, pageSize int, agentType string) ([]*Agent, int64, error) {
+func (s *AgentService) ListAgents(listQuery *ListQuery) ([]*Agent, int64, error) {
 	var agents []*Agent
 	var total int64
 
-	query := DB.Model(&Agent{})
-	if agentType != "" {
-		query = query.Where("type = ?", agentType)
+	// sandbox agents are listed under /sandbox/agents
+	query, err := listQuery.filter(DB.Model(&Agent{}).Where("namespace = ?", ""), agentListSpec)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// calculate total
-	err := query.Count(&total).Error
+	err = query.Count(&total).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// paginated query
-	offset := (page - 1) * pageSize
-	err = query.Offset(offset).Limit(pageSize).Find(&agents).Error
+	// sorted and paginated query
+	query, err = listQuery.paginate(query, agentListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&agents).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -117,21 +189,185 @@ func (s *AgentService) ListAgents(page, pageSize int, agentType string) ([]*Agen
 	return agents, total, nil
 }
 
+// ListEnabledAgents get every enabled agent
+func (s *AgentService) ListEnabledAgents() ([]*Agent, error) {
+	var agents []*Agent
+	if err := DB.Where("enabled = ?", true).Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
 // CreateAgent create agent
 func (s *AgentService) CreateAgent(agent *Agent) error {
+	return s.createAgent(agent, s.generateAgentID())
+}
+
+// createAgent create agent under agentID, with a new connector API key
+func (s *AgentService) createAgent(agent *Agent, agentID string) error {
 	// validate agent configuration
 	if err := s.validateAgent(agent); err != nil {
 		return err
 	}
 
-	// automatically generate agent ID and connector API key
-	agent.AgentID = s.generateAgentID()
-	agent.ConnectorAPIKey = s.generateConnectorAPIKey()
+	// automatically generate connector API key
+	agent.AgentID = agentID
+	agent.SetConnectorAPIKey(s.generateConnectorAPIKey())
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(agent).Error; err != nil {
+			return err
+		}
+		return enqueueAgentKeyCreated(tx, agent, "created")
+	})
+}
+
+// GetAgentByConnectorAPIKey get agent by connector API key, using the plaintext prefix for lookup
+func (s *AgentService) GetAgentByConnectorAPIKey(apiKey string) (*Agent, error) {
+	var candidates []*Agent
+	err := DB.Where("connector_key_prefix = ?", ConnectorKeyPrefix(apiKey)).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, agent := range candidates {
+		if agent.VerifyConnectorAPIKey(apiKey) {
+			return agent, nil
+		}
+	}
+
+	return nil, errors.New("agent not found")
+}
+
+// RotateConnectorAPIKey replace the connector API key of an agent, the returned agent
+// carries the new plaintext key which cannot be retrieved again afterwards
+func (s *AgentService) RotateConnectorAPIKey(id uint) (*Agent, error) {
+	agent, err := s.GetAgent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	agent.SetConnectorAPIKey(s.generateConnectorAPIKey())
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Agent{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"connector_key_prefix": agent.ConnectorKeyPrefix,
+			"connector_key_hash":   agent.ConnectorKeyHash,
+			"connector_api_key":    nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return enqueueAgentKeyCreated(tx, agent, "rotated")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateAgentLookups(id)
+	return agent, nil
+}
+
+// RotateSigningSecret replace the secret the agent's requests are HMAC signed with,
+// requests signed with the old secret fail immediately. The returned agent carries the
+// new secret, which is only shown once.
+func (s *AgentService) RotateSigningSecret(id uint) (*Agent, error) {
+	agent, err := s.GetAgent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	agent.SigningSecret = "sig_" + generateRandomString(48)
+	err = DB.Model(&Agent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"signing_secret": agent.SigningSecret,
+		"version":        bumpVersion(),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
 
-	return DB.Create(agent).Error
+	invalidateAgentLookups(id)
+	return agent, nil
 }
 
-// UpdateAgent update agent
+// SetAgentACL replace the users, roles and key prefixes allowed to call an agent, an
+// empty list lets every caller with a valid key through again
+func (s *AgentService) SetAgentACL(id uint, list acl.List) (*Agent, error) {
+	agent, err := s.GetAgent(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeAgentACL(&list); err != nil {
+		return nil, err
+	}
+
+	agent.AllowedUsers = acl.Join(list.Users)
+	agent.AllowedRoles = acl.Join(list.Roles)
+	agent.AllowedKeys = acl.Join(list.Keys)
+	if len(agent.AllowedUsers) > 1000 || len(agent.AllowedKeys) > 1000 {
+		return nil, agentFieldError("acl", "agent access list is too long, at most 1000 characters of users and of keys")
+	}
+	err = DB.Model(&Agent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"allowed_users": agent.AllowedUsers,
+		"allowed_roles": agent.AllowedRoles,
+		"allowed_keys":  agent.AllowedKeys,
+		"version":       bumpVersion(),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateAgentLookups(id)
+	return agent, nil
+}
+
+// normalizeAgentACL check the entries of an access list: users must exist, roles are
+// platform roles and keys are cut to the lookup prefix of a connector key or
+// playground token, so a full key can be pasted
+func normalizeAgentACL(list *acl.List) error {
+	for i, role := range list.Roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		switch UserRole(role) {
+		case UserRoleAdmin, UserRoleOperator, UserRoleUser, UserRoleReadonly:
+			list.Roles[i] = role
+		default:
+			return agentFieldError("roles", fmt.Sprintf("invalid role %q, expected admin, operator, user or readonly", role))
+		}
+	}
+
+	for i, key := range list.Keys {
+		key = strings.TrimSpace(key)
+		switch {
+		case IsPlaygroundToken(key) && len(key) >= playgroundTokenPrefixLength:
+			list.Keys[i] = key[:playgroundTokenPrefixLength]
+		case strings.HasPrefix(key, "sk-conn_") && len(key) >= connectorKeyPrefixLength:
+			list.Keys[i] = ConnectorKeyPrefix(key)
+		default:
+			return agentFieldError("keys", fmt.Sprintf("invalid key %q, expected a connector key prefix like sk-conn_ab12cd34 or a playground token prefix like pg_ab12cd34", key))
+		}
+	}
+
+	users := acl.Split(strings.Join(list.Users, ","))
+	if len(users) == 0 {
+		return nil
+	}
+	var found []string
+	if err := DB.Model(&User{}).Where("username IN ?", users).Pluck("username", &found).Error; err != nil {
+		return fmt.Errorf("failed to look up users: %v", err)
+	}
+	var unknown []string
+	for _, user := range users {
+		if !slices.Contains(found, user) {
+			unknown = append(unknown, user)
+		}
+	}
+	if len(unknown) > 0 {
+		return agentFieldError("users", "unknown users: "+strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// UpdateAgent update agent, agent.Version is the version the changes are based on;
+// ErrVersionConflict when the agent changed since
 func (s *AgentService) UpdateAgent(id uint, agent *Agent) error {
 	// validate agent configuration
 	if err := s.validateAgent(agent); err != nil {
@@ -148,7 +384,58 @@ func (s *AgentService) UpdateAgent(id uint, agent *Agent) error {
 	}
 
 	agent.ID = id
-	return DB.Save(agent).Error
+	if err := updateVersioned(DB, agent, &agent.Version); err != nil {
+		return err
+	}
+
+	invalidateAgentLookups(id)
+	agentUpdated(agent)
+	return nil
+}
+
+var (
+	agentUpdateHooksMu sync.Mutex
+	agentUpdateHooks   []func(agent *Agent)
+)
+
+// OnAgentUpdated register fn to run in the background after the configuration of
+// an agent was changed through the API or a sync
+func OnAgentUpdated(fn func(agent *Agent)) {
+	agentUpdateHooksMu.Lock()
+	defer agentUpdateHooksMu.Unlock()
+	agentUpdateHooks = append(agentUpdateHooks, fn)
+}
+
+// agentUpdated run the update hooks for a changed agent
+func agentUpdated(agent *Agent) {
+	agentUpdateHooksMu.Lock()
+	hooks := agentUpdateHooks
+	agentUpdateHooksMu.Unlock()
+
+	for _, hook := range hooks {
+		go hook(agent)
+	}
+}
+
+// SetAgentEnabled enable or disable an agent
+func (s *AgentService) SetAgentEnabled(id uint, enabled bool) error {
+	result := DB.Model(&Agent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"enabled": enabled,
+		"version": bumpVersion(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		// MySQL reports 0 affected rows when the value is unchanged
+		if _, err := s.GetAgent(id); err != nil {
+			return err
+		}
+	}
+
+	invalidateAgentLookups(id)
+	return nil
 }
 
 // DeleteAgent delete agent (soft delete)
@@ -162,29 +449,294 @@ func (s *AgentService) DeleteAgent(id uint) error {
 		return errors.New("agent not found")
 	}
 
+	invalidateAgentLookups(id)
 	return nil
 }
 
 // validateAgent validate agent configuration
 func (s *AgentService) validateAgent(agent *Agent) error {
 	if agent.Name == "" {
-		return errors.New("agent name is required")
+		return agentFieldError("name", "agent name is required")
+	}
+
+	if agent.Type != types.AgentTypeOpenAI && agent.Type != types.AgentTypeDifyChat && agent.Type != types.AgentTypeDifyWorkflow && agent.Type != types.AgentTypeMock {
+		return agentFieldError("type", "invalid agent type")
+	}
+
+	if agent.Type == types.AgentTypeMock {
+		// the URL holds the mock options, there is no upstream key
+		if agent.URL == "" {
+			agent.URL = mockagent.Scheme + "://local"
+		}
+		if _, err := mockagent.ParseOptions(agent.URL); err != nil {
+			return agentFieldError("url", err.Error())
+		}
+		if agent.ResponseFormat == types.ResponseFormatDify {
+			return agentFieldError("response_format", "mock agents answer in the openai response format")
+		}
+	} else if err := validateAgentTypeConfig(agent); err != nil {
+		return err
 	}
 
-	if agent.Type != types.AgentTypeOpenAI && agent.Type != types.AgentTypeDifyChat && agent.Type != types.AgentTypeDifyWorkflow {
-		return errors.New("invalid agent type")
+	if agent.QPS <= 0 {
+		return agentFieldError("qps", "agent QPS must be greater than 0")
 	}
 
-	if agent.URL == "" {
-		return errors.New("agent URL is required")
+	if agent.PromptPrice < 0 {
+		return agentFieldError("prompt_price", "agent token prices cannot be negative")
+	}
+	if agent.CompletionPrice < 0 {
+		return agentFieldError("completion_price", "agent token prices cannot be negative")
 	}
 
-	if agent.SourceAPIKey == "" {
-		return errors.New("agent source API key is required")
+	if agent.MonthlyBudget < 0 {
+		return agentFieldError("monthly_budget", "agent monthly budget cannot be negative")
 	}
 
-	if agent.QPS <= 0 {
-		return errors.New("agent QPS must be greater than 0")
+	if agent.HedgeAfterMs < 0 {
+		return agentFieldError("hedge_after_ms", "agent hedge delay cannot be negative")
+	}
+	if agent.HedgeAgentID != "" {
+		if agent.HedgeAfterMs == 0 {
+			return agentFieldError("hedge_after_ms", "agent hedge delay is required with a hedge agent")
+		}
+		if agent.HedgeAgentID == agent.AgentID {
+			return agentFieldError("hedge_agent_id", "agent cannot hedge to itself")
+		}
+		hedge, err := s.GetAgentByAgentID(agent.HedgeAgentID)
+		if err != nil {
+			return agentFieldError("hedge_agent_id", fmt.Sprintf("invalid hedge_agent_id: %v", err))
+		}
+		if hedge.Namespace != agent.Namespace {
+			return agentFieldError("hedge_agent_id", "agent cannot hedge to an agent of another namespace")
+		}
+		if agent.PrivacyMode && !hedge.PrivacyMode {
+			return agentFieldError("hedge_agent_id", "a privacy mode agent can only hedge to another privacy mode agent")
+		}
+	}
+
+	mode, err := recorder.ParseMode(agent.RecordMode)
+	if err != nil {
+		return agentFieldError("record_mode", err.Error())
+	}
+	if mode == recorder.ModeRecord && agent.PrivacyMode {
+		return agentFieldError("record_mode", "privacy mode agents cannot record upstream exchanges")
+	}
+
+	if agent.UserQPS < 0 {
+		return agentFieldError("user_qps", "agent user QPS cannot be negative")
+	}
+
+	if agent.StreamTokenRate < 0 {
+		return agentFieldError("stream_token_rate", "agent stream token rate cannot be negative")
+	}
+
+	if agent.Passthrough && agent.Type != types.AgentTypeOpenAI {
+		return agentFieldError("passthrough", "only openai agents can be exposed as a passthrough proxy")
+	}
+
+	agent.Tier = strings.TrimSpace(agent.Tier)
+	if agent.Tier != "" {
+		if _, err := (&KeyTierService{}).GetKeyTierByName(agent.Tier); err != nil {
+			return agentFieldError("tier", fmt.Sprintf("invalid tier: %v", err))
+		}
+	}
+
+	agent.QuotaPool = strings.TrimSpace(agent.QuotaPool)
+	if agent.QuotaPool != "" {
+		if _, err := (&QuotaPoolService{}).GetQuotaPoolByName(agent.QuotaPool); err != nil {
+			return agentFieldError("quota_pool", fmt.Sprintf("invalid quota pool: %v", err))
+		}
+	}
+	if agent.PoolTokenLimit < 0 {
+		return agentFieldError("pool_token_limit", "agent pool token limit cannot be negative")
+	}
+	if agent.PoolRequestLimit < 0 {
+		return agentFieldError("pool_request_limit", "agent pool request limit cannot be negative")
+	}
+
+	agent.AccessSchedule = strings.TrimSpace(agent.AccessSchedule)
+	agent.AccessTimezone = strings.TrimSpace(agent.AccessTimezone)
+	if _, err := accesswindow.LoadLocation(agent.AccessTimezone); err != nil {
+		return agentFieldError("access_timezone", err.Error())
+	}
+	if _, err := accesswindow.Parse(agent.AccessSchedule, agent.AccessTimezone); err != nil {
+		return agentFieldError("access_schedule", err.Error())
+	}
+
+	if agent.ContextWindow < 0 {
+		return agentFieldError("context_window", "agent context window cannot be negative")
+	}
+	switch agent.ContextOverflow {
+	case "":
+		agent.ContextOverflow = ContextOverflowReject
+	case ContextOverflowReject, ContextOverflowTruncateOldest, ContextOverflowSummarize:
+	default:
+		return agentFieldError("context_overflow", fmt.Sprintf("invalid context overflow policy %q, expected reject, truncate_oldest or summarize", agent.ContextOverflow))
+	}
+
+	if agent.MaxTemperature < 0 || agent.MaxTemperature > 2 {
+		return agentFieldError("max_temperature", "agent max temperature must be between 0 and 2")
+	}
+	if agent.MaxTokensCap < 0 {
+		return agentFieldError("max_tokens_cap", "agent max tokens cap cannot be negative")
+	}
+	if agent.MaxMessages < 0 {
+		return agentFieldError("max_messages", "agent max messages cannot be negative")
+	}
+	if agent.MaxMessageBytes < 0 {
+		return agentFieldError("max_message_bytes", "agent max message bytes cannot be negative")
+	}
+	if agent.MaxInputs < 0 {
+		return agentFieldError("max_inputs", "agent max inputs cannot be negative")
+	}
+	agent.ForbiddenParameters = strings.Join(agent.ForbiddenParameterList(), ",")
+	switch agent.GuardrailPolicy {
+	case "":
+		agent.GuardrailPolicy = GuardrailPolicyClamp
+	case GuardrailPolicyClamp, GuardrailPolicyReject:
+	default:
+		return agentFieldError("guardrail_policy", fmt.Sprintf("invalid guardrail policy %q, expected clamp or reject", agent.GuardrailPolicy))
+	}
+
+	rules := agent.OutputFilterRules()
+	for _, rule := range rules {
+		if _, ok := redact.Builtin(rule); !ok {
+			return agentFieldError("output_filter", fmt.Sprintf("unknown output filter rule %q, expected one of %s", rule, strings.Join(redact.BuiltinRuleNames(), ", ")))
+		}
+	}
+	agent.OutputFilter = strings.Join(rules, ",")
+	agent.BlockedWords = strings.Join(agent.BlockedWordList(), ",")
+	switch agent.OutputFilterAction {
+	case "":
+		agent.OutputFilterAction = OutputFilterRedact
+	case OutputFilterRedact, OutputFilterBlock:
+	default:
+		return agentFieldError("output_filter_action", fmt.Sprintf("invalid output filter action %q, expected redact or block", agent.OutputFilterAction))
+	}
+
+	if agent.InSandbox() {
+		return validateSandboxLimits(agent)
+	}
+	return nil
+}
+
+// agentConfigFields agent request fields of the pkg/agent configuration fields
+var agentConfigFields = map[string]string{
+	"base_url": "url",
+	"api_key":  "source_api_key",
+}
+
+// validateAgentTypeConfig run the pkg/agent validator of the agent's type on its upstream
+// configuration, so an agent the dataflow could not call is rejected when it is saved
+func validateAgentTypeConfig(agent *Agent) error {
+	// agents get their ID when they are created, new ones are validated under their name
+	id := agent.AgentID
+	if id == "" {
+		id = agent.Name
+	}
+
+	validator := agentpkg.NewConfigValidator()
+	var err error
+	switch agent.Type {
+	case types.AgentTypeOpenAI:
+		err = validator.ValidateOpenAIConfig(&agentpkg.OpenAIConfig{
+			AgentConfig: agentpkg.AgentConfig{ID: id, Name: agent.Name, Type: agentpkg.AgentTypeOpenAI},
+			BaseURL:     agent.URL,
+			APIKey:      agent.SourceAPIKey,
+		})
+	case types.AgentTypeDifyChat, types.AgentTypeDifyWorkflow:
+		appType := "chatbot"
+		if agent.Type == types.AgentTypeDifyWorkflow {
+			appType = "workflow"
+		}
+		// Dify resolves the app from its API key, the agent stands in for the app ID
+		err = validator.ValidateDifyConfig(&agentpkg.DifyConfig{
+			AgentConfig: agentpkg.AgentConfig{ID: id, Name: agent.Name, Type: agentpkg.AgentTypeDify},
+			BaseURL:     agent.URL,
+			APIKey:      agent.SourceAPIKey,
+			AppID:       id,
+			AppType:     appType,
+		})
+	}
+
+	var fieldErr *agentpkg.FieldError
+	if errors.As(err, &fieldErr) {
+		field, ok := agentConfigFields[fieldErr.Field]
+		if !ok {
+			field = fieldErr.Field
+		}
+		return agentFieldError(field, fieldErr.Message)
+	}
+	return err
+}
+
+// agentFieldError a rejected agent value, named by its request field
+func agentFieldError(field, message string) error {
+	return &agentpkg.FieldError{Field: field, Message: message}
+}
+
+// AgentQueueConfigService per-agent queue override service
+type AgentQueueConfigService struct{}
+
+// GetAgentQueueConfig get queue override of an agent
+func (s *AgentQueueConfigService) GetAgentQueueConfig(agentID string) (*AgentQueueConfig, error) {
+	var config AgentQueueConfig
+	err := DB.Where("agent_id = ?", agentID).First(&config).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("queue config not found")
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ListAgentQueueConfigs get all queue overrides
+func (s *AgentQueueConfigService) ListAgentQueueConfigs() ([]*AgentQueueConfig, error) {
+	var configs []*AgentQueueConfig
+	if err := DB.Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// SaveAgentQueueConfig create or replace queue override of an agent
+func (s *AgentQueueConfigService) SaveAgentQueueConfig(config *AgentQueueConfig) error {
+	if config.AgentID == "" {
+		return errors.New("agent ID is required")
+	}
+
+	if config.MaxQueueSize < 0 {
+		return errors.New("max queue size cannot be negative")
+	}
+
+	if config.DefaultTTL < 0 {
+		return errors.New("default TTL cannot be negative")
+	}
+
+	existing, err := s.GetAgentQueueConfig(config.AgentID)
+	if err != nil && err.Error() != "queue config not found" {
+		return err
+	}
+
+	if existing != nil {
+		config.ID = existing.ID
+		config.CreatedAt = existing.CreatedAt
+	}
+
+	return DB.Save(config).Error
+}
+
+// DeleteAgentQueueConfig delete queue override of an agent
+func (s *AgentQueueConfigService) DeleteAgentQueueConfig(agentID string) error {
+	result := DB.Where("agent_id = ?", agentID).Delete(&AgentQueueConfig{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("queue config not found")
 	}
 
 	return nil
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationMapping the Dify conversation a client session continues. Dify creates the
+// conversation ID on the first turn, so the dataflow API remembers it per agent, connector
+// key and session and sends it along with the following turns of the session.
+type ConversationMapping struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID        string    `json:"agent_id" gorm:"type:varchar(100);not null;uniqueIndex:idx_conversation_session,priority:3;comment:'agent id'"`
+	APIKeyHash     string    `json:"-" gorm:"type:varchar(64);not null;uniqueIndex:idx_conversation_session,priority:1;comment:'SHA-256 of the connector key'"`
+	SessionID      string    `json:"session_id" gorm:"type:varchar(128);not null;uniqueIndex:idx_conversation_session,priority:2;comment:'client session id'"`
+	User           string    `json:"user" gorm:"type:varchar(255);not null;default:'';comment:'Dify user owning the conversation'"`
+	ConversationID string    `json:"conversation_id" gorm:"type:varchar(100);not null;comment:'Dify conversation id'"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"index"`
+}
+
+// TableName specify table name
+func (ConversationMapping) TableName() string {
+	return "conversation_mappings"
+}
+
+// ConversationMappingService stores the Dify conversations of client sessions
+type ConversationMappingService struct{}
+
+// GetConversationID the conversation the session of the key continues on the agent for
+// user, empty when the session has none or it belongs to another user
+func (s *ConversationMappingService) GetConversationID(ctx context.Context, agentID, apiKey, sessionID, user string) (string, error) {
+	var mapping ConversationMapping
+	err := DB.WithContext(ctx).
+		Where("agent_id = ? AND api_key_hash = ? AND session_id = ?", agentID, HashConnectorAPIKey(apiKey), sessionID).
+		First(&mapping).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get conversation mapping: %v", err)
+	}
+	// Dify only continues conversations of the user that started them
+	if mapping.User != user {
+		return "", nil
+	}
+	return mapping.ConversationID, nil
+}
+
+// SaveConversationID remember the conversation of the session, replacing the one it
+// continued so far
+func (s *ConversationMappingService) SaveConversationID(ctx context.Context, agentID, apiKey, sessionID, user, conversationID string) error {
+	mapping := &ConversationMapping{
+		AgentID:        agentID,
+		APIKeyHash:     HashConnectorAPIKey(apiKey),
+		SessionID:      sessionID,
+		User:           user,
+		ConversationID: conversationID,
+	}
+	err := DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "agent_id"}, {Name: "api_key_hash"}, {Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user", "conversation_id", "updated_at"}),
+	}).Create(mapping).Error
+	if err != nil {
+		return fmt.Errorf("failed to save conversation mapping: %v", err)
+	}
+	return nil
+}
+
+// ListConversationMappings the conversations the session of the key continues, most
+// recently used first
+func (s *ConversationMappingService) ListConversationMappings(ctx context.Context, apiKey, sessionID string) ([]*ConversationMapping, error) {
+	var mappings []*ConversationMapping
+	err := DB.WithContext(ctx).
+		Where("api_key_hash = ? AND session_id = ?", HashConnectorAPIKey(apiKey), sessionID).
+		Order("updated_at DESC").
+		Find(&mappings).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation mappings: %v", err)
+	}
+	return mappings, nil
+}
+
+// DeleteConversationMappings forget the conversations of the session of the key on all
+// agents, so the next turn starts a new conversation
+func (s *ConversationMappingService) DeleteConversationMappings(ctx context.Context, apiKey, sessionID string) (int64, error) {
+	result := DB.WithContext(ctx).
+		Where("api_key_hash = ? AND session_id = ?", HashConnectorAPIKey(apiKey), sessionID).
+		Delete(&ConversationMapping{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete conversation mappings: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteConversationMapping forget the conversation of the session on the agent
+func (s *ConversationMappingService) DeleteConversationMapping(ctx context.Context, agentID, apiKey, sessionID string) error {
+	err := DB.WithContext(ctx).
+		Where("agent_id = ? AND api_key_hash = ? AND session_id = ?", agentID, HashConnectorAPIKey(apiKey), sessionID).
+		Delete(&ConversationMapping{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation mapping: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationTitle the title the gateway gave a client session after its first exchange,
+// whatever the agent. Sessions are named per connector key with X-Session-ID. The title is
+// stored encrypted with the agent's content key when content encryption is configured.
+type ConversationTitle struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	APIKeyHash   string    `json:"-" gorm:"type:varchar(64);not null;uniqueIndex:idx_conversation_title_session,priority:1;comment:'SHA-256 of the connector key'"`
+	SessionID    string    `json:"session_id" gorm:"type:varchar(128);not null;uniqueIndex:idx_conversation_title_session,priority:2;comment:'client session id'"`
+	AgentID      string    `json:"agent_id" gorm:"type:varchar(100);not null;index;comment:'agent of the titled exchange'"`
+	Title        string    `json:"title" gorm:"type:varchar(1024);not null;comment:'title of the conversation, sealed when key_id is set'"`
+	KeyID        uint      `json:"-" gorm:"not null;default:0;comment:'content key the title is encrypted with, 0 for plaintext'"`
+	TitleAgentID string    `json:"title_agent_id" gorm:"type:varchar(100);not null;default:'';comment:'agent that wrote the title'"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName specify table name
+func (ConversationTitle) TableName() string {
+	return "conversation_titles"
+}
+
+// ConversationTitleService stores the titles of client sessions
+type ConversationTitleService struct{}
+
+// GetConversationTitle the title of the session of the key, nil when it has none yet
+func (s *ConversationTitleService) GetConversationTitle(ctx context.Context, apiKey, sessionID string) (*ConversationTitle, error) {
+	var title ConversationTitle
+	err := DB.WithContext(ctx).
+		Where("api_key_hash = ? AND session_id = ?", HashConnectorAPIKey(apiKey), sessionID).
+		First(&title).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get conversation title: %v", err)
+	}
+	if title.KeyID != 0 {
+		if contentKeyring == nil {
+			return nil, ErrContentEncryptionDisabled
+		}
+		text, err := contentKeyring.openText(title.KeyID, title.Title, titleContext(title.AgentID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt conversation title: %v", err)
+		}
+		title.Title, title.KeyID = text, 0
+	}
+	return &title, nil
+}
+
+// titleContext authenticated data binding a title to its agent, distinct from usage content
+func titleContext(agentID string) string {
+	return "conversation-title:" + agentID
+}
+
+// SaveConversationTitle store the title of the session of the key, a session keeps the
+// first title it was given
+func (s *ConversationTitleService) SaveConversationTitle(ctx context.Context, apiKey string, title *ConversationTitle) error {
+	title.APIKeyHash = HashConnectorAPIKey(apiKey)
+	if contentKeyring != nil && title.KeyID == 0 {
+		sealed, keyID, err := contentKeyring.sealText(title.AgentID, title.Title, titleContext(title.AgentID))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt conversation title: %v", err)
+		}
+		title.Title, title.KeyID = sealed, keyID
+	}
+	err := DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(title).Error
+	if err != nil {
+		return fmt.Errorf("failed to save conversation title: %v", err)
+	}
+	return nil
+}
+
+// DeleteConversationTitle forget the title of the session of the key, the next exchange
+// titles it again
+func (s *ConversationTitleService) DeleteConversationTitle(ctx context.Context, apiKey, sessionID string) (int64, error) {
+	result := DB.WithContext(ctx).
+		Where("api_key_hash = ? AND session_id = ?", HashConnectorAPIKey(apiKey), sessionID).
+		Delete(&ConversationTitle{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete conversation title: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -24,12 +24,15 @@ func InitDB(dsn string) error {
 	return nil
 }
 
-// InitDatabase initialize database connection
+// InitDatabase initialize database connection with the global config, loaded when unset
 func InitDatabase() error {
 	// load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+	cfg := config.GlobalConfig
+	var err error
+	if cfg == nil {
+		if cfg, err = config.Load(); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
 	}
 
 	// print configuration information
@@ -63,19 +66,52 @@ func InitDatabase() error {
 	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
 	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
 
+	if err := initReadReplica(cfg, logLevel); err != nil {
+		return err
+	}
+
 	// automatically migrate table structures
 	err = DB.AutoMigrate(
 		&User{},
 		&UserSession{},
 		&UserLoginLog{},
+		&LoginChallenge{},
+		&ImpersonationLog{},
+		&UserSettings{},
 		&SystemConfig{},
 		&Agent{},
+		&AgentQueueConfig{},
+		&PlaygroundToken{},
+		&NotificationChannel{},
+		&NotificationRecipient{},
+		&MaintenanceWindow{},
+		&KeyTier{},
+		&QuotaPool{},
+		&GoldenPrompt{},
+		&GoldenRun{},
+		&GoldenResult{},
+		&UsageRecord{},
+		&UsageRecordTag{},
+		&UsageRecordContent{},
+		&UsageRecordScore{},
+		&UsageForecast{},
+		&ContentKey{},
+		&OutboxEvent{},
+		&ConversationMapping{},
+		&ConversationTitle{},
+		&ProviderStatus{},
+		&JobRun{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// hash connector API keys stored in plaintext by older versions
+	if err := migrateConnectorAPIKeys(); err != nil {
+		return fmt.Errorf("failed to migrate connector API keys: %w", err)
+	}
+
 	// initialize default system configuration
 	if err := initDefaultSystemConfig(); err != nil {
 		log.Printf("Warning: failed to init default system config: %v", err)
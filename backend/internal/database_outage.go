@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"agent-connector/config"
+)
+
+// databaseOutageCheckInterval how often the primary is pinged while it is unreachable
+const databaseOutageCheckInterval = 5 * time.Second
+
+// ErrUsageDeferred the usage record is held in memory until the database is back
+var ErrUsageDeferred = errors.New("database is unreachable, usage record deferred")
+
+// databaseDown whether the primary is considered unreachable
+var databaseDown atomic.Bool
+
+// databaseOutage the current outage of the primary and the usage records held for it
+var databaseOutage struct {
+	sync.Mutex
+	since     time.Time
+	lastError string
+	pending   []*UsageRecord
+	dropped   int
+}
+
+// DatabaseDown whether the primary database is currently considered unreachable
+func DatabaseDown() bool {
+	return databaseDown.Load()
+}
+
+// DatabaseStatus the database part of the dataflow health check
+func DatabaseStatus() map[string]interface{} {
+	if !databaseDown.Load() {
+		return map[string]interface{}{"status": "ok"}
+	}
+	databaseOutage.Lock()
+	defer databaseOutage.Unlock()
+	return map[string]interface{}{
+		"status":         "degraded",
+		"degraded_since": databaseOutage.since,
+		"last_error":     databaseOutage.lastError,
+		"pending_usage":  len(databaseOutage.pending),
+		"dropped_usage":  databaseOutage.dropped,
+	}
+}
+
+// databaseFailed whether err of a query is due to the primary being unreachable rather
+// than the query itself, confirmed with a ping; starts the outage when it is
+func databaseFailed(err error) bool {
+	if err == nil || DB == nil {
+		return false
+	}
+	if databaseDown.Load() {
+		return true
+	}
+	if pingPrimary() == nil {
+		return false
+	}
+	startDatabaseOutage(err)
+	return true
+}
+
+// startDatabaseOutage mark the primary as down and ping it until it is back
+func startDatabaseOutage(err error) {
+	if !databaseDown.CompareAndSwap(false, true) {
+		return
+	}
+	databaseOutage.Lock()
+	databaseOutage.since = time.Now()
+	databaseOutage.lastError = err.Error()
+	databaseOutage.Unlock()
+	log.Printf("Database is unreachable, serving cached lookups and deferring usage records: %v", err)
+
+	go func() {
+		ticker := time.NewTicker(databaseOutageCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := pingPrimary(); err != nil {
+				databaseOutage.Lock()
+				databaseOutage.lastError = err.Error()
+				databaseOutage.Unlock()
+				continue
+			}
+			endDatabaseOutage()
+			return
+		}
+	}()
+}
+
+// endDatabaseOutage mark the primary as reachable and write the deferred usage records
+func endDatabaseOutage() {
+	databaseOutage.Lock()
+	since, dropped := databaseOutage.since, databaseOutage.dropped
+	databaseOutage.dropped = 0
+	databaseOutage.Unlock()
+	databaseDown.Store(false)
+	log.Printf("Database is reachable again after %s", time.Since(since).Round(time.Second))
+	if dropped > 0 {
+		log.Printf("Dropped %d usage records during the database outage, the outage buffer was full", dropped)
+	}
+
+	flushDeferredUsage()
+}
+
+// pingPrimary check the primary connection
+func pingPrimary() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// deferUsage hold a usage record until the database is back, up to usage.outage_buffer
+func deferUsage(record *UsageRecord) error {
+	limit := 0
+	if config.GlobalConfig != nil {
+		limit = config.GlobalConfig.Usage.OutageBuffer
+	}
+
+	databaseOutage.Lock()
+	defer databaseOutage.Unlock()
+	if len(databaseOutage.pending) >= limit {
+		databaseOutage.dropped++
+		return errors.New("database is unreachable and the usage outage buffer is full")
+	}
+	databaseOutage.pending = append(databaseOutage.pending, record)
+	return ErrUsageDeferred
+}
+
+// flushDeferredUsage write the usage records held during the outage in their order; if
+// the database goes away again the rest is held for the next recovery
+func flushDeferredUsage() {
+	databaseOutage.Lock()
+	pending := databaseOutage.pending
+	databaseOutage.pending = nil
+	databaseOutage.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	written := 0
+	for i, record := range pending {
+		err := DB.Create(record).Error
+		if err == nil {
+			written++
+			continue
+		}
+		if databaseFailed(err) {
+			databaseOutage.Lock()
+			databaseOutage.pending = append(pending[i:], databaseOutage.pending...)
+			databaseOutage.Unlock()
+			break
+		}
+		log.Printf("Dropping deferred usage record of agent %s: %v", record.AgentID, err)
+	}
+	log.Printf("Wrote %d of %d usage records deferred during the database outage", written, len(pending))
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"errors"
+
+	"agent-connector/pkg/textlimit"
+)
+
+// maxScoreReasonLength size of the reason column of usage_record_scores
+const maxScoreReasonLength = 500
+
+// UsageQualityPoint average judge score of an agent's responses on one rubric and day
+type UsageQualityPoint struct {
+	AgentID  string  `json:"agent_id"`
+	Day      string  `json:"day"` // YYYY-MM-DD of the request
+	Rubric   string  `json:"rubric"`
+	Samples  int64   `json:"samples"`
+	AvgScore float64 `json:"avg_score"`
+	MinScore float64 `json:"min_score"`
+}
+
+// RecordScores store the judge's scores of a sampled response
+func (s *UsageService) RecordScores(scores []*UsageRecordScore) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+	for _, score := range scores {
+		score.Reason, _ = textlimit.TruncateBytes(score.Reason, maxScoreReasonLength)
+	}
+	return currentUsageStore().InsertScores(context.Background(), scores)
+}
+
+// QualityTrend average scores per agent, day and rubric of the requests the filter
+// selects, the days of each agent in order
+func (s *UsageService) QualityTrend(filter *UsageFilter) ([]*UsageQualityPoint, error) {
+	return currentUsageStore().QualityTrend(context.Background(), filter)
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/events"
+
+	"gorm.io/gorm"
+)
+
+// InitEventPublisher create the publisher configured in the global config and install
+// it as the default, source names the running service in every event
+func InitEventPublisher(source string) (events.Publisher, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	eventsConfig := events.DefaultConfig()
+	eventsConfig.Broker = events.BrokerType(cfg.Events.Broker)
+	eventsConfig.Stream = cfg.Events.Stream
+	eventsConfig.MaxLen = cfg.Events.MaxLen
+	eventsConfig.BufferSize = cfg.Events.BufferSize
+	eventsConfig.Redis = &events.RedisConfig{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	}
+
+	publisher, err := events.NewPublisher(eventsConfig)
+	if err != nil {
+		return nil, err
+	}
+	outbox := publisher
+
+	// notifications are delivered from every process, independently of the broker
+	if cfg.Events.Notifications && DB != nil {
+		notifications := NewNotificationDispatcher()
+		outbox = events.NewFanoutPublisher(publisher, notifications)
+		publisher = events.NewFanoutPublisher(publisher, events.NewAsyncPublisher(notifications, eventsConfig.BufferSize, 30*time.Second))
+	}
+
+	events.SetDefault(publisher, source)
+	eventSource, outboxPublisher = source, outbox
+	return publisher, nil
+}
+
+// enqueueAgentKeyCreated announce a new connector API key once tx commits, only the prefix is included
+func enqueueAgentKeyCreated(tx *gorm.DB, agent *Agent, reason string) error {
+	return enqueueEvent(tx, newEvent(events.TypeKeyCreated, agent.AgentID, map[string]interface{}{
+		"kind":       "connector_api_key",
+		"reason":     reason,
+		"agent_id":   agent.AgentID,
+		"agent_name": agent.Name,
+		"key_prefix": agent.ConnectorKeyPrefix,
+	}))
+}
+
+// enqueuePlaygroundTokenCreated announce a new playground token once tx commits, only the prefix is included
+func enqueuePlaygroundTokenCreated(tx *gorm.DB, token *PlaygroundToken) error {
+	return enqueueEvent(tx, newEvent(events.TypeKeyCreated, token.AgentID, map[string]interface{}{
+		"kind":       "playground_token",
+		"reason":     "issued",
+		"token_id":   strconv.FormatUint(uint64(token.ID), 10),
+		"agent_id":   token.AgentID,
+		"key_prefix": token.TokenPrefix,
+		"qps":        token.QPS,
+		"expires_at": token.ExpiresAt,
+	}))
+}
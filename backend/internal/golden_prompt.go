@@ -0,0 +1,387 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/textlimit"
+	"agent-connector/pkg/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Golden run triggers
+const (
+	GoldenTriggerManual      = "manual"       // started through the API
+	GoldenTriggerAgentUpdate = "agent_update" // started by a change of the agent's configuration
+)
+
+// Golden run statuses
+const (
+	GoldenRunRunning   = "running"
+	GoldenRunPassed    = "passed"
+	GoldenRunRegressed = "regressed" // at least one answer drifted from its reference
+	GoldenRunFailed    = "failed"    // no regression, but the agent failed to answer some prompts
+)
+
+// defaultGoldenMinSimilarity minimum similarity of prompts that do not set one
+const defaultGoldenMinSimilarity = 0.8
+
+// goldenErrorLength bytes of an upstream error kept with a result
+const goldenErrorLength = 500
+
+// GoldenRunTimeout bounds a run; a run still marked running after it was abandoned
+// by a crashed process and no longer blocks new runs
+const GoldenRunTimeout = 15 * time.Minute
+
+var (
+	// ErrNoGoldenPrompts the agent has no enabled golden prompts to run
+	ErrNoGoldenPrompts = errors.New("agent has no enabled golden prompts")
+	// ErrGoldenRunInProgress a run of the agent's golden prompts is not finished yet
+	ErrGoldenRunInProgress = errors.New("a golden run of the agent is already in progress")
+)
+
+// GoldenPromptService golden prompt and run service
+type GoldenPromptService struct{}
+
+// goldenPromptListSpec searchable, filterable and sortable columns of the golden prompt list
+var goldenPromptListSpec = listQuerySpec{
+	searchColumns: []string{"name", "prompt"},
+	sortColumns: map[string]string{
+		"name":       "name",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	defaultSort: "created_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch status {
+		case "enabled":
+			return db.Where("enabled = ?", true), nil
+		case "disabled":
+			return db.Where("enabled = ?", false), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
+// goldenRunListSpec filterable and sortable columns of the golden run list
+var goldenRunListSpec = listQuerySpec{
+	typeColumn: "triggered_by",
+	sortColumns: map[string]string{
+		"started_at": "started_at",
+		"regressed":  "regressed",
+	},
+	defaultSort: "started_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch status {
+		case GoldenRunRunning, GoldenRunPassed, GoldenRunRegressed, GoldenRunFailed:
+			return db.Where("status = ?", status), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
+// CreateGoldenPrompt create golden prompt
+func (s *GoldenPromptService) CreateGoldenPrompt(prompt *GoldenPrompt) error {
+	if err := s.validateGoldenPrompt(prompt); err != nil {
+		return err
+	}
+	// select every column, a disabled prompt is a zero value gorm would replace with
+	// the column default
+	return DB.Select("*").Create(prompt).Error
+}
+
+// GetGoldenPrompt get golden prompt
+func (s *GoldenPromptService) GetGoldenPrompt(id uint) (*GoldenPrompt, error) {
+	var prompt GoldenPrompt
+	err := DB.First(&prompt, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("golden prompt not found")
+		}
+		return nil, err
+	}
+	return &prompt, nil
+}
+
+// ListGoldenPrompts get golden prompt list, of one agent when agentID is set
+func (s *GoldenPromptService) ListGoldenPrompts(agentID string, listQuery *ListQuery) ([]*GoldenPrompt, int64, error) {
+	var prompts []*GoldenPrompt
+	var total int64
+
+	query := DB.Model(&GoldenPrompt{})
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	query, err := listQuery.filter(query, goldenPromptListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, goldenPromptListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&prompts).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return prompts, total, nil
+}
+
+// UpdateGoldenPrompt update golden prompt, e.g. to approve a new reference answer
+func (s *GoldenPromptService) UpdateGoldenPrompt(id uint, prompt *GoldenPrompt) error {
+	existing, err := s.GetGoldenPrompt(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateGoldenPrompt(prompt); err != nil {
+		return err
+	}
+
+	prompt.ID = id
+	prompt.CreatedAt = existing.CreatedAt
+	return DB.Save(prompt).Error
+}
+
+// DeleteGoldenPrompt delete golden prompt, the results of past runs are kept
+func (s *GoldenPromptService) DeleteGoldenPrompt(id uint) error {
+	result := DB.Delete(&GoldenPrompt{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("golden prompt not found")
+	}
+
+	return nil
+}
+
+// StartGoldenRun record a new run of the enabled golden prompts of the agent and return
+// them; fails while another run of the agent is in progress
+func (s *GoldenPromptService) StartGoldenRun(agentID, trigger string) (*GoldenRun, []*GoldenPrompt, error) {
+	agentService := &AgentService{}
+	if _, err := agentService.GetAgentByAgentID(agentID); err != nil {
+		return nil, nil, fmt.Errorf("invalid agent_id: %w", err)
+	}
+
+	var prompts []*GoldenPrompt
+	if err := DB.Where("agent_id = ? AND enabled = ?", agentID, true).Order("id").Find(&prompts).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(prompts) == 0 {
+		return nil, nil, ErrNoGoldenPrompts
+	}
+
+	run := &GoldenRun{
+		AgentID:   agentID,
+		Trigger:   trigger,
+		Status:    GoldenRunRunning,
+		Total:     len(prompts),
+		StartedAt: time.Now(),
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// lock the agent so two processes do not both start a run
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("agent_id = ?", agentID).First(&Agent{}).Error; err != nil {
+			return err
+		}
+
+		var running int64
+		err := tx.Model(&GoldenRun{}).
+			Where("agent_id = ? AND status = ? AND started_at > ?", agentID, GoldenRunRunning, run.StartedAt.Add(-GoldenRunTimeout)).
+			Count(&running).Error
+		if err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrGoldenRunInProgress
+		}
+		return tx.Create(run).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return run, prompts, nil
+}
+
+// FinishGoldenRun store the results of a run and its outcome; a run with regressions
+// announces them once stored
+func (s *GoldenPromptService) FinishGoldenRun(run *GoldenRun, results []*GoldenResult) error {
+	run.Passed, run.Regressed, run.Errored = 0, 0, 0
+	for _, result := range results {
+		result.RunID = run.ID
+		result.Error, _ = textlimit.TruncateBytes(result.Error, goldenErrorLength)
+		switch {
+		case result.Error != "":
+			run.Errored++
+		case result.Passed:
+			run.Passed++
+		default:
+			run.Regressed++
+		}
+	}
+
+	switch {
+	case run.Regressed > 0:
+		run.Status = GoldenRunRegressed
+	case run.Errored > 0:
+		run.Status = GoldenRunFailed
+	default:
+		run.Status = GoldenRunPassed
+	}
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if len(results) > 0 {
+			if err := tx.Create(results).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(run).Updates(map[string]interface{}{
+			"status":      run.Status,
+			"passed":      run.Passed,
+			"regressed":   run.Regressed,
+			"errored":     run.Errored,
+			"finished_at": run.FinishedAt,
+		}).Error; err != nil {
+			return err
+		}
+		if run.Regressed == 0 {
+			return nil
+		}
+		return enqueueGoldenRegression(tx, run, results)
+	})
+}
+
+// enqueueGoldenRegression announce the regressions of a run once tx commits
+func enqueueGoldenRegression(tx *gorm.DB, run *GoldenRun, results []*GoldenResult) error {
+	var prompts []string
+	for _, result := range results {
+		if result.Error == "" && !result.Passed {
+			prompts = append(prompts, result.PromptName)
+		}
+	}
+	return enqueueEvent(tx, newEvent(events.TypeAgentGoldenRegression, run.AgentID, map[string]interface{}{
+		"agent_id":  run.AgentID,
+		"run_id":    run.ID,
+		"trigger":   run.Trigger,
+		"total":     run.Total,
+		"regressed": run.Regressed,
+		"prompts":   strings.Join(prompts, ", "),
+	}))
+}
+
+// GetGoldenRun get golden run with its results
+func (s *GoldenPromptService) GetGoldenRun(id uint) (*GoldenRun, error) {
+	var run GoldenRun
+	err := DB.Preload("Results", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&run, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("golden run not found")
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListGoldenRuns get golden run list without results, of one agent when agentID is set
+func (s *GoldenPromptService) ListGoldenRuns(agentID string, listQuery *ListQuery) ([]*GoldenRun, int64, error) {
+	var runs []*GoldenRun
+	var total int64
+
+	query := DB.Model(&GoldenRun{})
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	query, err := listQuery.filter(query, goldenRunListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, goldenRunListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&runs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return runs, total, nil
+}
+
+// HasGoldenPrompts report whether the agent has enabled golden prompts
+func (s *GoldenPromptService) HasGoldenPrompts(agentID string) (bool, error) {
+	var count int64
+	err := DB.Model(&GoldenPrompt{}).Where("agent_id = ? AND enabled = ?", agentID, true).Count(&count).Error
+	return count > 0, err
+}
+
+// validateGoldenPrompt validate golden prompt
+func (s *GoldenPromptService) validateGoldenPrompt(prompt *GoldenPrompt) error {
+	prompt.Name = strings.TrimSpace(prompt.Name)
+	if prompt.Name == "" {
+		return errors.New("golden prompt name cannot be empty")
+	}
+	if strings.TrimSpace(prompt.Prompt) == "" {
+		return errors.New("golden prompt cannot be empty")
+	}
+	if strings.TrimSpace(prompt.Reference) == "" {
+		return errors.New("golden prompt reference answer cannot be empty")
+	}
+
+	if prompt.MinSimilarity == 0 {
+		prompt.MinSimilarity = defaultGoldenMinSimilarity
+	}
+	if prompt.MinSimilarity < 0 || prompt.MinSimilarity > 1 {
+		return errors.New("golden prompt min_similarity must be between 0 and 1")
+	}
+
+	prompt.AgentID = strings.TrimSpace(prompt.AgentID)
+	agentService := &AgentService{}
+	agent, err := agentService.GetAgentByAgentID(prompt.AgentID)
+	if err != nil {
+		return fmt.Errorf("invalid agent_id: %w", err)
+	}
+
+	// workflows take their inputs as the prompt, chat apps may add inputs
+	var object map[string]interface{}
+	if agent.Type == types.AgentTypeDifyWorkflow {
+		if err := json.Unmarshal([]byte(prompt.Prompt), &object); err != nil {
+			return errors.New("golden prompt of a workflow agent must be a JSON object of the workflow inputs")
+		}
+	}
+	if prompt.Inputs != "" {
+		if agent.Type != types.AgentTypeDifyChat {
+			return errors.New("golden prompt inputs are only supported for dify-chat agents")
+		}
+		if err := json.Unmarshal([]byte(prompt.Inputs), &object); err != nil {
+			return errors.New("golden prompt inputs must be a JSON object")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/notify"
+	"agent-connector/pkg/textlimit"
+
+	"gorm.io/gorm"
+)
+
+// defaultImpersonationTTL lifetime of impersonation sessions when none is configured
+const defaultImpersonationTTL = 15 * time.Minute
+
+var (
+	// ErrImpersonationNotAllowed the user's role may not impersonate
+	ErrImpersonationNotAllowed = errors.New("impersonation requires the admin role")
+
+	// ErrImpersonationTarget the user cannot be impersonated
+	ErrImpersonationTarget = errors.New("user cannot be impersonated")
+)
+
+// CreateImpersonationSession issue a short-lived session that lets the admin act as
+// the user, record it in the user's login log and notify the user
+func (s *UserService) CreateImpersonationSession(impersonator *User, userID uint, reason, ip string) (*UserSession, error) {
+	if !impersonator.CanImpersonate() {
+		return nil, ErrImpersonationNotAllowed
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("impersonation reason cannot be empty")
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case user.ID == impersonator.ID:
+		return nil, fmt.Errorf("%w: you cannot impersonate yourself", ErrImpersonationTarget)
+	case user.Role == UserRoleAdmin:
+		return nil, fmt.Errorf("%w: admins cannot be impersonated", ErrImpersonationTarget)
+	case !user.IsActive():
+		return nil, fmt.Errorf("%w: user account is not active", ErrImpersonationTarget)
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	session := &UserSession{
+		UserID:              user.ID,
+		Token:               token,
+		ExpiresAt:           time.Now().Add(impersonationTTL()),
+		ImpersonatorID:      &impersonator.ID,
+		ImpersonationReason: reason,
+	}
+	var event events.Event
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return fmt.Errorf("failed to create session: %v", err)
+		}
+		session.User = *user
+		session.Impersonator = impersonator
+
+		event = impersonationEvent(session)
+		return enqueueEvent(tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.LogImpersonation(session, "started", "", "", 0, ip)
+	message, _ := textlimit.TruncateBytes(fmt.Sprintf("Impersonation session issued to admin %s: %s", impersonator.Username, reason), 255)
+	s.LogUserLogin(user.ID, ip, "", true, message)
+	mailSecurityNotice(user, event)
+
+	return session, nil
+}
+
+// LogImpersonation record an action taken with an impersonation session
+func (s *UserService) LogImpersonation(session *UserSession, action, method, path string, status int, ip string) {
+	if !session.IsImpersonated() {
+		return
+	}
+
+	path, _ = textlimit.TruncateBytes(path, 255)
+	entry := &ImpersonationLog{
+		SessionID:      session.ID,
+		ImpersonatorID: *session.ImpersonatorID,
+		UserID:         session.UserID,
+		Action:         action,
+		Method:         method,
+		Path:           path,
+		Status:         status,
+		IP:             ip,
+		Reason:         session.ImpersonationReason,
+	}
+	if err := DB.Create(entry).Error; err != nil {
+		log.Printf("Failed to log impersonated %s of user %d by %d: %v", action, session.UserID, *session.ImpersonatorID, err)
+	}
+}
+
+// GetImpersonationLogs get the impersonation audit log of a user
+func (s *UserService) GetImpersonationLogs(userID uint, page, pageSize int) ([]*ImpersonationLog, int64, error) {
+	var logs []*ImpersonationLog
+	var total int64
+
+	err := withReadReplica(func(db *gorm.DB) error {
+		logs, total = nil, 0
+		query := db.Model(&ImpersonationLog{}).Where("user_id = ?", userID)
+
+		if err := query.Count(&total).Error; err != nil {
+			return fmt.Errorf("failed to count impersonation logs: %v", err)
+		}
+
+		offset := (page - 1) * pageSize
+		if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&logs).Error; err != nil {
+			return fmt.Errorf("failed to list impersonation logs: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
+
+// impersonationTTL lifetime of impersonation sessions, from the live system config or
+// the configuration file
+func impersonationTTL() time.Duration {
+	if minutes := CurrentSystemConfig().ImpersonationTTLMinutes; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	if config.GlobalConfig != nil && config.GlobalConfig.Security.ImpersonationTTL > 0 {
+		return config.GlobalConfig.Security.ImpersonationTTL
+	}
+	return defaultImpersonationTTL
+}
+
+// impersonationEvent the user.impersonated event of a new impersonation session
+func impersonationEvent(session *UserSession) events.Event {
+	return newEvent(events.TypeUserImpersonated, session.User.Username, map[string]interface{}{
+		"user_id":         session.UserID,
+		"username":        session.User.Username,
+		"impersonator_id": *session.ImpersonatorID,
+		"impersonator":    session.Impersonator.Username,
+		"reason":          session.ImpersonationReason,
+		"expires_at":      session.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// mailSecurityNotice mail a security event to the user when SMTP is configured and the
+// user did not opt out, the event itself is published through the outbox
+func mailSecurityNotice(user *User, event events.Event) {
+	if user.Email == "" {
+		return
+	}
+	if settings, err := NewUserService().GetUserSettings(user.ID); err == nil && !settings.EmailSecurityNotices {
+		return
+	}
+	sender, err := newEmailSender()
+	if err != nil {
+		return
+	}
+	email, err := notify.RenderEmail(notify.MessageFromEvent(event))
+	if err != nil {
+		log.Printf("Failed to render %s notice for user %d: %v", event.Type, user.ID, err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := sender.Send(ctx, user.Email, email); err != nil {
+			log.Printf("Failed to mail %s notice to user %d: %v", event.Type, user.ID, err)
+		}
+	}()
+}
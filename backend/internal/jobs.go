@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/jobs"
+)
+
+// Job names
+const (
+	JobUsageForecast  = "usage-forecast"
+	JobReencryption   = "usage-reencryption"
+	JobSessionCleanup = "session-cleanup"
+	JobRunPurge       = "job-run-purge"
+	JobAgentSelfTest  = "agent-selftest"
+	JobSandboxCleanup = "sandbox-cleanup"
+	JobProviderStatus = "provider-status"
+)
+
+// defaultJobRetention how long job runs are kept without a configured retention
+const defaultJobRetention = 30 * 24 * time.Hour
+
+// Jobs the background jobs of this service, nil until InitJobs
+var Jobs *jobs.Scheduler
+
+// JobRun a finished run of a background job of one of the services
+type JobRun struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Service    string    `json:"service" gorm:"type:varchar(50);not null;index:idx_job_runs_job,priority:1;comment:'service running the job'"`
+	Job        string    `json:"job" gorm:"type:varchar(100);not null;index:idx_job_runs_job,priority:2;comment:'job name'"`
+	Trigger    string    `json:"trigger" gorm:"type:varchar(20);not null;comment:'schedule or manual'"`
+	StartedAt  time.Time `json:"started_at" gorm:"not null;index"`
+	FinishedAt time.Time `json:"finished_at" gorm:"not null"`
+	DurationMs int64     `json:"duration_ms" gorm:"not null;default:0"`
+	Result     string    `json:"result" gorm:"type:text;comment:'summary of what the run did'"`
+	Error      string    `json:"error" gorm:"type:text;comment:'error of a failed run'"`
+}
+
+// TableName specify table name
+func (JobRun) TableName() string {
+	return "job_runs"
+}
+
+// jobRunRecorder stores the runs of a service's jobs
+type jobRunRecorder struct {
+	service string
+}
+
+// RecordRun implements jobs.Recorder
+func (r *jobRunRecorder) RecordRun(run *jobs.Run) error {
+	return DB.Create(&JobRun{
+		Service:    r.service,
+		Job:        run.Job,
+		Trigger:    run.Trigger,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		DurationMs: run.Duration.Milliseconds(),
+		Result:     run.Result,
+		Error:      run.Error,
+	}).Error
+}
+
+// InitJobs create the job scheduler of the service, its runs are stored under the
+// service name. The jobs start with Jobs.Start once they are registered.
+func InitJobs(service string) *jobs.Scheduler {
+	history := 0
+	if cfg := config.GlobalConfig; cfg != nil {
+		history = cfg.Jobs.History
+	}
+	Jobs = jobs.NewScheduler(&jobRunRecorder{service: service}, history)
+	return Jobs
+}
+
+// RegisterJob register a job with the scheduler of the service, spec is a schedule as
+// accepted by jobs.ParseSchedule, empty registers the job for manual runs only
+func RegisterJob(scheduler *jobs.Scheduler, name, description, spec string, run jobs.Func) error {
+	job, err := newJob(name, description, spec, run)
+	if err != nil {
+		return err
+	}
+	return scheduler.Register(job)
+}
+
+// newJob a job on the schedule of spec
+func newJob(name, description, spec string, run jobs.Func) (jobs.Job, error) {
+	job := jobs.Job{Name: name, Description: description, Run: run}
+	if spec != "" {
+		schedule, err := jobs.ParseSchedule(spec)
+		if err != nil {
+			return job, fmt.Errorf("job %s: %w", name, err)
+		}
+		job.Schedule = schedule
+	}
+	return job, nil
+}
+
+// intervalSchedule the schedule of a job configured with an interval, 0 runs it on
+// manual trigger only
+func intervalSchedule(interval time.Duration) string {
+	if interval <= 0 {
+		return ""
+	}
+	return "@every " + interval.String()
+}
+
+// ListJobRuns the stored runs, newest first, optionally of one service and job
+func ListJobRuns(service, job string, limit int) ([]JobRun, error) {
+	query := DB.Model(&JobRun{}).Order("started_at DESC").Limit(limit)
+	if service != "" {
+		query = query.Where("service = ?", service)
+	}
+	if job != "" {
+		query = query.Where("job = ?", job)
+	}
+	var runs []JobRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list job runs: %v", err)
+	}
+	return runs, nil
+}
+
+// RegisterUsageForecastJob refit the usage forecasts every interval
+func RegisterUsageForecastJob(scheduler *jobs.Scheduler, interval time.Duration) error {
+	service := &UsageService{}
+	job, err := newJob(JobUsageForecast, "Refit the per-agent usage forecasts", intervalSchedule(interval),
+		func(ctx context.Context) (string, error) {
+			forecasts, err := service.RefreshUsageForecasts(ctx)
+			if err != nil {
+				return "", err
+			}
+			for _, result := range forecasts {
+				if result.DaysUntilBudgetExhausted != nil {
+					log.Printf("Agent %s is projected to use up its monthly budget in %d days", result.AgentID, *result.DaysUntilBudgetExhausted)
+				}
+			}
+			return fmt.Sprintf("%d agents forecast", len(forecasts)), nil
+		})
+	if err != nil {
+		return err
+	}
+	// forecasts are there from the start instead of after the first interval
+	job.RunAtStart = true
+	return scheduler.Register(job)
+}
+
+// RegisterReencryptionJob move usage content to the current keys every interval
+func RegisterReencryptionJob(scheduler *jobs.Scheduler, keyring *ContentKeyring, interval time.Duration) error {
+	return RegisterJob(scheduler, JobReencryption, "Re-encrypt usage content with the current keys", intervalSchedule(interval),
+		func(ctx context.Context) (string, error) {
+			result, err := keyring.Reencrypt(ctx)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d keys rewrapped, %d contents re-encrypted, %d failed, %d keys deleted",
+				result.RewrappedKeys, result.ReencryptedContents, result.FailedContents, result.DeletedKeys), nil
+		})
+}
+
+// RegisterSessionCleanupJob purge expired user sessions on schedule
+func RegisterSessionCleanupJob(scheduler *jobs.Scheduler, schedule string) error {
+	service := NewUserService()
+	return RegisterJob(scheduler, JobSessionCleanup, "Delete expired user sessions", schedule,
+		func(ctx context.Context) (string, error) {
+			return "", service.CleanExpiredSessions()
+		})
+}
+
+// RegisterSandboxCleanupJob delete expired sandbox agents on schedule
+func RegisterSandboxCleanupJob(scheduler *jobs.Scheduler, schedule string) error {
+	service := &SandboxService{}
+	return RegisterJob(scheduler, JobSandboxCleanup, "Delete expired sandbox agents", schedule,
+		func(ctx context.Context) (string, error) {
+			deleted, err := service.PurgeExpiredSandboxAgents(ctx)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d sandbox agents deleted", deleted), nil
+		})
+}
+
+// RegisterProviderStatusJob poll the status pages of the upstream providers on schedule
+func RegisterProviderStatusJob(scheduler *jobs.Scheduler, schedule string) error {
+	service := NewProviderStatusService()
+	return RegisterJob(scheduler, JobProviderStatus, "Poll the status pages of the upstream providers", schedule,
+		func(ctx context.Context) (string, error) {
+			incidents, err := service.PollProviderStatuses(ctx)
+			if len(incidents) > 0 {
+				log.Printf("Providers reporting incidents: %s", strings.Join(incidents, ", "))
+			}
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d providers reporting incidents", len(incidents)), nil
+		})
+}
+
+// RegisterJobRunPurgeJob delete stored job runs of every service older than the
+// configured retention, daily
+func RegisterJobRunPurgeJob(scheduler *jobs.Scheduler) error {
+	return RegisterJob(scheduler, JobRunPurge, "Delete job runs past their retention", "@daily",
+		func(ctx context.Context) (string, error) {
+			retention := defaultJobRetention
+			if cfg := config.GlobalConfig; cfg != nil && cfg.Jobs.RunRetention > 0 {
+				retention = cfg.Jobs.RunRetention
+			}
+			result := DB.WithContext(ctx).Where("started_at < ?", time.Now().Add(-retention)).Delete(&JobRun{})
+			if result.Error != nil {
+				return "", fmt.Errorf("failed to purge job runs: %v", result.Error)
+			}
+			return fmt.Sprintf("%d runs deleted", result.RowsAffected), nil
+		})
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Request features a key tier can switch off
+const (
+	FeatureStreaming = "streaming" // streamed responses
+	FeatureTools     = "tools"     // tools and function calling
+	FeatureVision    = "vision"    // image inputs
+)
+
+// Allows report whether keys of the tier may use the feature, unknown features are allowed
+func (t *KeyTier) Allows(feature string) bool {
+	switch feature {
+	case FeatureStreaming:
+		return t.Streaming
+	case FeatureTools:
+		return t.Tools
+	case FeatureVision:
+		return t.Vision
+	default:
+		return true
+	}
+}
+
+// KeyTierService key tier service
+type KeyTierService struct{}
+
+// keyTierListSpec searchable and sortable columns of the key tier list
+var keyTierListSpec = listQuerySpec{
+	searchColumns: []string{"name", "description"},
+	sortColumns: map[string]string{
+		"name":       "name",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	defaultSort: "name",
+}
+
+// CreateKeyTier create key tier
+func (s *KeyTierService) CreateKeyTier(tier *KeyTier) error {
+	if err := s.validateKeyTier(tier, 0); err != nil {
+		return err
+	}
+	// select every column, features switched off are zero values gorm would replace
+	// with the column default
+	return DB.Select("*").Create(tier).Error
+}
+
+// GetKeyTier get key tier
+func (s *KeyTierService) GetKeyTier(id uint) (*KeyTier, error) {
+	var tier KeyTier
+	err := DB.First(&tier, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("key tier not found")
+		}
+		return nil, err
+	}
+	return &tier, nil
+}
+
+// GetKeyTierByName get key tier by the name agents reference it with
+func (s *KeyTierService) GetKeyTierByName(name string) (*KeyTier, error) {
+	var tier KeyTier
+	err := DB.Where("name = ?", name).First(&tier).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("key tier not found")
+		}
+		return nil, err
+	}
+	return &tier, nil
+}
+
+// ListKeyTiers get key tier list
+func (s *KeyTierService) ListKeyTiers(listQuery *ListQuery) ([]*KeyTier, int64, error) {
+	var tiers []*KeyTier
+	var total int64
+
+	query, err := listQuery.filter(DB.Model(&KeyTier{}), keyTierListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, keyTierListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&tiers).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tiers, total, nil
+}
+
+// UpdateKeyTier update key tier; a tier agents use cannot be renamed, the agents
+// reference it by name
+func (s *KeyTierService) UpdateKeyTier(id uint, tier *KeyTier) error {
+	existing, err := s.GetKeyTier(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateKeyTier(tier, id); err != nil {
+		return err
+	}
+	if tier.Name != existing.Name {
+		if err := s.checkUnused(existing.Name, "renamed"); err != nil {
+			return err
+		}
+	}
+
+	tier.ID = id
+	tier.CreatedAt = existing.CreatedAt
+	if err := DB.Save(tier).Error; err != nil {
+		return err
+	}
+	invalidateTierLookups(existing.Name)
+	return nil
+}
+
+// DeleteKeyTier delete key tier, refused while agents use it
+func (s *KeyTierService) DeleteKeyTier(id uint) error {
+	existing, err := s.GetKeyTier(id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkUnused(existing.Name, "deleted"); err != nil {
+		return err
+	}
+
+	if err := DB.Delete(&KeyTier{}, id).Error; err != nil {
+		return err
+	}
+	invalidateTierLookups(existing.Name)
+	return nil
+}
+
+// checkUnused fail when agents use the tier, action names what was refused
+func (s *KeyTierService) checkUnused(name, action string) error {
+	var count int64
+	if err := DB.Model(&Agent{}).Where("tier = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("key tier is used by %d agents and cannot be %s, move them to another tier first", count, action)
+	}
+	return nil
+}
+
+// validateKeyTier validate key tier, id is the tier being updated or 0 for a new one
+func (s *KeyTierService) validateKeyTier(tier *KeyTier, id uint) error {
+	tier.Name = strings.TrimSpace(tier.Name)
+	if tier.Name == "" {
+		return errors.New("key tier name cannot be empty")
+	}
+
+	var count int64
+	if err := DB.Model(&KeyTier{}).Where("name = ? AND id <> ?", tier.Name, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("key tier name already exists")
+	}
+
+	return nil
+}
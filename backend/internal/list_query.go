@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidListQuery returned when list parameters name an unsupported filter, status or sort column
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+const (
+	defaultListPageSize = 10
+	maxListPageSize     = 100
+)
+
+// ListQuery common search, filter, sort and pagination parameters of the list endpoints
+type ListQuery struct {
+	Page         int
+	PageSize     int
+	Search       string
+	Status       string
+	Type         string
+	SortBy       string
+	Order        string // "asc" or "desc"
+	CreatedAfter *time.Time
+}
+
+// ParseListQuery build a list query from URL query parameters:
+// page, page_size, search, status, type, sort_by, order and created_after (RFC 3339 or YYYY-MM-DD)
+func ParseListQuery(values url.Values) (*ListQuery, error) {
+	query := &ListQuery{
+		Search: strings.TrimSpace(values.Get("search")),
+		Status: strings.TrimSpace(values.Get("status")),
+		Type:   strings.TrimSpace(values.Get("type")),
+		SortBy: strings.TrimSpace(values.Get("sort_by")),
+		Order:  strings.ToLower(strings.TrimSpace(values.Get("order"))),
+	}
+
+	query.Page, _ = strconv.Atoi(values.Get("page"))
+	query.PageSize, _ = strconv.Atoi(values.Get("page_size"))
+
+	if query.Order != "" && query.Order != "asc" && query.Order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidListQuery)
+	}
+
+	if createdAfter := values.Get("created_after"); createdAfter != "" {
+		t, err := parseListTime(createdAfter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: created_after must be RFC 3339 or YYYY-MM-DD", ErrInvalidListQuery)
+		}
+		query.CreatedAfter = &t
+	}
+
+	query.normalize()
+	return query, nil
+}
+
+// parseListTime parse a timestamp or a plain date
+func parseListTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// normalize fill defaults and clamp the page size
+func (q *ListQuery) normalize() {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = defaultListPageSize
+	}
+	if q.PageSize > maxListPageSize {
+		q.PageSize = maxListPageSize
+	}
+	if q.Order == "" {
+		q.Order = "desc"
+	}
+}
+
+// listQuerySpec describes what a list endpoint can search, filter and sort on
+type listQuerySpec struct {
+	searchColumns []string
+	typeColumn    string
+	sortColumns   map[string]string // sort_by value to column
+	defaultSort   string            // key of sortColumns
+
+	// filterStatus applies the status filter, nil when the endpoint has no status
+	filterStatus func(db *gorm.DB, status string) (*gorm.DB, error)
+}
+
+// filter apply search, status, type and created_after conditions
+func (q *ListQuery) filter(db *gorm.DB, spec listQuerySpec) (*gorm.DB, error) {
+	if q.Search != "" && len(spec.searchColumns) > 0 {
+		pattern := "%" + q.Search + "%"
+		conditions := make([]string, len(spec.searchColumns))
+		args := make([]interface{}, len(spec.searchColumns))
+		for i, column := range spec.searchColumns {
+			conditions[i] = column + " LIKE ?"
+			args[i] = pattern
+		}
+		db = db.Where(strings.Join(conditions, " OR "), args...)
+	}
+
+	if q.Status != "" {
+		if spec.filterStatus == nil {
+			return nil, fmt.Errorf("%w: status filter is not supported", ErrInvalidListQuery)
+		}
+		var err error
+		if db, err = spec.filterStatus(db, q.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Type != "" {
+		if spec.typeColumn == "" {
+			return nil, fmt.Errorf("%w: type filter is not supported", ErrInvalidListQuery)
+		}
+		db = db.Where(spec.typeColumn+" = ?", q.Type)
+	}
+
+	if q.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *q.CreatedAfter)
+	}
+
+	return db, nil
+}
+
+// paginate apply ordering, offset and limit, sort columns come from the spec whitelist only
+func (q *ListQuery) paginate(db *gorm.DB, spec listQuerySpec) (*gorm.DB, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = spec.defaultSort
+	}
+
+	column, ok := spec.sortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: sort_by %s is not supported", ErrInvalidListQuery, sortBy)
+	}
+
+	order := column + " DESC"
+	if q.Order == "asc" {
+		order = column + " ASC"
+	}
+
+	offset := (q.Page - 1) * q.PageSize
+	return db.Order(order).Order("id").Offset(offset).Limit(q.PageSize), nil
+}
+
+// invalidStatus build the error for an unknown status value
+func invalidStatus(status string) error {
+	return fmt.Errorf("%w: unknown status %s", ErrInvalidListQuery, status)
+}
+
+// CSVText a client-supplied value made safe for spreadsheets, which would run a cell
+// starting with =, +, - or @ as a formula
+func CSVText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,406 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/notify"
+
+	"gorm.io/gorm"
+)
+
+// Login anomaly sensitivities, which unusual logins are reported
+const (
+	LoginAnomalyOff    = "off"
+	LoginAnomalyLow    = "low"    // impossible travel only
+	LoginAnomalyMedium = "medium" // also logins from a new country
+	LoginAnomalyHigh   = "high"   // also logins from a new network
+)
+
+// Kinds of unusual logins
+const (
+	LoginAnomalyNewCountry       = "new_country"
+	LoginAnomalyNewNetwork       = "new_network"
+	LoginAnomalyImpossibleTravel = "impossible_travel"
+)
+
+// Actions taken on an unusual login
+const (
+	LoginAnomalyActionAllowed              = "allowed"
+	LoginAnomalyActionVerificationRequired = "verification_required"
+)
+
+const (
+	// loginChallengeTTL how long a mailed verification code is valid
+	loginChallengeTTL = 10 * time.Minute
+
+	// maxLoginChallengeAttempts wrong codes after which the challenge is dropped
+	maxLoginChallengeAttempts = 5
+
+	// minTravelDistanceKm distances below which travel is never impossible, IP
+	// geolocation is not more precise than that
+	minTravelDistanceKm = 300
+
+	// maxKnownLogins successful logins the new country and network checks look at
+	maxKnownLogins = 1000
+)
+
+// ErrLoginChallengeInvalid the verification is unknown, expired or used up
+var ErrLoginChallengeInvalid = errors.New("login verification is unknown or expired, log in again")
+
+// ErrLoginCodeMismatch the verification code is wrong
+var ErrLoginCodeMismatch = errors.New("wrong verification code")
+
+// loginAnomalyLevel the checks of a sensitivity
+type loginAnomalyLevel struct {
+	newCountry  bool
+	newNetwork  bool
+	maxSpeedKmh float64 // travel faster than this between two logins is impossible
+}
+
+// loginAnomalyLevels checks per sensitivity
+var loginAnomalyLevels = map[string]loginAnomalyLevel{
+	LoginAnomalyLow:    {maxSpeedKmh: 1000},
+	LoginAnomalyMedium: {newCountry: true, maxSpeedKmh: 800},
+	LoginAnomalyHigh:   {newCountry: true, newNetwork: true, maxSpeedKmh: 500},
+}
+
+// ValidLoginAnomalySensitivity report whether s is a sensitivity, empty included
+func ValidLoginAnomalySensitivity(s string) bool {
+	_, ok := loginAnomalyLevels[s]
+	return ok || s == "" || s == LoginAnomalyOff
+}
+
+// loginAnomalySensitivity the live sensitivity, or the configured one
+func loginAnomalySensitivity() string {
+	if sensitivity := CurrentSystemConfig().LoginAnomalySensitivity; sensitivity != "" {
+		return sensitivity
+	}
+	if cfg := config.GlobalConfig; cfg != nil && cfg.Security.LoginAnomalySensitivity != "" {
+		return cfg.Security.LoginAnomalySensitivity
+	}
+	return LoginAnomalyMedium
+}
+
+// LoginContext where a login comes from
+type LoginContext struct {
+	IP        string
+	UserAgent string
+	Country   string   // ISO country code, empty when unknown
+	Latitude  *float64 // nil when unknown
+	Longitude *float64
+}
+
+// NewLoginContext the login context of a request, with the country and coordinates
+// from the configured headers
+func NewLoginContext(ip, userAgent string, header http.Header) *LoginContext {
+	login := &LoginContext{IP: ip, UserAgent: userAgent}
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		return login
+	}
+
+	if name := cfg.Security.LoginCountryHeader; name != "" {
+		country := strings.ToUpper(strings.TrimSpace(header.Get(name)))
+		// XX and T1 are what proxies send for unknown locations and Tor
+		if len(country) == 2 && country != "XX" && country != "T1" {
+			login.Country = country
+		}
+	}
+	if cfg.Security.LoginLatitudeHeader != "" && cfg.Security.LoginLongitudeHeader != "" {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(header.Get(cfg.Security.LoginLatitudeHeader)), 64)
+		longitude, lonErr := strconv.ParseFloat(strings.TrimSpace(header.Get(cfg.Security.LoginLongitudeHeader)), 64)
+		if latErr == nil && lonErr == nil && math.Abs(latitude) <= 90 && math.Abs(longitude) <= 180 {
+			login.Latitude, login.Longitude = &latitude, &longitude
+		}
+	}
+	return login
+}
+
+// hasLocation report whether the coordinates of the login are known
+func (l *LoginContext) hasLocation() bool {
+	return l.Latitude != nil && l.Longitude != nil
+}
+
+// LoginAnomaly what made a login unusual
+type LoginAnomaly struct {
+	Kinds      []string
+	Network    string
+	Country    string
+	DistanceKm float64 // from the previous located login, for impossible travel
+	SpeedKmh   float64
+}
+
+// String the kinds, comma separated
+func (a *LoginAnomaly) String() string {
+	return strings.Join(a.Kinds, ",")
+}
+
+// DetectLoginAnomaly compare a login with the successful logins of the user within the
+// lookback at the current sensitivity; nil when the login looks usual or the user has
+// no logins to compare with
+func (s *UserService) DetectLoginAnomaly(userID uint, login *LoginContext) (*LoginAnomaly, error) {
+	level, ok := loginAnomalyLevels[loginAnomalySensitivity()]
+	if !ok {
+		return nil, nil
+	}
+	lookback := 90 * 24 * time.Hour
+	if cfg := config.GlobalConfig; cfg != nil && cfg.Security.LoginAnomalyLookback > 0 {
+		lookback = cfg.Security.LoginAnomalyLookback
+	}
+
+	var known []*UserLoginLog
+	err := DB.Where("user_id = ? AND success = ? AND created_at >= ?", userID, true, time.Now().Add(-lookback)).
+		Order("created_at DESC").Limit(maxKnownLogins).Find(&known).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login history: %v", err)
+	}
+	if len(known) == 0 {
+		return nil, nil
+	}
+
+	anomaly := &LoginAnomaly{Network: clientNetwork(login.IP), Country: login.Country}
+	if level.newCountry && login.Country != "" {
+		located, seen := false, false
+		for _, entry := range known {
+			located = located || entry.Country != ""
+			seen = seen || entry.Country == login.Country
+		}
+		// without any located login the header was only just set up
+		if located && !seen {
+			anomaly.Kinds = append(anomaly.Kinds, LoginAnomalyNewCountry)
+		}
+	}
+	if level.newNetwork && anomaly.Network != "" {
+		seen := false
+		for _, entry := range known {
+			if clientNetwork(entry.IP) == anomaly.Network {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			anomaly.Kinds = append(anomaly.Kinds, LoginAnomalyNewNetwork)
+		}
+	}
+	if login.hasLocation() {
+		for _, entry := range known {
+			if entry.Latitude == nil || entry.Longitude == nil {
+				continue
+			}
+			distance := distanceKm(*entry.Latitude, *entry.Longitude, *login.Latitude, *login.Longitude)
+			if distance >= minTravelDistanceKm {
+				hours := math.Max(time.Since(entry.CreatedAt).Hours(), 1.0/60)
+				if speed := distance / hours; speed > level.maxSpeedKmh {
+					anomaly.Kinds = append(anomaly.Kinds, LoginAnomalyImpossibleTravel)
+					anomaly.DistanceKm, anomaly.SpeedKmh = math.Round(distance), math.Round(speed)
+				}
+			}
+			// only the latest located login counts
+			break
+		}
+	}
+
+	if len(anomaly.Kinds) == 0 {
+		return nil, nil
+	}
+	return anomaly, nil
+}
+
+// distanceKm great-circle distance between two coordinates
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// LoginChallenge a login held back until the user enters the code mailed to them
+type LoginChallenge struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ChallengeID string    `json:"challenge_id" gorm:"type:varchar(64);not null;uniqueIndex;comment:'public id of the challenge'"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	CodeHash    string    `json:"-" gorm:"type:varchar(64);not null;comment:'sha-256 of the mailed code'"`
+	Attempts    int       `json:"attempts" gorm:"not null;default:0"`
+	Anomalies   string    `json:"anomalies" gorm:"type:varchar(100);not null;default:''"`
+	Country     string    `json:"country" gorm:"type:varchar(8);not null;default:''"`
+	Latitude    *float64  `json:"latitude"`
+	Longitude   *float64  `json:"longitude"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName specify table name
+func (LoginChallenge) TableName() string {
+	return "login_challenges"
+}
+
+// HandleLoginAnomaly publish the user.login_anomaly event of an unusual login. With
+// verification required and a mail to the user possible, a challenge is returned and
+// the user is mailed its code; otherwise the login goes ahead and the user gets a
+// security notice.
+func (s *UserService) HandleLoginAnomaly(user *User, login *LoginContext, anomaly *LoginAnomaly) (*LoginChallenge, error) {
+	var challenge *LoginChallenge
+	var code string
+	if cfg := config.GlobalConfig; cfg != nil && cfg.Security.LoginAnomalyVerify && user.Email != "" {
+		if sender, err := newEmailSender(); err == nil {
+			challenge, code, err = s.createLoginChallenge(user, login, anomaly)
+			if err != nil {
+				return nil, err
+			}
+			if err := mailLoginCode(sender, user, code, anomaly); err != nil {
+				DB.Delete(challenge)
+				log.Printf("Failed to mail login verification code to user %d, allowing the login: %v", user.ID, err)
+				challenge = nil
+			}
+		}
+	}
+
+	action := LoginAnomalyActionAllowed
+	if challenge != nil {
+		action = LoginAnomalyActionVerificationRequired
+	}
+	data := map[string]interface{}{
+		"user_id":   user.ID,
+		"username":  user.Username,
+		"anomalies": anomaly.String(),
+		"action":    action,
+		"ip":        login.IP,
+		"network":   anomaly.Network,
+	}
+	if anomaly.Country != "" {
+		data["country"] = anomaly.Country
+	}
+	if anomaly.DistanceKm > 0 {
+		data["distance_km"] = anomaly.DistanceKm
+		data["speed_kmh"] = anomaly.SpeedKmh
+	}
+	event := newEvent(events.TypeLoginAnomaly, user.Username, data)
+	if err := enqueueEvent(DB, event); err != nil {
+		log.Printf("Failed to record login anomaly of user %d: %v", user.ID, err)
+	}
+	if challenge == nil {
+		mailSecurityNotice(user, event)
+	}
+	return challenge, nil
+}
+
+// createLoginChallenge store a challenge for the login, returning it with its code
+func (s *UserService) createLoginChallenge(user *User, login *LoginContext, anomaly *LoginAnomaly) (*LoginChallenge, string, error) {
+	code, err := newLoginCode()
+	if err != nil {
+		return nil, "", err
+	}
+	challenge := &LoginChallenge{
+		ChallengeID: "lc_" + generateRandomString(32),
+		UserID:      user.ID,
+		CodeHash:    hashLoginCode(code),
+		Anomalies:   anomaly.String(),
+		Country:     login.Country,
+		Latitude:    login.Latitude,
+		Longitude:   login.Longitude,
+		ExpiresAt:   time.Now().Add(loginChallengeTTL),
+	}
+	if err := DB.Create(challenge).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create login challenge: %v", err)
+	}
+	return challenge, code, nil
+}
+
+// newLoginCode a random six digit code
+func newLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %v", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashLoginCode hex SHA-256 of a verification code
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// mailLoginCode mail the verification code of a held back login
+func mailLoginCode(sender *notify.EmailSender, user *User, code string, anomaly *LoginAnomaly) error {
+	email, err := notify.RenderEmail(notify.Message{
+		Title: "Confirm your login",
+		Text: fmt.Sprintf("A login to your account looked unusual (%s). Enter the code %s to complete it, it expires in %d minutes. If this was not you, change your password.",
+			anomaly.String(), code, int(loginChallengeTTL.Minutes())),
+		Severity: notify.SeverityWarning,
+		Source:   eventSource,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return sender.Send(ctx, user.Email, email)
+}
+
+// VerifyLoginChallenge check the code of a challenge and use it up, returning the
+// challenge and its user. After too many wrong codes the challenge is dropped.
+func (s *UserService) VerifyLoginChallenge(challengeID, code string) (*LoginChallenge, *User, error) {
+	var challenge LoginChallenge
+	if err := DB.Where("challenge_id = ?", challengeID).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrLoginChallengeInvalid
+		}
+		return nil, nil, fmt.Errorf("database error: %v", err)
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		DB.Delete(&challenge)
+		return nil, nil, ErrLoginChallengeInvalid
+	}
+
+	// counted before the comparison so parallel guesses cannot exceed the attempts
+	result := DB.Model(&LoginChallenge{}).Where("id = ? AND attempts < ?", challenge.ID, maxLoginChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("database error: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		DB.Delete(&challenge)
+		return nil, nil, ErrLoginChallengeInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashLoginCode(strings.TrimSpace(code))), []byte(challenge.CodeHash)) != 1 {
+		return nil, nil, ErrLoginCodeMismatch
+	}
+
+	// a code works once, the delete decides between parallel correct submissions
+	result = DB.Delete(&challenge)
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("database error: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrLoginChallengeInvalid
+	}
+
+	user, err := s.GetUserByID(challenge.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive() {
+		return nil, nil, errors.New("user account is not active")
+	}
+	return &challenge, user, nil
+}
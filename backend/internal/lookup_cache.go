@@ -0,0 +1,410 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/ttlcache"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lookupInvalidationChannel Redis pub/sub channel announcing agents and users whose
+// cached lookups are stale
+const lookupInvalidationChannel = "agent-connector:lookup-invalidation"
+
+// lookupInvalidation the agent or user changed by a control flow mutation, by primary
+// key, or the key tier or quota pool by name
+type lookupInvalidation struct {
+	AgentID uint   `json:"agent_id,omitempty"`
+	UserID  uint   `json:"user_id,omitempty"`
+	Tier    string `json:"tier,omitempty"`
+	Pool    string `json:"pool,omitempty"`
+}
+
+// lookupCache caches of the lookups made on every dataflow request, connector keys
+// are cached by their SHA-256 so plaintext keys are not kept in memory
+type lookupCache struct {
+	agents   *ttlcache.Cache[string, *Agent]
+	keys     *ttlcache.Cache[string, *Agent]
+	settings *ttlcache.Cache[string, *UserSettings]
+	tiers    *ttlcache.Cache[string, *KeyTier]
+	pools    *ttlcache.Cache[string, *QuotaPool]
+
+	// generation counts invalidations, a lookup racing one is not cached
+	generation atomic.Uint64
+}
+
+// lookups installed by InitLookupCache, nil when lookups always read the database
+var lookups *lookupCache
+
+// lookupInvalidator installed by InitLookupInvalidation, nil when invalidations stay in-process
+var lookupInvalidator *LookupInvalidation
+
+// InitLookupCache install the lookup cache configured in the global config, false
+// when it is disabled
+func InitLookupCache() (bool, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return false, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+	if cfg.LookupCache.TTL <= 0 {
+		return false, nil
+	}
+
+	ttl, maxEntries, stale := cfg.LookupCache.TTL, cfg.LookupCache.MaxEntries, cfg.LookupCache.StaleTTL
+	lookups = &lookupCache{
+		agents:   ttlcache.New[string, *Agent](ttl, maxEntries).WithStale(stale),
+		keys:     ttlcache.New[string, *Agent](ttl, maxEntries).WithStale(stale),
+		settings: ttlcache.New[string, *UserSettings](ttl, maxEntries).WithStale(stale),
+		tiers:    ttlcache.New[string, *KeyTier](ttl, maxEntries).WithStale(stale),
+		pools:    ttlcache.New[string, *QuotaPool](ttl, maxEntries).WithStale(stale),
+	}
+	return true, nil
+}
+
+// LookupCacheStats counters of every cached lookup, nil when the cache is disabled
+func LookupCacheStats() map[string]ttlcache.Stats {
+	if lookups == nil {
+		return nil
+	}
+	return map[string]ttlcache.Stats{
+		"agents":         lookups.agents.Stats(),
+		"connector_keys": lookups.keys.Stats(),
+		"user_settings":  lookups.settings.Stats(),
+		"key_tiers":      lookups.tiers.Stats(),
+		"quota_pools":    lookups.pools.Stats(),
+	}
+}
+
+// LookupAgentByAgentID GetAgentByAgentID through the lookup cache
+func LookupAgentByAgentID(agentID string) (*Agent, error) {
+	if lookups == nil {
+		return (&AgentService{}).GetAgentByAgentID(agentID)
+	}
+	agent, ok := lookups.agents.Get(agentID)
+	if !ok {
+		agent, ok = staleLookup(lookups.agents, agentID, nil)
+	}
+	if ok {
+		return copyAgent(agent), nil
+	}
+
+	generation := lookups.generation.Load()
+	agent, err := (&AgentService{}).GetAgentByAgentID(agentID)
+	if err != nil {
+		if agent, ok := staleLookup(lookups.agents, agentID, err); ok {
+			return copyAgent(agent), nil
+		}
+		return nil, err
+	}
+	lookups.store(generation, func() { lookups.agents.Set(agentID, agent) })
+	return copyAgent(agent), nil
+}
+
+// LookupAgentByConnectorAPIKey GetAgentByConnectorAPIKey through the lookup cache
+func LookupAgentByConnectorAPIKey(apiKey string) (*Agent, error) {
+	if lookups == nil {
+		return (&AgentService{}).GetAgentByConnectorAPIKey(apiKey)
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	key := hex.EncodeToString(sum[:])
+	agent, ok := lookups.keys.Get(key)
+	if !ok {
+		agent, ok = staleLookup(lookups.keys, key, nil)
+	}
+	if ok {
+		return copyAgent(agent), nil
+	}
+
+	generation := lookups.generation.Load()
+	agent, err := (&AgentService{}).GetAgentByConnectorAPIKey(apiKey)
+	if err != nil {
+		if agent, ok := staleLookup(lookups.keys, key, err); ok {
+			return copyAgent(agent), nil
+		}
+		return nil, err
+	}
+	lookups.store(generation, func() { lookups.keys.Set(key, agent) })
+	return copyAgent(agent), nil
+}
+
+// LookupUserSettingsByUsername GetUserSettingsByUsername through the lookup cache,
+// unknown users are not cached so a user created afterwards is found at once
+func LookupUserSettingsByUsername(username string) (*UserSettings, error) {
+	if lookups == nil || username == "" {
+		return NewUserService().GetUserSettingsByUsername(username)
+	}
+	settings, ok := lookups.settings.Get(username)
+	if !ok {
+		settings, ok = staleLookup(lookups.settings, username, nil)
+	}
+	if ok {
+		copied := *settings
+		return &copied, nil
+	}
+
+	generation := lookups.generation.Load()
+	settings, err := NewUserService().GetUserSettingsByUsername(username)
+	if err != nil {
+		if settings, ok := staleLookup(lookups.settings, username, err); ok {
+			copied := *settings
+			return &copied, nil
+		}
+		return nil, err
+	}
+	if settings == nil {
+		return nil, nil
+	}
+	lookups.store(generation, func() { lookups.settings.Set(username, settings) })
+	copied := *settings
+	return &copied, nil
+}
+
+// LookupKeyTier GetKeyTierByName through the lookup cache
+func LookupKeyTier(name string) (*KeyTier, error) {
+	if lookups == nil {
+		return (&KeyTierService{}).GetKeyTierByName(name)
+	}
+	tier, ok := lookups.tiers.Get(name)
+	if !ok {
+		tier, ok = staleLookup(lookups.tiers, name, nil)
+	}
+	if ok {
+		copied := *tier
+		return &copied, nil
+	}
+
+	generation := lookups.generation.Load()
+	tier, err := (&KeyTierService{}).GetKeyTierByName(name)
+	if err != nil {
+		if tier, ok := staleLookup(lookups.tiers, name, err); ok {
+			copied := *tier
+			return &copied, nil
+		}
+		return nil, err
+	}
+	lookups.store(generation, func() { lookups.tiers.Set(name, tier) })
+	copied := *tier
+	return &copied, nil
+}
+
+// LookupQuotaPool GetQuotaPoolByName through the lookup cache
+func LookupQuotaPool(name string) (*QuotaPool, error) {
+	if lookups == nil {
+		return (&QuotaPoolService{}).GetQuotaPoolByName(name)
+	}
+	pool, ok := lookups.pools.Get(name)
+	if !ok {
+		pool, ok = staleLookup(lookups.pools, name, nil)
+	}
+	if ok {
+		copied := *pool
+		return &copied, nil
+	}
+
+	generation := lookups.generation.Load()
+	pool, err := (&QuotaPoolService{}).GetQuotaPoolByName(name)
+	if err != nil {
+		if pool, ok := staleLookup(lookups.pools, name, err); ok {
+			copied := *pool
+			return &copied, nil
+		}
+		return nil, err
+	}
+	lookups.store(generation, func() { lookups.pools.Set(name, pool) })
+	copied := *pool
+	return &copied, nil
+}
+
+// staleLookup the expired entry of key while the database is unreachable, so requests
+// keep being served for up to stale_ttl past the TTL. err is the error of the lookup
+// that just failed, nil to use the entry only during an outage already known.
+func staleLookup[V any](cache *ttlcache.Cache[string, V], key string, err error) (V, bool) {
+	var outage bool
+	if err == nil {
+		outage = databaseDown.Load()
+	} else {
+		outage = databaseFailed(err)
+	}
+	if !outage {
+		var zero V
+		return zero, false
+	}
+	value, _, ok := cache.GetStale(key)
+	return value, ok
+}
+
+// store cache a lookup unless an invalidation arrived since generation was read
+func (c *lookupCache) store(generation uint64, set func()) {
+	if c.generation.Load() == generation {
+		set()
+	}
+}
+
+// apply drop the cached lookups of the invalidated agent, user, key tier or quota pool
+func (c *lookupCache) apply(invalidation lookupInvalidation) {
+	c.generation.Add(1)
+	if id := invalidation.AgentID; id != 0 {
+		byAgent := func(_ string, agent *Agent) bool { return agent.ID == id }
+		c.agents.DeleteFunc(byAgent)
+		c.keys.DeleteFunc(byAgent)
+	}
+	if id := invalidation.UserID; id != 0 {
+		c.settings.DeleteFunc(func(_ string, settings *UserSettings) bool { return settings.UserID == id })
+	}
+	if invalidation.Tier != "" {
+		c.tiers.Delete(invalidation.Tier)
+	}
+	if invalidation.Pool != "" {
+		c.pools.Delete(invalidation.Pool)
+	}
+}
+
+// copyAgent callers may modify the returned agent, the cached one must not change
+func copyAgent(agent *Agent) *Agent {
+	copied := *agent
+	return &copied
+}
+
+// invalidateAgentLookups announce a changed or deleted agent
+func invalidateAgentLookups(id uint) {
+	publishLookupInvalidation(lookupInvalidation{AgentID: id})
+}
+
+// invalidateUserLookups announce a changed or deleted user or user settings
+func invalidateUserLookups(id uint) {
+	publishLookupInvalidation(lookupInvalidation{UserID: id})
+}
+
+// invalidateTierLookups announce a changed or deleted key tier
+func invalidateTierLookups(name string) {
+	publishLookupInvalidation(lookupInvalidation{Tier: name})
+}
+
+// invalidatePoolLookups announce a changed or deleted quota pool
+func invalidatePoolLookups(name string) {
+	publishLookupInvalidation(lookupInvalidation{Pool: name})
+}
+
+// publishLookupInvalidation drop the stale lookups of this process and of the services
+// subscribed through Redis; when publishing fails they expire after the cache TTL
+func publishLookupInvalidation(invalidation lookupInvalidation) {
+	if lookups != nil {
+		lookups.apply(invalidation)
+	}
+	if lookupInvalidator == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lookupInvalidator.publish(ctx, invalidation); err != nil {
+		log.Printf("Failed to propagate lookup invalidation: %v", err)
+	}
+}
+
+// LookupInvalidation publishes the agents and users changed by this process over Redis
+// pub/sub and drops the cached lookups other services announce
+type LookupInvalidation struct {
+	client *redis.Client
+}
+
+// InitLookupInvalidation connect to the configured Redis and install the invalidation,
+// so mutations of this process reach the caches of the other services
+func InitLookupInvalidation() (*LookupInvalidation, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	lookupInvalidator = &LookupInvalidation{client: client}
+	return lookupInvalidator, nil
+}
+
+// publish announce one invalidation
+func (l *LookupInvalidation) publish(ctx context.Context, invalidation lookupInvalidation) error {
+	payload, err := json.Marshal(invalidation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lookup invalidation: %w", err)
+	}
+	if err := l.client.Publish(ctx, lookupInvalidationChannel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish lookup invalidation: %w", err)
+	}
+	return nil
+}
+
+// Run drop the lookups invalidated by other services until ctx is done; the cache is
+// cleared whenever the subscription is re-established, messages may have been missed
+func (l *LookupInvalidation) Run(ctx context.Context) {
+	pubsub := l.client.Subscribe(ctx, lookupInvalidationChannel)
+	defer pubsub.Close()
+
+	for {
+		message, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Lookup invalidation subscription failed: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if lookups == nil {
+			continue
+		}
+
+		switch message := message.(type) {
+		case *redis.Subscription:
+			if message.Kind == "subscribe" {
+				lookups.clear()
+			}
+		case *redis.Message:
+			var invalidation lookupInvalidation
+			if err := json.Unmarshal([]byte(message.Payload), &invalidation); err != nil {
+				log.Printf("Ignoring invalid lookup invalidation: %v", err)
+				continue
+			}
+			lookups.apply(invalidation)
+		}
+	}
+}
+
+// Close closes the Redis connection
+func (l *LookupInvalidation) Close() error {
+	return l.client.Close()
+}
+
+// clear drop every cached lookup
+func (c *lookupCache) clear() {
+	c.generation.Add(1)
+	c.agents.Clear()
+	c.keys.Clear()
+	c.settings.Clear()
+	c.tiers.Clear()
+	c.pools.Clear()
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/pkg/events"
+
+	"gorm.io/gorm"
+)
+
+// maintenanceRefresh how long MaintenanceChecker caches the upcoming windows
+const maintenanceRefresh = 15 * time.Second
+
+// IsGlobal report whether the window covers every agent
+func (w *MaintenanceWindow) IsGlobal() bool {
+	return w.AgentID == ""
+}
+
+// Covers report whether the window applies to the agent at the given time
+func (w *MaintenanceWindow) Covers(agentID string, at time.Time) bool {
+	if !w.IsGlobal() && w.AgentID != agentID {
+		return false
+	}
+	return !at.Before(w.StartsAt) && at.Before(w.EndsAt)
+}
+
+// Status scheduled, active or ended at the given time
+func (w *MaintenanceWindow) Status(at time.Time) string {
+	switch {
+	case at.Before(w.StartsAt):
+		return "scheduled"
+	case at.Before(w.EndsAt):
+		return "active"
+	default:
+		return "ended"
+	}
+}
+
+// MaintenanceWindowService maintenance window service
+type MaintenanceWindowService struct{}
+
+// maintenanceWindowListSpec searchable, filterable and sortable columns of the maintenance window list
+var maintenanceWindowListSpec = listQuerySpec{
+	searchColumns: []string{"name", "agent_id", "message"},
+	sortColumns: map[string]string{
+		"name":       "name",
+		"starts_at":  "starts_at",
+		"ends_at":    "ends_at",
+		"created_at": "created_at",
+	},
+	defaultSort: "starts_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		now := time.Now()
+		switch status {
+		case "scheduled":
+			return db.Where("starts_at > ?", now), nil
+		case "active":
+			return db.Where("starts_at <= ? AND ends_at > ?", now, now), nil
+		case "ended":
+			return db.Where("ends_at <= ?", now), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
+// CreateMaintenanceWindow create maintenance window
+func (s *MaintenanceWindowService) CreateMaintenanceWindow(window *MaintenanceWindow) error {
+	if err := s.validateMaintenanceWindow(window); err != nil {
+		return err
+	}
+	return DB.Create(window).Error
+}
+
+// GetMaintenanceWindow get maintenance window
+func (s *MaintenanceWindowService) GetMaintenanceWindow(id uint) (*MaintenanceWindow, error) {
+	var window MaintenanceWindow
+	err := DB.First(&window, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("maintenance window not found")
+		}
+		return nil, err
+	}
+	return &window, nil
+}
+
+// ListMaintenanceWindows get maintenance window list
+func (s *MaintenanceWindowService) ListMaintenanceWindows(listQuery *ListQuery) ([]*MaintenanceWindow, int64, error) {
+	var windows []*MaintenanceWindow
+	var total int64
+
+	query, err := listQuery.filter(DB.Model(&MaintenanceWindow{}), maintenanceWindowListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, maintenanceWindowListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&windows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return windows, total, nil
+}
+
+// UpdateMaintenanceWindow update maintenance window, e.g. to end it early or extend it
+func (s *MaintenanceWindowService) UpdateMaintenanceWindow(id uint, window *MaintenanceWindow) error {
+	existing, err := s.GetMaintenanceWindow(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateMaintenanceWindow(window); err != nil {
+		return err
+	}
+
+	window.ID = id
+	window.CreatedAt = existing.CreatedAt
+	return DB.Save(window).Error
+}
+
+// DeleteMaintenanceWindow delete maintenance window
+func (s *MaintenanceWindowService) DeleteMaintenanceWindow(id uint) error {
+	result := DB.Delete(&MaintenanceWindow{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("maintenance window not found")
+	}
+
+	return nil
+}
+
+// listUnfinishedMaintenanceWindows get the active and scheduled windows
+func (s *MaintenanceWindowService) listUnfinishedMaintenanceWindows() ([]*MaintenanceWindow, error) {
+	var windows []*MaintenanceWindow
+	err := DB.Where("ends_at > ?", time.Now()).Order("starts_at").Find(&windows).Error
+	return windows, err
+}
+
+// validateMaintenanceWindow validate maintenance window
+func (s *MaintenanceWindowService) validateMaintenanceWindow(window *MaintenanceWindow) error {
+	window.Name = strings.TrimSpace(window.Name)
+	if window.Name == "" {
+		return errors.New("maintenance window name cannot be empty")
+	}
+
+	if window.StartsAt.IsZero() || window.EndsAt.IsZero() {
+		return errors.New("maintenance window start and end are required")
+	}
+	if !window.EndsAt.After(window.StartsAt) {
+		return errors.New("maintenance window must end after it starts")
+	}
+
+	window.AgentID = strings.TrimSpace(window.AgentID)
+	if window.AgentID != "" {
+		agentService := &AgentService{}
+		if _, err := agentService.GetAgentByAgentID(window.AgentID); err != nil {
+			return fmt.Errorf("invalid agent_id: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MaintenanceChecker answers whether an agent is under maintenance from a
+// periodically refreshed cache, so the request path does not query the database
+type MaintenanceChecker struct {
+	service *MaintenanceWindowService
+
+	mu       sync.Mutex
+	windows  []*MaintenanceWindow
+	loadedAt time.Time
+}
+
+// NewMaintenanceChecker create maintenance checker
+func NewMaintenanceChecker() *MaintenanceChecker {
+	return &MaintenanceChecker{
+		service: &MaintenanceWindowService{},
+	}
+}
+
+// Active window covering the agent now, the one ending last when several overlap;
+// nil when there is none or the windows cannot be loaded
+func (m *MaintenanceChecker) Active(agentID string) *MaintenanceWindow {
+	now := time.Now()
+
+	var active *MaintenanceWindow
+	for _, window := range m.unfinishedWindows() {
+		if window.Covers(agentID, now) && (active == nil || window.EndsAt.After(active.EndsAt)) {
+			active = window
+		}
+	}
+	return active
+}
+
+// Silences report whether the event is an agent health alert raised during maintenance
+func (m *MaintenanceChecker) Silences(event events.Event) bool {
+	switch event.Type {
+	case events.TypeAgentHealthChanged, events.TypeAgentUnhealthy, events.TypeAgentErrorRateHigh:
+		return m.Active(event.Subject) != nil
+	default:
+		return false
+	}
+}
+
+// unfinishedWindows cached list of active and scheduled windows, a failed refresh
+// keeps the previous list
+func (m *MaintenanceChecker) unfinishedWindows() []*MaintenanceWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.windows != nil && time.Since(m.loadedAt) < maintenanceRefresh {
+		return m.windows
+	}
+	if DB == nil {
+		return nil
+	}
+
+	windows, err := m.service.listUnfinishedMaintenanceWindows()
+	m.loadedAt = time.Now()
+	if err != nil {
+		log.Printf("Failed to load maintenance windows: %v", err)
+		if m.windows == nil {
+			m.windows = []*MaintenanceWindow{}
+		}
+		return m.windows
+	}
+	if windows == nil {
+		windows = []*MaintenanceWindow{}
+	}
+	m.windows = windows
+	return windows
+}
@@ -1,8 +1,11 @@
 package internal
 
 import (
+	"slices"
+	"strings"
 	"time"
 
+	"agent-connector/pkg/acl"
 	"agent-connector/pkg/types"
 
 	"gorm.io/gorm"
@@ -12,28 +15,317 @@ import (
 
 // SystemConfig system configuration table
 type SystemConfig struct {
-	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	BootstrappedAt *time.Time `json:"bootstrapped_at" gorm:"comment:'when the first-run seed was applied'"`
+
+	// Live settings, applied by the running services without a restart; empty or 0
+	// keeps the value of the configuration file
+	RateLimitMode           string `json:"rate_limit_mode" gorm:"type:varchar(16);not null;default:'';comment:'agent rate limits: enforce, monitor or off'"`
+	ImpersonationTTLMinutes int    `json:"impersonation_ttl_minutes" gorm:"type:int;not null;default:0;comment:'lifetime of impersonation sessions'"`
+	DefaultQPS              int    `json:"default_qps" gorm:"type:int;not null;default:0;comment:'qps of each user of an agent without a key or user override'"`
+	DefaultPriority         int    `json:"default_priority" gorm:"type:int;not null;default:0;comment:'queue priority of users without a priority, 0 keeps 50'"`
+	LoginAnomalySensitivity string `json:"login_anomaly_sensitivity" gorm:"type:varchar(16);not null;default:'';comment:'unusual login detection: off, low, medium or high'"`
+
+	Version   int       `json:"version" gorm:"type:int;not null;default:1;comment:'incremented by every update, for optimistic locking'"`
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
+// Rate limit modes of the system configuration
+const (
+	RateLimitModeEnforce = "enforce" // reject requests over the agent's QPS
+	RateLimitModeMonitor = "monitor" // log and count them, but let them through
+	RateLimitModeOff     = "off"     // skip the agent rate limit
+)
+
 // Agent agent configuration table
 type Agent struct {
-	ID               uint            `json:"id" gorm:"primaryKey;autoIncrement"`
-	Name             string          `json:"name" gorm:"type:varchar(255);not null;comment:'agent name'"`
-	Type             types.AgentType `json:"type" gorm:"type:varchar(50);not null;comment:'agent type: openai, dify-chat, dify-workflow'"`
-	URL              string          `json:"url" gorm:"type:varchar(500);not null;comment:'agent url'"`
-	SourceAPIKey     string          `json:"source_api_key" gorm:"type:varchar(500);not null;comment:'source api key'"`
-	ConnectorAPIKey  string          `json:"connector_api_key" gorm:"type:varchar(500);not null;unique;comment:'connector api key, used for data flow api authentication'"`
-	AgentID          string          `json:"agent_id" gorm:"type:varchar(100);not null;unique;comment:'agent id'"`
-	QPS              int             `json:"qps" gorm:"type:int;not null;default:10;comment:'agent qps limit'"`
-	Enabled          bool            `json:"enabled" gorm:"type:boolean;not null;default:true;comment:'whether to enable'"`
-	Description      string          `json:"description" gorm:"type:text;comment:'description'"`
-	SupportStreaming bool            `json:"support_streaming" gorm:"type:boolean;not null;default:true;comment:'whether to support streaming response'"`
-	ResponseFormat   string          `json:"response_format" gorm:"type:varchar(50);not null;default:'openai';comment:'response format: openai or dify'"`
-	CreatedAt        time.Time       `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt        time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt        gorm.DeletedAt  `json:"-" gorm:"index"`
+	ID                    uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name                  string          `json:"name" gorm:"type:varchar(255);not null;comment:'agent name'"`
+	Type                  types.AgentType `json:"type" gorm:"type:varchar(50);not null;comment:'agent type: openai, dify-chat, dify-workflow'"`
+	URL                   string          `json:"url" gorm:"type:varchar(500);not null;comment:'agent url'"`
+	SourceAPIKey          string          `json:"source_api_key" gorm:"type:varchar(500);not null;comment:'source api key'"`
+	ConnectorAPIKey       string          `json:"connector_api_key,omitempty" gorm:"-"` // plaintext key, only set right after it is generated
+	ConnectorKeyPrefix    string          `json:"connector_key_prefix" gorm:"type:varchar(32);not null;default:'';index;comment:'connector api key prefix, used for lookup'"`
+	ConnectorKeyHash      string          `json:"-" gorm:"type:varchar(64);not null;default:'';comment:'sha-256 of the connector api key'"`
+	LegacyConnectorAPIKey *string         `json:"-" gorm:"column:connector_api_key;type:varchar(500);unique;comment:'deprecated plaintext connector api key, cleared by migration'"`
+	AgentID               string          `json:"agent_id" gorm:"type:varchar(100);not null;unique;comment:'agent id'"`
+	QPS                   int             `json:"qps" gorm:"type:int;not null;default:10;comment:'agent qps limit'"`
+	Enabled               bool            `json:"enabled" gorm:"type:boolean;not null;default:true;comment:'whether to enable'"`
+	Description           string          `json:"description" gorm:"type:text;comment:'description'"`
+	SupportStreaming      bool            `json:"support_streaming" gorm:"type:boolean;not null;default:true;comment:'whether to support streaming response'"`
+	ResponseFormat        string          `json:"response_format" gorm:"type:varchar(50);not null;default:'openai';comment:'response format: openai or dify'"`
+	PromptPrice           float64         `json:"prompt_price" gorm:"type:decimal(12,6);not null;default:0;comment:'cost per 1K prompt tokens'"`
+	CompletionPrice       float64         `json:"completion_price" gorm:"type:decimal(12,6);not null;default:0;comment:'cost per 1K completion tokens'"`
+	MonthlyBudget         float64         `json:"monthly_budget" gorm:"type:decimal(14,4);not null;default:0;comment:'planned cost per calendar month, 0 means no budget'"`
+	HedgeAgentID          string          `json:"hedge_agent_id" gorm:"type:varchar(100);not null;default:'';comment:'agent that also receives the request when the first byte is late'"`
+	HedgeAfterMs          int             `json:"hedge_after_ms" gorm:"type:int;not null;default:0;comment:'milliseconds without a first byte before hedging, 0 disables'"`
+	ContinueOnInterrupt   bool            `json:"continue_on_interrupt" gorm:"type:boolean;not null;default:false;comment:'whether to ask the agent to continue a broken off stream'"`
+	ContextWindow         int             `json:"context_window" gorm:"type:int;not null;default:0;comment:'prompt and completion tokens the agent accepts, 0 disables the check'"`
+	ContextOverflow       string          `json:"context_overflow" gorm:"type:varchar(32);not null;default:'reject';comment:'reject, truncate_oldest or summarize'"`
+	PriorityOverride      bool            `json:"priority_override" gorm:"type:boolean;not null;default:false;comment:'whether requests with the connector key may set their queue priority'"`
+	QPSSharing            bool            `json:"qps_sharing" gorm:"type:boolean;not null;default:false;comment:'whether the qps is shared among the agent users by priority'"`
+	RecordMode            string          `json:"record_mode" gorm:"type:varchar(16);not null;default:'';comment:'upstream fixtures: empty, record or replay'"`
+	PrivacyMode           bool            `json:"privacy_mode" gorm:"type:boolean;not null;default:false;comment:'aggregation-only analytics: no prompts stored, only k-anonymized summaries'"`
+	MaxTemperature        float64         `json:"max_temperature" gorm:"type:decimal(4,2);not null;default:0;comment:'highest temperature clients may request, 0 disables the cap'"`
+	MaxTokensCap          int             `json:"max_tokens_cap" gorm:"type:int;not null;default:0;comment:'highest max_tokens clients may request, 0 disables the cap'"`
+	ForbiddenParameters   string          `json:"forbidden_parameters" gorm:"type:varchar(500);not null;default:'';comment:'comma separated request parameters clients may not set'"`
+	MaxMessages           int             `json:"max_messages" gorm:"type:int;not null;default:0;comment:'most messages of a chat request, 0 inherits the endpoint limit'"`
+	MaxMessageBytes       int             `json:"max_message_bytes" gorm:"type:int;not null;default:0;comment:'largest message or query in bytes, 0 inherits the endpoint limit'"`
+	MaxInputs             int             `json:"max_inputs" gorm:"type:int;not null;default:0;comment:'most dify inputs of a request, 0 inherits the endpoint limit'"`
+	GuardrailPolicy       string          `json:"guardrail_policy" gorm:"type:varchar(16);not null;default:'clamp';comment:'clamp or reject requests beyond the caps'"`
+	OutputFilter          string          `json:"output_filter" gorm:"type:varchar(100);not null;default:'';comment:'comma separated redaction rules applied to answers: email, phone, api_key, credit_card'"`
+	BlockedWords          string          `json:"blocked_words" gorm:"type:varchar(1000);not null;default:'';comment:'comma separated words the output filter matches in answers'"`
+	OutputFilterAction    string          `json:"output_filter_action" gorm:"type:varchar(16);not null;default:'redact';comment:'redact the matches or block answers the output filter matches'"`
+	RequireSignature      bool            `json:"require_signature" gorm:"type:boolean;not null;default:false;comment:'whether requests with the connector key must be hmac signed'"`
+	SigningSecret         string          `json:"-" gorm:"type:varchar(100);not null;default:'';comment:'hmac secret of signed requests, empty until generated'"`
+	StreamTokenRate       int             `json:"stream_token_rate" gorm:"type:int;not null;default:0;comment:'highest tokens per second streamed to clients, 0 disables pacing'"`
+	Passthrough           bool            `json:"passthrough" gorm:"type:boolean;not null;default:false;comment:'whether openai routes the connector does not implement are forwarded verbatim'"`
+	Tier                  string          `json:"tier" gorm:"type:varchar(50);not null;default:'';index;comment:'key tier of the connector key, empty enables every feature'"`
+	UserQPS               int             `json:"user_qps" gorm:"type:int;not null;default:0;comment:'qps of each user of the connector key, overrides user and system defaults, 0 inherits'"`
+	AccessSchedule        string          `json:"access_schedule" gorm:"type:varchar(500);not null;default:'';comment:'weekly windows the connector key may be used in, e.g. Mon-Fri 09:00-18:00, empty allows any time'"`
+	AccessTimezone        string          `json:"access_timezone" gorm:"type:varchar(64);not null;default:'';comment:'iana time zone of the access schedule, empty means utc'"`
+	QuotaPool             string          `json:"quota_pool" gorm:"type:varchar(50);not null;default:'';index;comment:'quota pool the connector key draws from, empty has no shared quota'"`
+	PoolTokenLimit        int64           `json:"pool_token_limit" gorm:"type:bigint;not null;default:0;comment:'tokens the key may draw from its pool per period, 0 leaves only the pool limit'"`
+	PoolRequestLimit      int64           `json:"pool_request_limit" gorm:"type:bigint;not null;default:0;comment:'requests the key may draw from its pool per period, 0 leaves only the pool limit'"`
+	AllowedUsers          string          `json:"-" gorm:"type:varchar(1000);not null;default:'';comment:'comma separated usernames that may call the agent'"`
+	AllowedRoles          string          `json:"-" gorm:"type:varchar(200);not null;default:'';comment:'comma separated user roles that may call the agent'"`
+	AllowedKeys           string          `json:"-" gorm:"type:varchar(1000);not null;default:'';comment:'comma separated connector key or playground token prefixes that may call the agent'"`
+	Namespace             string          `json:"namespace" gorm:"type:varchar(100);not null;default:'';index;comment:'sandbox namespace of a temporary agent, empty for production agents'"`
+	ExpiresAt             *time.Time      `json:"expires_at" gorm:"index;comment:'when a sandbox agent expires, null for production agents'"`
+	Version               int             `json:"version" gorm:"type:int;not null;default:1;comment:'incremented by every update, for optimistic locking'"`
+	CreatedAt             time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt             time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt             gorm.DeletedAt  `json:"-" gorm:"index"`
+}
+
+// Context overflow policies, applied to prompts beyond the agent's context window
+const (
+	ContextOverflowReject         = "reject"          // fail with a context length error
+	ContextOverflowTruncateOldest = "truncate_oldest" // drop the oldest messages
+	ContextOverflowSummarize      = "summarize"       // replace the oldest messages with a summary
+)
+
+// Guardrail policies, applied to requests beyond the agent's parameter caps
+const (
+	GuardrailPolicyClamp  = "clamp"  // lower values to the cap and drop forbidden parameters
+	GuardrailPolicyReject = "reject" // fail the request
+)
+
+// Output filter actions, applied to answers the agent's output filter matches
+const (
+	OutputFilterRedact = "redact" // mask the matched values
+	OutputFilterBlock  = "block"  // withhold the answer
+)
+
+// AgentQueueConfig per-agent queue override table
+type AgentQueueConfig struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID      string    `json:"agent_id" gorm:"type:varchar(100);not null;unique;comment:'agent id'"`
+	MaxQueueSize int64     `json:"max_queue_size" gorm:"type:bigint;not null;default:0;comment:'max queued requests, 0 means unlimited'"`
+	DefaultTTL   int64     `json:"default_ttl" gorm:"type:bigint;not null;default:0;comment:'queued request ttl in seconds, 0 means no expiry'"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PlaygroundToken restricted token for demos and trials, scoped to a single agent
+type PlaygroundToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string     `json:"name" gorm:"type:varchar(255);not null;comment:'token name'"`
+	Token       string     `json:"token,omitempty" gorm:"-"` // plaintext token, only set right after it is issued
+	TokenPrefix string     `json:"token_prefix" gorm:"type:varchar(32);not null;index;comment:'token prefix, used for lookup'"`
+	TokenHash   string     `json:"-" gorm:"type:varchar(64);not null;comment:'sha-256 of the token'"`
+	AgentID     string     `json:"agent_id" gorm:"type:varchar(100);not null;index;comment:'the only agent the token can call'"`
+	QPS         int        `json:"qps" gorm:"type:int;not null;default:1;comment:'token qps limit'"`
+	MaxTokens   int        `json:"max_tokens" gorm:"type:int;not null;default:0;comment:'max tokens per response, 0 means no cap'"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null;index;comment:'expiry time'"`
+	Revoked     bool       `json:"revoked" gorm:"type:boolean;not null;default:false;comment:'whether the token was revoked'"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// NotificationChannel destination of platform event notifications (Slack or Teams webhook)
+type NotificationChannel struct {
+	ID         uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string     `json:"name" gorm:"type:varchar(255);not null;unique;comment:'channel name'"`
+	Type       string     `json:"type" gorm:"type:varchar(20);not null;comment:'channel type: slack, teams or email'"`
+	WebhookURL string     `json:"-" gorm:"type:varchar(1024);not null;default:'';comment:'incoming webhook url, empty for email'"`
+	EventTypes string     `json:"event_types" gorm:"type:varchar(500);not null;comment:'comma separated event types'"`
+	AgentIDs   string     `json:"agent_ids" gorm:"type:text;comment:'comma separated agent ids, empty means all agents'"`
+	Enabled    bool       `json:"enabled" gorm:"type:boolean;not null;default:true;comment:'whether to enable'"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	LastError  string     `json:"last_error" gorm:"type:text;comment:'error of the last delivery, empty when it succeeded'"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// email channels only
+	DigestInterval int                     `json:"digest_interval" gorm:"type:int;not null;default:60;comment:'minutes between digest mails'"`
+	Recipients     []NotificationRecipient `json:"recipients,omitempty" gorm:"foreignKey:ChannelID"`
+}
+
+// NotificationRecipient email address subscribed to an email notification channel
+type NotificationRecipient struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ChannelID  uint      `json:"channel_id" gorm:"not null;index;comment:'notification channel id'"`
+	Email      string    `json:"email" gorm:"type:varchar(255);not null;comment:'recipient email address'"`
+	EventTypes string    `json:"event_types" gorm:"type:varchar(500);comment:'comma separated event types, empty means those of the channel'"`
+	Digest     bool      `json:"digest" gorm:"type:boolean;not null;default:false;comment:'whether to batch notifications into digest mails'"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// MaintenanceWindow scheduled maintenance of one agent or, without agent, of all agents
+type MaintenanceWindow struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null;comment:'maintenance window name'"`
+	AgentID   string    `json:"agent_id" gorm:"type:varchar(100);not null;default:'';index;comment:'agent id, empty means all agents'"`
+	StartsAt  time.Time `json:"starts_at" gorm:"not null;index;comment:'start of the maintenance'"`
+	EndsAt    time.Time `json:"ends_at" gorm:"not null;index;comment:'expected end of the maintenance'"`
+	Message   string    `json:"message" gorm:"type:varchar(500);comment:'message returned to clients during the maintenance'"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// KeyTier plan of connector keys, the request features its agents' keys may use
+type KeyTier struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string    `json:"name" gorm:"type:varchar(50);not null;unique;comment:'tier name, referenced by agents'"`
+	Description string    `json:"description" gorm:"type:varchar(500);comment:'description'"`
+	Streaming   bool      `json:"streaming" gorm:"type:boolean;not null;default:true;comment:'whether streamed responses are allowed'"`
+	Tools       bool      `json:"tools" gorm:"type:boolean;not null;default:true;comment:'whether tools and function calling are allowed'"`
+	Vision      bool      `json:"vision" gorm:"type:boolean;not null;default:true;comment:'whether image inputs are allowed'"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// QuotaPool token and request budget shared by the connector keys of a team, the agents
+// draw from it by name
+type QuotaPool struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name         string    `json:"name" gorm:"type:varchar(50);not null;unique;comment:'pool name, referenced by agents'"`
+	Description  string    `json:"description" gorm:"type:varchar(500);comment:'description'"`
+	Period       string    `json:"period" gorm:"type:varchar(10);not null;default:'month';comment:'day or month, in utc'"`
+	TokenLimit   int64     `json:"token_limit" gorm:"type:bigint;not null;default:0;comment:'tokens the keys may use together per period, 0 means unlimited'"`
+	RequestLimit int64     `json:"request_limit" gorm:"type:bigint;not null;default:0;comment:'requests the keys may make together per period, 0 means unlimited'"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// GoldenPrompt prompt of an agent with its approved reference answer, rerun to catch
+// regressions of the agent's answers
+type GoldenPrompt struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID       string    `json:"agent_id" gorm:"type:varchar(100);not null;index;comment:'agent id'"`
+	Name          string    `json:"name" gorm:"type:varchar(100);not null;comment:'golden prompt name'"`
+	Prompt        string    `json:"prompt" gorm:"type:text;not null;comment:'user message, Dify query or workflow inputs as JSON'"`
+	Inputs        string    `json:"inputs" gorm:"type:text;comment:'Dify chat inputs as JSON'"`
+	Reference     string    `json:"reference" gorm:"type:mediumtext;not null;comment:'approved reference answer'"`
+	MinSimilarity float64   `json:"min_similarity" gorm:"not null;default:0.8;comment:'similarity below which an answer is a regression'"`
+	Enabled       bool      `json:"enabled" gorm:"type:boolean;not null;default:true;comment:'whether runs include the prompt'"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// GoldenRun one run of the golden prompts of an agent
+type GoldenRun struct {
+	ID         uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID    string          `json:"agent_id" gorm:"type:varchar(100);not null;index;comment:'agent id'"`
+	Trigger    string          `json:"trigger" gorm:"column:triggered_by;type:varchar(20);not null;comment:'manual or agent_update'"`
+	Status     string          `json:"status" gorm:"type:varchar(20);not null;index;comment:'running, passed, regressed or failed'"`
+	Total      int             `json:"total" gorm:"not null;default:0;comment:'prompts run'"`
+	Passed     int             `json:"passed" gorm:"not null;default:0;comment:'answers similar enough to the reference'"`
+	Regressed  int             `json:"regressed" gorm:"not null;default:0;comment:'answers below the minimum similarity'"`
+	Errored    int             `json:"errored" gorm:"not null;default:0;comment:'prompts the agent failed to answer'"`
+	StartedAt  time.Time       `json:"started_at" gorm:"not null;index;comment:'start of the run'"`
+	FinishedAt *time.Time      `json:"finished_at" gorm:"comment:'end of the run'"`
+	Results    []*GoldenResult `json:"results,omitempty" gorm:"foreignKey:RunID;constraint:OnDelete:CASCADE"`
+}
+
+// GoldenResult the answer to one golden prompt in a run, compared to the reference
+type GoldenResult struct {
+	ID            uint    `json:"id" gorm:"primaryKey;autoIncrement"`
+	RunID         uint    `json:"run_id" gorm:"not null;index;comment:'golden run id'"`
+	PromptID      uint    `json:"prompt_id" gorm:"not null;index;comment:'golden prompt id'"`
+	PromptName    string  `json:"prompt_name" gorm:"type:varchar(100);comment:'golden prompt name at the time of the run'"`
+	Reference     string  `json:"reference" gorm:"type:mediumtext;comment:'reference answer at the time of the run'"`
+	Response      string  `json:"response" gorm:"type:mediumtext;comment:'answer of the agent'"`
+	Similarity    float64 `json:"similarity" gorm:"not null;default:0;comment:'similarity of the answer to the reference, 0 to 1'"`
+	MinSimilarity float64 `json:"min_similarity" gorm:"not null;default:0;comment:'minimum similarity at the time of the run'"`
+	Passed        bool    `json:"passed" gorm:"type:boolean;not null;default:false;comment:'whether the answer reached the minimum similarity'"`
+	Error         string  `json:"error" gorm:"type:varchar(500);comment:'why the agent did not answer'"`
+	DurationMs    int64   `json:"duration_ms" gorm:"not null;default:0;comment:'duration of the request'"`
+}
+
+// UsageOutcomeClientCancelled outcome of a request whose client went away before the
+// response was complete; such requests are not counted as failed
+const UsageOutcomeClientCancelled = "client_cancelled"
+
+// UsageRecord one proxied dataflow request with the metadata the client attached
+type UsageRecord struct {
+	ID                uint                `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID           string              `json:"agent_id" gorm:"type:varchar(100);not null;index:idx_usage_agent_created;comment:'agent id'"`
+	PlaygroundTokenID *uint               `json:"playground_token_id,omitempty" gorm:"index;comment:'playground token that made the request'"`
+	Path              string              `json:"path" gorm:"type:varchar(200);comment:'dataflow route'"`
+	Stream            bool                `json:"stream" gorm:"type:boolean;not null;default:false"`
+	Success           bool                `json:"success" gorm:"type:boolean;not null;default:false"`
+	Outcome           string              `json:"outcome" gorm:"type:varchar(32);not null;default:'';index;comment:'success, failed or client_cancelled'"`
+	Error             string              `json:"error,omitempty" gorm:"type:text"`
+	DurationMs        int64               `json:"duration_ms" gorm:"not null;default:0"`
+	PromptTokens      int                 `json:"prompt_tokens" gorm:"not null;default:0"`
+	CompletionTokens  int                 `json:"completion_tokens" gorm:"not null;default:0"`
+	TotalTokens       int                 `json:"total_tokens" gorm:"not null;default:0"`
+	Cost              float64             `json:"cost" gorm:"type:decimal(16,6);not null;default:0;comment:'cost at the agent prices of the time of the request'"`
+	Metadata          string              `json:"metadata" gorm:"type:text;comment:'client metadata as JSON object'"`
+	Tags              []UsageRecordTag    `json:"-" gorm:"foreignKey:UsageRecordID"`
+	Content           *UsageRecordContent `json:"content,omitempty" gorm:"foreignKey:UsageRecordID"`
+	Scores            []*UsageRecordScore `json:"scores,omitempty" gorm:"foreignKey:UsageRecordID"`
+	CreatedAt         time.Time           `json:"created_at" gorm:"autoCreateTime;index:idx_usage_agent_created;index"`
+}
+
+// UsageRecordTag one metadata key/value of a usage record, indexed for report filters
+type UsageRecordTag struct {
+	ID            uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	UsageRecordID uint   `json:"usage_record_id" gorm:"not null;index"`
+	TagKey        string `json:"key" gorm:"type:varchar(64);not null;index:idx_usage_tag;comment:'metadata key'"`
+	TagValue      string `json:"value" gorm:"type:varchar(255);not null;index:idx_usage_tag;comment:'metadata value, truncated to 255 characters'"`
+}
+
+// UsageRecordScore the judge's score of a sampled response on one rubric
+type UsageRecordScore struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UsageRecordID uint      `json:"usage_record_id" gorm:"not null;index"`
+	AgentID       string    `json:"agent_id" gorm:"type:varchar(100);not null;index:idx_usage_score_agent;comment:'agent that answered'"`
+	Rubric        string    `json:"rubric" gorm:"type:varchar(64);not null;index:idx_usage_score_agent;comment:'criterion the response was scored on'"`
+	Score         float64   `json:"score" gorm:"type:double;not null;default:0;comment:'1 (poor) to 5 (excellent)'"`
+	Reason        string    `json:"reason" gorm:"type:varchar(500);comment:'judge explanation'"`
+	JudgeAgentID  string    `json:"judge_agent_id" gorm:"type:varchar(100);comment:'agent that scored the response'"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// UsageRecordContent prompt and response text of a usage record, stored when content
+// recording is enabled
+type UsageRecordContent struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UsageRecordID uint      `json:"usage_record_id" gorm:"not null;uniqueIndex"`
+	Request       string    `json:"request" gorm:"type:mediumtext;comment:'prompt, messages or workflow inputs'"`
+	Response      string    `json:"response" gorm:"type:mediumtext;comment:'response text, streamed responses are joined'"`
+	Parameters    string    `json:"parameters" gorm:"type:mediumtext;comment:'request fields besides the prompt as json, used to replay the request'"`
+	Truncated     bool      `json:"truncated" gorm:"type:boolean;not null;default:false;comment:'whether the text was cut at the size limit'"`
+	KeyID         uint      `json:"-" gorm:"not null;default:0;index;comment:'content key the text is encrypted with, 0 for plaintext'"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ContentKey data key encrypting the stored usage content of one agent, kept wrapped
+// by a master key; retired keys only decrypt until their content is re-encrypted
+type ContentKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID     string     `json:"agent_id" gorm:"type:varchar(100);not null;index;comment:'agent id'"`
+	MasterKeyID string     `json:"master_key_id" gorm:"type:varchar(64);not null;comment:'master key the data key is wrapped with'"`
+	WrappedKey  string     `json:"-" gorm:"type:varchar(255);not null;comment:'data key sealed with the master key'"`
+	RetiredAt   *time.Time `json:"retired_at" gorm:"index;comment:'when the key stopped encrypting new content'"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
 // GetAgentType returns the agent type as string
@@ -41,6 +333,48 @@ func (a *Agent) GetAgentType() string {
 	return string(a.Type)
 }
 
+// ForbiddenParameterList request parameters clients may not set, trimmed and lower case
+func (a *Agent) ForbiddenParameterList() []string {
+	var parameters []string
+	for _, parameter := range strings.Split(a.ForbiddenParameters, ",") {
+		if parameter = strings.ToLower(strings.TrimSpace(parameter)); parameter != "" {
+			parameters = append(parameters, parameter)
+		}
+	}
+	return parameters
+}
+
+// OutputFilterRules redaction rules of the output filter, trimmed and lower case
+func (a *Agent) OutputFilterRules() []string {
+	var rules []string
+	for _, rule := range strings.Split(a.OutputFilter, ",") {
+		if rule = strings.ToLower(strings.TrimSpace(rule)); rule != "" && !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// BlockedWordList words the output filter matches, trimmed
+func (a *Agent) BlockedWordList() []string {
+	var words []string
+	for _, word := range strings.Split(a.BlockedWords, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// ACL users, roles and keys allowed to call the agent, empty when everyone may
+func (a *Agent) ACL() acl.List {
+	return acl.List{
+		Users: acl.Split(a.AllowedUsers),
+		Roles: acl.Split(a.AllowedRoles),
+		Keys:  acl.Split(a.AllowedKeys),
+	}
+}
+
 // TableName specify table name
 func (Agent) TableName() string {
 	return "agents"
@@ -49,3 +383,55 @@ func (Agent) TableName() string {
 func (SystemConfig) TableName() string {
 	return "system_configs"
 }
+
+func (AgentQueueConfig) TableName() string {
+	return "agent_queue_configs"
+}
+
+func (PlaygroundToken) TableName() string {
+	return "playground_tokens"
+}
+
+func (NotificationChannel) TableName() string {
+	return "notification_channels"
+}
+
+func (NotificationRecipient) TableName() string {
+	return "notification_recipients"
+}
+
+func (MaintenanceWindow) TableName() string {
+	return "maintenance_windows"
+}
+
+func (KeyTier) TableName() string {
+	return "key_tiers"
+}
+
+func (QuotaPool) TableName() string {
+	return "quota_pools"
+}
+
+func (GoldenPrompt) TableName() string {
+	return "golden_prompts"
+}
+
+func (GoldenRun) TableName() string {
+	return "golden_runs"
+}
+
+func (GoldenResult) TableName() string {
+	return "golden_results"
+}
+
+func (UsageRecord) TableName() string {
+	return "usage_records"
+}
+
+func (UsageRecordTag) TableName() string {
+	return "usage_record_tags"
+}
+
+func (UsageRecordScore) TableName() string {
+	return "usage_record_scores"
+}
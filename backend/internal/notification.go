@@ -0,0 +1,425 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/notify"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDigestInterval = 60 // minutes
+	minDigestInterval     = 5  // minutes
+)
+
+// EventTypeList subscribed event types
+func (n *NotificationChannel) EventTypeList() []string {
+	return splitList(n.EventTypes)
+}
+
+// AgentIDList agents the channel is restricted to, empty means all agents
+func (n *NotificationChannel) AgentIDList() []string {
+	return splitList(n.AgentIDs)
+}
+
+// IsEmail report whether the channel sends mails instead of posting to a webhook
+func (n *NotificationChannel) IsEmail() bool {
+	return notify.ChannelType(n.Type) == notify.EmailChannel
+}
+
+// Subscribes report whether the channel wants the event, for email channels
+// the recipients may narrow or widen the event types further
+func (n *NotificationChannel) Subscribes(event events.Event) bool {
+	if !n.Enabled {
+		return false
+	}
+
+	agentIDs := n.AgentIDList()
+	if len(agentIDs) > 0 && !containsString(agentIDs, event.Subject) {
+		return false
+	}
+
+	if n.IsEmail() {
+		for i := range n.Recipients {
+			if n.Recipients[i].Subscribes(n, event) {
+				return true
+			}
+		}
+		return false
+	}
+	return containsString(n.EventTypeList(), string(event.Type))
+}
+
+// MaskedWebhookURL webhook URL with the secret path hidden
+func (n *NotificationChannel) MaskedWebhookURL() string {
+	if n.WebhookURL == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(n.WebhookURL)
+	if err != nil || parsed.Host == "" {
+		return maskSecret(n.WebhookURL)
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/****"
+}
+
+// EventTypeList event types of the recipient, empty means those of the channel
+func (r *NotificationRecipient) EventTypeList() []string {
+	return splitList(r.EventTypes)
+}
+
+// Subscribes report whether the recipient wants the event
+func (r *NotificationRecipient) Subscribes(channel *NotificationChannel, event events.Event) bool {
+	eventTypes := r.EventTypeList()
+	if len(eventTypes) == 0 {
+		eventTypes = channel.EventTypeList()
+	}
+	return containsString(eventTypes, string(event.Type))
+}
+
+// NotificationChannelService notification channel service
+type NotificationChannelService struct{}
+
+// notificationChannelListSpec searchable, filterable and sortable columns of the channel list
+var notificationChannelListSpec = listQuerySpec{
+	searchColumns: []string{"name", "event_types"},
+	typeColumn:    "type",
+	sortColumns: map[string]string{
+		"name":         "name",
+		"type":         "type",
+		"last_sent_at": "last_sent_at",
+		"created_at":   "created_at",
+	},
+	defaultSort: "created_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch status {
+		case "enabled":
+			return db.Where("enabled = ?", true), nil
+		case "disabled":
+			return db.Where("enabled = ?", false), nil
+		case "failing":
+			return db.Where("last_error <> ''"), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
+// CreateNotificationChannel create notification channel together with its recipients
+func (s *NotificationChannelService) CreateNotificationChannel(channel *NotificationChannel) error {
+	if err := s.validateNotificationChannel(channel); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := DB.Model(&NotificationChannel{}).Where("name = ?", channel.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("notification channel name already exists")
+	}
+
+	return DB.Create(channel).Error
+}
+
+// GetNotificationChannel get notification channel
+func (s *NotificationChannelService) GetNotificationChannel(id uint) (*NotificationChannel, error) {
+	var channel NotificationChannel
+	err := DB.Preload("Recipients").First(&channel, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("notification channel not found")
+		}
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// ListNotificationChannels get notification channel list
+func (s *NotificationChannelService) ListNotificationChannels(listQuery *ListQuery) ([]*NotificationChannel, int64, error) {
+	var channels []*NotificationChannel
+	var total int64
+
+	query, err := listQuery.filter(DB.Model(&NotificationChannel{}), notificationChannelListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, notificationChannelListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Preload("Recipients").Find(&channels).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return channels, total, nil
+}
+
+// UpdateNotificationChannel update notification channel and replace its recipients,
+// an empty webhook URL keeps the stored one
+func (s *NotificationChannelService) UpdateNotificationChannel(id uint, channel *NotificationChannel) error {
+	existing, err := s.GetNotificationChannel(id)
+	if err != nil {
+		return err
+	}
+
+	if channel.WebhookURL == "" && channel.Type == existing.Type {
+		channel.WebhookURL = existing.WebhookURL
+	}
+	if err := s.validateNotificationChannel(channel); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := DB.Model(&NotificationChannel{}).Where("name = ? AND id <> ?", channel.Name, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("notification channel name already exists")
+	}
+
+	channel.ID = id
+	channel.LastSentAt = existing.LastSentAt
+	channel.LastError = existing.LastError
+	channel.CreatedAt = existing.CreatedAt
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Recipients").Save(channel).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("channel_id = ?", id).Delete(&NotificationRecipient{}).Error; err != nil {
+			return err
+		}
+		for i := range channel.Recipients {
+			channel.Recipients[i].ID = 0
+			channel.Recipients[i].ChannelID = id
+		}
+		if len(channel.Recipients) > 0 {
+			return tx.Create(&channel.Recipients).Error
+		}
+		return nil
+	})
+}
+
+// DeleteNotificationChannel delete notification channel and its recipients
+func (s *NotificationChannelService) DeleteNotificationChannel(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&NotificationChannel{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errors.New("notification channel not found")
+		}
+
+		return tx.Where("channel_id = ?", id).Delete(&NotificationRecipient{}).Error
+	})
+}
+
+// SendTestNotification send a test message through the channel, to every recipient
+// of an email channel, and record the outcome
+func (s *NotificationChannelService) SendTestNotification(ctx context.Context, id uint) error {
+	channel, err := s.GetNotificationChannel(id)
+	if err != nil {
+		return err
+	}
+
+	msg := notify.Message{
+		Title:    "Test notification",
+		Text:     fmt.Sprintf("Notification channel %s is configured correctly.", channel.Name),
+		Severity: notify.SeverityInfo,
+		Source:   "control-flow-api",
+		Time:     time.Now(),
+	}
+
+	if channel.IsEmail() {
+		err = s.sendTestEmails(ctx, channel, msg)
+	} else {
+		err = notify.NewWebhookSender(nil).Send(ctx, notify.ChannelType(channel.Type), channel.WebhookURL, msg)
+	}
+
+	s.recordDelivery(channel.ID, err)
+	return err
+}
+
+// sendTestEmails mail the test message to every recipient, stopping at the first failure
+func (s *NotificationChannelService) sendTestEmails(ctx context.Context, channel *NotificationChannel, msg notify.Message) error {
+	sender, err := newEmailSender()
+	if err != nil {
+		return err
+	}
+	email, err := notify.RenderEmail(msg)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range channel.Recipients {
+		if err := sender.Send(ctx, recipient.Email, email); err != nil {
+			return fmt.Errorf("%s: %w", recipient.Email, err)
+		}
+	}
+	return nil
+}
+
+// listEnabledNotificationChannels get every enabled channel with its recipients
+func (s *NotificationChannelService) listEnabledNotificationChannels() ([]*NotificationChannel, error) {
+	var channels []*NotificationChannel
+	err := DB.Preload("Recipients").Where("enabled = ?", true).Find(&channels).Error
+	return channels, err
+}
+
+// recordDelivery store the time and error of the last delivery
+func (s *NotificationChannelService) recordDelivery(id uint, deliveryErr error) {
+	updates := map[string]interface{}{
+		"last_sent_at": time.Now(),
+		"last_error":   "",
+	}
+	if deliveryErr != nil {
+		updates["last_error"] = deliveryErr.Error()
+	}
+
+	if err := DB.Model(&NotificationChannel{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record delivery of notification channel %d: %v", id, err)
+	}
+}
+
+// validateNotificationChannel validate notification channel
+func (s *NotificationChannelService) validateNotificationChannel(channel *NotificationChannel) error {
+	if strings.TrimSpace(channel.Name) == "" {
+		return errors.New("notification channel name cannot be empty")
+	}
+
+	eventTypes, err := validateEventTypes(channel.EventTypeList())
+	if err != nil {
+		return err
+	}
+	if len(eventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	channel.EventTypes = strings.Join(eventTypes, ",")
+	channel.AgentIDs = strings.Join(channel.AgentIDList(), ",")
+
+	switch notify.ChannelType(channel.Type) {
+	case notify.SlackChannel, notify.TeamsChannel:
+		if len(channel.Recipients) > 0 {
+			return errors.New("recipients are only supported by email channels")
+		}
+		parsed, err := url.Parse(channel.WebhookURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return errors.New("webhook URL must be an http or https URL")
+		}
+	case notify.EmailChannel:
+		return s.validateEmailChannel(channel)
+	default:
+		return fmt.Errorf("unsupported notification channel type: %s", channel.Type)
+	}
+	return nil
+}
+
+// validateEmailChannel validate the recipients and digest settings of an email channel
+func (s *NotificationChannelService) validateEmailChannel(channel *NotificationChannel) error {
+	if _, err := newEmailSender(); err != nil {
+		return err
+	}
+
+	channel.WebhookURL = ""
+	if channel.DigestInterval == 0 {
+		channel.DigestInterval = defaultDigestInterval
+	}
+	if channel.DigestInterval < minDigestInterval {
+		return fmt.Errorf("digest interval must be at least %d minutes", minDigestInterval)
+	}
+
+	if len(channel.Recipients) == 0 {
+		return errors.New("email channels need at least one recipient")
+	}
+
+	seen := make(map[string]bool)
+	for i := range channel.Recipients {
+		recipient := &channel.Recipients[i]
+
+		address, err := mail.ParseAddress(recipient.Email)
+		if err != nil {
+			return fmt.Errorf("invalid recipient email: %s", recipient.Email)
+		}
+		recipient.Email = strings.ToLower(address.Address)
+		if seen[recipient.Email] {
+			return fmt.Errorf("duplicate recipient email: %s", recipient.Email)
+		}
+		seen[recipient.Email] = true
+
+		eventTypes, err := validateEventTypes(recipient.EventTypeList())
+		if err != nil {
+			return err
+		}
+		recipient.EventTypes = strings.Join(eventTypes, ",")
+	}
+	return nil
+}
+
+// validateEventTypes reject event types the platform does not emit
+func validateEventTypes(eventTypes []string) ([]string, error) {
+	for _, eventType := range eventTypes {
+		if !events.IsKnownType(events.Type(eventType)) {
+			return nil, fmt.Errorf("unknown event type: %s", eventType)
+		}
+	}
+	return eventTypes, nil
+}
+
+// newEmailSender create an email sender from the SMTP configuration
+func newEmailSender() (*notify.EmailSender, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.SMTP.Host == "" {
+		return nil, errors.New("SMTP is not configured, set SMTP_HOST and SMTP_FROM to use email channels")
+	}
+
+	return notify.NewEmailSender(notify.SMTPConfig{
+		Host:        cfg.SMTP.Host,
+		Port:        cfg.SMTP.Port,
+		Username:    cfg.SMTP.Username,
+		Password:    cfg.SMTP.Password,
+		From:        cfg.SMTP.From,
+		ImplicitTLS: cfg.SMTP.ImplicitTLS,
+	})
+}
+
+// splitList split a comma separated column, dropping blanks and duplicates
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !containsString(items, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// containsString report whether items contains value
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
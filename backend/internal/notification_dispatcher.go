@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/notify"
+)
+
+const (
+	// notificationChannelRefresh how long the dispatcher caches the enabled channels
+	notificationChannelRefresh = 30 * time.Second
+
+	// notificationCooldown minimum time between two identical notifications on a channel
+	notificationCooldown = 5 * time.Minute
+
+	// digestFlushInterval how often pending digests are checked for being due
+	digestFlushInterval = time.Minute
+
+	// maxDigestMessages caps a digest, later notifications are only counted
+	maxDigestMessages = 100
+)
+
+// pendingDigest notifications collected for one digest recipient
+type pendingDigest struct {
+	channelID uint
+	email     string
+	interval  time.Duration
+	started   time.Time
+	messages  []notify.Message
+	dropped   int
+}
+
+// NotificationDispatcher events.Publisher that delivers subscribed events to the notification channels
+type NotificationDispatcher struct {
+	service     *NotificationChannelService
+	sender      *notify.WebhookSender
+	mailer      *notify.EmailSender
+	maintenance *MaintenanceChecker
+
+	mu       sync.Mutex
+	channels []*NotificationChannel
+	loadedAt time.Time
+	lastSent map[string]time.Time
+	digests  map[uint]*pendingDigest
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewNotificationDispatcher create notification dispatcher, email channels are
+// skipped when SMTP is not configured
+func NewNotificationDispatcher() *NotificationDispatcher {
+	d := &NotificationDispatcher{
+		service:     &NotificationChannelService{},
+		sender:      notify.NewWebhookSender(nil),
+		maintenance: NewMaintenanceChecker(),
+		lastSent:    make(map[string]time.Time),
+		digests:     make(map[uint]*pendingDigest),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	if mailer, err := newEmailSender(); err == nil {
+		d.mailer = mailer
+	}
+
+	go d.runDigests()
+	return d
+}
+
+// Publish deliver the event to every subscribed channel, identical notifications
+// within the cooldown are skipped so a flapping limit does not flood the channel,
+// and agent health alerts are silenced during maintenance windows
+func (d *NotificationDispatcher) Publish(ctx context.Context, event events.Event) error {
+	if d.maintenance.Silences(event) {
+		return nil
+	}
+
+	channels, err := d.enabledChannels()
+	if err != nil {
+		return fmt.Errorf("failed to load notification channels: %w", err)
+	}
+
+	var msg *notify.Message
+	var firstErr error
+	for _, channel := range channels {
+		if !channel.Subscribes(event) || !d.claim(channel.ID, event) {
+			continue
+		}
+
+		if msg == nil {
+			built := notify.MessageFromEvent(event)
+			msg = &built
+		}
+
+		if channel.IsEmail() {
+			err = d.deliverEmail(ctx, channel, event, *msg)
+		} else {
+			err = d.sender.Send(ctx, notify.ChannelType(channel.Type), channel.WebhookURL, *msg)
+			d.service.recordDelivery(channel.ID, err)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("notification channel %s: %w", channel.Name, err)
+		}
+	}
+
+	return firstErr
+}
+
+// Close stop the digest loop and send the digests collected so far
+func (d *NotificationDispatcher) Close() error {
+	close(d.stop)
+	<-d.done
+
+	d.flushDigests(true)
+	return nil
+}
+
+// deliverEmail mail the message to the immediate recipients and queue it for the digest ones
+func (d *NotificationDispatcher) deliverEmail(ctx context.Context, channel *NotificationChannel, event events.Event, msg notify.Message) error {
+	if d.mailer == nil {
+		return fmt.Errorf("SMTP is not configured")
+	}
+
+	var email *notify.Email
+	var firstErr error
+	sent := false
+	for i := range channel.Recipients {
+		recipient := &channel.Recipients[i]
+		if !recipient.Subscribes(channel, event) {
+			continue
+		}
+
+		if recipient.Digest {
+			d.queueDigest(channel, recipient, msg)
+			continue
+		}
+
+		if email == nil {
+			rendered, err := notify.RenderEmail(msg)
+			if err != nil {
+				return err
+			}
+			email = rendered
+		}
+
+		sent = true
+		if err := d.mailer.Send(ctx, recipient.Email, email); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", recipient.Email, err)
+		}
+	}
+
+	if sent {
+		d.service.recordDelivery(channel.ID, firstErr)
+	}
+	return firstErr
+}
+
+// queueDigest add the message to the pending digest of the recipient
+func (d *NotificationDispatcher) queueDigest(channel *NotificationChannel, recipient *NotificationRecipient, msg notify.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest, ok := d.digests[recipient.ID]
+	if !ok {
+		digest = &pendingDigest{
+			channelID: channel.ID,
+			email:     recipient.Email,
+			interval:  time.Duration(channel.DigestInterval) * time.Minute,
+			started:   time.Now(),
+		}
+		d.digests[recipient.ID] = digest
+	}
+
+	if len(digest.messages) >= maxDigestMessages {
+		digest.dropped++
+		return
+	}
+	digest.messages = append(digest.messages, msg)
+}
+
+// runDigests periodically send the digests whose interval elapsed
+func (d *NotificationDispatcher) runDigests() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(digestFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.flushDigests(false)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// flushDigests send the due digests, or all of them when force is set
+func (d *NotificationDispatcher) flushDigests(force bool) {
+	now := time.Now()
+
+	d.mu.Lock()
+	var due []*pendingDigest
+	for id, digest := range d.digests {
+		if force || now.Sub(digest.started) >= digest.interval {
+			due = append(due, digest)
+			delete(d.digests, id)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, digest := range due {
+		messages := digest.messages
+		if digest.dropped > 0 {
+			messages = append(messages, notify.Message{
+				Title:    "More notifications",
+				Text:     fmt.Sprintf("%d further notifications were left out of this digest.", digest.dropped),
+				Severity: notify.SeverityInfo,
+				Time:     now,
+			})
+		}
+
+		email, err := notify.RenderDigest(messages)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err = d.mailer.Send(ctx, digest.email, email)
+			cancel()
+		}
+		if err != nil {
+			log.Printf("Failed to send notification digest to %s: %v", digest.email, err)
+			err = fmt.Errorf("%s: %w", digest.email, err)
+		}
+		d.service.recordDelivery(digest.channelID, err)
+	}
+}
+
+// enabledChannels cached list of enabled channels
+func (d *NotificationDispatcher) enabledChannels() ([]*NotificationChannel, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.channels != nil && time.Since(d.loadedAt) < notificationChannelRefresh {
+		return d.channels, nil
+	}
+
+	channels, err := d.service.listEnabledNotificationChannels()
+	if err != nil {
+		return nil, err
+	}
+	d.channels = channels
+	d.loadedAt = time.Now()
+	return channels, nil
+}
+
+// claim reserve the cooldown slot of an event on a channel, false when one was sent recently
+func (d *NotificationDispatcher) claim(channelID uint, event events.Event) bool {
+	// the severity is part of the key so a recovery is not swallowed by the outage notification
+	key := fmt.Sprintf("%d|%s|%s|%s", channelID, event.Type, event.Subject, notify.MessageFromEvent(event).Severity)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := d.lastSent[key]; ok && now.Sub(last) < notificationCooldown {
+		return false
+	}
+	d.lastSent[key] = now
+
+	for k, last := range d.lastSent {
+		if now.Sub(last) >= notificationCooldown {
+			delete(d.lastSent, k)
+		}
+	}
+	return true
+}
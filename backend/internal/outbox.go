@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"agent-connector/pkg/events"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// outboxPollInterval how often the dispatcher looks for pending events
+	outboxPollInterval = time.Second
+
+	// outboxBatchSize events claimed at once
+	outboxBatchSize = 10
+
+	// outboxLease how long a claimed batch is reserved for the claiming dispatcher, long
+	// enough to publish the whole batch; a crashed dispatcher's batch is retried afterwards
+	outboxLease = 5 * time.Minute
+
+	// outboxPublishTimeout limit of one delivery
+	outboxPublishTimeout = 20 * time.Second
+
+	// outboxMaxAttempts deliveries before an event is given up
+	outboxMaxAttempts = 12
+
+	// outboxRetryDelay delay before the first retry, doubling up to outboxMaxRetryDelay
+	outboxRetryDelay    = 5 * time.Second
+	outboxMaxRetryDelay = 30 * time.Minute
+
+	// outboxRetention how long delivered and failed events are kept
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// OutboxEvent platform event stored in the transaction of the change it announces and
+// delivered afterwards by the OutboxDispatcher, so a crash cannot lose it
+type OutboxEvent struct {
+	ID            uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	EventID       string     `json:"event_id" gorm:"type:varchar(64);not null;uniqueIndex;comment:'id of the event, stable across retries'"`
+	Type          string     `json:"type" gorm:"type:varchar(100);not null;comment:'event type'"`
+	Payload       string     `json:"payload" gorm:"type:mediumtext;not null;comment:'event as delivered'"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0;comment:'failed deliveries'"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbox_pending,priority:2;comment:'earliest time of the next delivery'"`
+	ClaimedBy     string     `json:"-" gorm:"type:varchar(32);not null;default:'';index;comment:'claim token of the dispatcher delivering the event'"`
+	ClaimedUntil  *time.Time `json:"-" gorm:"comment:'end of the delivery lease'"`
+	DeliveredAt   *time.Time `json:"delivered_at" gorm:"index:idx_outbox_pending,priority:1"`
+	FailedAt      *time.Time `json:"failed_at" gorm:"comment:'when delivery was given up'"`
+	LastError     string     `json:"last_error" gorm:"type:text;comment:'error of the last failed delivery'"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// eventSource names the running service in outbox events, set by InitEventPublisher
+var eventSource = "agent-connector"
+
+// outboxPublisher delivers outbox events synchronously, so failures are retried;
+// set by InitEventPublisher
+var outboxPublisher events.Publisher = events.NoopPublisher{}
+
+// newEvent an event of the running service
+func newEvent(eventType events.Type, subject string, data map[string]interface{}) events.Event {
+	return events.New(eventType, eventSource, subject, data)
+}
+
+// enqueueEvent store the event in the outbox as part of tx, it is delivered once tx commits
+func enqueueEvent(tx *gorm.DB, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+	return tx.Create(&OutboxEvent{
+		EventID:       event.ID,
+		Type:          string(event.Type),
+		Payload:       string(payload),
+		NextAttemptAt: event.Time,
+	}).Error
+}
+
+// OutboxDispatcher delivers the stored outbox events; several services may run one,
+// each batch is claimed by one dispatcher at a time. An event is delivered at least
+// once, subscribers deduplicate by the event ID.
+type OutboxDispatcher struct {
+	publisher events.Publisher
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// StartOutboxDispatcher deliver outbox events through the publisher installed by
+// InitEventPublisher until Close is called
+func StartOutboxDispatcher() *OutboxDispatcher {
+	d := &OutboxDispatcher{
+		publisher: outboxPublisher,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Close stop the dispatcher after the batch in progress
+func (d *OutboxDispatcher) Close() error {
+	close(d.stop)
+	<-d.done
+	return nil
+}
+
+// run poll for pending events, cleaning up old ones now and then
+func (d *OutboxDispatcher) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	var cleanedAt time.Time
+
+	for {
+		select {
+		case <-ticker.C:
+			// keep going while full batches are claimed
+			for {
+				claimed, err := d.dispatch()
+				if err != nil {
+					log.Printf("Outbox dispatch failed: %v", err)
+				}
+				if claimed < outboxBatchSize {
+					break
+				}
+				select {
+				case <-d.stop:
+					return
+				default:
+				}
+			}
+			if time.Since(cleanedAt) >= time.Hour {
+				d.cleanup()
+				cleanedAt = time.Now()
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// dispatch claim a batch of due events and deliver it, returning the number claimed
+func (d *OutboxDispatcher) dispatch() (int, error) {
+	now := time.Now()
+	token := generateRandomString(24)
+	result := DB.Model(&OutboxEvent{}).
+		Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+		Where("claimed_until IS NULL OR claimed_until < ?", now).
+		Order("id").
+		Limit(outboxBatchSize).
+		Updates(map[string]interface{}{
+			"claimed_by":    token,
+			"claimed_until": now.Add(outboxLease),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return 0, nil
+	}
+
+	var batch []*OutboxEvent
+	if err := DB.Where("claimed_by = ?", token).Order("id").Find(&batch).Error; err != nil {
+		return int(result.RowsAffected), fmt.Errorf("failed to load claimed outbox events: %w", err)
+	}
+	for _, entry := range batch {
+		d.deliver(entry)
+	}
+	return len(batch), nil
+}
+
+// deliver publish one event and record the outcome, scheduling a retry on failure
+func (d *OutboxDispatcher) deliver(entry *OutboxEvent) {
+	err := d.publish(entry)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"claimed_by":    "",
+		"claimed_until": nil,
+	}
+	if err == nil {
+		updates["delivered_at"] = now
+	} else {
+		attempts := entry.Attempts + 1
+		updates["attempts"] = attempts
+		updates["last_error"] = err.Error()
+		if attempts >= outboxMaxAttempts {
+			updates["failed_at"] = now
+			log.Printf("Giving up %s event %s after %d attempts: %v", entry.Type, entry.EventID, attempts, err)
+		} else {
+			updates["next_attempt_at"] = now.Add(outboxBackoff(attempts))
+		}
+	}
+
+	if err := DB.Model(&OutboxEvent{}).Where("id = ?", entry.ID).Updates(updates).Error; err != nil {
+		// the lease runs out and the event is delivered again
+		log.Printf("Failed to record delivery of %s event %s: %v", entry.Type, entry.EventID, err)
+	}
+}
+
+// publish decode and publish a stored event
+func (d *OutboxDispatcher) publish(entry *OutboxEvent) error {
+	var event events.Event
+	if err := json.Unmarshal([]byte(entry.Payload), &event); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), outboxPublishTimeout)
+	defer cancel()
+	return d.publisher.Publish(ctx, event)
+}
+
+// cleanup delete delivered and failed events past the retention
+func (d *OutboxDispatcher) cleanup() {
+	cutoff := time.Now().Add(-outboxRetention)
+	err := DB.Where("(delivered_at IS NOT NULL AND delivered_at < ?) OR (failed_at IS NOT NULL AND failed_at < ?)", cutoff, cutoff).
+		Delete(&OutboxEvent{}).Error
+	if err != nil {
+		log.Printf("Failed to clean up outbox events: %v", err)
+	}
+}
+
+// outboxBackoff delay before retry number attempts
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxRetryDelay
+	for i := 1; i < attempts && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxRetryDelay {
+		delay = outboxMaxRetryDelay
+	}
+	return delay
+}
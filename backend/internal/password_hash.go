@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"agent-connector/config"
+	"agent-connector/pkg/passwordhash"
+
+	"gorm.io/gorm"
+)
+
+// passwordHashBatchSize users read at once when building the password hash report
+const passwordHashBatchSize = 500
+
+var (
+	passwordHasherOnce sync.Once
+	sharedHasher       *passwordhash.Hasher
+)
+
+// passwordHasher the hasher configured in the security config, bcrypt at the
+// library defaults when the configuration is missing or invalid
+func passwordHasher() *passwordhash.Hasher {
+	passwordHasherOnce.Do(func() {
+		var params passwordhash.Params
+		if cfg := config.GlobalConfig; cfg != nil {
+			params = passwordhash.Params{
+				Algorithm:       cfg.Security.PasswordHashAlgorithm,
+				BcryptCost:      cfg.Security.BcryptCost,
+				Argon2Time:      cfg.Security.Argon2Time,
+				Argon2MemoryKiB: cfg.Security.Argon2MemoryKiB,
+				Argon2Threads:   cfg.Security.Argon2Threads,
+			}
+		}
+
+		hasher, err := passwordhash.New(params)
+		if err != nil {
+			log.Printf("Invalid password hash configuration, using bcrypt defaults: %v", err)
+			hasher, _ = passwordhash.New(passwordhash.Params{})
+		}
+		sharedHasher = hasher
+	})
+	return sharedHasher
+}
+
+// rehashPassword replace the stored hash of a user who just proved the password when
+// it was made with outdated parameters, failures only keep the old hash
+func rehashPassword(user *User, password string) {
+	hasher := passwordHasher()
+	if !hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %d: %v", user.ID, err)
+		return
+	}
+	if err := DB.Model(user).Update("password", hashedPassword).Error; err != nil {
+		log.Printf("Failed to store rehashed password of user %d: %v", user.ID, err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// PasswordHashScheme users whose password hash was made with one algorithm and parameters
+type PasswordHashScheme struct {
+	Scheme  string `json:"scheme"`
+	Users   int64  `json:"users"`
+	Current bool   `json:"current"`
+}
+
+// PasswordHashReport how many accounts use the configured hashing parameters; outdated
+// hashes are replaced when their users next log in
+type PasswordHashReport struct {
+	CurrentScheme string                `json:"current_scheme"`
+	TotalUsers    int64                 `json:"total_users"`
+	CurrentUsers  int64                 `json:"current_users"`
+	OutdatedUsers int64                 `json:"outdated_users"`
+	Schemes       []*PasswordHashScheme `json:"schemes"`
+}
+
+// GetPasswordHashReport count the users by the scheme of their password hash
+func (s *UserService) GetPasswordHashReport() (*PasswordHashReport, error) {
+	hasher := passwordHasher()
+	report := &PasswordHashReport{CurrentScheme: hasher.Describe()}
+	counts := make(map[string]int64)
+
+	var users []*User
+	err := DB.Select("id", "password").FindInBatches(&users, passwordHashBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			counts[passwordhash.Describe(user.Password)]++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	for scheme, users := range counts {
+		current := scheme == report.CurrentScheme
+		report.Schemes = append(report.Schemes, &PasswordHashScheme{Scheme: scheme, Users: users, Current: current})
+		report.TotalUsers += users
+		if current {
+			report.CurrentUsers += users
+		} else {
+			report.OutdatedUsers += users
+		}
+	}
+	sort.Slice(report.Schemes, func(i, j int) bool {
+		if report.Schemes[i].Users != report.Schemes[j].Users {
+			return report.Schemes[i].Users > report.Schemes[j].Users
+		}
+		return report.Schemes[i].Scheme < report.Schemes[j].Scheme
+	})
+	return report, nil
+}
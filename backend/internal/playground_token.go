@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// PlaygroundTokenPrefix marks playground tokens so they can be told apart from connector API keys
+	PlaygroundTokenPrefix = "pg_"
+
+	// playgroundTokenPrefixLength number of leading token characters kept in plaintext for lookup
+	playgroundTokenPrefixLength = 11
+
+	// MaxPlaygroundTokenLifetime longest validity an admin can give a playground token
+	MaxPlaygroundTokenLifetime = 30 * 24 * time.Hour
+)
+
+// IsPlaygroundToken check whether a presented key is a playground token
+func IsPlaygroundToken(token string) bool {
+	return strings.HasPrefix(token, PlaygroundTokenPrefix)
+}
+
+// IsActive check whether the token can still be used
+func (t *PlaygroundToken) IsActive() bool {
+	return !t.Revoked && time.Now().Before(t.ExpiresAt)
+}
+
+// VerifyToken check a presented token against the stored hash in constant time
+func (t *PlaygroundToken) VerifyToken(token string) bool {
+	if t.TokenHash == "" || token == "" {
+		return false
+	}
+	presented := HashConnectorAPIKey(token)
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(t.TokenHash)) == 1
+}
+
+// PlaygroundTokenService playground token service
+type PlaygroundTokenService struct{}
+
+// IssuePlaygroundToken create a playground token, the returned token carries the plaintext
+// value which cannot be retrieved again afterwards
+func (s *PlaygroundTokenService) IssuePlaygroundToken(token *PlaygroundToken) error {
+	if err := s.validatePlaygroundToken(token); err != nil {
+		return err
+	}
+
+	agentService := &AgentService{}
+	if _, err := agentService.GetAgentByAgentID(token.AgentID); err != nil {
+		return err
+	}
+
+	plaintext := PlaygroundTokenPrefix + generateRandomString(32)
+	token.Token = plaintext
+	token.TokenPrefix = plaintext[:playgroundTokenPrefixLength]
+	token.TokenHash = HashConnectorAPIKey(plaintext)
+	token.Revoked = false
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		return enqueuePlaygroundTokenCreated(tx, token)
+	})
+}
+
+// GetPlaygroundToken get playground token
+func (s *PlaygroundTokenService) GetPlaygroundToken(id uint) (*PlaygroundToken, error) {
+	var token PlaygroundToken
+	err := DB.First(&token, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("playground token not found")
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// playgroundTokenListSpec searchable, filterable and sortable columns of the playground token list
+var playgroundTokenListSpec = listQuerySpec{
+	searchColumns: []string{"name", "token_prefix", "agent_id"},
+	sortColumns: map[string]string{
+		"name":         "name",
+		"expires_at":   "expires_at",
+		"last_used_at": "last_used_at",
+		"created_at":   "created_at",
+	},
+	defaultSort: "created_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch status {
+		case "active":
+			return db.Where("revoked = ? AND expires_at > ?", false, time.Now()), nil
+		case "expired":
+			return db.Where("revoked = ? AND expires_at <= ?", false, time.Now()), nil
+		case "revoked":
+			return db.Where("revoked = ?", true), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
+// ListPlaygroundTokens get playground token list, optionally restricted to one agent
+func (s *PlaygroundTokenService) ListPlaygroundTokens(listQuery *ListQuery, agentID string) ([]*PlaygroundToken, int64, error) {
+	var tokens []*PlaygroundToken
+	var total int64
+
+	query := DB.Model(&PlaygroundToken{})
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+
+	query, err := listQuery.filter(query, playgroundTokenListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, playgroundTokenListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&tokens).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tokens, total, nil
+}
+
+// RevokePlaygroundToken revoke a playground token, it stops working immediately
+func (s *PlaygroundTokenService) RevokePlaygroundToken(id uint) error {
+	result := DB.Model(&PlaygroundToken{}).Where("id = ?", id).Update("revoked", true)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("playground token not found")
+	}
+
+	return nil
+}
+
+// AuthenticatePlaygroundToken find an active playground token matching the presented value
+func (s *PlaygroundTokenService) AuthenticatePlaygroundToken(token string) (*PlaygroundToken, error) {
+	if !IsPlaygroundToken(token) || len(token) <= playgroundTokenPrefixLength {
+		return nil, errors.New("invalid playground token")
+	}
+
+	var candidates []*PlaygroundToken
+	err := DB.Where("token_prefix = ?", token[:playgroundTokenPrefixLength]).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		if !candidate.VerifyToken(token) {
+			continue
+		}
+		if candidate.Revoked {
+			return nil, errors.New("playground token revoked")
+		}
+		if !candidate.IsActive() {
+			return nil, errors.New("playground token expired")
+		}
+
+		now := time.Now()
+		DB.Model(&PlaygroundToken{}).Where("id = ?", candidate.ID).Update("last_used_at", now)
+		candidate.LastUsedAt = &now
+		return candidate, nil
+	}
+
+	return nil, errors.New("invalid playground token")
+}
+
+// validatePlaygroundToken validate playground token limits
+func (s *PlaygroundTokenService) validatePlaygroundToken(token *PlaygroundToken) error {
+	if token.Name == "" {
+		return errors.New("playground token name is required")
+	}
+
+	if token.AgentID == "" {
+		return errors.New("agent ID is required")
+	}
+
+	if token.QPS <= 0 {
+		return errors.New("playground token QPS must be greater than 0")
+	}
+
+	if token.MaxTokens < 0 {
+		return errors.New("max tokens cannot be negative")
+	}
+
+	if !token.ExpiresAt.After(time.Now()) {
+		return errors.New("expiry must be in the future")
+	}
+
+	if token.ExpiresAt.After(time.Now().Add(MaxPlaygroundTokenLifetime)) {
+		return errors.New("expiry cannot be more than 30 days away")
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+
+	"agent-connector/config"
+)
+
+// ErrAggregateOnly the usage of a privacy mode agent is only reported in aggregate
+var ErrAggregateOnly = errors.New("usage of privacy mode agents is only available as aggregated summaries")
+
+// SuppressedUsageGroup the summary group collecting the groups of privacy mode agents
+// that are too small to be reported on their own
+const SuppressedUsageGroup = "(suppressed)"
+
+// defaultPrivacyMinGroupSize the minimum group size without a loaded configuration
+const defaultPrivacyMinGroupSize = 5
+
+// privacyMinGroupSize the fewest requests a summary group of privacy mode agents needs
+func privacyMinGroupSize() int64 {
+	if cfg := config.GlobalConfig; cfg != nil && cfg.Usage.PrivacyMinGroupSize > 0 {
+		return int64(cfg.Usage.PrivacyMinGroupSize)
+	}
+	return defaultPrivacyMinGroupSize
+}
+
+// applyPrivacyMode strip what a usage record of a privacy mode agent must not keep: the
+// prompt and response text and the error, which may quote them. An agent that cannot
+// be looked up is treated as a privacy mode agent.
+func applyPrivacyMode(record *UsageRecord) {
+	agent, err := LookupAgentByAgentID(record.AgentID)
+	if err == nil && !agent.PrivacyMode {
+		return
+	}
+	if err != nil && record.Content != nil {
+		log.Printf("Dropping content of usage record for agent %s, privacy mode unknown: %v", record.AgentID, err)
+	}
+	record.Content = nil
+	record.Error = ""
+}
+
+// privacyAgentIDs the agent IDs of the privacy mode agents, deleted ones included as
+// their usage records remain
+func privacyAgentIDs(ctx context.Context) ([]string, error) {
+	var agentIDs []string
+	err := DB.WithContext(ctx).Unscoped().Model(&Agent{}).Where("privacy_mode = ?", true).Pluck("agent_id", &agentIDs).Error
+	return agentIDs, err
+}
+
+// anonymizeUsageSummaries suppress the summary groups of privacy mode agents with fewer
+// than minSize requests: they are added up in one suppressed group, which is only kept
+// when it reaches minSize itself
+func anonymizeUsageSummaries(summaries []*UsageSummary, minSize int64) []*UsageSummary {
+	var kept []*UsageSummary
+	suppressed := &UsageSummary{Group: SuppressedUsageGroup}
+	for _, summary := range summaries {
+		if summary.Requests >= minSize {
+			kept = append(kept, summary)
+			continue
+		}
+		addUsageSummary(suppressed, summary)
+	}
+	if suppressed.Requests >= minSize {
+		kept = append(kept, suppressed)
+	}
+	return kept
+}
+
+// mergeUsageSummaries add the groups of extra to those of summaries with the same
+// group and subgroup, ordered by cost and requests like the summary query
+func mergeUsageSummaries(summaries, extra []*UsageSummary) []*UsageSummary {
+	type groupKey struct{ group, subgroup string }
+	index := make(map[groupKey]*UsageSummary, len(summaries))
+	for _, summary := range summaries {
+		index[groupKey{summary.Group, summary.Subgroup}] = summary
+	}
+	for _, summary := range extra {
+		if existing, ok := index[groupKey{summary.Group, summary.Subgroup}]; ok {
+			addUsageSummary(existing, summary)
+			continue
+		}
+		summaries = append(summaries, summary)
+		index[groupKey{summary.Group, summary.Subgroup}] = summary
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Cost != summaries[j].Cost {
+			return summaries[i].Cost > summaries[j].Cost
+		}
+		return summaries[i].Requests > summaries[j].Requests
+	})
+	return summaries
+}
+
+// addUsageSummary add the totals of src to dst, the average duration weighted by requests
+func addUsageSummary(dst, src *UsageSummary) {
+	if requests := dst.Requests + src.Requests; requests > 0 {
+		dst.AvgDurationMs = (dst.AvgDurationMs*float64(dst.Requests) + src.AvgDurationMs*float64(src.Requests)) / float64(requests)
+	}
+	dst.Requests += src.Requests
+	dst.Failed += src.Failed
+	dst.ClientCancelled += src.ClientCancelled
+	dst.PromptTokens += src.PromptTokens
+	dst.CompletionTokens += src.CompletionTokens
+	dst.TotalTokens += src.TotalTokens
+	dst.Cost += src.Cost
+}
+
+// scopedUsageFilter a copy of filter, which may be nil, for the service to narrow down
+func scopedUsageFilter(filter *UsageFilter) *UsageFilter {
+	if filter == nil {
+		return &UsageFilter{}
+	}
+	scoped := *filter
+	return &scoped
+}
+
+// checkRecordAccess fail with ErrAggregateOnly for a record of a privacy mode agent
+func checkRecordAccess(ctx context.Context, agentID string) error {
+	private, err := privacyAgentIDs(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(private, agentID) {
+		return ErrAggregateOnly
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/providerstatus"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProviderStatus the last polled state of an upstream provider, as its status page reports it
+type ProviderStatus struct {
+	Provider      string                    `json:"provider" gorm:"primaryKey;type:varchar(50);comment:'provider, e.g. openai or azure'"`
+	Indicator     string                    `json:"indicator" gorm:"type:varchar(20);not null;default:'none';comment:'none, minor, major or critical'"`
+	Description   string                    `json:"description" gorm:"type:varchar(255);not null;default:''"`
+	Incidents     []providerstatus.Incident `json:"incidents" gorm:"type:text;serializer:json;comment:'unresolved incidents'"`
+	IncidentSince *time.Time                `json:"incident_since,omitempty" gorm:"comment:'since when the provider reports an incident'"`
+	CheckedAt     *time.Time                `json:"checked_at" gorm:"comment:'last successful poll, null before the first'"`
+	Error         string                    `json:"error,omitempty" gorm:"type:text;comment:'error of the last poll, empty when it succeeded'"`
+	UpdatedAt     time.Time                 `json:"updated_at"`
+
+	// Stale the last successful poll is older than provider_status.max_age
+	Stale bool `json:"stale" gorm:"-"`
+}
+
+// TableName specify table name
+func (ProviderStatus) TableName() string {
+	return "provider_statuses"
+}
+
+// HasIncident whether the provider reports an incident and the report is recent
+func (s *ProviderStatus) HasIncident() bool {
+	return !s.Stale && s.Indicator != "" && s.Indicator != string(providerstatus.IndicatorNone)
+}
+
+// defaultProviderStatusMaxAge how long a polled status counts without a loaded configuration
+const defaultProviderStatusMaxAge = 30 * time.Minute
+
+// ProviderStatusService polls and stores the status of the upstream providers
+type ProviderStatusService struct {
+	checker *providerstatus.Checker
+}
+
+// NewProviderStatusService create a provider status service
+func NewProviderStatusService() *ProviderStatusService {
+	return &ProviderStatusService{checker: providerstatus.NewChecker(nil)}
+}
+
+// providerStatusSources the configured status pages
+func providerStatusSources() []providerstatus.Source {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		return nil
+	}
+	var sources []providerstatus.Source
+	if cfg.ProviderStatus.OpenAIURL != "" {
+		sources = append(sources, providerstatus.Source{Provider: providerstatus.OpenAI, URL: cfg.ProviderStatus.OpenAIURL, Format: providerstatus.FormatStatuspage})
+	}
+	if cfg.ProviderStatus.AzureURL != "" {
+		sources = append(sources, providerstatus.Source{Provider: providerstatus.Azure, URL: cfg.ProviderStatus.AzureURL, Format: providerstatus.FormatRSS})
+	}
+	return sources
+}
+
+// PollProviderStatuses read the status page of every configured provider and store what
+// it reports; a provider whose page cannot be read keeps its last status with the error.
+// Returns the providers reporting an incident.
+func (s *ProviderStatusService) PollProviderStatuses(ctx context.Context) ([]string, error) {
+	var incidents []string
+	var errs []error
+	for _, source := range providerStatusSources() {
+		status, err := s.checker.Check(ctx, source)
+		if err != nil {
+			errs = append(errs, err)
+			if err := s.recordPollError(ctx, source.Provider, err); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := s.saveProviderStatus(ctx, status); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if status.HasIncident() {
+			incidents = append(incidents, source.Provider)
+		}
+	}
+	return incidents, errors.Join(errs...)
+}
+
+// saveProviderStatus store a polled status, keeping when the current incident began
+func (s *ProviderStatusService) saveProviderStatus(ctx context.Context, polled *providerstatus.Status) error {
+	var stored ProviderStatus
+	err := DB.WithContext(ctx).Where("provider = ?", polled.Provider).First(&stored).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get provider status: %v", err)
+	}
+
+	incidentSince := stored.IncidentSince
+	switch {
+	case !polled.HasIncident():
+		incidentSince = nil
+	case incidentSince == nil:
+		incidentSince = &polled.CheckedAt
+	}
+	err = DB.WithContext(ctx).Save(&ProviderStatus{
+		Provider:      polled.Provider,
+		Indicator:     string(polled.Indicator),
+		Description:   polled.Description,
+		Incidents:     polled.Incidents,
+		IncidentSince: incidentSince,
+		CheckedAt:     &polled.CheckedAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save provider status: %v", err)
+	}
+	return nil
+}
+
+// recordPollError keep the error of a failed poll with the provider's last status
+func (s *ProviderStatusService) recordPollError(ctx context.Context, provider string, pollErr error) error {
+	result := DB.WithContext(ctx).Model(&ProviderStatus{}).Where("provider = ?", provider).Update("error", pollErr.Error())
+	if result.Error != nil {
+		return fmt.Errorf("failed to record provider status error: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// never polled successfully, the status is unknown until it is
+		err := DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&ProviderStatus{
+			Provider:  provider,
+			Indicator: string(providerstatus.IndicatorNone),
+			Error:     pollErr.Error(),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to record provider status error: %v", err)
+		}
+	}
+	return nil
+}
+
+// ListProviderStatuses the stored status of every polled provider, those not polled
+// successfully within provider_status.max_age marked stale
+func (s *ProviderStatusService) ListProviderStatuses(ctx context.Context) ([]ProviderStatus, error) {
+	var statuses []ProviderStatus
+	if err := DB.WithContext(ctx).Order("provider").Find(&statuses).Error; err != nil {
+		return nil, fmt.Errorf("failed to list provider statuses: %v", err)
+	}
+
+	maxAge := defaultProviderStatusMaxAge
+	if cfg := config.GlobalConfig; cfg != nil && cfg.ProviderStatus.MaxAge > 0 {
+		maxAge = cfg.ProviderStatus.MaxAge
+	}
+	for i := range statuses {
+		statuses[i].Stale = statuses[i].CheckedAt == nil || time.Since(*statuses[i].CheckedAt) > maxAge
+		if statuses[i].Incidents == nil {
+			statuses[i].Incidents = []providerstatus.Incident{}
+		}
+	}
+	return statuses, nil
+}
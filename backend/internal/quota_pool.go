@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"agent-connector/pkg/quota"
+
+	"gorm.io/gorm"
+)
+
+// Limits the shared budget of the pool
+func (p *QuotaPool) Limits() quota.Limits {
+	return quota.Limits{Tokens: p.TokenLimit, Requests: p.RequestLimit}
+}
+
+// PoolLimits the sub-limits of the agent's connector key in its quota pool
+func (a *Agent) PoolLimits() quota.Limits {
+	return quota.Limits{Tokens: a.PoolTokenLimit, Requests: a.PoolRequestLimit}
+}
+
+// QuotaPoolService quota pool service
+type QuotaPoolService struct{}
+
+// quotaPoolListSpec searchable and sortable columns of the quota pool list
+var quotaPoolListSpec = listQuerySpec{
+	searchColumns: []string{"name", "description"},
+	sortColumns: map[string]string{
+		"name":       "name",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	defaultSort: "name",
+}
+
+// CreateQuotaPool create quota pool
+func (s *QuotaPoolService) CreateQuotaPool(pool *QuotaPool) error {
+	if err := s.validateQuotaPool(pool, 0); err != nil {
+		return err
+	}
+	return DB.Create(pool).Error
+}
+
+// GetQuotaPool get quota pool
+func (s *QuotaPoolService) GetQuotaPool(id uint) (*QuotaPool, error) {
+	var pool QuotaPool
+	err := DB.First(&pool, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("quota pool not found")
+		}
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// GetQuotaPoolByName get quota pool by the name agents reference it with
+func (s *QuotaPoolService) GetQuotaPoolByName(name string) (*QuotaPool, error) {
+	var pool QuotaPool
+	err := DB.Where("name = ?", name).First(&pool).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("quota pool not found")
+		}
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// ListQuotaPools get quota pool list
+func (s *QuotaPoolService) ListQuotaPools(listQuery *ListQuery) ([]*QuotaPool, int64, error) {
+	var pools []*QuotaPool
+	var total int64
+
+	query, err := listQuery.filter(DB.Model(&QuotaPool{}), quotaPoolListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, quotaPoolListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Find(&pools).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return pools, total, nil
+}
+
+// ListQuotaPoolMembers the agents whose connector keys draw from the pool
+func (s *QuotaPoolService) ListQuotaPoolMembers(name string) ([]*Agent, error) {
+	var agents []*Agent
+	err := DB.Where("quota_pool = ?", name).Order("agent_id").Find(&agents).Error
+	if err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// UpdateQuotaPool update quota pool; a pool agents draw from cannot be renamed, the
+// agents reference it by name
+func (s *QuotaPoolService) UpdateQuotaPool(id uint, pool *QuotaPool) error {
+	existing, err := s.GetQuotaPool(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateQuotaPool(pool, id); err != nil {
+		return err
+	}
+	if pool.Name != existing.Name {
+		if err := s.checkUnused(existing.Name, "renamed"); err != nil {
+			return err
+		}
+	}
+
+	pool.ID = id
+	pool.CreatedAt = existing.CreatedAt
+	if err := DB.Save(pool).Error; err != nil {
+		return err
+	}
+	invalidatePoolLookups(existing.Name)
+	return nil
+}
+
+// DeleteQuotaPool delete quota pool, refused while agents draw from it
+func (s *QuotaPoolService) DeleteQuotaPool(id uint) error {
+	existing, err := s.GetQuotaPool(id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkUnused(existing.Name, "deleted"); err != nil {
+		return err
+	}
+
+	if err := DB.Delete(&QuotaPool{}, id).Error; err != nil {
+		return err
+	}
+	invalidatePoolLookups(existing.Name)
+	return nil
+}
+
+// checkUnused fail when agents draw from the pool, action names what was refused
+func (s *QuotaPoolService) checkUnused(name, action string) error {
+	var count int64
+	if err := DB.Model(&Agent{}).Where("quota_pool = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("quota pool is used by %d agents and cannot be %s, move them to another pool first", count, action)
+	}
+	return nil
+}
+
+// validateQuotaPool validate quota pool, id is the pool being updated or 0 for a new one
+func (s *QuotaPoolService) validateQuotaPool(pool *QuotaPool, id uint) error {
+	pool.Name = strings.TrimSpace(pool.Name)
+	if pool.Name == "" {
+		return errors.New("quota pool name cannot be empty")
+	}
+	if strings.Contains(pool.Name, ":") {
+		return errors.New("quota pool name cannot contain ':'")
+	}
+	if pool.Period == "" {
+		pool.Period = quota.PeriodMonth
+	}
+	if !quota.ValidPeriod(pool.Period) {
+		return fmt.Errorf("invalid quota pool period %q, expected day or month", pool.Period)
+	}
+	if pool.TokenLimit < 0 || pool.RequestLimit < 0 {
+		return errors.New("quota pool limits cannot be negative")
+	}
+
+	var count int64
+	if err := DB.Model(&QuotaPool{}).Where("name = ? AND id <> ?", pool.Name, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("quota pool name already exists")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"agent-connector/config"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// defaultReplicaCheckInterval used when no replica check interval is configured
+const defaultReplicaCheckInterval = 10 * time.Second
+
+// replicaDB read replica opened by initReadReplica, nil when none is configured
+var replicaDB *gorm.DB
+
+// replicaHealthy whether reads currently go to the replica
+var replicaHealthy atomic.Bool
+
+// initReadReplica open the configured read replica with the primary's pool settings and
+// start monitoring it. A replica that is down at startup is used once it recovers.
+func initReadReplica(cfg *config.Config, logLevel logger.LogLevel) error {
+	if cfg.Database.ReplicaDSN == "" {
+		return nil
+	}
+
+	// a replica that is down must not fail startup, it is checked below
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       cfg.Database.ReplicaDSN,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		Logger:               logger.Default.LogMode(logLevel),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open read replica: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB of read replica: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+
+	replicaDB = db
+	checkReadReplica()
+	if !replicaHealthy.Load() {
+		log.Println("Warning: read replica is unreachable, reading from the primary until it recovers")
+	}
+
+	interval := cfg.Database.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	go monitorReadReplica(interval)
+	return nil
+}
+
+// monitorReadReplica ping the replica every interval, switching reads back and forth
+func monitorReadReplica(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		checkReadReplica()
+	}
+}
+
+// checkReadReplica ping the replica and record whether it can serve reads, logging transitions
+func checkReadReplica() bool {
+	healthy := pingReadReplica() == nil
+	if previous := replicaHealthy.Swap(healthy); previous != healthy {
+		if healthy {
+			log.Println("Read replica is reachable, routing reads to it")
+		} else {
+			log.Println("Read replica is down, routing reads to the primary")
+		}
+	}
+	return healthy
+}
+
+// pingReadReplica check the replica connection
+func pingReadReplica() error {
+	sqlDB, err := replicaDB.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// withReadReplica run a read-only query on the replica when one is healthy, otherwise on
+// the primary. A query failing because the replica went down is retried on the primary.
+func withReadReplica(run func(db *gorm.DB) error) error {
+	if replicaDB == nil || !replicaHealthy.Load() {
+		return run(DB)
+	}
+	err := run(replicaDB)
+	if err == nil || checkReadReplica() {
+		return err
+	}
+	return run(DB)
+}
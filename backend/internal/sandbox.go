@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// SandboxNamespacePrefix starts the namespace of every sandbox, followed by its owner
+	SandboxNamespacePrefix = "sandbox:"
+
+	// sandboxAgentIDPrefix starts the agent IDs of sandbox agents, so every Redis key
+	// derived from an agent ID carries the namespace
+	sandboxAgentIDPrefix = "sbx_"
+
+	// minSandboxTTL shortest lifetime of a sandbox agent
+	minSandboxTTL = time.Minute
+)
+
+// sandboxOwnerPattern owners name their namespace, lower case so agent IDs stay readable
+var sandboxOwnerPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// ErrSandboxDisabled the sandbox allows no agents
+var ErrSandboxDisabled = errors.New("the sandbox is disabled")
+
+// SandboxNamespace the namespace of the owner's sandbox
+func SandboxNamespace(owner string) string {
+	return SandboxNamespacePrefix + owner
+}
+
+// InSandbox whether the agent is a temporary agent of a sandbox
+func (a *Agent) InSandbox() bool {
+	return a.Namespace != ""
+}
+
+// Expired whether the lifetime of a sandbox agent is over, never for production agents
+func (a *Agent) Expired() bool {
+	return a.ExpiresAt != nil && !time.Now().Before(*a.ExpiresAt)
+}
+
+// sandboxSettings the sandbox configuration, the defaults without a loaded configuration
+func sandboxSettings() config.SandboxConfig {
+	if cfg := config.GlobalConfig; cfg != nil {
+		return cfg.Sandbox
+	}
+	return config.SandboxConfig{MaxAgents: 5, DefaultTTL: 24 * time.Hour, MaxTTL: 7 * 24 * time.Hour, QPS: 2, MaxTokens: 1024}
+}
+
+// validateSandboxLimits hold a sandbox agent to the sandbox limits: QPS and max_tokens
+// caps above them are rejected, an unset max_tokens cap gets the limit. Sandbox agents
+// use no production resources: no hedging, quota pools or passthrough.
+func validateSandboxLimits(agent *Agent) error {
+	settings := sandboxSettings()
+	if agent.QPS > settings.QPS {
+		return agentFieldError("qps", fmt.Sprintf("sandbox agents are limited to %d QPS", settings.QPS))
+	}
+	if settings.MaxTokens > 0 {
+		if agent.MaxTokensCap == 0 {
+			agent.MaxTokensCap = settings.MaxTokens
+		}
+		if agent.MaxTokensCap > settings.MaxTokens {
+			return agentFieldError("max_tokens_cap", fmt.Sprintf("sandbox agents are limited to %d max tokens", settings.MaxTokens))
+		}
+	}
+	if agent.HedgeAgentID != "" {
+		return agentFieldError("hedge_agent_id", "sandbox agents cannot hedge")
+	}
+	if agent.QuotaPool != "" {
+		return agentFieldError("quota_pool", "sandbox agents cannot join quota pools")
+	}
+	if agent.Passthrough {
+		return agentFieldError("passthrough", "sandbox agents cannot be exposed as a passthrough proxy")
+	}
+	return nil
+}
+
+// SandboxService temporary agents of developers, kept apart from the production agents
+type SandboxService struct{}
+
+// sandboxAgentListSpec the agent list columns, for the agents of the sandboxes
+var sandboxAgentListSpec = func() listQuerySpec {
+	spec := agentListSpec
+	spec.sortColumns = map[string]string{
+		"name":       "name",
+		"created_at": "created_at",
+		"expires_at": "expires_at",
+	}
+	return spec
+}()
+
+// ListSandboxAgents get the agents of the owner's sandbox, of every sandbox when owner is empty
+func (s *SandboxService) ListSandboxAgents(listQuery *ListQuery, owner string) ([]*Agent, int64, error) {
+	var agents []*Agent
+	var total int64
+
+	query := DB.Model(&Agent{}).Where("namespace <> ?", "")
+	if owner != "" {
+		query = query.Where("namespace = ?", SandboxNamespace(owner))
+	}
+	query, err := listQuery.filter(query, sandboxAgentListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query, err = listQuery.paginate(query, sandboxAgentListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := query.Find(&agents).Error; err != nil {
+		return nil, 0, err
+	}
+	return agents, total, nil
+}
+
+// CreateSandboxAgent create a temporary agent in the owner's sandbox that expires after
+// ttl, 0 for the configured default. The returned agent carries its connector API key.
+func (s *SandboxService) CreateSandboxAgent(owner string, agent *Agent, ttl time.Duration) error {
+	settings := sandboxSettings()
+	if settings.MaxAgents <= 0 {
+		return ErrSandboxDisabled
+	}
+	if !sandboxOwnerPattern.MatchString(owner) {
+		return agentFieldError("owner", "sandbox owner must be 1 to 40 lower case letters, digits or dashes")
+	}
+	if ttl == 0 {
+		ttl = settings.DefaultTTL
+	}
+	if ttl < minSandboxTTL || (settings.MaxTTL > 0 && ttl > settings.MaxTTL) {
+		return agentFieldError("ttl", fmt.Sprintf("sandbox agent lifetime must be between %s and %s", minSandboxTTL, settings.MaxTTL))
+	}
+
+	namespace := SandboxNamespace(owner)
+	var count int64
+	if err := DB.Model(&Agent{}).Where("namespace = ? AND expires_at > ?", namespace, time.Now()).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(settings.MaxAgents) {
+		return fmt.Errorf("sandbox %s already has %d agents, delete one or wait until it expires", owner, count)
+	}
+
+	agent.Namespace = namespace
+	expiresAt := time.Now().Add(ttl)
+	agent.ExpiresAt = &expiresAt
+	if agent.QPS == 0 {
+		agent.QPS = settings.QPS
+	}
+	return (&AgentService{}).createAgent(agent, sandboxAgentIDPrefix+owner+"_"+generateRandomString(12))
+}
+
+// DeleteSandboxAgent delete a sandbox agent before it expires, with everything it left behind
+func (s *SandboxService) DeleteSandboxAgent(ctx context.Context, id uint) error {
+	var agent Agent
+	if err := DB.Where("namespace <> ?", "").First(&agent, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("sandbox agent not found")
+		}
+		return err
+	}
+	return s.purge(ctx, []*Agent{&agent})
+}
+
+// PurgeExpiredSandboxAgents delete every expired sandbox agent, the number deleted
+func (s *SandboxService) PurgeExpiredSandboxAgents(ctx context.Context) (int, error) {
+	var agents []*Agent
+	err := DB.WithContext(ctx).Unscoped().Where("namespace <> ? AND expires_at <= ?", "", time.Now()).Find(&agents).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(agents) == 0 {
+		return 0, nil
+	}
+	return len(agents), s.purge(ctx, agents)
+}
+
+// purge delete sandbox agents for good, with their playground tokens, queue overrides,
+// maintenance windows, golden prompts, conversations and conversation titles, then
+// their Redis keys. Usage records are kept.
+func (s *SandboxService) purge(ctx context.Context, agents []*Agent) error {
+	agentIDs := make([]string, len(agents))
+	ids := make([]uint, len(agents))
+	for i, agent := range agents {
+		agentIDs[i] = agent.AgentID
+		ids[i] = agent.ID
+	}
+
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&PlaygroundToken{}, &AgentQueueConfig{}, &MaintenanceWindow{}, &GoldenRun{}, &GoldenPrompt{}, &ConversationMapping{}, &ConversationTitle{}} {
+			if err := tx.Unscoped().Where("agent_id IN ?", agentIDs).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&Agent{}, ids).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete sandbox agents: %v", err)
+	}
+	for _, id := range ids {
+		invalidateAgentLookups(id)
+	}
+
+	// the keys expire on their own, a failure only leaves them until then
+	if err := purgeSandboxKeys(ctx, agentIDs); err != nil {
+		log.Printf("Failed to delete the Redis keys of sandbox agents %s: %v", strings.Join(agentIDs, ", "), err)
+	}
+	return nil
+}
+
+// purgeSandboxKeys delete the Redis keys of the sandbox agents: rate limits, queues,
+// stream slots and the like all name the agent ID
+func purgeSandboxKeys(ctx context.Context, agentIDs []string) error {
+	cfg := config.GlobalConfig
+	if cfg == nil || cfg.Redis.Addr == "" {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer client.Close()
+
+	iter := client.Scan(ctx, 0, "*"+sandboxAgentIDPrefix+"*", 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if slices.ContainsFunc(agentIDs, func(agentID string) bool { return strings.Contains(key, agentID) }) {
+			keys = append(keys, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += 500 {
+		if err := client.Del(ctx, keys[start:min(start+500, len(keys))]...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/ttlcache"
+
+	"gorm.io/gorm"
+)
+
+// Session binding modes, how a session used from another client than the one it was
+// created for is treated
+const (
+	// SessionBindingOff sessions are not checked
+	SessionBindingOff = "off"
+
+	// SessionBindingAudit mismatches are reported, the session keeps working
+	SessionBindingAudit = "audit"
+
+	// SessionBindingUserAgent another user agent revokes the session, another network
+	// is only reported since clients roam between networks
+	SessionBindingUserAgent = "user_agent"
+
+	// SessionBindingStrict another user agent or network revokes the session
+	SessionBindingStrict = "strict"
+)
+
+// ErrSessionBindingViolated the session was used from another client and is revoked
+var ErrSessionBindingViolated = errors.New("session is bound to another client, log in again")
+
+// reportedBindingViolations sessions whose mismatch was already reported in audit mode,
+// so a session used from a new network is reported once and not on every request
+var reportedBindingViolations = ttlcache.New[string, struct{}](time.Hour, 10000)
+
+// sessionBindingConfig the configured mode and network prefix lengths
+func sessionBindingConfig() (mode string, ipv4Prefix, ipv6Prefix int) {
+	mode, ipv4Prefix, ipv6Prefix = SessionBindingOff, 24, 48
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		return
+	}
+	if cfg.Security.SessionBinding != "" {
+		mode = cfg.Security.SessionBinding
+	}
+	if cfg.Security.SessionBindingIPv4Prefix > 0 {
+		ipv4Prefix = cfg.Security.SessionBindingIPv4Prefix
+	}
+	if cfg.Security.SessionBindingIPv6Prefix > 0 {
+		ipv6Prefix = cfg.Security.SessionBindingIPv6Prefix
+	}
+	return
+}
+
+// clientNetwork the network of ip with the configured prefix length, e.g. 203.0.113.0/24;
+// empty for addresses that do not parse
+func clientNetwork(ip string) string {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ""
+	}
+	_, ipv4Prefix, ipv6Prefix := sessionBindingConfig()
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(ipv4Prefix, 32)), Mask: net.CIDRMask(ipv4Prefix, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(ipv6Prefix, 128)), Mask: net.CIDRMask(ipv6Prefix, 128)}).String()
+}
+
+// userAgentHash hex SHA-256 of the user agent, only the hash is kept for the binding
+func userAgentHash(userAgent string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(userAgent)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// bindSession record the client fingerprint a new session is bound to
+func bindSession(session *UserSession, ip, userAgent string) {
+	session.BindingNetwork = clientNetwork(ip)
+	session.BindingUserAgentHash = userAgentHash(userAgent)
+}
+
+// CheckSessionBinding compare the client using a session with the one it was created
+// for. Mismatches are published as session.binding_violated events; depending on the
+// configured mode the session is revoked and ErrSessionBindingViolated returned. An
+// empty ip skips the network check, for callers that do not know the client address.
+func (s *UserService) CheckSessionBinding(session *UserSession, ip, userAgent string) error {
+	mode, _, _ := sessionBindingConfig()
+	if mode == SessionBindingOff || session.BindingUserAgentHash == "" || session.IsImpersonated() {
+		return nil
+	}
+
+	network := clientNetwork(ip)
+	networkChanged := ip != "" && network != session.BindingNetwork
+	userAgentChanged := userAgentHash(userAgent) != session.BindingUserAgentHash
+	if !networkChanged && !userAgentChanged {
+		return nil
+	}
+
+	revoke := mode == SessionBindingStrict || (mode == SessionBindingUserAgent && userAgentChanged)
+	reportKey := fmt.Sprintf("%d:%s:%t", session.ID, network, userAgentChanged)
+	if !revoke {
+		if _, reported := reportedBindingViolations.Get(reportKey); reported {
+			return nil
+		}
+		reportedBindingViolations.Set(reportKey, struct{}{})
+	}
+
+	action := "reported"
+	if revoke {
+		action = "revoked"
+	}
+	event := newEvent(events.TypeSessionBindingViolated, session.User.Username, map[string]interface{}{
+		"user_id":            session.UserID,
+		"username":           session.User.Username,
+		"session_id":         session.ID,
+		"mode":               mode,
+		"action":             action,
+		"network_changed":    networkChanged,
+		"user_agent_changed": userAgentChanged,
+		"bound_network":      session.BindingNetwork,
+		"client_network":     network,
+	})
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if revoke {
+			if err := tx.Where("id = ?", session.ID).Delete(&UserSession{}).Error; err != nil {
+				return fmt.Errorf("failed to revoke session: %v", err)
+			}
+		}
+		return enqueueEvent(tx, event)
+	})
+	if err != nil {
+		log.Printf("Failed to record session binding violation of session %d: %v", session.ID, err)
+	}
+	if !revoke {
+		return nil
+	}
+
+	s.LogUserLogin(session.UserID, ip, userAgent, false, "Session revoked: used from another client than it was issued to")
+	return ErrSessionBindingViolated
+}
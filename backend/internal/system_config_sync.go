@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"agent-connector/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// systemConfigChannel Redis pub/sub channel announcing system configuration changes
+	systemConfigChannel = "agent-connector:system-config"
+
+	// systemConfigRefreshInterval how often subscribers reload the configuration from
+	// the database, pub/sub does not redeliver messages missed while disconnected
+	systemConfigRefreshInterval = time.Minute
+)
+
+// liveSystemConfig the system configuration last loaded or received by this process
+var liveSystemConfig atomic.Pointer[SystemConfig]
+
+// systemConfigSync installed by InitSystemConfigSync, nil when changes are not propagated
+var systemConfigSync *SystemConfigSync
+
+// CurrentSystemConfig the live system configuration, empty until it is first loaded
+func CurrentSystemConfig() *SystemConfig {
+	if current := liveSystemConfig.Load(); current != nil {
+		return current
+	}
+	return &SystemConfig{}
+}
+
+// SystemConfigSync publishes system configuration changes over Redis pub/sub and
+// applies the changes published by other services
+type SystemConfigSync struct {
+	client  *redis.Client
+	service *SystemConfigService
+}
+
+// InitSystemConfigSync load the current system configuration, connect to the
+// configured Redis and install the sync, so updates are published to the other services
+func InitSystemConfigSync() (*SystemConfigSync, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	// the stored settings apply even when Redis is unreachable
+	s := &SystemConfigSync{service: &SystemConfigService{}}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	s.client = client
+	systemConfigSync = s
+	return s, nil
+}
+
+// Publish announce a changed system configuration to the subscribed services
+func (s *SystemConfigSync) Publish(ctx context.Context, systemConfig *SystemConfig) error {
+	liveSystemConfig.Store(systemConfig)
+
+	payload, err := json.Marshal(systemConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal system config: %w", err)
+	}
+	if err := s.client.Publish(ctx, systemConfigChannel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish system config change: %w", err)
+	}
+	return nil
+}
+
+// Run apply published changes until ctx is done, reloading from the database every
+// systemConfigRefreshInterval in case a message was missed
+func (s *SystemConfigSync) Run(ctx context.Context) {
+	pubsub := s.client.Subscribe(ctx, systemConfigChannel)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+
+	ticker := time.NewTicker(systemConfigRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var systemConfig SystemConfig
+			if err := json.Unmarshal([]byte(message.Payload), &systemConfig); err != nil {
+				log.Printf("Ignoring invalid system config change: %v", err)
+				continue
+			}
+			s.apply(&systemConfig)
+		case <-ticker.C:
+			if err := s.reload(); err != nil {
+				log.Printf("System config reload failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close closes the Redis connection
+func (s *SystemConfigSync) Close() error {
+	return s.client.Close()
+}
+
+// reload load the system configuration from the database
+func (s *SystemConfigSync) reload() error {
+	systemConfig, err := s.service.GetSystemConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load system config: %w", err)
+	}
+	s.apply(systemConfig)
+	return nil
+}
+
+// apply make the configuration live, logging the settings that changed
+func (s *SystemConfigSync) apply(systemConfig *SystemConfig) {
+	previous := liveSystemConfig.Swap(systemConfig)
+	if previous == nil {
+		return
+	}
+	if previous.RateLimitMode != systemConfig.RateLimitMode {
+		log.Printf("System config: rate limit mode changed from %q to %q", previous.RateLimitMode, systemConfig.RateLimitMode)
+	}
+	if previous.ImpersonationTTLMinutes != systemConfig.ImpersonationTTLMinutes {
+		log.Printf("System config: impersonation TTL changed from %d to %d minutes", previous.ImpersonationTTLMinutes, systemConfig.ImpersonationTTLMinutes)
+	}
+	if previous.DefaultQPS != systemConfig.DefaultQPS {
+		log.Printf("System config: default user QPS changed from %d to %d", previous.DefaultQPS, systemConfig.DefaultQPS)
+	}
+	if previous.DefaultPriority != systemConfig.DefaultPriority {
+		log.Printf("System config: default user priority changed from %d to %d", previous.DefaultPriority, systemConfig.DefaultPriority)
+	}
+	if previous.LoginAnomalySensitivity != systemConfig.LoginAnomalySensitivity {
+		log.Printf("System config: login anomaly sensitivity changed from %q to %q", previous.LoginAnomalySensitivity, systemConfig.LoginAnomalySensitivity)
+	}
+}
+
+// publishSystemConfig announce an update when the sync is installed; the other
+// services pick the change up on their next reload when publishing fails
+func publishSystemConfig(systemConfig *SystemConfig) {
+	if systemConfigSync == nil {
+		liveSystemConfig.Store(systemConfig)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := systemConfigSync.Publish(ctx, systemConfig); err != nil {
+		log.Printf("Failed to propagate system config change: %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-connector/pkg/textlimit"
+	"context"
+
+	"golang.org/x/net/http/httpguts"
+	"gorm.io/gorm"
+)
+
+const (
+	maxMetadataKeys        = 16
+	maxMetadataValueLength = 512
+	maxTagValueLength      = 255
+)
+
+// metadataKeyPattern allowed metadata keys, also used as report group names
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ValidateRequestMetadata check the metadata a client attached to a dataflow request
+func ValidateRequestMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("metadata supports at most %d keys, got %d", maxMetadataKeys, len(metadata))
+	}
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q: use up to 64 letters, digits, '_', '.' or '-'", textlimit.Ellipsize(key, 64))
+		}
+		if len(value) > maxMetadataValueLength {
+			return fmt.Errorf("metadata value of %q exceeds %d bytes", key, maxMetadataValueLength)
+		}
+		// forwarded metadata travels in X-Metadata-<key> headers
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("metadata value of %q contains control characters such as line breaks", key)
+		}
+	}
+	return nil
+}
+
+// SetMetadata store the metadata as JSON and as filterable tags
+func (r *UsageRecord) SetMetadata(metadata map[string]string) {
+	r.Metadata = ""
+	r.Tags = nil
+	if len(metadata) == 0 {
+		return
+	}
+
+	if data, err := json.Marshal(metadata); err == nil {
+		r.Metadata = string(data)
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := textlimit.TruncateBytes(metadata[key], maxTagValueLength)
+		r.Tags = append(r.Tags, UsageRecordTag{TagKey: key, TagValue: value})
+	}
+}
+
+// SetContent attach the prompt and response text, each cut to limit bytes, and the
+// request parameters, which are dropped above the limit as cut JSON cannot be replayed
+func (r *UsageRecord) SetContent(request, response, parameters string, truncated bool, limit int) {
+	request, requestCut := textlimit.TruncateBytes(request, limit)
+	response, responseCut := textlimit.TruncateBytes(response, limit)
+	if len(parameters) > limit {
+		parameters = ""
+	}
+	r.Content = &UsageRecordContent{
+		Request:    request,
+		Response:   response,
+		Parameters: parameters,
+		Truncated:  truncated || requestCut || responseCut,
+	}
+}
+
+// ApplyPricing compute the cost from the token counts and the prices per 1K tokens
+func (r *UsageRecord) ApplyPricing(promptPrice, completionPrice float64) {
+	r.Cost = (float64(r.PromptTokens)*promptPrice + float64(r.CompletionTokens)*completionPrice) / 1000
+}
+
+// MetadataMap decoded metadata, empty when there is none
+func (r *UsageRecord) MetadataMap() map[string]string {
+	metadata := map[string]string{}
+	if r.Metadata != "" {
+		if err := json.Unmarshal([]byte(r.Metadata), &metadata); err != nil {
+			log.Printf("Invalid metadata on usage record %d: %v", r.ID, err)
+		}
+	}
+	return metadata
+}
+
+// UsageFilter restricts usage records beyond the common list query
+type UsageFilter struct {
+	AgentID string
+	From    *time.Time
+	To      *time.Time
+	Tags    map[string]string // metadata key/value pairs that must all match
+
+	// PlaygroundTokenID only the requests made with this playground token
+	PlaygroundTokenID *uint
+
+	// agentIDs and excludeAgentIDs set by the service to keep the records of privacy
+	// mode agents apart
+	agentIDs        []string
+	excludeAgentIDs []string
+}
+
+// ParseUsageFilter build a usage filter from URL query parameters: agent_id,
+// from and to (RFC 3339 or YYYY-MM-DD, to is exclusive) and repeated tag=key:value
+func ParseUsageFilter(values url.Values) (*UsageFilter, error) {
+	filter := &UsageFilter{
+		AgentID: strings.TrimSpace(values.Get("agent_id")),
+	}
+
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := parseListTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be RFC 3339 or YYYY-MM-DD", ErrInvalidListQuery, name)
+		}
+		*target = &t
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidListQuery)
+	}
+
+	for _, tag := range values["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || !metadataKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%w: invalid tag filter %q, expected key:value", ErrInvalidListQuery, tag)
+		}
+		if filter.Tags == nil {
+			filter.Tags = make(map[string]string)
+		}
+		filter.Tags[key] = value
+	}
+
+	return filter, nil
+}
+
+// apply add the filter conditions to a usage_records query
+func (f *UsageFilter) apply(db *gorm.DB) *gorm.DB {
+	if f == nil {
+		return db
+	}
+
+	if f.AgentID != "" {
+		db = db.Where("usage_records.agent_id = ?", f.AgentID)
+	}
+	if f.From != nil {
+		db = db.Where("usage_records.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("usage_records.created_at < ?", *f.To)
+	}
+	if f.PlaygroundTokenID != nil {
+		db = db.Where("usage_records.playground_token_id = ?", *f.PlaygroundTokenID)
+	}
+	if len(f.agentIDs) > 0 {
+		db = db.Where("usage_records.agent_id IN ?", f.agentIDs)
+	}
+	if len(f.excludeAgentIDs) > 0 {
+		db = db.Where("usage_records.agent_id NOT IN ?", f.excludeAgentIDs)
+	}
+	for key, value := range f.Tags {
+		db = db.Where("usage_records.id IN (?)",
+			DB.Model(&UsageRecordTag{}).Select("usage_record_id").Where("tag_key = ? AND tag_value = ?", key, value))
+	}
+	return db
+}
+
+// UsageSummary aggregated usage of one group
+type UsageSummary struct {
+	Group            string  `json:"group" gorm:"column:group_name"`
+	Subgroup         string  `json:"subgroup,omitempty" gorm:"column:subgroup_name"`
+	Requests         int64   `json:"requests"`
+	Failed           int64   `json:"failed"`
+	ClientCancelled  int64   `json:"client_cancelled"` // clients that went away before the response was complete
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+	AvgDurationMs    float64 `json:"avg_duration_ms"`
+}
+
+// UsageService usage record service
+type UsageService struct{}
+
+// usageRecordListSpec searchable, filterable and sortable columns of the usage record list
+var usageRecordListSpec = listQuerySpec{
+	searchColumns: []string{"usage_records.agent_id", "usage_records.path", "usage_records.metadata"},
+	sortColumns: map[string]string{
+		"created_at":   "usage_records.created_at",
+		"duration_ms":  "usage_records.duration_ms",
+		"total_tokens": "usage_records.total_tokens",
+	},
+	defaultSort: "created_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch status {
+		case "success":
+			return db.Where("usage_records.success = ?", true), nil
+		case "failed":
+			return db.Where("usage_records.success = ? AND usage_records.outcome <> ?", false, UsageOutcomeClientCancelled), nil
+		case UsageOutcomeClientCancelled:
+			return db.Where("usage_records.outcome = ?", UsageOutcomeClientCancelled), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
+// RecordUsage store a usage record together with its metadata tags. While the database
+// is unreachable the record is held in memory and ErrUsageDeferred returned.
+func (s *UsageService) RecordUsage(record *UsageRecord) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+
+	applyPrivacyMode(record)
+	sealUsageContent(record)
+	if !usageStoreIsRelational() {
+		return currentUsageStore().Insert(context.Background(), []*UsageRecord{record})
+	}
+	if databaseDown.Load() {
+		return deferUsage(record)
+	}
+	if err := DB.Create(record).Error; err != nil {
+		if databaseFailed(err) {
+			return deferUsage(record)
+		}
+		return err
+	}
+	return nil
+}
+
+// WriteUsage store a usage record through the usage writer when one is installed,
+// otherwise like RecordUsage. written is called with the stored record, which then
+// has its ID, unless the record is deferred, spilled or dropped; it may be nil.
+func (s *UsageService) WriteUsage(record *UsageRecord, written func(*UsageRecord)) error {
+	if usageWriter == nil {
+		if err := s.RecordUsage(record); err != nil {
+			return err
+		}
+		if written != nil {
+			written(record)
+		}
+		return nil
+	}
+
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	applyPrivacyMode(record)
+	sealUsageContent(record)
+	return usageWriter.enqueue(record, written)
+}
+
+// sealUsageContent encrypt the content of a record before it leaves the process
+func sealUsageContent(record *UsageRecord) {
+	if record.Content != nil && contentKeyring != nil && record.Content.KeyID == 0 {
+		if err := contentKeyring.encrypt(record.AgentID, record.Content); err != nil {
+			// Never fall back to plaintext, the usage itself is still recorded
+			log.Printf("Dropping content of usage record for agent %s, encryption failed: %v", record.AgentID, err)
+			record.Content = nil
+		}
+	}
+}
+
+// GetUsageRecord get usage record with its stored content, ErrAggregateOnly for a record
+// of a privacy mode agent
+func (s *UsageService) GetUsageRecord(id uint) (*UsageRecord, error) {
+	record, err := currentUsageStore().Get(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRecordAccess(context.Background(), record.AgentID); err != nil {
+		return nil, err
+	}
+
+	if record.Content != nil && record.Content.KeyID != 0 {
+		if contentKeyring == nil {
+			return nil, fmt.Errorf("usage content is encrypted: %w", ErrContentEncryptionDisabled)
+		}
+		if err := contentKeyring.decrypt(record.AgentID, record.Content); err != nil {
+			return nil, fmt.Errorf("failed to decrypt usage content: %w", err)
+		}
+	}
+	return record, nil
+}
+
+// ListUsageRecords get usage record list, without the records of privacy mode agents;
+// ErrAggregateOnly when the filter asks for the records of one
+func (s *UsageService) ListUsageRecords(listQuery *ListQuery, filter *UsageFilter) ([]*UsageRecord, int64, error) {
+	private, err := privacyAgentIDs(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+	scoped := scopedUsageFilter(filter)
+	if slices.Contains(private, scoped.AgentID) {
+		return nil, 0, ErrAggregateOnly
+	}
+	scoped.excludeAgentIDs = private
+	return currentUsageStore().List(context.Background(), listQuery, scoped)
+}
+
+// SummarizeUsage aggregate usage by up to two comma separated dimensions, each
+// "agent" or "metadata.<key>", e.g. "metadata.project,agent" for the cost of every
+// project split by agent; records without a metadata key are grouped under ""
+func (s *UsageService) SummarizeUsage(filter *UsageFilter, groupBy string) ([]*UsageSummary, error) {
+	dimensions, err := parseUsageDimensions(groupBy)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	private, err := privacyAgentIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(private) == 0 {
+		return currentUsageStore().Summarize(ctx, filter, dimensions)
+	}
+
+	// the groups of privacy mode agents are k-anonymized before they join the others
+	public := scopedUsageFilter(filter)
+	public.excludeAgentIDs = private
+	summaries, err := currentUsageStore().Summarize(ctx, public, dimensions)
+	if err != nil {
+		return nil, err
+	}
+	restricted := scopedUsageFilter(filter)
+	restricted.agentIDs = private
+	privateSummaries, err := currentUsageStore().Summarize(ctx, restricted, dimensions)
+	if err != nil {
+		return nil, err
+	}
+	return mergeUsageSummaries(summaries, anonymizeUsageSummaries(privateSummaries, privacyMinGroupSize())), nil
+}
+
+// SummarizeOwnUsage the totals of the one agent the filter names, zero when it has no
+// usage; for the agent's own keys, which see all of their requests, so the totals of a
+// privacy mode agent are not k-anonymized as in SummarizeUsage
+func (s *UsageService) SummarizeOwnUsage(filter *UsageFilter) (UsageSummary, error) {
+	if filter == nil || filter.AgentID == "" {
+		return UsageSummary{}, errors.New("agent ID is required")
+	}
+	dimensions, err := parseUsageDimensions("agent")
+	if err != nil {
+		return UsageSummary{}, err
+	}
+	summaries, err := currentUsageStore().Summarize(context.Background(), scopedUsageFilter(filter), dimensions)
+	if err != nil || len(summaries) == 0 {
+		return UsageSummary{}, err
+	}
+	return *summaries[0], nil
+}
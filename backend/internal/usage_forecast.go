@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/forecast"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// forecastDays horizon of the request, token and cost projections
+	forecastDays = 30
+
+	// defaultForecastHistoryDays daily usage the trends are fitted to when none is configured
+	defaultForecastHistoryDays = 28
+)
+
+// UsageForecast usage trend of an agent and its projection, refreshed by the forecast job
+type UsageForecast struct {
+	ID          uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID     string `json:"agent_id" gorm:"type:varchar(100);not null;unique;comment:'agent id'"`
+	HistoryDays int    `json:"history_days" gorm:"type:int;not null;default:0;comment:'days of usage the trends are fitted to'"`
+
+	// Averages and fitted change per day over the history
+	AvgDailyRequests float64 `json:"avg_daily_requests" gorm:"type:double;not null;default:0"`
+	AvgDailyTokens   float64 `json:"avg_daily_tokens" gorm:"type:double;not null;default:0"`
+	AvgDailyCost     float64 `json:"avg_daily_cost" gorm:"type:double;not null;default:0"`
+	RequestTrend     float64 `json:"request_trend" gorm:"type:double;not null;default:0;comment:'requests per day change'"`
+	TokenTrend       float64 `json:"token_trend" gorm:"type:double;not null;default:0;comment:'tokens per day change'"`
+	CostTrend        float64 `json:"cost_trend" gorm:"type:double;not null;default:0;comment:'cost per day change'"`
+
+	// Projections of the next 30 days, today included
+	ProjectedRequests int64   `json:"projected_requests_30d" gorm:"type:bigint;not null;default:0"`
+	ProjectedTokens   int64   `json:"projected_tokens_30d" gorm:"type:bigint;not null;default:0"`
+	ProjectedCost     float64 `json:"projected_cost_30d" gorm:"type:decimal(14,4);not null;default:0"`
+
+	// Budget of the current calendar month, the days are empty when the agent has no
+	// budget or the projection stays within it until the month ends
+	MonthlyBudget            float64    `json:"monthly_budget" gorm:"type:decimal(14,4);not null;default:0"`
+	MonthToDateCost          float64    `json:"month_to_date_cost" gorm:"type:decimal(14,4);not null;default:0"`
+	DaysUntilBudgetExhausted *int       `json:"days_until_budget_exhausted"`
+	BudgetExhaustedAt        *time.Time `json:"budget_exhausted_at"`
+
+	GeneratedAt time.Time `json:"generated_at"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName specify table name
+func (UsageForecast) TableName() string {
+	return "usage_forecasts"
+}
+
+// dailyUsage usage of an agent on one day
+type dailyUsage struct {
+	AgentID  string  `json:"agent_id"`
+	Day      string  `json:"day"`
+	Requests int64   `json:"requests"`
+	Tokens   int64   `json:"tokens"`
+	Cost     float64 `json:"cost"`
+}
+
+// monthCost cost of an agent in the current month and on the current day
+type monthCost struct {
+	AgentID string  `json:"agent_id"`
+	Month   float64 `json:"month"`
+	Today   float64 `json:"today"`
+}
+
+// ListUsageForecasts get the stored forecasts, of one agent when agentID is set
+func (s *UsageService) ListUsageForecasts(agentID string) ([]*UsageForecast, error) {
+	var forecasts []*UsageForecast
+
+	query := DB.Model(&UsageForecast{})
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if err := query.Order("projected_cost DESC, agent_id").Find(&forecasts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list usage forecasts: %v", err)
+	}
+	return forecasts, nil
+}
+
+// calendarDaysBetween the number of calendar days from one date to another; counted on
+// the dates in UTC, since a day of local time is 23 or 25 hours long across a DST change
+func calendarDaysBetween(from, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+// RefreshUsageForecasts fit the usage trends of every agent and store the projections
+func (s *UsageService) RefreshUsageForecasts(ctx context.Context) ([]*UsageForecast, error) {
+	historyDays := forecastHistoryDays()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := today.AddDate(0, 0, -historyDays)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	var agents []*Agent
+	if err := DB.WithContext(ctx).Select("agent_id", "monthly_budget").Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to list agents: %v", err)
+	}
+
+	// today is still running, it only counts toward the month to date
+	store := currentUsageStore()
+	days, err := store.DailyUsage(ctx, from, today)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate daily usage: %v", err)
+	}
+
+	costs, err := store.MonthCosts(ctx, monthStart, today)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate month to date cost: %v", err)
+	}
+	spent := make(map[string]*monthCost, len(costs))
+	for _, cost := range costs {
+		spent[cost.AgentID] = cost
+	}
+
+	// index the days so missing ones count as no usage
+	type series struct{ requests, tokens, cost []float64 }
+	byAgent := make(map[string]*series, len(agents))
+	for _, agent := range agents {
+		byAgent[agent.AgentID] = &series{
+			requests: make([]float64, historyDays),
+			tokens:   make([]float64, historyDays),
+			cost:     make([]float64, historyDays),
+		}
+	}
+	for _, day := range days {
+		agentSeries, ok := byAgent[day.AgentID]
+		if !ok {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", day.Day, now.Location())
+		if err != nil {
+			continue
+		}
+		index := calendarDaysBetween(from, date)
+		if index < 0 || index >= historyDays {
+			continue
+		}
+		agentSeries.requests[index] = float64(day.Requests)
+		agentSeries.tokens[index] = float64(day.Tokens)
+		agentSeries.cost[index] = day.Cost
+	}
+
+	daysLeftInMonth := monthStart.AddDate(0, 1, 0).Sub(today).Hours() / 24
+	forecasts := make([]*UsageForecast, 0, len(agents))
+	for _, agent := range agents {
+		agentSeries := byAgent[agent.AgentID]
+		agentSpent := spent[agent.AgentID]
+		if agentSpent == nil {
+			agentSpent = &monthCost{}
+		}
+		requests := forecast.Fit(agentSeries.requests)
+		tokens := forecast.Fit(agentSeries.tokens)
+		cost := forecast.Fit(agentSeries.cost)
+		costProjection := cost.Project(forecastDays)
+
+		result := &UsageForecast{
+			AgentID:           agent.AgentID,
+			HistoryDays:       historyDays,
+			AvgDailyRequests:  forecast.Sum(agentSeries.requests) / float64(historyDays),
+			AvgDailyTokens:    forecast.Sum(agentSeries.tokens) / float64(historyDays),
+			AvgDailyCost:      forecast.Sum(agentSeries.cost) / float64(historyDays),
+			RequestTrend:      requests.Slope,
+			TokenTrend:        tokens.Slope,
+			CostTrend:         cost.Slope,
+			ProjectedRequests: int64(math.Round(forecast.Sum(requests.Project(forecastDays)))),
+			ProjectedTokens:   int64(math.Round(forecast.Sum(tokens.Project(forecastDays)))),
+			ProjectedCost:     forecast.Sum(costProjection),
+			MonthlyBudget:     agent.MonthlyBudget,
+			MonthToDateCost:   agentSpent.Month,
+			GeneratedAt:       now,
+		}
+
+		if agent.MonthlyBudget > 0 {
+			// the budget starts over with the next month, only its remaining days count
+			monthProjection := cost.Project(int(math.Round(daysLeftInMonth)))
+			if len(monthProjection) > 0 {
+				monthProjection[0] = math.Max(0, monthProjection[0]-agentSpent.Today)
+			}
+			if days, ok := forecast.DaysUntil(monthProjection, agent.MonthlyBudget-result.MonthToDateCost); ok {
+				exhaustedAt := today
+				if days > 0 {
+					exhaustedAt = today.AddDate(0, 0, days-1)
+				}
+				result.DaysUntilBudgetExhausted = &days
+				result.BudgetExhaustedAt = &exhaustedAt
+			}
+		}
+
+		err := DB.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "agent_id"}},
+			UpdateAll: true,
+		}).Create(result).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to store usage forecast of agent %s: %v", agent.AgentID, err)
+		}
+		forecasts = append(forecasts, result)
+	}
+
+	// agents that were deleted since the last run
+	agentIDs := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		agentIDs = append(agentIDs, agent.AgentID)
+	}
+	cleanup := DB.WithContext(ctx)
+	if len(agentIDs) > 0 {
+		cleanup = cleanup.Where("agent_id NOT IN ?", agentIDs)
+	} else {
+		cleanup = cleanup.Where("1 = 1")
+	}
+	if err := cleanup.Delete(&UsageForecast{}).Error; err != nil {
+		log.Printf("Failed to delete stale usage forecasts: %v", err)
+	}
+
+	return forecasts, nil
+}
+
+// forecastHistoryDays configured days of usage the forecast is fitted to
+func forecastHistoryDays() int {
+	if config.GlobalConfig != nil && config.GlobalConfig.Usage.ForecastHistoryDays > 0 {
+		return config.GlobalConfig.Usage.ForecastHistoryDays
+	}
+	return defaultForecastHistoryDays
+}
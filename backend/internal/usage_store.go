@@ -0,0 +1,284 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"agent-connector/config"
+
+	"gorm.io/gorm"
+)
+
+// Usage storages selectable with usage.storage
+const (
+	UsageStorageMySQL      = "mysql"
+	UsageStorageClickHouse = "clickhouse"
+)
+
+// usageStore storage of the usage records with their content and judge scores. The
+// relational database keeps them by default; high volumes go to an analytics database
+// while agents, users and every other transactional entity stay relational.
+type usageStore interface {
+	// Insert store records, assigning their IDs
+	Insert(ctx context.Context, records []*UsageRecord) error
+
+	// Get one record with its content, still encrypted, and its scores
+	Get(ctx context.Context, id uint) (*UsageRecord, error)
+
+	// List one page of the records the query and filter select, with their total
+	List(ctx context.Context, listQuery *ListQuery, filter *UsageFilter) ([]*UsageRecord, int64, error)
+
+	// Summarize aggregate the records the filter selects by one or two dimensions
+	Summarize(ctx context.Context, filter *UsageFilter, dimensions []usageDimension) ([]*UsageSummary, error)
+
+	// DailyUsage requests, tokens and cost per agent and local day in [from, to)
+	DailyUsage(ctx context.Context, from, to time.Time) ([]*dailyUsage, error)
+
+	// MonthCosts cost per agent since monthStart and since today
+	MonthCosts(ctx context.Context, monthStart, today time.Time) ([]*monthCost, error)
+
+	// InsertScores store judge scores of stored records
+	InsertScores(ctx context.Context, scores []*UsageRecordScore) error
+
+	// QualityTrend average scores per agent, day and rubric of the records the filter selects
+	QualityTrend(ctx context.Context, filter *UsageFilter) ([]*UsageQualityPoint, error)
+}
+
+// usageDimension a group_by dimension of the usage summary: the agent, or the value of
+// a metadata key
+type usageDimension struct {
+	metadataKey string // empty for the agent
+}
+
+// usageRecords installed by InitUsageStore, the relational database when nil
+var usageRecords usageStore
+
+// InitUsageStore install the usage storage configured in the global config, returning
+// its name; the analytics tables are created when they do not exist
+func InitUsageStore() (string, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return "", fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	switch cfg.Usage.Storage {
+	case "", UsageStorageMySQL:
+		usageRecords = relationalUsageStore{}
+		return UsageStorageMySQL, nil
+	case UsageStorageClickHouse:
+		store, err := newClickHouseUsageStore(cfg.Usage.ClickHouse)
+		if err != nil {
+			return "", err
+		}
+		usageRecords = store
+		return UsageStorageClickHouse, nil
+	default:
+		return "", fmt.Errorf("unknown usage storage %q, use %q or %q", cfg.Usage.Storage, UsageStorageMySQL, UsageStorageClickHouse)
+	}
+}
+
+// currentUsageStore the installed usage storage
+func currentUsageStore() usageStore {
+	if usageRecords == nil {
+		return relationalUsageStore{}
+	}
+	return usageRecords
+}
+
+// usageStoreIsRelational whether usage records live in the relational database, so
+// database outages and content re-encryption concern them
+func usageStoreIsRelational() bool {
+	_, ok := currentUsageStore().(relationalUsageStore)
+	return ok
+}
+
+// parseUsageDimensions parse up to two comma separated group_by dimensions, each "agent"
+// or "metadata.<key>"
+func parseUsageDimensions(groupBy string) ([]usageDimension, error) {
+	if groupBy == "" {
+		groupBy = "agent"
+	}
+	values := strings.Split(groupBy, ",")
+	if len(values) > 2 {
+		return nil, fmt.Errorf("%w: group_by supports at most two dimensions", ErrInvalidListQuery)
+	}
+
+	dimensions := make([]usageDimension, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "agent":
+			dimensions = append(dimensions, usageDimension{})
+		case strings.HasPrefix(value, "metadata."):
+			key := strings.TrimPrefix(value, "metadata.")
+			if !metadataKeyPattern.MatchString(key) {
+				return nil, fmt.Errorf("%w: invalid metadata key %q", ErrInvalidListQuery, key)
+			}
+			dimensions = append(dimensions, usageDimension{metadataKey: key})
+		default:
+			return nil, fmt.Errorf("%w: group_by dimensions must be agent or metadata.<key>, got %q", ErrInvalidListQuery, value)
+		}
+	}
+	return dimensions, nil
+}
+
+// relationalUsageStore usage records in the relational database, read from the replica
+// when there is one
+type relationalUsageStore struct{}
+
+// Insert store the records and their tags and content with one insert per table
+func (relationalUsageStore) Insert(ctx context.Context, records []*UsageRecord) error {
+	return DB.WithContext(ctx).CreateInBatches(records, len(records)).Error
+}
+
+// Get one record with its content and scores
+func (relationalUsageStore) Get(ctx context.Context, id uint) (*UsageRecord, error) {
+	var record UsageRecord
+	err := DB.WithContext(ctx).Preload("Content").Preload("Scores").First(&record, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("usage record not found")
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// List one page of records with their total
+func (relationalUsageStore) List(ctx context.Context, listQuery *ListQuery, filter *UsageFilter) ([]*UsageRecord, int64, error) {
+	var records []*UsageRecord
+	var total int64
+
+	err := withReadReplica(func(db *gorm.DB) error {
+		records, total = nil, 0
+		query, err := listQuery.filter(filter.apply(db.WithContext(ctx).Model(&UsageRecord{})), usageRecordListSpec)
+		if err != nil {
+			return err
+		}
+
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+
+		query, err = listQuery.paginate(query, usageRecordListSpec)
+		if err != nil {
+			return err
+		}
+		return query.Find(&records).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+// Summarize aggregate the records, metadata dimensions join the tag table
+func (relationalUsageStore) Summarize(ctx context.Context, filter *UsageFilter, dimensions []usageDimension) ([]*UsageSummary, error) {
+	aliases := []string{"group_name", "subgroup_name"}
+	var selects, groups, joins []string
+	var joinKeys []interface{}
+	for i, dimension := range dimensions {
+		column := "usage_records.agent_id"
+		if dimension.metadataKey != "" {
+			table := fmt.Sprintf("usage_tag_%d", i)
+			joins = append(joins, fmt.Sprintf("LEFT JOIN usage_record_tags %s ON %s.usage_record_id = usage_records.id AND %s.tag_key = ?", table, table, table))
+			joinKeys = append(joinKeys, dimension.metadataKey)
+			column = fmt.Sprintf("COALESCE(%s.tag_value, '')", table)
+		}
+
+		selects = append(selects, column+" AS "+aliases[i])
+		groups = append(groups, column)
+	}
+
+	var summaries []*UsageSummary
+	err := withReadReplica(func(db *gorm.DB) error {
+		summaries = nil
+		query := filter.apply(db.WithContext(ctx).Model(&UsageRecord{}))
+		for i, join := range joins {
+			query = query.Joins(join, joinKeys[i])
+		}
+		return query.Select(strings.Join(selects, ", ") + `,
+		COUNT(*) AS requests,
+		SUM(CASE WHEN usage_records.success OR usage_records.outcome = '` + UsageOutcomeClientCancelled + `' THEN 0 ELSE 1 END) AS failed,
+		SUM(CASE WHEN usage_records.outcome = '` + UsageOutcomeClientCancelled + `' THEN 1 ELSE 0 END) AS client_cancelled,
+		COALESCE(SUM(usage_records.prompt_tokens), 0) AS prompt_tokens,
+		COALESCE(SUM(usage_records.completion_tokens), 0) AS completion_tokens,
+		COALESCE(SUM(usage_records.total_tokens), 0) AS total_tokens,
+		COALESCE(SUM(usage_records.cost), 0) AS cost,
+		COALESCE(AVG(usage_records.duration_ms), 0) AS avg_duration_ms`).
+			Group(strings.Join(groups, ", ")).
+			Order("cost DESC, requests DESC").
+			Scan(&summaries).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// DailyUsage usage per agent and day, in the time zone of the database session
+func (relationalUsageStore) DailyUsage(ctx context.Context, from, to time.Time) ([]*dailyUsage, error) {
+	var days []*dailyUsage
+	err := withReadReplica(func(db *gorm.DB) error {
+		days = nil
+		return db.WithContext(ctx).Model(&UsageRecord{}).
+			Select(`agent_id,
+			DATE_FORMAT(created_at, '%Y-%m-%d') AS day,
+			COUNT(*) AS requests,
+			COALESCE(SUM(total_tokens), 0) AS tokens,
+			COALESCE(SUM(cost), 0) AS cost`).
+			Where("created_at >= ? AND created_at < ?", from, to).
+			Group("agent_id, day").
+			Scan(&days).Error
+	})
+	return days, err
+}
+
+// MonthCosts cost per agent of the month and of today
+func (relationalUsageStore) MonthCosts(ctx context.Context, monthStart, today time.Time) ([]*monthCost, error) {
+	var costs []*monthCost
+	err := withReadReplica(func(db *gorm.DB) error {
+		costs = nil
+		return db.WithContext(ctx).Model(&UsageRecord{}).
+			Select("agent_id, COALESCE(SUM(cost), 0) AS month, COALESCE(SUM(CASE WHEN created_at >= ? THEN cost ELSE 0 END), 0) AS today", today).
+			Where("created_at >= ?", monthStart).
+			Group("agent_id").
+			Scan(&costs).Error
+	})
+	return costs, err
+}
+
+// InsertScores store the scores
+func (relationalUsageStore) InsertScores(ctx context.Context, scores []*UsageRecordScore) error {
+	return DB.WithContext(ctx).Create(scores).Error
+}
+
+// QualityTrend scores joined with their records
+func (relationalUsageStore) QualityTrend(ctx context.Context, filter *UsageFilter) ([]*UsageQualityPoint, error) {
+	var points []*UsageQualityPoint
+	err := withReadReplica(func(db *gorm.DB) error {
+		points = nil
+		return filter.apply(db.WithContext(ctx).Model(&UsageRecordScore{})).
+			Joins("JOIN usage_records ON usage_records.id = usage_record_scores.usage_record_id").
+			Select(`usage_records.agent_id AS agent_id,
+			DATE_FORMAT(usage_records.created_at, '%Y-%m-%d') AS day,
+			usage_record_scores.rubric AS rubric,
+			COUNT(*) AS samples,
+			AVG(usage_record_scores.score) AS avg_score,
+			MIN(usage_record_scores.score) AS min_score`).
+			Group("usage_records.agent_id, day, usage_record_scores.rubric").
+			Order("usage_records.agent_id, day, usage_record_scores.rubric").
+			Scan(&points).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
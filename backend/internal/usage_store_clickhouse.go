@@ -0,0 +1,546 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/config"
+	"agent-connector/pkg/clickhouse"
+)
+
+// clickHouseTables analytics tables of the ClickHouse usage storage, created when missing.
+// Records are partitioned by month and ordered for the per-agent time range scans of
+// the reports; tags are a map so every metadata key can be grouped on.
+var clickHouseTables = []string{
+	`CREATE TABLE IF NOT EXISTS usage_records (
+		id UInt64,
+		agent_id String,
+		playground_token_id Nullable(UInt64),
+		path String,
+		stream Bool,
+		success Bool,
+		outcome LowCardinality(String),
+		error String,
+		duration_ms Int64,
+		prompt_tokens Int64,
+		completion_tokens Int64,
+		total_tokens Int64,
+		cost Float64,
+		metadata String,
+		tags Map(String, String),
+		has_content Bool,
+		content_request String,
+		content_response String,
+		content_parameters String,
+		content_truncated Bool,
+		content_key_id UInt64,
+		created_at DateTime64(3, 'UTC')
+	) ENGINE = MergeTree
+	PARTITION BY toYYYYMM(created_at)
+	ORDER BY (agent_id, created_at, id)`,
+	`CREATE TABLE IF NOT EXISTS usage_record_scores (
+		id UInt64,
+		usage_record_id UInt64,
+		agent_id String,
+		rubric LowCardinality(String),
+		score Float64,
+		reason String,
+		judge_agent_id String,
+		created_at DateTime64(3, 'UTC')
+	) ENGINE = MergeTree
+	PARTITION BY toYYYYMM(created_at)
+	ORDER BY (usage_record_id, rubric)`,
+}
+
+// clickHouseRecordColumns columns of the record list, without the content
+const clickHouseRecordColumns = `id, agent_id, playground_token_id, path, stream, success, outcome, error, duration_ms,
+	prompt_tokens, completion_tokens, total_tokens, cost, metadata, created_at`
+
+// clickHouseUsageStore usage records in ClickHouse. ClickHouse has no auto increment, so
+// IDs are generated here and stay below 2^53 for JavaScript clients.
+type clickHouseUsageStore struct {
+	client   *clickhouse.Client
+	timeZone string
+	ids      *usageIDGenerator
+}
+
+// newClickHouseUsageStore connect to ClickHouse and create the analytics tables
+func newClickHouseUsageStore(settings config.ClickHouseConfig) (*clickHouseUsageStore, error) {
+	client, err := clickhouse.New(clickhouse.Config{
+		URL:      settings.URL,
+		Database: settings.Database,
+		Username: settings.Username,
+		Password: settings.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timeZone := settings.TimeZone
+	if timeZone == "" {
+		timeZone = time.Local.String()
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil || timeZone == "Local" {
+		log.Printf("Counting daily usage in ClickHouse in UTC, the local time zone %q has no IANA name", timeZone)
+		timeZone = "UTC"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, statement := range clickHouseTables {
+		if err := client.Exec(ctx, statement, nil); err != nil {
+			return nil, fmt.Errorf("failed to create ClickHouse usage tables: %w", err)
+		}
+	}
+
+	return &clickHouseUsageStore{client: client, timeZone: timeZone, ids: newUsageIDGenerator()}, nil
+}
+
+// chTime a DateTime64 column, written in the basic format ClickHouse parses fastest
+type chTime time.Time
+
+func (t chTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(t).UTC().Format("2006-01-02 15:04:05.000"))
+}
+
+func (t *chTime) UnmarshalJSON(data []byte) error {
+	return (*time.Time)(t).UnmarshalJSON(data)
+}
+
+// clickHouseUsageRow one row of usage_records
+type clickHouseUsageRow struct {
+	ID                uint64            `json:"id"`
+	AgentID           string            `json:"agent_id"`
+	PlaygroundTokenID *uint64           `json:"playground_token_id"`
+	Path              string            `json:"path"`
+	Stream            bool              `json:"stream"`
+	Success           bool              `json:"success"`
+	Outcome           string            `json:"outcome"`
+	Error             string            `json:"error"`
+	DurationMs        int64             `json:"duration_ms"`
+	PromptTokens      int               `json:"prompt_tokens"`
+	CompletionTokens  int               `json:"completion_tokens"`
+	TotalTokens       int               `json:"total_tokens"`
+	Cost              float64           `json:"cost"`
+	Metadata          string            `json:"metadata"`
+	Tags              map[string]string `json:"tags,omitempty"`
+	HasContent        bool              `json:"has_content"`
+	ContentRequest    string            `json:"content_request"`
+	ContentResponse   string            `json:"content_response"`
+	ContentParameters string            `json:"content_parameters"`
+	ContentTruncated  bool              `json:"content_truncated"`
+	ContentKeyID      uint64            `json:"content_key_id"`
+	CreatedAt         chTime            `json:"created_at"`
+}
+
+// clickHouseScoreRow one row of usage_record_scores
+type clickHouseScoreRow struct {
+	ID            uint64  `json:"id"`
+	UsageRecordID uint64  `json:"usage_record_id"`
+	AgentID       string  `json:"agent_id"`
+	Rubric        string  `json:"rubric"`
+	Score         float64 `json:"score"`
+	Reason        string  `json:"reason"`
+	JudgeAgentID  string  `json:"judge_agent_id"`
+	CreatedAt     chTime  `json:"created_at"`
+}
+
+// newClickHouseUsageRow the row of a record
+func newClickHouseUsageRow(record *UsageRecord) clickHouseUsageRow {
+	row := clickHouseUsageRow{
+		ID:               uint64(record.ID),
+		AgentID:          record.AgentID,
+		Path:             record.Path,
+		Stream:           record.Stream,
+		Success:          record.Success,
+		Outcome:          record.Outcome,
+		Error:            record.Error,
+		DurationMs:       record.DurationMs,
+		PromptTokens:     record.PromptTokens,
+		CompletionTokens: record.CompletionTokens,
+		TotalTokens:      record.TotalTokens,
+		Cost:             record.Cost,
+		Metadata:         record.Metadata,
+		CreatedAt:        chTime(record.CreatedAt),
+	}
+	if record.PlaygroundTokenID != nil {
+		tokenID := uint64(*record.PlaygroundTokenID)
+		row.PlaygroundTokenID = &tokenID
+	}
+	if len(record.Tags) > 0 {
+		row.Tags = make(map[string]string, len(record.Tags))
+		for _, tag := range record.Tags {
+			row.Tags[tag.TagKey] = tag.TagValue
+		}
+	}
+	if content := record.Content; content != nil {
+		row.HasContent = true
+		row.ContentRequest = content.Request
+		row.ContentResponse = content.Response
+		row.ContentParameters = content.Parameters
+		row.ContentTruncated = content.Truncated
+		row.ContentKeyID = uint64(content.KeyID)
+	}
+	return row
+}
+
+// record the record of a row, with its content when the row has one
+func (row clickHouseUsageRow) record() *UsageRecord {
+	record := &UsageRecord{
+		ID:               uint(row.ID),
+		AgentID:          row.AgentID,
+		Path:             row.Path,
+		Stream:           row.Stream,
+		Success:          row.Success,
+		Outcome:          row.Outcome,
+		Error:            row.Error,
+		DurationMs:       row.DurationMs,
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		TotalTokens:      row.TotalTokens,
+		Cost:             row.Cost,
+		Metadata:         row.Metadata,
+		CreatedAt:        time.Time(row.CreatedAt),
+	}
+	if row.PlaygroundTokenID != nil {
+		tokenID := uint(*row.PlaygroundTokenID)
+		record.PlaygroundTokenID = &tokenID
+	}
+	if row.HasContent {
+		record.Content = &UsageRecordContent{
+			UsageRecordID: record.ID,
+			Request:       row.ContentRequest,
+			Response:      row.ContentResponse,
+			Parameters:    row.ContentParameters,
+			Truncated:     row.ContentTruncated,
+			KeyID:         uint(row.ContentKeyID),
+			CreatedAt:     record.CreatedAt,
+		}
+	}
+	return record
+}
+
+// Insert assign IDs and write the records with one insert
+func (s *clickHouseUsageStore) Insert(ctx context.Context, records []*UsageRecord) error {
+	rows := make([]clickHouseUsageRow, len(records))
+	for i, record := range records {
+		if record.ID == 0 {
+			record.ID = uint(s.ids.next())
+		}
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = time.Now()
+		}
+		if record.Content != nil {
+			record.Content.UsageRecordID = record.ID
+		}
+		rows[i] = newClickHouseUsageRow(record)
+	}
+	return clickhouse.Insert(ctx, s.client, "usage_records", rows)
+}
+
+// Get one record with its content and scores
+func (s *clickHouseUsageStore) Get(ctx context.Context, id uint) (*UsageRecord, error) {
+	rows, err := clickhouse.Query[clickHouseUsageRow](ctx, s.client,
+		"SELECT * FROM usage_records WHERE id = {id:UInt64} LIMIT 1", clickhouse.Params{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("usage record not found")
+	}
+	record := rows[0].record()
+
+	scores, err := clickhouse.Query[clickHouseScoreRow](ctx, s.client,
+		"SELECT * FROM usage_record_scores WHERE usage_record_id = {id:UInt64} ORDER BY rubric", clickhouse.Params{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	for _, score := range scores {
+		record.Scores = append(record.Scores, &UsageRecordScore{
+			ID:            uint(score.ID),
+			UsageRecordID: uint(score.UsageRecordID),
+			AgentID:       score.AgentID,
+			Rubric:        score.Rubric,
+			Score:         score.Score,
+			Reason:        score.Reason,
+			JudgeAgentID:  score.JudgeAgentID,
+			CreatedAt:     time.Time(score.CreatedAt),
+		})
+	}
+	return record, nil
+}
+
+// List one page of records with their total, same search, status and sort as the
+// relational list
+func (s *clickHouseUsageStore) List(ctx context.Context, listQuery *ListQuery, filter *UsageFilter) ([]*UsageRecord, int64, error) {
+	where := newClickHouseWhere("")
+	where.filter(filter)
+	if listQuery.Search != "" {
+		search := where.param(listQuery.Search, "String")
+		where.add(fmt.Sprintf("(positionCaseInsensitive(agent_id, %[1]s) > 0 OR positionCaseInsensitive(path, %[1]s) > 0 OR positionCaseInsensitive(metadata, %[1]s) > 0)", search))
+	}
+	switch listQuery.Status {
+	case "":
+	case "success":
+		where.add("success")
+	case "failed":
+		where.add("NOT success AND outcome != '" + UsageOutcomeClientCancelled + "'")
+	case UsageOutcomeClientCancelled:
+		where.add("outcome = '" + UsageOutcomeClientCancelled + "'")
+	default:
+		return nil, 0, invalidStatus(listQuery.Status)
+	}
+	if listQuery.Type != "" {
+		return nil, 0, fmt.Errorf("%w: type filter is not supported", ErrInvalidListQuery)
+	}
+	if listQuery.CreatedAfter != nil {
+		where.add("created_at >= " + where.param(*listQuery.CreatedAfter, "DateTime64(3)"))
+	}
+
+	sortBy := listQuery.SortBy
+	if sortBy == "" {
+		sortBy = usageRecordListSpec.defaultSort
+	}
+	if _, ok := usageRecordListSpec.sortColumns[sortBy]; !ok {
+		return nil, 0, fmt.Errorf("%w: sort_by %s is not supported", ErrInvalidListQuery, sortBy)
+	}
+	order := "DESC"
+	if listQuery.Order == "asc" {
+		order = "ASC"
+	}
+
+	type count struct {
+		Total int64 `json:"total"`
+	}
+	totals, err := clickhouse.Query[count](ctx, s.client, "SELECT count() AS total FROM usage_records"+where.clause(), where.params)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if len(totals) > 0 {
+		total = totals[0].Total
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM usage_records%s ORDER BY %s %s, id LIMIT %d OFFSET %d",
+		clickHouseRecordColumns, where.clause(), sortBy, order, listQuery.PageSize, (listQuery.Page-1)*listQuery.PageSize)
+	rows, err := clickhouse.Query[clickHouseUsageRow](ctx, s.client, query, where.params)
+	if err != nil {
+		return nil, 0, err
+	}
+	records := make([]*UsageRecord, len(rows))
+	for i, row := range rows {
+		records[i] = row.record()
+	}
+	return records, total, nil
+}
+
+// Summarize aggregate the records, metadata dimensions read the tags map, which is
+// empty for records without the key
+func (s *clickHouseUsageStore) Summarize(ctx context.Context, filter *UsageFilter, dimensions []usageDimension) ([]*UsageSummary, error) {
+	where := newClickHouseWhere("")
+	where.filter(filter)
+
+	aliases := []string{"`group`", "subgroup"}
+	var selects, groups []string
+	for i, dimension := range dimensions {
+		column := "agent_id"
+		if dimension.metadataKey != "" {
+			column = "tags[" + where.param(dimension.metadataKey, "String") + "]"
+		}
+		selects = append(selects, column+" AS "+aliases[i])
+		groups = append(groups, aliases[i])
+	}
+
+	query := strings.Join(selects, ", ") + `,
+		count() AS requests,
+		countIf(NOT success AND outcome != '` + UsageOutcomeClientCancelled + `') AS failed,
+		countIf(outcome = '` + UsageOutcomeClientCancelled + `') AS client_cancelled,
+		sum(prompt_tokens) AS prompt_tokens,
+		sum(completion_tokens) AS completion_tokens,
+		sum(total_tokens) AS total_tokens,
+		sum(cost) AS cost,
+		avg(duration_ms) AS avg_duration_ms`
+	return clickhouse.Query[*UsageSummary](ctx, s.client,
+		"SELECT "+query+" FROM usage_records"+where.clause()+" GROUP BY "+strings.Join(groups, ", ")+" ORDER BY cost DESC, requests DESC",
+		where.params)
+}
+
+// DailyUsage usage per agent and day in the configured time zone
+func (s *clickHouseUsageStore) DailyUsage(ctx context.Context, from, to time.Time) ([]*dailyUsage, error) {
+	return clickhouse.Query[*dailyUsage](ctx, s.client, `SELECT agent_id,
+		formatDateTime(created_at, '%Y-%m-%d', {tz:String}) AS day,
+		count() AS requests,
+		sum(total_tokens) AS tokens,
+		sum(cost) AS cost
+		FROM usage_records
+		WHERE created_at >= {from:DateTime64(3)} AND created_at < {to:DateTime64(3)}
+		GROUP BY agent_id, day`,
+		clickhouse.Params{"tz": s.timeZone, "from": from, "to": to})
+}
+
+// MonthCosts cost per agent of the month and of today
+func (s *clickHouseUsageStore) MonthCosts(ctx context.Context, monthStart, today time.Time) ([]*monthCost, error) {
+	return clickhouse.Query[*monthCost](ctx, s.client, `SELECT agent_id,
+		sum(cost) AS month,
+		sumIf(cost, created_at >= {today:DateTime64(3)}) AS today
+		FROM usage_records
+		WHERE created_at >= {month_start:DateTime64(3)}
+		GROUP BY agent_id`,
+		clickhouse.Params{"today": today, "month_start": monthStart})
+}
+
+// InsertScores assign IDs and write the scores with one insert
+func (s *clickHouseUsageStore) InsertScores(ctx context.Context, scores []*UsageRecordScore) error {
+	rows := make([]clickHouseScoreRow, len(scores))
+	for i, score := range scores {
+		if score.ID == 0 {
+			score.ID = uint(s.ids.next())
+		}
+		if score.CreatedAt.IsZero() {
+			score.CreatedAt = time.Now()
+		}
+		rows[i] = clickHouseScoreRow{
+			ID:            uint64(score.ID),
+			UsageRecordID: uint64(score.UsageRecordID),
+			AgentID:       score.AgentID,
+			Rubric:        score.Rubric,
+			Score:         score.Score,
+			Reason:        score.Reason,
+			JudgeAgentID:  score.JudgeAgentID,
+			CreatedAt:     chTime(score.CreatedAt),
+		}
+	}
+	return clickhouse.Insert(ctx, s.client, "usage_record_scores", rows)
+}
+
+// QualityTrend scores joined with their records, by the day of the request
+func (s *clickHouseUsageStore) QualityTrend(ctx context.Context, filter *UsageFilter) ([]*UsageQualityPoint, error) {
+	where := newClickHouseWhere("r.")
+	where.filter(filter)
+	where.params["tz"] = s.timeZone
+
+	return clickhouse.Query[*UsageQualityPoint](ctx, s.client, `SELECT r.agent_id AS agent_id,
+		formatDateTime(r.created_at, '%Y-%m-%d', {tz:String}) AS day,
+		s.rubric AS rubric,
+		count() AS samples,
+		avg(s.score) AS avg_score,
+		min(s.score) AS min_score
+		FROM usage_record_scores AS s
+		INNER JOIN usage_records AS r ON r.id = s.usage_record_id`+where.clause()+`
+		GROUP BY agent_id, day, rubric
+		ORDER BY agent_id, day, rubric`, where.params)
+}
+
+// clickHouseWhere conditions of a statement with their query parameters, columns get
+// the table prefix
+type clickHouseWhere struct {
+	prefix     string
+	conditions []string
+	params     clickhouse.Params
+}
+
+func newClickHouseWhere(prefix string) *clickHouseWhere {
+	return &clickHouseWhere{prefix: prefix, params: clickhouse.Params{}}
+}
+
+// param register a value and return its placeholder
+func (w *clickHouseWhere) param(value interface{}, typ string) string {
+	name := fmt.Sprintf("p%d", len(w.params))
+	w.params[name] = value
+	return "{" + name + ":" + typ + "}"
+}
+
+// paramList register string values and return their comma separated placeholders
+func (w *clickHouseWhere) paramList(values []string) string {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = w.param(value, "String")
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// add a condition
+func (w *clickHouseWhere) add(condition string) {
+	w.conditions = append(w.conditions, condition)
+}
+
+// filter add the conditions of a usage filter
+func (w *clickHouseWhere) filter(f *UsageFilter) {
+	if f == nil {
+		return
+	}
+	if f.AgentID != "" {
+		w.add(w.prefix + "agent_id = " + w.param(f.AgentID, "String"))
+	}
+	if f.From != nil {
+		w.add(w.prefix + "created_at >= " + w.param(*f.From, "DateTime64(3)"))
+	}
+	if f.To != nil {
+		w.add(w.prefix + "created_at < " + w.param(*f.To, "DateTime64(3)"))
+	}
+	if f.PlaygroundTokenID != nil {
+		w.add(w.prefix + "playground_token_id = " + w.param(*f.PlaygroundTokenID, "UInt64"))
+	}
+	if len(f.agentIDs) > 0 {
+		w.add(w.prefix + "agent_id IN (" + w.paramList(f.agentIDs) + ")")
+	}
+	if len(f.excludeAgentIDs) > 0 {
+		w.add(w.prefix + "agent_id NOT IN (" + w.paramList(f.excludeAgentIDs) + ")")
+	}
+	for key, value := range f.Tags {
+		w.add(w.prefix + "tags[" + w.param(key, "String") + "] = " + w.param(value, "String"))
+	}
+}
+
+// clause the WHERE clause, empty without conditions
+func (w *clickHouseWhere) clause() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+// usageIDEpoch start of the generated IDs; milliseconds since then shifted by 12 bits
+// stay below 2^53 until 2093
+var usageIDEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// usageIDGenerator time ordered IDs of the records and scores of one process: the
+// millisecond and a sequence that starts at a random value every millisecond, so
+// instances writing at the same time rarely collide
+type usageIDGenerator struct {
+	mu       sync.Mutex
+	lastMs   int64
+	sequence int64
+	started  int64
+}
+
+func newUsageIDGenerator() *usageIDGenerator {
+	return &usageIDGenerator{}
+}
+
+// next a new ID; more than 4096 IDs in one millisecond borrow the next one
+func (g *usageIDGenerator) next() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Since(usageIDEpoch).Milliseconds()
+	if ms <= g.lastMs {
+		g.sequence = (g.sequence + 1) & 0xfff
+		if g.sequence == g.started {
+			g.lastMs++
+		}
+		ms = g.lastMs
+	} else {
+		g.lastMs = ms
+		g.started = rand.Int63n(4096)
+		g.sequence = g.started
+	}
+	return uint64(ms)<<12 | uint64(g.sequence)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// summaryUsageStore a usage store that only summarizes, every agent having the given
+// number of requests
+type summaryUsageStore struct {
+	usageStore
+	requests int64
+}
+
+func (s summaryUsageStore) Summarize(ctx context.Context, filter *UsageFilter, dimensions []usageDimension) ([]*UsageSummary, error) {
+	if s.requests == 0 {
+		return nil, nil
+	}
+	return []*UsageSummary{{Group: filter.AgentID, Requests: s.requests, TotalTokens: 10 * s.requests, Cost: 0.5}}, nil
+}
+
+func TestSummarizeOwnUsageNotAnonymized(t *testing.T) {
+	previous := usageRecords
+	defer func() { usageRecords = previous }()
+	service := &UsageService{}
+	since := time.Now().Add(-time.Hour)
+
+	// fewer requests than the privacy group size are still reported to the agent's key
+	usageRecords = summaryUsageStore{requests: defaultPrivacyMinGroupSize - 2}
+	summary, err := service.SummarizeOwnUsage(&UsageFilter{AgentID: "private-agent", From: &since})
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultPrivacyMinGroupSize-2), summary.Requests)
+	assert.Equal(t, int64(30), summary.TotalTokens)
+	assert.Equal(t, 0.5, summary.Cost)
+
+	usageRecords = summaryUsageStore{}
+	summary, err = service.SummarizeOwnUsage(&UsageFilter{AgentID: "private-agent"})
+	require.NoError(t, err)
+	assert.Zero(t, summary.Requests)
+
+	_, err = service.SummarizeOwnUsage(&UsageFilter{})
+	assert.Error(t, err)
+}
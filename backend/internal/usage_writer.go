@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"agent-connector/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// usageSpillKey Redis list holding usage records that did not fit into the buffer of
+// a usage writer, shared by every dataflow instance
+const usageSpillKey = "agent-connector:usage-spill"
+
+// Overflow strategies of the usage writer
+const (
+	UsageOverflowDrop  = "drop"
+	UsageOverflowRedis = "redis"
+)
+
+// ErrUsageDropped the usage record did not fit into the buffer of the usage writer
+var ErrUsageDropped = errors.New("usage writer buffer is full, usage record dropped")
+
+// usageWriter installed by InitUsageWriter, nil when records are written per request
+var usageWriter *UsageWriter
+
+// pendingUsage a usage record waiting in the buffer, with the callback of its request
+type pendingUsage struct {
+	record  *UsageRecord
+	written func(*UsageRecord)
+}
+
+// spilledUsage a usage record in the spill list; the content key ID and the tags are
+// not part of the record's JSON
+type spilledUsage struct {
+	Record       *UsageRecord `json:"record"`
+	ContentKeyID uint         `json:"content_key_id,omitempty"`
+}
+
+// UsageWriterStats counters of the usage writer for the health check
+type UsageWriterStats struct {
+	Buffered int   `json:"buffered"`
+	Written  int64 `json:"written"`
+	Spilled  int64 `json:"spilled"`
+	Dropped  int64 `json:"dropped"`
+	Failed   int64 `json:"failed"`
+}
+
+// UsageWriter writes usage records in batches from a background goroutine, so a request
+// does not wait for its record to be stored. Records that do not fit into the buffer are
+// dropped and counted, or spilled to Redis and written once the buffer has room again.
+type UsageWriter struct {
+	records       chan pendingUsage
+	batchSize     int
+	flushInterval time.Duration
+	spill         *redis.Client
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	written atomic.Int64
+	spilled atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// InitUsageWriter install the usage writer configured in the global config, nil when
+// it is disabled
+func InitUsageWriter() (*UsageWriter, error) {
+	cfg := config.GlobalConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+	settings := cfg.Usage.Writer
+	if !settings.Enabled {
+		return nil, nil
+	}
+
+	w := &UsageWriter{
+		records:       make(chan pendingUsage, max(settings.BufferSize, 1)),
+		batchSize:     max(settings.BatchSize, 1),
+		flushInterval: settings.FlushInterval,
+		done:          make(chan struct{}),
+	}
+	if w.flushInterval <= 0 {
+		w.flushInterval = time.Second
+	}
+	switch settings.Overflow {
+	case "", UsageOverflowDrop:
+	case UsageOverflowRedis:
+		// Redis that is down only means overflowing records are dropped until it is back
+		w.spill = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+	default:
+		return nil, fmt.Errorf("unknown usage writer overflow %q, use %q or %q", settings.Overflow, UsageOverflowDrop, UsageOverflowRedis)
+	}
+
+	go w.run()
+	usageWriter = w
+	return w, nil
+}
+
+// CurrentUsageWriterStats counters of the installed usage writer, nil when there is none
+func CurrentUsageWriterStats() *UsageWriterStats {
+	if usageWriter == nil {
+		return nil
+	}
+	return usageWriter.Stats()
+}
+
+// Stats current counters
+func (w *UsageWriter) Stats() *UsageWriterStats {
+	return &UsageWriterStats{
+		Buffered: len(w.records),
+		Written:  w.written.Load(),
+		Spilled:  w.spilled.Load(),
+		Dropped:  w.dropped.Load(),
+		Failed:   w.failed.Load(),
+	}
+}
+
+// enqueue buffer a record without blocking; after Close records are written at once
+func (w *UsageWriter) enqueue(record *UsageRecord, written func(*UsageRecord)) error {
+	if record.CreatedAt.IsZero() {
+		// the time of the request, not of the batch
+		record.CreatedAt = time.Now()
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.write([]pendingUsage{{record: record, written: written}})
+		return nil
+	}
+
+	select {
+	case w.records <- pendingUsage{record: record, written: written}:
+		return nil
+	default:
+	}
+
+	if w.spill != nil {
+		err := w.spillRecord(record)
+		if err == nil {
+			w.spilled.Add(1)
+			return nil
+		}
+		log.Printf("Failed to spill usage record of agent %s to Redis: %v", record.AgentID, err)
+	}
+	w.dropped.Add(1)
+	return ErrUsageDropped
+}
+
+// Close stop accepting records and write the buffered ones; records enqueued afterwards
+// are written at once
+func (w *UsageWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.records)
+	w.mu.Unlock()
+
+	<-w.done
+	if w.spill != nil {
+		return w.spill.Close()
+	}
+	return nil
+}
+
+// run write the buffered records whenever a batch is full or the flush interval passed,
+// until the buffer is closed and drained
+func (w *UsageWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]pendingUsage, 0, w.batchSize)
+	for {
+		select {
+		case pending, ok := <-w.records:
+			if !ok {
+				w.write(batch)
+				return
+			}
+			batch = append(batch, pending)
+			if len(batch) >= w.batchSize {
+				w.write(batch)
+				batch = make([]pendingUsage, 0, w.batchSize)
+			}
+		case <-ticker.C:
+			w.write(batch)
+			batch = make([]pendingUsage, 0, w.batchSize)
+			w.drainSpill()
+		}
+	}
+}
+
+// write store a batch with one insert; while the database is unreachable the records
+// are deferred like single ones, and a batch the database refuses is retried record by
+// record so one bad record does not lose the others. Batches the analytics usage
+// storage refuses are counted as failed.
+func (w *UsageWriter) write(batch []pendingUsage) {
+	if len(batch) == 0 {
+		return
+	}
+	relational := usageStoreIsRelational()
+	if relational && databaseDown.Load() {
+		w.deferBatch(batch)
+		return
+	}
+
+	records := make([]*UsageRecord, len(batch))
+	for i, pending := range batch {
+		records[i] = pending.record
+	}
+	err := currentUsageStore().Insert(context.Background(), records)
+	if err == nil {
+		w.stored(batch)
+		return
+	}
+	if !relational {
+		w.failed.Add(int64(len(batch)))
+		log.Printf("Failed to write a batch of %d usage records: %v", len(batch), err)
+		return
+	}
+	if databaseFailed(err) {
+		w.deferBatch(batch)
+		return
+	}
+
+	log.Printf("Failed to write a batch of %d usage records, writing them one by one: %v", len(batch), err)
+	for _, pending := range batch {
+		resetUsageIDs(pending.record)
+		if err := DB.Create(pending.record).Error; err != nil {
+			w.failed.Add(1)
+			log.Printf("Failed to record usage of agent %s: %v", pending.record.AgentID, err)
+			continue
+		}
+		w.stored([]pendingUsage{pending})
+	}
+}
+
+// stored count written records and call back their requests
+func (w *UsageWriter) stored(batch []pendingUsage) {
+	w.written.Add(int64(len(batch)))
+	for _, pending := range batch {
+		if pending.written != nil {
+			pending.written(pending.record)
+		}
+	}
+}
+
+// deferBatch hand the records of a batch to the database outage buffer
+func (w *UsageWriter) deferBatch(batch []pendingUsage) {
+	for _, pending := range batch {
+		resetUsageIDs(pending.record)
+		if err := deferUsage(pending.record); !errors.Is(err, ErrUsageDeferred) {
+			w.failed.Add(1)
+		}
+	}
+}
+
+// spillRecord push a record to the spill list
+func (w *UsageWriter) spillRecord(record *UsageRecord) error {
+	spilled := spilledUsage{Record: record}
+	if record.Content != nil {
+		spilled.ContentKeyID = record.Content.KeyID
+	}
+	payload, err := json.Marshal(spilled)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return w.spill.RPush(ctx, usageSpillKey, payload).Err()
+}
+
+// drainSpill write a batch of spilled records while the buffer is at most half full
+// and the database is reachable
+func (w *UsageWriter) drainSpill() {
+	if w.spill == nil || (usageStoreIsRelational() && databaseDown.Load()) || len(w.records) > cap(w.records)/2 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	payloads, err := w.spill.LPopCount(ctx, usageSpillKey, w.batchSize).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Failed to read spilled usage records: %v", err)
+		}
+		return
+	}
+
+	batch := make([]pendingUsage, 0, len(payloads))
+	for _, payload := range payloads {
+		var spilled spilledUsage
+		if err := json.Unmarshal([]byte(payload), &spilled); err != nil || spilled.Record == nil {
+			w.failed.Add(1)
+			log.Printf("Dropping invalid spilled usage record: %v", err)
+			continue
+		}
+		record := spilled.Record
+		record.SetMetadata(record.MetadataMap())
+		if record.Content != nil {
+			record.Content.KeyID = spilled.ContentKeyID
+		}
+		batch = append(batch, pendingUsage{record: record})
+	}
+	w.write(batch)
+}
+
+// resetUsageIDs clear the IDs a failed insert may have assigned, so the record can be
+// inserted again
+func resetUsageIDs(record *UsageRecord) {
+	record.ID = 0
+	if record.Content != nil {
+		record.Content.ID = 0
+		record.Content.UsageRecordID = 0
+	}
+	for i := range record.Tags {
+		record.Tags[i].ID = 0
+		record.Tags[i].UsageRecordID = 0
+	}
+}
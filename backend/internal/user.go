@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,11 +18,27 @@ type User struct {
 	Role      UserRole       `json:"role" gorm:"default:'user'"`
 	Status    UserStatus     `json:"status" gorm:"default:'active'"`
 	LastLogin *time.Time     `json:"last_login"`
+	Version   int            `json:"version" gorm:"not null;default:1"` // incremented by every update, for optimistic locking
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Priority of the user's dataflow requests in the agent queues, 0 (lowest) to 100
+	// (highest); nil means the system default
+	Priority *int `json:"priority"`
+
+	// QPS of the user's dataflow requests to each agent; nil means the system default
+	QPS *int `json:"qps"`
 }
 
+// Queue priorities of dataflow requests, the range of the queue package without the
+// critical level reserved for the platform
+const (
+	MinUserPriority     = 0
+	MaxUserPriority     = 100
+	DefaultUserPriority = 50
+)
+
 // UserRole user role enum
 type UserRole string
 
@@ -55,6 +72,21 @@ type UserSession struct {
 	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
 	CreatedAt time.Time `json:"created_at"`
 	User      User      `json:"user" gorm:"foreignKey:UserID"`
+
+	// Client the session was created from and when it was last used
+	IP           string     `json:"ip" gorm:"size:45"`
+	UserAgent    string     `json:"user_agent" gorm:"size:500"`
+	LastActiveAt *time.Time `json:"last_active_at"`
+
+	// Coarse fingerprint of the client the session is bound to: its network and a hash
+	// of its user agent. Empty for sessions that are not bound
+	BindingNetwork       string `json:"-" gorm:"size:64"`
+	BindingUserAgentHash string `json:"-" gorm:"size:64"`
+
+	// Impersonation sessions are issued by an admin to act as the user
+	ImpersonatorID      *uint  `json:"impersonator_id,omitempty" gorm:"index"`
+	ImpersonationReason string `json:"impersonation_reason,omitempty" gorm:"size:255"`
+	Impersonator        *User  `json:"impersonator,omitempty" gorm:"foreignKey:ImpersonatorID"`
 }
 
 // TableName specify table name
@@ -67,6 +99,66 @@ func (us *UserSession) IsExpired() bool {
 	return time.Now().After(us.ExpiresAt)
 }
 
+// IsImpersonated check if the session was issued to an admin acting as the user
+func (us *UserSession) IsImpersonated() bool {
+	return us.ImpersonatorID != nil
+}
+
+// Device short description of the client from its user agent, e.g. "Chrome on macOS"
+func (us *UserSession) Device() string {
+	if us.UserAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, candidate := range userAgentBrowsers {
+		if strings.Contains(us.UserAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	for _, candidate := range userAgentSystems {
+		if strings.Contains(us.UserAgent, candidate.token) {
+			return browser + " on " + candidate.name
+		}
+	}
+	return browser
+}
+
+// userAgentBrowsers user agent tokens of common clients, checked in order since most
+// browsers also claim to be Safari or Chrome
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+	{"python-requests/", "Python"},
+	{"Go-http-client/", "Go"},
+}
+
+// userAgentSystems user agent tokens of operating systems, checked in order
+var userAgentSystems = []struct{ token, name string }{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// ImpersonationRevoked check if the admin of an impersonation session can no longer
+// impersonate, the impersonator must be preloaded
+func (us *UserSession) ImpersonationRevoked() bool {
+	if !us.IsImpersonated() {
+		return false
+	}
+	return us.Impersonator == nil || !us.Impersonator.IsActive() || !us.Impersonator.CanImpersonate()
+}
+
 // UserLoginLog user login log
 type UserLoginLog struct {
 	ID        uint      `json:"id" gorm:"primarykey"`
@@ -77,6 +169,12 @@ type UserLoginLog struct {
 	Message   string    `json:"message" gorm:"size:255"`
 	CreatedAt time.Time `json:"created_at"`
 	User      User      `json:"user" gorm:"foreignKey:UserID"`
+
+	// Where the login came from, as far as known, and what made it unusual
+	Country   string   `json:"country" gorm:"size:8;not null;default:''"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Anomalies string   `json:"anomalies" gorm:"size:100;not null;default:''"`
 }
 
 // TableName specify table name
@@ -84,6 +182,26 @@ func (UserLoginLog) TableName() string {
 	return "user_login_logs"
 }
 
+// ImpersonationLog audit entry of a request made with an impersonation session
+type ImpersonationLog struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	SessionID      uint      `json:"session_id" gorm:"not null;index"`
+	ImpersonatorID uint      `json:"impersonator_id" gorm:"not null;index"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	Action         string    `json:"action" gorm:"size:50"` // started, request
+	Method         string    `json:"method" gorm:"size:10"`
+	Path           string    `json:"path" gorm:"size:255"`
+	Status         int       `json:"status"`
+	IP             string    `json:"ip" gorm:"size:45"`
+	Reason         string    `json:"reason" gorm:"size:255"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName specify table name
+func (ImpersonationLog) TableName() string {
+	return "impersonation_logs"
+}
+
 // HasPermission check if user has specific permission
 func (u *User) HasPermission(action string) bool {
 	switch u.Role {
@@ -108,11 +226,26 @@ func (u *User) CanManageUser() bool {
 	return u.Role == UserRoleAdmin
 }
 
+// CanImpersonate check if user can act as another user, only admins can
+func (u *User) CanImpersonate() bool {
+	return u.Role == UserRoleAdmin
+}
+
 // CanManageSystem check if user can manage system config
 func (u *User) CanManageSystem() bool {
 	return u.Role == UserRoleAdmin || u.Role == UserRoleOperator
 }
 
+// EffectivePriority the queue priority of the user's dataflow requests
+func (u *User) EffectivePriority() int {
+	return ResolveUserPriority(u.Limits())
+}
+
+// Limits the rate limit overrides of the user
+func (u *User) Limits() *UserLimits {
+	return &UserLimits{Priority: u.Priority, QPS: u.QPS, Role: u.Role}
+}
+
 // IsActive check if user is active
 func (u *User) IsActive() bool {
 	return u.Status == UserStatusActive
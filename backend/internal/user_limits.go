@@ -0,0 +1,44 @@
+package internal
+
+import "agent-connector/config"
+
+// UserLimits the rate limit overrides of a platform user, nil fields fall back to the
+// system defaults; Role is the user's role, the group agent access lists name
+type UserLimits struct {
+	Priority *int
+	QPS      *int
+	Role     UserRole
+}
+
+// ResolveUserPriority the queue priority of a user's requests: the user's own
+// priority, else the default priority of the live system configuration, else
+// DefaultUserPriority. limits may be nil for requests without a known user.
+func ResolveUserPriority(limits *UserLimits) int {
+	if limits != nil && limits.Priority != nil {
+		return *limits.Priority
+	}
+	if priority := CurrentSystemConfig().DefaultPriority; priority > 0 {
+		return priority
+	}
+	return DefaultUserPriority
+}
+
+// ResolveUserQPS the QPS of a user's requests to an agent: the agent's user_qps
+// override of its connector key, else the user's own QPS, else the default QPS of the
+// live system configuration, else security.default_rate_limit of the configuration
+// file. limits is nil for the default bucket of the agent; 0 means no limit.
+func ResolveUserQPS(keyQPS int, limits *UserLimits) int {
+	if keyQPS > 0 {
+		return keyQPS
+	}
+	if limits != nil && limits.QPS != nil && *limits.QPS > 0 {
+		return *limits.QPS
+	}
+	if qps := CurrentSystemConfig().DefaultQPS; qps > 0 {
+		return qps
+	}
+	if config.GlobalConfig != nil {
+		return config.GlobalConfig.Security.DefaultRateLimit
+	}
+	return 0
+}
@@ -5,12 +5,29 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"agent-connector/pkg/textlimit"
+
 	"gorm.io/gorm"
 )
 
+// sessionTouchInterval how often the last activity of a session is written at most
+const sessionTouchInterval = time.Minute
+
+// Credentials of the admin account created on first start, bootstrap disables it
+// once a real admin is seeded
+const (
+	defaultAdminUsername = "admin"
+	defaultAdminPassword = "admin123"
+)
+
+// ErrSessionNotFound the session does not exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
 // UserService user service
 type UserService struct{}
 
@@ -33,11 +50,11 @@ func (s *UserService) CreateUser(user *User) error {
 	}
 
 	// hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := passwordHasher().Hash(user.Password)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %v", err)
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
 	// create user
 	if err := DB.Create(user).Error; err != nil {
@@ -63,9 +80,10 @@ func (s *UserService) AuthenticateUser(username, password string) (*User, error)
 	}
 
 	// validate password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+	if err := passwordHasher().Verify(user.Password, password); err != nil {
 		return nil, errors.New("invalid username or password")
 	}
+	rehashPassword(&user, password)
 
 	// update last login time
 	now := time.Now()
@@ -99,14 +117,37 @@ func (s *UserService) GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
-// UpdateUser update user info
+// UpdateUser update user info, user.Version is the version the changes are based on;
+// ErrVersionConflict when the user changed since
 func (s *UserService) UpdateUser(user *User) error {
-	if err := DB.Save(user).Error; err != nil {
+	if err := updateVersioned(DB, user, &user.Version); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			return err
+		}
 		return fmt.Errorf("failed to update user: %v", err)
 	}
+	invalidateUserLookups(user.ID)
 	return nil
 }
 
+// GetUserLimitsByUsername get the rate limit overrides and role of an active user by
+// username, nil when there is no such user
+func (s *UserService) GetUserLimitsByUsername(username string) (*UserLimits, error) {
+	if username == "" {
+		return nil, nil
+	}
+
+	var user User
+	err := DB.Select("id", "priority", "qps", "role").Where("username = ? AND status = ?", username, UserStatusActive).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return user.Limits(), nil
+}
+
 // ChangePassword change password
 func (s *UserService) ChangePassword(userID uint, oldPassword, newPassword string) error {
 	user, err := s.GetUserByID(userID)
@@ -115,35 +156,57 @@ func (s *UserService) ChangePassword(userID uint, oldPassword, newPassword strin
 	}
 
 	// validate old password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+	if err := passwordHasher().Verify(user.Password, oldPassword); err != nil {
 		return errors.New("invalid old password")
 	}
 
 	// hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := passwordHasher().Hash(newPassword)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %v", err)
 	}
 
 	// update password
-	if err := DB.Model(user).Update("password", string(hashedPassword)).Error; err != nil {
+	if err := DB.Model(user).Update("password", hashedPassword).Error; err != nil {
 		return fmt.Errorf("failed to update password: %v", err)
 	}
 
 	return nil
 }
 
+// userListSpec searchable, filterable and sortable columns of the user list,
+// the type filter matches the user role
+var userListSpec = listQuerySpec{
+	searchColumns: []string{"username", "email", "full_name"},
+	typeColumn:    "role",
+	sortColumns: map[string]string{
+		"username":   "username",
+		"email":      "email",
+		"role":       "role",
+		"status":     "status",
+		"last_login": "last_login",
+		"created_at": "created_at",
+	},
+	defaultSort: "created_at",
+	filterStatus: func(db *gorm.DB, status string) (*gorm.DB, error) {
+		switch UserStatus(status) {
+		case UserStatusActive, UserStatusInactive, UserStatusBlocked, UserStatusPending:
+			return db.Where("status = ?", status), nil
+		default:
+			return nil, invalidStatus(status)
+		}
+	},
+}
+
 // ListUsers get user list
-func (s *UserService) ListUsers(page, pageSize int, search string) ([]*User, int64, error) {
+func (s *UserService) ListUsers(listQuery *ListQuery) ([]*User, int64, error) {
 	var users []*User
 	var total int64
 
-	query := DB.Model(&User{})
-
-	// search conditions
-	if search != "" {
-		query = query.Where("username LIKE ? OR email LIKE ? OR full_name LIKE ?",
-			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	// search and filter conditions
+	query, err := listQuery.filter(DB.Model(&User{}), userListSpec)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// get total
@@ -151,9 +214,12 @@ func (s *UserService) ListUsers(page, pageSize int, search string) ([]*User, int
 		return nil, 0, fmt.Errorf("failed to count users: %v", err)
 	}
 
-	// paginated query
-	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&users).Error; err != nil {
+	// sorted and paginated query
+	query, err = listQuery.paginate(query, userListSpec)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := query.Find(&users).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to list users: %v", err)
 	}
 
@@ -185,6 +251,12 @@ func (s *UserService) DeleteUser(id uint) error {
 		return fmt.Errorf("failed to delete user sessions: %v", err)
 	}
 
+	// delete user settings
+	if err := tx.Where("user_id = ?", id).Delete(&UserSettings{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete user settings: %v", err)
+	}
+
 	// delete user related login logs (optional, depending on whether to keep)
 	// if err := tx.Where("user_id = ?", id).Delete(&UserLoginLog{}).Error; err != nil {
 	// 	tx.Rollback()
@@ -202,11 +274,12 @@ func (s *UserService) DeleteUser(id uint) error {
 		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
+	invalidateUserLookups(id)
 	return nil
 }
 
-// CreateSession create user session
-func (s *UserService) CreateSession(userID uint) (*UserSession, error) {
+// CreateSession create user session for the client at ip
+func (s *UserService) CreateSession(userID uint, ip, userAgent string) (*UserSession, error) {
 	// generate random token
 	token, err := generateToken()
 	if err != nil {
@@ -214,11 +287,17 @@ func (s *UserService) CreateSession(userID uint) (*UserSession, error) {
 	}
 
 	// create session, valid for 24 hours
+	now := time.Now()
+	userAgent, _ = textlimit.TruncateBytes(userAgent, 500)
 	session := &UserSession{
-		UserID:    userID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+		UserID:       userID,
+		Token:        token,
+		ExpiresAt:    now.Add(24 * time.Hour),
+		IP:           ip,
+		UserAgent:    userAgent,
+		LastActiveAt: &now,
 	}
+	bindSession(session, ip, userAgent)
 
 	if err := DB.Create(session).Error; err != nil {
 		return nil, fmt.Errorf("failed to create session: %v", err)
@@ -230,9 +309,9 @@ func (s *UserService) CreateSession(userID uint) (*UserSession, error) {
 // GetSessionByToken get session by token
 func (s *UserService) GetSessionByToken(token string) (*UserSession, error) {
 	var session UserSession
-	if err := DB.Preload("User").Where("token = ?", token).First(&session).Error; err != nil {
+	if err := DB.Preload("User").Preload("Impersonator").Where("token = ?", token).First(&session).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("session not found")
+			return nil, ErrSessionNotFound
 		}
 		return nil, fmt.Errorf("database error: %v", err)
 	}
@@ -254,22 +333,102 @@ func (s *UserService) DeleteSession(token string) error {
 	return nil
 }
 
+// TouchSession record that the session was just used, at most once per sessionTouchInterval
+func (s *UserService) TouchSession(session *UserSession, ip string) {
+	now := time.Now()
+	if session.LastActiveAt != nil && now.Sub(*session.LastActiveAt) < sessionTouchInterval && session.IP == ip {
+		return
+	}
+
+	updates := map[string]interface{}{"last_active_at": now}
+	if ip != "" {
+		updates["ip"] = ip
+	}
+	if err := DB.Model(&UserSession{}).Where("id = ?", session.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to touch session %d: %v", session.ID, err)
+		return
+	}
+	session.LastActiveAt = &now
+	if ip != "" {
+		session.IP = ip
+	}
+}
+
+// ListActiveSessions get the unexpired sessions of a user, most recently used first
+func (s *UserService) ListActiveSessions(userID uint) ([]*UserSession, error) {
+	var sessions []*UserSession
+	err := DB.Preload("Impersonator").
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_active_at DESC, created_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession delete one session of a user
+func (s *UserService) RevokeSession(userID, sessionID uint) error {
+	result := DB.Where("id = ? AND user_id = ?", sessionID, userID).Delete(&UserSession{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions delete every session of a user except the one with keepToken,
+// returning how many were revoked
+func (s *UserService) RevokeOtherSessions(userID uint, keepToken string) (int64, error) {
+	result := DB.Where("user_id = ? AND token <> ?", userID, keepToken).Delete(&UserSession{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RevokeAllSessions delete every session of a user, logging them out everywhere
+func (s *UserService) RevokeAllSessions(userID uint) (int64, error) {
+	result := DB.Where("user_id = ?", userID).Delete(&UserSession{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // CleanExpiredSessions clean expired sessions
 func (s *UserService) CleanExpiredSessions() error {
 	if err := DB.Where("expires_at < ?", time.Now()).Delete(&UserSession{}).Error; err != nil {
 		return fmt.Errorf("failed to clean expired sessions: %v", err)
 	}
+	if err := DB.Where("expires_at < ?", time.Now()).Delete(&LoginChallenge{}).Error; err != nil {
+		return fmt.Errorf("failed to clean expired login challenges: %v", err)
+	}
 	return nil
 }
 
 // LogUserLogin log user login
 func (s *UserService) LogUserLogin(userID uint, ip, userAgent string, success bool, message string) error {
+	return s.LogLogin(userID, &LoginContext{IP: ip, UserAgent: userAgent}, success, message, nil)
+}
+
+// LogLogin log a login with its location and the anomalies found, anomaly may be nil
+func (s *UserService) LogLogin(userID uint, login *LoginContext, success bool, message string, anomaly *LoginAnomaly) error {
+	userAgent, _ := textlimit.TruncateBytes(login.UserAgent, 500)
 	log := &UserLoginLog{
 		UserID:    userID,
-		IP:        ip,
+		IP:        login.IP,
 		UserAgent: userAgent,
 		Success:   success,
 		Message:   message,
+		Country:   login.Country,
+		Latitude:  login.Latitude,
+		Longitude: login.Longitude,
+	}
+	if anomaly != nil {
+		log.Anomalies = anomaly.String()
 	}
 
 	if err := DB.Create(log).Error; err != nil {
@@ -279,22 +438,93 @@ func (s *UserService) LogUserLogin(userID uint, ip, userAgent string, success bo
 	return nil
 }
 
-// GetUserLoginLogs get user login logs
-func (s *UserService) GetUserLoginLogs(userID uint, page, pageSize int) ([]*UserLoginLog, int64, error) {
+// MaxLoginLogExport most login logs an export returns, newest first
+const MaxLoginLogExport = 10000
+
+// LoginLogFilter restricts the login logs of a user
+type LoginLogFilter struct {
+	From    *time.Time
+	To      *time.Time
+	Success *bool  // only successful or only failed logins
+	IP      string // part of the client IP
+}
+
+// ParseLoginLogFilter build a login log filter from URL query parameters: from and to
+// (RFC 3339 or YYYY-MM-DD, to is exclusive), result (success or failure) and ip
+func ParseLoginLogFilter(values url.Values) (*LoginLogFilter, error) {
+	filter := &LoginLogFilter{
+		IP: strings.TrimSpace(values.Get("ip")),
+	}
+
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := parseListTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be RFC 3339 or YYYY-MM-DD", ErrInvalidListQuery, name)
+		}
+		*target = &t
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidListQuery)
+	}
+
+	switch result := strings.ToLower(strings.TrimSpace(values.Get("result"))); result {
+	case "":
+	case "success", "failure":
+		success := result == "success"
+		filter.Success = &success
+	default:
+		return nil, fmt.Errorf("%w: result must be success or failure", ErrInvalidListQuery)
+	}
+
+	return filter, nil
+}
+
+// apply add the filter conditions to a user_login_logs query
+func (f *LoginLogFilter) apply(db *gorm.DB) *gorm.DB {
+	if f == nil {
+		return db
+	}
+
+	if f.From != nil {
+		db = db.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("created_at < ?", *f.To)
+	}
+	if f.Success != nil {
+		db = db.Where("success = ?", *f.Success)
+	}
+	if f.IP != "" {
+		db = db.Where("ip LIKE ?", "%"+f.IP+"%")
+	}
+	return db
+}
+
+// GetUserLoginLogs get user login logs matching filter, newest first, filter may be nil
+func (s *UserService) GetUserLoginLogs(userID uint, filter *LoginLogFilter, page, pageSize int) ([]*UserLoginLog, int64, error) {
 	var logs []*UserLoginLog
 	var total int64
 
-	query := DB.Model(&UserLoginLog{}).Where("user_id = ?", userID)
+	err := withReadReplica(func(db *gorm.DB) error {
+		logs, total = nil, 0
+		query := filter.apply(db.Model(&UserLoginLog{}).Where("user_id = ?", userID))
 
-	// get total
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count login logs: %v", err)
-	}
+		if err := query.Count(&total).Error; err != nil {
+			return fmt.Errorf("failed to count login logs: %v", err)
+		}
 
-	// paginated query
-	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&logs).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to list login logs: %v", err)
+		offset := (page - 1) * pageSize
+		if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&logs).Error; err != nil {
+			return fmt.Errorf("failed to list login logs: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
 	return logs, total, nil
@@ -302,9 +532,14 @@ func (s *UserService) GetUserLoginLogs(userID uint, page, pageSize int) ([]*User
 
 // UpdateUserStatus update user status
 func (s *UserService) UpdateUserStatus(userID uint, status UserStatus) error {
-	if err := DB.Model(&User{}).Where("id = ?", userID).Update("status", status).Error; err != nil {
+	err := DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"status":  status,
+		"version": bumpVersion(),
+	}).Error
+	if err != nil {
 		return fmt.Errorf("failed to update user status: %v", err)
 	}
+	invalidateUserLookups(userID)
 	return nil
 }
 
@@ -328,9 +563,9 @@ func (s *UserService) CreateDefaultAdmin() error {
 
 	// create default admin
 	admin := &User{
-		Username: "admin",
+		Username: defaultAdminUsername,
 		Email:    "admin@agent-connector.com",
-		Password: "admin123",
+		Password: defaultAdminPassword,
 		FullName: "System Admin",
 		Role:     UserRoleAdmin,
 		Status:   UserStatusActive,
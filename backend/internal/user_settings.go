@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidUserSettings the settings are rejected by validation
+var ErrInvalidUserSettings = errors.New("invalid user settings")
+
+// localePattern BCP 47 style language tag, e.g. "en", "zh-CN" or "de-AT"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// UserSettings preferences of a user, the dataflow API falls back to them for fields
+// a request of the user leaves out
+type UserSettings struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	UserID         uint   `json:"user_id" gorm:"uniqueIndex;not null"`
+	DefaultAgentID string `json:"default_agent_id" gorm:"size:100"`
+	DefaultModel   string `json:"default_model" gorm:"size:100"`
+	Locale         string `json:"locale" gorm:"size:35"`
+
+	// Notification opt-ins
+	EmailSecurityNotices bool `json:"email_security_notices" gorm:"not null;default:true"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specify table name
+func (UserSettings) TableName() string {
+	return "user_settings"
+}
+
+// defaultUserSettings settings of a user who never saved any
+func defaultUserSettings(userID uint) *UserSettings {
+	return &UserSettings{UserID: userID, EmailSecurityNotices: true}
+}
+
+// GetUserSettings get the settings of a user, the defaults when none were saved
+func (s *UserService) GetUserSettings(userID uint) (*UserSettings, error) {
+	var settings UserSettings
+	if err := DB.Where("user_id = ?", userID).First(&settings).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return defaultUserSettings(userID), nil
+		}
+		return nil, fmt.Errorf("failed to get user settings: %v", err)
+	}
+	return &settings, nil
+}
+
+// GetUserSettingsByUsername get the settings of an active user by username, nil when
+// there is no such user
+func (s *UserService) GetUserSettingsByUsername(username string) (*UserSettings, error) {
+	if username == "" {
+		return nil, nil
+	}
+
+	var user User
+	err := DB.Select("id").Where("username = ? AND status = ?", username, UserStatusActive).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return s.GetUserSettings(user.ID)
+}
+
+// SaveUserSettings validate and store the settings of a user
+func (s *UserService) SaveUserSettings(settings *UserSettings) error {
+	settings.DefaultAgentID = strings.TrimSpace(settings.DefaultAgentID)
+	settings.DefaultModel = strings.TrimSpace(settings.DefaultModel)
+	settings.Locale = strings.TrimSpace(settings.Locale)
+
+	if settings.Locale != "" && !localePattern.MatchString(settings.Locale) {
+		return fmt.Errorf("%w: invalid locale %q", ErrInvalidUserSettings, settings.Locale)
+	}
+	if settings.DefaultAgentID != "" {
+		var count int64
+		if err := DB.Model(&Agent{}).Where("agent_id = ?", settings.DefaultAgentID).Count(&count).Error; err != nil {
+			return fmt.Errorf("database error: %v", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: default agent %s not found", ErrInvalidUserSettings, settings.DefaultAgentID)
+		}
+	}
+
+	if settings.ID == 0 {
+		if err := DB.Create(settings).Error; err != nil {
+			return fmt.Errorf("failed to save user settings: %v", err)
+		}
+		// Create skips false values and leaves the column default of true in place
+		if settings.EmailSecurityNotices {
+			invalidateUserLookups(settings.UserID)
+			return nil
+		}
+	}
+	if err := DB.Select("*").Save(settings).Error; err != nil {
+		return fmt.Errorf("failed to save user settings: %v", err)
+	}
+	invalidateUserLookups(settings.UserID)
+	return nil
+}
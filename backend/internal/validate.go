@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"agent-connector/config"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// validationTimeout bounds each connectivity check
+const validationTimeout = 5 * time.Second
+
+// Validation check results
+const (
+	ValidationPassed  = "passed"
+	ValidationWarning = "warning"
+	ValidationFailed  = "failed"
+	ValidationSkipped = "skipped"
+)
+
+// ValidationCheck result of one deployment check
+type ValidationCheck struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`
+	Message    string   `json:"message,omitempty"`
+	Details    []string `json:"details,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// ValidationReport result of validating a service deployment, Valid is false when
+// any check failed; warnings do not fail the report
+type ValidationReport struct {
+	Service     string             `json:"service"`
+	Environment string             `json:"environment,omitempty"`
+	Valid       bool               `json:"valid"`
+	Checks      []*ValidationCheck `json:"checks"`
+	CheckedAt   time.Time          `json:"checked_at"`
+}
+
+// ExitCode process exit code for the report, 1 when a check failed
+func (r *ValidationReport) ExitCode() int {
+	if r.Valid {
+		return 0
+	}
+	return 1
+}
+
+// Write the report as indented JSON
+func (r *ValidationReport) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// add record a check and mark the report invalid when it failed
+func (r *ValidationReport) add(check *ValidationCheck) {
+	r.Checks = append(r.Checks, check)
+	if check.Status == ValidationFailed {
+		r.Valid = false
+	}
+}
+
+// ValidateDeployment load the configuration and check what the service needs to
+// start: database and Redis connectivity, the JWT secret and the stored agents.
+// Nothing is migrated or written.
+func ValidateDeployment(ctx context.Context, service string) *ValidationReport {
+	report := &ValidationReport{Service: service, Valid: true, CheckedAt: time.Now()}
+
+	started := time.Now()
+	cfg, err := config.Load()
+	if err != nil {
+		report.add(&ValidationCheck{Name: "config", Status: ValidationFailed, Message: err.Error(), DurationMs: since(started)})
+		for _, name := range []string{"jwt_secret", "database", "redis", "agents"} {
+			report.add(&ValidationCheck{Name: name, Status: ValidationSkipped, Message: "configuration could not be loaded"})
+		}
+		return report
+	}
+	report.Environment = cfg.App.Environment
+	report.add(&ValidationCheck{Name: "config", Status: ValidationPassed, DurationMs: since(started)})
+
+	report.add(checkJWTSecret(cfg))
+
+	database := checkDatabase(ctx, cfg)
+	report.add(database)
+	report.add(checkRedis(ctx, cfg))
+
+	if database.Status == ValidationFailed {
+		report.add(&ValidationCheck{Name: "agents", Status: ValidationSkipped, Message: "database is not reachable"})
+	} else {
+		report.add(checkAgents(ctx))
+	}
+
+	return report
+}
+
+// checkJWTSecret the JWT secret must be changed from the default and long enough in
+// production, elsewhere a weak secret is only a warning
+func checkJWTSecret(cfg *config.Config) *ValidationCheck {
+	check := &ValidationCheck{Name: "jwt_secret", Status: ValidationPassed}
+
+	secret := cfg.Security.JWTSecret
+	var problems []string
+	if secret == "" || secret == config.DefaultJWTSecret {
+		problems = append(problems, "JWT secret is not set, the default placeholder is in use")
+	} else if len(secret) < config.MinProductionJWTSecretLength {
+		problems = append(problems, fmt.Sprintf("JWT secret is %d characters, at least %d are required", len(secret), config.MinProductionJWTSecretLength))
+	}
+	if len(problems) == 0 {
+		return check
+	}
+
+	check.Details = problems
+	if cfg.App.Environment == "production" {
+		check.Status = ValidationFailed
+		check.Message = "JWT secret is too weak for production"
+	} else {
+		check.Status = ValidationWarning
+		check.Message = "JWT secret would be rejected in production"
+	}
+	return check
+}
+
+// checkDatabase connect and ping the database; on success DB points to the connection
+// so the agent check can run
+func checkDatabase(ctx context.Context, cfg *config.Config) *ValidationCheck {
+	started := time.Now()
+	check := &ValidationCheck{Name: "database", Status: ValidationPassed}
+
+	db, err := gorm.Open(mysql.Open(cfg.GetDSN()), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err == nil {
+		var sqlDB *sql.DB
+		if sqlDB, err = db.DB(); err == nil {
+			pingCtx, cancel := context.WithTimeout(ctx, validationTimeout)
+			err = sqlDB.PingContext(pingCtx)
+			cancel()
+		}
+	}
+	check.DurationMs = since(started)
+	if err != nil {
+		check.Status = ValidationFailed
+		check.Message = fmt.Sprintf("cannot reach %s:%d/%s: %v", cfg.Database.Host, cfg.Database.Port, cfg.Database.Database, err)
+		return check
+	}
+
+	DB = db
+	return check
+}
+
+// checkRedis ping Redis
+func checkRedis(ctx context.Context, cfg *config.Config) *ValidationCheck {
+	started := time.Now()
+	check := &ValidationCheck{Name: "redis", Status: ValidationPassed}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer client.Close()
+
+	pingCtx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		check.Status = ValidationFailed
+		check.Message = fmt.Sprintf("cannot reach %s: %v", cfg.Redis.Addr, err)
+	}
+	check.DurationMs = since(started)
+	return check
+}
+
+// checkAgents run the agent validation on every stored agent
+func checkAgents(ctx context.Context) *ValidationCheck {
+	started := time.Now()
+	check := &ValidationCheck{Name: "agents", Status: ValidationPassed}
+
+	if !DB.WithContext(ctx).Migrator().HasTable(&Agent{}) {
+		check.Status = ValidationWarning
+		check.Message = "agents table does not exist yet, it is created on the first start"
+		check.DurationMs = since(started)
+		return check
+	}
+
+	var agents []*Agent
+	if err := DB.WithContext(ctx).Find(&agents).Error; err != nil {
+		check.Status = ValidationFailed
+		check.Message = fmt.Sprintf("failed to load agents: %v", err)
+		check.DurationMs = since(started)
+		return check
+	}
+
+	service := &AgentService{}
+	for _, agent := range agents {
+		if err := service.validateAgent(agent); err != nil {
+			check.Details = append(check.Details, fmt.Sprintf("%s: %v", agent.AgentID, err))
+		}
+	}
+	check.DurationMs = since(started)
+	if len(check.Details) > 0 {
+		check.Status = ValidationFailed
+		check.Message = fmt.Sprintf("%d of %d agents are invalid", len(check.Details), len(agents))
+	} else {
+		check.Message = fmt.Sprintf("%d agents are valid", len(agents))
+	}
+	return check
+}
+
+// since milliseconds elapsed since start
+func since(start time.Time) int64 {
+	return time.Since(start).Milliseconds()
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrVersionConflict the record was changed after the version an update is based on
+var ErrVersionConflict = errors.New("the record was changed by someone else, reload it and apply your changes again")
+
+// updateVersioned write every column of record, an agent, user or system config whose
+// Version holds the version the change is based on. The row is only written while it
+// still has that version, which is then incremented; ErrVersionConflict otherwise.
+func updateVersioned(tx *gorm.DB, record interface{}, version *int) error {
+	expected := *version
+	*version = expected + 1
+
+	result := tx.Model(record).Where("version = ?", expected).Select("*").Omit("created_at").Updates(record)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrVersionConflict
+	}
+	if result.Error != nil {
+		*version = expected
+	}
+	return result.Error
+}
+
+// bumpVersion update expression incrementing the version, for updates of single columns
+func bumpVersion() interface{} {
+	return gorm.Expr("version + 1")
+}
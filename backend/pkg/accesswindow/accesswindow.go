@@ -0,0 +1,254 @@
+// Package accesswindow parses weekly access schedules such as
+// "Mon-Fri 09:00-18:00; Sat 10:00-14:00" and answers whether a time falls into them.
+package accesswindow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minutesPerDay end of day, "24:00"
+const minutesPerDay = 24 * 60
+
+// dayNames weekday abbreviations in time.Weekday order
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// locations time zones already loaded, LoadLocation reads the zone database every time
+var locations sync.Map
+
+// Schedule weekly windows in a time zone; a nil schedule allows every time
+type Schedule struct {
+	spec     string
+	location *time.Location
+	windows  []window
+}
+
+// window a daily time range on some weekdays; a range ending before it starts runs
+// past midnight into the next day
+type window struct {
+	days       [7]bool
+	start, end int // minutes after midnight
+}
+
+// Parse read a schedule: windows separated by ";", each an optional list of days and a
+// time range, e.g. "Mon-Fri 09:00-18:00", "Sat,Sun 10:00-14:00", "22:00-06:00" (every
+// day, overnight) or "Mon 00:00-24:00". Times are in timezone, an IANA name, UTC when
+// empty. An empty spec returns nil.
+func Parse(spec, timezone string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	location, err := LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &Schedule{spec: spec, location: location}
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access window %q: %w", part, err)
+		}
+		schedule.windows = append(schedule.windows, w)
+	}
+	if len(schedule.windows) == 0 {
+		return nil, fmt.Errorf("access schedule %q has no windows", spec)
+	}
+	return schedule, nil
+}
+
+// Allows report whether t falls into one of the windows
+func (s *Schedule) Allows(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	local := t.In(s.location)
+	day := local.Weekday()
+	previous := (day + 6) % 7
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[day] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// overnight: the evening of a listed day or the morning after it
+		if (w.days[day] && minute >= w.start) || (w.days[previous] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextAllowed the earliest time from t on that falls into a window, t itself when it
+// does; zero for a nil schedule
+func (s *Schedule) NextAllowed(t time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	if s.Allows(t) {
+		return t
+	}
+
+	local := t.In(s.location)
+	var next time.Time
+	for offset := 0; offset <= 7; offset++ {
+		date := local.AddDate(0, 0, offset)
+		for _, w := range s.windows {
+			if !w.days[date.Weekday()] {
+				continue
+			}
+			opens := time.Date(date.Year(), date.Month(), date.Day(), w.start/60, w.start%60, 0, 0, s.location)
+			if opens.After(t) && (next.IsZero() || opens.Before(next)) {
+				next = opens
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
+
+// Location the time zone of the windows
+func (s *Schedule) Location() *time.Location {
+	return s.location
+}
+
+// String the schedule as it was written
+func (s *Schedule) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.spec
+}
+
+// parseWindow read "<days> <start>-<end>" or "<start>-<end>"
+func parseWindow(text string) (window, error) {
+	var w window
+	fields := strings.Fields(text)
+	var times string
+	switch len(fields) {
+	case 1:
+		times = fields[0]
+		for day := range w.days {
+			w.days[day] = true
+		}
+	case 2:
+		if err := parseDays(fields[0], &w.days); err != nil {
+			return w, err
+		}
+		times = fields[1]
+	default:
+		return w, fmt.Errorf("expected days and a time range, e.g. Mon-Fri 09:00-18:00")
+	}
+
+	startText, endText, ok := strings.Cut(times, "-")
+	if !ok {
+		return w, fmt.Errorf("time range %q must be written start-end, e.g. 09:00-18:00", times)
+	}
+	var err error
+	if w.start, err = parseClock(startText); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(endText); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("time range %q is empty", times)
+	}
+	if w.start == minutesPerDay {
+		return w, fmt.Errorf("time range %q cannot start at 24:00", times)
+	}
+	if w.end == minutesPerDay {
+		// until midnight, the same as an overnight range ending at 00:00
+		w.end = 0
+	}
+	return w, nil
+}
+
+// parseDays read a comma separated list of days and day ranges, e.g. "Mon-Fri,Sun";
+// a range may wrap around the week, e.g. "Fri-Mon"
+func parseDays(text string, days *[7]bool) error {
+	for _, item := range strings.Split(text, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "daily" || item == "*" {
+			for day := range days {
+				days[day] = true
+			}
+			continue
+		}
+
+		firstText, lastText, isRange := strings.Cut(item, "-")
+		first, err := parseDay(firstText)
+		if err != nil {
+			return err
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(lastText); err != nil {
+				return err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseDay read a day name, its first three letters are enough
+func parseDay(text string) (int, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if len(text) >= 3 {
+		for day, name := range dayNames {
+			if strings.HasPrefix(text, name) {
+				return day, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q, use Mon, Tue, Wed, Thu, Fri, Sat or Sun", text)
+}
+
+// parseClock read HH:MM, 24:00 being the end of the day
+func parseClock(text string) (int, error) {
+	hourText, minuteText, ok := strings.Cut(strings.TrimSpace(text), ":")
+	hour, hourErr := strconv.Atoi(hourText)
+	minute, minuteErr := strconv.Atoi(minuteText)
+	if !ok || hourErr != nil || minuteErr != nil || hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", text)
+	}
+	return hour*60 + minute, nil
+}
+
+// LoadLocation load an IANA time zone once, UTC for an empty name
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	locations.Store(name, location)
+	return location, nil
+}
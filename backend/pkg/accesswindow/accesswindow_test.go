@@ -0,0 +1,132 @@
+package accesswindow
+
+import (
+	"testing"
+	"time"
+)
+
+// monday a Monday, the times below are offsets from its midnight
+var monday = time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+
+func at(day int, hour, minute int) time.Time {
+	return monday.AddDate(0, 0, day).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func TestParse_Empty(t *testing.T) {
+	schedule, err := Parse("  ", "Europe/Berlin")
+	if err != nil || schedule != nil {
+		t.Fatalf("Expected no schedule for an empty spec, got %v, %v", schedule, err)
+	}
+	if !schedule.Allows(monday) {
+		t.Error("Expected a nil schedule to allow every time")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		timezone string
+	}{
+		{name: "Unknown day", spec: "Mon-Fry 09:00-18:00"},
+		{name: "Missing range", spec: "Mon 09:00"},
+		{name: "Bad time", spec: "Mon 9-18"},
+		{name: "Hour out of range", spec: "Mon 09:00-25:00"},
+		{name: "Minute out of range", spec: "Mon 09:60-18:00"},
+		{name: "Empty range", spec: "Mon 09:00-09:00"},
+		{name: "Starts at midnight end", spec: "Mon 24:00-06:00"},
+		{name: "Too many fields", spec: "Mon Tue 09:00-18:00"},
+		{name: "Only separators", spec: ";;"},
+		{name: "Unknown time zone", spec: "Mon 09:00-18:00", timezone: "Mars/Olympus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.spec, tt.timezone); err == nil {
+				t.Errorf("Expected an error for %q in %q", tt.spec, tt.timezone)
+			}
+		})
+	}
+}
+
+func TestSchedule_Allows(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{name: "Business hours", spec: "Mon-Fri 09:00-18:00", at: at(2, 12, 0), want: true},
+		{name: "Start included", spec: "Mon-Fri 09:00-18:00", at: at(0, 9, 0), want: true},
+		{name: "End excluded", spec: "Mon-Fri 09:00-18:00", at: at(0, 18, 0), want: false},
+		{name: "Weekend", spec: "Mon-Fri 09:00-18:00", at: at(5, 12, 0), want: false},
+		{name: "Second window", spec: "Mon-Fri 09:00-18:00; Sat 10:00-14:00", at: at(5, 11, 0), want: true},
+		{name: "Day list", spec: "Mon,Wed 09:00-18:00", at: at(1, 12, 0), want: false},
+		{name: "Wrapping days", spec: "Fri-Mon 09:00-18:00", at: at(6, 12, 0), want: true},
+		{name: "Every day", spec: "08:00-20:00", at: at(6, 8, 30), want: true},
+		{name: "Daily keyword", spec: "daily 08:00-20:00", at: at(3, 7, 59), want: false},
+		{name: "Overnight evening", spec: "Fri 22:00-06:00", at: at(4, 23, 0), want: true},
+		{name: "Overnight next morning", spec: "Fri 22:00-06:00", at: at(5, 5, 59), want: true},
+		{name: "Overnight other morning", spec: "Fri 22:00-06:00", at: at(4, 5, 0), want: false},
+		{name: "Until midnight", spec: "Mon 18:00-24:00", at: at(0, 23, 59), want: true},
+		{name: "Not past midnight", spec: "Mon 18:00-24:00", at: at(1, 0, 0), want: false},
+		{name: "Full names", spec: "monday-tuesday 00:00-24:00", at: at(1, 12, 0), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec, "")
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.spec, err)
+			}
+			if got := schedule.Allows(tt.at); got != tt.want {
+				t.Errorf("Allows(%s) for %q = %v, want %v", tt.at.Format(time.RFC1123), tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_TimeZone(t *testing.T) {
+	schedule, err := Parse("Mon-Fri 09:00-18:00", "Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// 01:00 UTC is 10:00 in Tokyo
+	if !schedule.Allows(at(0, 1, 0)) {
+		t.Error("Expected 10:00 Tokyo time to be allowed")
+	}
+	// Friday 12:00 UTC is Friday 21:00 in Tokyo
+	if schedule.Allows(at(4, 12, 0)) {
+		t.Error("Expected 21:00 Tokyo time to be refused")
+	}
+}
+
+func TestSchedule_NextAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		at   time.Time
+		want time.Time
+	}{
+		{name: "Inside window", spec: "Mon-Fri 09:00-18:00", at: at(0, 10, 0), want: at(0, 10, 0)},
+		{name: "Later today", spec: "Mon-Fri 09:00-18:00", at: at(0, 7, 30), want: at(0, 9, 0)},
+		{name: "Tomorrow", spec: "Mon-Fri 09:00-18:00", at: at(0, 19, 0), want: at(1, 9, 0)},
+		{name: "After the weekend", spec: "Mon-Fri 09:00-18:00", at: at(4, 19, 0), want: at(7, 9, 0)},
+		{name: "Nearest window", spec: "Mon 09:00-10:00; Sat 10:00-14:00", at: at(4, 19, 0), want: at(5, 10, 0)},
+		{name: "Same day next week", spec: "Mon 09:00-10:00", at: at(0, 11, 0), want: at(7, 9, 0)},
+		{name: "Overnight", spec: "Fri 22:00-06:00", at: at(5, 7, 0), want: at(11, 22, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec, "")
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.spec, err)
+			}
+			if got := schedule.NextAllowed(tt.at); !got.Equal(tt.want) {
+				t.Errorf("NextAllowed(%s) for %q = %s, want %s", tt.at.Format(time.RFC1123), tt.spec, got.Format(time.RFC1123), tt.want.Format(time.RFC1123))
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Package acl decides who may call an agent: lists of allowed users, user groups and
+// API key prefixes. A request passes when it matches any entry; an empty list lets
+// every request through.
+package acl
+
+import (
+	"slices"
+	"strings"
+)
+
+// List allowed callers of an agent
+type List struct {
+	Users []string `json:"users"` // platform usernames
+	Roles []string `json:"roles"` // user groups, the platform roles
+	Keys  []string `json:"keys"`  // prefixes of connector keys or playground tokens
+}
+
+// Caller who makes a request, empty fields match nothing
+type Caller struct {
+	User      string
+	Role      string
+	KeyPrefix string
+}
+
+// Empty whether the list restricts nothing
+func (l List) Empty() bool {
+	return len(l.Users) == 0 && len(l.Roles) == 0 && len(l.Keys) == 0
+}
+
+// Allows whether the caller matches an entry of the list, always true for an empty list
+func (l List) Allows(caller Caller) bool {
+	if l.Empty() {
+		return true
+	}
+	if caller.User != "" && slices.Contains(l.Users, caller.User) {
+		return true
+	}
+	if caller.Role != "" && slices.Contains(l.Roles, strings.ToLower(caller.Role)) {
+		return true
+	}
+	return caller.KeyPrefix != "" && slices.Contains(l.Keys, caller.KeyPrefix)
+}
+
+// Split the entries of a comma separated value, trimmed and without duplicates
+func Split(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" && !slices.Contains(entries, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Join the entries as a comma separated value, trimmed and without duplicates
+func Join(entries []string) string {
+	return strings.Join(Split(strings.Join(entries, ",")), ",")
+}
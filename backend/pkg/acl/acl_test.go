@@ -0,0 +1,48 @@
+package acl
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestList_Allows(t *testing.T) {
+	list := List{
+		Users: []string{"alice"},
+		Roles: []string{"operator"},
+		Keys:  []string{"sk-conn_ab12cd34"},
+	}
+	tests := []struct {
+		name   string
+		caller Caller
+		want   bool
+	}{
+		{"listed user", Caller{User: "alice", Role: "user"}, true},
+		{"listed role", Caller{User: "bob", Role: "operator"}, true},
+		{"role in other case", Caller{User: "bob", Role: "Operator"}, true},
+		{"listed key", Caller{KeyPrefix: "sk-conn_ab12cd34"}, true},
+		{"unlisted user", Caller{User: "bob", Role: "user", KeyPrefix: "sk-conn_ffffffff"}, false},
+		{"usernames are case sensitive", Caller{User: "Alice"}, false},
+		{"anonymous", Caller{}, false},
+	}
+	for _, tt := range tests {
+		if got := list.Allows(tt.caller); got != tt.want {
+			t.Errorf("%s: Allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !(List{}).Allows(Caller{}) {
+		t.Error("Expected an empty list to allow every caller")
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	if got := Split(" alice, bob,,alice ,"); !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Errorf("Split = %q", got)
+	}
+	if got := Split(""); got != nil {
+		t.Errorf("Expected no entries of an empty value, got %q", got)
+	}
+	if got := Join([]string{"bob ", "alice", "bob", ""}); got != "bob,alice" {
+		t.Errorf("Join = %q", got)
+	}
+}
@@ -0,0 +1,405 @@
+// Package agenttest is a conformance suite for agent.Agent implementations. An
+// adapter runs it from its own tests by passing a constructor that builds the agent
+// against a fake upstream behaving as asked:
+//
+//	func TestConformance(t *testing.T) {
+//		agenttest.Run(t, func(t *testing.T, upstream agenttest.Upstream) agent.Agent {
+//			server := newFakeServer(t, upstream) // answers agenttest.Reply, fails or is closed
+//			return newMyAgent(server.URL)
+//		})
+//	}
+package agenttest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"agent-connector/pkg/agent"
+)
+
+// Upstream how the fake upstream of the agent under test behaves
+type Upstream int
+
+const (
+	// UpstreamHealthy answers every chat with Reply, streamed in at least two chunks,
+	// and passes the health check of the agent
+	UpstreamHealthy Upstream = iota
+
+	// UpstreamFailing answers every request with a 5xx status and the error body of
+	// its protocol
+	UpstreamFailing
+
+	// UpstreamUnreachable cannot be connected to, e.g. a closed server
+	UpstreamUnreachable
+)
+
+// String name of the upstream behaviour
+func (u Upstream) String() string {
+	switch u {
+	case UpstreamHealthy:
+		return "healthy"
+	case UpstreamFailing:
+		return "failing"
+	case UpstreamUnreachable:
+		return "unreachable"
+	default:
+		return "unknown"
+	}
+}
+
+// Reply the answer of a healthy upstream
+const Reply = "conformance reply"
+
+// Timeout longest wait for a stream to finish or close
+const Timeout = 10 * time.Second
+
+// NewAgent builds the agent under test against an upstream behaving as upstream;
+// the fake upstream is cleaned up with t.Cleanup
+type NewAgent func(t *testing.T, upstream Upstream) agent.Agent
+
+// Run runs the conformance suite as subtests of t
+func Run(t *testing.T, newAgent NewAgent) {
+	// build creates the agent and closes it once the subtest ends
+	build := func(t *testing.T, upstream Upstream) agent.Agent {
+		t.Helper()
+		a := newAgent(t, upstream)
+		if a == nil {
+			t.Fatalf("NewAgent(%s) returned nil", upstream)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+
+	t.Run("Identity", func(t *testing.T) { testIdentity(t, build(t, UpstreamHealthy)) })
+	t.Run("Chat", func(t *testing.T) { testChat(t, build(t, UpstreamHealthy)) })
+	t.Run("ChatCancelledContext", func(t *testing.T) { testChatCancelledContext(t, build(t, UpstreamHealthy)) })
+	t.Run("ChatStream", func(t *testing.T) { testChatStream(t, build(t, UpstreamHealthy)) })
+	t.Run("ChatStreamCancel", func(t *testing.T) { testChatStreamCancel(t, build(t, UpstreamHealthy)) })
+	t.Run("UpstreamError", func(t *testing.T) { testUpstreamError(t, build(t, UpstreamFailing)) })
+	t.Run("Unreachable", func(t *testing.T) { testUnreachable(t, build(t, UpstreamUnreachable)) })
+	t.Run("StatusHealthy", func(t *testing.T) { testStatusHealthy(t, build(t, UpstreamHealthy)) })
+	t.Run("StatusUnhealthy", func(t *testing.T) {
+		testStatusUnhealthy(t, build(t, UpstreamFailing))
+		testStatusUnhealthy(t, build(t, UpstreamUnreachable))
+	})
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, build(t, UpstreamHealthy)) })
+	t.Run("Close", func(t *testing.T) { testClose(t, newAgent(t, UpstreamHealthy)) })
+}
+
+// request the chat request of the suite
+func request() *agent.ChatRequest {
+	return &agent.ChatRequest{
+		Messages: []agent.Message{{Role: "user", Content: "conformance check"}},
+		UserID:   "agenttest",
+	}
+}
+
+// testIdentity the agent describes itself and accepts its own configuration
+func testIdentity(t *testing.T, a agent.Agent) {
+	if a.GetID() == "" {
+		t.Error("GetID() is empty")
+	}
+	if a.GetName() == "" {
+		t.Error("GetName() is empty")
+	}
+	if a.GetType() == "" {
+		t.Error("GetType() is empty")
+	}
+	if !a.GetCapabilities().SupportsChatCompletion {
+		t.Error("GetCapabilities().SupportsChatCompletion = false")
+	}
+	if err := a.ValidateConfig(); err != nil {
+		t.Errorf("ValidateConfig() error = %v", err)
+	}
+}
+
+// testChat a blocking chat returns the upstream answer as one assistant choice
+func testChat(t *testing.T, a agent.Agent) {
+	resp, err := a.Chat(context.Background(), request())
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if resp == nil {
+		t.Fatal("Chat() returned a nil response without an error")
+	}
+	if resp.Error != nil {
+		t.Errorf("Chat() response carries an error: %v", resp.Error)
+	}
+	if len(resp.Choices) == 0 {
+		t.Fatal("Chat() response has no choices")
+	}
+	message := resp.Choices[0].Message
+	if message.Role != "assistant" {
+		t.Errorf("Chat() role = %q, want assistant", message.Role)
+	}
+	if message.Content != Reply {
+		t.Errorf("Chat() content = %q, want %q", message.Content, Reply)
+	}
+}
+
+// testChatCancelledContext a chat with a cancelled context fails instead of answering
+func testChatCancelledContext(t *testing.T, a agent.Agent) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp, err := a.Chat(ctx, request())
+	if err == nil {
+		t.Fatalf("Chat() with a cancelled context = %+v, want an error", resp)
+	}
+	if resp != nil {
+		t.Error("Chat() returned a response together with an error")
+	}
+}
+
+// streamResult what a stream delivered until both of its channels were closed
+type streamResult struct {
+	content  strings.Builder
+	events   int
+	finished bool
+	err      error
+	timedOut bool
+}
+
+// drain read the events and then the errors of a stream until both are closed
+func drain(stream *agent.ChatStreamResponse) *streamResult {
+	result := &streamResult{}
+	deadline := time.NewTimer(Timeout)
+	defer deadline.Stop()
+
+	for events := stream.Events; events != nil; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			result.events++
+			if event.Delta != nil {
+				result.content.WriteString(event.Delta.Content)
+			}
+			if event.FinishReason != nil {
+				result.finished = true
+			}
+		case <-deadline.C:
+			result.timedOut = true
+			return result
+		}
+	}
+	for errs := stream.Errors; errs != nil; {
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if result.err == nil {
+				result.err = err
+			}
+		case <-deadline.C:
+			result.timedOut = true
+			return result
+		}
+	}
+	return result
+}
+
+// testChatStream a stream delivers the answer in content events, ends with a finish
+// reason and closes both channels
+func testChatStream(t *testing.T, a agent.Agent) {
+	if !a.GetCapabilities().SupportsStreaming {
+		t.Skip("agent does not support streaming")
+	}
+
+	stream, err := a.ChatStream(context.Background(), request())
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if stream == nil || stream.Events == nil || stream.Errors == nil {
+		t.Fatal("ChatStream() must return both an event and an error channel")
+	}
+
+	result := drain(stream)
+	if result.timedOut {
+		t.Fatalf("stream channels still open after %v", Timeout)
+	}
+	if result.err != nil {
+		t.Errorf("stream error = %v", result.err)
+	}
+	if got := result.content.String(); got != Reply {
+		t.Errorf("streamed content = %q, want %q", got, Reply)
+	}
+	if !result.finished {
+		t.Error("no stream event carried a finish reason")
+	}
+}
+
+// testChatStreamCancel cancelling the context ends the stream
+func testChatStreamCancel(t *testing.T, a agent.Agent) {
+	if !a.GetCapabilities().SupportsStreaming {
+		t.Skip("agent does not support streaming")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := a.ChatStream(ctx, request())
+	if err != nil {
+		cancel()
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	cancel()
+
+	if result := drain(stream); result.timedOut {
+		t.Fatalf("stream channels still open %v after the context was cancelled", Timeout)
+	}
+}
+
+// testUpstreamError errors answered by the upstream are reported as *agent.AgentError
+// with a message and the kind of a server error, never as a response
+func testUpstreamError(t *testing.T, a agent.Agent) {
+	resp, err := a.Chat(context.Background(), request())
+	if err == nil {
+		t.Fatalf("Chat() = %+v, want an error from a failing upstream", resp)
+	}
+	if resp != nil {
+		t.Error("Chat() returned a response together with an error")
+	}
+	var agentErr *agent.AgentError
+	if !errors.As(err, &agentErr) {
+		t.Fatalf("Chat() error = %T %v, want an *agent.AgentError", err, err)
+	}
+	if agentErr.Message == "" {
+		t.Error("AgentError has no message")
+	}
+	if !errors.Is(err, agent.ErrUpstreamUnavailable) || !agent.IsRetryable(err) {
+		t.Errorf("Chat() error kind = %v, want agent.ErrUpstreamUnavailable", agentErr.Kind)
+	}
+
+	if a.GetCapabilities().SupportsStreaming {
+		stream, err := a.ChatStream(context.Background(), request())
+		if err == nil {
+			drain(stream)
+			t.Fatal("ChatStream() opened a stream on a failing upstream, want the error up front")
+		}
+		if !errors.As(err, &agentErr) {
+			t.Errorf("ChatStream() error = %T %v, want an *agent.AgentError", err, err)
+		}
+	}
+}
+
+// testUnreachable transport failures are errors of kind ErrUpstreamUnavailable, but
+// not *agent.AgentError, which means the upstream answered
+func testUnreachable(t *testing.T, a agent.Agent) {
+	resp, err := a.Chat(context.Background(), request())
+	if err == nil {
+		t.Fatalf("Chat() = %+v, want an error from an unreachable upstream", resp)
+	}
+	if resp != nil {
+		t.Error("Chat() returned a response together with an error")
+	}
+	var agentErr *agent.AgentError
+	if errors.As(err, &agentErr) {
+		t.Errorf("Chat() error = %v is an *agent.AgentError, want a transport error", err)
+	}
+	if !errors.Is(err, agent.ErrUpstreamUnavailable) {
+		t.Errorf("Chat() error = %v, want it to wrap agent.ErrUpstreamUnavailable", err)
+	}
+}
+
+// testStatusHealthy a healthy agent reports itself healthy under its own ID, and the
+// status is a copy the caller may change
+func testStatusHealthy(t *testing.T, a agent.Agent) {
+	before := time.Now().Add(-time.Second)
+	status, err := a.GetStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if status == nil {
+		t.Fatal("GetStatus() returned nil without an error")
+	}
+	if status.AgentID != a.GetID() {
+		t.Errorf("status AgentID = %q, want %q", status.AgentID, a.GetID())
+	}
+	if !status.Health {
+		t.Errorf("status Health = false, Status = %q, want healthy", status.Status)
+	}
+	if status.LastChecked.Before(before) {
+		t.Errorf("status LastChecked = %v, want the time of this check", status.LastChecked)
+	}
+
+	status.AgentID = "changed by caller"
+	again, err := a.GetStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if again.AgentID != a.GetID() {
+		t.Error("GetStatus() returned the agent's own status instead of a copy")
+	}
+}
+
+// testStatusUnhealthy an agent whose upstream fails is reported unhealthy, either as
+// a status or as an error
+func testStatusUnhealthy(t *testing.T, a agent.Agent) {
+	status, err := a.GetStatus(context.Background())
+	if err != nil {
+		return
+	}
+	if status == nil {
+		t.Fatal("GetStatus() returned nil without an error")
+	}
+	if status.Health {
+		t.Errorf("status Health = true with a broken upstream, Status = %q", status.Status)
+	}
+}
+
+// testConcurrent chats and status checks may run at the same time, run with -race
+func testConcurrent(t *testing.T, a agent.Agent) {
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := a.Chat(context.Background(), request()); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := a.GetStatus(context.Background()); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent call error = %v", err)
+	}
+}
+
+// testClose closing is idempotent, afterwards requests fail and the agent is unhealthy
+func testClose(t *testing.T, a agent.Agent) {
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+
+	if resp, err := a.Chat(context.Background(), request()); err == nil {
+		t.Errorf("Chat() after Close() = %+v, want an error", resp)
+	}
+	if a.GetCapabilities().SupportsStreaming {
+		if stream, err := a.ChatStream(context.Background(), request()); err == nil {
+			drain(stream)
+			t.Error("ChatStream() after Close() opened a stream, want an error")
+		}
+	}
+	if status, err := a.GetStatus(context.Background()); err == nil && status != nil && status.Health {
+		t.Error("GetStatus() after Close() reports a healthy agent")
+	}
+}
@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Broadcast fans one streaming response out to several subscribers, such as the
+// client, a recorder and a moderation scanner, reading the upstream events once.
+// Subscribers attached before Start see every event, later ones see the events
+// from the moment they subscribe.
+type Broadcast struct {
+	source *ChatStreamResponse
+
+	mu          sync.Mutex
+	subscribers []*Subscription
+	started     bool
+	finished    bool
+	err         error
+}
+
+// Subscription one consumer of a broadcast, Events is closed when the stream ends
+// and Errors then yields the stream error, if any
+type Subscription struct {
+	Events <-chan StreamEvent
+	Errors <-chan error
+
+	events    chan StreamEvent
+	errors    chan error
+	lossy     bool
+	dropped   atomic.Int64
+	done      chan struct{}
+	closeOnce sync.Once
+	broadcast *Broadcast
+}
+
+// NewBroadcast wraps a stream response, nothing is read until Start
+func NewBroadcast(source *ChatStreamResponse) *Broadcast {
+	return &Broadcast{source: source}
+}
+
+// Subscribe attaches a consumer that receives every event. The broadcast waits
+// for it when its buffer is full, so a slow consumer slows down all others.
+func (b *Broadcast) Subscribe(buffer int) *Subscription {
+	return b.subscribe(buffer, false)
+}
+
+// SubscribeLossy attaches a consumer that never holds up the broadcast, events
+// that do not fit in its buffer are dropped and counted
+func (b *Broadcast) SubscribeLossy(buffer int) *Subscription {
+	return b.subscribe(buffer, true)
+}
+
+// Start begins reading the source stream in the background, further calls do nothing
+func (b *Broadcast) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.started {
+		return
+	}
+	b.started = true
+	go b.run()
+}
+
+// Close stops the upstream stream, subscribers then see the stream end
+func (b *Broadcast) Close() error {
+	if b.source.Stream == nil {
+		return nil
+	}
+	return b.source.Stream.Close()
+}
+
+// Subscribers number of attached subscribers
+func (b *Broadcast) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Close detaches the subscription, the broadcast carries on for the others and
+// the subscription's channels receive nothing further
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.broadcast.remove(s)
+	})
+}
+
+// Dropped number of events a lossy subscription missed because its buffer was full
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// subscribe registers a subscription, after the stream ended it only yields the final error
+func (b *Broadcast) subscribe(buffer int, lossy bool) *Subscription {
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &Subscription{
+		events:    make(chan StreamEvent, buffer),
+		errors:    make(chan error, 1),
+		lossy:     lossy,
+		done:      make(chan struct{}),
+		broadcast: b,
+	}
+	sub.Events, sub.Errors = sub.events, sub.errors
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.finished {
+		sub.finish(b.err)
+		return sub
+	}
+	b.subscribers = append(b.subscribers, sub)
+	return sub
+}
+
+// remove detaches a subscription
+func (b *Broadcast) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, candidate := range b.subscribers {
+		if candidate == sub {
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// run copies every source event to the subscribers and ends them with the source error
+func (b *Broadcast) run() {
+	if b.source.Events != nil {
+		for event := range b.source.Events {
+			b.mu.Lock()
+			subscribers := append([]*Subscription(nil), b.subscribers...)
+			b.mu.Unlock()
+
+			for _, sub := range subscribers {
+				sub.send(event)
+			}
+		}
+	}
+
+	var streamErr error
+	if b.source.Errors != nil {
+		for err := range b.source.Errors {
+			if streamErr == nil {
+				streamErr = err
+			}
+		}
+	}
+
+	b.mu.Lock()
+	b.finished = true
+	b.err = streamErr
+	subscribers := b.subscribers
+	b.subscribers = nil
+	b.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.finish(streamErr)
+	}
+}
+
+// send delivers an event unless the subscriber left or, when lossy, is full
+func (s *Subscription) send(event StreamEvent) {
+	if s.lossy {
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+		}
+		return
+	}
+
+	select {
+	case s.events <- event:
+	case <-s.done:
+	}
+}
+
+// finish closes the channels of the subscription after queuing the stream error
+func (s *Subscription) finish(err error) {
+	if err != nil {
+		s.errors <- err
+	}
+	close(s.events)
+	close(s.errors)
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// broadcastSource creates a stream response that yields count content events,
+// then err when it is not nil
+func broadcastSource(count int, err error) (*ChatStreamResponse, chan<- struct{}) {
+	events := make(chan StreamEvent)
+	errs := make(chan error, 1)
+	release := make(chan struct{})
+
+	go func() {
+		<-release
+		for i := 0; i < count; i++ {
+			events <- StreamEvent{Type: "content", Delta: &Delta{Content: "x"}}
+		}
+		if err != nil {
+			errs <- err
+		}
+		close(errs)
+		close(events)
+	}()
+
+	return &ChatStreamResponse{
+		Stream: io.NopCloser(strings.NewReader("")),
+		Events: events,
+		Errors: errs,
+	}, release
+}
+
+// consume counts the events of a subscription and returns its error
+func consume(sub *Subscription) (int, error) {
+	count := 0
+	for range sub.Events {
+		count++
+	}
+	var err error
+	for e := range sub.Errors {
+		err = e
+	}
+	return count, err
+}
+
+func TestBroadcast_FanOut(t *testing.T) {
+	upstreamErr := errors.New("upstream closed")
+
+	tests := []struct {
+		name        string
+		events      int
+		err         error
+		subscribers int
+	}{
+		{"single subscriber", 5, nil, 1},
+		{"three subscribers", 50, nil, 3},
+		{"error delivered to all", 10, upstreamErr, 3},
+		{"empty stream", 0, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, release := broadcastSource(tt.events, tt.err)
+			broadcast := NewBroadcast(source)
+
+			var subs []*Subscription
+			for i := 0; i < tt.subscribers; i++ {
+				subs = append(subs, broadcast.Subscribe(0))
+			}
+			broadcast.Start()
+			close(release)
+
+			var wg sync.WaitGroup
+			for i, sub := range subs {
+				wg.Add(1)
+				go func(i int, sub *Subscription) {
+					defer wg.Done()
+					count, err := consume(sub)
+					if count != tt.events {
+						t.Errorf("Subscriber %d: expected %d events, got %d", i, tt.events, count)
+					}
+					if !errors.Is(err, tt.err) {
+						t.Errorf("Subscriber %d: expected error %v, got %v", i, tt.err, err)
+					}
+				}(i, sub)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestBroadcast_LossySubscriberDoesNotBlock(t *testing.T) {
+	source, release := broadcastSource(20, nil)
+	broadcast := NewBroadcast(source)
+
+	client := broadcast.Subscribe(0)
+	recorder := broadcast.SubscribeLossy(5)
+	broadcast.Start()
+	close(release)
+
+	count, err := consume(client)
+	if count != 20 || err != nil {
+		t.Fatalf("Expected the client to get 20 events, got %d (%v)", count, err)
+	}
+
+	received, _ := consume(recorder)
+	if int64(received)+recorder.Dropped() != 20 {
+		t.Errorf("Expected received %d plus dropped %d to be 20", received, recorder.Dropped())
+	}
+	if recorder.Dropped() == 0 {
+		t.Error("Expected the unread lossy subscriber to drop events")
+	}
+}
+
+func TestBroadcast_ClosedSubscriberDoesNotBlock(t *testing.T) {
+	source, release := broadcastSource(10, nil)
+	broadcast := NewBroadcast(source)
+
+	client := broadcast.Subscribe(0)
+	leaver := broadcast.Subscribe(0)
+	leaver.Close()
+	if broadcast.Subscribers() != 1 {
+		t.Fatalf("Expected 1 subscriber after close, got %d", broadcast.Subscribers())
+	}
+
+	broadcast.Start()
+	close(release)
+
+	if count, _ := consume(client); count != 10 {
+		t.Errorf("Expected 10 events, got %d", count)
+	}
+}
+
+func TestBroadcast_SubscribeAfterEnd(t *testing.T) {
+	upstreamErr := errors.New("upstream closed")
+	source, release := broadcastSource(3, upstreamErr)
+	broadcast := NewBroadcast(source)
+
+	first := broadcast.Subscribe(0)
+	broadcast.Start()
+	broadcast.Start()
+	close(release)
+	consume(first)
+
+	count, err := consume(broadcast.Subscribe(0))
+	if count != 0 || !errors.Is(err, upstreamErr) {
+		t.Errorf("Expected no events and the stream error, got %d events and %v", count, err)
+	}
+}
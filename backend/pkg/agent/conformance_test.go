@@ -0,0 +1,138 @@
+package agent_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agent-connector/pkg/agent"
+	"agent-connector/pkg/agent/agenttest"
+)
+
+// fakeUpstream start a server answering as upstream, for UpstreamUnreachable the
+// URL of a server that is closed already
+func fakeUpstream(t *testing.T, upstream agenttest.Upstream, healthy, failing http.HandlerFunc) string {
+	t.Helper()
+	handler := healthy
+	if upstream == agenttest.UpstreamFailing {
+		handler = failing
+	}
+	server := httptest.NewServer(handler)
+	if upstream == agenttest.UpstreamUnreachable {
+		server.Close()
+		return server.URL
+	}
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// replyWords the conformance reply split into stream chunks
+func replyWords() []string {
+	return strings.SplitAfter(agenttest.Reply, " ")
+}
+
+func TestOpenAIAgent_Conformance(t *testing.T) {
+	healthy := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}],"data":[]}`, agenttest.Reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range replyWords() {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error":{"message":"upstream failure","type":"server_error","code":"internal_error"}}`)
+	}
+
+	agenttest.Run(t, func(t *testing.T, upstream agenttest.Upstream) agent.Agent {
+		a, err := agent.NewOpenAIAgent(&agent.OpenAIConfig{
+			AgentConfig: agent.AgentConfig{ID: "conformance-openai", Name: "Conformance OpenAI", Type: agent.AgentTypeOpenAI},
+			BaseURL:     fakeUpstream(t, upstream, healthy, failing),
+			APIKey:      "test-key",
+		})
+		if err != nil {
+			t.Fatalf("NewOpenAIAgent() error = %v", err)
+		}
+		return a
+	})
+}
+
+func TestDifyAgent_Conformance(t *testing.T) {
+	healthy := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"response_mode":"streaming"`) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"message_id":"msg-1","conversation_id":"conv-1","mode":"chat","answer":%q}`, agenttest.Reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range replyWords() {
+			fmt.Fprintf(w, "data: {\"event\":\"message\",\"answer\":%q}\n\n", word)
+		}
+		io.WriteString(w, "data: {\"event\":\"message_end\"}\n\n")
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"code":"internal_server_error","message":"upstream failure","status":500}`)
+	}
+
+	agenttest.Run(t, func(t *testing.T, upstream agenttest.Upstream) agent.Agent {
+		a, err := agent.NewDifyAgent(&agent.DifyConfig{
+			AgentConfig: agent.AgentConfig{ID: "conformance-dify", Name: "Conformance Dify", Type: agent.AgentTypeDify},
+			BaseURL:     fakeUpstream(t, upstream, healthy, failing),
+			APIKey:      "test-key",
+			AppID:       "app-1",
+		})
+		if err != nil {
+			t.Fatalf("NewDifyAgent() error = %v", err)
+		}
+		return a
+	})
+}
+
+func TestGeminiAgent_Conformance(t *testing.T) {
+	healthy := func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"models":[{"name":"models/gemini-1.5-flash","supportedGenerationMethods":["generateContent"]}]}`)
+		case strings.HasSuffix(r.URL.Path, ":generateContent"):
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":%q}]},"finishReason":"STOP"}]}`, agenttest.Reply)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, word := range replyWords() {
+				fmt.Fprintf(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":%q}]}}]}\n\n", word)
+			}
+			io.WriteString(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[]},\"finishReason\":\"STOP\"}]}\n\n")
+		}
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error":{"code":500,"message":"upstream failure","status":"INTERNAL"}}`)
+	}
+
+	agenttest.Run(t, func(t *testing.T, upstream agenttest.Upstream) agent.Agent {
+		a, err := agent.NewGeminiAgent(&agent.GeminiConfig{
+			AgentConfig: agent.AgentConfig{ID: "conformance-gemini", Name: "Conformance Gemini", Type: agent.AgentTypeGemini},
+			BaseURL:     fakeUpstream(t, upstream, healthy, failing),
+			APIKey:      "test-key",
+		})
+		if err != nil {
+			t.Fatalf("NewGeminiAgent() error = %v", err)
+		}
+		return a
+	})
+}
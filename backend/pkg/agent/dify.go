@@ -18,7 +18,10 @@ type DifyAgent struct {
 	config     *DifyConfig
 	httpClient *http.Client
 	status     *AgentStatus
+	keys       *KeyPool
+	endpoints  *EndpointSet
 	statusMu   sync.RWMutex // Mutex to protect status field
+	calls      callTracker  // calls in flight, drained before a replaced agent is closed
 }
 
 // DifyConfig represents configuration for Dify agents
@@ -31,6 +34,12 @@ type DifyConfig struct {
 	// APIKey is the API key for authentication
 	APIKey string `json:"api_key"`
 
+	// KeyPoolConfig additional keys rotated with APIKey
+	KeyPoolConfig
+
+	// Endpoints regional base URLs failed over to, in order, after BaseURL
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
 	// AppID is the Dify app identifier
 	AppID string `json:"app_id"`
 
@@ -59,14 +68,14 @@ func NewDifyAgent(config *DifyConfig) (*DifyAgent, error) {
 	// Set defaults
 	setDifyDefaults(config)
 
-	// Create HTTP client with timeout
-	httpClient := &http.Client{
-		Timeout: config.Timeout,
-	}
+	// Calls are bounded by the agent's timeouts, not by the client
+	httpClient := newUpstreamClient(&config.AgentConfig)
 
 	agent := &DifyAgent{
 		config:     config,
 		httpClient: httpClient,
+		keys:       NewKeyPool(config.APIKey, config.KeyPoolConfig),
+		endpoints:  NewEndpointSet(config.BaseURL, config.Endpoints),
 		status: &AgentStatus{
 			AgentID:     config.ID,
 			Status:      "initializing",
@@ -85,23 +94,31 @@ func validateDifyConfig(config *DifyConfig) error {
 	}
 
 	if config.ID == "" {
-		return fmt.Errorf("agent ID is required")
+		return &FieldError{Field: "id", Message: "agent ID is required"}
+	}
+
+	if err := validateBaseURL(config.BaseURL); err != nil {
+		return err
 	}
 
-	if config.BaseURL == "" {
-		return fmt.Errorf("base URL is required")
+	if err := validateKeyPool(config.APIKey, config.KeyPoolConfig); err != nil {
+		return err
 	}
 
-	if config.APIKey == "" {
-		return fmt.Errorf("API key is required")
+	if err := validateEndpoints(config.Endpoints); err != nil {
+		return err
+	}
+
+	if err := validateTimeouts(&config.AgentConfig); err != nil {
+		return err
 	}
 
 	if config.AppID == "" {
-		return fmt.Errorf("app ID is required")
+		return &FieldError{Field: "app_id", Message: "app ID is required"}
 	}
 
 	if !config.Type.IsValid() {
-		return fmt.Errorf("invalid agent type: %s", config.Type)
+		return &FieldError{Field: "type", Message: fmt.Sprintf("invalid agent type: %s", config.Type)}
 	}
 
 	return nil
@@ -117,9 +134,7 @@ func setDifyDefaults(config *DifyConfig) {
 		config.Type = AgentTypeDify
 	}
 
-	if config.Timeout == 0 {
-		config.Timeout = DefaultTimeout
-	}
+	setTimeoutDefaults(&config.AgentConfig)
 
 	if config.MaxConcurrentRequests == 0 {
 		config.MaxConcurrentRequests = DefaultMaxConcurrentRequests
@@ -171,11 +186,13 @@ func (d *DifyAgent) GetCapabilities() AgentCapabilities {
 
 // Chat sends a chat message and returns the response
 func (d *DifyAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	defer d.calls.begin()()
+
 	// Prepare Dify request
 	difyReq := d.prepareDifyRequest(request)
 
 	// Make HTTP request
-	resp, err := d.makeRequest(ctx, "/chat-messages", difyReq)
+	resp, err := d.makeRequest(ctx, "/chat-messages", difyReq, false)
 	if err != nil {
 		d.updateStatus(false, err)
 		return nil, err
@@ -191,11 +208,7 @@ func (d *DifyAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatRespon
 
 	// Check for API errors
 	if difyResp.Code != "" && difyResp.Code != "success" {
-		agentErr := &AgentError{
-			Code:    difyResp.Code,
-			Message: difyResp.Message,
-			Type:    "dify_error",
-		}
+		agentErr := NewAgentError(resp.StatusCode, difyResp.Code, "dify_error", difyResp.Message)
 		d.updateStatus(false, agentErr)
 		return nil, agentErr
 	}
@@ -209,13 +222,17 @@ func (d *DifyAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatRespon
 
 // ChatStream sends a chat message and returns a streaming response
 func (d *DifyAgent) ChatStream(ctx context.Context, request *ChatRequest) (*ChatStreamResponse, error) {
+	// the call lasts until the stream is read to the end or closed
+	done := d.calls.begin()
+
 	// Prepare Dify streaming request
 	difyReq := d.prepareDifyRequest(request)
 	difyReq["response_mode"] = "streaming"
 
 	// Make streaming HTTP request
-	resp, err := d.makeRequest(ctx, "/chat-messages", difyReq)
+	resp, err := d.makeRequest(ctx, "/chat-messages", difyReq, true)
 	if err != nil {
+		done()
 		d.updateStatus(false, err)
 		return nil, err
 	}
@@ -225,7 +242,10 @@ func (d *DifyAgent) ChatStream(ctx context.Context, request *ChatRequest) (*Chat
 	errors := make(chan error, 1)
 
 	// Start streaming goroutine
-	go d.handleStreamResponse(resp.Body, events, errors)
+	go func() {
+		defer done()
+		d.handleStreamResponse(resp.Body, events, errors)
+	}()
 
 	return &ChatStreamResponse{
 		Stream: resp.Body,
@@ -256,6 +276,8 @@ func (d *DifyAgent) ValidateConfig() error {
 
 // GetStatus returns the current status of the agent
 func (d *DifyAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	defer d.calls.begin()()
+
 	// Check if agent is closed (read-only check first)
 	d.statusMu.RLock()
 	isClosed := d.httpClient == nil
@@ -267,6 +289,8 @@ func (d *DifyAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
 		d.status.Status = "offline"
 		d.status.LastChecked = time.Now()
 		statusCopy := *d.status
+		statusCopy.Keys = d.keys.Health(time.Now())
+		statusCopy.Endpoints = d.endpoints.Health(time.Now())
 		d.statusMu.Unlock()
 		return &statusCopy, nil
 	}
@@ -291,9 +315,16 @@ func (d *DifyAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
 
 	d.status.LastChecked = time.Now()
 	statusCopy := *d.status
+	statusCopy.Keys = d.keys.Health(time.Now())
+	statusCopy.Endpoints = d.endpoints.Health(time.Now())
 	return &statusCopy, nil
 }
 
+// Drain waits until the agent has no calls in flight, or until ctx is done
+func (d *DifyAgent) Drain(ctx context.Context) error {
+	return d.calls.wait(ctx)
+}
+
 // Close cleans up resources used by the agent
 func (d *DifyAgent) Close() error {
 	d.statusMu.Lock()
@@ -301,7 +332,8 @@ func (d *DifyAgent) Close() error {
 
 	// Close HTTP client if needed
 	if d.httpClient != nil {
-		// HTTP client doesn't need explicit closing
+		// the agent has a transport of its own
+		d.httpClient.CloseIdleConnections()
 		d.httpClient = nil
 	}
 
@@ -366,7 +398,7 @@ func (d *DifyAgent) getUserID(userID string) string {
 }
 
 // makeRequest makes an HTTP request to the Dify API
-func (d *DifyAgent) makeRequest(ctx context.Context, endpoint string, body interface{}) (*http.Response, error) {
+func (d *DifyAgent) makeRequest(ctx context.Context, endpoint string, body interface{}, stream bool) (*http.Response, error) {
 	// Get httpClient safely
 	d.statusMu.RLock()
 	client := d.httpClient
@@ -374,28 +406,62 @@ func (d *DifyAgent) makeRequest(ctx context.Context, endpoint string, body inter
 
 	// Check if agent is closed
 	if client == nil {
-		return nil, fmt.Errorf("agent is closed")
+		return nil, ErrAgentClosed
 	}
 
-	url := strings.TrimSuffix(d.config.BaseURL, "/") + "/" + d.config.Version + endpoint
-
-	var reqBody io.Reader
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
+	}
+
+	resp, err := d.endpoints.Do(ctx, func(baseURL string) (*http.Response, error) {
+		return d.send(ctx, client, stream, strings.TrimSuffix(baseURL, "/")+"/"+d.config.Version+endpoint, jsonBody)
+	})
+	if err != nil {
+		return nil, TransportError(err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errorResp struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Status  int    `json:"status"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
+			return nil, NewAgentError(resp.StatusCode, errorResp.Code, "dify_error", errorResp.Message)
+		}
+
+		return nil, NewAgentError(resp.StatusCode, "", "", "HTTP error: "+resp.Status)
+	}
+
+	return resp, nil
+}
+
+// send makes one attempt against a single endpoint
+func (d *DifyAgent) send(ctx context.Context, client *http.Client, stream bool, url string, jsonBody []byte) (*http.Response, error) {
+	var reqBody io.Reader
+	if jsonBody != nil {
 		reqBody = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, reqBody)
+	callCtx, watchdog := startWatchdog(ctx, &d.config.AgentConfig, stream)
+	req, err := http.NewRequestWithContext(callCtx, "POST", url, reqBody)
 	if err != nil {
+		watchdog.stop()
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+d.config.APIKey)
+	apiKey := d.keys.Acquire(time.Now())
+	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	// Add custom headers
 	for key, value := range d.config.CustomHeaders {
@@ -404,39 +470,31 @@ func (d *DifyAgent) makeRequest(ctx context.Context, endpoint string, body inter
 
 	// Make request
 	startTime := time.Now()
-	resp, err := client.Do(req)
+	resp, err := watchdog.response(client.Do(req))
 	responseTime := time.Since(startTime).Milliseconds()
 
 	// Update response time in status (thread-safe)
 	d.statusMu.Lock()
-	d.status.ResponseTime = responseTime
+	d.status.ResponseTime = averageResponseTime(d.status.ResponseTime, responseTime)
 	d.statusMu.Unlock()
 
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if resp != nil {
+		d.keys.Report(apiKey, resp.StatusCode, resp.Header, time.Now())
 	}
+	return resp, err
+}
 
-	// Check for HTTP errors
-	if resp.StatusCode >= 400 {
-		defer resp.Body.Close()
-		var errorResp struct {
-			Code    string `json:"code"`
-			Message string `json:"message"`
-			Status  string `json:"status"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-			return nil, &AgentError{
-				Code:    errorResp.Code,
-				Message: errorResp.Message,
-				Type:    "dify_error",
-			}
-		}
+// observeProxied records a call to the upstream made with the agent's API key outside
+// the agent, e.g. by a proxy forwarding requests as they are
+func (d *DifyAgent) observeProxied(resp *http.Response, responseTime time.Duration, err error) {
+	d.statusMu.Lock()
+	d.status.ResponseTime = averageResponseTime(d.status.ResponseTime, responseTime.Milliseconds())
+	d.statusMu.Unlock()
 
-		return nil, fmt.Errorf("HTTP error: %s", resp.Status)
+	if resp != nil {
+		d.keys.Report(d.config.APIKey, resp.StatusCode, resp.Header, time.Now())
 	}
-
-	return resp, nil
+	d.updateStatus(proxiedSuccess(resp, err), proxiedError(resp, err))
 }
 
 // handleStreamResponse handles streaming response
@@ -564,7 +622,7 @@ func (d *DifyAgent) healthCheck(ctx context.Context) error {
 		"user": "health-check",
 	}
 
-	resp, err := d.makeRequest(ctx, "/parameters", req)
+	resp, err := d.makeRequest(ctx, "/parameters", req, false)
 	if err != nil {
 		return err
 	}
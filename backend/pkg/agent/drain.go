@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// Drainer is implemented by agents that track their in-flight calls, so a replaced
+// agent can finish them before it is closed
+type Drainer interface {
+	// Drain waits until the agent has no calls in flight, or until ctx is done
+	Drain(ctx context.Context) error
+}
+
+// callTracker counts the calls an agent has in flight; a stream counts until its
+// response is read to the end or closed
+type callTracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{} // closed once active drops to 0, nil while idle
+}
+
+// begin records the start of a call and returns the func that records its end, safe
+// to call more than once
+func (t *callTracker) begin() func() {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(t.end)
+	}
+}
+
+// end records the end of a call
+func (t *callTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.active--
+	if t.active == 0 {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// inFlight returns the number of calls in flight
+func (t *callTracker) inFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// wait blocks until no call is in flight or ctx is done
+func (t *callTracker) wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		idle := t.idle
+		t.mu.Unlock()
+		if idle == nil {
+			return nil
+		}
+
+		select {
+		case <-idle:
+			// a call may have started since, check again
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
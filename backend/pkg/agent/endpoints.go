@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoint failover defaults
+const (
+	// endpointFailureThreshold consecutive failures after which an endpoint is taken out of rotation
+	endpointFailureThreshold = 3
+	// endpointCooldown how long a failed endpoint is skipped before it is tried again
+	endpointCooldown = 30 * time.Second
+)
+
+// errNoEndpoint is returned when an agent has no endpoint to send to
+var errNoEndpoint = errors.New("no endpoint configured")
+
+// Endpoint an additional base URL of an agent, usually the same deployment in another region
+type Endpoint struct {
+	URL    string `json:"url"`
+	Region string `json:"region,omitempty"`
+}
+
+// EndpointHealth state and latency of one endpoint
+type EndpointHealth struct {
+	URL          string    `json:"url"`
+	Region       string    `json:"region,omitempty"`
+	Healthy      bool      `json:"healthy"`
+	DownUntil    time.Time `json:"down_until,omitempty"`
+	ResponseTime int64     `json:"response_time_ms"`
+	Requests     int       `json:"requests"`
+	Failures     int       `json:"failures"`
+}
+
+// endpointState an endpoint with its failure streak and latency
+type endpointState struct {
+	Endpoint
+	consecutiveFailures int
+	downUntil           time.Time
+	responseTime        int64
+	requests            int
+	failures            int
+}
+
+// EndpointSet sends requests to the endpoints of an agent in configured order,
+// failing over to the next endpoint when one is unreachable or erroring
+type EndpointSet struct {
+	mu        sync.Mutex
+	endpoints []*endpointState
+}
+
+// NewEndpointSet creates the set from the primary base URL followed by the
+// regional endpoints, duplicates and empty URLs are dropped
+func NewEndpointSet(baseURL string, endpoints []Endpoint) *EndpointSet {
+	set := &EndpointSet{}
+	seen := make(map[string]bool)
+	for _, endpoint := range append([]Endpoint{{URL: baseURL}}, endpoints...) {
+		if endpoint.URL == "" || seen[endpoint.URL] {
+			continue
+		}
+		seen[endpoint.URL] = true
+		set.endpoints = append(set.endpoints, &endpointState{Endpoint: endpoint})
+	}
+	return set
+}
+
+// validateEndpoints checks that every regional endpoint has a URL
+func validateEndpoints(endpoints []Endpoint) error {
+	for i, endpoint := range endpoints {
+		if endpoint.URL == "" {
+			return &FieldError{Field: fmt.Sprintf("endpoints[%d].url", i), Message: fmt.Sprintf("endpoint %d: URL is required", i)}
+		}
+	}
+	return nil
+}
+
+// Do sends the request to the first healthy endpoint and fails over to the next
+// one on transport errors and 5xx responses. The last endpoint's answer is
+// returned as is.
+func (s *EndpointSet) Do(ctx context.Context, send func(baseURL string) (*http.Response, error)) (*http.Response, error) {
+	candidates := s.order(time.Now())
+	if len(candidates) == 0 {
+		return nil, errNoEndpoint
+	}
+
+	var resp *http.Response
+	var err error
+	for i, endpoint := range candidates {
+		startTime := time.Now()
+		resp, err = send(endpoint.URL)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		s.report(endpoint.URL, time.Since(startTime), failed, time.Now())
+		if !failed || i == len(candidates)-1 {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// Health returns the state of every endpoint in configured order
+func (s *EndpointSet) Health(now time.Time) []EndpointHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := make([]EndpointHealth, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		entry := EndpointHealth{
+			URL:          endpoint.URL,
+			Region:       endpoint.Region,
+			Healthy:      !now.Before(endpoint.downUntil),
+			ResponseTime: endpoint.responseTime,
+			Requests:     endpoint.requests,
+			Failures:     endpoint.failures,
+		}
+		if !entry.Healthy {
+			entry.DownUntil = endpoint.downUntil
+		}
+		health = append(health, entry)
+	}
+	return health
+}
+
+// Size number of distinct endpoints
+func (s *EndpointSet) Size() int {
+	return len(s.endpoints)
+}
+
+// order healthy endpoints in configured order, followed by the endpoints that are
+// down ordered by when they come back
+func (s *EndpointSet) order(now time.Time) []Endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var healthy, down []*endpointState
+	for _, endpoint := range s.endpoints {
+		if now.Before(endpoint.downUntil) {
+			down = append(down, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	sort.SliceStable(down, func(i, j int) bool {
+		return down[i].downUntil.Before(down[j].downUntil)
+	})
+
+	order := make([]Endpoint, 0, len(s.endpoints))
+	for _, endpoint := range append(healthy, down...) {
+		order = append(order, endpoint.Endpoint)
+	}
+	return order
+}
+
+// report records the outcome of one attempt, an endpoint failing
+// endpointFailureThreshold times in a row is skipped for endpointCooldown
+func (s *EndpointSet) report(url string, responseTime time.Duration, failed bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, endpoint := range s.endpoints {
+		if endpoint.URL != url {
+			continue
+		}
+
+		endpoint.requests++
+		endpoint.responseTime = averageResponseTime(endpoint.responseTime, responseTime.Milliseconds())
+		if !failed {
+			endpoint.consecutiveFailures = 0
+			endpoint.downUntil = time.Time{}
+			return
+		}
+
+		endpoint.failures++
+		endpoint.consecutiveFailures++
+		if endpoint.consecutiveFailures >= endpointFailureThreshold {
+			endpoint.downUntil = now.Add(endpointCooldown)
+		}
+		return
+	}
+}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewEndpointSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		baseURL   string
+		endpoints []Endpoint
+		expected  []string
+	}{
+		{"base url only", "https://eu.example.com", nil, []string{"https://eu.example.com"}},
+		{"regions after base url", "https://eu.example.com", []Endpoint{{URL: "https://us.example.com", Region: "us"}}, []string{"https://eu.example.com", "https://us.example.com"}},
+		{"duplicates dropped", "https://eu.example.com", []Endpoint{{URL: "https://eu.example.com"}, {URL: ""}}, []string{"https://eu.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewEndpointSet(tt.baseURL, tt.endpoints)
+			order := set.order(time.Now())
+			if len(order) != len(tt.expected) {
+				t.Fatalf("Expected %d endpoints, got %d", len(tt.expected), len(order))
+			}
+			for i, url := range tt.expected {
+				if order[i].URL != url {
+					t.Errorf("Endpoint %d: expected %s, got %s", i, url, order[i].URL)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointSet_Order(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		failures map[string]int
+		expected []string
+	}{
+		{"all healthy", nil, []string{"a", "b", "c"}},
+		{"below threshold stays", map[string]int{"a": endpointFailureThreshold - 1}, []string{"a", "b", "c"}},
+		{"failed endpoint last", map[string]int{"a": endpointFailureThreshold}, []string{"b", "c", "a"}},
+		{"all down", map[string]int{"a": endpointFailureThreshold, "b": endpointFailureThreshold, "c": endpointFailureThreshold}, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewEndpointSet("a", []Endpoint{{URL: "b"}, {URL: "c"}})
+			for _, url := range []string{"a", "b", "c"} {
+				for i := 0; i < tt.failures[url]; i++ {
+					set.report(url, time.Millisecond, true, now)
+				}
+			}
+
+			order := set.order(now)
+			for i, url := range tt.expected {
+				if order[i].URL != url {
+					t.Errorf("Position %d: expected %s, got %s", i, url, order[i].URL)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointSet_Recovery(t *testing.T) {
+	now := time.Now()
+	set := NewEndpointSet("a", []Endpoint{{URL: "b"}})
+	for i := 0; i < endpointFailureThreshold; i++ {
+		set.report("a", time.Millisecond, true, now)
+	}
+
+	if order := set.order(now.Add(endpointCooldown)); order[0].URL != "a" {
+		t.Errorf("Expected the endpoint to be retried after the cooldown, got %s", order[0].URL)
+	}
+
+	set.report("a", time.Millisecond, false, now)
+	health := set.Health(now)
+	if !health[0].Healthy || health[0].Failures != endpointFailureThreshold || health[0].Requests != endpointFailureThreshold+1 {
+		t.Errorf("Unexpected health after recovery: %+v", health[0])
+	}
+}
+
+func TestEndpointSet_Do(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachable.Close()
+
+	tests := []struct {
+		name     string
+		urls     []string
+		status   int
+		wantErr  bool
+		attempts int
+	}{
+		{"primary healthy", []string{healthy.URL, failing.URL}, http.StatusOK, false, 1},
+		{"server error fails over", []string{failing.URL, healthy.URL}, http.StatusOK, false, 2},
+		{"unreachable fails over", []string{unreachable.URL, healthy.URL}, http.StatusOK, false, 2},
+		{"client error returned", []string{rejecting.URL, healthy.URL}, http.StatusBadRequest, false, 1},
+		{"single endpoint answer returned", []string{failing.URL}, http.StatusServiceUnavailable, false, 1},
+		{"last error returned", []string{failing.URL, unreachable.URL}, 0, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var endpoints []Endpoint
+			for _, url := range tt.urls[1:] {
+				endpoints = append(endpoints, Endpoint{URL: url})
+			}
+			set := NewEndpointSet(tt.urls[0], endpoints)
+
+			attempts := 0
+			resp, err := set.Do(context.Background(), func(baseURL string) (*http.Response, error) {
+				attempts++
+				return http.Get(baseURL)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if resp != nil {
+				resp.Body.Close()
+				if resp.StatusCode != tt.status {
+					t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+				}
+			}
+			if attempts != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestOpenAIAgent_RegionalFailover(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer secondary.Close()
+
+	agent, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{ID: "regional", Name: "regional", Type: AgentTypeOpenAI, Enabled: true},
+		BaseURL:     primary.URL,
+		APIKey:      "test-key",
+		Endpoints:   []Endpoint{{URL: secondary.URL, Region: "westus"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	request := &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	for i := 0; i < endpointFailureThreshold+1; i++ {
+		if _, err := agent.Chat(context.Background(), request); err != nil {
+			t.Fatalf("Chat %d: expected failover to the secondary region, got %v", i, err)
+		}
+	}
+
+	status, err := agent.GetStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if len(status.Endpoints) != 2 {
+		t.Fatalf("Expected 2 endpoints in status, got %d", len(status.Endpoints))
+	}
+	if status.Endpoints[0].Healthy || status.Endpoints[0].Requests != endpointFailureThreshold {
+		t.Errorf("Expected the primary to be down after %d failures, got %+v", endpointFailureThreshold, status.Endpoints[0])
+	}
+	if status.Endpoints[1].Region != "westus" || !status.Endpoints[1].Healthy {
+		t.Errorf("Unexpected secondary health: %+v", status.Endpoints[1])
+	}
+}
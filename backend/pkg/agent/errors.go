@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Error kinds of agent failures; errors returned by agents wrap one of them, so callers
+// decide with errors.Is instead of matching messages
+var (
+	// ErrRateLimited the upstream rejected the request for rate or quota limits
+	ErrRateLimited = errors.New("agent rate limited")
+
+	// ErrContextLength the prompt does not fit into the model's context window
+	ErrContextLength = errors.New("context length exceeded")
+
+	// ErrAuth the upstream rejected the agent's credentials
+	ErrAuth = errors.New("agent authentication failed")
+
+	// ErrUpstreamTimeout the upstream did not answer in time
+	ErrUpstreamTimeout = errors.New("agent upstream timed out")
+
+	// ErrUpstreamUnavailable the upstream could not be reached or failed with a server error
+	ErrUpstreamUnavailable = errors.New("agent upstream unavailable")
+
+	// ErrInvalidRequest the upstream rejected the request itself
+	ErrInvalidRequest = errors.New("invalid agent request")
+)
+
+// ErrAgentClosed the agent was closed, e.g. after AgentManager.UpdateAgent replaced it;
+// the call never reached the upstream, so it is safe to look the agent up again and retry
+var ErrAgentClosed = errors.New("agent is closed")
+
+// Stable codes of the error kinds, used in API responses and retry policies
+const (
+	ErrorCodeRateLimited         = "rate_limited"
+	ErrorCodeContextLength       = "context_length_exceeded"
+	ErrorCodeAuth                = "upstream_auth_failed"
+	ErrorCodeUpstreamTimeout     = "upstream_timeout"
+	ErrorCodeUpstreamUnavailable = "upstream_unavailable"
+	ErrorCodeInvalidRequest      = "invalid_request"
+)
+
+// errorKinds code and client-facing HTTP status of each kind; authentication
+// failures are the connector's credentials, not the caller's, hence 502
+var errorKinds = []struct {
+	kind   error
+	code   string
+	status int
+}{
+	{ErrRateLimited, ErrorCodeRateLimited, http.StatusTooManyRequests},
+	{ErrContextLength, ErrorCodeContextLength, http.StatusBadRequest},
+	{ErrAuth, ErrorCodeAuth, http.StatusBadGateway},
+	{ErrUpstreamTimeout, ErrorCodeUpstreamTimeout, http.StatusGatewayTimeout},
+	{ErrUpstreamUnavailable, ErrorCodeUpstreamUnavailable, http.StatusBadGateway},
+	{ErrInvalidRequest, ErrorCodeInvalidRequest, http.StatusBadRequest},
+}
+
+// upstreamCodes provider error codes and types with a kind of their own, whatever
+// the status they come with
+var upstreamCodes = map[string]error{
+	"context_length_exceeded": ErrContextLength,
+	"rate_limit_exceeded":     ErrRateLimited,
+	"insufficient_quota":      ErrRateLimited,
+	"invalid_api_key":         ErrAuth,
+	"unauthorized":            ErrAuth,
+}
+
+// ClassifyStatus the kind of an error answered by the upstream with status and the
+// provider's error code or type, nil for a success status
+func ClassifyStatus(status int, codes ...string) error {
+	for _, code := range codes {
+		if kind, ok := upstreamCodes[code]; ok {
+			return kind
+		}
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrUpstreamTimeout
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrContextLength
+	case status >= 500:
+		return ErrUpstreamUnavailable
+	case status >= 400:
+		return ErrInvalidRequest
+	default:
+		return nil
+	}
+}
+
+// NewAgentError creates the error of an upstream error response, classified by its
+// status, code and type
+func NewAgentError(status int, code, errType, message string) *AgentError {
+	if message == "" {
+		message = fmt.Sprintf("agent returned error status: %d", status)
+	}
+	kind := ClassifyStatus(status, code, errType)
+	if kind == nil {
+		kind = ErrUpstreamUnavailable
+	}
+	return &AgentError{
+		Code:       code,
+		Message:    message,
+		Type:       errType,
+		StatusCode: status,
+		Kind:       kind,
+	}
+}
+
+// TransportError wrap a failed upstream call with its kind, timeouts as
+// ErrUpstreamTimeout and everything else but a cancelled caller as ErrUpstreamUnavailable
+func TransportError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrUpstreamTimeout):
+		// a TimeoutError of the agent's own timeouts
+		return fmt.Errorf("request failed: %w", err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("request failed: %w", err)
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return fmt.Errorf("request failed: %w: %w", ErrUpstreamTimeout, err)
+	default:
+		return fmt.Errorf("request failed: %w: %w", ErrUpstreamUnavailable, err)
+	}
+}
+
+// ErrorCode the stable code of the error's kind, empty when it has none
+func ErrorCode(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			return k.code
+		}
+	}
+	return ""
+}
+
+// HTTPStatus the status a gateway answers its client with for the error's kind,
+// 0 when it has none
+func HTTPStatus(err error) int {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			return k.status
+		}
+	}
+	return 0
+}
+
+// IsRetryable whether the same request may succeed when sent again or to another
+// agent: rate limits, timeouts and unavailable upstreams
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUpstreamTimeout) || errors.Is(err, ErrUpstreamUnavailable)
+}
+
+// ShouldRetry whether the policy retries the error, by its RetryableErrors codes or,
+// when none are set, IsRetryable
+func (p *RetryPolicy) ShouldRetry(err error) bool {
+	if err == nil {
+		return false
+	}
+	if len(p.RetryableErrors) == 0 {
+		return IsRetryable(err)
+	}
+	code := ErrorCode(err)
+	for _, retryable := range p.RetryableErrors {
+		if code != "" && retryable == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		codes  []string
+		want   error
+	}{
+		{name: "Success", status: http.StatusOK, want: nil},
+		{name: "Unauthorized", status: http.StatusUnauthorized, want: ErrAuth},
+		{name: "Forbidden", status: http.StatusForbidden, want: ErrAuth},
+		{name: "Too many requests", status: http.StatusTooManyRequests, want: ErrRateLimited},
+		{name: "Gateway timeout", status: http.StatusGatewayTimeout, want: ErrUpstreamTimeout},
+		{name: "Server error", status: http.StatusServiceUnavailable, want: ErrUpstreamUnavailable},
+		{name: "Bad request", status: http.StatusBadRequest, want: ErrInvalidRequest},
+		{name: "Context length code", status: http.StatusBadRequest, codes: []string{"context_length_exceeded"}, want: ErrContextLength},
+		{name: "Quota code", status: http.StatusBadRequest, codes: []string{"", "insufficient_quota"}, want: ErrRateLimited},
+		{name: "Unknown code", status: http.StatusBadGateway, codes: []string{"server_error"}, want: ErrUpstreamUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyStatus(tt.status, tt.codes...); got != tt.want {
+				t.Errorf("ClassifyStatus(%d, %v) = %v, want %v", tt.status, tt.codes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		code      string
+		status    int
+		retryable bool
+	}{
+		{name: "Rate limited agent error", err: NewAgentError(429, "rate_limit_exceeded", "requests", "slow down"), code: ErrorCodeRateLimited, status: 429, retryable: true},
+		{name: "Context length agent error", err: NewAgentError(400, "context_length_exceeded", "invalid_request_error", "too long"), code: ErrorCodeContextLength, status: 400},
+		{name: "Auth agent error", err: NewAgentError(401, "invalid_api_key", "", "bad key"), code: ErrorCodeAuth, status: 502},
+		{name: "Wrapped agent error", err: fmt.Errorf("failed: %w", NewAgentError(500, "", "", "")), code: ErrorCodeUpstreamUnavailable, status: 502, retryable: true},
+		{name: "Transport timeout", err: TransportError(context.DeadlineExceeded), code: ErrorCodeUpstreamTimeout, status: 504, retryable: true},
+		{name: "Transport failure", err: TransportError(errors.New("connection refused")), code: ErrorCodeUpstreamUnavailable, status: 502, retryable: true},
+		{name: "Cancelled caller", err: TransportError(context.Canceled)},
+		{name: "Unclassified", err: errors.New("failed to decode response")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCode(tt.err); got != tt.code {
+				t.Errorf("ErrorCode() = %q, want %q", got, tt.code)
+			}
+			if got := HTTPStatus(tt.err); got != tt.status {
+				t.Errorf("HTTPStatus() = %d, want %d", got, tt.status)
+			}
+			if got := IsRetryable(tt.err); got != tt.retryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	rateLimited := NewAgentError(429, "", "", "slow down")
+	unavailable := NewAgentError(503, "", "", "down")
+	invalid := NewAgentError(400, "", "", "bad")
+
+	tests := []struct {
+		name      string
+		retryable []string
+		err       error
+		want      bool
+	}{
+		{name: "Default retries retryable kinds", err: unavailable, want: true},
+		{name: "Default skips invalid requests", err: invalid, want: false},
+		{name: "Listed code", retryable: []string{ErrorCodeRateLimited}, err: rateLimited, want: true},
+		{name: "Unlisted code", retryable: []string{ErrorCodeRateLimited}, err: unavailable, want: false},
+		{name: "Nil error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetryPolicy{RetryableErrors: tt.retryable}
+			if got := policy.ShouldRetry(tt.err); got != tt.want {
+				t.Errorf("ShouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -34,6 +35,13 @@ func (f *AgentFactory) CreateAgent(agentType AgentType, config interface{}) (Age
 		}
 		return NewDifyAgent(difyConfig)
 
+	case AgentTypeGemini:
+		geminiConfig, ok := config.(*GeminiConfig)
+		if !ok {
+			return nil, fmt.Errorf("invalid config type for Gemini agent, expected *GeminiConfig")
+		}
+		return NewGeminiAgent(geminiConfig)
+
 	default:
 		return nil, fmt.Errorf("unsupported agent type: %s", agentType)
 	}
@@ -49,6 +57,11 @@ func (f *AgentFactory) CreateDifyAgent(config *DifyConfig) (*DifyAgent, error) {
 	return NewDifyAgent(config)
 }
 
+// CreateGeminiAgent creates a Gemini agent
+func (f *AgentFactory) CreateGeminiAgent(config *GeminiConfig) (*GeminiAgent, error) {
+	return NewGeminiAgent(config)
+}
+
 // OpenAIConfigBuilder provides a fluent interface for building OpenAI configurations
 type OpenAIConfigBuilder struct {
 	config *OpenAIConfig
@@ -95,6 +108,18 @@ func (b *OpenAIConfigBuilder) WithAPIKey(apiKey string) *OpenAIConfigBuilder {
 	return b
 }
 
+// WithAPIKeys sets additional API keys rotated with the primary key
+func (b *OpenAIConfigBuilder) WithAPIKeys(apiKeys ...string) *OpenAIConfigBuilder {
+	b.config.APIKeys = apiKeys
+	return b
+}
+
+// WithKeyRotation sets how the API keys are rotated
+func (b *OpenAIConfigBuilder) WithKeyRotation(rotation KeyRotation) *OpenAIConfigBuilder {
+	b.config.KeyRotation = rotation
+	return b
+}
+
 // WithOrganization sets the organization ID
 func (b *OpenAIConfigBuilder) WithOrganization(organization string) *OpenAIConfigBuilder {
 	b.config.Organization = organization
@@ -131,6 +156,24 @@ func (b *OpenAIConfigBuilder) WithTimeout(timeout time.Duration) *OpenAIConfigBu
 	return b
 }
 
+// WithConnectTimeout sets the timeout for opening a connection
+func (b *OpenAIConfigBuilder) WithConnectTimeout(timeout time.Duration) *OpenAIConfigBuilder {
+	b.config.ConnectTimeout = timeout
+	return b
+}
+
+// WithFirstByteTimeout sets the timeout until the response headers arrive
+func (b *OpenAIConfigBuilder) WithFirstByteTimeout(timeout time.Duration) *OpenAIConfigBuilder {
+	b.config.FirstByteTimeout = timeout
+	return b
+}
+
+// WithStreamIdleTimeout sets the longest silence between two chunks of a stream
+func (b *OpenAIConfigBuilder) WithStreamIdleTimeout(timeout time.Duration) *OpenAIConfigBuilder {
+	b.config.StreamIdleTimeout = timeout
+	return b
+}
+
 // WithPriority sets the agent priority
 func (b *OpenAIConfigBuilder) WithPriority(priority int) *OpenAIConfigBuilder {
 	b.config.Priority = priority
@@ -220,6 +263,18 @@ func (b *DifyConfigBuilder) WithAPIKey(apiKey string) *DifyConfigBuilder {
 	return b
 }
 
+// WithAPIKeys sets additional API keys rotated with the primary key
+func (b *DifyConfigBuilder) WithAPIKeys(apiKeys ...string) *DifyConfigBuilder {
+	b.config.APIKeys = apiKeys
+	return b
+}
+
+// WithKeyRotation sets how the API keys are rotated
+func (b *DifyConfigBuilder) WithKeyRotation(rotation KeyRotation) *DifyConfigBuilder {
+	b.config.KeyRotation = rotation
+	return b
+}
+
 // WithAppID sets the app ID
 func (b *DifyConfigBuilder) WithAppID(appID string) *DifyConfigBuilder {
 	b.config.AppID = appID
@@ -256,6 +311,24 @@ func (b *DifyConfigBuilder) WithTimeout(timeout time.Duration) *DifyConfigBuilde
 	return b
 }
 
+// WithConnectTimeout sets the timeout for opening a connection
+func (b *DifyConfigBuilder) WithConnectTimeout(timeout time.Duration) *DifyConfigBuilder {
+	b.config.ConnectTimeout = timeout
+	return b
+}
+
+// WithFirstByteTimeout sets the timeout until the response headers arrive
+func (b *DifyConfigBuilder) WithFirstByteTimeout(timeout time.Duration) *DifyConfigBuilder {
+	b.config.FirstByteTimeout = timeout
+	return b
+}
+
+// WithStreamIdleTimeout sets the longest silence between two chunks of a stream
+func (b *DifyConfigBuilder) WithStreamIdleTimeout(timeout time.Duration) *DifyConfigBuilder {
+	b.config.StreamIdleTimeout = timeout
+	return b
+}
+
 // WithPriority sets the agent priority
 func (b *DifyConfigBuilder) WithPriority(priority int) *DifyConfigBuilder {
 	b.config.Priority = priority
@@ -297,6 +370,161 @@ func (b *DifyConfigBuilder) Build() *DifyConfig {
 	return b.config
 }
 
+// GeminiConfigBuilder provides a fluent interface for building Gemini configurations
+type GeminiConfigBuilder struct {
+	config *GeminiConfig
+}
+
+// NewGeminiConfigBuilder creates a new Gemini config builder
+func NewGeminiConfigBuilder() *GeminiConfigBuilder {
+	return &GeminiConfigBuilder{
+		config: &GeminiConfig{
+			AgentConfig: AgentConfig{
+				Type:                  AgentTypeGemini,
+				Enabled:               true,
+				Priority:              50,
+				Timeout:               DefaultTimeout,
+				MaxConcurrentRequests: DefaultMaxConcurrentRequests,
+			},
+			BaseURL:     "https://generativelanguage.googleapis.com",
+			APIVersion:  "v1beta",
+			Temperature: 0.7,
+			MaxTokens:   8192,
+		},
+	}
+}
+
+// WithID sets the agent ID
+func (b *GeminiConfigBuilder) WithID(id string) *GeminiConfigBuilder {
+	b.config.ID = id
+	return b
+}
+
+// WithName sets the agent name
+func (b *GeminiConfigBuilder) WithName(name string) *GeminiConfigBuilder {
+	b.config.Name = name
+	return b
+}
+
+// WithBaseURL sets the base URL
+func (b *GeminiConfigBuilder) WithBaseURL(baseURL string) *GeminiConfigBuilder {
+	b.config.BaseURL = baseURL
+	return b
+}
+
+// WithAPIKey sets the API key
+func (b *GeminiConfigBuilder) WithAPIKey(apiKey string) *GeminiConfigBuilder {
+	b.config.APIKey = apiKey
+	return b
+}
+
+// WithAPIKeys sets additional API keys rotated with the primary key
+func (b *GeminiConfigBuilder) WithAPIKeys(apiKeys ...string) *GeminiConfigBuilder {
+	b.config.APIKeys = apiKeys
+	return b
+}
+
+// WithKeyRotation sets how the API keys are rotated
+func (b *GeminiConfigBuilder) WithKeyRotation(rotation KeyRotation) *GeminiConfigBuilder {
+	b.config.KeyRotation = rotation
+	return b
+}
+
+// WithAPIVersion sets the API version
+func (b *GeminiConfigBuilder) WithAPIVersion(version string) *GeminiConfigBuilder {
+	b.config.APIVersion = version
+	return b
+}
+
+// WithDefaultModel sets the default model
+func (b *GeminiConfigBuilder) WithDefaultModel(model string) *GeminiConfigBuilder {
+	b.config.DefaultModel = model
+	return b
+}
+
+// WithSupportedModels sets the supported models
+func (b *GeminiConfigBuilder) WithSupportedModels(models []string) *GeminiConfigBuilder {
+	b.config.SupportedModels = models
+	return b
+}
+
+// WithMaxTokens sets the maximum output tokens
+func (b *GeminiConfigBuilder) WithMaxTokens(maxTokens int) *GeminiConfigBuilder {
+	b.config.MaxTokens = maxTokens
+	return b
+}
+
+// WithTemperature sets the temperature
+func (b *GeminiConfigBuilder) WithTemperature(temperature float32) *GeminiConfigBuilder {
+	b.config.Temperature = temperature
+	return b
+}
+
+// WithTimeout sets the request timeout
+func (b *GeminiConfigBuilder) WithTimeout(timeout time.Duration) *GeminiConfigBuilder {
+	b.config.Timeout = timeout
+	return b
+}
+
+// WithConnectTimeout sets the timeout for opening a connection
+func (b *GeminiConfigBuilder) WithConnectTimeout(timeout time.Duration) *GeminiConfigBuilder {
+	b.config.ConnectTimeout = timeout
+	return b
+}
+
+// WithFirstByteTimeout sets the timeout until the response headers arrive
+func (b *GeminiConfigBuilder) WithFirstByteTimeout(timeout time.Duration) *GeminiConfigBuilder {
+	b.config.FirstByteTimeout = timeout
+	return b
+}
+
+// WithStreamIdleTimeout sets the longest silence between two chunks of a stream
+func (b *GeminiConfigBuilder) WithStreamIdleTimeout(timeout time.Duration) *GeminiConfigBuilder {
+	b.config.StreamIdleTimeout = timeout
+	return b
+}
+
+// WithPriority sets the agent priority
+func (b *GeminiConfigBuilder) WithPriority(priority int) *GeminiConfigBuilder {
+	b.config.Priority = priority
+	return b
+}
+
+// WithMaxConcurrentRequests sets the maximum concurrent requests
+func (b *GeminiConfigBuilder) WithMaxConcurrentRequests(maxRequests int) *GeminiConfigBuilder {
+	b.config.MaxConcurrentRequests = maxRequests
+	return b
+}
+
+// WithCustomHeaders sets custom HTTP headers
+func (b *GeminiConfigBuilder) WithCustomHeaders(headers map[string]string) *GeminiConfigBuilder {
+	b.config.CustomHeaders = headers
+	return b
+}
+
+// WithRetryPolicy sets the retry policy
+func (b *GeminiConfigBuilder) WithRetryPolicy(policy *RetryPolicy) *GeminiConfigBuilder {
+	b.config.RetryPolicy = policy
+	return b
+}
+
+// WithHealthCheck sets the health check configuration
+func (b *GeminiConfigBuilder) WithHealthCheck(healthCheck *HealthCheckConfig) *GeminiConfigBuilder {
+	b.config.HealthCheck = healthCheck
+	return b
+}
+
+// Enabled sets whether the agent is enabled
+func (b *GeminiConfigBuilder) Enabled(enabled bool) *GeminiConfigBuilder {
+	b.config.Enabled = enabled
+	return b
+}
+
+// Build builds the Gemini configuration
+func (b *GeminiConfigBuilder) Build() *GeminiConfig {
+	return b.config
+}
+
 // RetryPolicyBuilder provides a fluent interface for building retry policies
 type RetryPolicyBuilder struct {
 	policy *RetryPolicy
@@ -402,7 +630,32 @@ func (b *HealthCheckConfigBuilder) Build() *HealthCheckConfig {
 	return b.config
 }
 
-// ConfigValidator provides validation for agent configurations
+// FieldError a configuration value the validators reject, Field names it as in the
+// JSON configuration (e.g. base_url, api_key, endpoints[0].url)
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Error returns the message
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// validateBaseURL checks that the base URL is an absolute http or https URL
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return &FieldError{Field: "base_url", Message: "base URL is required"}
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &FieldError{Field: "base_url", Message: fmt.Sprintf("base URL must be an http or https URL: %s", baseURL)}
+	}
+	return nil
+}
+
+// ConfigValidator provides validation for agent configurations, errors about a single
+// value are *FieldError
 type ConfigValidator struct{}
 
 // NewConfigValidator creates a new config validator
@@ -420,6 +673,11 @@ func (v *ConfigValidator) ValidateDifyConfig(config *DifyConfig) error {
 	return validateDifyConfig(config)
 }
 
+// ValidateGeminiConfig validates a Gemini configuration
+func (v *ConfigValidator) ValidateGeminiConfig(config *GeminiConfig) error {
+	return validateGeminiConfig(config)
+}
+
 // ValidateAgentManagerConfig validates an agent manager configuration
 func (v *ConfigValidator) ValidateAgentManagerConfig(config *AgentManagerConfig) error {
 	if config == nil {
@@ -517,6 +775,30 @@ func (p *PresetConfigs) DifyAgent(id, name, baseURL, apiKey, appID string) *Dify
 		Build()
 }
 
+// GeminiFlash returns a preset configuration for Google Gemini 1.5 Flash
+func (p *PresetConfigs) GeminiFlash(id, name, apiKey string) *GeminiConfig {
+	return NewGeminiConfigBuilder().
+		WithID(id).
+		WithName(name).
+		WithAPIKey(apiKey).
+		WithDefaultModel("gemini-1.5-flash").
+		WithMaxTokens(8192).
+		WithTemperature(0.7).
+		Build()
+}
+
+// GeminiPro returns a preset configuration for Google Gemini 1.5 Pro
+func (p *PresetConfigs) GeminiPro(id, name, apiKey string) *GeminiConfig {
+	return NewGeminiConfigBuilder().
+		WithID(id).
+		WithName(name).
+		WithAPIKey(apiKey).
+		WithDefaultModel("gemini-1.5-pro").
+		WithMaxTokens(8192).
+		WithTemperature(0.7).
+		Build()
+}
+
 // ConfigTemplate represents a configuration template
 type ConfigTemplate struct {
 	Name        string                 `json:"name"`
@@ -593,6 +875,20 @@ func (tm *TemplateManager) addDefaultTemplates() {
 			"auto_generate_title": true,
 		},
 	})
+
+	// Gemini templates
+	tm.AddTemplate(&ConfigTemplate{
+		Name:        "gemini-flash",
+		Description: "Google Gemini 1.5 Flash configuration template",
+		Type:        AgentTypeGemini,
+		Template: map[string]interface{}{
+			"base_url":      "https://generativelanguage.googleapis.com",
+			"api_version":   "v1beta",
+			"default_model": "gemini-1.5-flash",
+			"max_tokens":    8192,
+			"temperature":   0.7,
+		},
+	})
 }
 
 // AddTemplate adds a configuration template
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -263,6 +264,21 @@ func TestPresetConfigs(t *testing.T) {
 	if difyAgentConfig.AppType != "agent" {
 		t.Errorf("Expected AppType to be 'agent', got %s", difyAgentConfig.AppType)
 	}
+
+	// Test Gemini presets
+	geminiConfig := presets.GeminiFlash("gemini", "Gemini Agent", "gemini-key")
+	if geminiConfig.Type != AgentTypeGemini || geminiConfig.DefaultModel != "gemini-1.5-flash" {
+		t.Errorf("Expected a gemini-1.5-flash Gemini config, got %s %s", geminiConfig.Type, geminiConfig.DefaultModel)
+	}
+	if geminiConfig.BaseURL != "https://generativelanguage.googleapis.com" {
+		t.Errorf("Expected the Gemini API base URL, got %s", geminiConfig.BaseURL)
+	}
+	if _, err := NewAgentFactory().CreateAgent(AgentTypeGemini, geminiConfig); err != nil {
+		t.Errorf("Expected the Gemini preset to create an agent, got %v", err)
+	}
+	if proConfig := presets.GeminiPro("gemini-pro", "Gemini Pro", "gemini-key"); proConfig.DefaultModel != "gemini-1.5-pro" {
+		t.Errorf("Expected model to be 'gemini-1.5-pro', got %s", proConfig.DefaultModel)
+	}
 }
 
 func TestAgentManager(t *testing.T) {
@@ -372,6 +388,7 @@ func TestAgentType(t *testing.T) {
 	}{
 		{AgentTypeOpenAI, true, "openai"},
 		{AgentTypeDify, true, "dify"},
+		{AgentTypeGemini, true, "gemini"},
 		{AgentType("invalid"), false, "invalid"},
 	}
 
@@ -400,6 +417,81 @@ func TestAgentError(t *testing.T) {
 	}
 }
 
+func TestConfigValidator_FieldErrors(t *testing.T) {
+	validator := NewConfigValidator()
+	openAI := func(modify func(*OpenAIConfig)) *OpenAIConfig {
+		config := &OpenAIConfig{
+			AgentConfig: AgentConfig{ID: "openai", Type: AgentTypeOpenAI},
+			BaseURL:     "https://api.openai.com/v1",
+			APIKey:      "sk-test",
+		}
+		modify(config)
+		return config
+	}
+	dify := func(modify func(*DifyConfig)) *DifyConfig {
+		config := &DifyConfig{
+			AgentConfig: AgentConfig{ID: "dify", Type: AgentTypeDify},
+			BaseURL:     "https://api.dify.ai/v1",
+			APIKey:      "app-test",
+			AppID:       "app-123",
+		}
+		modify(config)
+		return config
+	}
+
+	tests := []struct {
+		name     string
+		validate func() error
+		field    string
+	}{
+		{"Valid OpenAI", func() error { return validator.ValidateOpenAIConfig(openAI(func(*OpenAIConfig) {})) }, ""},
+		{"Valid Dify", func() error { return validator.ValidateDifyConfig(dify(func(*DifyConfig) {})) }, ""},
+		{"OpenAI missing base URL", func() error {
+			return validator.ValidateOpenAIConfig(openAI(func(c *OpenAIConfig) { c.BaseURL = "" }))
+		}, "base_url"},
+		{"OpenAI relative base URL", func() error {
+			return validator.ValidateOpenAIConfig(openAI(func(c *OpenAIConfig) { c.BaseURL = "api.openai.com/v1" }))
+		}, "base_url"},
+		{"OpenAI missing key", func() error {
+			return validator.ValidateOpenAIConfig(openAI(func(c *OpenAIConfig) { c.APIKey = "" }))
+		}, "api_key"},
+		{"OpenAI empty endpoint", func() error {
+			return validator.ValidateOpenAIConfig(openAI(func(c *OpenAIConfig) { c.Endpoints = []Endpoint{{URL: "https://eu.example.com"}, {}} }))
+		}, "endpoints[1].url"},
+		{"Dify ftp base URL", func() error {
+			return validator.ValidateDifyConfig(dify(func(c *DifyConfig) { c.BaseURL = "ftp://api.dify.ai" }))
+		}, "base_url"},
+		{"Dify missing app ID", func() error {
+			return validator.ValidateDifyConfig(dify(func(c *DifyConfig) { c.AppID = "" }))
+		}, "app_id"},
+		{"Dify invalid key rotation", func() error {
+			return validator.ValidateDifyConfig(dify(func(c *DifyConfig) { c.KeyRotation = "random" }))
+		}, "key_rotation"},
+		{"Dify wrong type", func() error {
+			return validator.ValidateDifyConfig(dify(func(c *DifyConfig) { c.Type = "dify-chat" }))
+		}, "type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("Expected a *FieldError, got %v", err)
+			}
+			if fieldErr.Field != tt.field {
+				t.Errorf("Field = %q, want %q (%v)", fieldErr.Field, tt.field, err)
+			}
+		})
+	}
+}
+
 func BenchmarkAgentFactory_CreateAgent(b *testing.B) {
 	factory := NewAgentFactory()
 	config := &OpenAIConfig{
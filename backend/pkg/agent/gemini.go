@@ -0,0 +1,833 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeminiAgent implements the Agent interface for the Google Gemini API
+type GeminiAgent struct {
+	config     *GeminiConfig
+	httpClient *http.Client
+	status     *AgentStatus
+	keys       *KeyPool
+	endpoints  *EndpointSet
+	statusMu   sync.RWMutex // Mutex to protect status field
+	calls      callTracker  // calls in flight, drained before a replaced agent is closed
+}
+
+// GeminiConfig represents configuration for Gemini agents
+type GeminiConfig struct {
+	AgentConfig
+
+	// BaseURL is the base URL for the Gemini API
+	BaseURL string `json:"base_url"`
+
+	// APIKey is the API key for authentication
+	APIKey string `json:"api_key"`
+
+	// KeyPoolConfig additional keys rotated with APIKey
+	KeyPoolConfig
+
+	// Endpoints regional base URLs failed over to, in order, after BaseURL
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// APIVersion is the API version in the request path (e.g. v1beta)
+	APIVersion string `json:"api_version"`
+
+	// DefaultModel is the default model to use
+	DefaultModel string `json:"default_model"`
+
+	// SupportedModels lists available models
+	SupportedModels []string `json:"supported_models"`
+
+	// MaxTokens is the default maximum output tokens
+	MaxTokens int `json:"max_tokens"`
+
+	// Temperature is the default temperature
+	Temperature float32 `json:"temperature"`
+
+	// CustomHeaders for additional HTTP headers
+	CustomHeaders map[string]string `json:"custom_headers,omitempty"`
+}
+
+// NewGeminiAgent creates a new Gemini agent
+func NewGeminiAgent(config *GeminiConfig) (*GeminiAgent, error) {
+	if err := validateGeminiConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Set defaults
+	setGeminiDefaults(config)
+
+	// Calls are bounded by the agent's timeouts, not by the client
+	httpClient := newUpstreamClient(&config.AgentConfig)
+
+	agent := &GeminiAgent{
+		config:     config,
+		httpClient: httpClient,
+		keys:       NewKeyPool(config.APIKey, config.KeyPoolConfig),
+		endpoints:  NewEndpointSet(config.BaseURL, config.Endpoints),
+		status: &AgentStatus{
+			AgentID:     config.ID,
+			Status:      "initializing",
+			Health:      false,
+			LastChecked: time.Now(),
+		},
+	}
+
+	return agent, nil
+}
+
+// validateGeminiConfig validates the Gemini configuration
+func validateGeminiConfig(config *GeminiConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if config.ID == "" {
+		return &FieldError{Field: "id", Message: "agent ID is required"}
+	}
+
+	if err := validateBaseURL(config.BaseURL); err != nil {
+		return err
+	}
+
+	if err := validateKeyPool(config.APIKey, config.KeyPoolConfig); err != nil {
+		return err
+	}
+
+	if err := validateEndpoints(config.Endpoints); err != nil {
+		return err
+	}
+
+	if err := validateTimeouts(&config.AgentConfig); err != nil {
+		return err
+	}
+
+	if !config.Type.IsValid() {
+		return &FieldError{Field: "type", Message: fmt.Sprintf("invalid agent type: %s", config.Type)}
+	}
+
+	return nil
+}
+
+// setGeminiDefaults sets default values for Gemini configuration
+func setGeminiDefaults(config *GeminiConfig) {
+	if config.Name == "" {
+		config.Name = "Gemini Agent"
+	}
+
+	if config.Type == "" {
+		config.Type = AgentTypeGemini
+	}
+
+	setTimeoutDefaults(&config.AgentConfig)
+
+	if config.MaxConcurrentRequests == 0 {
+		config.MaxConcurrentRequests = DefaultMaxConcurrentRequests
+	}
+
+	if config.APIVersion == "" {
+		config.APIVersion = "v1beta"
+	}
+
+	if config.DefaultModel == "" {
+		config.DefaultModel = "gemini-1.5-flash"
+	}
+
+	if config.MaxTokens == 0 {
+		config.MaxTokens = 8192
+	}
+
+	if config.Temperature == 0 {
+		config.Temperature = 0.7
+	}
+
+	if len(config.SupportedModels) == 0 {
+		config.SupportedModels = []string{
+			"gemini-1.5-flash",
+			"gemini-1.5-pro",
+		}
+	}
+}
+
+// GetID returns the unique identifier of the agent
+func (g *GeminiAgent) GetID() string {
+	return g.config.ID
+}
+
+// GetName returns the display name of the agent
+func (g *GeminiAgent) GetName() string {
+	return g.config.Name
+}
+
+// GetType returns the type of the agent source
+func (g *GeminiAgent) GetType() AgentType {
+	return AgentTypeGemini
+}
+
+// GetCapabilities returns the capabilities of the agent
+func (g *GeminiAgent) GetCapabilities() AgentCapabilities {
+	return AgentCapabilities{
+		SupportsChatCompletion:  true,
+		SupportsStreaming:       true,
+		SupportsImages:          true,
+		SupportsFiles:           false,
+		SupportsFunctionCalling: true,
+		MaxTokens:               g.config.MaxTokens,
+		SupportedLanguages:      []string{"en", "zh", "es", "fr", "de", "ja", "ko"},
+	}
+}
+
+// Chat sends a chat message and returns the response
+func (g *GeminiAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	defer g.calls.begin()()
+
+	model := g.getModel(request.Model)
+
+	resp, err := g.makeRequest(ctx, http.MethodPost, g.modelPath(model, "generateContent"), g.prepareGeminiRequest(request), false)
+	if err != nil {
+		g.updateStatus(false, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var geminiResp geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+		g.updateStatus(false, fmt.Errorf("failed to decode response: %w", err))
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	response := g.convertToStandardResponse(&geminiResp, model)
+	g.updateStatus(true, nil)
+
+	return response, nil
+}
+
+// ChatStream sends a chat message and returns a streaming response
+func (g *GeminiAgent) ChatStream(ctx context.Context, request *ChatRequest) (*ChatStreamResponse, error) {
+	// the call lasts until the stream is read to the end or closed
+	done := g.calls.begin()
+
+	// Server-sent events instead of the default JSON array
+	path := g.modelPath(g.getModel(request.Model), "streamGenerateContent") + "?alt=sse"
+
+	resp, err := g.makeRequest(ctx, http.MethodPost, path, g.prepareGeminiRequest(request), true)
+	if err != nil {
+		done()
+		g.updateStatus(false, err)
+		return nil, err
+	}
+
+	// Create channels for streaming
+	events := make(chan StreamEvent, 100)
+	errors := make(chan error, 1)
+
+	// Start streaming goroutine
+	go func() {
+		defer done()
+		g.handleStreamResponse(resp.Body, events, errors)
+	}()
+
+	return &ChatStreamResponse{
+		Stream: resp.Body,
+		Events: events,
+		Errors: errors,
+	}, nil
+}
+
+// GetModels returns available models for this agent
+func (g *GeminiAgent) GetModels(ctx context.Context) ([]Model, error) {
+	defer g.calls.begin()()
+
+	resp, err := g.makeRequest(ctx, http.MethodGet, "/models", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var modelsResp struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			DisplayName                string   `json:"displayName"`
+			Description                string   `json:"description"`
+			OutputTokenLimit           int      `json:"outputTokenLimit"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode models response: %w", err)
+	}
+
+	// Convert to standard models, embedding models cannot chat
+	models := make([]Model, 0, len(modelsResp.Models))
+	for _, model := range modelsResp.Models {
+		if len(model.SupportedGenerationMethods) > 0 && !slices.Contains(model.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		capabilities := g.GetCapabilities()
+		if model.OutputTokenLimit > 0 {
+			capabilities.MaxTokens = model.OutputTokenLimit
+		}
+		models = append(models, Model{
+			ID:           strings.TrimPrefix(model.Name, "models/"),
+			Name:         model.DisplayName,
+			Description:  model.Description,
+			OwnedBy:      "google",
+			Capabilities: capabilities,
+		})
+	}
+
+	return models, nil
+}
+
+// ValidateConfig validates the agent configuration
+func (g *GeminiAgent) ValidateConfig() error {
+	return validateGeminiConfig(g.config)
+}
+
+// GetStatus returns the current status of the agent
+func (g *GeminiAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	defer g.calls.begin()()
+
+	// Check if agent is closed (read-only check first)
+	g.statusMu.RLock()
+	isClosed := g.httpClient == nil
+	g.statusMu.RUnlock()
+
+	if isClosed {
+		g.statusMu.Lock()
+		g.status.Health = false
+		g.status.Status = "inactive"
+		g.status.LastChecked = time.Now()
+		statusCopy := *g.status
+		statusCopy.Keys = g.keys.Health(time.Now())
+		statusCopy.Endpoints = g.endpoints.Health(time.Now())
+		g.statusMu.Unlock()
+		return &statusCopy, nil
+	}
+
+	// Perform health check without holding the lock
+	healthErr := g.healthCheck(ctx)
+
+	// Update status based on health check result
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	if healthErr != nil {
+		g.status.Health = false
+		g.status.Status = "error"
+		g.status.Details = map[string]interface{}{
+			"error": healthErr.Error(),
+		}
+	} else {
+		g.status.Health = true
+		g.status.Status = "active"
+	}
+
+	g.status.LastChecked = time.Now()
+	statusCopy := *g.status
+	statusCopy.Keys = g.keys.Health(time.Now())
+	statusCopy.Endpoints = g.endpoints.Health(time.Now())
+	return &statusCopy, nil
+}
+
+// Drain waits until the agent has no calls in flight, or until ctx is done
+func (g *GeminiAgent) Drain(ctx context.Context) error {
+	return g.calls.wait(ctx)
+}
+
+// Close cleans up resources used by the agent
+func (g *GeminiAgent) Close() error {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	if g.httpClient != nil {
+		// the agent has a transport of its own
+		g.httpClient.CloseIdleConnections()
+		g.httpClient = nil
+	}
+
+	g.status.Status = "inactive"
+	return nil
+}
+
+// prepareGeminiRequest converts a ChatRequest to a Gemini generateContent request:
+// system messages become the system instruction, assistant messages are sent as the
+// model role and function results as functionResponse parts of the user. Consecutive
+// messages of the same role are merged, as Gemini expects the roles to alternate.
+func (g *GeminiAgent) prepareGeminiRequest(request *ChatRequest) *geminiRequest {
+	req := &geminiRequest{
+		GenerationConfig: &geminiGenerationConfig{},
+	}
+
+	var system []geminiPart
+	for _, message := range request.Messages {
+		role, parts := geminiMessageParts(message)
+		if role == "system" {
+			system = append(system, parts...)
+			continue
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		if last := len(req.Contents) - 1; last >= 0 && req.Contents[last].Role == role {
+			req.Contents[last].Parts = append(req.Contents[last].Parts, parts...)
+			continue
+		}
+		req.Contents = append(req.Contents, geminiContent{Role: role, Parts: parts})
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	// Add optional parameters
+	if request.Temperature != nil {
+		req.GenerationConfig.Temperature = request.Temperature
+	} else {
+		temperature := g.config.Temperature
+		req.GenerationConfig.Temperature = &temperature
+	}
+
+	if request.MaxTokens != nil {
+		req.GenerationConfig.MaxOutputTokens = *request.MaxTokens
+	} else if g.config.MaxTokens > 0 {
+		req.GenerationConfig.MaxOutputTokens = g.config.MaxTokens
+	}
+
+	// Functions and tools are both function declarations
+	var declarations []Function
+	declarations = append(declarations, request.Functions...)
+	for _, tool := range request.Tools {
+		if tool.Type == "" || tool.Type == "function" {
+			declarations = append(declarations, tool.Function)
+		}
+	}
+	if len(declarations) > 0 {
+		req.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+
+	return req
+}
+
+// geminiMessageParts the Gemini role and parts of a chat message
+func geminiMessageParts(message Message) (string, []geminiPart) {
+	switch message.Role {
+	case "system":
+		return "system", []geminiPart{{Text: message.Content}}
+
+	case "assistant":
+		var parts []geminiPart
+		if message.Content != "" {
+			parts = append(parts, geminiPart{Text: message.Content})
+		}
+		if message.FunctionCall != nil {
+			parts = append(parts, geminiPart{FunctionCall: newGeminiFunctionCall(*message.FunctionCall)})
+		}
+		for _, call := range message.ToolCalls {
+			parts = append(parts, geminiPart{FunctionCall: newGeminiFunctionCall(call.Function)})
+		}
+		return "model", parts
+
+	case "function", "tool":
+		return "user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+			Name:     message.Name,
+			Response: map[string]interface{}{"content": message.Content},
+		}}}
+
+	default:
+		return "user", []geminiPart{{Text: message.Content}}
+	}
+}
+
+// newGeminiFunctionCall converts a function call, whose arguments are a JSON string,
+// to a Gemini function call with the arguments as an object
+func newGeminiFunctionCall(call FunctionCall) *geminiFunctionCall {
+	args := map[string]interface{}{}
+	if call.Arguments != "" {
+		_ = json.Unmarshal([]byte(call.Arguments), &args)
+	}
+	return &geminiFunctionCall{Name: call.Name, Args: args}
+}
+
+// getModel returns the model to use, with fallback to default
+func (g *GeminiAgent) getModel(model string) string {
+	if model != "" {
+		return model
+	}
+	return g.config.DefaultModel
+}
+
+// modelPath the path of a method of the model, which may be named with or without
+// its models/ prefix
+func (g *GeminiAgent) modelPath(model, method string) string {
+	return "/models/" + url.PathEscape(strings.TrimPrefix(model, "models/")) + ":" + method
+}
+
+// makeRequest makes an HTTP request to the Gemini API
+func (g *GeminiAgent) makeRequest(ctx context.Context, method, endpoint string, body interface{}, stream bool) (*http.Response, error) {
+	// Get httpClient safely
+	g.statusMu.RLock()
+	client := g.httpClient
+	g.statusMu.RUnlock()
+
+	// Check if agent is closed
+	if client == nil {
+		return nil, ErrAgentClosed
+	}
+
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		jsonBody, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	resp, err := g.endpoints.Do(ctx, func(baseURL string) (*http.Response, error) {
+		return g.send(ctx, client, method, stream, strings.TrimSuffix(baseURL, "/")+"/"+g.config.APIVersion+endpoint, jsonBody)
+	})
+	if err != nil {
+		return nil, TransportError(err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errorResp struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
+			return nil, NewAgentError(resp.StatusCode, errorResp.Error.Status, "gemini_error", errorResp.Error.Message)
+		}
+
+		return nil, NewAgentError(resp.StatusCode, "", "", "HTTP error: "+resp.Status)
+	}
+
+	return resp, nil
+}
+
+// send makes one attempt against a single endpoint
+func (g *GeminiAgent) send(ctx context.Context, client *http.Client, method string, stream bool, url string, jsonBody []byte) (*http.Response, error) {
+	var reqBody io.Reader
+	if jsonBody != nil {
+		reqBody = bytes.NewReader(jsonBody)
+	}
+
+	callCtx, watchdog := startWatchdog(ctx, &g.config.AgentConfig, stream)
+	req, err := http.NewRequestWithContext(callCtx, method, url, reqBody)
+	if err != nil {
+		watchdog.stop()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers, the key is sent as a header to keep it out of URLs in logs
+	if jsonBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	apiKey := g.keys.Acquire(time.Now())
+	req.Header.Set("x-goog-api-key", apiKey)
+
+	// Add custom headers
+	for key, value := range g.config.CustomHeaders {
+		req.Header.Set(key, value)
+	}
+
+	// Make request
+	startTime := time.Now()
+	resp, err := watchdog.response(client.Do(req))
+	responseTime := time.Since(startTime).Milliseconds()
+
+	// Update response time in status (thread-safe)
+	g.statusMu.Lock()
+	g.status.ResponseTime = averageResponseTime(g.status.ResponseTime, responseTime)
+	g.statusMu.Unlock()
+
+	if resp != nil {
+		g.keys.Report(apiKey, resp.StatusCode, resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+// handleStreamResponse handles streaming response, every event is a complete
+// generateContent response holding the next part of the answer
+func (g *GeminiAgent) handleStreamResponse(body io.ReadCloser, events chan<- StreamEvent, errors chan<- error) {
+	defer close(events)
+	defer close(errors)
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		// Check for data prefix
+		if strings.HasPrefix(line, "data: ") {
+			data := strings.TrimPrefix(line, "data: ")
+
+			// Parse JSON data
+			var chunk geminiResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				errors <- fmt.Errorf("failed to parse stream chunk: %w", err)
+				return
+			}
+
+			// Convert to standard event
+			event := g.convertStreamChunk(&chunk)
+			if event != nil {
+				events <- *event
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		errors <- fmt.Errorf("error reading stream: %w", err)
+	}
+}
+
+// convertToStandardResponse converts Gemini response to standard format
+func (g *GeminiAgent) convertToStandardResponse(resp *geminiResponse, model string) *ChatResponse {
+	response := &ChatResponse{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Usage:   resp.UsageMetadata.usage(),
+	}
+	if resp.ModelVersion != "" {
+		response.Model = resp.ModelVersion
+	}
+
+	for i, candidate := range resp.Candidates {
+		message, finishReason := candidate.message()
+		response.Choices = append(response.Choices, Choice{
+			Index:        i,
+			Message:      message,
+			FinishReason: finishReason,
+		})
+	}
+
+	// A blocked prompt has no candidates
+	if len(response.Choices) == 0 {
+		response.Choices = []Choice{{
+			Message:      Message{Role: "assistant"},
+			FinishReason: stringPtr("content_filter"),
+		}}
+		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+			response.Metadata = map[string]interface{}{
+				"block_reason": resp.PromptFeedback.BlockReason,
+			}
+		}
+	}
+
+	return response
+}
+
+// convertStreamChunk converts Gemini stream chunk to standard event
+func (g *GeminiAgent) convertStreamChunk(chunk *geminiResponse) *StreamEvent {
+	if len(chunk.Candidates) == 0 {
+		if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+			return &StreamEvent{
+				Type:         "finish",
+				FinishReason: stringPtr("content_filter"),
+				Data:         chunk.PromptFeedback,
+			}
+		}
+		return nil
+	}
+
+	message, finishReason := chunk.Candidates[0].message()
+	event := &StreamEvent{
+		Type: "content",
+		Delta: &Delta{
+			Role:      message.Role,
+			Content:   message.Content,
+			ToolCalls: message.ToolCalls,
+		},
+	}
+
+	if finishReason != nil {
+		event.FinishReason = finishReason
+		event.Type = "finish"
+	}
+
+	return event
+}
+
+// healthCheck performs a health check on the agent
+func (g *GeminiAgent) healthCheck(ctx context.Context) error {
+	// Simple health check by listing the models
+	resp, err := g.makeRequest(ctx, http.MethodGet, "/models", nil, false)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// updateStatus updates the agent status based on operation result
+func (g *GeminiAgent) updateStatus(success bool, err error) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	g.status.RequestCount++
+	if success {
+		g.status.Health = true
+		g.status.Status = "online"
+	} else {
+		g.status.ErrorCount++
+		g.status.Health = false
+		g.status.Status = "error"
+		if err != nil {
+			g.status.Details = map[string]interface{}{
+				"last_error": err.Error(),
+			}
+		}
+	}
+
+	// Calculate success rate
+	if g.status.RequestCount > 0 {
+		g.status.SuccessRate = float64(g.status.RequestCount-g.status.ErrorCount) / float64(g.status.RequestCount) * 100
+	}
+
+	g.status.LastChecked = time.Now()
+}
+
+// Gemini API request structures
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []Function `json:"functionDeclarations"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float32 `json:"temperature,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+}
+
+// Gemini API response structures
+type geminiResponse struct {
+	ResponseID     string              `json:"responseId"`
+	ModelVersion   string              `json:"modelVersion"`
+	Candidates     []geminiCandidate   `json:"candidates"`
+	UsageMetadata  *geminiUsage        `json:"usageMetadata,omitempty"`
+	PromptFeedback *geminiPromptResult `json:"promptFeedback,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type geminiPromptResult struct {
+	BlockReason string `json:"blockReason"`
+}
+
+// usage converts the token counts, nil when Gemini sent none
+func (u *geminiUsage) usage() *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+}
+
+// message the assistant message of a candidate and its finish reason, nil while the
+// candidate is not finished
+func (c *geminiCandidate) message() (Message, *string) {
+	message := Message{Role: "assistant"}
+	var text strings.Builder
+	for _, part := range c.Content.Parts {
+		text.WriteString(part.Text)
+		if part.FunctionCall != nil {
+			arguments, _ := json.Marshal(part.FunctionCall.Args)
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:       fmt.Sprintf("call_%d", len(message.ToolCalls)),
+				Type:     "function",
+				Function: FunctionCall{Name: part.FunctionCall.Name, Arguments: string(arguments)},
+			})
+		}
+	}
+	message.Content = text.String()
+
+	if c.FinishReason == "" || c.FinishReason == "FINISH_REASON_UNSPECIFIED" {
+		return message, nil
+	}
+	if len(message.ToolCalls) > 0 {
+		return message, stringPtr("tool_calls")
+	}
+	return message, stringPtr(geminiFinishReason(c.FinishReason))
+}
+
+// geminiFinishReason maps a Gemini finish reason to the OpenAI one
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
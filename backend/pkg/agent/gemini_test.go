@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestGeminiAgent a Gemini agent against the server at baseURL
+func newTestGeminiAgent(t *testing.T, baseURL string) *GeminiAgent {
+	t.Helper()
+	agent, err := NewGeminiAgent(&GeminiConfig{
+		AgentConfig: AgentConfig{
+			ID:   "test-gemini",
+			Name: "Test Gemini Agent",
+			Type: AgentTypeGemini,
+		},
+		BaseURL: baseURL,
+		APIKey:  "test-key",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	t.Cleanup(func() { agent.Close() })
+	return agent
+}
+
+func TestNewGeminiAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *GeminiConfig
+		wantErr  bool
+		errorMsg string
+	}{
+		{
+			name: "Valid config",
+			config: &GeminiConfig{
+				AgentConfig: AgentConfig{ID: "test-gemini", Type: AgentTypeGemini},
+				BaseURL:     "https://generativelanguage.googleapis.com",
+				APIKey:      "test-key",
+			},
+		},
+		{
+			name: "Missing API key",
+			config: &GeminiConfig{
+				AgentConfig: AgentConfig{ID: "test-gemini", Type: AgentTypeGemini},
+				BaseURL:     "https://generativelanguage.googleapis.com",
+			},
+			wantErr:  true,
+			errorMsg: "API key is required",
+		},
+		{
+			name: "Missing base URL",
+			config: &GeminiConfig{
+				AgentConfig: AgentConfig{ID: "test-gemini", Type: AgentTypeGemini},
+				APIKey:      "test-key",
+			},
+			wantErr:  true,
+			errorMsg: "base URL is required",
+		},
+		{
+			name:     "Nil config",
+			config:   nil,
+			wantErr:  true,
+			errorMsg: "config cannot be nil",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, err := NewGeminiAgent(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewGeminiAgent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("Expected error containing '%s', got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if agent.config.APIVersion != "v1beta" || agent.config.DefaultModel != "gemini-1.5-flash" {
+				t.Errorf("Expected defaults v1beta and gemini-1.5-flash, got %s and %s", agent.config.APIVersion, agent.config.DefaultModel)
+			}
+		})
+	}
+}
+
+func TestGeminiAgent_PrepareRequest(t *testing.T) {
+	agent := newTestGeminiAgent(t, "https://generativelanguage.googleapis.com")
+	maxTokens := 256
+
+	req := agent.prepareGeminiRequest(&ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "What is the weather in Paris?"},
+			{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_0", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}},
+			{Role: "tool", Name: "get_weather", Content: "sunny"},
+			{Role: "user", Content: "And tomorrow?"},
+		},
+		MaxTokens: &maxTokens,
+		Tools:     []Tool{{Type: "function", Function: Function{Name: "get_weather", Description: "Current weather"}}},
+	})
+
+	if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("Expected the system message as system instruction, got %+v", req.SystemInstruction)
+	}
+	// the tool result and the next user message are merged into one user turn
+	roles := make([]string, len(req.Contents))
+	for i, content := range req.Contents {
+		roles[i] = content.Role
+	}
+	if strings.Join(roles, ",") != "user,model,user" {
+		t.Fatalf("Expected roles user,model,user, got %v", roles)
+	}
+	call := req.Contents[1].Parts[0].FunctionCall
+	if call == nil || call.Name != "get_weather" || call.Args["city"] != "Paris" {
+		t.Errorf("Expected a get_weather function call with city Paris, got %+v", call)
+	}
+	lastTurn := req.Contents[2].Parts
+	if len(lastTurn) != 2 || lastTurn[0].FunctionResponse == nil || lastTurn[0].FunctionResponse.Name != "get_weather" || lastTurn[1].Text != "And tomorrow?" {
+		t.Errorf("Expected the function response followed by the user message, got %+v", lastTurn)
+	}
+	if req.GenerationConfig.MaxOutputTokens != 256 {
+		t.Errorf("Expected maxOutputTokens 256, got %d", req.GenerationConfig.MaxOutputTokens)
+	}
+	if req.GenerationConfig.Temperature == nil || *req.GenerationConfig.Temperature != 0.7 {
+		t.Errorf("Expected the default temperature 0.7, got %v", req.GenerationConfig.Temperature)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].FunctionDeclarations[0].Name != "get_weather" {
+		t.Errorf("Expected the tool as function declaration, got %+v", req.Tools)
+	}
+}
+
+func TestGeminiAgent_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-1.5-pro:generateContent" {
+			t.Errorf("Expected path /v1beta/models/gemini-1.5-pro:generateContent, got %s", r.URL.Path)
+		}
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("Expected the API key header, got %q", r.Header.Get("x-goog-api-key"))
+		}
+		var body geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Contents) != 1 || body.Contents[0].Role != "user" {
+			t.Errorf("Expected one user content, got %+v (%v)", body, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"candidates": [{
+				"content": {"role": "model", "parts": [{"text": "Hello! "}, {"text": "How can I help?"}]},
+				"finishReason": "STOP"
+			}],
+			"usageMetadata": {"promptTokenCount": 4, "candidatesTokenCount": 6, "totalTokenCount": 10},
+			"modelVersion": "gemini-1.5-pro-002",
+			"responseId": "resp-1"
+		}`)
+	}))
+	defer server.Close()
+
+	agent := newTestGeminiAgent(t, server.URL)
+	resp, err := agent.Chat(context.Background(), &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+		Model:    "models/gemini-1.5-pro",
+	})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if resp.ID != "resp-1" || resp.Model != "gemini-1.5-pro-002" {
+		t.Errorf("Expected ID resp-1 and model gemini-1.5-pro-002, got %s and %s", resp.ID, resp.Model)
+	}
+	if len(resp.Choices) != 1 {
+		t.Fatalf("Expected one choice, got %d", len(resp.Choices))
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Role != "assistant" || choice.Message.Content != "Hello! How can I help?" {
+		t.Errorf("Unexpected message: %+v", choice.Message)
+	}
+	if choice.FinishReason == nil || *choice.FinishReason != "stop" {
+		t.Errorf("Expected finish reason stop, got %v", choice.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 4 || resp.Usage.CompletionTokens != 6 || resp.Usage.TotalTokens != 10 {
+		t.Errorf("Unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestGeminiAgent_ChatFunctionCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"candidates": [{"content": {"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]}, "finishReason": "STOP"}]}`)
+	}))
+	defer server.Close()
+
+	agent := newTestGeminiAgent(t, server.URL)
+	resp, err := agent.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Weather?"}}})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	message := resp.Choices[0].Message
+	if len(message.ToolCalls) != 1 || message.ToolCalls[0].Function.Name != "get_weather" || message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("Expected a get_weather tool call, got %+v", message.ToolCalls)
+	}
+	if reason := resp.Choices[0].FinishReason; reason == nil || *reason != "tool_calls" {
+		t.Errorf("Expected finish reason tool_calls, got %v", reason)
+	}
+}
+
+func TestGeminiAgent_ChatBlockedPrompt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"promptFeedback": {"blockReason": "SAFETY"}}`)
+	}))
+	defer server.Close()
+
+	agent := newTestGeminiAgent(t, server.URL)
+	resp, err := agent.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "..."}}})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if len(resp.Choices) != 1 || resp.Choices[0].FinishReason == nil || *resp.Choices[0].FinishReason != "content_filter" {
+		t.Fatalf("Expected one content_filter choice, got %+v", resp.Choices)
+	}
+	if resp.Metadata["block_reason"] != "SAFETY" {
+		t.Errorf("Expected block reason SAFETY, got %v", resp.Metadata)
+	}
+}
+
+func TestGeminiAgent_ChatWithError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error": {"code": 429, "message": "Resource has been exhausted", "status": "RESOURCE_EXHAUSTED"}}`)
+	}))
+	defer server.Close()
+
+	agent := newTestGeminiAgent(t, server.URL)
+	_, err := agent.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hello"}}})
+	if err == nil {
+		t.Fatal("Expected error for an exhausted quota")
+	}
+
+	var agentErr *AgentError
+	if !errors.As(err, &agentErr) || agentErr.Code != "RESOURCE_EXHAUSTED" || agentErr.Message != "Resource has been exhausted" {
+		t.Errorf("Expected the Gemini error, got %v", err)
+	}
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestGeminiAgent_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-1.5-flash:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("Expected the SSE stream of gemini-1.5-flash, got %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hello\"}]}}]}\r\n\r\n")
+		io.WriteString(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\" there\"}]},\"finishReason\":\"MAX_TOKENS\"}],\"usageMetadata\":{\"totalTokenCount\":7}}\r\n\r\n")
+	}))
+	defer server.Close()
+
+	agent := newTestGeminiAgent(t, server.URL)
+	stream, err := agent.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hello"}}})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	var content strings.Builder
+	var finishReason string
+	for event := range stream.Events {
+		if event.Delta != nil {
+			content.WriteString(event.Delta.Content)
+		}
+		if event.FinishReason != nil {
+			finishReason = *event.FinishReason
+		}
+	}
+	if err := <-stream.Errors; err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+
+	if content.String() != "Hello there" {
+		t.Errorf("Expected streamed content 'Hello there', got %q", content.String())
+	}
+	if finishReason != "length" {
+		t.Errorf("Expected finish reason length, got %q", finishReason)
+	}
+}
+
+func TestGeminiAgent_GetModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1beta/models" {
+			t.Errorf("Expected GET /v1beta/models, got %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"models": [
+			{"name": "models/gemini-1.5-flash", "displayName": "Gemini 1.5 Flash", "outputTokenLimit": 8192, "supportedGenerationMethods": ["generateContent", "countTokens"]},
+			{"name": "models/text-embedding-004", "displayName": "Text Embedding 004", "supportedGenerationMethods": ["embedContent"]}
+		]}`)
+	}))
+	defer server.Close()
+
+	agent := newTestGeminiAgent(t, server.URL)
+	models, err := agent.GetModels(context.Background())
+	if err != nil {
+		t.Fatalf("GetModels failed: %v", err)
+	}
+
+	if len(models) != 1 {
+		t.Fatalf("Expected only the chat model, got %+v", models)
+	}
+	if models[0].ID != "gemini-1.5-flash" || models[0].Name != "Gemini 1.5 Flash" || models[0].Capabilities.MaxTokens != 8192 {
+		t.Errorf("Unexpected model: %+v", models[0])
+	}
+}
@@ -47,6 +47,10 @@ type AgentManager interface {
 	// UnregisterAgent removes an agent
 	UnregisterAgent(agentID string) error
 
+	// UpdateAgent replaces a registered agent with a new instance of the same ID,
+	// closing the old one once its in-flight calls finished
+	UpdateAgent(agent Agent) error
+
 	// GetAgent retrieves an agent by ID
 	GetAgent(agentID string) (Agent, error)
 
@@ -72,6 +76,9 @@ const (
 
 	// AgentTypeDify represents Dify platform agents
 	AgentTypeDify AgentType = "dify"
+
+	// AgentTypeGemini represents Google Gemini agents
+	AgentTypeGemini AgentType = "gemini"
 )
 
 // String returns the string representation of the agent type
@@ -82,7 +89,7 @@ func (at AgentType) String() string {
 // IsValid checks if the agent type is valid
 func (at AgentType) IsValid() bool {
 	switch at {
-	case AgentTypeOpenAI, AgentTypeDify:
+	case AgentTypeOpenAI, AgentTypeDify, AgentTypeGemini:
 		return true
 	default:
 		return false
@@ -334,7 +341,7 @@ type AgentStatus struct {
 	// LastChecked timestamp
 	LastChecked time.Time `json:"last_checked"`
 
-	// ResponseTime in milliseconds
+	// ResponseTime rolling average in milliseconds, 0 until the first request
 	ResponseTime int64 `json:"response_time_ms"`
 
 	// ErrorCount in the last period
@@ -346,6 +353,12 @@ type AgentStatus struct {
 	// SuccessRate percentage
 	SuccessRate float64 `json:"success_rate"`
 
+	// Keys health of each upstream API key the agent rotates among
+	Keys []KeyHealth `json:"keys,omitempty"`
+
+	// Endpoints health and latency of each base URL the agent fails over between
+	Endpoints []EndpointHealth `json:"endpoints,omitempty"`
+
 	// Additional status information
 	Details map[string]interface{} `json:"details,omitempty"`
 }
@@ -366,6 +379,12 @@ type AgentError struct {
 
 	// Details contains additional error details
 	Details map[string]interface{} `json:"details,omitempty"`
+
+	// StatusCode is the HTTP status the upstream answered with, 0 when unknown
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Kind is the sentinel error classifying the failure, e.g. ErrRateLimited
+	Kind error `json:"-"`
 }
 
 // Error implements the error interface
@@ -373,6 +392,11 @@ func (e *AgentError) Error() string {
 	return e.Message
 }
 
+// Unwrap returns the kind, so errors.Is(err, ErrRateLimited) works on agent errors
+func (e *AgentError) Unwrap() error {
+	return e.Kind
+}
+
 // AgentConfig represents the base configuration for agents
 type AgentConfig struct {
 	// ID of the agent
@@ -390,9 +414,19 @@ type AgentConfig struct {
 	// Priority for agent selection (higher = more preferred)
 	Priority int `json:"priority"`
 
-	// Timeout for requests to this agent
+	// Timeout for requests to this agent, from sending to the end of the response;
+	// streams are bounded by StreamIdleTimeout instead
 	Timeout time.Duration `json:"timeout"`
 
+	// ConnectTimeout for opening a connection to the upstream
+	ConnectTimeout time.Duration `json:"connect_timeout,omitempty"`
+
+	// FirstByteTimeout from sending a request to the response headers, Timeout when unset
+	FirstByteTimeout time.Duration `json:"first_byte_timeout,omitempty"`
+
+	// StreamIdleTimeout longest silence between two chunks of a stream before it is aborted
+	StreamIdleTimeout time.Duration `json:"stream_idle_timeout,omitempty"`
+
 	// MaxConcurrentRequests limits concurrent requests
 	MaxConcurrentRequests int `json:"max_concurrent_requests"`
 
@@ -420,7 +454,8 @@ type RetryPolicy struct {
 	// Multiplier for exponential backoff
 	Multiplier float64 `json:"multiplier"`
 
-	// RetryableErrors are error codes that should trigger retries
+	// RetryableErrors are error codes (see ErrorCode) that should trigger retries,
+	// when empty every error IsRetryable accepts is retried
 	RetryableErrors []string `json:"retryable_errors"`
 }
 
@@ -460,6 +495,9 @@ const (
 
 	// WeightedRandom strategy
 	WeightedRandom LoadBalancingStrategy = "weighted_random"
+
+	// LeastLatency strategy (faster of two random agents by average response time)
+	LeastLatency LoadBalancingStrategy = "least_latency"
 )
 
 // AgentManagerConfig represents configuration for the agent manager
@@ -479,14 +517,39 @@ type AgentManagerConfig struct {
 	// MaxRetries for failed requests
 	MaxRetries int `json:"max_retries"`
 
+	// LatencyBudget excludes agents whose average response time exceeds it while
+	// any agent is within budget (0 disables)
+	LatencyBudget time.Duration `json:"latency_budget"`
+
+	// ProviderLimitThreshold share of its provider rate limit from which an agent
+	// is skipped while any agent has more headroom (0 disables)
+	ProviderLimitThreshold float64 `json:"provider_limit_threshold"`
+
+	// StatusCacheTTL how long a known agent status is served before it is refreshed
+	// in the background (0 checks upstream on every call)
+	StatusCacheTTL time.Duration `json:"status_cache_ttl"`
+
+	// StatusCacheJitter fraction of the TTL a refresh is moved by at random
+	StatusCacheJitter float64 `json:"status_cache_jitter"`
+
+	// DrainTimeout how long a replaced agent is left to finish its in-flight calls in
+	// the background before it is closed anyway (0 closes it right away)
+	DrainTimeout time.Duration `json:"drain_timeout"`
+
 	// EnableMetrics indicates if metrics should be collected
 	EnableMetrics bool `json:"enable_metrics"`
 }
 
 // Default values for configuration
 const (
-	DefaultTimeout               = 30 * time.Second
-	DefaultMaxConcurrentRequests = 10
-	DefaultHealthCheckInterval   = 1 * time.Minute
-	DefaultMaxRetries            = 3
+	DefaultTimeout                = 30 * time.Second
+	DefaultConnectTimeout         = 10 * time.Second
+	DefaultStreamIdleTimeout      = 60 * time.Second
+	DefaultMaxConcurrentRequests  = 10
+	DefaultHealthCheckInterval    = 1 * time.Minute
+	DefaultMaxRetries             = 3
+	DefaultStatusCacheTTL         = 15 * time.Second
+	DefaultStatusCacheJitter      = 0.2
+	DefaultProviderLimitThreshold = 0.9
+	DefaultDrainTimeout           = 30 * time.Second
 )
@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KeyRotation strategy for picking among the API keys of an agent
+type KeyRotation string
+
+const (
+	// KeyRotationRoundRobin uses the keys in turn
+	KeyRotationRoundRobin KeyRotation = "round_robin"
+	// KeyRotationLeastThrottled prefers the key that was rate limited longest ago
+	KeyRotationLeastThrottled KeyRotation = "least_recently_throttled"
+)
+
+// IsValid checks if the key rotation strategy is supported
+func (r KeyRotation) IsValid() bool {
+	switch r {
+	case "", KeyRotationRoundRobin, KeyRotationLeastThrottled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Default cooldowns for keys rejected by the provider
+const (
+	DefaultKeyCooldown     = 30 * time.Second
+	DefaultKeyAuthCooldown = 5 * time.Minute
+)
+
+// KeyPoolConfig upstream API keys an agent rotates among in addition to APIKey
+type KeyPoolConfig struct {
+	// APIKeys additional keys, APIKey may be left empty when these are set
+	APIKeys []string `json:"api_keys,omitempty"`
+
+	// KeyRotation strategy, round robin by default
+	KeyRotation KeyRotation `json:"key_rotation,omitempty"`
+
+	// KeyCooldown how long a rate limited key is skipped when the provider sends no Retry-After
+	KeyCooldown time.Duration `json:"key_cooldown,omitempty"`
+
+	// KeyAuthCooldown how long a key the provider rejected as unauthorized is skipped
+	KeyAuthCooldown time.Duration `json:"key_auth_cooldown,omitempty"`
+}
+
+// KeyHealth state of one pooled key, the key itself is masked
+type KeyHealth struct {
+	Key           string    `json:"key"`
+	Available     bool      `json:"available"`
+	CooldownUntil time.Time `json:"cooldown_until,omitempty"`
+	Requests      int       `json:"requests"`
+	Throttled     int       `json:"throttled"`
+	AuthFailures  int       `json:"auth_failures"`
+	LastThrottled time.Time `json:"last_throttled,omitempty"`
+}
+
+// pooledKey a key with its cooldown and counters
+type pooledKey struct {
+	key           string
+	cooldownUntil time.Time
+	lastThrottled time.Time
+	requests      int
+	throttled     int
+	authFailures  int
+}
+
+// KeyPool hands out the API keys of an agent and cools down keys the provider rejects
+type KeyPool struct {
+	mu           sync.Mutex
+	keys         []*pooledKey
+	rotation     KeyRotation
+	cooldown     time.Duration
+	authCooldown time.Duration
+	next         int
+}
+
+// NewKeyPool creates a pool from the primary key and the configured extra keys,
+// duplicates and empty keys are dropped
+func NewKeyPool(primary string, config KeyPoolConfig) *KeyPool {
+	pool := &KeyPool{
+		rotation:     config.KeyRotation,
+		cooldown:     config.KeyCooldown,
+		authCooldown: config.KeyAuthCooldown,
+	}
+	if pool.rotation == "" {
+		pool.rotation = KeyRotationRoundRobin
+	}
+	if pool.cooldown <= 0 {
+		pool.cooldown = DefaultKeyCooldown
+	}
+	if pool.authCooldown <= 0 {
+		pool.authCooldown = DefaultKeyAuthCooldown
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range append([]string{primary}, config.APIKeys...) {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pool.keys = append(pool.keys, &pooledKey{key: key})
+	}
+	return pool
+}
+
+// validateKeyPool checks that an agent has at least one key and a known rotation
+func validateKeyPool(primary string, config KeyPoolConfig) error {
+	if !config.KeyRotation.IsValid() {
+		return &FieldError{Field: "key_rotation", Message: fmt.Sprintf("invalid key rotation: %s", config.KeyRotation)}
+	}
+	if primary != "" {
+		return nil
+	}
+	for _, key := range config.APIKeys {
+		if key != "" {
+			return nil
+		}
+	}
+	return &FieldError{Field: "api_key", Message: "API key is required"}
+}
+
+// Acquire picks the key for the next request. When every key is cooling down the
+// one that becomes available first is used rather than failing the request.
+func (p *KeyPool) Acquire(now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var picked *pooledKey
+	pickedIndex := 0
+	for i := range p.keys {
+		index := (p.next + i) % len(p.keys)
+		key := p.keys[index]
+		if now.Before(key.cooldownUntil) {
+			continue
+		}
+		if picked == nil || (p.rotation == KeyRotationLeastThrottled && key.lastThrottled.Before(picked.lastThrottled)) {
+			picked, pickedIndex = key, index
+		}
+		if p.rotation == KeyRotationRoundRobin {
+			break
+		}
+	}
+
+	if picked == nil {
+		for index, key := range p.keys {
+			if picked == nil || key.cooldownUntil.Before(picked.cooldownUntil) {
+				picked, pickedIndex = key, index
+			}
+		}
+	}
+
+	p.next = (pickedIndex + 1) % len(p.keys)
+	picked.requests++
+	return picked.key
+}
+
+// Report records the provider's answer to a request made with key, rate limited
+// keys cool down until Retry-After and rejected keys for the auth cooldown
+func (p *KeyPool) Report(key string, statusCode int, header http.Header, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled := p.find(key)
+	if pooled == nil {
+		return
+	}
+
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		pooled.throttled++
+		pooled.lastThrottled = now
+		pooled.cooldownUntil = now.Add(p.cooldown)
+		if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+			pooled.cooldownUntil = retryAfter
+		}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		pooled.authFailures++
+		pooled.cooldownUntil = now.Add(p.authCooldown)
+	}
+}
+
+// Health returns the state of every key in pool order
+func (p *KeyPool) Health(now time.Time) []KeyHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make([]KeyHealth, 0, len(p.keys))
+	for _, key := range p.keys {
+		entry := KeyHealth{
+			Key:           maskKey(key.key),
+			Available:     !now.Before(key.cooldownUntil),
+			Requests:      key.requests,
+			Throttled:     key.throttled,
+			AuthFailures:  key.authFailures,
+			LastThrottled: key.lastThrottled,
+		}
+		if !entry.Available {
+			entry.CooldownUntil = key.cooldownUntil
+		}
+		health = append(health, entry)
+	}
+	return health
+}
+
+// Size number of distinct keys in the pool
+func (p *KeyPool) Size() int {
+	return len(p.keys)
+}
+
+// find returns the pooled entry of key, nil when it is not part of the pool
+func (p *KeyPool) find(key string) *pooledKey {
+	for _, pooled := range p.keys {
+		if pooled.key == key {
+			return pooled
+		}
+	}
+	return nil
+}
+
+// maskKey keep only a hint of a key for status output
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "********"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewKeyPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		primary  string
+		extra    []string
+		expected int
+	}{
+		{"primary only", "key-a", nil, 1},
+		{"primary and extra", "key-a", []string{"key-b", "key-c"}, 3},
+		{"extra only", "", []string{"key-b"}, 1},
+		{"duplicates dropped", "key-a", []string{"key-a", "", "key-b"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewKeyPool(tt.primary, KeyPoolConfig{APIKeys: tt.extra})
+			if pool.Size() != tt.expected {
+				t.Errorf("Expected %d keys, got %d", tt.expected, pool.Size())
+			}
+		})
+	}
+}
+
+func TestValidateKeyPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		config  KeyPoolConfig
+		wantErr bool
+	}{
+		{"primary key", "key-a", KeyPoolConfig{}, false},
+		{"pool only", "", KeyPoolConfig{APIKeys: []string{"key-b"}}, false},
+		{"no key", "", KeyPoolConfig{APIKeys: []string{""}}, true},
+		{"valid rotation", "key-a", KeyPoolConfig{KeyRotation: KeyRotationLeastThrottled}, false},
+		{"unknown rotation", "key-a", KeyPoolConfig{KeyRotation: "random"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateKeyPool(tt.primary, tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKeyPool_Acquire(t *testing.T) {
+	now := time.Now()
+	header := func(retryAfter string) http.Header {
+		h := http.Header{}
+		if retryAfter != "" {
+			h.Set("Retry-After", retryAfter)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name     string
+		rotation KeyRotation
+		setup    func(pool *KeyPool)
+		expected []string
+	}{
+		{
+			name:     "round robin",
+			rotation: KeyRotationRoundRobin,
+			expected: []string{"key-a", "key-b", "key-c", "key-a"},
+		},
+		{
+			name:     "rate limited key skipped",
+			rotation: KeyRotationRoundRobin,
+			setup: func(pool *KeyPool) {
+				pool.Report("key-b", http.StatusTooManyRequests, header(""), now)
+			},
+			expected: []string{"key-a", "key-c", "key-a"},
+		},
+		{
+			name:     "rejected key skipped",
+			rotation: KeyRotationRoundRobin,
+			setup: func(pool *KeyPool) {
+				pool.Report("key-a", http.StatusUnauthorized, header(""), now)
+			},
+			expected: []string{"key-b", "key-c", "key-b"},
+		},
+		{
+			name:     "retry after elapsed",
+			rotation: KeyRotationRoundRobin,
+			setup: func(pool *KeyPool) {
+				pool.Report("key-a", http.StatusTooManyRequests, header("0"), now)
+			},
+			expected: []string{"key-a", "key-b"},
+		},
+		{
+			name:     "all cooling uses first available",
+			rotation: KeyRotationRoundRobin,
+			setup: func(pool *KeyPool) {
+				pool.Report("key-a", http.StatusTooManyRequests, header("60"), now)
+				pool.Report("key-b", http.StatusTooManyRequests, header("10"), now)
+				pool.Report("key-c", http.StatusUnauthorized, header(""), now)
+			},
+			expected: []string{"key-b", "key-b"},
+		},
+		{
+			name:     "least recently throttled",
+			rotation: KeyRotationLeastThrottled,
+			setup: func(pool *KeyPool) {
+				pool.Report("key-a", http.StatusTooManyRequests, header("0"), now.Add(-time.Minute))
+				pool.Report("key-b", http.StatusTooManyRequests, header("0"), now.Add(-2*time.Minute))
+			},
+			expected: []string{"key-c", "key-c"},
+		},
+		{
+			name:     "oldest throttle preferred",
+			rotation: KeyRotationLeastThrottled,
+			setup: func(pool *KeyPool) {
+				pool.Report("key-a", http.StatusTooManyRequests, header("0"), now.Add(-time.Minute))
+				pool.Report("key-b", http.StatusTooManyRequests, header("0"), now.Add(-2*time.Minute))
+				pool.Report("key-c", http.StatusTooManyRequests, header("0"), now.Add(-30*time.Second))
+			},
+			expected: []string{"key-b", "key-b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewKeyPool("key-a", KeyPoolConfig{APIKeys: []string{"key-b", "key-c"}, KeyRotation: tt.rotation})
+			if tt.setup != nil {
+				tt.setup(pool)
+			}
+
+			for i, expected := range tt.expected {
+				if got := pool.Acquire(now); got != expected {
+					t.Errorf("Acquire %d: expected %s, got %s", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyPool_Health(t *testing.T) {
+	now := time.Now()
+	pool := NewKeyPool("sk-primary-0001", KeyPoolConfig{APIKeys: []string{"sk-secondary-0002"}})
+
+	pool.Acquire(now)
+	pool.Report("sk-primary-0001", http.StatusTooManyRequests, http.Header{}, now)
+
+	health := pool.Health(now)
+	if len(health) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(health))
+	}
+	if health[0].Key != "sk-p****0001" {
+		t.Errorf("Expected masked key, got %s", health[0].Key)
+	}
+	if health[0].Available || health[0].Throttled != 1 || health[0].Requests != 1 {
+		t.Errorf("Unexpected health for throttled key: %+v", health[0])
+	}
+	if !health[0].CooldownUntil.Equal(now.Add(DefaultKeyCooldown)) {
+		t.Errorf("Expected default cooldown, got %v", health[0].CooldownUntil)
+	}
+	if !health[1].Available || !health[1].CooldownUntil.IsZero() {
+		t.Errorf("Unexpected health for idle key: %+v", health[1])
+	}
+}
+
+func TestOpenAIAgent_KeyPoolFailover(t *testing.T) {
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		used = append(used, key)
+
+		w.Header().Set("Content-Type", "application/json")
+		if key == "revoked-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"invalid_api_key","message":"bad key","type":"auth"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"1","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	agent, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig:   AgentConfig{ID: "pooled", Name: "pooled", Type: AgentTypeOpenAI, Enabled: true},
+		BaseURL:       server.URL,
+		APIKey:        "revoked-key",
+		KeyPoolConfig: KeyPoolConfig{APIKeys: []string{"working-key"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	request := &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	if _, err := agent.Chat(context.Background(), request); err == nil {
+		t.Fatal("Expected the revoked key to fail")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := agent.Chat(context.Background(), request); err != nil {
+			t.Fatalf("Expected the working key to be used, got %v", err)
+		}
+	}
+
+	expected := []string{"revoked-key", "working-key", "working-key"}
+	if strings.Join(used, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected keys %v, got %v", expected, used)
+	}
+
+	keys := agent.keys.Health(time.Now())
+	if keys[0].Available || keys[0].AuthFailures != 1 {
+		t.Errorf("Expected the revoked key to be cooling down, got %+v", keys[0])
+	}
+}
@@ -3,7 +3,9 @@ package agent
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
+	"net/http"
 	"sort"
 	"sync"
 	"time"
@@ -18,9 +20,17 @@ type DefaultAgentManager struct {
 	// Load balancing state
 	roundRobinCounter int
 
+	// Last known agent statuses, nil when every call checks upstream
+	statusCache *StatusCache
+
 	// Health check
 	healthCheckTicker *time.Ticker
 	healthCheckStop   chan struct{}
+
+	// Replaced agents draining in the background; Close cancels the drains
+	retiring     sync.WaitGroup
+	retireCtx    context.Context
+	cancelRetire context.CancelFunc
 }
 
 // NewAgentManager creates a new agent manager
@@ -33,6 +43,10 @@ func NewAgentManager(config *AgentManagerConfig) (*DefaultAgentManager, error) {
 		config: config,
 		agents: make(map[string]Agent),
 	}
+	manager.retireCtx, manager.cancelRetire = context.WithCancel(context.Background())
+	if config.StatusCacheTTL > 0 {
+		manager.statusCache = NewStatusCache(config.StatusCacheTTL, config.StatusCacheJitter, config.DefaultTimeout)
+	}
 
 	// Start health checks if enabled
 	if config.EnableHealthChecks {
@@ -45,12 +59,16 @@ func NewAgentManager(config *AgentManagerConfig) (*DefaultAgentManager, error) {
 // DefaultAgentManagerConfig returns default configuration for agent manager
 func DefaultAgentManagerConfig() *AgentManagerConfig {
 	return &AgentManagerConfig{
-		LoadBalancingStrategy: Priority,
-		EnableHealthChecks:    true,
-		HealthCheckInterval:   DefaultHealthCheckInterval,
-		DefaultTimeout:        DefaultTimeout,
-		MaxRetries:            DefaultMaxRetries,
-		EnableMetrics:         true,
+		LoadBalancingStrategy:  Priority,
+		EnableHealthChecks:     true,
+		HealthCheckInterval:    DefaultHealthCheckInterval,
+		DefaultTimeout:         DefaultTimeout,
+		MaxRetries:             DefaultMaxRetries,
+		StatusCacheTTL:         DefaultStatusCacheTTL,
+		StatusCacheJitter:      DefaultStatusCacheJitter,
+		ProviderLimitThreshold: DefaultProviderLimitThreshold,
+		DrainTimeout:           DefaultDrainTimeout,
+		EnableMetrics:          true,
 	}
 }
 
@@ -105,10 +123,79 @@ func (m *DefaultAgentManager) UnregisterAgent(agentID string) error {
 
 	// Remove from map
 	delete(m.agents, agentID)
+	if m.statusCache != nil {
+		m.statusCache.Invalidate(agentID)
+	}
+
+	return nil
+}
+
+// UpdateAgent replaces a registered agent with a new instance of the same ID, e.g.
+// rebuilt after its configuration changed. The swap is atomic: lookups from then on get
+// the new instance, while calls already running on the old one finish on it. UpdateAgent
+// returns right after the swap; the old instance is drained in the background and closed
+// once its calls finished, or after DrainTimeout. Agents that do not implement Drainer
+// are closed right away. A caller that looked up the old instance but starts its call
+// only after the close gets ErrAgentClosed and can look it up again.
+func (m *DefaultAgentManager) UpdateAgent(agent Agent) error {
+	if agent == nil {
+		return fmt.Errorf("agent cannot be nil")
+	}
+
+	agentID := agent.GetID()
+	if agentID == "" {
+		return fmt.Errorf("agent ID cannot be empty")
+	}
+
+	// Validate agent configuration
+	if err := agent.ValidateConfig(); err != nil {
+		return fmt.Errorf("invalid agent configuration: %w", err)
+	}
+
+	m.mutex.Lock()
+	old, exists := m.agents[agentID]
+	if !exists {
+		m.mutex.Unlock()
+		return fmt.Errorf("agent with ID %s not found", agentID)
+	}
+	m.agents[agentID] = agent
+	m.mutex.Unlock()
+
+	if old == agent {
+		return nil
+	}
+
+	// The last status was found for the old instance
+	if m.statusCache != nil {
+		m.statusCache.Invalidate(agentID)
+	}
 
+	drainer, ok := old.(Drainer)
+	if !ok || m.config.DrainTimeout <= 0 {
+		if err := old.Close(); err != nil {
+			return fmt.Errorf("failed to close replaced agent: %w", err)
+		}
+		return nil
+	}
+
+	// Let the old instance finish its calls without holding up the caller; calls still
+	// running after DrainTimeout keep the HTTP client they started with
+	m.retiring.Add(1)
+	go func() {
+		defer m.retiring.Done()
+		ctx, cancel := context.WithTimeout(m.retireCtx, m.config.DrainTimeout)
+		drainer.Drain(ctx)
+		cancel()
+		old.Close()
+	}()
 	return nil
 }
 
+// waitRetired block until every replaced agent is drained and closed
+func (m *DefaultAgentManager) waitRetired() {
+	m.retiring.Wait()
+}
+
 // GetAgent retrieves an agent by ID
 func (m *DefaultAgentManager) GetAgent(agentID string) (Agent, error) {
 	if agentID == "" {
@@ -164,6 +251,8 @@ func (m *DefaultAgentManager) GetAvailableAgent(ctx context.Context, request *Ch
 	if len(healthyAgents) == 0 {
 		return nil, fmt.Errorf("no healthy agents available")
 	}
+	healthyAgents = m.belowProviderLimits(healthyAgents)
+	healthyAgents = m.withinLatencyBudget(healthyAgents)
 
 	// Apply load balancing strategy
 	switch m.config.LoadBalancingStrategy {
@@ -177,6 +266,8 @@ func (m *DefaultAgentManager) GetAvailableAgent(ctx context.Context, request *Ch
 		return m.leastConnectionsSelect(healthyAgents), nil
 	case WeightedRandom:
 		return m.weightedRandomSelect(healthyAgents), nil
+	case LeastLatency:
+		return m.leastLatencySelect(healthyAgents), nil
 	default:
 		return m.prioritySelect(healthyAgents), nil
 	}
@@ -190,6 +281,10 @@ func (m *DefaultAgentManager) Close() error {
 		close(m.healthCheckStop)
 	}
 
+	// Close replaced agents still draining without waiting for their calls
+	m.cancelRetire()
+	m.waitRetired()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -203,6 +298,9 @@ func (m *DefaultAgentManager) Close() error {
 
 	// Clear agents map
 	m.agents = make(map[string]Agent)
+	if m.statusCache != nil {
+		m.statusCache.Clear()
+	}
 
 	// Return combined error if any
 	if len(errors) > 0 {
@@ -218,7 +316,7 @@ func (m *DefaultAgentManager) getHealthyAgents(ctx context.Context) []agentWithC
 
 	for _, agent := range m.agents {
 		// Check agent status
-		status, err := agent.GetStatus(ctx)
+		status, err := m.agentStatus(ctx, agent)
 		if err != nil || !status.Health {
 			continue
 		}
@@ -229,6 +327,7 @@ func (m *DefaultAgentManager) getHealthyAgents(ctx context.Context) []agentWithC
 			healthyAgents = append(healthyAgents, agentWithConfig{
 				agent:  agent,
 				config: config,
+				status: status,
 			})
 		}
 	}
@@ -236,6 +335,15 @@ func (m *DefaultAgentManager) getHealthyAgents(ctx context.Context) []agentWithC
 	return healthyAgents
 }
 
+// agentStatus returns the cached status of the agent, or checks upstream when the
+// cache is off
+func (m *DefaultAgentManager) agentStatus(ctx context.Context, agent Agent) (*AgentStatus, error) {
+	if m.statusCache == nil {
+		return agent.GetStatus(ctx)
+	}
+	return m.statusCache.Get(ctx, agent)
+}
+
 // getAgentConfig extracts configuration from agent (type assertion)
 func (m *DefaultAgentManager) getAgentConfig(agent Agent) *AgentConfig {
 	switch a := agent.(type) {
@@ -335,6 +443,105 @@ func (m *DefaultAgentManager) weightedRandomSelect(agents []agentWithConfig) Age
 	return agents[len(agents)-1].agent
 }
 
+// leastLatencySelect picks two agents at random and returns the one with the lower
+// average response time; sampling two instead of taking the fastest keeps the
+// fastest agent from receiving all traffic until its latency degrades
+func (m *DefaultAgentManager) leastLatencySelect(agents []agentWithConfig) Agent {
+	if len(agents) == 0 {
+		return nil
+	}
+	if len(agents) == 1 {
+		return agents[0].agent
+	}
+
+	i := rand.Intn(len(agents))
+	j := rand.Intn(len(agents) - 1)
+	if j >= i {
+		j++
+	}
+
+	if fasterAgent(agents[j], agents[i]) {
+		return agents[j].agent
+	}
+	return agents[i].agent
+}
+
+// fasterAgent reports whether a should be preferred over b by latency; agents
+// without measurements are preferred so they receive traffic and get measured,
+// equal latencies fall back to priority
+func fasterAgent(a, b agentWithConfig) bool {
+	latencyA, latencyB := a.status.ResponseTime, b.status.ResponseTime
+	switch {
+	case latencyA == latencyB:
+		return a.config.Priority > b.config.Priority
+	case latencyA == 0:
+		return true
+	case latencyB == 0:
+		return false
+	default:
+		return latencyA < latencyB
+	}
+}
+
+// withinLatencyBudget filters out agents slower than the configured budget,
+// keeping all agents when none is within it
+func (m *DefaultAgentManager) withinLatencyBudget(agents []agentWithConfig) []agentWithConfig {
+	if m.config.LatencyBudget <= 0 {
+		return agents
+	}
+
+	budget := m.config.LatencyBudget.Milliseconds()
+	var within []agentWithConfig
+	for _, agent := range agents {
+		if agent.status.ResponseTime <= budget {
+			within = append(within, agent)
+		}
+	}
+
+	if len(within) == 0 {
+		return agents
+	}
+	return within
+}
+
+// belowProviderLimits filters out agents close to their provider rate limits,
+// keeping all agents when none has headroom left
+func (m *DefaultAgentManager) belowProviderLimits(agents []agentWithConfig) []agentWithConfig {
+	if m.config.ProviderLimitThreshold <= 0 {
+		return agents
+	}
+
+	now := time.Now()
+	var below []agentWithConfig
+	for _, agent := range agents {
+		reporter, ok := agent.agent.(ProviderLimitReporter)
+		if !ok {
+			below = append(below, agent)
+			continue
+		}
+		if limits := reporter.ProviderLimits(); limits == nil || limits.Usage(now) < m.config.ProviderLimitThreshold {
+			below = append(below, agent)
+		}
+	}
+
+	if len(below) == 0 {
+		return agents
+	}
+	return below
+}
+
+// responseTimeSmoothing weight of the newest sample in the rolling average
+const responseTimeSmoothing = 0.2
+
+// averageResponseTime exponentially weighted average of the response time, the
+// first sample initializes it
+func averageResponseTime(average, sample int64) int64 {
+	if average <= 0 {
+		return sample
+	}
+	return int64(math.Round(responseTimeSmoothing*float64(sample) + (1-responseTimeSmoothing)*float64(average)))
+}
+
 // Health check functionality
 
 // startHealthChecks starts periodic health checks
@@ -369,7 +576,12 @@ func (m *DefaultAgentManager) performHealthChecks() {
 	// Perform health checks concurrently
 	for _, agent := range agents {
 		go func(a Agent) {
-			_, err := a.GetStatus(ctx)
+			var err error
+			if m.statusCache != nil {
+				_, err = m.statusCache.Refresh(ctx, a)
+			} else {
+				_, err = a.GetStatus(ctx)
+			}
 			if err != nil {
 				// Log error or handle unhealthy agent
 				// This could trigger alerts, remove from rotation, etc.
@@ -378,12 +590,56 @@ func (m *DefaultAgentManager) performHealthChecks() {
 	}
 }
 
+// proxiedObserver is implemented by agents that learn from calls made on their behalf
+type proxiedObserver interface {
+	observeProxied(resp *http.Response, responseTime time.Duration, err error)
+}
+
+// ObserveResult records the outcome of a request a caller sent to the agent's upstream
+// itself, so request counts, success rate, response time, key cooldowns and provider
+// limits reflect that traffic as well. Server errors and transport errors count as failures.
+func (m *DefaultAgentManager) ObserveResult(agentID string, resp *http.Response, responseTime time.Duration, err error) error {
+	agent, getErr := m.GetAgent(agentID)
+	if getErr != nil {
+		return getErr
+	}
+	observer, ok := agent.(proxiedObserver)
+	if !ok {
+		return fmt.Errorf("agent %s does not record proxied requests", agentID)
+	}
+	observer.observeProxied(resp, responseTime, err)
+	return nil
+}
+
+// KnownStatus returns the last status the health checks found for the agent without
+// calling upstream, false when none is known yet or the status cache is off
+func (m *DefaultAgentManager) KnownStatus(agentID string) (*AgentStatus, bool) {
+	if m.statusCache == nil {
+		return nil, false
+	}
+	return m.statusCache.Peek(agentID)
+}
+
+// proxiedSuccess whether a proxied call reached an upstream that was not failing
+func proxiedSuccess(resp *http.Response, err error) bool {
+	return err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError
+}
+
+// proxiedError the error recorded for a failed proxied call
+func proxiedError(resp *http.Response, err error) error {
+	if err != nil || resp == nil || resp.StatusCode < http.StatusInternalServerError {
+		return err
+	}
+	return fmt.Errorf("HTTP error: %s", resp.Status)
+}
+
 // Helper types
 
 // agentWithConfig combines agent with its configuration for load balancing
 type agentWithConfig struct {
 	agent  Agent
 	config *AgentConfig
+	status *AgentStatus
 }
 
 // AgentInfo represents agent information for management
@@ -403,7 +659,7 @@ func (m *DefaultAgentManager) GetAgentInfo(ctx context.Context, agentID string)
 		return nil, err
 	}
 
-	status, err := agent.GetStatus(ctx)
+	status, err := m.agentStatus(ctx, agent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get agent status: %w", err)
 	}
@@ -444,6 +700,9 @@ type AgentMetrics struct {
 	AverageResponse time.Duration `json:"average_response_time"`
 	LastRequest     time.Time     `json:"last_request"`
 	Uptime          time.Duration `json:"uptime"`
+
+	// Endpoints per endpoint latency and failures of multi-region agents
+	Endpoints []EndpointHealth `json:"endpoints,omitempty"`
 }
 
 // GetAgentMetrics returns metrics for a specific agent
@@ -453,7 +712,7 @@ func (m *DefaultAgentManager) GetAgentMetrics(ctx context.Context, agentID strin
 		return nil, err
 	}
 
-	status, err := agent.GetStatus(ctx)
+	status, err := m.agentStatus(ctx, agent)
 	if err != nil {
 		return nil, err
 	}
@@ -465,6 +724,7 @@ func (m *DefaultAgentManager) GetAgentMetrics(ctx context.Context, agentID strin
 		SuccessRate:     status.SuccessRate,
 		AverageResponse: time.Duration(status.ResponseTime) * time.Millisecond,
 		LastRequest:     status.LastChecked,
+		Endpoints:       status.Endpoints,
 		// Uptime calculation would require tracking start time
 	}, nil
 }
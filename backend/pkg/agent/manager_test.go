@@ -2,9 +2,11 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -438,6 +440,7 @@ func TestAgentManager_LoadBalancingStrategies(t *testing.T) {
 		Random,
 		WeightedRandom,
 		LeastConnections,
+		LeastLatency,
 	}
 
 	for _, strategy := range strategies {
@@ -495,6 +498,202 @@ func TestAgentManager_LoadBalancingStrategies(t *testing.T) {
 	}
 }
 
+// latencyAgent creates an agent candidate with the given average response time
+func latencyAgent(t *testing.T, id string, responseTime int64, priority int) agentWithConfig {
+	t.Helper()
+
+	agent, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{
+			ID:       id,
+			Name:     id,
+			Type:     AgentTypeOpenAI,
+			Enabled:  true,
+			Priority: priority,
+		},
+		BaseURL: "http://localhost",
+		APIKey:  "test-key",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	return agentWithConfig{
+		agent:  agent,
+		config: &agent.config.AgentConfig,
+		status: &AgentStatus{AgentID: id, Health: true, ResponseTime: responseTime},
+	}
+}
+
+func TestAgentManager_LeastLatencySelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		latency  [2]int64
+		priority [2]int
+		expected string
+	}{
+		{"faster agent wins", [2]int64{300, 120}, [2]int{50, 50}, "agent-1"},
+		{"unmeasured agent wins", [2]int64{80, 0}, [2]int{50, 50}, "agent-1"},
+		{"tie falls back to priority", [2]int64{100, 100}, [2]int{90, 10}, "agent-0"},
+	}
+
+	manager, err := NewAgentManager(&AgentManagerConfig{LoadBalancingStrategy: LeastLatency})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agents := []agentWithConfig{
+				latencyAgent(t, "agent-0", tt.latency[0], tt.priority[0]),
+				latencyAgent(t, "agent-1", tt.latency[1], tt.priority[1]),
+			}
+
+			// With two candidates both are always sampled, so the choice is deterministic
+			for i := 0; i < 20; i++ {
+				selected := manager.leastLatencySelect(agents)
+				if selected.GetID() != tt.expected {
+					t.Fatalf("Expected %s, got %s", tt.expected, selected.GetID())
+				}
+			}
+		})
+	}
+}
+
+func TestAgentManager_LeastLatencySelectNeverPicksSlowest(t *testing.T) {
+	manager, err := NewAgentManager(&AgentManagerConfig{LoadBalancingStrategy: LeastLatency})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+
+	agents := []agentWithConfig{
+		latencyAgent(t, "fast", 50, 50),
+		latencyAgent(t, "medium", 200, 50),
+		latencyAgent(t, "slow", 900, 50),
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		counts[manager.leastLatencySelect(agents).GetID()]++
+	}
+
+	if counts["slow"] != 0 {
+		t.Errorf("Expected the slowest agent never to win a comparison, got %d selections", counts["slow"])
+	}
+	if counts["fast"] <= counts["medium"] {
+		t.Errorf("Expected the fastest agent to be selected most often, got %v", counts)
+	}
+}
+
+func TestAgentManager_WithinLatencyBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   time.Duration
+		latency  []int64
+		expected int
+	}{
+		{"budget disabled", 0, []int64{100, 5000}, 2},
+		{"slow agent excluded", time.Second, []int64{100, 5000}, 1},
+		{"unmeasured agent kept", time.Second, []int64{0, 5000}, 1},
+		{"all over budget keeps all", time.Second, []int64{2000, 5000}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, err := NewAgentManager(&AgentManagerConfig{LatencyBudget: tt.budget})
+			if err != nil {
+				t.Fatalf("NewAgentManager failed: %v", err)
+			}
+
+			var agents []agentWithConfig
+			for i, latency := range tt.latency {
+				agents = append(agents, latencyAgent(t, fmt.Sprintf("agent-%d", i), latency, 50))
+			}
+
+			if got := manager.withinLatencyBudget(agents); len(got) != tt.expected {
+				t.Errorf("Expected %d agents within budget, got %d", tt.expected, len(got))
+			}
+		})
+	}
+}
+
+func TestAverageResponseTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		average  int64
+		sample   int64
+		expected int64
+	}{
+		{"first sample", 0, 250, 250},
+		{"slower sample", 100, 600, 200},
+		{"faster sample", 500, 0, 400},
+		{"steady", 120, 120, 120},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := averageResponseTime(tt.average, tt.sample); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAgentManager_ObserveResult(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+
+	manager, err := NewAgentManager(&AgentManagerConfig{DefaultTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+	agent, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{ID: "proxied", Name: "Proxied", Type: AgentTypeOpenAI},
+		BaseURL:     server.URL,
+		APIKey:      "test-key",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	if err := manager.RegisterAgent(agent); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	results := []struct {
+		resp *http.Response
+		err  error
+	}{
+		{resp: &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}},
+		{resp: &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}}},
+		{resp: &http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway", Header: http.Header{}}},
+		{err: fmt.Errorf("connection refused")},
+	}
+	for _, result := range results {
+		if err := manager.ObserveResult("proxied", result.resp, 100*time.Millisecond, result.err); err != nil {
+			t.Fatalf("ObserveResult failed: %v", err)
+		}
+	}
+
+	agent.statusMu.RLock()
+	status := *agent.status
+	agent.statusMu.RUnlock()
+	if status.RequestCount != 4 || status.ErrorCount != 2 {
+		t.Errorf("RequestCount = %d, ErrorCount = %d, want 4 and 2", status.RequestCount, status.ErrorCount)
+	}
+	if status.SuccessRate != 50 {
+		t.Errorf("SuccessRate = %v, want 50", status.SuccessRate)
+	}
+	if status.ResponseTime != 100 {
+		t.Errorf("ResponseTime = %d, want 100", status.ResponseTime)
+	}
+	if status.Health {
+		t.Error("Expected the agent to be unhealthy after a failed call")
+	}
+
+	if err := manager.ObserveResult("unknown", nil, 0, nil); err == nil {
+		t.Error("Expected an error for an unknown agent")
+	}
+}
+
 func TestAgentManager_Close(t *testing.T) {
 	server := createMockServer()
 	defer server.Close()
@@ -609,6 +808,365 @@ func TestAgentManager_EmptyManagerBehavior(t *testing.T) {
 	}
 }
 
+// newUpdateTestAgent creates an OpenAI agent against the server, key tells instances apart
+func newUpdateTestAgent(t *testing.T, serverURL, key string) *OpenAIAgent {
+	t.Helper()
+	agent, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{
+			ID:      "test-agent",
+			Name:    "Test Agent",
+			Type:    AgentTypeOpenAI,
+			Enabled: true,
+		},
+		BaseURL: serverURL,
+		APIKey:  key,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	return agent
+}
+
+func TestAgentManager_UpdateAgent(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+
+	manager, err := NewAgentManager(nil)
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+	defer manager.Close()
+
+	old := newUpdateTestAgent(t, server.URL, "old-key")
+	if err := manager.RegisterAgent(old); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	updated := newUpdateTestAgent(t, server.URL, "new-key")
+	if err := manager.UpdateAgent(updated); err != nil {
+		t.Fatalf("UpdateAgent failed: %v", err)
+	}
+
+	got, err := manager.GetAgent("test-agent")
+	if err != nil {
+		t.Fatalf("GetAgent failed: %v", err)
+	}
+	if got != Agent(updated) {
+		t.Error("Expected GetAgent to return the new instance")
+	}
+	if len(manager.ListAgents()) != 1 {
+		t.Errorf("Expected 1 agent after update, got %d", len(manager.ListAgents()))
+	}
+
+	// the old instance is closed once drained
+	manager.waitRetired()
+	status, _ := old.GetStatus(context.Background())
+	if status.Health {
+		t.Error("Expected the replaced agent to be closed")
+	}
+	if _, err := old.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}}); !errors.Is(err, ErrAgentClosed) {
+		t.Errorf("Expected ErrAgentClosed from the replaced agent, got %v", err)
+	}
+
+	// updating with the registered instance is a no-op
+	if err := manager.UpdateAgent(updated); err != nil {
+		t.Errorf("UpdateAgent with the same instance failed: %v", err)
+	}
+	if status, _ := updated.GetStatus(context.Background()); !status.Health {
+		t.Error("Expected the registered instance to stay open")
+	}
+
+	if err := manager.UpdateAgent(nil); err == nil {
+		t.Error("Expected error for nil agent")
+	}
+	unknown, _ := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{ID: "unknown", Name: "Unknown", Type: AgentTypeOpenAI},
+		BaseURL:     server.URL,
+		APIKey:      "key",
+	})
+	if err := manager.UpdateAgent(unknown); err == nil {
+		t.Error("Expected error for updating an unregistered agent")
+	}
+	if _, err := manager.GetAgent("unknown"); err == nil {
+		t.Error("Expected UpdateAgent not to register an unknown agent")
+	}
+}
+
+// gatedServer answers chat completions once release is closed and reports each
+// request that arrived on started
+func gatedServer(started chan<- string, release <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"object": "list", "data": []}`))
+			return
+		}
+
+		started <- r.Header.Get("Authorization")
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-3.5-turbo",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello!"}, "finish_reason": "stop"}]}`))
+	}))
+}
+
+func TestAgentManager_UpdateAgentDrainsInFlightCalls(t *testing.T) {
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	server := gatedServer(started, release)
+	defer server.Close()
+
+	manager, err := NewAgentManager(&AgentManagerConfig{DrainTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+	defer manager.Close()
+
+	old := newUpdateTestAgent(t, server.URL, "old-key")
+	if err := manager.RegisterAgent(old); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	// a call on the old instance is in flight when the update comes in
+	chatErr := make(chan error, 1)
+	go func() {
+		held, _ := manager.GetAgent("test-agent")
+		_, err := held.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+		chatErr <- err
+	}()
+	if key := <-started; key != "Bearer old-key" {
+		t.Fatalf("Expected the call on the old instance, got key %q", key)
+	}
+
+	// the swap returns at once, the close waits for the call in the background
+	updated := newUpdateTestAgent(t, server.URL, "new-key")
+	if err := manager.UpdateAgent(updated); err != nil {
+		t.Fatalf("UpdateAgent failed: %v", err)
+	}
+	if got, _ := manager.GetAgent("test-agent"); got != Agent(updated) {
+		t.Fatal("Expected the new instance to be swapped in while the old one drains")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := old.calls.inFlight(); n != 1 {
+		t.Errorf("Expected 1 call in flight on the old instance, got %d", n)
+	}
+	if status, _ := old.GetStatus(context.Background()); !status.Health {
+		t.Error("Expected the draining agent to stay open until its call finished")
+	}
+
+	close(release)
+	if err := <-chatErr; err != nil {
+		t.Errorf("Expected the in-flight call to succeed, got %v", err)
+	}
+	manager.waitRetired()
+	if status, _ := old.GetStatus(context.Background()); status.Health {
+		t.Error("Expected the drained agent to be closed")
+	}
+}
+
+func TestAgentManager_UpdateAgentDrainsStreams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\": \"1\", \"choices\": [{\"index\": 0, \"delta\": {\"content\": \"Hi\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	manager, err := NewAgentManager(&AgentManagerConfig{DrainTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+	defer manager.Close()
+
+	old := newUpdateTestAgent(t, server.URL, "old-key")
+	if err := manager.RegisterAgent(old); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	// the stream counts as in flight until it is read, its buffered events keep the
+	// reader from finishing before the update
+	stream, err := old.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if err := manager.UpdateAgent(newUpdateTestAgent(t, server.URL, "new-key")); err != nil {
+		t.Fatalf("UpdateAgent failed: %v", err)
+	}
+
+	var content string
+	for event := range stream.Events {
+		if event.Delta != nil {
+			content += event.Delta.Content
+		}
+	}
+	if content != "Hi" {
+		t.Errorf("Expected the stream to be read to the end, got %q", content)
+	}
+	manager.waitRetired()
+	if n := old.calls.inFlight(); n != 0 {
+		t.Errorf("Expected no call in flight after the stream ended, got %d", n)
+	}
+}
+
+func TestAgentManager_UpdateAgentDrainTimeout(t *testing.T) {
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	server := gatedServer(started, release)
+	defer server.Close()
+	defer close(release)
+
+	manager, err := NewAgentManager(&AgentManagerConfig{DrainTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+	defer manager.Close()
+
+	old := newUpdateTestAgent(t, server.URL, "old-key")
+	if err := manager.RegisterAgent(old); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+	go old.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+	<-started
+
+	start := time.Now()
+	if err := manager.UpdateAgent(newUpdateTestAgent(t, server.URL, "new-key")); err != nil {
+		t.Fatalf("UpdateAgent failed: %v", err)
+	}
+	manager.waitRetired()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the drain to give up after the timeout, took %v", elapsed)
+	}
+	if status, _ := old.GetStatus(context.Background()); status.Health {
+		t.Error("Expected the agent to be closed after the drain timeout")
+	}
+}
+
+func TestAgentManager_CloseCancelsDrains(t *testing.T) {
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	server := gatedServer(started, release)
+	defer server.Close()
+	defer close(release)
+
+	manager, err := NewAgentManager(&AgentManagerConfig{DrainTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+
+	old := newUpdateTestAgent(t, server.URL, "old-key")
+	if err := manager.RegisterAgent(old); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+	go old.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+	<-started
+
+	// neither the update nor the close waits out the drain timeout
+	start := time.Now()
+	if err := manager.UpdateAgent(newUpdateTestAgent(t, server.URL, "new-key")); err != nil {
+		t.Fatalf("UpdateAgent failed: %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected UpdateAgent and Close to return without draining, took %v", elapsed)
+	}
+	if status, _ := old.GetStatus(context.Background()); status.Health {
+		t.Error("Expected Close to close the draining agent")
+	}
+}
+
+func TestAgentManager_UpdateAgentUnderLoad(t *testing.T) {
+	var served sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Store(r.Header.Get("Authorization"), true)
+		time.Sleep(2 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-3.5-turbo",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello!"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	config := DefaultAgentManagerConfig()
+	config.EnableHealthChecks = false
+	manager, err := NewAgentManager(config)
+	if err != nil {
+		t.Fatalf("NewAgentManager failed: %v", err)
+	}
+	defer manager.Close()
+
+	if err := manager.RegisterAgent(newUpdateTestAgent(t, server.URL, "key-0")); err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	const workers = 8
+	const swaps = 20
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var calls int
+	var failures []error
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := &ChatRequest{Messages: []Message{{Role: "user", Content: "Hi"}}}
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// a lookup racing a swap may get an instance closed before the call
+				// starts, which never reaches upstream and is retried on the new one
+				var err error
+				for attempt := 0; attempt < 2; attempt++ {
+					var agent Agent
+					if agent, err = manager.GetAvailableAgent(context.Background(), request); err == nil {
+						_, err = agent.Chat(context.Background(), request)
+					}
+					if !errors.Is(err, ErrAgentClosed) {
+						break
+					}
+				}
+				mu.Lock()
+				calls++
+				if err != nil {
+					failures = append(failures, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 1; i <= swaps; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if err := manager.UpdateAgent(newUpdateTestAgent(t, server.URL, fmt.Sprintf("key-%d", i))); err != nil {
+			t.Fatalf("UpdateAgent %d failed: %v", i, err)
+		}
+	}
+	// the swaps return without draining, give the last instance time to serve
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := served.Load(fmt.Sprintf("Bearer key-%d", swaps)); ok {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		t.Errorf("Expected no call to fail during %d swaps, %d of %d failed, first: %v", swaps, len(failures), calls, failures[0])
+	}
+	if len(manager.ListAgents()) != 1 {
+		t.Errorf("Expected 1 agent after the swaps, got %d", len(manager.ListAgents()))
+	}
+	if _, ok := served.Load(fmt.Sprintf("Bearer key-%d", swaps)); !ok {
+		t.Error("Expected the last instance to serve calls")
+	}
+}
+
 func BenchmarkAgentManager_GetAvailableAgent(b *testing.B) {
 	server := createMockServer()
 	defer server.Close()
@@ -18,7 +18,11 @@ type OpenAIAgent struct {
 	config     *OpenAIConfig
 	httpClient *http.Client
 	status     *AgentStatus
-	statusMu   sync.RWMutex // Mutex to protect status field
+	keys       *KeyPool
+	endpoints  *EndpointSet
+	limits     ProviderLimits
+	statusMu   sync.RWMutex // Mutex to protect status and limits fields
+	calls      callTracker  // calls in flight, drained before a replaced agent is closed
 }
 
 // OpenAIConfig represents configuration for OpenAI compatible agents
@@ -31,6 +35,12 @@ type OpenAIConfig struct {
 	// APIKey is the API key for authentication
 	APIKey string `json:"api_key"`
 
+	// KeyPoolConfig additional keys rotated with APIKey
+	KeyPoolConfig
+
+	// Endpoints regional base URLs failed over to, in order, after BaseURL
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
 	// Organization is the organization ID (optional)
 	Organization string `json:"organization,omitempty"`
 
@@ -59,14 +69,14 @@ func NewOpenAIAgent(config *OpenAIConfig) (*OpenAIAgent, error) {
 	// Set defaults
 	setOpenAIDefaults(config)
 
-	// Create HTTP client with timeout
-	httpClient := &http.Client{
-		Timeout: config.Timeout,
-	}
+	// Calls are bounded by the agent's timeouts, not by the client
+	httpClient := newUpstreamClient(&config.AgentConfig)
 
 	agent := &OpenAIAgent{
 		config:     config,
 		httpClient: httpClient,
+		keys:       NewKeyPool(config.APIKey, config.KeyPoolConfig),
+		endpoints:  NewEndpointSet(config.BaseURL, config.Endpoints),
 		status: &AgentStatus{
 			AgentID:     config.ID,
 			Status:      "initializing",
@@ -85,19 +95,27 @@ func validateOpenAIConfig(config *OpenAIConfig) error {
 	}
 
 	if config.ID == "" {
-		return fmt.Errorf("agent ID is required")
+		return &FieldError{Field: "id", Message: "agent ID is required"}
+	}
+
+	if err := validateBaseURL(config.BaseURL); err != nil {
+		return err
+	}
+
+	if err := validateKeyPool(config.APIKey, config.KeyPoolConfig); err != nil {
+		return err
 	}
 
-	if config.BaseURL == "" {
-		return fmt.Errorf("base URL is required")
+	if err := validateEndpoints(config.Endpoints); err != nil {
+		return err
 	}
 
-	if config.APIKey == "" {
-		return fmt.Errorf("API key is required")
+	if err := validateTimeouts(&config.AgentConfig); err != nil {
+		return err
 	}
 
 	if !config.Type.IsValid() {
-		return fmt.Errorf("invalid agent type: %s", config.Type)
+		return &FieldError{Field: "type", Message: fmt.Sprintf("invalid agent type: %s", config.Type)}
 	}
 
 	return nil
@@ -113,9 +131,7 @@ func setOpenAIDefaults(config *OpenAIConfig) {
 		config.Type = AgentTypeOpenAI
 	}
 
-	if config.Timeout == 0 {
-		config.Timeout = DefaultTimeout
-	}
+	setTimeoutDefaults(&config.AgentConfig)
 
 	if config.MaxConcurrentRequests == 0 {
 		config.MaxConcurrentRequests = DefaultMaxConcurrentRequests
@@ -173,11 +189,13 @@ func (a *OpenAIAgent) GetCapabilities() AgentCapabilities {
 
 // Chat sends a chat message and returns the response
 func (a *OpenAIAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	defer a.calls.begin()()
+
 	// Prepare OpenAI request
 	openaiReq := a.prepareOpenAIRequest(request)
 
 	// Make HTTP request
-	resp, err := a.makeRequest(ctx, "/v1/chat/completions", openaiReq)
+	resp, err := a.makeRequest(ctx, "/v1/chat/completions", openaiReq, false)
 	if err != nil {
 		a.updateStatus(false, err)
 		return nil, err
@@ -193,11 +211,7 @@ func (a *OpenAIAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatResp
 
 	// Check for API errors
 	if openaiResp.Error != nil {
-		agentErr := &AgentError{
-			Code:    openaiResp.Error.Code,
-			Message: openaiResp.Error.Message,
-			Type:    openaiResp.Error.Type,
-		}
+		agentErr := NewAgentError(resp.StatusCode, openaiResp.Error.Code, openaiResp.Error.Type, openaiResp.Error.Message)
 		a.updateStatus(false, agentErr)
 		return nil, agentErr
 	}
@@ -211,6 +225,9 @@ func (a *OpenAIAgent) Chat(ctx context.Context, request *ChatRequest) (*ChatResp
 
 // ChatStream sends a chat message and returns a streaming response
 func (a *OpenAIAgent) ChatStream(ctx context.Context, request *ChatRequest) (*ChatStreamResponse, error) {
+	// the call lasts until the stream is read to the end or closed
+	done := a.calls.begin()
+
 	// Set stream to true
 	streamReq := *request
 	streamReq.Stream = true
@@ -219,8 +236,9 @@ func (a *OpenAIAgent) ChatStream(ctx context.Context, request *ChatRequest) (*Ch
 	openaiReq := a.prepareOpenAIRequest(&streamReq)
 
 	// Make streaming HTTP request
-	resp, err := a.makeRequest(ctx, "/v1/chat/completions", openaiReq)
+	resp, err := a.makeRequest(ctx, "/v1/chat/completions", openaiReq, true)
 	if err != nil {
+		done()
 		a.updateStatus(false, err)
 		return nil, err
 	}
@@ -230,7 +248,10 @@ func (a *OpenAIAgent) ChatStream(ctx context.Context, request *ChatRequest) (*Ch
 	errors := make(chan error, 1)
 
 	// Start streaming goroutine
-	go a.handleStreamResponse(resp.Body, events, errors)
+	go func() {
+		defer done()
+		a.handleStreamResponse(resp.Body, events, errors)
+	}()
 
 	return &ChatStreamResponse{
 		Stream: resp.Body,
@@ -241,8 +262,10 @@ func (a *OpenAIAgent) ChatStream(ctx context.Context, request *ChatRequest) (*Ch
 
 // GetModels returns available models for this agent
 func (a *OpenAIAgent) GetModels(ctx context.Context) ([]Model, error) {
+	defer a.calls.begin()()
+
 	// Make request to models endpoint
-	resp, err := a.makeRequest(ctx, "/v1/models", nil)
+	resp, err := a.makeRequest(ctx, "/v1/models", nil, false)
 	if err != nil {
 		return nil, err
 	}
@@ -284,6 +307,8 @@ func (a *OpenAIAgent) ValidateConfig() error {
 
 // GetStatus returns the current status of the agent
 func (a *OpenAIAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	defer a.calls.begin()()
+
 	// Check if agent is closed (read-only check first)
 	a.statusMu.RLock()
 	isClosed := a.httpClient == nil
@@ -295,6 +320,8 @@ func (a *OpenAIAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
 		a.status.Status = "inactive"
 		a.status.LastChecked = time.Now()
 		statusCopy := *a.status
+		statusCopy.Keys = a.keys.Health(time.Now())
+		statusCopy.Endpoints = a.endpoints.Health(time.Now())
 		a.statusMu.Unlock()
 		return &statusCopy, nil
 	}
@@ -319,9 +346,16 @@ func (a *OpenAIAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
 
 	a.status.LastChecked = time.Now()
 	statusCopy := *a.status
+	statusCopy.Keys = a.keys.Health(time.Now())
+	statusCopy.Endpoints = a.endpoints.Health(time.Now())
 	return &statusCopy, nil
 }
 
+// Drain waits until the agent has no calls in flight, or until ctx is done
+func (a *OpenAIAgent) Drain(ctx context.Context) error {
+	return a.calls.wait(ctx)
+}
+
 // Close cleans up resources used by the agent
 func (a *OpenAIAgent) Close() error {
 	a.statusMu.Lock()
@@ -329,7 +363,8 @@ func (a *OpenAIAgent) Close() error {
 
 	// Close HTTP client if needed
 	if a.httpClient != nil {
-		// HTTP client doesn't need explicit closing
+		// the agent has a transport of its own
+		a.httpClient.CloseIdleConnections()
 		a.httpClient = nil
 	}
 
@@ -385,7 +420,7 @@ func (a *OpenAIAgent) getModel(model string) string {
 }
 
 // makeRequest makes an HTTP request to the OpenAI API
-func (a *OpenAIAgent) makeRequest(ctx context.Context, endpoint string, body interface{}) (*http.Response, error) {
+func (a *OpenAIAgent) makeRequest(ctx context.Context, endpoint string, body interface{}, stream bool) (*http.Response, error) {
 	// Get httpClient safely
 	a.statusMu.RLock()
 	client := a.httpClient
@@ -393,28 +428,64 @@ func (a *OpenAIAgent) makeRequest(ctx context.Context, endpoint string, body int
 
 	// Check if agent is closed
 	if client == nil {
-		return nil, fmt.Errorf("agent is closed")
+		return nil, ErrAgentClosed
 	}
 
-	url := strings.TrimSuffix(a.config.BaseURL, "/") + endpoint
-
-	var reqBody io.Reader
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
+	}
+
+	resp, err := a.endpoints.Do(ctx, func(baseURL string) (*http.Response, error) {
+		return a.send(ctx, client, stream, strings.TrimSuffix(baseURL, "/")+endpoint, jsonBody)
+	})
+	if err != nil {
+		return nil, TransportError(err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errorResp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+				Type    string `json:"type"`
+			} `json:"error"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
+			return nil, NewAgentError(resp.StatusCode, errorResp.Error.Code, errorResp.Error.Type, errorResp.Error.Message)
+		}
+
+		return nil, NewAgentError(resp.StatusCode, "", "", "HTTP error: "+resp.Status)
+	}
+
+	return resp, nil
+}
+
+// send makes one attempt against a single endpoint
+func (a *OpenAIAgent) send(ctx context.Context, client *http.Client, stream bool, url string, jsonBody []byte) (*http.Response, error) {
+	var reqBody io.Reader
+	if jsonBody != nil {
 		reqBody = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, reqBody)
+	callCtx, watchdog := startWatchdog(ctx, &a.config.AgentConfig, stream)
+	req, err := http.NewRequestWithContext(callCtx, "POST", url, reqBody)
 	if err != nil {
+		watchdog.stop()
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+a.config.APIKey)
+	apiKey := a.keys.Acquire(time.Now())
+	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	// Add organization header if provided
 	if a.config.Organization != "" {
@@ -428,41 +499,50 @@ func (a *OpenAIAgent) makeRequest(ctx context.Context, endpoint string, body int
 
 	// Make request
 	startTime := time.Now()
-	resp, err := client.Do(req)
+	resp, err := watchdog.response(client.Do(req))
 	responseTime := time.Since(startTime).Milliseconds()
 
 	// Update response time in status (thread-safe)
 	a.statusMu.Lock()
-	a.status.ResponseTime = responseTime
+	a.status.ResponseTime = averageResponseTime(a.status.ResponseTime, responseTime)
+	if resp != nil {
+		a.limits.Update(resp.Header, time.Now())
+	}
 	a.statusMu.Unlock()
 
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if resp != nil {
+		a.keys.Report(apiKey, resp.StatusCode, resp.Header, time.Now())
 	}
+	return resp, err
+}
 
-	// Check for HTTP errors
-	if resp.StatusCode >= 400 {
-		defer resp.Body.Close()
-		var errorResp struct {
-			Error struct {
-				Code    string `json:"code"`
-				Message string `json:"message"`
-				Type    string `json:"type"`
-			} `json:"error"`
-		}
+// ProviderLimits returns the rate limits OpenAI reported, nil before any were seen
+func (a *OpenAIAgent) ProviderLimits() *ProviderLimits {
+	a.statusMu.RLock()
+	defer a.statusMu.RUnlock()
 
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-			return nil, &AgentError{
-				Code:    errorResp.Error.Code,
-				Message: errorResp.Error.Message,
-				Type:    errorResp.Error.Type,
-			}
-		}
+	if a.limits.UpdatedAt.IsZero() {
+		return nil
+	}
+	limits := a.limits
+	return &limits
+}
 
-		return nil, fmt.Errorf("HTTP error: %s", resp.Status)
+// observeProxied records a call to the upstream made with the agent's API key outside
+// the agent, e.g. by a proxy forwarding requests as they are
+func (a *OpenAIAgent) observeProxied(resp *http.Response, responseTime time.Duration, err error) {
+	now := time.Now()
+	a.statusMu.Lock()
+	a.status.ResponseTime = averageResponseTime(a.status.ResponseTime, responseTime.Milliseconds())
+	if resp != nil {
+		a.limits.Update(resp.Header, now)
 	}
+	a.statusMu.Unlock()
 
-	return resp, nil
+	if resp != nil {
+		a.keys.Report(a.config.APIKey, resp.StatusCode, resp.Header, now)
+	}
+	a.updateStatus(proxiedSuccess(resp, err), proxiedError(resp, err))
 }
 
 // handleStreamResponse handles streaming response
@@ -551,7 +631,7 @@ func (a *OpenAIAgent) convertStreamChunk(chunk *openAIStreamChunk) *StreamEvent
 // healthCheck performs a health check on the agent
 func (a *OpenAIAgent) healthCheck(ctx context.Context) error {
 	// Simple health check by calling the models endpoint
-	resp, err := a.makeRequest(ctx, "/v1/models", nil)
+	resp, err := a.makeRequest(ctx, "/v1/models", nil, false)
 	if err != nil {
 		return err
 	}
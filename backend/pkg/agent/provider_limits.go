@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// providerLimitsMaxAge how long limits without a reported reset time are trusted
+const providerLimitsMaxAge = time.Minute
+
+// ProviderLimits rate limit capacity the provider reported with its latest
+// responses, zero limits mean the provider did not report that dimension
+type ProviderLimits struct {
+	LimitRequests     int       `json:"limit_requests,omitempty"`
+	RemainingRequests int       `json:"remaining_requests,omitempty"`
+	ResetRequests     time.Time `json:"reset_requests,omitempty"`
+	LimitTokens       int       `json:"limit_tokens,omitempty"`
+	RemainingTokens   int       `json:"remaining_tokens,omitempty"`
+	ResetTokens       time.Time `json:"reset_tokens,omitempty"`
+
+	// RetryAfter the provider asked for no requests before this time
+	RetryAfter time.Time `json:"retry_after,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ProviderLimitReporter is implemented by agents that track provider rate limits
+type ProviderLimitReporter interface {
+	// ProviderLimits returns the latest reported limits, nil when none are known
+	ProviderLimits() *ProviderLimits
+}
+
+// Update merges the rate limit headers of a provider response, dimensions the
+// response does not mention keep their previous values. It reports whether any
+// rate limit header was present.
+func (l *ProviderLimits) Update(header http.Header, now time.Time) bool {
+	updated := false
+
+	if limit, remaining, reset, ok := parseLimitHeaders(header, "requests", now); ok {
+		l.LimitRequests, l.RemainingRequests, l.ResetRequests = limit, remaining, reset
+		updated = true
+	}
+	if limit, remaining, reset, ok := parseLimitHeaders(header, "tokens", now); ok {
+		l.LimitTokens, l.RemainingTokens, l.ResetTokens = limit, remaining, reset
+		updated = true
+	}
+	if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+		l.RetryAfter = retryAfter
+		updated = true
+	}
+
+	if updated {
+		l.UpdatedAt = now
+	}
+	return updated
+}
+
+// Usage share of the provider limit in use between 0 and 1, the highest of the
+// request and token dimensions. It is 1 while a Retry-After is pending and
+// ignores dimensions whose window has reset since they were reported.
+func (l *ProviderLimits) Usage(now time.Time) float64 {
+	if now.Before(l.RetryAfter) {
+		return 1
+	}
+
+	usage := 0.0
+	if l.LimitRequests > 0 && l.current(l.ResetRequests, now) {
+		usage = max(usage, 1-float64(l.RemainingRequests)/float64(l.LimitRequests))
+	}
+	if l.LimitTokens > 0 && l.current(l.ResetTokens, now) {
+		usage = max(usage, 1-float64(l.RemainingTokens)/float64(l.LimitTokens))
+	}
+	return min(max(usage, 0), 1)
+}
+
+// current reports whether a dimension reported with the given reset time still applies
+func (l *ProviderLimits) current(reset, now time.Time) bool {
+	if reset.IsZero() {
+		return now.Sub(l.UpdatedAt) < providerLimitsMaxAge
+	}
+	return now.Before(reset)
+}
+
+// parseLimitHeaders reads the x-ratelimit-* headers of one dimension, the limit
+// and remaining headers are required
+func parseLimitHeaders(header http.Header, dimension string, now time.Time) (int, int, time.Time, bool) {
+	limit, err := strconv.Atoi(header.Get("X-Ratelimit-Limit-" + dimension))
+	if err != nil || limit <= 0 {
+		return 0, 0, time.Time{}, false
+	}
+	remaining, err := strconv.Atoi(header.Get("X-Ratelimit-Remaining-" + dimension))
+	if err != nil || remaining < 0 {
+		return 0, 0, time.Time{}, false
+	}
+
+	var reset time.Time
+	if d, err := time.ParseDuration(header.Get("X-Ratelimit-Reset-" + dimension)); err == nil && d >= 0 {
+		reset = now.Add(d)
+	}
+	return limit, remaining, reset, true
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date, true
+	}
+	return time.Time{}, false
+}
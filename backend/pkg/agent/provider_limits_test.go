@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProviderLimits_Update(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		updated  bool
+		expected ProviderLimits
+	}{
+		{
+			name:    "no headers",
+			headers: map[string]string{},
+			updated: false,
+		},
+		{
+			name: "requests and tokens",
+			headers: map[string]string{
+				"x-ratelimit-limit-requests":     "60",
+				"x-ratelimit-remaining-requests": "59",
+				"x-ratelimit-reset-requests":     "1s",
+				"x-ratelimit-limit-tokens":       "150000",
+				"x-ratelimit-remaining-tokens":   "149984",
+				"x-ratelimit-reset-tokens":       "6m0s",
+			},
+			updated: true,
+			expected: ProviderLimits{
+				LimitRequests: 60, RemainingRequests: 59, ResetRequests: now.Add(time.Second),
+				LimitTokens: 150000, RemainingTokens: 149984, ResetTokens: now.Add(6 * time.Minute),
+				UpdatedAt: now,
+			},
+		},
+		{
+			name: "unparseable reset",
+			headers: map[string]string{
+				"x-ratelimit-limit-requests":     "60",
+				"x-ratelimit-remaining-requests": "0",
+				"x-ratelimit-reset-requests":     "soon",
+			},
+			updated:  true,
+			expected: ProviderLimits{LimitRequests: 60, UpdatedAt: now},
+		},
+		{
+			name:    "missing remaining ignored",
+			headers: map[string]string{"x-ratelimit-limit-tokens": "1000"},
+			updated: false,
+		},
+		{
+			name:     "retry after seconds",
+			headers:  map[string]string{"Retry-After": "20"},
+			updated:  true,
+			expected: ProviderLimits{RetryAfter: now.Add(20 * time.Second), UpdatedAt: now},
+		},
+		{
+			name:     "retry after date",
+			headers:  map[string]string{"Retry-After": now.Add(time.Minute).Format(http.TimeFormat)},
+			updated:  true,
+			expected: ProviderLimits{RetryAfter: now.Add(time.Minute), UpdatedAt: now},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+
+			var limits ProviderLimits
+			if updated := limits.Update(header, now); updated != tt.updated {
+				t.Fatalf("Expected updated %v, got %v", tt.updated, updated)
+			}
+			if limits != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, limits)
+			}
+		})
+	}
+}
+
+func TestProviderLimits_UpdateKeepsUnreportedDimensions(t *testing.T) {
+	now := time.Now()
+	limits := ProviderLimits{LimitTokens: 1000, RemainingTokens: 10, UpdatedAt: now}
+
+	header := http.Header{}
+	header.Set("Retry-After", "5")
+	limits.Update(header, now)
+
+	if limits.LimitTokens != 1000 || limits.RemainingTokens != 10 {
+		t.Errorf("Expected token limits to be kept, got %+v", limits)
+	}
+}
+
+func TestProviderLimits_Usage(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		limits   ProviderLimits
+		expected float64
+	}{
+		{"nothing reported", ProviderLimits{UpdatedAt: now}, 0},
+		{"requests", ProviderLimits{LimitRequests: 100, RemainingRequests: 25, ResetRequests: now.Add(time.Second), UpdatedAt: now}, 0.75},
+		{"highest dimension wins", ProviderLimits{
+			LimitRequests: 100, RemainingRequests: 90, ResetRequests: now.Add(time.Second),
+			LimitTokens: 1000, RemainingTokens: 50, ResetTokens: now.Add(time.Second),
+			UpdatedAt: now,
+		}, 0.95},
+		{"window reset", ProviderLimits{LimitRequests: 100, RemainingRequests: 0, ResetRequests: now.Add(-time.Second), UpdatedAt: now}, 0},
+		{"no reset recent", ProviderLimits{LimitTokens: 100, RemainingTokens: 50, UpdatedAt: now}, 0.5},
+		{"no reset stale", ProviderLimits{LimitTokens: 100, RemainingTokens: 0, UpdatedAt: now.Add(-2 * providerLimitsMaxAge)}, 0},
+		{"retry after pending", ProviderLimits{RetryAfter: now.Add(time.Second), UpdatedAt: now}, 1},
+		{"retry after passed", ProviderLimits{RetryAfter: now.Add(-time.Second), UpdatedAt: now}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.Usage(now); got != tt.expected {
+				t.Errorf("Expected usage %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOpenAIAgent_ProviderLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-limit-requests", "10")
+		w.Header().Set("x-ratelimit-remaining-requests", "0")
+		w.Header().Set("x-ratelimit-reset-requests", "30s")
+		w.Header().Set("Retry-After", "30")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"rate_limit_exceeded","message":"slow down","type":"requests"}}`))
+	}))
+	defer server.Close()
+
+	agent := limitedAgent(t, "limited", server.URL)
+	if agent.ProviderLimits() != nil {
+		t.Fatal("Expected no provider limits before the first response")
+	}
+
+	_, err := agent.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if err == nil {
+		t.Fatal("Expected rate limited error")
+	}
+
+	limits := agent.ProviderLimits()
+	if limits == nil {
+		t.Fatal("Expected provider limits after a rate limited response")
+	}
+	if limits.LimitRequests != 10 || limits.RemainingRequests != 0 {
+		t.Errorf("Unexpected request limits: %+v", limits)
+	}
+	if usage := limits.Usage(time.Now()); usage != 1 {
+		t.Errorf("Expected usage 1, got %v", usage)
+	}
+}
+
+func TestAgentManager_BelowProviderLimits(t *testing.T) {
+	now := time.Now()
+	exhausted := ProviderLimits{LimitTokens: 1000, RemainingTokens: 20, ResetTokens: now.Add(time.Minute), UpdatedAt: now}
+	plenty := ProviderLimits{LimitTokens: 1000, RemainingTokens: 900, ResetTokens: now.Add(time.Minute), UpdatedAt: now}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		limits    []ProviderLimits
+		expected  int
+	}{
+		{"threshold disabled", 0, []ProviderLimits{exhausted, plenty}, 2},
+		{"exhausted agent skipped", 0.9, []ProviderLimits{exhausted, plenty}, 1},
+		{"unreported agent kept", 0.9, []ProviderLimits{exhausted, {}}, 1},
+		{"all exhausted keeps all", 0.9, []ProviderLimits{exhausted, exhausted}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, err := NewAgentManager(&AgentManagerConfig{ProviderLimitThreshold: tt.threshold})
+			if err != nil {
+				t.Fatalf("NewAgentManager failed: %v", err)
+			}
+
+			var agents []agentWithConfig
+			for i, limits := range tt.limits {
+				candidate := latencyAgent(t, fmt.Sprintf("agent-%d", i), 100, 50)
+				candidate.agent.(*OpenAIAgent).limits = limits
+				agents = append(agents, candidate)
+			}
+
+			if got := manager.belowProviderLimits(agents); len(got) != tt.expected {
+				t.Errorf("Expected %d agents below provider limits, got %d", tt.expected, len(got))
+			}
+		})
+	}
+}
+
+// limitedAgent creates an OpenAI agent talking to the given server
+func limitedAgent(t *testing.T, id, baseURL string) *OpenAIAgent {
+	t.Helper()
+
+	agent, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{ID: id, Name: id, Type: AgentTypeOpenAI, Enabled: true},
+		BaseURL:     baseURL,
+		APIKey:      "test-key",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	return agent
+}
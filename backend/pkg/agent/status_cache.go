@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// statusEntry last known status of one agent
+type statusEntry struct {
+	status     *AgentStatus
+	err        error
+	staleAt    time.Time
+	refreshing bool
+	ready      chan struct{} // closed once the first status is known
+}
+
+// StatusCache serves agent statuses with stale-while-revalidate semantics: a known
+// status is returned right away, and once it is older than the TTL a single
+// background call refreshes it. The TTL of every refresh is jittered so agents that
+// went stale together do not all call upstream at the same moment.
+type StatusCache struct {
+	ttl            time.Duration
+	jitter         float64
+	refreshTimeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*statusEntry
+}
+
+// NewStatusCache creates a status cache; jitter is the fraction of the TTL a refresh
+// may come earlier or later, refreshTimeout bounds each upstream status call
+func NewStatusCache(ttl time.Duration, jitter float64, refreshTimeout time.Duration) *StatusCache {
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	if refreshTimeout <= 0 {
+		refreshTimeout = DefaultTimeout
+	}
+	return &StatusCache{
+		ttl:            ttl,
+		jitter:         jitter,
+		refreshTimeout: refreshTimeout,
+		entries:        make(map[string]*statusEntry),
+	}
+}
+
+// Get returns the last known status of the agent. Only the first call for an agent
+// waits for upstream, concurrent first calls share that one request.
+func (c *StatusCache) Get(ctx context.Context, agent Agent) (*AgentStatus, error) {
+	agentID := agent.GetID()
+
+	c.mu.Lock()
+	entry, ok := c.entries[agentID]
+	if !ok {
+		entry = &statusEntry{refreshing: true, ready: make(chan struct{})}
+		c.entries[agentID] = entry
+		go c.refresh(agent, entry)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !entry.refreshing && time.Now().After(entry.staleAt) {
+		entry.refreshing = true
+		go c.refresh(agent, entry)
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	status := *entry.status
+	return &status, nil
+}
+
+// Refresh fetches the status from upstream now and stores it
+func (c *StatusCache) Refresh(ctx context.Context, agent Agent) (*AgentStatus, error) {
+	status, err := agent.GetStatus(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[agent.GetID()]
+	if !ok {
+		entry = &statusEntry{ready: make(chan struct{})}
+		c.entries[agent.GetID()] = entry
+		close(entry.ready)
+	}
+	c.store(entry, status, err)
+	return status, err
+}
+
+// Peek returns the known status of the agent without calling upstream or refreshing it,
+// false while the first status is pending or when it failed
+func (c *StatusCache) Peek(agentID string) (*AgentStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[agentID]
+	if !ok || entry.status == nil || entry.err != nil {
+		return nil, false
+	}
+	status := *entry.status
+	return &status, true
+}
+
+// Invalidate drops the cached status of the agent
+func (c *StatusCache) Invalidate(agentID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, agentID)
+}
+
+// Clear drops all cached statuses
+func (c *StatusCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*statusEntry)
+}
+
+// refresh fetches the status in the background and releases the waiting callers
+func (c *StatusCache) refresh(agent Agent, entry *statusEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.refreshTimeout)
+	defer cancel()
+
+	status, err := agent.GetStatus(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store(entry, status, err)
+	entry.refreshing = false
+	select {
+	case <-entry.ready:
+	default:
+		close(entry.ready)
+	}
+}
+
+// store records a fetched status, the caller holds the lock
+func (c *StatusCache) store(entry *statusEntry, status *AgentStatus, err error) {
+	if err == nil && status == nil {
+		status = &AgentStatus{}
+	}
+	if err == nil {
+		copied := *status
+		entry.status = &copied
+	}
+	entry.err = err
+	entry.staleAt = time.Now().Add(c.jitteredTTL())
+}
+
+// jitteredTTL the TTL moved by a random amount of up to jitter in either direction
+func (c *StatusCache) jitteredTTL() time.Duration {
+	if c.jitter == 0 {
+		return c.ttl
+	}
+	spread := float64(c.ttl) * c.jitter
+	return c.ttl + time.Duration((rand.Float64()*2-1)*spread)
+}
@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusAgent counts the upstream status calls, release blocks them until closed
+type statusAgent struct {
+	Agent
+	id      string
+	calls   int32
+	healthy atomic.Bool
+	release chan struct{}
+	err     error
+}
+
+func newStatusAgent(id string) *statusAgent {
+	a := &statusAgent{id: id}
+	a.healthy.Store(true)
+	return a
+}
+
+func (a *statusAgent) GetID() string { return a.id }
+
+func (a *statusAgent) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	atomic.AddInt32(&a.calls, 1)
+	if a.release != nil {
+		<-a.release
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &AgentStatus{AgentID: a.id, Health: a.healthy.Load(), LastChecked: time.Now()}, nil
+}
+
+func (a *statusAgent) callCount() int {
+	return int(atomic.LoadInt32(&a.calls))
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStatusCache_ConcurrentFirstGet(t *testing.T) {
+	cache := NewStatusCache(time.Minute, 0, time.Second)
+	agent := newStatusAgent("agent-1")
+	agent.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := cache.Get(context.Background(), agent)
+			if err == nil && !status.Health {
+				err = errors.New("expected healthy status")
+			}
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool { return agent.callCount() == 1 })
+	close(agent.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+	}
+	if got := agent.callCount(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
+
+func TestStatusCache_ServesStaleWhileRevalidating(t *testing.T) {
+	cache := NewStatusCache(20*time.Millisecond, 0, time.Second)
+	agent := newStatusAgent("agent-1")
+
+	if _, err := cache.Get(context.Background(), agent); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	// within the TTL nothing goes upstream
+	if _, err := cache.Get(context.Background(), agent); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := agent.callCount(); got != 1 {
+		t.Fatalf("upstream calls = %d, want 1", got)
+	}
+
+	// once stale the old status comes back right away while one refresh runs
+	time.Sleep(30 * time.Millisecond)
+	agent.healthy.Store(false)
+	agent.release = make(chan struct{})
+	for i := 0; i < 5; i++ {
+		status, err := cache.Get(context.Background(), agent)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if !status.Health {
+			t.Fatal("Get() returned the refreshed status before the refresh finished")
+		}
+	}
+	waitFor(t, func() bool { return agent.callCount() == 2 })
+	close(agent.release)
+
+	waitFor(t, func() bool {
+		status, err := cache.Get(context.Background(), agent)
+		return err == nil && !status.Health
+	})
+	if got := agent.callCount(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestStatusCache_Errors(t *testing.T) {
+	cache := NewStatusCache(time.Minute, 0, time.Second)
+	agent := newStatusAgent("agent-1")
+	agent.err = errors.New("upstream down")
+
+	if _, err := cache.Get(context.Background(), agent); err == nil {
+		t.Error("Get() error = nil, want the upstream error")
+	}
+
+	agent.err = nil
+	if _, err := cache.Refresh(context.Background(), agent); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, err := cache.Get(context.Background(), agent); err != nil {
+		t.Errorf("Get() after Refresh() error = %v", err)
+	}
+}
+
+func TestStatusCache_GetHonoursContext(t *testing.T) {
+	cache := NewStatusCache(time.Minute, 0, time.Second)
+	agent := newStatusAgent("agent-1")
+	agent.release = make(chan struct{})
+	defer close(agent.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cache.Get(ctx, agent); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStatusCache_Invalidate(t *testing.T) {
+	cache := NewStatusCache(time.Minute, 0, time.Second)
+	agent := newStatusAgent("agent-1")
+
+	cache.Get(context.Background(), agent)
+	cache.Invalidate("agent-1")
+	cache.Get(context.Background(), agent)
+
+	if got := agent.callCount(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestStatusCache_JitteredTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		jitter float64
+		min    time.Duration
+		max    time.Duration
+	}{
+		{name: "No jitter", ttl: 10 * time.Second, jitter: 0, min: 10 * time.Second, max: 10 * time.Second},
+		{name: "20 percent", ttl: 10 * time.Second, jitter: 0.2, min: 8 * time.Second, max: 12 * time.Second},
+		{name: "Clamped to the TTL", ttl: 10 * time.Second, jitter: 3, min: 0, max: 20 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewStatusCache(tt.ttl, tt.jitter, time.Second)
+			for i := 0; i < 100; i++ {
+				if got := cache.jitteredTTL(); got < tt.min || got > tt.max {
+					t.Fatalf("jitteredTTL() = %v, want between %v and %v", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusCache_Peek(t *testing.T) {
+	cache := NewStatusCache(time.Minute, 0, time.Second)
+	agent := newStatusAgent("agent-1")
+
+	if _, ok := cache.Peek("agent-1"); ok {
+		t.Fatal("Peek found a status before any was fetched")
+	}
+
+	agent.healthy.Store(false)
+	if _, err := cache.Refresh(context.Background(), agent); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	status, ok := cache.Peek("agent-1")
+	if !ok || status.Health {
+		t.Fatalf("Peek = %+v, %v, want the unhealthy status", status, ok)
+	}
+	if agent.callCount() != 1 {
+		t.Errorf("Peek called upstream, %d calls", agent.callCount())
+	}
+
+	failing := newStatusAgent("agent-2")
+	failing.err = errors.New("status unavailable")
+	cache.Refresh(context.Background(), failing)
+	if _, ok := cache.Peek("agent-2"); ok {
+		t.Error("Peek returned the status of a failed refresh")
+	}
+}
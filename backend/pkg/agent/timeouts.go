@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of an upstream call an agent timeout expires in
+const (
+	TimeoutPhaseConnect    = "connect"     // opening the connection
+	TimeoutPhaseFirstByte  = "first_byte"  // waiting for the response headers
+	TimeoutPhaseStreamIdle = "stream_idle" // silence between two chunks of a stream
+	TimeoutPhaseTotal      = "total"       // the whole call, streams excluded
+)
+
+// TimeoutError an upstream call aborted by one of the agent's timeouts. It is an
+// ErrUpstreamTimeout; errors.As tells in which phase the call stalled.
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("agent upstream %s timeout after %s", strings.ReplaceAll(e.Phase, "_", " "), e.Timeout)
+}
+
+// Unwrap the error kind
+func (e *TimeoutError) Unwrap() error {
+	return ErrUpstreamTimeout
+}
+
+// validateTimeouts the timeouts of an agent must not be negative
+func validateTimeouts(config *AgentConfig) error {
+	timeouts := []struct {
+		field string
+		value time.Duration
+	}{
+		{"timeout", config.Timeout},
+		{"connect_timeout", config.ConnectTimeout},
+		{"first_byte_timeout", config.FirstByteTimeout},
+		{"stream_idle_timeout", config.StreamIdleTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			return &FieldError{Field: timeout.field, Message: fmt.Sprintf("%s must not be negative", timeout.field)}
+		}
+	}
+	return nil
+}
+
+// setTimeoutDefaults fill in the timeouts left at zero; the first byte timeout defaults
+// to the request timeout so a stream does not wait longer for its start than a blocking
+// call for its end
+func setTimeoutDefaults(config *AgentConfig) {
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = DefaultConnectTimeout
+	}
+	if config.FirstByteTimeout == 0 {
+		config.FirstByteTimeout = config.Timeout
+	}
+	if config.StreamIdleTimeout == 0 {
+		config.StreamIdleTimeout = DefaultStreamIdleTimeout
+	}
+}
+
+// newUpstreamClient the HTTP client of an agent. It has no overall timeout, which would
+// cut long streams short; every call is bounded by a callWatchdog instead, and dialing
+// by the connect timeout.
+func newUpstreamClient(config *AgentConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: config.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			var netErr net.Error
+			if err != nil && ctx.Err() == nil && errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, &TimeoutError{Phase: TimeoutPhaseConnect, Timeout: config.ConnectTimeout}
+			}
+			return conn, err
+		}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// callWatchdog the timers of one upstream call. The first byte timer runs until the
+// response headers arrived; a stream then gets the idle timer, restarted by every chunk,
+// and any other call the total timer, running until its body is closed. An expired
+// timer cancels the call, which then fails with a TimeoutError.
+type callWatchdog struct {
+	cancel context.CancelFunc
+	idle   time.Duration
+
+	mu        sync.Mutex
+	firstByte *time.Timer
+	total     *time.Timer
+	idleTimer *time.Timer
+	expired   *TimeoutError
+}
+
+// startWatchdog watch a call of an agent, the returned context carries the request
+func startWatchdog(parent context.Context, config *AgentConfig, stream bool) (context.Context, *callWatchdog) {
+	ctx, cancel := context.WithCancel(parent)
+	w := &callWatchdog{cancel: cancel}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if config.FirstByteTimeout > 0 {
+		w.firstByte = w.after(TimeoutPhaseFirstByte, config.FirstByteTimeout)
+	}
+	if stream {
+		w.idle = config.StreamIdleTimeout
+	} else if config.Timeout > 0 {
+		w.total = w.after(TimeoutPhaseTotal, config.Timeout)
+	}
+	return ctx, w
+}
+
+// after a timer expiring the call in phase
+func (w *callWatchdog) after(phase string, timeout time.Duration) *time.Timer {
+	return time.AfterFunc(timeout, func() {
+		w.mu.Lock()
+		if w.expired == nil {
+			w.expired = &TimeoutError{Phase: phase, Timeout: timeout}
+		}
+		w.mu.Unlock()
+		w.cancel()
+	})
+}
+
+// wrap the error of a call aborted by the watchdog as its TimeoutError
+func (w *callWatchdog) wrap(err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired != nil {
+		return w.expired
+	}
+	return err
+}
+
+// response the result of sending the request: the first byte timer stops, and the body
+// of a response is watched until it is closed
+func (w *callWatchdog) response(resp *http.Response, err error) (*http.Response, error) {
+	w.mu.Lock()
+	if w.firstByte != nil {
+		w.firstByte.Stop()
+	}
+	if err == nil && w.idle > 0 && w.expired == nil {
+		w.idleTimer = w.after(TimeoutPhaseStreamIdle, w.idle)
+	}
+	w.mu.Unlock()
+
+	if err != nil {
+		w.stop()
+		return resp, w.wrap(err)
+	}
+	resp.Body = &watchedBody{body: resp.Body, watchdog: w}
+	return resp, nil
+}
+
+// chunk data arrived on a stream, restart the idle timer
+func (w *callWatchdog) chunk() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.idleTimer != nil && w.expired == nil {
+		w.idleTimer.Reset(w.idle)
+	}
+}
+
+// stop the timers and release the call's context
+func (w *callWatchdog) stop() {
+	w.mu.Lock()
+	for _, timer := range []*time.Timer{w.firstByte, w.total, w.idleTimer} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	w.mu.Unlock()
+	w.cancel()
+}
+
+// watchedBody a response body whose reads fail with the TimeoutError of its call once
+// the watchdog expired
+type watchedBody struct {
+	body      io.ReadCloser
+	watchdog  *callWatchdog
+	closeOnce sync.Once
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.watchdog.chunk()
+	}
+	if err != nil && err != io.EOF {
+		err = b.watchdog.wrap(err)
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	err := b.body.Close()
+	b.closeOnce.Do(b.watchdog.stop)
+	return err
+}
@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTimeoutTestAgent an OpenAI agent against handler with the given timeouts
+func newTimeoutTestAgent(t *testing.T, handler http.HandlerFunc, timeouts AgentConfig) *OpenAIAgent {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	timeouts.ID = "test-timeouts"
+	timeouts.Type = AgentTypeOpenAI
+	agent, err := NewOpenAIAgent(&OpenAIConfig{AgentConfig: timeouts, BaseURL: server.URL, APIKey: "test-key"})
+	if err != nil {
+		t.Fatalf("NewOpenAIAgent failed: %v", err)
+	}
+	return agent
+}
+
+// streamChunks write n chunks of a chat completion stream, pause between them
+func streamChunks(w http.ResponseWriter, n int, pause time.Duration) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(w, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"%d\"}}]}\n\n", i)
+		w.(http.Flusher).Flush()
+		time.Sleep(pause)
+	}
+	io.WriteString(w, "data: [DONE]\n\n")
+}
+
+// drainStream read every event of a stream, returning the stream error
+func drainStream(stream *ChatStreamResponse) (int, error) {
+	events := 0
+	for range stream.Events {
+		events++
+	}
+	return events, <-stream.Errors
+}
+
+func TestTimeout_FirstByte(t *testing.T) {
+	agent := newTimeoutTestAgent(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}, AgentConfig{Timeout: 5 * time.Second, FirstByteTimeout: 50 * time.Millisecond})
+
+	_, err := agent.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != TimeoutPhaseFirstByte {
+		t.Fatalf("Expected a first byte TimeoutError, got %v", err)
+	}
+	if !errors.Is(err, ErrUpstreamTimeout) || ErrorCode(err) != ErrorCodeUpstreamTimeout {
+		t.Errorf("Expected an ErrUpstreamTimeout, got %v (code %q)", err, ErrorCode(err))
+	}
+}
+
+func TestTimeout_StreamIdle(t *testing.T) {
+	agent := newTimeoutTestAgent(t, func(w http.ResponseWriter, r *http.Request) {
+		streamChunks(w, 1, 0)
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}, AgentConfig{StreamIdleTimeout: 50 * time.Millisecond})
+
+	stream, err := agent.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	events, err := drainStream(stream)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != TimeoutPhaseStreamIdle {
+		t.Fatalf("Expected a stream idle TimeoutError, got %v", err)
+	}
+	if events != 1 {
+		t.Errorf("Expected the chunk before the stall, got %d events", events)
+	}
+}
+
+func TestTimeout_StreamOutlivesRequestTimeout(t *testing.T) {
+	// chunks keep the stream alive past the request timeout, which only bounds blocking calls
+	agent := newTimeoutTestAgent(t, func(w http.ResponseWriter, r *http.Request) {
+		streamChunks(w, 6, 30*time.Millisecond)
+	}, AgentConfig{Timeout: 100 * time.Millisecond, StreamIdleTimeout: 100 * time.Millisecond})
+
+	stream, err := agent.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	events, err := drainStream(stream)
+	if err != nil {
+		t.Fatalf("Expected the stream to complete, got %v", err)
+	}
+	if events != 7 {
+		t.Errorf("Expected 6 chunks and done, got %d events", events)
+	}
+}
+
+func TestTimeout_Total(t *testing.T) {
+	agent := newTimeoutTestAgent(t, func(w http.ResponseWriter, r *http.Request) {
+		// headers in time, the body too late
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}, AgentConfig{Timeout: 50 * time.Millisecond, FirstByteTimeout: time.Second})
+
+	_, err := agent.Chat(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != TimeoutPhaseTotal {
+		t.Fatalf("Expected a total TimeoutError, got %v", err)
+	}
+}
+
+func TestTimeout_CallerCancel(t *testing.T) {
+	agent := newTimeoutTestAgent(t, func(w http.ResponseWriter, r *http.Request) {
+		// the server notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}, AgentConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := agent.Chat(ctx, &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		t.Errorf("Expected the caller's deadline, not an agent timeout: %v", err)
+	}
+}
+
+func TestTimeout_Defaults(t *testing.T) {
+	config := &AgentConfig{Timeout: 20 * time.Second}
+	setTimeoutDefaults(config)
+
+	if config.ConnectTimeout != DefaultConnectTimeout {
+		t.Errorf("ConnectTimeout = %v, want %v", config.ConnectTimeout, DefaultConnectTimeout)
+	}
+	if config.FirstByteTimeout != 20*time.Second {
+		t.Errorf("FirstByteTimeout = %v, want the request timeout", config.FirstByteTimeout)
+	}
+	if config.StreamIdleTimeout != DefaultStreamIdleTimeout {
+		t.Errorf("StreamIdleTimeout = %v, want %v", config.StreamIdleTimeout, DefaultStreamIdleTimeout)
+	}
+}
+
+func TestTimeout_Negative(t *testing.T) {
+	_, err := NewOpenAIAgent(&OpenAIConfig{
+		AgentConfig: AgentConfig{ID: "test", Type: AgentTypeOpenAI, StreamIdleTimeout: -time.Second},
+		BaseURL:     "https://api.openai.com",
+		APIKey:      "test-key",
+	})
+
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "stream_idle_timeout" {
+		t.Errorf("Expected a stream_idle_timeout field error, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package authclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"agent-connector/pkg/serviceauth"
+)
+
+var (
+	// ErrEmptyToken is returned when no token is provided
+	ErrEmptyToken = errors.New("token cannot be empty")
+
+	// ErrTokenInactive is returned by Validate when the token is unknown, expired or its user is not active
+	ErrTokenInactive = errors.New("token is not active")
+)
+
+// Introspection represents the result of a token introspection
+type Introspection struct {
+	Active          bool       `json:"active"`
+	UserID          uint       `json:"user_id,omitempty"`
+	Username        string     `json:"username,omitempty"`
+	Email           string     `json:"email,omitempty"`
+	Role            string     `json:"role,omitempty"`
+	Status          string     `json:"status,omitempty"`
+	CanManageUsers  bool       `json:"can_manage_users,omitempty"`
+	CanManageSystem bool       `json:"can_manage_system,omitempty"`
+	IssuedAt        *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn       int64      `json:"expires_in,omitempty"`
+	ImpersonatorID  uint       `json:"impersonator_id,omitempty"`
+	ImpersonatedBy  string     `json:"impersonated_by,omitempty"`
+}
+
+// IsImpersonated reports whether the token was issued to an admin acting as the user
+func (i *Introspection) IsImpersonated() bool {
+	return i != nil && i.ImpersonatorID != 0
+}
+
+// HasRole reports whether the token owner has one of the given roles
+func (i *Introspection) HasRole(roles ...string) bool {
+	if i == nil || !i.Active {
+		return false
+	}
+
+	for _, role := range roles {
+		if i.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientInfo the client that presented a token, forwarded so the auth API can check
+// sessions bound to their client
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// Config represents the configuration of the auth API client
+type Config struct {
+	// BaseURL is the base URL of the auth API, e.g. http://localhost:8083
+	BaseURL string
+
+	// Timeout is the timeout of a single introspection call
+	Timeout time.Duration
+
+	// HTTPClient overrides the default HTTP client (optional)
+	HTTPClient *http.Client
+
+	// ServiceIssuer authenticates the calling service (optional); when set the client
+	// uses the internal introspection route, which requires a service token
+	ServiceIssuer *serviceauth.Issuer
+}
+
+// Client calls the auth API on behalf of other services
+type Client struct {
+	baseURL        string
+	introspectPath string
+	httpClient     *http.Client
+}
+
+// envelope is the common response structure of the auth API
+type envelope struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// NewClient creates a new auth API client
+func NewClient(config *Config) (*Client, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	if config.BaseURL == "" {
+		return nil, fmt.Errorf("base URL cannot be empty")
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	introspectPath := "/api/v1/auth/introspect"
+	httpClient := config.HTTPClient
+	if config.ServiceIssuer != nil {
+		introspectPath = "/api/v1/internal/introspect"
+		if httpClient == nil {
+			httpClient = serviceauth.NewHTTPClient(config.ServiceIssuer, serviceauth.ServiceAuthAPI, timeout)
+		}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: timeout}
+	}
+
+	return &Client{
+		baseURL:        strings.TrimRight(config.BaseURL, "/"),
+		introspectPath: introspectPath,
+		httpClient:     httpClient,
+	}, nil
+}
+
+// Introspect asks the auth API about a session token, inactive tokens are not an error
+func (c *Client) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	return c.IntrospectFor(ctx, token, nil)
+}
+
+// IntrospectFor asks the auth API about a session token presented by client, a token
+// bound to another client is inactive
+func (c *Client) IntrospectFor(ctx context.Context, token string, client *ClientInfo) (*Introspection, error) {
+	token = TokenFromHeader(token)
+	if token == "" {
+		return nil, ErrEmptyToken
+	}
+
+	request := map[string]string{"token": token}
+	if client != nil && client.IP != "" {
+		request["client_ip"] = client.IP
+		request["user_agent"] = client.UserAgent
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+c.introspectPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call auth API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result envelope
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil {
+			return nil, fmt.Errorf("auth API error (status %d): %s", resp.StatusCode, result.Error.Message)
+		}
+		return nil, fmt.Errorf("auth API error (status %d): %s", resp.StatusCode, result.Message)
+	}
+
+	var introspection Introspection
+	if err := json.Unmarshal(result.Data, &introspection); err != nil {
+		return nil, fmt.Errorf("failed to parse introspection: %w", err)
+	}
+
+	return &introspection, nil
+}
+
+// Validate introspects the token and returns ErrTokenInactive if it is not active
+func (c *Client) Validate(ctx context.Context, token string) (*Introspection, error) {
+	introspection, err := c.Introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !introspection.Active {
+		return nil, ErrTokenInactive
+	}
+
+	return introspection, nil
+}
+
+// TokenFromHeader extracts the token from an Authorization header value
+func TokenFromHeader(header string) string {
+	header = strings.TrimSpace(header)
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}
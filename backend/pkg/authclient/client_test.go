@@ -0,0 +1,227 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-connector/pkg/serviceauth"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/auth/introspect" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch req["token"] {
+		case "bound-token":
+			if req["client_ip"] != "203.0.113.7" || req["user_agent"] != "curl/8.0" {
+				w.Write([]byte(`{"code":200,"message":"Token is not active","data":{"active":false}}`))
+				return
+			}
+			w.Write([]byte(`{"code":200,"message":"Token is active","data":{"active":true,"user_id":7,"username":"alice","role":"user","status":"active","expires_in":3600}}`))
+		case "valid-token":
+			w.Write([]byte(`{"code":200,"message":"Token is active","data":{"active":true,"user_id":7,"username":"alice","role":"operator","status":"active","can_manage_system":true,"expires_in":3600}}`))
+		case "impersonated-token":
+			w.Write([]byte(`{"code":200,"message":"Token is active","data":{"active":true,"user_id":7,"username":"alice","role":"user","status":"active","impersonator_id":1,"impersonated_by":"admin","expires_in":900}}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code":500,"message":"Failed to introspect token","error":{"type":"database_error","code":"500","message":"database error: connection refused"}}`))
+		default:
+			w.Write([]byte(`{"code":200,"message":"Token is not active","data":{"active":false}}`))
+		}
+	}))
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		wantErr  bool
+		errorMsg string
+	}{
+		{
+			name:     "Nil config",
+			config:   nil,
+			wantErr:  true,
+			errorMsg: "config cannot be nil",
+		},
+		{
+			name:     "Missing base URL",
+			config:   &Config{},
+			wantErr:  true,
+			errorMsg: "base URL cannot be empty",
+		},
+		{
+			name:    "Valid config",
+			config:  &Config{BaseURL: "http://localhost:8083/"},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.config)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("NewClient() error = %v, want error containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewClient() unexpected error = %v", err)
+			}
+			if client.baseURL != "http://localhost:8083" {
+				t.Errorf("NewClient() baseURL = %q, want trailing slash trimmed", client.baseURL)
+			}
+		})
+	}
+}
+
+func TestClientIntrospect(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	client, err := NewClient(&Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	t.Run("Active token", func(t *testing.T) {
+		introspection, err := client.Introspect(context.Background(), "Bearer valid-token")
+		if err != nil {
+			t.Fatalf("Introspect() error = %v", err)
+		}
+		if !introspection.Active || introspection.UserID != 7 || introspection.Username != "alice" {
+			t.Errorf("Introspect() = %+v, want active token of alice", introspection)
+		}
+		if !introspection.HasRole("admin", "operator") {
+			t.Errorf("HasRole() = false, want true for operator")
+		}
+		if introspection.IsImpersonated() {
+			t.Errorf("IsImpersonated() = true for a regular session")
+		}
+	})
+
+	t.Run("Impersonated token", func(t *testing.T) {
+		introspection, err := client.Introspect(context.Background(), "impersonated-token")
+		if err != nil {
+			t.Fatalf("Introspect() error = %v", err)
+		}
+		if !introspection.IsImpersonated() || introspection.ImpersonatedBy != "admin" {
+			t.Errorf("Introspect() = %+v, want session of alice impersonated by admin", introspection)
+		}
+	})
+
+	t.Run("Inactive token", func(t *testing.T) {
+		introspection, err := client.Introspect(context.Background(), "expired-token")
+		if err != nil {
+			t.Fatalf("Introspect() error = %v", err)
+		}
+		if introspection.Active {
+			t.Errorf("Introspect() active = true, want false")
+		}
+		if introspection.HasRole("user") {
+			t.Errorf("HasRole() = true for inactive token")
+		}
+
+		if _, err := client.Validate(context.Background(), "expired-token"); !errors.Is(err, ErrTokenInactive) {
+			t.Errorf("Validate() error = %v, want ErrTokenInactive", err)
+		}
+	})
+
+	t.Run("Client forwarded", func(t *testing.T) {
+		introspection, err := client.IntrospectFor(context.Background(), "bound-token", &ClientInfo{IP: "203.0.113.7", UserAgent: "curl/8.0"})
+		if err != nil {
+			t.Fatalf("IntrospectFor() error = %v", err)
+		}
+		if !introspection.Active {
+			t.Errorf("IntrospectFor() active = false, want the client to be forwarded")
+		}
+
+		introspection, err = client.Introspect(context.Background(), "bound-token")
+		if err != nil {
+			t.Fatalf("Introspect() error = %v", err)
+		}
+		if introspection.Active {
+			t.Errorf("Introspect() active = true, want no client forwarded")
+		}
+	})
+
+	t.Run("Empty token", func(t *testing.T) {
+		if _, err := client.Introspect(context.Background(), "  "); !errors.Is(err, ErrEmptyToken) {
+			t.Errorf("Introspect() error = %v, want ErrEmptyToken", err)
+		}
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		_, err := client.Introspect(context.Background(), "broken")
+		if err == nil || !strings.Contains(err.Error(), "connection refused") {
+			t.Errorf("Introspect() error = %v, want auth API error", err)
+		}
+	})
+}
+
+func TestTokenFromHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer abc123", "abc123"},
+		{"bearer abc123", "abc123"},
+		{"abc123", "abc123"},
+		{"  Bearer   abc123 ", "abc123"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := TokenFromHeader(tt.header); got != tt.want {
+			t.Errorf("TokenFromHeader(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestClientWithServiceIssuer(t *testing.T) {
+	keyRing, err := serviceauth.NewKeyRing(map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeyRing() error = %v", err)
+	}
+	issuer, _ := serviceauth.NewIssuer(keyRing, serviceauth.ServiceDataFlowAPI, time.Minute)
+	verifier, _ := serviceauth.NewVerifier(keyRing, serviceauth.ServiceAuthAPI)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/internal/introspect" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if _, err := verifier.VerifyRequest(r); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"message":"Service authentication failed"}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"message":"Token is active","data":{"active":true,"user_id":1,"role":"admin"}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{BaseURL: server.URL, ServiceIssuer: issuer})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	introspection, err := client.Validate(context.Background(), "session-token")
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !introspection.HasRole("admin") {
+		t.Errorf("HasRole(admin) = false, want true")
+	}
+}
@@ -0,0 +1,177 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the rule fields left empty
+const (
+	DefaultErrorStatus = 503
+	DefaultRetryAfter  = 1 // seconds
+	DefaultDropAfter   = 256
+)
+
+// Rule faults injected into the requests of an agent and/or endpoint, each fault with
+// its own probability between 0 and 1
+type Rule struct {
+	AgentID  string `json:"agent_id"` // empty matches every agent
+	Endpoint string `json:"endpoint"` // request path prefix, empty matches every path
+
+	LatencyRate float64 `json:"latency_rate"`
+	LatencyMs   int     `json:"latency_ms"`
+
+	ErrorRate   float64 `json:"error_rate"`
+	ErrorStatus int     `json:"error_status"` // 5xx status of injected errors
+
+	RateLimitRate     float64 `json:"rate_limit_rate"`
+	RetryAfterSeconds int     `json:"retry_after_seconds"`
+
+	DropStreamRate float64 `json:"drop_stream_rate"`
+	DropAfterBytes int     `json:"drop_after_bytes"` // event stream bytes sent before the connection is cut
+}
+
+// matches whether the rule applies to a request of agentID to path
+func (r *Rule) matches(agentID, path string) bool {
+	if r.AgentID != "" && r.AgentID != agentID {
+		return false
+	}
+	return r.Endpoint == "" || strings.HasPrefix(path, r.Endpoint)
+}
+
+// validate check the rule and fill in the defaults
+func (r *Rule) validate() error {
+	rates := map[string]float64{
+		"latency_rate":     r.LatencyRate,
+		"error_rate":       r.ErrorRate,
+		"rate_limit_rate":  r.RateLimitRate,
+		"drop_stream_rate": r.DropStreamRate,
+	}
+	for name, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	// errors and rate limits exclude each other, they are drawn from one roll
+	if r.ErrorRate+r.RateLimitRate > 1 {
+		return fmt.Errorf("error_rate and rate_limit_rate must not add up to more than 1")
+	}
+	if r.LatencyMs < 0 || r.RetryAfterSeconds < 0 || r.DropAfterBytes < 0 {
+		return fmt.Errorf("latency_ms, retry_after_seconds and drop_after_bytes must not be negative")
+	}
+
+	if r.ErrorStatus == 0 {
+		r.ErrorStatus = DefaultErrorStatus
+	}
+	if r.ErrorStatus < 500 || r.ErrorStatus > 599 {
+		return fmt.Errorf("error_status must be a 5xx status")
+	}
+	if r.RetryAfterSeconds == 0 {
+		r.RetryAfterSeconds = DefaultRetryAfter
+	}
+	if r.DropAfterBytes == 0 {
+		r.DropAfterBytes = DefaultDropAfter
+	}
+	return nil
+}
+
+// ParseRules parse a JSON array of rules, e.g.
+// [{"agent_id":"agent_1","error_rate":0.2},{"endpoint":"/api/v1/openai","drop_stream_rate":0.5}]
+func ParseRules(data string) ([]Rule, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("invalid chaos rules: %w", err)
+	}
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid chaos rule %d: %w", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// Fault what to do to one request, the zero value injects nothing
+type Fault struct {
+	Latency     time.Duration
+	ErrorStatus int  // answer with this status instead of calling the agent
+	RateLimited bool // answer 429 instead of calling the agent
+	RetryAfter  int  // seconds, with RateLimited
+	DropAfter   int  // cut an event stream after this many bytes, -1 keeps it
+}
+
+// None whether the fault injects nothing
+func (f Fault) None() bool {
+	return f.Latency == 0 && f.ErrorStatus == 0 && !f.RateLimited && f.DropAfter < 0
+}
+
+// String the injected faults, e.g. "latency=200ms,error=503"
+func (f Fault) String() string {
+	var parts []string
+	if f.Latency > 0 {
+		parts = append(parts, "latency="+f.Latency.String())
+	}
+	if f.ErrorStatus != 0 {
+		parts = append(parts, "error="+strconv.Itoa(f.ErrorStatus))
+	}
+	if f.RateLimited {
+		parts = append(parts, "rate_limit")
+	}
+	if f.DropAfter >= 0 {
+		parts = append(parts, "drop_stream="+strconv.Itoa(f.DropAfter))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Injector picks the faults of requests from the rules, the first matching rule applies
+type Injector struct {
+	rules  []Rule
+	random func() float64
+}
+
+// NewInjector creates an injector, rules must come from ParseRules
+func NewInjector(rules []Rule) *Injector {
+	return &Injector{rules: rules, random: rand.Float64}
+}
+
+// Rules number of rules
+func (i *Injector) Rules() int {
+	return len(i.rules)
+}
+
+// Decide roll the faults of a request of agentID to path
+func (i *Injector) Decide(agentID, path string) Fault {
+	fault := Fault{DropAfter: -1}
+	for idx := range i.rules {
+		rule := &i.rules[idx]
+		if !rule.matches(agentID, path) {
+			continue
+		}
+
+		if rule.LatencyRate > 0 && i.random() < rule.LatencyRate {
+			fault.Latency = time.Duration(rule.LatencyMs) * time.Millisecond
+		}
+		if rule.ErrorRate > 0 || rule.RateLimitRate > 0 {
+			roll := i.random()
+			switch {
+			case roll < rule.ErrorRate:
+				fault.ErrorStatus = rule.ErrorStatus
+			case roll < rule.ErrorRate+rule.RateLimitRate:
+				fault.RateLimited = true
+				fault.RetryAfter = rule.RetryAfterSeconds
+			}
+		}
+		if rule.DropStreamRate > 0 && i.random() < rule.DropStreamRate {
+			fault.DropAfter = rule.DropAfterBytes
+		}
+		return fault
+	}
+	return fault
+}
@@ -0,0 +1,106 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{name: "Empty", data: "", want: 0},
+		{name: "Two rules", data: `[{"agent_id":"a","error_rate":0.5},{"endpoint":"/api/v1/openai","drop_stream_rate":1}]`, want: 2},
+		{name: "Not JSON", data: `agent_id=a`, wantErr: true},
+		{name: "Rate above 1", data: `[{"latency_rate":1.5}]`, wantErr: true},
+		{name: "Negative rate", data: `[{"drop_stream_rate":-0.1}]`, wantErr: true},
+		{name: "Error and rate limit above 1", data: `[{"error_rate":0.6,"rate_limit_rate":0.6}]`, wantErr: true},
+		{name: "Client error status", data: `[{"error_rate":0.1,"error_status":404}]`, wantErr: true},
+		{name: "Negative latency", data: `[{"latency_rate":1,"latency_ms":-5}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(rules) != tt.want {
+				t.Errorf("ParseRules() = %d rules, want %d", len(rules), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRules_Defaults(t *testing.T) {
+	rules, err := ParseRules(`[{"error_rate":0.1,"rate_limit_rate":0.1,"drop_stream_rate":0.1}]`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	rule := rules[0]
+	if rule.ErrorStatus != DefaultErrorStatus || rule.RetryAfterSeconds != DefaultRetryAfter || rule.DropAfterBytes != DefaultDropAfter {
+		t.Errorf("defaults = %d, %d, %d", rule.ErrorStatus, rule.RetryAfterSeconds, rule.DropAfterBytes)
+	}
+}
+
+func TestInjector_Decide(t *testing.T) {
+	rules, err := ParseRules(`[
+		{"agent_id":"slow","latency_rate":0.5,"latency_ms":200},
+		{"agent_id":"flaky","endpoint":"/api/v1/openai","error_rate":0.3,"error_status":502,"rate_limit_rate":0.3,"retry_after_seconds":5},
+		{"endpoint":"/api/v1/dify","drop_stream_rate":0.5,"drop_after_bytes":64}
+	]`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		agentID string
+		path    string
+		random  float64
+		want    Fault
+	}{
+		{name: "Latency rolled", agentID: "slow", path: "/api/v1/chat", random: 0.1, want: Fault{Latency: 200 * time.Millisecond, DropAfter: -1}},
+		{name: "Latency not rolled", agentID: "slow", path: "/api/v1/chat", random: 0.9, want: Fault{DropAfter: -1}},
+		{name: "Error", agentID: "flaky", path: "/api/v1/openai/chat/completions", random: 0.1, want: Fault{ErrorStatus: 502, DropAfter: -1}},
+		{name: "Rate limit", agentID: "flaky", path: "/api/v1/openai/chat/completions", random: 0.5, want: Fault{RateLimited: true, RetryAfter: 5, DropAfter: -1}},
+		{name: "Neither", agentID: "flaky", path: "/api/v1/openai/chat/completions", random: 0.7, want: Fault{DropAfter: -1}},
+		{name: "Endpoint does not match", agentID: "flaky", path: "/api/v1/chat", random: 0.1, want: Fault{DropAfter: -1}},
+		{name: "Drop stream on any agent", agentID: "other", path: "/api/v1/dify/chat-messages", random: 0.1, want: Fault{DropAfter: 64}},
+		{name: "No rule", agentID: "other", path: "/api/v1/chat", random: 0, want: Fault{DropAfter: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := NewInjector(rules)
+			injector.random = func() float64 { return tt.random }
+			if got := injector.Decide(tt.agentID, tt.path); got != tt.want {
+				t.Errorf("Decide() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFault_String(t *testing.T) {
+	tests := []struct {
+		fault Fault
+		want  string
+		none  bool
+	}{
+		{fault: Fault{DropAfter: -1}, want: "", none: true},
+		{fault: Fault{Latency: 150 * time.Millisecond, ErrorStatus: 503, DropAfter: -1}, want: "latency=150ms,error=503"},
+		{fault: Fault{RateLimited: true, DropAfter: 0}, want: "rate_limit,drop_stream=0"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.fault.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+		if got := tt.fault.None(); got != tt.none {
+			t.Errorf("None() = %v, want %v for %q", got, tt.none, tt.want)
+		}
+	}
+}
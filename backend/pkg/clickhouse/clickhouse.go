@@ -0,0 +1,182 @@
+// Package clickhouse is a minimal client of the ClickHouse HTTP interface: statements
+// with typed query parameters, inserts of JSON rows and queries decoded row by row.
+package clickhouse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config connection settings of the HTTP interface
+type Config struct {
+	URL      string // e.g. http://localhost:8123
+	Database string
+	Username string
+	Password string
+	Timeout  time.Duration // of one statement, 30s when unset
+}
+
+// Client runs statements over HTTP, safe for concurrent use
+type Client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+// Params values of the {name:Type} placeholders of a statement
+type Params map[string]interface{}
+
+// Error a statement ClickHouse refused, with its message
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("clickhouse: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// New create a client, no connection is made until the first statement
+func New(config Config) (*Client, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("clickhouse URL is required")
+	}
+	if _, err := url.Parse(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid clickhouse URL: %w", err)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &Client{config: config, httpClient: &http.Client{Timeout: config.Timeout}}, nil
+}
+
+// Ping check that the server answers
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Exec(ctx, "SELECT 1", nil)
+}
+
+// Exec run a statement without result rows
+func (c *Client) Exec(ctx context.Context, query string, params Params) error {
+	body, err := c.do(ctx, query, params, nil)
+	if err != nil {
+		return err
+	}
+	body.Close()
+	return nil
+}
+
+// Insert write rows into table, each row is marshalled to one JSON object whose keys are
+// the column names
+func Insert[T any](ctx context.Context, c *Client, table string, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var payload bytes.Buffer
+	encoder := json.NewEncoder(&payload)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("failed to marshal row: %w", err)
+		}
+	}
+
+	body, err := c.do(ctx, "INSERT INTO "+table+" FORMAT JSONEachRow", nil, &payload)
+	if err != nil {
+		return err
+	}
+	body.Close()
+	return nil
+}
+
+// Query run a SELECT and decode every result row into a T by the column names
+func Query[T any](ctx context.Context, c *Client, query string, params Params) ([]T, error) {
+	body, err := c.do(ctx, query+" FORMAT JSONEachRow", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var rows []T
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var row T
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, fmt.Errorf("failed to decode row: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	return rows, nil
+}
+
+// do send one statement; the query goes in the URL unless a body is sent with it
+func (c *Client) do(ctx context.Context, query string, params Params, payload io.Reader) (io.ReadCloser, error) {
+	values := url.Values{}
+	if c.config.Database != "" {
+		values.Set("database", c.config.Database)
+	}
+	// numbers as numbers and times as RFC 3339, both ways
+	values.Set("output_format_json_quote_64bit_integers", "0")
+	values.Set("date_time_output_format", "iso")
+	values.Set("date_time_input_format", "best_effort")
+	for name, value := range params {
+		values.Set("param_"+name, formatParam(value))
+	}
+
+	var body io.Reader = strings.NewReader(query)
+	if payload != nil {
+		values.Set("query", query)
+		body = payload
+	}
+
+	endpoint := strings.TrimRight(c.config.URL, "/") + "/?" + values.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.config.Username)
+		req.Header.Set("X-ClickHouse-Key", c.config.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp.Body, nil
+}
+
+// formatParam a parameter value in the text form ClickHouse parses for its type
+func formatParam(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05.000")
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
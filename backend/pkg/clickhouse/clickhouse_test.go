@@ -0,0 +1,116 @@
+package clickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorded one request the test server received
+type recorded struct {
+	query  string
+	params map[string]string
+	body   string
+	user   string
+}
+
+func newTestServer(t *testing.T, status int, response string) (*Client, *recorded) {
+	t.Helper()
+	got := &recorded{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.body = string(body)
+		got.query = r.URL.Query().Get("query")
+		got.user = r.Header.Get("X-ClickHouse-User")
+		got.params = make(map[string]string)
+		for name, values := range r.URL.Query() {
+			if strings.HasPrefix(name, "param_") {
+				got.params[strings.TrimPrefix(name, "param_")] = values[0]
+			}
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := New(Config{URL: server.URL, Database: "analytics", Username: "writer", Password: "secret"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return client, got
+}
+
+func TestQuery(t *testing.T) {
+	client, got := newTestServer(t, http.StatusOK, `{"agent_id":"agent_a","requests":3}
+{"agent_id":"agent_b","requests":5}
+`)
+
+	type row struct {
+		AgentID  string `json:"agent_id"`
+		Requests int64  `json:"requests"`
+	}
+	since := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	rows, err := Query[row](context.Background(), client,
+		"SELECT agent_id, count() AS requests FROM usage_records WHERE created_at >= {since:DateTime64(3)} GROUP BY agent_id",
+		Params{"since": since, "success": true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if len(rows) != 2 || rows[0].AgentID != "agent_a" || rows[1].Requests != 5 {
+		t.Errorf("rows = %+v", rows)
+	}
+	if !strings.HasSuffix(got.body, "FORMAT JSONEachRow") {
+		t.Errorf("Expected the query in the body with the JSON format, got %q", got.body)
+	}
+	if got.params["since"] != "2026-10-01 12:00:00.000" || got.params["success"] != "1" {
+		t.Errorf("params = %v", got.params)
+	}
+	if got.user != "writer" {
+		t.Errorf("user = %q, want writer", got.user)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	client, got := newTestServer(t, http.StatusOK, "")
+
+	type row struct {
+		ID      uint64 `json:"id"`
+		AgentID string `json:"agent_id"`
+	}
+	err := Insert(context.Background(), client, "usage_records", []row{{ID: 1, AgentID: "agent_a"}, {ID: 2, AgentID: "agent_b"}})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	if got.query != "INSERT INTO usage_records FORMAT JSONEachRow" {
+		t.Errorf("query = %q", got.query)
+	}
+	want := "{\"id\":1,\"agent_id\":\"agent_a\"}\n{\"id\":2,\"agent_id\":\"agent_b\"}\n"
+	if got.body != want {
+		t.Errorf("body = %q, want %q", got.body, want)
+	}
+}
+
+func TestError(t *testing.T) {
+	client, _ := newTestServer(t, http.StatusBadRequest, "Code: 60. DB::Exception: Table analytics.missing does not exist.\n")
+
+	err := client.Exec(context.Background(), "SELECT * FROM missing", nil)
+	chErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected an *Error, got %v", err)
+	}
+	if chErr.StatusCode != http.StatusBadRequest || !strings.Contains(chErr.Message, "does not exist") {
+		t.Errorf("error = %+v", chErr)
+	}
+}
+
+func TestNew_RequiresURL(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("Expected an error without URL")
+	}
+}
@@ -0,0 +1,186 @@
+// Package envelope implements envelope encryption: data is sealed with AES-256-GCM
+// under a data key, and data keys are stored wrapped by a master key, so master keys
+// never touch the data and data keys can be rotated without changing the master key.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeySize length of master and data keys in bytes (AES-256)
+const KeySize = 32
+
+// wrapContext additional data binding wrapped data keys to their purpose
+const wrapContext = "envelope:data-key:"
+
+// ErrDecrypt the ciphertext was altered, or sealed with another key or context
+var ErrDecrypt = errors.New("envelope: message authentication failed")
+
+// MasterKeys master keys by key ID; data keys are wrapped with the active key and
+// unwrapped with any known key, so a new master key can be rolled out before the
+// old one is retired
+type MasterKeys struct {
+	keys     map[string][]byte
+	activeID string
+}
+
+// NewMasterKeys create a master key set, activeID selects the wrapping key and may
+// be empty when there is a single key
+func NewMasterKeys(keys map[string][]byte, activeID string) (*MasterKeys, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one master key is required")
+	}
+
+	set := &MasterKeys{keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if id == "" {
+			return nil, fmt.Errorf("master key ID cannot be empty")
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		set.keys[id] = append([]byte(nil), key...)
+	}
+
+	if activeID == "" && len(keys) == 1 {
+		for id := range keys {
+			activeID = id
+		}
+	}
+	if _, ok := set.keys[activeID]; !ok {
+		return nil, fmt.Errorf("unknown active master key ID: %q", activeID)
+	}
+	set.activeID = activeID
+
+	return set, nil
+}
+
+// ParseMasterKeys parses keys in the "kid1:base64key1,kid2:base64key2" format used by the configuration
+func ParseMasterKeys(spec, activeID string) (*MasterKeys, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid master key entry, expected kid:base64key")
+		}
+
+		id := strings.TrimSpace(parts[0])
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate master key ID: %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return NewMasterKeys(keys, activeID)
+}
+
+// ActiveID ID of the master key new data keys are wrapped with
+func (m *MasterKeys) ActiveID() string {
+	return m.activeID
+}
+
+// IDs known master key IDs, sorted
+func (m *MasterKeys) IDs() []string {
+	ids := make([]string, 0, len(m.keys))
+	for id := range m.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WrapKey seal a data key with the active master key, returning the master key ID
+// to store alongside it
+func (m *MasterKeys) WrapKey(dataKey []byte) (masterID string, wrapped string, err error) {
+	wrapped, err = Seal(m.keys[m.activeID], dataKey, wrapContext+m.activeID)
+	if err != nil {
+		return "", "", err
+	}
+	return m.activeID, wrapped, nil
+}
+
+// UnwrapKey open a data key wrapped with the given master key
+func (m *MasterKeys) UnwrapKey(masterID, wrapped string) ([]byte, error) {
+	key, ok := m.keys[masterID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key ID: %s", masterID)
+	}
+	dataKey, err := Open(key, wrapped, wrapContext+masterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(dataKey) != KeySize {
+		return nil, fmt.Errorf("unwrapped data key has %d bytes, want %d", len(dataKey), KeySize)
+	}
+	return dataKey, nil
+}
+
+// GenerateDataKey random data key
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// Seal encrypt plaintext with AES-256-GCM under key, context is authenticated but not
+// encrypted and must be given again to Open; the result is the base64 of nonce and ciphertext
+func Seal(key, plaintext []byte, context string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(context))), nil
+}
+
+// Open decrypt a value produced by Seal with the same key and context
+func Open(key []byte, sealed, context string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(context))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// newAEAD AES-256-GCM for the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
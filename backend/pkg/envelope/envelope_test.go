@@ -0,0 +1,136 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyA = bytes.Repeat([]byte{0x0a}, KeySize)
+	testKeyB = bytes.Repeat([]byte{0x0b}, KeySize)
+)
+
+func TestSealOpen(t *testing.T) {
+	sealed, err := Seal(testKeyA, []byte("hello tenant"), "agent-1")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		sealed  string
+		context string
+		want    string
+		wantErr bool
+	}{
+		{name: "Same key and context", key: testKeyA, sealed: sealed, context: "agent-1", want: "hello tenant"},
+		{name: "Other context", key: testKeyA, sealed: sealed, context: "agent-2", wantErr: true},
+		{name: "Other key", key: testKeyB, sealed: sealed, context: "agent-1", wantErr: true},
+		{name: "Not base64", key: testKeyA, sealed: "not base64!", context: "agent-1", wantErr: true},
+		{name: "Too short", key: testKeyA, sealed: "AAAA", context: "agent-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Open(tt.key, tt.sealed, tt.context)
+			if tt.wantErr {
+				if !errors.Is(err, ErrDecrypt) {
+					t.Fatalf("Open() error = %v, want ErrDecrypt", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Open() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSealUsesFreshNonce(t *testing.T) {
+	first, _ := Seal(testKeyA, []byte("same"), "")
+	second, _ := Seal(testKeyA, []byte("same"), "")
+	if first == second {
+		t.Error("Seal() returned the same ciphertext twice")
+	}
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	encodedA := base64.StdEncoding.EncodeToString(testKeyA)
+	encodedB := base64.StdEncoding.EncodeToString(testKeyB)
+
+	tests := []struct {
+		name       string
+		spec       string
+		activeID   string
+		wantActive string
+		wantErr    bool
+		errorMsg   string
+	}{
+		{name: "Single key becomes active", spec: "m1:" + encodedA, wantActive: "m1"},
+		{name: "Multiple keys with active", spec: "m1:" + encodedA + ", m2:" + encodedB, activeID: "m2", wantActive: "m2"},
+		{name: "Multiple keys without active", spec: "m1:" + encodedA + ",m2:" + encodedB, wantErr: true, errorMsg: "unknown active master key"},
+		{name: "Missing separator", spec: encodedA, wantErr: true, errorMsg: "expected kid:base64key"},
+		{name: "Invalid base64", spec: "m1:***", wantErr: true, errorMsg: "not valid base64"},
+		{name: "Wrong key size", spec: "m1:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true, errorMsg: "must be 32 bytes"},
+		{name: "Duplicate ID", spec: "m1:" + encodedA + ",m1:" + encodedB, activeID: "m1", wantErr: true, errorMsg: "duplicate master key ID"},
+		{name: "Empty", spec: "", wantErr: true, errorMsg: "at least one master key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseMasterKeys(tt.spec, tt.activeID)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("ParseMasterKeys() error = %v, want error containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMasterKeys() error = %v", err)
+			}
+			if keys.ActiveID() != tt.wantActive {
+				t.Errorf("ActiveID() = %q, want %q", keys.ActiveID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	oldKeys, _ := NewMasterKeys(map[string][]byte{"m1": testKeyA}, "")
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		t.Fatalf("GenerateDataKey() error = %v", err)
+	}
+
+	masterID, wrapped, err := oldKeys.WrapKey(dataKey)
+	if err != nil {
+		t.Fatalf("WrapKey() error = %v", err)
+	}
+	if masterID != "m1" {
+		t.Errorf("WrapKey() master ID = %q, want m1", masterID)
+	}
+
+	// After rolling out m2 the data key still unwraps with m1
+	rotated, _ := NewMasterKeys(map[string][]byte{"m1": testKeyA, "m2": testKeyB}, "m2")
+	got, err := rotated.UnwrapKey(masterID, wrapped)
+	if err != nil {
+		t.Fatalf("UnwrapKey() error = %v", err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Error("UnwrapKey() returned a different data key")
+	}
+
+	if _, err := rotated.UnwrapKey("m2", wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("UnwrapKey() with the wrong master key error = %v, want ErrDecrypt", err)
+	}
+	if _, err := rotated.UnwrapKey("m3", wrapped); err == nil {
+		t.Error("UnwrapKey() with an unknown master key returned no error")
+	}
+}
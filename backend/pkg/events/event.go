@@ -0,0 +1,140 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Type identifies the kind of platform event
+type Type string
+
+const (
+	// TypeRequestCompleted is emitted when a dataflow request finishes, successfully or not
+	TypeRequestCompleted Type = "request.completed"
+
+	// TypeAgentHealthChanged is emitted when an agent's upstream flips between healthy and unhealthy
+	TypeAgentHealthChanged Type = "agent.health_changed"
+
+	// TypeAgentErrorRateHigh is emitted when the share of failed requests of an agent crosses the alert threshold
+	TypeAgentErrorRateHigh Type = "agent.error_rate_high"
+
+	// TypeAgentUnhealthy is emitted when an agent stays unhealthy longer than the alert delay
+	TypeAgentUnhealthy Type = "agent.unhealthy"
+
+	// TypeAgentGoldenRegression is emitted when answers of an agent to its golden prompts drift from the references
+	TypeAgentGoldenRegression Type = "agent.golden_regression"
+
+	// TypeKeyCreated is emitted when a credential is issued; the secret itself is never included
+	TypeKeyCreated Type = "key.created"
+
+	// TypeKeyOffHoursAttempt is emitted when a connector key is used outside the access windows of its agent
+	TypeKeyOffHoursAttempt Type = "key.off_hours_attempt"
+
+	// TypeQuotaExceeded is emitted when a request is rejected by a rate limit or a full queue
+	TypeQuotaExceeded Type = "quota.exceeded"
+
+	// TypeQuotaWarning is emitted when usage of a limit crosses its warning threshold, e.g. a queue 90% full
+	TypeQuotaWarning Type = "quota.warning"
+
+	// TypeStreamInterrupted is emitted when an upstream stream breaks off before the response is complete
+	TypeStreamInterrupted Type = "stream.interrupted"
+
+	// TypeUserImpersonated is emitted when an admin is issued a session to act as a user
+	TypeUserImpersonated Type = "user.impersonated"
+
+	// TypeSessionBindingViolated is emitted when a session is used from another client than it was issued to
+	TypeSessionBindingViolated Type = "session.binding_violated"
+
+	// TypeLoginAnomaly is emitted when a login comes from a new country or network, or implies impossible travel
+	TypeLoginAnomaly Type = "user.login_anomaly"
+)
+
+// KnownTypes lists the event types emitted by the platform
+func KnownTypes() []Type {
+	return []Type{
+		TypeRequestCompleted,
+		TypeAgentHealthChanged,
+		TypeAgentErrorRateHigh,
+		TypeAgentUnhealthy,
+		TypeAgentGoldenRegression,
+		TypeKeyCreated,
+		TypeKeyOffHoursAttempt,
+		TypeQuotaExceeded,
+		TypeQuotaWarning,
+		TypeStreamInterrupted,
+		TypeUserImpersonated,
+		TypeSessionBindingViolated,
+		TypeLoginAnomaly,
+	}
+}
+
+// IsKnownType report whether t is emitted by the platform
+func IsKnownType(t Type) bool {
+	for _, known := range KnownTypes() {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the structured envelope delivered to the broker
+type Event struct {
+	// ID is unique per event, subscribers can use it to deduplicate
+	ID string `json:"id"`
+
+	// Type is the event type, e.g. "request.completed"
+	Type Type `json:"type"`
+
+	// Source is the emitting service, e.g. "dataflow-api"
+	Source string `json:"source"`
+
+	// Subject is the resource the event is about, e.g. the agent ID
+	Subject string `json:"subject,omitempty"`
+
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+
+	// Data carries the type specific payload
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// New creates an event with a fresh ID and the current time
+func New(eventType Type, source, subject string, data map[string]interface{}) Event {
+	return Event{
+		ID:      newEventID(),
+		Type:    eventType,
+		Source:  source,
+		Subject: subject,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	}
+}
+
+// Validate checks that the event can be published
+func (e Event) Validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("event ID cannot be empty")
+	}
+	if e.Type == "" {
+		return fmt.Errorf("event type cannot be empty")
+	}
+	if e.Source == "" {
+		return fmt.Errorf("event source cannot be empty")
+	}
+	if e.Time.IsZero() {
+		return fmt.Errorf("event time cannot be zero")
+	}
+	return nil
+}
+
+// newEventID generate a random event ID
+func newEventID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("evt_%d", time.Now().UnixNano())
+	}
+	return "evt_" + hex.EncodeToString(buf)
+}
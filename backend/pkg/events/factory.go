@@ -0,0 +1,88 @@
+package events
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// BrokerType represents the broker events are published to
+type BrokerType string
+
+const (
+	// NoneBroker disables event publishing
+	NoneBroker BrokerType = "none"
+
+	// LogBroker writes events as JSON lines to stdout
+	LogBroker BrokerType = "log"
+
+	// RedisBroker appends events to a Redis stream
+	RedisBroker BrokerType = "redis"
+)
+
+// Config represents the configuration of the event publisher
+type Config struct {
+	// Broker selects the publisher implementation
+	Broker BrokerType
+
+	// Stream is the Redis stream key events are appended to
+	Stream string
+
+	// MaxLen caps the stream length, 0 keeps every event
+	MaxLen int64
+
+	// BufferSize is the number of events buffered before new ones are dropped
+	BufferSize int
+
+	// PublishTimeout bounds a single delivery to the broker
+	PublishTimeout time.Duration
+
+	// Redis connection, required for the redis broker
+	Redis *RedisConfig
+}
+
+// RedisConfig represents the Redis connection used by the redis broker
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// DefaultConfig returns a configuration with publishing disabled
+func DefaultConfig() *Config {
+	return &Config{
+		Broker:         NoneBroker,
+		Stream:         "agent-connector:events",
+		MaxLen:         100000,
+		BufferSize:     1024,
+		PublishTimeout: 5 * time.Second,
+	}
+}
+
+// NewPublisher creates a buffered publisher for the configured broker
+func NewPublisher(config *Config) (Publisher, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	switch config.Broker {
+	case NoneBroker, "":
+		return NoopPublisher{}, nil
+
+	case LogBroker:
+		return NewAsyncPublisher(NewLogPublisher(os.Stdout), config.BufferSize, config.PublishTimeout), nil
+
+	case RedisBroker:
+		if config.Stream == "" {
+			return nil, fmt.Errorf("stream cannot be empty")
+		}
+		publisher, err := NewRedisStreamPublisher(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewAsyncPublisher(publisher, config.BufferSize, config.PublishTimeout), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported event broker: %s", config.Broker)
+	}
+}
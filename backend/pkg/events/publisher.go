@@ -0,0 +1,244 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Publisher delivers events to a broker
+type Publisher interface {
+	// Publish sends a single event
+	Publish(ctx context.Context, event Event) error
+
+	// Close releases the broker connection, flushing pending events where possible
+	Close() error
+}
+
+// NoopPublisher discards every event, used when no broker is configured
+type NoopPublisher struct{}
+
+// Publish discards the event
+func (NoopPublisher) Publish(ctx context.Context, event Event) error {
+	return nil
+}
+
+// Close does nothing
+func (NoopPublisher) Close() error {
+	return nil
+}
+
+// LogPublisher writes each event as a JSON line, useful for development and log shippers
+type LogPublisher struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewLogPublisher creates a publisher writing JSON lines to w
+func NewLogPublisher(w io.Writer) *LogPublisher {
+	return &LogPublisher{writer: w}
+}
+
+// Publish writes the event as one JSON line
+func (p *LogPublisher) Publish(ctx context.Context, event Event) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Close does nothing, the writer is owned by the caller
+func (p *LogPublisher) Close() error {
+	return nil
+}
+
+// AsyncPublisher buffers events and hands them to the wrapped publisher on a
+// background goroutine, so a slow broker never adds latency to API requests.
+// Events are dropped when the buffer is full.
+type AsyncPublisher struct {
+	next           Publisher
+	events         chan Event
+	publishTimeout time.Duration
+
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// NewAsyncPublisher wraps next with a buffer of the given size
+func NewAsyncPublisher(next Publisher, bufferSize int, publishTimeout time.Duration) *AsyncPublisher {
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+	if publishTimeout <= 0 {
+		publishTimeout = 5 * time.Second
+	}
+
+	p := &AsyncPublisher{
+		next:           next,
+		events:         make(chan Event, bufferSize),
+		publishTimeout: publishTimeout,
+		done:           make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish enqueues the event without blocking
+func (p *AsyncPublisher) Publish(ctx context.Context, event Event) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return fmt.Errorf("publisher is closed")
+	}
+
+	select {
+	case p.events <- event:
+		return nil
+	default:
+		p.dropped.Add(1)
+		return fmt.Errorf("event buffer full, dropped %s event", event.Type)
+	}
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (p *AsyncPublisher) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Failed returns the number of events the wrapped publisher failed to deliver
+func (p *AsyncPublisher) Failed() int64 {
+	return p.failed.Load()
+}
+
+// Close stops accepting events, drains the buffer and closes the wrapped publisher
+func (p *AsyncPublisher) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.events)
+	p.mu.Unlock()
+
+	<-p.done
+	return p.next.Close()
+}
+
+// run delivers buffered events until the channel is closed
+func (p *AsyncPublisher) run() {
+	defer close(p.done)
+
+	for event := range p.events {
+		ctx, cancel := context.WithTimeout(context.Background(), p.publishTimeout)
+		if err := p.next.Publish(ctx, event); err != nil {
+			p.failed.Add(1)
+			log.Printf("Failed to publish %s event %s: %v", event.Type, event.ID, err)
+		}
+		cancel()
+	}
+}
+
+// FanoutPublisher publishes every event to several publishers
+type FanoutPublisher struct {
+	publishers []Publisher
+}
+
+// NewFanoutPublisher combine publishers, nil entries and no-op publishers are skipped
+func NewFanoutPublisher(publishers ...Publisher) *FanoutPublisher {
+	fanout := &FanoutPublisher{}
+	for _, publisher := range publishers {
+		if publisher == nil {
+			continue
+		}
+		if _, ok := publisher.(NoopPublisher); ok {
+			continue
+		}
+		fanout.publishers = append(fanout.publishers, publisher)
+	}
+	return fanout
+}
+
+// Publish sends the event to every publisher, returning the first error
+func (p *FanoutPublisher) Publish(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, publisher := range p.publishers {
+		if err := publisher.Publish(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close closes every publisher, returning the first error
+func (p *FanoutPublisher) Close() error {
+	var firstErr error
+	for _, publisher := range p.publishers {
+		if err := publisher.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+var (
+	defaultMu        sync.RWMutex
+	defaultPublisher Publisher = NoopPublisher{}
+	defaultSource    string
+)
+
+// SetDefault installs the process wide publisher used by Emit
+func SetDefault(publisher Publisher, source string) {
+	if publisher == nil {
+		publisher = NoopPublisher{}
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultPublisher = publisher
+	defaultSource = source
+}
+
+// Default returns the process wide publisher
+func Default() Publisher {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultPublisher
+}
+
+// Emit publishes an event through the default publisher. Failures are logged,
+// never returned: event delivery must not fail the operation that caused it.
+func Emit(eventType Type, subject string, data map[string]interface{}) {
+	defaultMu.RLock()
+	publisher, source := defaultPublisher, defaultSource
+	defaultMu.RUnlock()
+
+	if _, ok := publisher.(NoopPublisher); ok {
+		return
+	}
+
+	if err := publisher.Publish(context.Background(), New(eventType, source, subject, data)); err != nil {
+		log.Printf("Failed to emit %s event: %v", eventType, err)
+	}
+}
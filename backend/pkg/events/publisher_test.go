@@ -0,0 +1,206 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher keeps published events in memory
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []Event
+	block  chan struct{}
+	closed bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event Event) error {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	p.closed = true
+	return nil
+}
+
+func (p *recordingPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events)
+}
+
+func TestEventValidate(t *testing.T) {
+	valid := New(TypeKeyCreated, "control-flow-api", "42", nil)
+
+	tests := []struct {
+		name    string
+		event   Event
+		wantErr string
+	}{
+		{name: "valid event", event: valid},
+		{name: "missing ID", event: Event{Type: TypeKeyCreated, Source: "x", Time: time.Now()}, wantErr: "ID"},
+		{name: "missing type", event: Event{ID: "evt_1", Source: "x", Time: time.Now()}, wantErr: "type"},
+		{name: "missing source", event: Event{ID: "evt_1", Type: TypeKeyCreated, Time: time.Now()}, wantErr: "source"},
+		{name: "missing time", event: Event{ID: "evt_1", Type: TypeKeyCreated, Source: "x"}, wantErr: "time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.event.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if other := New(TypeKeyCreated, "control-flow-api", "42", nil); other.ID == valid.ID {
+		t.Fatalf("expected unique event IDs, got %s twice", valid.ID)
+	}
+}
+
+func TestLogPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := NewLogPublisher(&buf)
+
+	event := New(TypeQuotaExceeded, "dataflow-api", "agent-1", map[string]interface{}{"limit": "agent_qps"})
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	var decoded Event
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &decoded); err != nil {
+		t.Fatalf("output is not a JSON line: %v", err)
+	}
+	if decoded.ID != event.ID || decoded.Type != TypeQuotaExceeded || decoded.Data["limit"] != "agent_qps" {
+		t.Fatalf("unexpected decoded event: %+v", decoded)
+	}
+}
+
+func TestAsyncPublisherDrainsOnClose(t *testing.T) {
+	next := &recordingPublisher{}
+	publisher := NewAsyncPublisher(next, 10, time.Second)
+
+	for i := 0; i < 5; i++ {
+		if err := publisher.Publish(context.Background(), New(TypeRequestCompleted, "dataflow-api", "agent-1", nil)); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	if err := publisher.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := next.count(); got != 5 {
+		t.Fatalf("expected 5 delivered events, got %d", got)
+	}
+	if !next.closed {
+		t.Fatal("expected wrapped publisher to be closed")
+	}
+	if err := publisher.Publish(context.Background(), New(TypeRequestCompleted, "dataflow-api", "", nil)); err == nil {
+		t.Fatal("expected error publishing after close")
+	}
+}
+
+func TestAsyncPublisherDropsWhenFull(t *testing.T) {
+	next := &recordingPublisher{block: make(chan struct{})}
+	publisher := NewAsyncPublisher(next, 1, time.Second)
+
+	// the first event is picked up by the worker and blocks there, the second fills the buffer
+	publisher.Publish(context.Background(), New(TypeRequestCompleted, "dataflow-api", "", nil))
+	deadline := time.Now().Add(time.Second)
+	for len(publisher.events) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	publisher.Publish(context.Background(), New(TypeRequestCompleted, "dataflow-api", "", nil))
+
+	if err := publisher.Publish(context.Background(), New(TypeRequestCompleted, "dataflow-api", "", nil)); err == nil {
+		t.Fatal("expected error when buffer is full")
+	}
+	if publisher.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", publisher.Dropped())
+	}
+
+	close(next.block)
+	publisher.Close()
+	if got := next.count(); got != 2 {
+		t.Fatalf("expected 2 delivered events, got %d", got)
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{name: "nil config", config: nil, wantErr: true},
+		{name: "default config is noop", config: DefaultConfig()},
+		{name: "log broker", config: &Config{Broker: LogBroker}},
+		{name: "redis broker without stream", config: &Config{Broker: RedisBroker}, wantErr: true},
+		{name: "unsupported broker", config: &Config{Broker: "kafka"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher, err := NewPublisher(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			publisher.Close()
+		})
+	}
+}
+
+func TestEmitUsesDefaultPublisher(t *testing.T) {
+	next := &recordingPublisher{}
+	SetDefault(next, "control-flow-api")
+	defer SetDefault(nil, "")
+
+	Emit(TypeKeyCreated, "7", map[string]interface{}{"kind": "connector_api_key"})
+
+	if next.count() != 1 {
+		t.Fatalf("expected 1 event, got %d", next.count())
+	}
+	event := next.events[0]
+	if event.Source != "control-flow-api" || event.Subject != "7" || event.Type != TypeKeyCreated {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestFanoutPublisher(t *testing.T) {
+	first, second := &recordingPublisher{}, &recordingPublisher{}
+	publisher := NewFanoutPublisher(first, nil, NoopPublisher{}, second)
+
+	if len(publisher.publishers) != 2 {
+		t.Fatalf("expected nil and noop publishers to be skipped, got %d", len(publisher.publishers))
+	}
+	if err := publisher.Publish(context.Background(), New(TypeKeyCreated, "control-flow-api", "1", nil)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	publisher.Close()
+
+	if first.count() != 1 || second.count() != 1 || !first.closed || !second.closed {
+		t.Fatal("expected every publisher to receive the event and be closed")
+	}
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamPublisher appends events to a Redis stream with XADD, consumers
+// read them with XREAD or consumer groups
+type RedisStreamPublisher struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisStreamPublisher creates a Redis streams publisher
+func NewRedisStreamPublisher(config *Config) (*RedisStreamPublisher, error) {
+	if config.Redis == nil || config.Redis.Addr == "" {
+		return nil, fmt.Errorf("redis address cannot be empty")
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.Redis.Addr,
+		Password: config.Redis.Password,
+		DB:       config.Redis.DB,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisStreamPublisher{
+		client: client,
+		stream: config.Stream,
+		maxLen: config.MaxLen,
+	}, nil
+}
+
+// Publish appends the event to the stream; the payload is stored as JSON in the "data" field
+func (p *RedisStreamPublisher) Publish(ctx context.Context, event Event) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	args := &redis.XAddArgs{
+		Stream: p.stream,
+		Values: map[string]interface{}{
+			"id":      event.ID,
+			"type":    string(event.Type),
+			"source":  event.Source,
+			"subject": event.Subject,
+			"time":    event.Time.Format(time.RFC3339Nano),
+			"data":    string(data),
+		},
+	}
+	// trim approximately, exact trimming is much more expensive
+	if p.maxLen > 0 {
+		args.MaxLen = p.maxLen
+		args.Approx = true
+	}
+
+	if err := p.client.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf("failed to add event to stream %s: %w", p.stream, err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection
+func (p *RedisStreamPublisher) Close() error {
+	return p.client.Close()
+}
@@ -0,0 +1,89 @@
+package forecast
+
+// MinTrendPoints days of history needed before a slope is fitted, shorter series are
+// projected at their mean so a single busy day does not dominate the forecast
+const MinTrendPoints = 7
+
+// Trend straight line through a daily series, day 0 is the first day of the series
+type Trend struct {
+	Intercept float64 `json:"intercept"`
+	Slope     float64 `json:"slope"` // change per day
+	Points    int     `json:"points"`
+}
+
+// Fit least squares line through the series
+func Fit(series []float64) Trend {
+	n := len(series)
+	if n == 0 {
+		return Trend{}
+	}
+
+	mean := 0.0
+	for _, value := range series {
+		mean += value
+	}
+	mean /= float64(n)
+	if n < MinTrendPoints {
+		return Trend{Intercept: mean, Points: n}
+	}
+
+	// x runs 0..n-1, its mean is (n-1)/2
+	meanX := float64(n-1) / 2
+	var covariance, variance float64
+	for i, value := range series {
+		dx := float64(i) - meanX
+		covariance += dx * (value - mean)
+		variance += dx * dx
+	}
+	slope := covariance / variance
+
+	return Trend{Intercept: mean - slope*meanX, Slope: slope, Points: n}
+}
+
+// At the fitted value of a day, never negative
+func (t Trend) At(day int) float64 {
+	value := t.Intercept + t.Slope*float64(day)
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+// Project the fitted values of the days following the series
+func (t Trend) Project(days int) []float64 {
+	if days <= 0 {
+		return nil
+	}
+
+	projection := make([]float64, days)
+	for i := range projection {
+		projection[i] = t.At(t.Points + i)
+	}
+	return projection
+}
+
+// Sum total of values
+func Sum(values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+// DaysUntil the number of days of the projection it takes to use up remaining, the
+// day the running total reaches it counts; false when the projection never gets there
+func DaysUntil(projection []float64, remaining float64) (int, bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+
+	total := 0.0
+	for i, value := range projection {
+		total += value
+		if total >= remaining {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
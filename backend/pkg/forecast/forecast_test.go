@@ -0,0 +1,80 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		series        []float64
+		wantIntercept float64
+		wantSlope     float64
+	}{
+		{name: "Empty", series: nil},
+		{name: "Short series uses the mean", series: []float64{10, 20, 60}, wantIntercept: 30},
+		{name: "Constant", series: []float64{5, 5, 5, 5, 5, 5, 5}, wantIntercept: 5},
+		{name: "Linear growth", series: []float64{1, 3, 5, 7, 9, 11, 13, 15}, wantIntercept: 1, wantSlope: 2},
+		{name: "Decline", series: []float64{70, 60, 50, 40, 30, 20, 10}, wantIntercept: 70, wantSlope: -10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trend := Fit(tt.series)
+			if !almostEqual(trend.Intercept, tt.wantIntercept) || !almostEqual(trend.Slope, tt.wantSlope) {
+				t.Errorf("Fit() = %+v, want intercept %v and slope %v", trend, tt.wantIntercept, tt.wantSlope)
+			}
+			if trend.Points != len(tt.series) {
+				t.Errorf("Fit() points = %d, want %d", trend.Points, len(tt.series))
+			}
+		})
+	}
+}
+
+func TestTrendProject(t *testing.T) {
+	growth := Fit([]float64{1, 3, 5, 7, 9, 11, 13})
+	if got := growth.Project(3); len(got) != 3 || !almostEqual(got[0], 15) || !almostEqual(got[2], 19) {
+		t.Errorf("Project() = %v, want [15 17 19]", got)
+	}
+
+	decline := Fit([]float64{70, 60, 50, 40, 30, 20, 10})
+	for i, value := range decline.Project(5) {
+		if value < 0 {
+			t.Errorf("Project()[%d] = %v, want no negative values", i, value)
+		}
+	}
+
+	if got := growth.Project(0); got != nil {
+		t.Errorf("Project(0) = %v, want nil", got)
+	}
+}
+
+func TestDaysUntil(t *testing.T) {
+	projection := []float64{10, 10, 10, 10}
+
+	tests := []struct {
+		name      string
+		remaining float64
+		wantDays  int
+		wantOK    bool
+	}{
+		{name: "Already used up", remaining: 0, wantDays: 0, wantOK: true},
+		{name: "First day", remaining: 5, wantDays: 1, wantOK: true},
+		{name: "Exactly reached", remaining: 30, wantDays: 3, wantOK: true},
+		{name: "Beyond projection", remaining: 100, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, ok := DaysUntil(projection, tt.remaining)
+			if days != tt.wantDays || ok != tt.wantOK {
+				t.Errorf("DaysUntil() = %d, %v, want %d, %v", days, ok, tt.wantDays, tt.wantOK)
+			}
+		})
+	}
+}
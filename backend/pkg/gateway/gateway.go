@@ -0,0 +1,317 @@
+// Package gateway embeds the dataflow pipeline (authentication, rate limits and queues,
+// routing to the agent backends and usage recording) into another Go service. A
+// Gateway is an http.Handler serving the same routes as the dataflow-api binary, so it
+// can be mounted inside the host's own HTTP server.
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-connector/api/dataflow"
+	"agent-connector/config"
+	"agent-connector/internal"
+	"agent-connector/pkg/events"
+	"agent-connector/pkg/i18n"
+	"agent-connector/pkg/openapi"
+	"agent-connector/pkg/ratelimiter"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Option customizes a Gateway created by New
+type Option func(*options)
+
+type options struct {
+	config      *config.Config
+	rateLimiter *ratelimiter.RedisRateLimiter
+	middleware  []gin.HandlerFunc
+	legacy      bool
+	source      string
+	logf        func(format string, args ...interface{})
+}
+
+// WithConfig use this configuration instead of loading it from the config file and
+// the environment
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) { o.config = cfg }
+}
+
+// WithRateLimiter share the host's Redis rate limiter; it is not closed by Close
+func WithRateLimiter(limiter *ratelimiter.RedisRateLimiter) Option {
+	return func(o *options) { o.rateLimiter = limiter }
+}
+
+// WithMiddleware run handlers before the pipeline on every request, e.g. CORS or access
+// logging of the host
+func WithMiddleware(handlers ...gin.HandlerFunc) Option {
+	return func(o *options) { o.middleware = append(o.middleware, handlers...) }
+}
+
+// WithLegacyRoutes serve the deprecated /api/v1/chat endpoint too, off by default
+func WithLegacyRoutes() Option {
+	return func(o *options) { o.legacy = true }
+}
+
+// WithEventSource name the service in published platform events, "dataflow-api" by default
+func WithEventSource(source string) Option {
+	return func(o *options) { o.source = source }
+}
+
+// WithLogf report startup steps and degraded components with logf instead of log.Printf
+func WithLogf(logf func(format string, args ...interface{})) Option {
+	return func(o *options) { o.logf = logf }
+}
+
+// Gateway the dataflow pipeline with the background workers it started
+type Gateway struct {
+	engine *gin.Engine
+
+	rateLimiter     *ratelimiter.RedisRateLimiter
+	ownsRateLimiter bool
+	usageWriter     *internal.UsageWriter
+	eventPublisher  events.Publisher
+
+	// closers stop the other background workers, in start order
+	closers   []func()
+	closeOnce sync.Once
+}
+
+// New connect to the database and Redis, start the background workers and build the
+// routes. Only the database and the usage storage are required; Redis, the event broker,
+// live system config and the lookup cache invalidation degrade with a logged warning
+// like in the standalone service.
+func New(opts ...Option) (*Gateway, error) {
+	o := &options{source: "dataflow-api", logf: log.Printf}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg := o.config
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+	}
+	config.GlobalConfig = cfg
+
+	g := &Gateway{}
+	started := false
+	defer func() {
+		if !started {
+			g.Close()
+		}
+	}()
+
+	if err := internal.InitDatabase(); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	o.logf("✅ Database initialized successfully")
+
+	usageStorage, err := internal.InitUsageStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize usage storage: %w", err)
+	}
+	o.logf("✅ Usage records stored in %s", usageStorage)
+
+	contentKeyring, err := internal.InitContentEncryption()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize content encryption: %w", err)
+	}
+	if contentKeyring != nil {
+		o.logf("✅ Usage content encryption enabled")
+	}
+
+	if g.usageWriter, err = internal.InitUsageWriter(); err != nil {
+		return nil, fmt.Errorf("failed to initialize usage writer: %w", err)
+	}
+	if g.usageWriter != nil {
+		o.logf("✅ Usage writer enabled (batch: %d, overflow: %s)", cfg.Usage.Writer.BatchSize, cfg.Usage.Writer.Overflow)
+	}
+
+	g.rateLimiter = o.rateLimiter
+	if g.rateLimiter == nil {
+		if g.rateLimiter, err = openRateLimiter(cfg, o.logf); err != nil {
+			return nil, err
+		}
+		g.ownsRateLimiter = true
+	}
+
+	if g.eventPublisher, err = internal.InitEventPublisher(o.source); err != nil {
+		o.logf("⚠️  Event publishing disabled: %v", err)
+	} else {
+		o.logf("✅ Event publisher initialized (broker: %s)", cfg.Events.Broker)
+	}
+
+	// Apply system config changes made in control flow without a restart
+	if configSync, err := internal.InitSystemConfigSync(); err != nil {
+		o.logf("⚠️  Live system config disabled: %v", err)
+	} else {
+		g.runInBackground(configSync.Run, func() { configSync.Close() })
+		o.logf("✅ Live system config enabled")
+	}
+
+	// Cache agent and user lookups, dropped when control flow changes them
+	cacheEnabled, err := internal.InitLookupCache()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize lookup cache: %w", err)
+	}
+	if cacheEnabled {
+		if lookupInvalidation, err := internal.InitLookupInvalidation(); err != nil {
+			o.logf("⚠️  Lookup cache entries expire after %s, invalidation disabled: %v", cfg.LookupCache.TTL, err)
+		} else {
+			g.runInBackground(lookupInvalidation.Run, func() { lookupInvalidation.Close() })
+			o.logf("✅ Lookup cache enabled (TTL: %s)", cfg.LookupCache.TTL)
+		}
+	}
+
+	// Health check the upstreams and track forwarded calls with the agent manager
+	if managedAgents, err := dataflow.InitAgentManager(); err != nil {
+		o.logf("⚠️  Agent manager disabled: %v", err)
+	} else if managedAgents != nil {
+		g.closers = append(g.closers, func() { managedAgents.Close() })
+		o.logf("✅ Agent manager enabled (sync interval: %s)", cfg.API.AgentSyncInterval)
+	}
+
+	// Background jobs, their runs are stored with those of the other services
+	scheduler := internal.InitJobs(o.source)
+	g.closers = append(g.closers, func() { scheduler.Close() })
+	if cfg.Jobs.SelfTest != "" {
+		if err := internal.RegisterJob(scheduler, internal.JobAgentSelfTest, "Probe the upstream of every enabled agent", cfg.Jobs.SelfTest, runSelfTestJob); err != nil {
+			return nil, err
+		}
+		o.logf("✅ Agent probes scheduled (%s)", cfg.Jobs.SelfTest)
+	}
+	scheduler.Start()
+
+	g.engine = newEngine(cfg, g.rateLimiter, o)
+	started = true
+	return g, nil
+}
+
+// runSelfTestJob probe every enabled agent, failing when one of them is not ready
+func runSelfTestJob(ctx context.Context) (string, error) {
+	report, err := dataflow.RunSelfTest(ctx)
+	if err != nil {
+		return "", err
+	}
+	var failed []string
+	for _, result := range report.Agents {
+		if result.Status == internal.ValidationFailed {
+			failed = append(failed, result.AgentID)
+		}
+	}
+	summary := fmt.Sprintf("%d agents probed, %d not ready", len(report.Agents), len(failed))
+	if len(failed) > 0 {
+		return summary, fmt.Errorf("agents not ready: %s", strings.Join(failed, ", "))
+	}
+	return summary, nil
+}
+
+// openRateLimiter connect the Redis rate limiter, starting degraded with local limits
+// when Redis is unreachable
+func openRateLimiter(cfg *config.Config, logf func(format string, args ...interface{})) (*ratelimiter.RedisRateLimiter, error) {
+	// the per-user defaults resolve their QPS per request
+	rateLimiterConfig := &ratelimiter.Config{
+		Rate:  float64(cfg.Security.DefaultRateLimit),
+		Burst: cfg.Security.DefaultRateLimit * 2,
+		Redis: &ratelimiter.RedisConfig{
+			Addr:            cfg.Redis.Addr,
+			Password:        cfg.Redis.Password,
+			DB:              cfg.Redis.DB,
+			PoolSize:        10,
+			MinIdleConns:    2,
+			ConnMaxIdleTime: 30 * time.Minute,
+		},
+	}
+
+	limiter, err := ratelimiter.NewRedisRateLimiter(rateLimiterConfig)
+	if err == nil {
+		logf("✅ Redis rate limiter initialized successfully")
+		return limiter, nil
+	}
+
+	// the limiter connects once Redis is back
+	logf("⚠️  Redis is unreachable, starting with degraded local rate limits: %v", err)
+	limiter, err = ratelimiter.OpenRedisRateLimiter(rateLimiterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Redis rate limiter: %w", err)
+	}
+	return limiter, nil
+}
+
+// newEngine the router of the pipeline: the host's middleware, then recovery, the route
+// timeouts and the body size limit, then the dataflow routes
+func newEngine(cfg *config.Config, rateLimiter *ratelimiter.RedisRateLimiter, o *options) *gin.Engine {
+	engine := gin.New()
+	engine.Use(o.middleware...)
+	engine.Use(gin.Recovery())
+
+	// Messages in the language of Accept-Language
+	engine.Use(i18n.Middleware())
+
+	// Per-route timeouts, replacing the server-wide write timeout
+	engine.Use(dataflow.RouteTimeoutMiddleware(cfg.API))
+
+	// Request body size limit
+	engine.Use(func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.API.MaxRequestBodySize)
+		c.Next()
+	})
+
+	dataflow.SetupBackendRoutes(engine, rateLimiter)
+	if o.legacy {
+		dataflow.SetupLegacyRoutes(engine, rateLimiter)
+	}
+
+	// Machine-readable API description
+	engine.GET(openapi.SpecPath, openapi.GinHandler(dataflow.NewOpenAPIGenerator(), engine))
+	return engine
+}
+
+// runInBackground run a worker until Close, which cancels it and calls stop
+func (g *Gateway) runInBackground(run func(context.Context), stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go run(ctx)
+	g.closers = append(g.closers, func() {
+		cancel()
+		stop()
+	})
+}
+
+// ServeHTTP serve a request through the pipeline
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.engine.ServeHTTP(w, r)
+}
+
+// Engine the router of the gateway, for the host to add its own routes. Requests no
+// route matches are forwarded to agents with passthrough enabled.
+func (g *Gateway) Engine() *gin.Engine {
+	return g.engine
+}
+
+// Close write the buffered usage records and events, then stop the background workers;
+// call it after the HTTP server stopped serving the gateway
+func (g *Gateway) Close() error {
+	g.closeOnce.Do(func() {
+		if g.usageWriter != nil {
+			g.usageWriter.Close()
+		}
+		if g.eventPublisher != nil {
+			g.eventPublisher.Close()
+		}
+		for i := len(g.closers) - 1; i >= 0; i-- {
+			g.closers[i]()
+		}
+		if g.ownsRateLimiter && g.rateLimiter != nil {
+			g.rateLimiter.Close()
+		}
+	})
+	return nil
+}
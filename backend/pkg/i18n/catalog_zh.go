@@ -0,0 +1,314 @@
+package i18n
+
+// chineseMessages Simplified Chinese translations of the response messages of the
+// control flow, auth and dataflow APIs
+var chineseMessages = map[string]string{
+	// agents
+	"Access list cleared successfully":    "访问列表已清除",
+	"Access list retrieved successfully":  "获取访问列表成功",
+	"Access list updated successfully":    "访问列表更新成功",
+	"Agent ID must be a valid number":     "智能体 ID 必须是有效的数字",
+	"Agent config retrieved successfully": "获取智能体配置成功",
+	"Agent created successfully, store the connector API key now: it will not be shown again": "智能体创建成功，请立即保存连接器 API 密钥：它不会再次显示",
+	"Agent deleted successfully":                                          "智能体删除成功",
+	"Agent not found":                                                     "未找到智能体",
+	"Agent retrieved successfully":                                        "获取智能体成功",
+	"Agent updated successfully":                                          "智能体更新成功",
+	"Agent was changed by someone else":                                   "智能体已被他人修改",
+	"Agents retrieved successfully":                                       "获取智能体列表成功",
+	"Connector API key rotated, store it now: it will not be shown again": "连接器 API 密钥已轮换，请立即保存：它不会再次显示",
+	"Failed to create agent":                                              "创建智能体失败",
+	"Failed to delete agent":                                              "删除智能体失败",
+	"Failed to get agent":                                                 "获取智能体失败",
+	"Failed to get updated agent":                                         "获取更新后的智能体失败",
+	"Failed to list agents":                                               "获取智能体列表失败",
+	"Failed to rotate connector API key":                                  "轮换连接器 API 密钥失败",
+	"Failed to rotate signing secret":                                     "轮换签名密钥失败",
+	"Failed to update access list":                                        "更新访问列表失败",
+	"Failed to update agent":                                              "更新智能体失败",
+	"Invalid agent ID":                                                    "无效的智能体 ID",
+	"Invalid agent configuration":                                         "无效的智能体配置",
+	"Signing secret rotated, store it now: it will not be shown again":    "签名密钥已轮换，请立即保存：它不会再次显示",
+
+	// sync
+	"Drift detected":                      "检测到配置漂移",
+	"Failed to apply sync":                "应用同步失败",
+	"Failed to check drift":               "检查配置漂移失败",
+	"Failed to export platform spec":      "导出平台配置失败",
+	"Failed to import platform spec":      "导入平台配置失败",
+	"Failed to plan sync":                 "规划同步失败",
+	"Invalid sync spec":                   "无效的同步规范",
+	"No drift detected":                   "未检测到配置漂移",
+	"Platform spec exported successfully": "平台配置导出成功",
+
+	// authentication and sessions
+	"Authentication required":                           "需要身份验证",
+	"Authentication service health check":               "认证服务健康检查",
+	"Authentication service information":                "认证服务信息",
+	"Expired sessions cleaned up successfully":          "过期会话清理成功",
+	"Failed to cleanup expired sessions":                "清理过期会话失败",
+	"Failed to create session":                          "创建会话失败",
+	"Failed to introspect token":                        "校验令牌失败",
+	"Failed to list sessions":                           "获取会话列表失败",
+	"Failed to log out user":                            "注销用户失败",
+	"Failed to revoke session":                          "撤销会话失败",
+	"Failed to revoke sessions":                         "撤销会话失败",
+	"Insufficient permissions":                          "权限不足",
+	"Invalid or expired token":                          "令牌无效或已过期",
+	"Invalid session ID":                                "无效的会话 ID",
+	"Login failed":                                      "登录失败",
+	"Login successful":                                  "登录成功",
+	"Login verification failed":                         "登录验证失败",
+	"Login verification required":                       "需要验证登录",
+	"Logout successful":                                 "注销成功",
+	"Missing or invalid authorization token":            "缺少授权令牌或令牌无效",
+	"Other sessions revoked successfully":               "其他会话已撤销",
+	"Session ID must be a valid number":                 "会话 ID 必须是有效的数字",
+	"Session revoked successfully":                      "会话撤销成功",
+	"Sessions retrieved successfully":                   "获取会话列表成功",
+	"Token is active":                                   "令牌有效",
+	"Token is not active":                               "令牌无效",
+	"You don't have permission to access this resource": "您无权访问此资源",
+	"You don't have permission to perform this action":  "您无权执行此操作",
+
+	// impersonation
+	"Failed to get impersonation logs":                        "获取代入日志失败",
+	"Failed to impersonate user":                              "代入用户失败",
+	"Impersonation logs retrieved successfully":               "获取代入日志成功",
+	"Impersonation session created successfully":              "代入会话创建成功",
+	"Not allowed while impersonating":                         "代入期间不允许此操作",
+	"This action is not available to impersonation sessions":  "代入会话无法执行此操作",
+	"impersonating admin is no longer allowed to impersonate": "发起代入的管理员已无权代入",
+
+	// users
+	"Failed to build password hash report":        "生成密码哈希报告失败",
+	"Failed to change password":                   "修改密码失败",
+	"Failed to create user":                       "创建用户失败",
+	"Failed to delete user":                       "删除用户失败",
+	"Failed to get login logs":                    "获取登录日志失败",
+	"Failed to get settings":                      "获取设置失败",
+	"Failed to list users":                        "获取用户列表失败",
+	"Failed to update profile":                    "更新个人资料失败",
+	"Failed to update settings":                   "更新设置失败",
+	"Failed to update user status":                "更新用户状态失败",
+	"Failed to update user":                       "更新用户失败",
+	"Invalid user ID":                             "无效的用户 ID",
+	"Login logs retrieved successfully":           "获取登录日志成功",
+	"Password changed successfully":               "密码修改成功",
+	"Password hash report retrieved successfully": "获取密码哈希报告成功",
+	"Profile retrieved successfully":              "获取个人资料成功",
+	"Profile updated successfully":                "个人资料更新成功",
+	"Settings retrieved successfully":             "获取设置成功",
+	"Settings updated successfully":               "设置更新成功",
+	"User ID must be a valid number":              "用户 ID 必须是有效的数字",
+	"User account is not active":                  "用户账户未激活",
+	"User created successfully":                   "用户创建成功",
+	"User deleted successfully":                   "用户删除成功",
+	"User logged out successfully":                "用户已注销",
+	"User not authenticated":                      "用户未认证",
+	"User not found in context":                   "上下文中未找到用户",
+	"User not found":                              "未找到用户",
+	"User registered successfully":                "用户注册成功",
+	"User retrieved successfully":                 "获取用户成功",
+	"User status updated successfully":            "用户状态更新成功",
+	"User updated successfully":                   "用户更新成功",
+	"User was changed by someone else":            "用户已被他人修改",
+	"Users retrieved successfully":                "获取用户列表成功",
+	"Your account has been deactivated":           "您的账户已被停用",
+
+	// system config
+	"Database connection not established":       "数据库连接未建立",
+	"Database not available":                    "数据库不可用",
+	"Failed to get system config":               "获取系统配置失败",
+	"Failed to get updated system config":       "获取更新后的系统配置失败",
+	"Failed to update system config":            "更新系统配置失败",
+	"System config retrieved successfully":      "获取系统配置成功",
+	"System config updated successfully":        "系统配置更新成功",
+	"System config was changed by someone else": "系统配置已被他人修改",
+	"System statistics retrieved successfully":  "获取系统统计成功",
+
+	// queues
+	"Failed to delete queue config":       "删除队列配置失败",
+	"Failed to get queue config":          "获取队列配置失败",
+	"Failed to update queue config":       "更新队列配置失败",
+	"Queue config deleted successfully":   "队列配置删除成功",
+	"Queue config retrieved successfully": "获取队列配置成功",
+
+	// usage
+	"Failed to get usage forecast":            "获取用量预测失败",
+	"Failed to get usage quality":             "获取用量质量失败",
+	"Failed to get usage record":              "获取用量记录失败",
+	"Failed to list usage records":            "获取用量记录列表失败",
+	"Failed to re-encrypt usage content":      "重新加密用量内容失败",
+	"Failed to refresh usage forecast":        "刷新用量预测失败",
+	"Failed to replay usage record":           "重放用量记录失败",
+	"Failed to summarize usage":               "汇总用量失败",
+	"Invalid usage record ID":                 "无效的用量记录 ID",
+	"Usage content re-encrypted successfully": "用量内容重新加密成功",
+	"Usage forecast refreshed successfully":   "用量预测刷新成功",
+	"Usage forecast retrieved successfully":   "获取用量预测成功",
+	"Usage quality retrieved successfully":    "获取用量质量成功",
+	"Usage record ID must be a valid number":  "用量记录 ID 必须是有效的数字",
+	"Usage record replayed successfully":      "用量记录重放成功",
+	"Usage record retrieved successfully":     "获取用量记录成功",
+	"Usage records retrieved successfully":    "获取用量记录列表成功",
+	"Usage summary retrieved successfully":    "获取用量汇总成功",
+
+	// golden prompts
+	"Failed to list golden prompts":         "获取黄金提示列表失败",
+	"Failed to list golden runs":            "获取黄金运行列表失败",
+	"Golden prompt created successfully":    "黄金提示创建成功",
+	"Golden prompt deleted successfully":    "黄金提示删除成功",
+	"Golden prompt retrieved successfully":  "获取黄金提示成功",
+	"Golden prompt updated successfully":    "黄金提示更新成功",
+	"Golden prompts retrieved successfully": "获取黄金提示列表成功",
+	"Golden run retrieved successfully":     "获取黄金运行成功",
+	"Golden run started":                    "黄金运行已开始",
+	"Golden runs retrieved successfully":    "获取黄金运行列表成功",
+
+	// key tiers
+	"Failed to list key tiers":           "获取密钥等级列表失败",
+	"Invalid key tier ID":                "无效的密钥等级 ID",
+	"Key tier ID must be a valid number": "密钥等级 ID 必须是有效的数字",
+	"Key tier created successfully":      "密钥等级创建成功",
+	"Key tier deleted successfully":      "密钥等级删除成功",
+	"Key tier retrieved successfully":    "获取密钥等级成功",
+	"Key tier updated successfully":      "密钥等级更新成功",
+	"Key tiers retrieved successfully":   "获取密钥等级列表成功",
+
+	// maintenance windows
+	"Failed to list maintenance windows":           "获取维护窗口列表失败",
+	"Invalid maintenance window ID":                "无效的维护窗口 ID",
+	"Maintenance window ID must be a valid number": "维护窗口 ID 必须是有效的数字",
+	"Maintenance window created successfully":      "维护窗口创建成功",
+	"Maintenance window deleted successfully":      "维护窗口删除成功",
+	"Maintenance window retrieved successfully":    "获取维护窗口成功",
+	"Maintenance window updated successfully":      "维护窗口更新成功",
+	"Maintenance windows retrieved successfully":   "获取维护窗口列表成功",
+
+	// notification channels
+	"Failed to list notification channels":           "获取通知渠道列表失败",
+	"Failed to send test notification":               "发送测试通知失败",
+	"Invalid notification channel ID":                "无效的通知渠道 ID",
+	"Notification channel ID must be a valid number": "通知渠道 ID 必须是有效的数字",
+	"Notification channel created successfully":      "通知渠道创建成功",
+	"Notification channel deleted successfully":      "通知渠道删除成功",
+	"Notification channel retrieved successfully":    "获取通知渠道成功",
+	"Notification channel updated successfully":      "通知渠道更新成功",
+	"Notification channels retrieved successfully":   "获取通知渠道列表成功",
+	"Test notification sent successfully":            "测试通知发送成功",
+
+	// playground tokens
+	"Failed to issue playground token":                                  "签发试用令牌失败",
+	"Failed to list playground tokens":                                  "获取试用令牌列表失败",
+	"Failed to revoke playground token":                                 "撤销试用令牌失败",
+	"Invalid playground token ID":                                       "无效的试用令牌 ID",
+	"Playground token ID must be a valid number":                        "试用令牌 ID 必须是有效的数字",
+	"Playground token issued, store it now: it will not be shown again": "试用令牌已签发，请立即保存：它不会再次显示",
+	"Playground token revoked successfully":                             "试用令牌撤销成功",
+	"Playground tokens retrieved successfully":                          "获取试用令牌列表成功",
+
+	// quota pools
+	"Failed to get quota pool usage":          "获取配额池用量失败",
+	"Failed to list quota pools":              "获取配额池列表失败",
+	"Invalid quota pool ID":                   "无效的配额池 ID",
+	"Quota pool ID must be a valid number":    "配额池 ID 必须是有效的数字",
+	"Quota pool created successfully":         "配额池创建成功",
+	"Quota pool deleted successfully":         "配额池删除成功",
+	"Quota pool retrieved successfully":       "获取配额池成功",
+	"Quota pool updated successfully":         "配额池更新成功",
+	"Quota pool usage retrieved successfully": "获取配额池用量成功",
+	"Quota pools retrieved successfully":      "获取配额池列表成功",
+
+	// sandbox
+	"Failed to create sandbox agent": "创建沙箱智能体失败",
+	"Failed to delete sandbox agent": "删除沙箱智能体失败",
+	"Failed to list sandbox agents":  "获取沙箱智能体列表失败",
+	"Sandbox agent created successfully, store the connector API key now: it will not be shown again": "沙箱智能体创建成功，请立即保存连接器 API 密钥：它不会再次显示",
+	"Sandbox agent deleted successfully":    "沙箱智能体删除成功",
+	"Sandbox agents retrieved successfully": "获取沙箱智能体列表成功",
+
+	// background jobs
+	"Background jobs not available":   "后台任务不可用",
+	"Failed to list job runs":         "获取任务运行记录失败",
+	"Failed to trigger job":           "触发任务失败",
+	"Job runs retrieved successfully": "获取任务运行记录成功",
+	"Job triggered":                   "任务已触发",
+	"Jobs retrieved successfully":     "获取任务列表成功",
+
+	// requests
+	"Invalid list parameters": "无效的列表参数",
+	"Invalid merge patch":     "无效的合并补丁",
+	"Invalid request format":  "无效的请求格式",
+
+	// dataflow
+	"Endpoint retired":                     "接口已停用",
+	"Error":                                "错误",
+	"Error injected by chaos testing":      "混沌测试注入的错误",
+	"Feature not enabled":                  "功能未启用",
+	"Outside access window":                "不在访问时间窗口内",
+	"Queue full":                           "队列已满",
+	"Quota exceeded":                       "超出配额",
+	"Rate limit exceeded":                  "超出速率限制",
+	"Rate limit injected by chaos testing": "混沌测试注入的速率限制",
+	"Request limit exceeded":               "超出请求限制",
+	"Request timed out":                    "请求超时",
+	"Too many concurrent streams":          "并发流过多",
+	"Under maintenance":                    "系统维护中",
+}
+
+// chineseErrorTitles Simplified Chinese descriptions of the error types
+var chineseErrorTitles = map[string]string{
+	"access_denied":              "拒绝访问",
+	"aggregate_only":             "仅提供汇总数据",
+	"authentication_error":       "身份验证错误",
+	"authentication_failed":      "身份验证失败",
+	"authorization_error":        "授权错误",
+	"chaos_injected_error":       "混沌测试注入的错误",
+	"cleanup_error":              "清理错误",
+	"context_length_exceeded":    "超出上下文长度",
+	"creation_error":             "创建错误",
+	"database_error":             "数据库错误",
+	"deletion_error":             "删除错误",
+	"delivery_error":             "投递错误",
+	"endpoint_sunset":            "接口已停用",
+	"feature_not_enabled":        "功能未启用",
+	"generation_stopped":         "生成已停止",
+	"internal_error":             "内部错误",
+	"invalid_metadata":           "无效的元数据",
+	"invalid_request":            "无效的请求",
+	"job_running":                "任务正在运行",
+	"maintenance":                "系统维护中",
+	"not_found":                  "未找到",
+	"outside_access_window":      "不在访问时间窗口内",
+	"parameter_limit_exceeded":   "超出参数限制",
+	"parameter_not_allowed":      "不允许的参数",
+	"password_error":             "密码错误",
+	"playground_scope_violation": "超出试用令牌范围",
+	"processing_error":           "处理错误",
+	"queue_full":                 "队列已满",
+	"quota_exceeded":             "超出配额",
+	"rate_limit_error":           "速率限制错误",
+	"rate_limit_exceeded":        "超出速率限制",
+	"rate_limited":               "请求过于频繁",
+	"registration_error":         "注册错误",
+	"request_limit_exceeded":     "超出请求限制",
+	"request_not_found":          "未找到请求",
+	"request_timeout":            "请求超时",
+	"service_unavailable":        "服务不可用",
+	"session_error":              "会话错误",
+	"signature_not_configured":   "未配置签名",
+	"signature_replayed":         "签名已被使用",
+	"state_changed":              "状态已变更",
+	"stream_limit_exceeded":      "超出并发流限制",
+	"sync_error":                 "同步错误",
+	"update_error":               "更新错误",
+	"upstream_auth_failed":       "上游认证失败",
+	"upstream_error":             "上游错误",
+	"upstream_timeout":           "上游超时",
+	"upstream_unavailable":       "上游不可用",
+	"usage_error":                "用量错误",
+	"validation_error":           "验证错误",
+	"verification_required":      "需要验证",
+	"version_conflict":           "版本冲突",
+}
@@ -0,0 +1,125 @@
+// Package i18n translates the user-facing messages of API responses into the language a
+// client asks for with Accept-Language. Messages are written in English and looked up in
+// the catalogs by their English text; error types and codes are never translated, so
+// clients keep matching on them whatever the language.
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported languages
+const (
+	English = "en"
+	Chinese = "zh"
+)
+
+// DefaultLanguage the language of the source messages, answered when a client accepts
+// none of the supported languages
+const DefaultLanguage = English
+
+// catalogs translated messages per language, keyed by their English text
+var catalogs = map[string]map[string]string{
+	Chinese: chineseMessages,
+}
+
+// errorTitles short descriptions of error types per language, put in front of error
+// messages the catalog has no translation for
+var errorTitles = map[string]map[string]string{
+	Chinese: chineseErrorTitles,
+}
+
+// titleSeparators the separator between an error title and the original message
+var titleSeparators = map[string]string{
+	Chinese: "：",
+}
+
+// Supported whether lang is one of the supported languages
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok || lang == DefaultLanguage
+}
+
+// languageRange one entry of an Accept-Language header
+type languageRange struct {
+	tag     string
+	quality float64
+}
+
+// Match the supported language an Accept-Language header prefers, the default language
+// when it accepts none of them. Regional tags fall back to their language, zh-CN and
+// zh-TW both select zh.
+func Match(acceptLanguage string) string {
+	var ranges []languageRange
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		// q=0 marks a language as not acceptable
+		if quality <= 0 {
+			continue
+		}
+		ranges = append(ranges, languageRange{tag: tag, quality: quality})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, r := range ranges {
+		if r.tag == "*" {
+			return DefaultLanguage
+		}
+		base, _, _ := strings.Cut(r.tag, "-")
+		if Supported(base) {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// Translate a message into lang; ok is false when the catalog has no translation, the
+// message is returned unchanged then
+func Translate(lang, message string) (string, bool) {
+	translated, ok := catalogs[lang][message]
+	if !ok {
+		return message, false
+	}
+	return translated, true
+}
+
+// ErrorTitle the description of an error type in lang, ok is false when there is none
+func ErrorTitle(lang, errorType string) (string, bool) {
+	title, ok := errorTitles[lang][errorType]
+	return title, ok
+}
+
+// LocalizeError the message of an error of errorType in lang: its translation, or the
+// translated title of the type followed by the original message, which often carries
+// details no catalog can know, like field names or upstream errors
+func LocalizeError(lang, errorType, message string) string {
+	if translated, ok := Translate(lang, message); ok {
+		return translated
+	}
+	title, ok := ErrorTitle(lang, errorType)
+	if !ok {
+		return message
+	}
+	if message == "" {
+		return title
+	}
+	separator, ok := titleSeparators[lang]
+	if !ok {
+		separator = ": "
+	}
+	return title + separator + message
+}
@@ -0,0 +1,164 @@
+package i18n
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", English},
+		{"zh", Chinese},
+		{"zh-CN,zh;q=0.9,en;q=0.8", Chinese},
+		{"zh-TW", Chinese},
+		{"en-US,en;q=0.9,zh;q=0.8", English},
+		{"fr-FR,zh;q=0.5", Chinese},
+		{"fr, de", English},
+		{"en;q=0.3, zh;q=0.7", Chinese},
+		{"zh;q=0, en", English},
+		{"*", English},
+		{"zh;q=abc", English},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLocalizeError(t *testing.T) {
+	tests := []struct {
+		lang, errorType, message string
+		want                     string
+	}{
+		{Chinese, "not_found", "Agent not found", "未找到智能体"},
+		{Chinese, "validation_error", "name is required", "验证错误：name is required"},
+		{Chinese, "validation_error", "", "验证错误"},
+		{Chinese, "unknown_type", "something broke", "something broke"},
+		{English, "validation_error", "name is required", "name is required"},
+	}
+	for _, tt := range tests {
+		if got := LocalizeError(tt.lang, tt.errorType, tt.message); got != tt.want {
+			t.Errorf("LocalizeError(%q, %q, %q) = %q, want %q", tt.lang, tt.errorType, tt.message, got, tt.want)
+		}
+	}
+}
+
+// newTestRouter a router with the middleware and a handler answering with handler
+func newTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/", handler)
+	return router
+}
+
+// serve a GET / with the Accept-Language header
+func serve(router *gin.Engine, acceptLanguage string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_TranslatesJSON(t *testing.T) {
+	router := newTestRouter(func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Agent not found",
+			"error":   gin.H{"type": "not_found", "code": "404", "message": "agent 42 does not exist"},
+		})
+	})
+
+	w := serve(router, "zh-CN,zh;q=0.9")
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+	var body struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Error   struct {
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON body %q: %v", w.Body.String(), err)
+	}
+	if body.Message != "未找到智能体" {
+		t.Errorf("message = %q, want the translation", body.Message)
+	}
+	if body.Error.Message != "未找到：agent 42 does not exist" {
+		t.Errorf("error.message = %q, want the titled original", body.Error.Message)
+	}
+	// machine-readable fields stay as they are
+	if body.Code != 404 || body.Error.Type != "not_found" || body.Error.Code != "404" {
+		t.Errorf("Expected code and type untouched, got %+v", body)
+	}
+	if got := w.Header().Get("Content-Language"); got != Chinese {
+		t.Errorf("Content-Language = %q, want %q", got, Chinese)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Language" {
+		t.Errorf("Vary = %q, want Accept-Language", got)
+	}
+}
+
+func TestMiddleware_English(t *testing.T) {
+	router := newTestRouter(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Agent retrieved successfully"})
+	})
+
+	w := serve(router, "en-US")
+
+	if w.Body.String() != `{"message":"Agent retrieved successfully"}` {
+		t.Errorf("Expected the body untouched, got %s", w.Body.String())
+	}
+	if got := w.Header().Get("Content-Language"); got != "" {
+		t.Errorf("Expected no Content-Language, got %q", got)
+	}
+}
+
+func TestMiddleware_UntranslatedBodyUnchanged(t *testing.T) {
+	// numbers and key order are kept when there is nothing to translate
+	const body = `{"value":12345678901234567890,"message":"no catalog entry"}`
+	router := newTestRouter(func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(body))
+	})
+
+	w := serve(router, "zh")
+
+	if w.Body.String() != body {
+		t.Errorf("Expected the body untouched, got %s", w.Body.String())
+	}
+}
+
+func TestMiddleware_StreamPassesThrough(t *testing.T) {
+	const event = "data: {\"message\":\"Agent not found\"}\n\n"
+	router := newTestRouter(func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		c.Writer.WriteString(event)
+		c.Writer.Flush()
+	})
+
+	w := serve(router, "zh")
+
+	if w.Body.String() != event {
+		t.Errorf("Expected the event untouched, got %q", w.Body.String())
+	}
+	if !w.Flushed {
+		t.Error("Expected the stream to be flushed")
+	}
+}
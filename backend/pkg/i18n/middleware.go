@@ -0,0 +1,159 @@
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey gin context key of the negotiated language
+const contextKey = "i18n.language"
+
+// Middleware negotiate the language of each request from its Accept-Language header and
+// translate the messages of its JSON response: the top-level message and the message of
+// the error object. Other responses, event streams among them, pass through untouched.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := Match(c.GetHeader("Accept-Language"))
+		c.Set(contextKey, lang)
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		if lang == DefaultLanguage {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &translatingWriter{ResponseWriter: original, lang: lang}
+		c.Writer = writer
+		defer func() { c.Writer = original }()
+
+		c.Next()
+		writer.finish()
+	}
+}
+
+// Language the language negotiated for the request, the default language on routes
+// without the middleware
+func Language(c *gin.Context) string {
+	if lang := c.GetString(contextKey); lang != "" {
+		return lang
+	}
+	return DefaultLanguage
+}
+
+// translatingWriter holds back JSON bodies until the handlers are done, so their
+// messages can be translated as a whole
+type translatingWriter struct {
+	gin.ResponseWriter
+	lang string
+
+	decided bool
+	buffer  *bytes.Buffer // nil unless the body is held back
+}
+
+// Write implements http.ResponseWriter
+func (w *translatingWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		if isJSON(w.Header().Get("Content-Type")) {
+			w.buffer = &bytes.Buffer{}
+		}
+	}
+	if w.buffer != nil {
+		return w.buffer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter
+func (w *translatingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written whether the response was started, held back bodies included, so handlers do
+// not answer twice
+func (w *translatingWriter) Written() bool {
+	return w.buffer != nil || w.ResponseWriter.Written()
+}
+
+// Size the bytes of the body written so far
+func (w *translatingWriter) Size() int {
+	if w.buffer != nil {
+		return w.buffer.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// Flush implements http.Flusher; a held back body is flushed once it is translated
+func (w *translatingWriter) Flush() {
+	if w.buffer != nil {
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap the underlying writer, for http.ResponseController
+func (w *translatingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish write the held back body, translated when any of its messages are
+func (w *translatingWriter) finish() {
+	if w.buffer == nil {
+		return
+	}
+	body := w.buffer.Bytes()
+	w.buffer = nil
+	if translated := translateBody(w.lang, body); translated != nil {
+		body = translated
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Language", w.lang)
+	}
+	w.ResponseWriter.Write(body)
+}
+
+// isJSON whether a Content-Type is a JSON document
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// translateBody the JSON body with its messages translated, nil when it is no JSON object
+// or none of its messages has a translation
+func translateBody(lang string, body []byte) []byte {
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keep numbers as they were written
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil || document == nil {
+		return nil
+	}
+
+	changed := false
+	if message, ok := document["message"].(string); ok {
+		if translated, ok := Translate(lang, message); ok {
+			document["message"] = translated
+			changed = true
+		}
+	}
+	if apiErr, ok := document["error"].(map[string]interface{}); ok {
+		message, _ := apiErr["message"].(string)
+		errorType, _ := apiErr["type"].(string)
+		if localized := LocalizeError(lang, errorType, message); localized != message {
+			apiErr["message"] = localized
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	translated, err := json.Marshal(document)
+	if err != nil {
+		return nil
+	}
+	return translated
+}
@@ -0,0 +1,326 @@
+// Package jobs runs the background tasks of a service on schedules and keeps track of
+// them: the runs of every job with their outcome, the last error and the next run time.
+// Jobs can also be triggered by hand, a job never runs twice at the same time.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// DefaultHistory runs kept per job when the scheduler is created without a size
+const DefaultHistory = 20
+
+// Errors of Trigger
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job is already running")
+)
+
+// Func the work of a job, the result is a short summary of what it did
+type Func func(ctx context.Context) (string, error)
+
+// Job a background task
+type Job struct {
+	Name        string
+	Description string
+	Schedule    Schedule // nil runs the job on manual trigger only
+	Run         Func
+
+	// RunAtStart also runs a scheduled job right when the scheduler starts
+	RunAtStart bool
+}
+
+// Run one execution of a job
+type Run struct {
+	Job        string        `json:"job"`
+	Trigger    string        `json:"trigger"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration_ns"`
+	Result     string        `json:"result,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Status state of a job
+type Status struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Schedule    string     `json:"schedule"`
+	Running     bool       `json:"running"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastRun     *Run       `json:"last_run,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+	History     []Run      `json:"history"`
+}
+
+// Recorder stores finished runs, so their history outlives the process
+type Recorder interface {
+	RecordRun(run *Run) error
+}
+
+// entry a registered job and its state
+type entry struct {
+	job     Job
+	running bool
+	nextRun time.Time
+	history []Run // newest last
+	runs    int
+	fails   int
+
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Scheduler runs registered jobs on their schedules
+type Scheduler struct {
+	recorder Recorder
+	history  int
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	wg      sync.WaitGroup
+}
+
+// NewScheduler create a scheduler keeping history runs per job in memory, recorder may
+// be nil
+func NewScheduler(recorder Recorder, history int) *Scheduler {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		recorder: recorder,
+		history:  history,
+		jobs:     make(map[string]*entry),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Register add a job, it is scheduled right away when the scheduler is started
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job needs a name and a run function")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("job %q is already registered", job.Name)
+	}
+	e := &entry{job: job}
+	s.jobs[job.Name] = e
+	if s.started {
+		s.schedule(e)
+	}
+	return nil
+}
+
+// Start run the registered jobs on their schedules until Close
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, e := range s.jobs {
+		s.schedule(e)
+	}
+}
+
+// schedule start the loop of a scheduled job, s.mu must be held
+func (s *Scheduler) schedule(e *entry) {
+	if e.job.Schedule == nil {
+		return
+	}
+	s.wg.Add(1)
+	go s.loop(e)
+}
+
+// loop wait for each run time of a job and run it
+func (s *Scheduler) loop(e *entry) {
+	defer s.wg.Done()
+	if e.job.RunAtStart && s.claim(e) {
+		s.execute(e, TriggerSchedule)
+	}
+	for {
+		s.mu.Lock()
+		next := e.job.Schedule.Next(time.Now())
+		e.nextRun = next
+		s.mu.Unlock()
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			// a run still going, e.g. a manual one, makes this one skip
+			if s.claim(e) {
+				s.execute(e, TriggerSchedule)
+			}
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Trigger run a job now in the background
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	if !s.claim(e) {
+		return ErrJobRunning
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(e, TriggerManual)
+	}()
+	return nil
+}
+
+// claim mark a job running, false when it already is
+func (s *Scheduler) claim(e *entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.running {
+		return false
+	}
+	e.running = true
+	return true
+}
+
+// execute run a claimed job and record the run
+func (s *Scheduler) execute(e *entry, trigger string) {
+	run := Run{Job: e.job.Name, Trigger: trigger, StartedAt: time.Now()}
+	result, err := safeRun(s.ctx, e.job.Run)
+	run.FinishedAt = time.Now()
+	run.Duration = run.FinishedAt.Sub(run.StartedAt)
+	run.Result = result
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Job %s failed: %v", e.job.Name, err)
+	}
+
+	s.mu.Lock()
+	e.running = false
+	e.runs++
+	if err != nil {
+		e.fails++
+		e.lastError = run.Error
+		e.lastErrorAt = run.FinishedAt
+	}
+	e.history = append(e.history, run)
+	if len(e.history) > s.history {
+		e.history = e.history[len(e.history)-s.history:]
+	}
+	s.mu.Unlock()
+
+	if s.recorder != nil {
+		if err := s.recorder.RecordRun(&run); err != nil {
+			log.Printf("Failed to record run of job %s: %v", e.job.Name, err)
+		}
+	}
+}
+
+// safeRun run a job, turning a panic into an error so the scheduler keeps going
+func safeRun(ctx context.Context, run Func) (result string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return run(ctx)
+}
+
+// Jobs the status of every job, sorted by name
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		statuses = append(statuses, s.status(e))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Job the status of one job
+func (s *Scheduler) Job(name string) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.jobs[name]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	status := s.status(e)
+	return &status, nil
+}
+
+// status snapshot of a job, s.mu must be held
+func (s *Scheduler) status(e *entry) Status {
+	status := Status{
+		Name:        e.job.Name,
+		Description: e.job.Description,
+		Running:     e.running,
+		LastError:   e.lastError,
+		Runs:        e.runs,
+		Failures:    e.fails,
+		History:     make([]Run, len(e.history)),
+	}
+	// newest first
+	for i, run := range e.history {
+		status.History[len(e.history)-1-i] = run
+	}
+	if len(status.History) > 0 {
+		last := status.History[0]
+		status.LastRun = &last
+	}
+	if e.job.Schedule != nil {
+		status.Schedule = e.job.Schedule.String()
+	}
+	if !e.nextRun.IsZero() {
+		next := e.nextRun
+		status.NextRun = &next
+	}
+	if !e.lastErrorAt.IsZero() {
+		at := e.lastErrorAt
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+// Close stop scheduling, cancel the runs in progress and wait for them to return
+func (s *Scheduler) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
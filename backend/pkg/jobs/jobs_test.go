@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2026, 3, 4, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2026, 3, 4, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 4, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, 3, 5, 2, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 15 6 *", time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)},
+		{"5,45 10 * * *", time.Date(2026, 3, 4, 10, 45, 0, 0, time.UTC)},
+		// day of month or day of week, like cron
+		{"0 0 13 * 5", time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", from.Add(90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "x * * * *", "@every", "@every -1m", "@yearly"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestParseSchedule_NeverMatches(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no run time for the 31st of February, got %v", next)
+	}
+}
+
+// memoryRecorder keeps recorded runs
+type memoryRecorder struct {
+	mu   sync.Mutex
+	runs []Run
+}
+
+func (r *memoryRecorder) RecordRun(run *Run) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs = append(r.runs, *run)
+	return nil
+}
+
+// waitFor poll until condition holds or fail after a second
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	recorder := &memoryRecorder{}
+	scheduler := NewScheduler(recorder, 3)
+	defer scheduler.Close()
+
+	calls := 0
+	err := scheduler.Register(Job{Name: "tick", Schedule: Every(10 * time.Millisecond), Run: func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 2 {
+			return "", errors.New("second run broke")
+		}
+		return "ok", nil
+	}})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	scheduler.Start()
+
+	waitFor(t, func() bool {
+		status, _ := scheduler.Job("tick")
+		return status.Runs >= 5
+	})
+	scheduler.Close()
+
+	status, err := scheduler.Job("tick")
+	if err != nil {
+		t.Fatalf("Job failed: %v", err)
+	}
+	if len(status.History) != 3 {
+		t.Errorf("Expected the last 3 runs, got %d", len(status.History))
+	}
+	if status.Failures != 1 || status.LastError != "second run broke" || status.LastErrorAt == nil {
+		t.Errorf("Expected the failure to be kept, got %+v", status)
+	}
+	if status.LastRun == nil || status.LastRun.Trigger != TriggerSchedule || status.LastRun.Result != "ok" {
+		t.Errorf("Unexpected last run %+v", status.LastRun)
+	}
+	if status.Schedule != "@every 10ms" || status.NextRun == nil {
+		t.Errorf("Expected schedule and next run, got %q %v", status.Schedule, status.NextRun)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.runs) != status.Runs {
+		t.Errorf("Expected %d recorded runs, got %d", status.Runs, len(recorder.runs))
+	}
+}
+
+func TestScheduler_Trigger(t *testing.T) {
+	scheduler := NewScheduler(nil, 0)
+	defer scheduler.Close()
+
+	release := make(chan struct{})
+	err := scheduler.Register(Job{Name: "manual", Run: func(ctx context.Context) (string, error) {
+		<-release
+		return "done", nil
+	}})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	scheduler.Start()
+
+	if err := scheduler.Trigger("manual"); err != nil {
+		t.Fatalf("Trigger failed: %v", err)
+	}
+	if err := scheduler.Trigger("manual"); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Expected ErrJobRunning while running, got %v", err)
+	}
+	if err := scheduler.Trigger("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	close(release)
+	waitFor(t, func() bool {
+		status, _ := scheduler.Job("manual")
+		return status.Runs == 1 && !status.Running
+	})
+	status, _ := scheduler.Job("manual")
+	if status.LastRun.Trigger != TriggerManual || status.Schedule != "" || status.NextRun != nil {
+		t.Errorf("Unexpected status of a manual job %+v", status)
+	}
+}
+
+func TestScheduler_Panic(t *testing.T) {
+	scheduler := NewScheduler(nil, 0)
+	defer scheduler.Close()
+
+	scheduler.Register(Job{Name: "broken", Run: func(ctx context.Context) (string, error) {
+		panic("boom")
+	}})
+	scheduler.Trigger("broken")
+
+	waitFor(t, func() bool {
+		status, _ := scheduler.Job("broken")
+		return status.Runs == 1
+	})
+	status, _ := scheduler.Job("broken")
+	if status.LastError != "panic: boom" {
+		t.Errorf("Expected the panic as error, got %q", status.LastError)
+	}
+}
+
+func TestScheduler_RegisterDuplicate(t *testing.T) {
+	scheduler := NewScheduler(nil, 0)
+	defer scheduler.Close()
+
+	run := func(ctx context.Context) (string, error) { return "", nil }
+	if err := scheduler.Register(Job{Name: "once", Run: run}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := scheduler.Register(Job{Name: "once", Run: run}); err == nil {
+		t.Error("Expected registering a name twice to fail")
+	}
+	if err := scheduler.Register(Job{Name: "no-run"}); err == nil {
+		t.Error("Expected a job without run function to fail")
+	}
+}
@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule when a job runs
+type Schedule interface {
+	// Next the first run time after t
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// interval runs a job at a fixed period
+type interval struct {
+	every time.Duration
+}
+
+// Every a schedule running every d, counted from the previous run
+func Every(d time.Duration) Schedule {
+	return interval{every: d}
+}
+
+// Next implements Schedule
+func (s interval) Next(t time.Time) time.Time {
+	return t.Add(s.every)
+}
+
+// String implements Schedule
+func (s interval) String() string {
+	return "@every " + s.every.String()
+}
+
+// descriptors shorthands of common cron expressions
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSchedule parse a standard five field cron expression (minute, hour, day of month,
+// month, day of week), a descriptor like @hourly or @daily, or @every <duration>
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		if every <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q: the interval must be positive", spec)
+		}
+		return Every(every), nil
+	}
+	expression := spec
+	if expanded, ok := descriptors[spec]; ok {
+		expression = expanded
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	schedule := &cronSchedule{spec: spec}
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&schedule.minutes, 0, 59},
+		{&schedule.hours, 0, 23},
+		{&schedule.days, 1, 31},
+		{&schedule.months, 1, 12},
+		{&schedule.weekdays, 0, 7},
+	}
+	for i, field := range fields {
+		set, err := parseField(field, bounds[i].min, bounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		*bounds[i].set = set
+	}
+	// Sunday is 0 or 7
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.anyDay = fields[2] == "*"
+	schedule.anyWeekday = fields[4] == "*"
+	return schedule, nil
+}
+
+// parseField the bit set of the values of one cron field: *, n, a-b, lists of those
+// and steps like */15 or 1-30/2
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = parsed
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+// cronSchedule a parsed cron expression, each field a bit set of its values
+type cronSchedule struct {
+	spec                                   string
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+// maxSearch how far ahead Next looks before giving up on an expression that never
+// matches, like the 31st of February
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next implements Schedule, in the time zone of t
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for next.Before(limit) {
+		if s.months&(1<<uint(next.Month())) == 0 {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if !s.dayMatches(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if s.hours&(1<<uint(next.Hour())) == 0 {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(next.Minute())) == 0 {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// dayMatches whether the day of t matches; like cron, restricting both the day of month
+// and the day of week matches days satisfying either
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// String implements Schedule
+func (s *cronSchedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,54 @@
+// Package mergepatch applies JSON merge patches as defined in RFC 7396: members of the
+// patch replace those of the target, objects are merged recursively and null removes
+// a member.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotObject the patch is not a JSON object, which would replace the whole document
+var ErrNotObject = errors.New("merge patch must be a JSON object")
+
+// Apply merge patch into the target document and return the result
+func Apply(target, patch []byte) ([]byte, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	if _, ok := patchDoc.(map[string]interface{}); !ok {
+		return nil, ErrNotObject
+	}
+
+	var targetDoc interface{}
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &targetDoc); err != nil {
+			return nil, fmt.Errorf("invalid merge target: %w", err)
+		}
+	}
+
+	return json.Marshal(merge(targetDoc, patchDoc))
+}
+
+// merge the MergePatch function of RFC 7396
+func merge(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{}, len(patchObject))
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = merge(targetObject[name], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,84 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestApply the examples of RFC 7396 appendix A whose patch is an object, and a few more
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{name: "Replace member", target: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "Add member", target: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "Remove member", target: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "Remove one of two", target: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "Replace array", target: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "Replace with array", target: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "Nested merge", target: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "Arrays are not merged", target: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "Non-object target", target: `["c"]`, patch: `{"a":"b"}`, want: `{"a":"b"}`},
+		{name: "Null target", target: `null`, patch: `{"a":"foo"}`, want: `{"a":"foo"}`},
+		{name: "Empty target", target: ``, patch: `{"a":1}`, want: `{"a":1}`},
+		{name: "Nested null kept out", target: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+		{name: "Empty patch", target: `{"a":1,"b":[2]}`, patch: `{}`, want: `{"a":1,"b":[2]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Apply returned error: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("Apply(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		patch     string
+		notObject bool
+	}{
+		{name: "Array patch", target: `{"a":1}`, patch: `["a"]`, notObject: true},
+		{name: "Null patch", target: `{"a":1}`, patch: `null`, notObject: true},
+		{name: "String patch", target: `{"a":1}`, patch: `"a"`, notObject: true},
+		{name: "Invalid patch", target: `{"a":1}`, patch: `{"a":`},
+		{name: "Invalid target", target: `{"a":`, patch: `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(tt.target), []byte(tt.patch))
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if got := errors.Is(err, ErrNotObject); got != tt.notObject {
+				t.Errorf("errors.Is(err, ErrNotObject) = %v, want %v (err: %v)", got, tt.notObject, err)
+			}
+		})
+	}
+}
+
+// jsonEqual compare two JSON documents ignoring member order
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var docA, docB interface{}
+	if err := json.Unmarshal(a, &docA); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &docB); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(docA, docB)
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LatencyBuckets upper bounds in seconds suited to LLM requests, from a fast first
+// token to a long generation
+var LatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120}
+
+// Histogram counts observations in cumulative buckets, with their sum and count
+type Histogram struct {
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram create a histogram with the given bucket upper bounds, sorted ascending
+func NewHistogram(buckets []float64) *Histogram {
+	upperBounds := append([]float64(nil), buckets...)
+	sort.Float64s(upperBounds)
+	return &Histogram{upperBounds: upperBounds, counts: make([]uint64, len(upperBounds)+1)}
+}
+
+// Observe add one value
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.upperBounds, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+// HistogramSnapshot cumulative bucket counts of a histogram at one point in time
+type HistogramSnapshot struct {
+	UpperBounds []float64
+	Cumulative  []uint64 // per upper bound, then +Inf
+	Sum         float64
+	Count       uint64
+}
+
+// Snapshot the current counts
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := HistogramSnapshot{
+		UpperBounds: h.upperBounds,
+		Cumulative:  make([]uint64, len(h.counts)),
+		Sum:         h.sum,
+		Count:       h.count,
+	}
+	var total uint64
+	for i, count := range h.counts {
+		total += count
+		snapshot.Cumulative[i] = total
+	}
+	return snapshot
+}
+
+// HistogramVec histograms of one metric told apart by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu         sync.Mutex
+	histograms map[string]*labeledHistogram
+}
+
+type labeledHistogram struct {
+	values    []string
+	histogram *Histogram
+}
+
+// NewHistogramVec create a histogram vector with the given buckets and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		name:       name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		histograms: make(map[string]*labeledHistogram),
+	}
+}
+
+// With the histogram of the label values, created on first use
+func (v *HistogramVec) With(values ...string) *Histogram {
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if lh, ok := v.histograms[key]; ok {
+		return lh.histogram
+	}
+	lh := &labeledHistogram{values: append([]string(nil), values...), histogram: NewHistogram(v.buckets)}
+	v.histograms[key] = lh
+	return lh.histogram
+}
+
+// Each call fn for every histogram, ordered by label values
+func (v *HistogramVec) Each(fn func(values []string, histogram *Histogram)) {
+	v.mu.Lock()
+	histograms := make([]*labeledHistogram, 0, len(v.histograms))
+	for _, lh := range v.histograms {
+		histograms = append(histograms, lh)
+	}
+	v.mu.Unlock()
+
+	sort.Slice(histograms, func(i, j int) bool {
+		return strings.Join(histograms[i].values, "\xff") < strings.Join(histograms[j].values, "\xff")
+	})
+	for _, lh := range histograms {
+		fn(lh.values, lh.histogram)
+	}
+}
+
+// Write the histograms as _bucket, _sum and _count samples
+func (v *HistogramVec) Write(w io.Writer) error {
+	if err := WriteHeader(w, v.name, v.help, "histogram"); err != nil {
+		return err
+	}
+
+	bucketLabels := append(append([]string(nil), v.labels...), "le")
+	var err error
+	v.Each(func(values []string, histogram *Histogram) {
+		if err != nil {
+			return
+		}
+		snapshot := histogram.Snapshot()
+		for i, cumulative := range snapshot.Cumulative {
+			le := "+Inf"
+			if i < len(snapshot.UpperBounds) {
+				le = formatBound(snapshot.UpperBounds[i])
+			}
+			bucketValues := append(append([]string(nil), values...), le)
+			if err = WriteSample(w, v.name+"_bucket", bucketLabels, bucketValues, float64(cumulative)); err != nil {
+				return
+			}
+		}
+		if err = WriteSample(w, v.name+"_sum", v.labels, values, snapshot.Sum); err != nil {
+			return
+		}
+		err = WriteSample(w, v.name+"_count", v.labels, values, float64(snapshot.Count))
+	})
+	return err
+}
+
+// formatBound a bucket upper bound as the le label value
+func formatBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
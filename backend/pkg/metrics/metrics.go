@@ -0,0 +1,219 @@
+// Package metrics provides in-process gauges that also remember their peak over a
+// sliding window and histograms, and writes them in the Prometheus text exposition
+// format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// bucket highest value of a gauge during one second
+type bucket struct {
+	second int64
+	peak   int64
+}
+
+// Gauge current value of a count that goes up and down, with the highest value it
+// had during the window, kept in one-second buckets
+type Gauge struct {
+	mu      sync.Mutex
+	current int64
+	buckets []bucket
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewGauge create a gauge whose peak covers window, rounded up to whole seconds
+func NewGauge(window time.Duration) *Gauge {
+	seconds := int((window + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &Gauge{buckets: make([]bucket, seconds), now: time.Now}
+}
+
+// Add change the value by delta
+func (g *Gauge) Add(delta int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	second := g.now().Unix()
+	b := &g.buckets[int(second%int64(len(g.buckets)))]
+	if b.second != second {
+		// the value held since the last change counts for this second too
+		*b = bucket{second: second, peak: g.current}
+	}
+	g.current += delta
+	if g.current > b.peak {
+		b.peak = g.current
+	}
+}
+
+// Inc add one
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec subtract one
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Value the current value
+func (g *Gauge) Value() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.current
+}
+
+// Peak the highest value during the window, at least the current value
+func (g *Gauge) Peak() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	oldest := g.now().Unix() - int64(len(g.buckets)) + 1
+	peak := g.current
+	for _, b := range g.buckets {
+		if b.second >= oldest && b.peak > peak {
+			peak = b.peak
+		}
+	}
+	return peak
+}
+
+// GaugeVec gauges of one metric told apart by label values
+type GaugeVec struct {
+	name   string
+	help   string
+	labels []string
+	window time.Duration
+
+	mu     sync.Mutex
+	gauges map[string]*labeledGauge
+}
+
+type labeledGauge struct {
+	values []string
+	gauge  *Gauge
+}
+
+// NewGaugeVec create a gauge vector with the given label names
+func NewGaugeVec(name, help string, window time.Duration, labels ...string) *GaugeVec {
+	return &GaugeVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		window: window,
+		gauges: make(map[string]*labeledGauge),
+	}
+}
+
+// With the gauge of the label values, created on first use; values are matched to
+// the label names in order
+func (v *GaugeVec) With(values ...string) *Gauge {
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if lg, ok := v.gauges[key]; ok {
+		return lg.gauge
+	}
+	lg := &labeledGauge{values: append([]string(nil), values...), gauge: NewGauge(v.window)}
+	v.gauges[key] = lg
+	return lg.gauge
+}
+
+// Each call fn for every gauge, ordered by label values
+func (v *GaugeVec) Each(fn func(values []string, gauge *Gauge)) {
+	v.mu.Lock()
+	gauges := make([]*labeledGauge, 0, len(v.gauges))
+	for _, lg := range v.gauges {
+		gauges = append(gauges, lg)
+	}
+	v.mu.Unlock()
+
+	sort.Slice(gauges, func(i, j int) bool {
+		return strings.Join(gauges[i].values, "\xff") < strings.Join(gauges[j].values, "\xff")
+	})
+	for _, lg := range gauges {
+		fn(lg.values, lg.gauge)
+	}
+}
+
+// Write the current values as the gauge metric and the peaks as its _peak metric
+func (v *GaugeVec) Write(w io.Writer) error {
+	type sample struct {
+		values      []string
+		value, peak int64
+	}
+	var samples []sample
+	v.Each(func(values []string, gauge *Gauge) {
+		samples = append(samples, sample{values: values, value: gauge.Value(), peak: gauge.Peak()})
+	})
+
+	if err := WriteHeader(w, v.name, v.help, "gauge"); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if err := WriteSample(w, v.name, v.labels, s.values, float64(s.value)); err != nil {
+			return err
+		}
+	}
+
+	peakName := v.name + "_peak"
+	if err := WriteHeader(w, peakName, fmt.Sprintf("%s, highest value over the last %s", v.help, v.window), "gauge"); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if err := WriteSample(w, peakName, v.labels, s.values, float64(s.peak)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHeader write the HELP and TYPE lines of a metric
+func WriteHeader(w io.Writer, name, help, metricType string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, metricType)
+	return err
+}
+
+// WriteSample write one sample line, values are matched to the label names in order
+func WriteSample(w io.Writer, name string, labels, values []string, value float64) error {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			var labelValue string
+			if i < len(values) {
+				labelValue = values[i]
+			}
+			b.WriteString(label)
+			b.WriteString(`="`)
+			b.WriteString(labelEscaper.Replace(labelValue))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestGauge a gauge with a controllable clock, advance moves it forward
+func newTestGauge(window time.Duration) (*Gauge, func(time.Duration)) {
+	gauge := NewGauge(window)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	gauge.now = func() time.Time { return now }
+	return gauge, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestGauge_Peak(t *testing.T) {
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		wantPeak int64
+	}{
+		{name: "Right after the drop", elapsed: 0, wantPeak: 3},
+		{name: "Inside the window", elapsed: 59 * time.Second, wantPeak: 3},
+		{name: "After the window", elapsed: time.Minute, wantPeak: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gauge, advance := newTestGauge(time.Minute)
+			gauge.Add(3)
+			advance(10 * time.Second)
+			gauge.Add(-2)
+			advance(tt.elapsed)
+
+			if got := gauge.Value(); got != 1 {
+				t.Errorf("Value = %d, want 1", got)
+			}
+			if got := gauge.Peak(); got != tt.wantPeak {
+				t.Errorf("Peak = %d, want %d", got, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestGauge_PeakHeldWithoutChanges(t *testing.T) {
+	gauge, advance := newTestGauge(time.Minute)
+	gauge.Add(5)
+	advance(5 * time.Minute)
+	gauge.Add(-5)
+
+	if got := gauge.Peak(); got != 5 {
+		t.Errorf("Peak = %d, want the value held until the drop", got)
+	}
+}
+
+func TestGaugeVec_Write(t *testing.T) {
+	vec := NewGaugeVec("requests_in_flight", "Requests being processed", time.Minute, "agent_id", "endpoint")
+	vec.With("b", "/chat").Inc()
+	vec.With("a", `say "hi"`).Add(2)
+	vec.With("a", `say "hi"`).Dec()
+
+	var out strings.Builder
+	if err := vec.Write(&out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := `# HELP requests_in_flight Requests being processed
+# TYPE requests_in_flight gauge
+requests_in_flight{agent_id="a",endpoint="say \"hi\""} 1
+requests_in_flight{agent_id="b",endpoint="/chat"} 1
+# HELP requests_in_flight_peak Requests being processed, highest value over the last 1m0s
+# TYPE requests_in_flight_peak gauge
+requests_in_flight_peak{agent_id="a",endpoint="say \"hi\""} 2
+requests_in_flight_peak{agent_id="b",endpoint="/chat"} 1
+`
+	if out.String() != want {
+		t.Errorf("Write =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestHistogramVec_Write(t *testing.T) {
+	vec := NewHistogramVec("upstream_seconds", "Upstream latency", []float64{1, 0.5}, "model")
+	for _, value := range []float64{0.2, 0.5, 0.7, 3} {
+		vec.With("gpt-4o").Observe(value)
+	}
+
+	var out strings.Builder
+	if err := vec.Write(&out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	want := `# HELP upstream_seconds Upstream latency
+# TYPE upstream_seconds histogram
+upstream_seconds_bucket{model="gpt-4o",le="0.5"} 2
+upstream_seconds_bucket{model="gpt-4o",le="1"} 3
+upstream_seconds_bucket{model="gpt-4o",le="+Inf"} 4
+upstream_seconds_sum{model="gpt-4o"} 4.4
+upstream_seconds_count{model="gpt-4o"} 4
+`
+	if out.String() != want {
+		t.Errorf("Write =\n%s\nwant\n%s", out.String(), want)
+	}
+}
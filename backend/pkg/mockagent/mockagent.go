@@ -0,0 +1,343 @@
+package mockagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Scheme URL scheme of mock agents, requests to it never leave the process
+const Scheme = "mock"
+
+// DefaultResponse template used when the agent URL sets none
+const DefaultResponse = "This is a mock response to: {{.Prompt}}"
+
+// Defaults of the streaming options
+const (
+	DefaultChunkSize  = 1
+	DefaultChunkDelay = 50 * time.Millisecond
+)
+
+// Options behaviour of a mock agent, read from the query of its URL, e.g.
+// mock://local?response=Hi+{{.User}}&latency_ms=200&error_rate=0.1
+type Options struct {
+	Response    string        // canned answer, a text/template over TemplateData
+	Latency     time.Duration // delay before the answer or the first chunk
+	Jitter      time.Duration // random extra delay up to this long
+	ErrorRate   float64       // share of requests answered with ErrorStatus, 0 to 1
+	ErrorStatus int           // HTTP status of simulated errors
+	ChunkSize   int           // words per streamed chunk
+	ChunkDelay  time.Duration // delay between streamed chunks
+
+	template *template.Template
+}
+
+// TemplateData fields available to the response template
+type TemplateData struct {
+	Prompt       string // content of the last user message
+	Model        string
+	User         string
+	MessageCount int
+}
+
+// ParseOptions read the options from a mock agent URL
+func ParseOptions(rawURL string) (*Options, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock URL: %w", err)
+	}
+	if parsed.Scheme != Scheme {
+		return nil, fmt.Errorf("mock agent URL must start with %s://", Scheme)
+	}
+
+	query := parsed.Query()
+	options := &Options{
+		Response:    DefaultResponse,
+		ErrorStatus: http.StatusInternalServerError,
+		ChunkSize:   DefaultChunkSize,
+		ChunkDelay:  DefaultChunkDelay,
+	}
+	if response := query.Get("response"); response != "" {
+		options.Response = response
+	}
+
+	durations := map[string]*time.Duration{
+		"latency_ms":     &options.Latency,
+		"jitter_ms":      &options.Jitter,
+		"chunk_delay_ms": &options.ChunkDelay,
+	}
+	for name, target := range durations {
+		if value := query.Get(name); value != "" {
+			ms, err := strconv.Atoi(value)
+			if err != nil || ms < 0 {
+				return nil, fmt.Errorf("mock option %s must be a non-negative number of milliseconds", name)
+			}
+			*target = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	if value := query.Get("error_rate"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("mock option error_rate must be between 0 and 1")
+		}
+		options.ErrorRate = rate
+	}
+	if value := query.Get("error_status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("mock option error_status must be an HTTP error status")
+		}
+		options.ErrorStatus = status
+	}
+	if value := query.Get("chunk_size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("mock option chunk_size must be at least 1")
+		}
+		options.ChunkSize = size
+	}
+
+	options.template, err = template.New("response").Parse(options.Response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock response template: %w", err)
+	}
+	return options, nil
+}
+
+// chatRequest the part of an OpenAI chat request the mock reads
+type chatRequest struct {
+	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
+	User     string `json:"user"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+// Transport answers OpenAI chat completion requests to mock:// URLs in process;
+// register it on an http.Transport with RegisterProtocol(Scheme, ...)
+type Transport struct {
+	random func() float64
+	sleep  func(req *http.Request, d time.Duration) error
+}
+
+// NewTransport creates a mock transport
+func NewTransport() *Transport {
+	return &Transport{random: rand.Float64, sleep: sleepContext}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	options, err := ParseOptions(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var chat chatRequest
+	if req.Body != nil {
+		defer req.Body.Close()
+		if err := json.NewDecoder(req.Body).Decode(&chat); err != nil && err != io.EOF {
+			return jsonResponse(req, http.StatusBadRequest, errorBody("invalid request body: "+err.Error())), nil
+		}
+	}
+
+	delay := options.Latency
+	if options.Jitter > 0 {
+		delay += time.Duration(t.random() * float64(options.Jitter))
+	}
+	if err := t.sleep(req, delay); err != nil {
+		return nil, err
+	}
+
+	if options.ErrorRate > 0 && t.random() < options.ErrorRate {
+		return jsonResponse(req, options.ErrorStatus, errorBody("simulated mock agent error")), nil
+	}
+
+	data := TemplateData{Model: chat.Model, User: chat.User, MessageCount: len(chat.Messages)}
+	promptWords := 0
+	for _, message := range chat.Messages {
+		promptWords += len(strings.Fields(message.Content))
+		if message.Role == "user" {
+			data.Prompt = message.Content
+		}
+	}
+	var rendered bytes.Buffer
+	if err := options.template.Execute(&rendered, data); err != nil {
+		return jsonResponse(req, http.StatusInternalServerError, errorBody("mock response template failed: "+err.Error())), nil
+	}
+
+	completion := newCompletion(chat.Model, rendered.String(), promptWords)
+	if chat.Stream {
+		return t.streamResponse(req, options, completion), nil
+	}
+	return jsonResponse(req, http.StatusOK, completion.message()), nil
+}
+
+// completion the answer of one request
+type completion struct {
+	id               string
+	created          int64
+	model            string
+	content          string
+	promptTokens     int
+	completionTokens int
+}
+
+func newCompletion(model, content string, promptTokens int) *completion {
+	if model == "" {
+		model = "mock"
+	}
+	return &completion{
+		id:               fmt.Sprintf("chatcmpl-mock-%d", time.Now().UnixNano()),
+		created:          time.Now().Unix(),
+		model:            model,
+		content:          content,
+		promptTokens:     promptTokens,
+		completionTokens: len(strings.Fields(content)),
+	}
+}
+
+// usage token counts, words stand in for tokens
+func (c *completion) usage() map[string]int {
+	return map[string]int{
+		"prompt_tokens":     c.promptTokens,
+		"completion_tokens": c.completionTokens,
+		"total_tokens":      c.promptTokens + c.completionTokens,
+	}
+}
+
+// message the blocking chat.completion body
+func (c *completion) message() map[string]interface{} {
+	return map[string]interface{}{
+		"id":      c.id,
+		"object":  "chat.completion",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": c.content},
+			"finish_reason": "stop",
+		}},
+		"usage": c.usage(),
+	}
+}
+
+// chunk one chat.completion.chunk event, the last one carries the finish reason and usage
+func (c *completion) chunk(content string, last bool) map[string]interface{} {
+	choice := map[string]interface{}{
+		"index":         0,
+		"delta":         map[string]string{"content": content},
+		"finish_reason": nil,
+	}
+	event := map[string]interface{}{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []map[string]interface{}{choice},
+	}
+	if last {
+		choice["delta"] = map[string]string{}
+		choice["finish_reason"] = "stop"
+		event["usage"] = c.usage()
+	}
+	return event
+}
+
+// streamResponse stream the answer as server-sent events, ChunkSize words at a time
+func (t *Transport) streamResponse(req *http.Request, options *Options, c *completion) *http.Response {
+	reader, writer := io.Pipe()
+
+	go func() {
+		words := strings.SplitAfter(c.content, " ")
+		for start := 0; start < len(words); start += options.ChunkSize {
+			if start > 0 {
+				if err := t.sleep(req, options.ChunkDelay); err != nil {
+					writer.CloseWithError(err)
+					return
+				}
+			}
+			end := start + options.ChunkSize
+			if end > len(words) {
+				end = len(words)
+			}
+			if err := writeEvent(writer, c.chunk(strings.Join(words[start:end], ""), false)); err != nil {
+				return
+			}
+		}
+		if err := writeEvent(writer, c.chunk("", true)); err != nil {
+			return
+		}
+		io.WriteString(writer, "data: [DONE]\n\n")
+		writer.Close()
+	}()
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       reader,
+		Request:    req,
+	}
+}
+
+// writeEvent write one SSE data line
+func writeEvent(w io.Writer, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// errorBody OpenAI style error body
+func errorBody(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]string{"message": message, "type": "mock_error"},
+	}
+}
+
+// jsonResponse build a response with a JSON body
+func jsonResponse(req *http.Request, status int, body interface{}) *http.Response {
+	data, _ := json.Marshal(body)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
+
+// sleepContext wait for d unless the request is cancelled first
+func sleepContext(req *http.Request, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,198 @@
+package mockagent
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    Options
+		wantErr bool
+	}{
+		{
+			name: "Defaults",
+			url:  "mock://local",
+			want: Options{Response: DefaultResponse, ErrorStatus: 500, ChunkSize: DefaultChunkSize, ChunkDelay: DefaultChunkDelay},
+		},
+		{
+			name: "All options",
+			url:  "mock://local?response=Hi&latency_ms=200&jitter_ms=50&error_rate=0.25&error_status=503&chunk_size=3&chunk_delay_ms=0",
+			want: Options{Response: "Hi", Latency: 200 * time.Millisecond, Jitter: 50 * time.Millisecond, ErrorRate: 0.25, ErrorStatus: 503, ChunkSize: 3},
+		},
+		{name: "Wrong scheme", url: "https://api.openai.com/v1", wantErr: true},
+		{name: "Negative latency", url: "mock://local?latency_ms=-1", wantErr: true},
+		{name: "Error rate above 1", url: "mock://local?error_rate=2", wantErr: true},
+		{name: "Success status as error", url: "mock://local?error_status=200", wantErr: true},
+		{name: "Empty chunks", url: "mock://local?chunk_size=0", wantErr: true},
+		{name: "Broken template", url: "mock://local?response={{.Prompt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOptions(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseOptions() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOptions() error = %v", err)
+			}
+			got.template = nil
+			if *got != tt.want {
+				t.Errorf("ParseOptions() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// newClient an HTTP client that routes mock:// URLs to the transport
+func newClient(mock *Transport) *http.Client {
+	transport := &http.Transport{}
+	transport.RegisterProtocol(Scheme, mock)
+	return &http.Client{Transport: transport}
+}
+
+func post(t *testing.T, client *http.Client, url, body string) *http.Response {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	return resp
+}
+
+func TestTransport_Blocking(t *testing.T) {
+	client := newClient(NewTransport())
+	resp := post(t, client, "mock://local/v1/chat/completions?response=Echo+{{.Prompt}}+for+{{.User}}",
+		`{"model":"test-model","user":"alice","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hello there"}]}`)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var body struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage map[string]int `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode error = %v", err)
+	}
+	if got := body.Choices[0].Message.Content; got != "Echo hello there for alice" {
+		t.Errorf("content = %q, want %q", got, "Echo hello there for alice")
+	}
+	if body.Model != "test-model" {
+		t.Errorf("model = %q, want test-model", body.Model)
+	}
+	if body.Usage["prompt_tokens"] != 4 || body.Usage["completion_tokens"] != 5 || body.Usage["total_tokens"] != 9 {
+		t.Errorf("usage = %v, want 4 prompt and 5 completion tokens", body.Usage)
+	}
+}
+
+func TestTransport_Streaming(t *testing.T) {
+	client := newClient(NewTransport())
+	resp := post(t, client, "mock://local/v1/chat/completions?response=one+two+three&chunk_size=2&chunk_delay_ms=1",
+		`{"stream":true,"messages":[{"role":"user","content":"count"}]}`)
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	var content strings.Builder
+	var chunks int
+	var done, finished bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		if event.Choices[0].FinishReason != nil {
+			finished = true
+			continue
+		}
+		chunks++
+		content.WriteString(event.Choices[0].Delta.Content)
+	}
+
+	if content.String() != "one two three" {
+		t.Errorf("streamed content = %q, want %q", content.String(), "one two three")
+	}
+	if chunks != 2 {
+		t.Errorf("chunks = %d, want 2", chunks)
+	}
+	if !finished || !done {
+		t.Errorf("finish chunk = %v, [DONE] = %v, want both", finished, done)
+	}
+}
+
+func TestTransport_ErrorRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		random     float64
+		wantStatus int
+	}{
+		{name: "Below the rate fails", random: 0.1, wantStatus: http.StatusServiceUnavailable},
+		{name: "Above the rate succeeds", random: 0.9, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewTransport()
+			mock.random = func() float64 { return tt.random }
+			resp := post(t, newClient(mock), "mock://local/v1/chat/completions?error_rate=0.5&error_status=503",
+				`{"messages":[{"role":"user","content":"hi"}]}`)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTransport_Latency(t *testing.T) {
+	mock := NewTransport()
+	var slept time.Duration
+	mock.sleep = func(req *http.Request, d time.Duration) error {
+		slept += d
+		return nil
+	}
+	mock.random = func() float64 { return 0.5 }
+
+	resp := post(t, newClient(mock), "mock://local/v1/chat/completions?latency_ms=100&jitter_ms=40",
+		`{"messages":[{"role":"user","content":"hi"}]}`)
+	resp.Body.Close()
+
+	if slept != 120*time.Millisecond {
+		t.Errorf("slept %v, want 120ms", slept)
+	}
+}
@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailChannel sends templated HTML mails through SMTP
+const EmailChannel ChannelType = "email"
+
+// SMTPConfig SMTP server used to send alert mails
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	// ImplicitTLS connects with TLS right away (port 465), otherwise STARTTLS is used when offered
+	ImplicitTLS bool
+
+	// Timeout bounds the whole SMTP conversation
+	Timeout time.Duration
+}
+
+// Validate checks that mails can be sent with the configuration
+func (c *SMTPConfig) Validate() error {
+	if c == nil || c.Host == "" {
+		return fmt.Errorf("SMTP host is not configured")
+	}
+	if c.Port <= 0 {
+		return fmt.Errorf("SMTP port must be positive, got: %d", c.Port)
+	}
+	if c.From == "" {
+		return fmt.Errorf("SMTP sender address is not configured")
+	}
+	return nil
+}
+
+// Email is a rendered mail
+type Email struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+var emailTemplate = template.Must(template.New("alert").Funcs(template.FuncMap{
+	"color": func(severity Severity) string { return severityColors[severity] },
+}).Parse(`<!DOCTYPE html>
+<html><body style="font-family:Arial,Helvetica,sans-serif;color:#1d1c1d">
+{{range .Messages}}
+<div style="border-left:4px solid {{color .Severity}};padding:8px 16px;margin:0 0 16px">
+  <h2 style="margin:0 0 4px;font-size:18px">{{.Title}}</h2>
+  <p style="margin:0 0 8px;color:#616061;font-size:12px">{{.Severity}} · {{.Source}} · {{.Time.Format "2006-01-02 15:04:05 MST"}}</p>
+  <p style="margin:0 0 8px">{{.Text}}</p>
+  {{if .Fields}}<table style="border-collapse:collapse;font-size:13px">
+  {{range .Fields}}<tr><td style="padding:2px 12px 2px 0;color:#616061">{{.Name}}</td><td style="padding:2px 0">{{.Value}}</td></tr>
+  {{end}}</table>{{end}}
+</div>
+{{end}}
+{{if .Digest}}<p style="color:#616061;font-size:12px">Digest of {{len .Messages}} notifications.</p>{{end}}
+</body></html>`))
+
+// RenderEmail render a single alert mail
+func RenderEmail(msg Message) (*Email, error) {
+	return renderEmail(fmt.Sprintf("[%s] %s", strings.ToUpper(string(msg.Severity)), msg.Title), []Message{msg}, false)
+}
+
+// RenderDigest render one mail summarizing several notifications
+func RenderDigest(messages []Message) (*Email, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("digest has no messages")
+	}
+
+	severity := SeverityInfo
+	for _, msg := range messages {
+		if severityRank(msg.Severity) > severityRank(severity) {
+			severity = msg.Severity
+		}
+	}
+	subject := fmt.Sprintf("[%s] Agent-Connector digest: %d notifications", strings.ToUpper(string(severity)), len(messages))
+	return renderEmail(subject, messages, true)
+}
+
+// renderEmail render the HTML and plain text bodies
+func renderEmail(subject string, messages []Message, digest bool) (*Email, error) {
+	var html bytes.Buffer
+	err := emailTemplate.Execute(&html, map[string]interface{}{
+		"Messages": messages,
+		"Digest":   digest,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+
+	var text strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&text, "[%s] %s\n%s\n", msg.Severity, msg.Title, msg.Text)
+		for _, field := range msg.Fields {
+			fmt.Fprintf(&text, "  %s: %s\n", field.Name, field.Value)
+		}
+		fmt.Fprintf(&text, "%s · %s\n\n", msg.Source, msg.Time.Format(time.RFC3339))
+	}
+
+	return &Email{Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+// severityRank order severities for digests
+func severityRank(severity Severity) int {
+	switch severity {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// EmailSender sends mails through an SMTP server
+type EmailSender struct {
+	config SMTPConfig
+}
+
+// NewEmailSender create an SMTP email sender
+func NewEmailSender(config SMTPConfig) (*EmailSender, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &EmailSender{config: config}, nil
+}
+
+// Send deliver the mail to a single recipient, recipients never see each other
+func (s *EmailSender) Send(ctx context.Context, to string, email *Email) error {
+	body, err := buildMIMEMessage(s.config.From, to, email)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.config.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{Deadline: deadline}
+
+	var conn net.Conn
+	if s.config.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: s.config.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if !s.config.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.config.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO %s failed: %w", to, err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(body); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the mail: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMIMEMessage build a multipart/alternative mail with text and HTML parts
+func buildMIMEMessage(from, to string, email *Email) ([]byte, error) {
+	if strings.ContainsAny(from+to, "\r\n") {
+		return nil, fmt.Errorf("invalid address")
+	}
+
+	boundaryBytes := make([]byte, 12)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, err
+	}
+	boundary := "ac-" + hex.EncodeToString(boundaryBytes)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(email.Text, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	buf.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(email.HTML, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
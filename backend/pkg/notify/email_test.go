@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one mail per connection and reports the received data
+func fakeSMTPServer(t *testing.T) (host string, port int, received chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received = make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		write := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		write("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					write("250 queued")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"):
+				write("250-localhost")
+				write("250 8BITMIME")
+			case strings.HasPrefix(command, "DATA"):
+				inData = true
+				write("354 go ahead")
+			case strings.HasPrefix(command, "QUIT"):
+				write("221 bye")
+				return
+			default:
+				write("250 ok")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestEmailSenderSend(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+
+	sender, err := NewEmailSender(SMTPConfig{Host: host, Port: port, From: "alerts@example.com", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewEmailSender failed: %v", err)
+	}
+
+	email, err := RenderEmail(Message{
+		Title:    "Agent down",
+		Text:     "Requests to agent <b>agent-1</b> are failing.",
+		Severity: SeverityCritical,
+		Fields:   []Field{{Name: "agent_id", Value: "agent-1"}},
+		Source:   "dataflow-api",
+		Time:     time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("RenderEmail failed: %v", err)
+	}
+
+	if err := sender.Send(context.Background(), "ops@example.com", email); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	select {
+	case data := <-received:
+		for _, want := range []string{
+			"To: ops@example.com",
+			"multipart/alternative",
+			"text/html",
+			"[CRITICAL] Agent down",
+			"&lt;b&gt;agent-1&lt;/b&gt;",
+		} {
+			if !strings.Contains(data, want) {
+				t.Errorf("mail does not contain %q", want)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive the mail")
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	messages := []Message{
+		{Title: "Quota exceeded", Severity: SeverityWarning, Time: time.Now()},
+		{Title: "Agent down", Severity: SeverityCritical, Time: time.Now()},
+		{Title: "Key created", Severity: SeverityInfo, Time: time.Now()},
+	}
+
+	email, err := RenderDigest(messages)
+	if err != nil {
+		t.Fatalf("RenderDigest failed: %v", err)
+	}
+	if !strings.HasPrefix(email.Subject, "[CRITICAL]") || !strings.Contains(email.Subject, "3 notifications") {
+		t.Fatalf("unexpected subject %q", email.Subject)
+	}
+	for _, msg := range messages {
+		if !strings.Contains(email.HTML, msg.Title) || !strings.Contains(email.Text, msg.Title) {
+			t.Errorf("digest is missing %q", msg.Title)
+		}
+	}
+	if strings.Contains(email.HTML, "ZgotmplZ") {
+		t.Error("severity color was rejected by the template")
+	}
+
+	if _, err := RenderDigest(nil); err == nil {
+		t.Fatal("expected error for an empty digest")
+	}
+}
+
+func TestSMTPConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *SMTPConfig
+		wantErr bool
+	}{
+		{name: "nil config", config: nil, wantErr: true},
+		{name: "missing host", config: &SMTPConfig{Port: 25, From: "a@example.com"}, wantErr: true},
+		{name: "missing port", config: &SMTPConfig{Host: "smtp.example.com", From: "a@example.com"}, wantErr: true},
+		{name: "missing sender", config: &SMTPConfig{Host: "smtp.example.com", Port: 25}, wantErr: true},
+		{name: "valid", config: &SMTPConfig{Host: "smtp.example.com", Port: 587, From: "a@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildMIMEMessageRejectsHeaderInjection(t *testing.T) {
+	_, err := buildMIMEMessage("alerts@example.com", "ops@example.com\r\nBcc: x@example.com", &Email{Subject: "s"})
+	if err == nil {
+		t.Fatal("expected error for an address with a line break")
+	}
+}
@@ -0,0 +1,136 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"agent-connector/pkg/events"
+)
+
+// Severity of a notification
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Field is a labelled value shown under the message text
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Message is a channel independent notification
+type Message struct {
+	Title    string    `json:"title"`
+	Text     string    `json:"text"`
+	Severity Severity  `json:"severity"`
+	Fields   []Field   `json:"fields,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// MessageFromEvent build the notification for a platform event
+func MessageFromEvent(event events.Event) Message {
+	msg := Message{
+		Title:    string(event.Type),
+		Severity: SeverityInfo,
+		Source:   event.Source,
+		Time:     event.Time,
+		Fields:   dataFields(event.Data),
+	}
+
+	agentID := stringValue(event.Data, "agent_id", event.Subject)
+	switch event.Type {
+	case events.TypeAgentHealthChanged:
+		if healthy, _ := event.Data["healthy"].(bool); healthy {
+			msg.Title = "Agent recovered"
+			msg.Text = fmt.Sprintf("Agent %s is responding again.", agentID)
+		} else {
+			msg.Title = "Agent down"
+			msg.Severity = SeverityCritical
+			msg.Text = fmt.Sprintf("Requests to agent %s are failing.", agentID)
+		}
+	case events.TypeAgentErrorRateHigh:
+		msg.Title = "Anomalous error rate"
+		msg.Severity = SeverityCritical
+		msg.Text = fmt.Sprintf("Agent %s is failing an unusual share of requests.", agentID)
+	case events.TypeAgentUnhealthy:
+		msg.Title = "Agent unhealthy"
+		msg.Severity = SeverityCritical
+		msg.Text = fmt.Sprintf("Agent %s has been failing for %s.", agentID, stringValue(event.Data, "unhealthy_for", "several minutes"))
+	case events.TypeAgentGoldenRegression:
+		msg.Title = "Answers regressed"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("Agent %s answered %v of its golden prompts unlike the approved references.", agentID, event.Data["regressed"])
+	case events.TypeQuotaWarning:
+		msg.Title = "Quota almost reached"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("The %s limit of agent %s is almost reached.", stringValue(event.Data, "limit", "usage"), agentID)
+	case events.TypeQuotaExceeded:
+		msg.Title = "Quota exceeded"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("Requests to agent %s were rejected by the %s limit.", agentID, stringValue(event.Data, "limit", "rate"))
+	case events.TypeStreamInterrupted:
+		msg.Title = "Stream interrupted"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("A streamed response of agent %s broke off before it was complete.", agentID)
+	case events.TypeKeyCreated:
+		msg.Title = "Key created"
+		msg.Text = fmt.Sprintf("A %s was %s for agent %s.", stringValue(event.Data, "kind", "key"), stringValue(event.Data, "reason", "created"), agentID)
+	case events.TypeKeyOffHoursAttempt:
+		msg.Title = "Key used off hours"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("The connector key of agent %s was used outside its access schedule %s (%v attempts).",
+			agentID, stringValue(event.Data, "schedule", "unknown"), event.Data["attempts"])
+	case events.TypeUserImpersonated:
+		msg.Title = "User impersonated"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("Administrator %s is signed in as user %s until %s.",
+			stringValue(event.Data, "impersonator", "unknown"), stringValue(event.Data, "username", event.Subject), stringValue(event.Data, "expires_at", "the session expires"))
+	case events.TypeSessionBindingViolated:
+		msg.Title = "Session used from another client"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("A session of user %s was used from another client than it was issued to, the session was %s.",
+			stringValue(event.Data, "username", event.Subject), stringValue(event.Data, "action", "reported"))
+	case events.TypeLoginAnomaly:
+		msg.Title = "Unusual login"
+		msg.Severity = SeverityWarning
+		msg.Text = fmt.Sprintf("A login of user %s looked unusual (%s), the login was %s. If this was not you, change your password.",
+			stringValue(event.Data, "username", event.Subject), stringValue(event.Data, "anomalies", "unknown"), stringValue(event.Data, "action", "allowed"))
+	case events.TypeRequestCompleted:
+		msg.Title = "Request completed"
+		msg.Text = fmt.Sprintf("A request to agent %s completed.", agentID)
+		if success, _ := event.Data["success"].(bool); !success {
+			msg.Severity = SeverityWarning
+			msg.Text = fmt.Sprintf("A request to agent %s failed.", agentID)
+		}
+	default:
+		msg.Text = fmt.Sprintf("Event %s about %s.", event.Type, event.Subject)
+	}
+
+	return msg
+}
+
+// dataFields list the event data as fields, sorted for stable output
+func dataFields(data map[string]interface{}) []Field {
+	fields := make([]Field, 0, len(data))
+	for key, value := range data {
+		fields = append(fields, Field{Name: key, Value: fmt.Sprint(value)})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// stringValue read a string from event data with a fallback
+func stringValue(data map[string]interface{}, key, fallback string) string {
+	if value, ok := data[key].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
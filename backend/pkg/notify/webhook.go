@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ChannelType identifies how a message is delivered
+type ChannelType string
+
+const (
+	// SlackChannel posts to a Slack incoming webhook
+	SlackChannel ChannelType = "slack"
+
+	// TeamsChannel posts to a Microsoft Teams incoming webhook
+	TeamsChannel ChannelType = "teams"
+)
+
+// severityColors accent color per severity, used by both Slack and Teams
+var severityColors = map[Severity]string{
+	SeverityInfo:     "#2EB67D",
+	SeverityWarning:  "#ECB22E",
+	SeverityCritical: "#E01E5A",
+}
+
+// FormatSlack build a Slack incoming webhook payload
+func FormatSlack(msg Message) map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(msg.Fields))
+	for _, field := range msg.Fields {
+		fields = append(fields, map[string]interface{}{
+			"title": field.Name,
+			"value": field.Value,
+			"short": true,
+		})
+	}
+
+	return map[string]interface{}{
+		// text is what shows up in push notifications
+		"text": fmt.Sprintf("[%s] %s", msg.Severity, msg.Title),
+		"attachments": []map[string]interface{}{
+			{
+				"color":  severityColors[msg.Severity],
+				"title":  msg.Title,
+				"text":   msg.Text,
+				"fields": fields,
+				"footer": msg.Source,
+				"ts":     msg.Time.Unix(),
+			},
+		},
+	}
+}
+
+// FormatTeams build a Microsoft Teams incoming webhook payload (MessageCard)
+func FormatTeams(msg Message) map[string]interface{} {
+	facts := make([]map[string]string, 0, len(msg.Fields))
+	for _, field := range msg.Fields {
+		facts = append(facts, map[string]string{
+			"name":  field.Name,
+			"value": field.Value,
+		})
+	}
+
+	return map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    msg.Title,
+		"themeColor": severityColors[msg.Severity][1:],
+		"title":      fmt.Sprintf("[%s] %s", msg.Severity, msg.Title),
+		"sections": []map[string]interface{}{
+			{
+				"activityTitle":    msg.Text,
+				"activitySubtitle": fmt.Sprintf("%s · %s", msg.Source, msg.Time.Format(time.RFC3339)),
+				"facts":            facts,
+			},
+		},
+	}
+}
+
+// WebhookSender posts messages to Slack and Teams incoming webhooks
+type WebhookSender struct {
+	client *http.Client
+}
+
+// NewWebhookSender create a webhook sender, client may be nil
+func NewWebhookSender(client *http.Client) *WebhookSender {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WebhookSender{client: client}
+}
+
+// Send format msg for the channel type and post it to webhookURL
+func (s *WebhookSender) Send(ctx context.Context, channelType ChannelType, webhookURL string, msg Message) error {
+	var payload map[string]interface{}
+	switch channelType {
+	case SlackChannel:
+		payload = FormatSlack(msg)
+	case TeamsChannel:
+		payload = FormatTeams(msg)
+	default:
+		return fmt.Errorf("unsupported channel type: %s", channelType)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-connector/pkg/events"
+)
+
+func TestMessageFromEvent(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        events.Event
+		wantTitle    string
+		wantSeverity Severity
+	}{
+		{
+			name:         "agent down",
+			event:        events.New(events.TypeAgentHealthChanged, "dataflow-api", "agent-1", map[string]interface{}{"agent_id": "agent-1", "healthy": false}),
+			wantTitle:    "Agent down",
+			wantSeverity: SeverityCritical,
+		},
+		{
+			name:         "agent recovered",
+			event:        events.New(events.TypeAgentHealthChanged, "dataflow-api", "agent-1", map[string]interface{}{"agent_id": "agent-1", "healthy": true}),
+			wantTitle:    "Agent recovered",
+			wantSeverity: SeverityInfo,
+		},
+		{
+			name:         "quota exceeded",
+			event:        events.New(events.TypeQuotaExceeded, "dataflow-api", "agent-1", map[string]interface{}{"limit": "queue"}),
+			wantTitle:    "Quota exceeded",
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "stream interrupted",
+			event:        events.New(events.TypeStreamInterrupted, "dataflow-api", "agent-1", map[string]interface{}{"partial_content_length": 120}),
+			wantTitle:    "Stream interrupted",
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "error rate",
+			event:        events.New(events.TypeAgentErrorRateHigh, "dataflow-api", "agent-1", nil),
+			wantTitle:    "Anomalous error rate",
+			wantSeverity: SeverityCritical,
+		},
+		{
+			name:         "user impersonated",
+			event:        events.New(events.TypeUserImpersonated, "auth-api", "alice", map[string]interface{}{"username": "alice", "impersonator": "admin"}),
+			wantTitle:    "User impersonated",
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "login anomaly",
+			event:        events.New(events.TypeLoginAnomaly, "auth-api", "alice", map[string]interface{}{"username": "alice", "anomalies": "new_country", "action": "verification_required"}),
+			wantTitle:    "Unusual login",
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "unknown type",
+			event:        events.New("custom.event", "dataflow-api", "x", nil),
+			wantTitle:    "custom.event",
+			wantSeverity: SeverityInfo,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := MessageFromEvent(tt.event)
+			if msg.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", msg.Title, tt.wantTitle)
+			}
+			if msg.Severity != tt.wantSeverity {
+				t.Errorf("severity = %q, want %q", msg.Severity, tt.wantSeverity)
+			}
+			if msg.Text == "" {
+				t.Error("expected message text")
+			}
+		})
+	}
+}
+
+func TestWebhookSenderSend(t *testing.T) {
+	msg := Message{
+		Title:    "Agent down",
+		Text:     "Requests to agent agent-1 are failing.",
+		Severity: SeverityCritical,
+		Fields:   []Field{{Name: "agent_id", Value: "agent-1"}},
+		Source:   "dataflow-api",
+		Time:     time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name        string
+		channelType ChannelType
+		status      int
+		wantKey     string
+		wantErr     bool
+	}{
+		{name: "slack", channelType: SlackChannel, status: http.StatusOK, wantKey: "attachments"},
+		{name: "teams", channelType: TeamsChannel, status: http.StatusOK, wantKey: "sections"},
+		{name: "webhook error", channelType: SlackChannel, status: http.StatusNotFound, wantErr: true},
+		{name: "unsupported type", channelType: "pager", status: http.StatusOK, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				json.Unmarshal(body, &received)
+				w.WriteHeader(tt.status)
+				w.Write([]byte("no_service"))
+			}))
+			defer server.Close()
+
+			err := NewWebhookSender(nil).Send(context.Background(), tt.channelType, server.URL, msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := received[tt.wantKey]; !ok {
+				t.Fatalf("payload missing %q: %v", tt.wantKey, received)
+			}
+		})
+	}
+}
+
+func TestFormatTeamsThemeColor(t *testing.T) {
+	payload := FormatTeams(Message{Title: "t", Severity: SeverityWarning})
+	if color := payload["themeColor"].(string); strings.HasPrefix(color, "#") || color != "ECB22E" {
+		t.Fatalf("unexpected theme color %q", color)
+	}
+}
@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SpecPath is the path the spec is served at by every service
+const SpecPath = "/openapi.json"
+
+// Route an HTTP route registered on a router
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Endpoint documentation of one route
+type Endpoint struct {
+	Summary     string
+	Tags        []string
+	OperationID string       // derived from method and path when empty
+	Query       []*Parameter // query parameters, path parameters are derived from the path
+	Request     interface{}  // request body value, nil when the route has no body
+	Response    interface{}  // value of the data field of the response envelope, nil when there is none
+	Status      int          // success status, defaults to 200
+	Paginated   bool         // the envelope carries pagination information
+	Raw         bool         // the response is Response itself, not wrapped in the envelope
+	Security    []string     // names of accepted security schemes, empty means public
+}
+
+// Generator builds an OpenAPI document from the routes of a service and the endpoint descriptions
+type Generator struct {
+	info            Info
+	servers         []Server
+	endpoints       map[string]Endpoint
+	securitySchemes map[string]*SecurityScheme
+}
+
+// NewGenerator create a generator for a service
+func NewGenerator(title, version, description string) *Generator {
+	return &Generator{
+		info: Info{
+			Title:       title,
+			Version:     version,
+			Description: description,
+		},
+		endpoints:       make(map[string]Endpoint),
+		securitySchemes: make(map[string]*SecurityScheme),
+	}
+}
+
+// AddServer add a base URL to the document
+func (g *Generator) AddServer(url, description string) {
+	g.servers = append(g.servers, Server{URL: url, Description: description})
+}
+
+// AddSecurityScheme register a security scheme endpoints can refer to by name
+func (g *Generator) AddSecurityScheme(name string, scheme *SecurityScheme) {
+	g.securitySchemes[name] = scheme
+}
+
+// Describe document the route with the given method and router path (gin syntax, e.g. /agents/:id)
+func (g *Generator) Describe(method, path string, endpoint Endpoint) {
+	g.endpoints[routeKey(method, path)] = endpoint
+}
+
+// Build generate the document for the given routes, undocumented routes get a generic entry
+// so the spec always lists every route the service serves
+func (g *Generator) Build(routes []Route) *Document {
+	registry := newSchemaRegistry()
+	registry.schemas["Error"] = errorSchema()
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    g.info,
+		Servers: g.servers,
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas:         registry.schemas,
+			SecuritySchemes: g.securitySchemes,
+		},
+	}
+
+	sorted := make([]Route, len(routes))
+	copy(sorted, routes)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+
+	for _, route := range sorted {
+		if route.Path == SpecPath {
+			continue
+		}
+
+		endpoint, documented := g.endpoints[routeKey(route.Method, route.Path)]
+		if !documented {
+			endpoint = Endpoint{Summary: route.Method + " " + route.Path}
+		}
+
+		path, pathParams := convertPath(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = g.buildOperation(registry, route, endpoint, pathParams)
+	}
+
+	return doc
+}
+
+// buildOperation build the operation of one route
+func (g *Generator) buildOperation(registry *schemaRegistry, route Route, endpoint Endpoint, pathParams []string) *Operation {
+	operation := &Operation{
+		OperationID: endpoint.OperationID,
+		Summary:     endpoint.Summary,
+		Tags:        endpoint.Tags,
+		Responses:   make(map[string]*Response),
+	}
+	if operation.OperationID == "" {
+		operation.OperationID = operationID(route)
+	}
+
+	for _, name := range pathParams {
+		operation.Parameters = append(operation.Parameters, &Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	operation.Parameters = append(operation.Parameters, endpoint.Query...)
+
+	if body := registry.schemaOf(endpoint.Request); body != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: body}},
+		}
+	}
+
+	status := endpoint.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	data := registry.schemaOf(endpoint.Response)
+	responseSchema := data
+	if !endpoint.Raw {
+		responseSchema = envelopeSchema(data, endpoint.Paginated)
+	}
+
+	success := &Response{Description: http.StatusText(status)}
+	if responseSchema != nil {
+		success.Content = map[string]*MediaType{"application/json": {Schema: responseSchema}}
+	}
+	operation.Responses[strconv.Itoa(status)] = success
+	operation.Responses["default"] = &Response{
+		Description: "Error",
+		Content: map[string]*MediaType{
+			"application/json": {Schema: envelopeSchema(nil, false)},
+		},
+	}
+
+	for _, name := range endpoint.Security {
+		operation.Security = append(operation.Security, map[string][]string{name: {}})
+	}
+
+	return operation
+}
+
+// QueryParam build a query parameter, typ is a JSON schema type such as "string" or "integer"
+func QueryParam(name, typ, description string) *Parameter {
+	return &Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &Schema{Type: typ},
+	}
+}
+
+// envelopeSchema the {code, message, data, error} envelope shared by the services
+func envelopeSchema(data *Schema, paginated bool) *Schema {
+	schema := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":    {Type: "integer", Format: "int32"},
+			"message": {Type: "string"},
+			"error":   {Ref: "#/components/schemas/Error"},
+		},
+		Required: []string{"code", "message"},
+	}
+
+	if data != nil {
+		if paginated {
+			data = &Schema{Type: "array", Items: data}
+		}
+		schema.Properties["data"] = data
+	}
+
+	if paginated {
+		schema.Properties["pagination"] = &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"page":        {Type: "integer", Format: "int32"},
+				"page_size":   {Type: "integer", Format: "int32"},
+				"total":       {Type: "integer", Format: "int64"},
+				"total_pages": {Type: "integer", Format: "int32"},
+			},
+		}
+	}
+
+	return schema
+}
+
+// errorSchema the error object of the envelope
+func errorSchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"type":    {Type: "string"},
+			"code":    {Type: "string"},
+			"message": {Type: "string"},
+			"details": {},
+		},
+		Required: []string{"type", "code", "message"},
+	}
+}
+
+// convertPath turn a gin path into an OpenAPI path and list its parameters
+func convertPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derive a stable operation ID such as get_api_v1_agents_id
+func operationID(route Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+	for _, segment := range strings.Split(route.Path, "/") {
+		segment = strings.TrimLeft(segment, ":*")
+		if segment == "" {
+			continue
+		}
+		b.WriteByte('_')
+		b.WriteString(strings.NewReplacer("-", "_", ".", "_").Replace(segment))
+	}
+	return b.String()
+}
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
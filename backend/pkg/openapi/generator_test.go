@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testAgent struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name" binding:"required,min=1,max=255"`
+	Type      string     `json:"type" binding:"required,oneof=openai dify"`
+	URL       string     `json:"url" binding:"required,url"`
+	QPS       *int       `json:"qps,omitempty" binding:"omitempty,min=1"`
+	Secret    string     `json:"-"`
+	Owner     *testOwner `json:"owner,omitempty"`
+	Tags      []string   `json:"tags" binding:"max=5"`
+	CreatedAt time.Time  `json:"created_at"`
+	hidden    string
+}
+
+type testOwner struct {
+	Name   string     `json:"name"`
+	Parent *testOwner `json:"parent,omitempty"`
+}
+
+func TestConvertPath(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantPath   string
+		wantParams []string
+	}{
+		{"/api/v1/agents", "/api/v1/agents", nil},
+		{"/api/v1/agents/:id", "/api/v1/agents/{id}", []string{"id"}},
+		{"/api/v1/agents/:id/queue-config", "/api/v1/agents/{id}/queue-config", []string{"id"}},
+		{"/files/*filepath", "/files/{filepath}", []string{"filepath"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			gotPath, gotParams := convertPath(tt.path)
+			if gotPath != tt.wantPath {
+				t.Errorf("convertPath() path = %v, want %v", gotPath, tt.wantPath)
+			}
+			if !reflect.DeepEqual(gotParams, tt.wantParams) {
+				t.Errorf("convertPath() params = %v, want %v", gotParams, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	got := operationID(Route{Method: http.MethodPost, Path: "/api/v1/agents/:id/rotate-key"})
+	if got != "post_api_v1_agents_id_rotate_key" {
+		t.Errorf("operationID() = %v", got)
+	}
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	registry := newSchemaRegistry()
+	ref := registry.schemaOf(testAgent{})
+	if ref.Ref != "#/components/schemas/testAgent" {
+		t.Fatalf("schemaOf() ref = %q", ref.Ref)
+	}
+
+	schema := registry.schemas["testAgent"]
+	if schema == nil {
+		t.Fatal("testAgent schema not registered")
+	}
+
+	if _, ok := schema.Properties["Secret"]; ok {
+		t.Error("field with json:\"-\" should be skipped")
+	}
+	if _, ok := schema.Properties["hidden"]; ok {
+		t.Error("unexported field should be skipped")
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"name", "type", "url"}) {
+		t.Errorf("required = %v", schema.Required)
+	}
+	if !reflect.DeepEqual(schema.Properties["type"].Enum, []string{"openai", "dify"}) {
+		t.Errorf("type enum = %v", schema.Properties["type"].Enum)
+	}
+	if schema.Properties["url"].Format != "uri" {
+		t.Errorf("url format = %q", schema.Properties["url"].Format)
+	}
+	if name := schema.Properties["name"]; name.MinLength == nil || *name.MinLength != 1 || name.MaxLength == nil || *name.MaxLength != 255 {
+		t.Errorf("name length bounds not applied: %+v", name)
+	}
+	if qps := schema.Properties["qps"]; !qps.Nullable || qps.Minimum == nil || *qps.Minimum != 1 {
+		t.Errorf("qps should be nullable with minimum 1: %+v", qps)
+	}
+	if tags := schema.Properties["tags"]; tags.Type != "array" || tags.MaxItems == nil || *tags.MaxItems != 5 {
+		t.Errorf("tags should be an array with maxItems 5: %+v", tags)
+	}
+	if created := schema.Properties["created_at"]; created.Format != "date-time" {
+		t.Errorf("created_at format = %q", created.Format)
+	}
+
+	// recursive types end in a reference instead of looping
+	owner := registry.schemas["testOwner"]
+	if owner == nil || owner.Properties["parent"].Ref != "#/components/schemas/testOwner" {
+		t.Errorf("recursive owner schema = %+v", owner)
+	}
+}
+
+func TestGeneratorBuild(t *testing.T) {
+	generator := NewGenerator("Test API", "1.0.0", "")
+	generator.AddSecurityScheme("bearerAuth", &SecurityScheme{Type: "http", Scheme: "bearer"})
+	generator.Describe(http.MethodGet, "/agents", Endpoint{
+		Summary:   "List agents",
+		Response:  testAgent{},
+		Paginated: true,
+		Security:  []string{"bearerAuth"},
+		Query:     []*Parameter{QueryParam("search", "string", "search term")},
+	})
+	generator.Describe(http.MethodPost, "/agents", Endpoint{
+		Summary:  "Create agent",
+		Request:  testAgent{},
+		Response: testAgent{},
+		Status:   http.StatusCreated,
+	})
+
+	doc := generator.Build([]Route{
+		{Method: http.MethodGet, Path: "/agents"},
+		{Method: http.MethodPost, Path: "/agents"},
+		{Method: http.MethodDelete, Path: "/agents/:id"},
+		{Method: http.MethodGet, Path: SpecPath},
+	})
+
+	if _, ok := doc.Paths[SpecPath]; ok {
+		t.Error("spec path should not be documented")
+	}
+
+	list := doc.Paths["/agents"]["get"]
+	if list == nil || list.Summary != "List agents" || len(list.Security) != 1 {
+		t.Fatalf("list operation = %+v", list)
+	}
+	data := list.Responses["200"].Content["application/json"].Schema.Properties["data"]
+	if data.Type != "array" || data.Items.Ref != "#/components/schemas/testAgent" {
+		t.Errorf("paginated data schema = %+v", data)
+	}
+
+	create := doc.Paths["/agents"]["post"]
+	if create.RequestBody == nil || create.Responses["201"] == nil {
+		t.Errorf("create operation = %+v", create)
+	}
+
+	remove := doc.Paths["/agents/{id}"]["delete"]
+	if remove == nil || len(remove.Parameters) != 1 || remove.Parameters[0].In != "path" {
+		t.Fatalf("undocumented route should still be listed with its path parameter: %+v", remove)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatalf("document should marshal: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoutesFromGin list the routes registered on a gin engine
+func RoutesFromGin(engine *gin.Engine) []Route {
+	infos := engine.Routes()
+	routes := make([]Route, 0, len(infos))
+	for _, info := range infos {
+		routes = append(routes, Route{Method: info.Method, Path: info.Path})
+	}
+	return routes
+}
+
+// GinHandler serve the document of the engine's routes, built on the first request
+// so routes registered after the handler are included
+func GinHandler(generator *Generator, engine *gin.Engine) gin.HandlerFunc {
+	var once sync.Once
+	var body []byte
+	var buildErr error
+
+	return func(c *gin.Context) {
+		once.Do(func() {
+			body, buildErr = json.Marshal(generator.Build(RoutesFromGin(engine)))
+		})
+
+		if buildErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    http.StatusInternalServerError,
+				"message": "Failed to build OpenAPI document",
+				"error": gin.H{
+					"type":    "internal_error",
+					"code":    "500",
+					"message": buildErr.Error(),
+				},
+			})
+			return
+		}
+
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
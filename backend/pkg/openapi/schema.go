@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaRegistry converts Go types to schemas, named structs become reusable components
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	types   map[reflect.Type]string
+	names   map[string]reflect.Type
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: make(map[string]*Schema),
+		types:   make(map[reflect.Type]string),
+		names:   make(map[string]reflect.Type),
+	}
+}
+
+// schemaOf returns the schema for the type of value, nil when value is nil
+func (r *schemaRegistry) schemaOf(value interface{}) *Schema {
+	if value == nil {
+		return nil
+	}
+	return r.schemaFor(reflect.TypeOf(value))
+}
+
+// schemaFor returns the schema of a Go type
+func (r *schemaRegistry) schemaFor(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		schema := r.schemaFor(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "duration in nanoseconds"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + r.register(t)}
+	default:
+		// interface{} and anything else accepts any JSON value
+		return &Schema{}
+	}
+}
+
+// register adds a named struct to the components and returns its component name
+func (r *schemaRegistry) register(t reflect.Type) string {
+	if name, ok := r.types[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if existing, ok := r.names[name]; ok && existing != t {
+		// same type name in two packages, qualify with the package name
+		pkgPath := t.PkgPath()
+		pkgName := pkgPath[strings.LastIndex(pkgPath, "/")+1:]
+		name = strings.ToUpper(pkgName[:1]) + pkgName[1:] + name
+	}
+
+	// reserve the name before walking the fields so recursive types terminate
+	r.types[t] = name
+	r.names[name] = t
+	r.schemas[name] = r.structSchema(t)
+	return name
+}
+
+// structSchema builds an object schema from exported fields and their json and binding tags
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		// embedded structs without a json name are flattened like encoding/json does
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := r.structSchema(embedded)
+				for propName, prop := range inner.Properties {
+					schema.Properties[propName] = prop
+				}
+				schema.Required = append(schema.Required, inner.Required...)
+				continue
+			}
+		}
+
+		prop := r.schemaFor(field.Type)
+		required := applyBinding(prop, field.Tag.Get("binding"))
+		if prop.Ref == "" {
+			if description := field.Tag.Get("description"); description != "" {
+				prop.Description = description
+			}
+		}
+
+		schema.Properties[name] = prop
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// jsonFieldName resolve the JSON property name of a struct field
+func jsonFieldName(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+
+	name, _, _ = strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// applyBinding translate gin binding rules into schema constraints, reports whether the field is required
+func applyBinding(schema *Schema, binding string) bool {
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		if key == "required" {
+			required = true
+		}
+		if schema.Ref != "" {
+			continue // constraints belong to the component
+		}
+		switch key {
+		case "oneof":
+			schema.Enum = strings.Fields(value)
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		case "min", "max":
+			applyBound(schema, key, value)
+		}
+	}
+	return required
+}
+
+// applyBound set a min or max constraint matching the schema type
+func applyBound(schema *Schema, key, value string) {
+	switch schema.Type {
+	case "integer", "number":
+		bound, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return
+		}
+		if key == "min" {
+			schema.Minimum = &bound
+		} else {
+			schema.Maximum = &bound
+		}
+	case "string", "array":
+		bound, err := strconv.Atoi(value)
+		if err != nil {
+			return
+		}
+		switch {
+		case schema.Type == "string" && key == "min":
+			schema.MinLength = &bound
+		case schema.Type == "string":
+			schema.MaxLength = &bound
+		case key == "min":
+			schema.MinItems = &bound
+		default:
+			schema.MaxItems = &bound
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package passwordhash hashes passwords with a configurable algorithm, bcrypt or
+// argon2id, verifies hashes of either algorithm and tells when a stored hash was made
+// with other parameters than the configured ones, so it can be replaced on next login.
+//
+// Argon2id hashes use the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//
+// with salt and key in unpadded standard base64.
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	// maxArgon2MemoryKiB and maxArgon2Time bound the cost of a hash, a stored hash
+	// asking for more is rejected instead of exhausting memory or CPU at login
+	maxArgon2MemoryKiB = 2 * 1024 * 1024
+	maxArgon2Time      = 64
+)
+
+var (
+	// ErrMismatch the password does not match the hash
+	ErrMismatch = errors.New("password does not match")
+
+	// ErrUnknownHash the hash was not made by a supported algorithm
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// Params algorithm and cost of new hashes
+type Params struct {
+	Algorithm string
+
+	// BcryptCost log2 of the bcrypt rounds
+	BcryptCost int
+
+	// Argon2Time passes over the memory, Argon2MemoryKiB memory in KiB and
+	// Argon2Threads the parallelism of argon2id
+	Argon2Time      uint32
+	Argon2MemoryKiB uint32
+	Argon2Threads   uint8
+}
+
+// DefaultParams bcrypt at its default cost, argon2id parameters follow RFC 9106's
+// second recommended option
+func DefaultParams() Params {
+	return Params{
+		Algorithm:       Bcrypt,
+		BcryptCost:      bcrypt.DefaultCost,
+		Argon2Time:      3,
+		Argon2MemoryKiB: 64 * 1024,
+		Argon2Threads:   2,
+	}
+}
+
+// Hasher hashes new passwords with its parameters and verifies existing hashes
+type Hasher struct {
+	params Params
+}
+
+// New create a hasher, an empty algorithm means bcrypt and zero costs their defaults
+func New(params Params) (*Hasher, error) {
+	defaults := DefaultParams()
+	if params.Algorithm == "" {
+		params.Algorithm = defaults.Algorithm
+	}
+	if params.BcryptCost == 0 {
+		params.BcryptCost = defaults.BcryptCost
+	}
+	if params.Argon2Time == 0 {
+		params.Argon2Time = defaults.Argon2Time
+	}
+	if params.Argon2MemoryKiB == 0 {
+		params.Argon2MemoryKiB = defaults.Argon2MemoryKiB
+	}
+	if params.Argon2Threads == 0 {
+		params.Argon2Threads = defaults.Argon2Threads
+	}
+
+	switch params.Algorithm {
+	case Bcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, params.BcryptCost)
+		}
+	case Argon2id:
+		if err := checkArgon2Params(params); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q, expected bcrypt or argon2id", params.Algorithm)
+	}
+	return &Hasher{params: params}, nil
+}
+
+// Params the parameters of new hashes
+func (h *Hasher) Params() Params {
+	return h.params
+}
+
+// Hash a password with the hasher's algorithm and parameters
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Argon2Time, h.params.Argon2MemoryKiB, h.params.Argon2Threads, argon2KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+		h.params.Argon2MemoryKiB, h.params.Argon2Time, h.params.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify check a password against a hash of any supported algorithm, ErrMismatch
+// when it does not match
+func (h *Hasher) Verify(hash, password string) error {
+	if strings.HasPrefix(hash, "$"+Argon2id+"$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2MemoryKiB, params.Argon2Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return ErrMismatch
+		}
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return ErrMismatch
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+	return nil
+}
+
+// NeedsRehash whether the hash was made with another algorithm or other parameters
+// than new hashes get
+func (h *Hasher) NeedsRehash(hash string) bool {
+	return Describe(hash) != h.Describe()
+}
+
+// Describe the algorithm and parameters of new hashes, as Describe reports them for a hash
+func (h *Hasher) Describe() string {
+	if h.params.Algorithm == Bcrypt {
+		return fmt.Sprintf("%s cost=%d", Bcrypt, h.params.BcryptCost)
+	}
+	return fmt.Sprintf("%s m=%d,t=%d,p=%d", Argon2id, h.params.Argon2MemoryKiB, h.params.Argon2Time, h.params.Argon2Threads)
+}
+
+// Describe the algorithm and parameters a hash was made with, e.g. "bcrypt cost=12",
+// "unknown" for hashes of no supported algorithm
+func Describe(hash string) string {
+	if strings.HasPrefix(hash, "$"+Argon2id+"$") {
+		params, _, _, err := decodeArgon2id(hash)
+		if err != nil {
+			return "unknown"
+		}
+		return fmt.Sprintf("%s m=%d,t=%d,p=%d", Argon2id, params.Argon2MemoryKiB, params.Argon2Time, params.Argon2Threads)
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s cost=%d", Bcrypt, cost)
+}
+
+// checkArgon2Params check that argon2id parameters are in the range argon2 accepts and
+// within the cost bounds
+func checkArgon2Params(params Params) error {
+	switch {
+	case params.Argon2Time < 1 || params.Argon2Time > maxArgon2Time:
+		return fmt.Errorf("argon2id time must be between 1 and %d, got %d", maxArgon2Time, params.Argon2Time)
+	case params.Argon2Threads < 1:
+		return errors.New("argon2id threads must be at least 1")
+	case params.Argon2MemoryKiB < 8*uint32(params.Argon2Threads):
+		return fmt.Errorf("argon2id memory must be at least 8 KiB per thread, got %d KiB", params.Argon2MemoryKiB)
+	case params.Argon2MemoryKiB > maxArgon2MemoryKiB:
+		return fmt.Errorf("argon2id memory must be at most %d KiB, got %d KiB", maxArgon2MemoryKiB, params.Argon2MemoryKiB)
+	}
+	return nil
+}
+
+// decodeArgon2id split a PHC argon2id hash into its parameters, salt and key
+func decodeArgon2id(hash string) (Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownHash, parts[2])
+	}
+
+	params := Params{Algorithm: Argon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2MemoryKiB, &params.Argon2Time, &params.Argon2Threads); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("%w: invalid argon2id parameters", ErrUnknownHash)
+	}
+	if err := checkArgon2Params(params); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("%w: invalid argon2id salt", ErrUnknownHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, fmt.Errorf("%w: invalid argon2id key", ErrUnknownHash)
+	}
+	return params, salt, key, nil
+}
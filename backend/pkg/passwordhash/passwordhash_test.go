@@ -0,0 +1,141 @@
+package passwordhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams cheap parameters so the tests run fast
+var testParams = map[string]Params{
+	Bcrypt:   {Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost},
+	Argon2id: {Algorithm: Argon2id, Argon2Time: 1, Argon2MemoryKiB: 64, Argon2Threads: 1},
+}
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	for algorithm, params := range testParams {
+		t.Run(algorithm, func(t *testing.T) {
+			hasher, err := New(params)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			hash, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if err := hasher.Verify(hash, "correct horse"); err != nil {
+				t.Errorf("Verify of the right password: %v", err)
+			}
+			if err := hasher.Verify(hash, "wrong horse"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify of a wrong password = %v, want ErrMismatch", err)
+			}
+			if hasher.NeedsRehash(hash) {
+				t.Errorf("NeedsRehash of a fresh hash %q = true", hash)
+			}
+		})
+	}
+}
+
+func TestHasher_VerifiesOtherAlgorithms(t *testing.T) {
+	bcryptHasher, _ := New(testParams[Bcrypt])
+	argonHasher, _ := New(testParams[Argon2id])
+
+	hash, err := bcryptHasher.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := argonHasher.Verify(hash, "secret"); err != nil {
+		t.Errorf("argon2id hasher failed to verify a bcrypt hash: %v", err)
+	}
+	if !argonHasher.NeedsRehash(hash) {
+		t.Error("Expected a bcrypt hash to need a rehash when argon2id is configured")
+	}
+}
+
+func TestHasher_NeedsRehashOnParameterChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		before Params
+		after  Params
+	}{
+		{
+			name:   "bcrypt cost",
+			before: Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost},
+			after:  Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1},
+		},
+		{
+			name:   "argon2id memory",
+			before: testParams[Argon2id],
+			after:  Params{Algorithm: Argon2id, Argon2Time: 1, Argon2MemoryKiB: 128, Argon2Threads: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := New(tt.before)
+			after, _ := New(tt.after)
+			hash, err := before.Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !after.NeedsRehash(hash) {
+				t.Errorf("NeedsRehash(%s) with %s = false", Describe(hash), after.Describe())
+			}
+		})
+	}
+}
+
+func TestNew_InvalidParams(t *testing.T) {
+	for _, params := range []Params{
+		{Algorithm: "md5"},
+		{Algorithm: Bcrypt, BcryptCost: 40},
+		{Algorithm: Argon2id, Argon2MemoryKiB: 8, Argon2Threads: 4},
+		{Algorithm: Argon2id, Argon2MemoryKiB: maxArgon2MemoryKiB + 1},
+		{Algorithm: Argon2id, Argon2Time: maxArgon2Time + 1},
+	} {
+		if _, err := New(params); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", params)
+		}
+	}
+}
+
+func TestVerify_OutOfRangeArgon2Params(t *testing.T) {
+	hasher, err := New(testParams[Argon2id])
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	hash, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	parts := strings.Split(hash, "$")
+
+	// stored hashes whose parameters would make argon2 panic or allocate without bound
+	for _, params := range []string{
+		"m=64,t=0,p=1",
+		"m=64,t=1,p=0",
+		"m=4,t=1,p=1",
+		"m=4294967295,t=1,p=1",
+		"m=64,t=4294967295,p=1",
+	} {
+		parts[3] = params
+		malformed := strings.Join(parts, "$")
+		if err := hasher.Verify(malformed, "secret"); !errors.Is(err, ErrUnknownHash) {
+			t.Errorf("Verify(%s) error = %v, want ErrUnknownHash", params, err)
+		}
+		if got := Describe(malformed); got != "unknown" {
+			t.Errorf("Describe(%s) = %q, want unknown", params, got)
+		}
+	}
+}
+
+func TestDescribe_Unknown(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$broken"} {
+		if got := Describe(hash); got != "unknown" {
+			t.Errorf("Describe(%q) = %q, want unknown", hash, got)
+		}
+	}
+}
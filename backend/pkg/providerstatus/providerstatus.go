@@ -0,0 +1,221 @@
+package providerstatus
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Providers whose status is polled
+const (
+	OpenAI = "openai"
+	Azure  = "azure"
+)
+
+// Format how a status source describes the state of its provider
+type Format string
+
+const (
+	// FormatStatuspage the Statuspage summary API, /api/v2/summary.json, used by
+	// status.openai.com and many other providers
+	FormatStatuspage Format = "statuspage"
+
+	// FormatRSS a feed with one item per open incident, e.g. the Azure status feed
+	FormatRSS Format = "rss"
+)
+
+// Indicator overall state of a provider, from none to critical
+type Indicator string
+
+const (
+	IndicatorNone     Indicator = "none"
+	IndicatorMinor    Indicator = "minor"
+	IndicatorMajor    Indicator = "major"
+	IndicatorCritical Indicator = "critical"
+)
+
+// maxBodyBytes largest status page read
+const maxBodyBytes = 4 << 20
+
+// Source where the status of a provider is read
+type Source struct {
+	Provider string `json:"provider"`
+	URL      string `json:"url"`
+	Format   Format `json:"format"`
+}
+
+// Incident an unresolved incident reported by a provider
+type Incident struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status,omitempty"`
+	Impact    string    `json:"impact,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+// Status the reported state of a provider
+type Status struct {
+	Provider    string     `json:"provider"`
+	Indicator   Indicator  `json:"indicator"`
+	Description string     `json:"description"`
+	Incidents   []Incident `json:"incidents"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// HasIncident whether the provider reports degraded service
+func (s *Status) HasIncident() bool {
+	return s != nil && s.Indicator != "" && s.Indicator != IndicatorNone
+}
+
+// Checker reads the status sources of the providers
+type Checker struct {
+	client *http.Client
+}
+
+// NewChecker create a checker, client may be nil
+func NewChecker(client *http.Client) *Checker {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Checker{client: client}
+}
+
+// Check read the current status of the source's provider
+func (c *Checker) Check(ctx context.Context, source Source) (*Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status of %s: %w", source.Provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status page of %s returned %d", source.Provider, resp.StatusCode)
+	}
+
+	body := io.LimitReader(resp.Body, maxBodyBytes)
+	var status *Status
+	switch source.Format {
+	case FormatStatuspage, "":
+		status, err = ParseStatuspage(body)
+	case FormatRSS:
+		status, err = ParseRSS(body)
+	default:
+		return nil, fmt.Errorf("unsupported status format: %s", source.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse status of %s: %w", source.Provider, err)
+	}
+	status.Provider = source.Provider
+	status.CheckedAt = time.Now()
+	return status, nil
+}
+
+// statuspageSummary the parts of a Statuspage summary that are read
+type statuspageSummary struct {
+	Status struct {
+		Indicator   string `json:"indicator"`
+		Description string `json:"description"`
+	} `json:"status"`
+	Incidents []struct {
+		Name      string    `json:"name"`
+		Status    string    `json:"status"`
+		Impact    string    `json:"impact"`
+		Shortlink string    `json:"shortlink"`
+		StartedAt time.Time `json:"started_at"`
+	} `json:"incidents"`
+}
+
+// ParseStatuspage the status described by a Statuspage summary or status document;
+// indicators other than none, minor, major and critical, e.g. maintenance, count as none
+func ParseStatuspage(r io.Reader) (*Status, error) {
+	var summary statuspageSummary
+	if err := json.NewDecoder(r).Decode(&summary); err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Indicator:   IndicatorNone,
+		Description: summary.Status.Description,
+		Incidents:   []Incident{},
+	}
+	switch indicator := Indicator(summary.Status.Indicator); indicator {
+	case IndicatorMinor, IndicatorMajor, IndicatorCritical:
+		status.Indicator = indicator
+	}
+	for _, incident := range summary.Incidents {
+		status.Incidents = append(status.Incidents, Incident{
+			Name:      incident.Name,
+			Status:    incident.Status,
+			Impact:    incident.Impact,
+			URL:       incident.Shortlink,
+			StartedAt: incident.StartedAt,
+		})
+	}
+	return status, nil
+}
+
+// rssFeed the parts of an RSS feed that are read
+type rssFeed struct {
+	Items []struct {
+		Title   string `xml:"title"`
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+// ParseRSS the status described by a feed listing the open incidents; feeds do not
+// grade incidents, so any open incident makes the indicator minor
+func ParseRSS(r io.Reader) (*Status, error) {
+	var feed rssFeed
+	if err := xml.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Indicator:   IndicatorNone,
+		Description: "All Systems Operational",
+		Incidents:   []Incident{},
+	}
+	for _, item := range feed.Items {
+		incident := Incident{Name: strings.TrimSpace(item.Title), URL: strings.TrimSpace(item.Link)}
+		if startedAt, err := time.Parse(time.RFC1123Z, strings.TrimSpace(item.PubDate)); err == nil {
+			incident.StartedAt = startedAt
+		} else if startedAt, err := time.Parse(time.RFC1123, strings.TrimSpace(item.PubDate)); err == nil {
+			incident.StartedAt = startedAt
+		}
+		status.Incidents = append(status.Incidents, incident)
+	}
+	if len(status.Incidents) > 0 {
+		status.Indicator = IndicatorMinor
+		status.Description = fmt.Sprintf("%d open incidents", len(status.Incidents))
+	}
+	return status, nil
+}
+
+// ProviderOfURL the provider serving an agent's upstream URL, empty when it is not
+// one of the polled providers, e.g. a self-hosted Dify
+func ProviderOfURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	switch {
+	case host == "openai.com" || strings.HasSuffix(host, ".openai.com"):
+		return OpenAI
+	case strings.HasSuffix(host, ".openai.azure.com"), strings.HasSuffix(host, ".cognitiveservices.azure.com"),
+		strings.HasSuffix(host, ".services.ai.azure.com"):
+		return Azure
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,154 @@
+package providerstatus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const statuspageIncident = `{
+  "page": {"id": "abc", "name": "OpenAI"},
+  "status": {"indicator": "major", "description": "Partial System Outage"},
+  "components": [],
+  "incidents": [
+    {
+      "name": "Elevated error rates on Chat Completions",
+      "status": "investigating",
+      "impact": "major",
+      "shortlink": "https://stspg.io/xyz",
+      "started_at": "2026-10-16T08:12:00.000Z"
+    }
+  ]
+}`
+
+const azureFeed = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Azure Status</title>
+    <item>
+      <title>Azure OpenAI Service - West Europe - Investigating</title>
+      <link>https://azure.status.microsoft/en-us/status</link>
+      <pubDate>Fri, 16 Oct 2026 08:30:00 Z</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+func TestParseStatuspage(t *testing.T) {
+	status, err := ParseStatuspage(strings.NewReader(statuspageIncident))
+	if err != nil {
+		t.Fatalf("ParseStatuspage() error = %v", err)
+	}
+	if status.Indicator != IndicatorMajor || !status.HasIncident() {
+		t.Errorf("indicator = %q, want major", status.Indicator)
+	}
+	if status.Description != "Partial System Outage" {
+		t.Errorf("description = %q", status.Description)
+	}
+	if len(status.Incidents) != 1 {
+		t.Fatalf("incidents = %d, want 1", len(status.Incidents))
+	}
+	incident := status.Incidents[0]
+	if incident.Name != "Elevated error rates on Chat Completions" || incident.Impact != "major" || incident.URL != "https://stspg.io/xyz" {
+		t.Errorf("incident = %+v", incident)
+	}
+	if !incident.StartedAt.Equal(time.Date(2026, 10, 16, 8, 12, 0, 0, time.UTC)) {
+		t.Errorf("started_at = %v", incident.StartedAt)
+	}
+}
+
+func TestParseStatuspageOperational(t *testing.T) {
+	for _, indicator := range []string{"none", "maintenance", ""} {
+		body := `{"status": {"indicator": "` + indicator + `", "description": "All Systems Operational"}}`
+		status, err := ParseStatuspage(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("ParseStatuspage(%q) error = %v", indicator, err)
+		}
+		if status.HasIncident() {
+			t.Errorf("indicator %q: HasIncident() = true", indicator)
+		}
+		if status.Incidents == nil {
+			t.Errorf("indicator %q: incidents are nil, want empty", indicator)
+		}
+	}
+}
+
+func TestParseRSS(t *testing.T) {
+	status, err := ParseRSS(strings.NewReader(azureFeed))
+	if err != nil {
+		t.Fatalf("ParseRSS() error = %v", err)
+	}
+	if status.Indicator != IndicatorMinor || len(status.Incidents) != 1 {
+		t.Fatalf("status = %+v, want one minor incident", status)
+	}
+	if status.Incidents[0].Name != "Azure OpenAI Service - West Europe - Investigating" {
+		t.Errorf("incident = %+v", status.Incidents[0])
+	}
+
+	empty, err := ParseRSS(strings.NewReader(`<rss version="2.0"><channel><title>Azure Status</title></channel></rss>`))
+	if err != nil {
+		t.Fatalf("ParseRSS() error = %v", err)
+	}
+	if empty.HasIncident() {
+		t.Errorf("empty feed: HasIncident() = true")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/summary.json":
+			w.Write([]byte(statuspageIncident))
+		case "/feed":
+			w.Write([]byte(azureFeed))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	checker := NewChecker(server.Client())
+	ctx := context.Background()
+
+	status, err := checker.Check(ctx, Source{Provider: OpenAI, URL: server.URL + "/api/v2/summary.json", Format: FormatStatuspage})
+	if err != nil {
+		t.Fatalf("Check(statuspage) error = %v", err)
+	}
+	if status.Provider != OpenAI || status.CheckedAt.IsZero() || !status.HasIncident() {
+		t.Errorf("status = %+v", status)
+	}
+
+	status, err = checker.Check(ctx, Source{Provider: Azure, URL: server.URL + "/feed", Format: FormatRSS})
+	if err != nil {
+		t.Fatalf("Check(rss) error = %v", err)
+	}
+	if status.Provider != Azure || !status.HasIncident() {
+		t.Errorf("status = %+v", status)
+	}
+
+	if _, err := checker.Check(ctx, Source{Provider: OpenAI, URL: server.URL + "/down"}); err == nil {
+		t.Error("Check() of a failing page succeeded")
+	}
+	if _, err := checker.Check(ctx, Source{Provider: OpenAI, URL: server.URL + "/feed", Format: "atom"}); err == nil {
+		t.Error("Check() of an unsupported format succeeded")
+	}
+}
+
+func TestProviderOfURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.openai.com/v1":                                   OpenAI,
+		"https://API.OpenAI.com":                                      OpenAI,
+		"https://my-resource.openai.azure.com/openai/deployments/gpt": Azure,
+		"https://my-resource.cognitiveservices.azure.com":             Azure,
+		"https://dify.example.com/v1":                                 "",
+		"https://openai.com.example.org":                              "",
+		"::not a url":                                                 "",
+	}
+	for rawURL, want := range tests {
+		if got := ProviderOfURL(rawURL); got != want {
+			t.Errorf("ProviderOfURL(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
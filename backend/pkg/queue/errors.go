@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// QueueFullError is returned by Enqueue when the queue has reached its size limit
+type QueueFullError struct {
+	// QueueName is the name of the queue that rejected the request
+	QueueName string `json:"queue_name"`
+
+	// CurrentSize is the number of requests in the queue when the request was rejected
+	CurrentSize int64 `json:"current_size"`
+
+	// MaxQueueSize is the size limit that was hit
+	MaxQueueSize int64 `json:"max_queue_size"`
+
+	// DefaultTTL is the TTL applied to requests in the queue, in seconds
+	DefaultTTL int64 `json:"default_ttl"`
+}
+
+// Error implements the error interface
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("enqueue failed: queue_full (queue: %s, size: %d, max: %d)",
+		e.QueueName, e.CurrentSize, e.MaxQueueSize)
+}
+
+// IsQueueFull reports whether err was caused by a full queue
+func IsQueueFull(err error) bool {
+	_, ok := AsQueueFull(err)
+	return ok
+}
+
+// AsQueueFull returns the QueueFullError wrapped in err, if any
+func AsQueueFull(err error) (*QueueFullError, bool) {
+	var queueFullErr *QueueFullError
+	if errors.As(err, &queueFullErr) {
+		return queueFullErr, true
+	}
+	return nil, false
+}
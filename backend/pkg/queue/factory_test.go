@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -417,3 +418,82 @@ func TestQueueNameBuilder(t *testing.T) {
 		assert.Equal(t, "custom:part1:part2", name)
 	})
 }
+
+func TestQueueOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     *QueueOptions
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name:        "nil options",
+			options:     nil,
+			expectError: true,
+			errorMsg:    "queue options cannot be nil",
+		},
+		{
+			name:        "negative max size",
+			options:     &QueueOptions{MaxQueueSize: -1, DefaultTTL: 60},
+			expectError: true,
+			errorMsg:    "MaxQueueSize cannot be negative",
+		},
+		{
+			name:        "negative ttl",
+			options:     &QueueOptions{MaxQueueSize: 10, DefaultTTL: -1},
+			expectError: true,
+			errorMsg:    "DefaultTTL cannot be negative",
+		},
+		{
+			name:        "unlimited queue without expiry",
+			options:     &QueueOptions{},
+			expectError: false,
+		},
+		{
+			name:        "valid override",
+			options:     &QueueOptions{MaxQueueSize: 500, DefaultTTL: 120},
+			expectError: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestQueueFullError(t *testing.T) {
+	queueFullErr := &QueueFullError{
+		QueueName:    "agent:agent-123",
+		CurrentSize:  100,
+		MaxQueueSize: 100,
+		DefaultTTL:   60,
+	}
+
+	t.Run("error message", func(t *testing.T) {
+		assert.Contains(t, queueFullErr.Error(), "queue_full")
+		assert.Contains(t, queueFullErr.Error(), "agent:agent-123")
+	})
+
+	t.Run("detect wrapped error", func(t *testing.T) {
+		wrapped := fmt.Errorf("admission failed: %w", queueFullErr)
+		assert.True(t, IsQueueFull(wrapped))
+
+		diagnostics, ok := AsQueueFull(wrapped)
+		require.True(t, ok)
+		assert.Equal(t, int64(100), diagnostics.MaxQueueSize)
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		assert.False(t, IsQueueFull(fmt.Errorf("failed to enqueue request")))
+		assert.False(t, IsQueueFull(nil))
+	})
+}
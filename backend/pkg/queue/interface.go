@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -22,6 +23,9 @@ type PriorityQueue interface {
 	// Size returns the number of requests in the queue
 	Size(ctx context.Context, queueName string) (int64, error)
 
+	// Position returns the 1-based place of a request in priority order, 0 when it is not queued
+	Position(ctx context.Context, queueName string, requestID string) (int64, error)
+
 	// Remove removes a specific request from the queue by ID
 	Remove(ctx context.Context, queueName string, requestID string) error
 
@@ -34,6 +38,15 @@ type PriorityQueue interface {
 	// Clear removes all requests from the queue
 	Clear(ctx context.Context, queueName string) error
 
+	// SetQueueOptions stores size and TTL overrides for a single queue
+	SetQueueOptions(ctx context.Context, queueName string, options *QueueOptions) error
+
+	// GetQueueOptions returns the effective options for a queue (override or global defaults)
+	GetQueueOptions(ctx context.Context, queueName string) (*QueueOptions, error)
+
+	// ClearQueueOptions removes the overrides of a queue so the global defaults apply again
+	ClearQueueOptions(ctx context.Context, queueName string) error
+
 	// Close cleans up resources used by the queue
 	Close() error
 }
@@ -126,6 +139,35 @@ type QueueConfig struct {
 	EnableMetrics bool
 }
 
+// QueueOptions represents per-queue overrides of the global queue configuration
+type QueueOptions struct {
+	// MaxQueueSize is the maximum number of requests in this queue (0 = unlimited)
+	MaxQueueSize int64 `json:"max_queue_size"`
+
+	// DefaultTTL is the TTL for requests in this queue in seconds (0 = no expiry)
+	DefaultTTL int64 `json:"default_ttl"`
+
+	// Override reports whether the options come from a per-queue override
+	Override bool `json:"override"`
+}
+
+// Validate checks that the options are usable
+func (o *QueueOptions) Validate() error {
+	if o == nil {
+		return fmt.Errorf("queue options cannot be nil")
+	}
+
+	if o.MaxQueueSize < 0 {
+		return fmt.Errorf("MaxQueueSize cannot be negative, got: %d", o.MaxQueueSize)
+	}
+
+	if o.DefaultTTL < 0 {
+		return fmt.Errorf("DefaultTTL cannot be negative, got: %d", o.DefaultTTL)
+	}
+
+	return nil
+}
+
 // RedisConfig represents Redis configuration for distributed queue
 type RedisConfig struct {
 	// Addr is the Redis server address
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -25,17 +26,27 @@ type RedisQueue struct {
 const enqueueLuaScript = `
 local queue_key = KEYS[1]
 local data_key = KEYS[2]
+local options_key = KEYS[3]
 local request_id = ARGV[1]
 local priority = tonumber(ARGV[2])
 local request_data = ARGV[3]
 local max_size = tonumber(ARGV[4])
 local ttl = tonumber(ARGV[5])
 
+-- Per-queue overrides take precedence over the global defaults
+local options = redis.call('HMGET', options_key, 'max_size', 'ttl')
+if options[1] then
+    max_size = tonumber(options[1])
+end
+if options[2] then
+    ttl = tonumber(options[2])
+end
+
 -- Check queue size limit
 if max_size > 0 then
     local current_size = redis.call('ZCARD', queue_key)
     if current_size >= max_size then
-        return {0, "queue_full"}
+        return {0, "queue_full", current_size, max_size, ttl}
     end
 end
 
@@ -180,6 +191,11 @@ func (q *RedisQueue) getDataKey(queueName string) string {
 	return fmt.Sprintf("%s:data:%s", q.config.Redis.KeyPrefix, queueName)
 }
 
+// getOptionsKey returns the Redis key for per-queue option overrides
+func (q *RedisQueue) getOptionsKey(queueName string) string {
+	return fmt.Sprintf("%s:options:%s", q.config.Redis.KeyPrefix, queueName)
+}
+
 // Enqueue adds a request to the priority queue
 func (q *RedisQueue) Enqueue(ctx context.Context, queueName string, request *Request) error {
 	if request == nil {
@@ -207,9 +223,10 @@ func (q *RedisQueue) Enqueue(ctx context.Context, queueName string, request *Req
 
 	queueKey := q.getQueueKey(queueName)
 	dataKey := q.getDataKey(queueName)
+	optionsKey := q.getOptionsKey(queueName)
 
 	// Execute enqueue script
-	result, err := q.enqueueScript.Run(ctx, q.client, []string{queueKey, dataKey},
+	result, err := q.enqueueScript.Run(ctx, q.client, []string{queueKey, dataKey, optionsKey},
 		request.ID, int64(request.Priority), string(requestData),
 		q.config.MaxQueueSize, q.config.DefaultTTL).Result()
 
@@ -218,11 +235,21 @@ func (q *RedisQueue) Enqueue(ctx context.Context, queueName string, request *Req
 	}
 
 	// Check result
-	if resultSlice, ok := result.([]interface{}); ok && len(resultSlice) == 2 {
+	if resultSlice, ok := result.([]interface{}); ok && len(resultSlice) >= 2 {
 		if success, ok := resultSlice[0].(int64); ok && success == 0 {
-			if msg, ok := resultSlice[1].(string); ok {
-				return fmt.Errorf("enqueue failed: %s", msg)
+			msg, _ := resultSlice[1].(string)
+			if msg == "queue_full" && len(resultSlice) == 5 {
+				currentSize, _ := resultSlice[2].(int64)
+				maxSize, _ := resultSlice[3].(int64)
+				ttl, _ := resultSlice[4].(int64)
+				return &QueueFullError{
+					QueueName:    queueName,
+					CurrentSize:  currentSize,
+					MaxQueueSize: maxSize,
+					DefaultTTL:   ttl,
+				}
 			}
+			return fmt.Errorf("enqueue failed: %s", msg)
 		}
 	}
 
@@ -355,6 +382,21 @@ func (q *RedisQueue) Size(ctx context.Context, queueName string) (int64, error)
 	return size, nil
 }
 
+// Position returns the 1-based place of a request in priority order, 0 when it is not queued
+func (q *RedisQueue) Position(ctx context.Context, queueName string, requestID string) (int64, error) {
+	queueKey := q.getQueueKey(queueName)
+
+	rank, err := q.client.ZRank(ctx, queueKey, requestID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get request position: %w", err)
+	}
+
+	return rank + 1, nil
+}
+
 // Remove removes a specific request from the queue by ID
 func (q *RedisQueue) Remove(ctx context.Context, queueName string, requestID string) error {
 	queueKey := q.getQueueKey(queueName)
@@ -457,6 +499,60 @@ func (q *RedisQueue) Clear(ctx context.Context, queueName string) error {
 	return nil
 }
 
+// SetQueueOptions stores size and TTL overrides for a single queue
+func (q *RedisQueue) SetQueueOptions(ctx context.Context, queueName string, options *QueueOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	err := q.client.HSet(ctx, q.getOptionsKey(queueName),
+		"max_size", options.MaxQueueSize,
+		"ttl", options.DefaultTTL).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set queue options: %w", err)
+	}
+
+	return nil
+}
+
+// GetQueueOptions returns the effective options for a queue (override or global defaults)
+func (q *RedisQueue) GetQueueOptions(ctx context.Context, queueName string) (*QueueOptions, error) {
+	options := &QueueOptions{
+		MaxQueueSize: q.config.MaxQueueSize,
+		DefaultTTL:   q.config.DefaultTTL,
+	}
+
+	values, err := q.client.HGetAll(ctx, q.getOptionsKey(queueName)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue options: %w", err)
+	}
+
+	if maxSize, ok := values["max_size"]; ok {
+		if options.MaxQueueSize, err = strconv.ParseInt(maxSize, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid max_size override: %w", err)
+		}
+		options.Override = true
+	}
+
+	if ttl, ok := values["ttl"]; ok {
+		if options.DefaultTTL, err = strconv.ParseInt(ttl, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid ttl override: %w", err)
+		}
+		options.Override = true
+	}
+
+	return options, nil
+}
+
+// ClearQueueOptions removes the overrides of a queue so the global defaults apply again
+func (q *RedisQueue) ClearQueueOptions(ctx context.Context, queueName string) error {
+	if err := q.client.Del(ctx, q.getOptionsKey(queueName)).Err(); err != nil {
+		return fmt.Errorf("failed to clear queue options: %w", err)
+	}
+
+	return nil
+}
+
 // Close cleans up resources used by the queue
 func (q *RedisQueue) Close() error {
 	return q.client.Close()
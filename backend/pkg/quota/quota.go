@@ -0,0 +1,210 @@
+// Package quota keeps the shared token and request budgets of quota pools in Redis.
+// Every key of a pool draws from the pool's budget and, optionally, from a sub-limit of
+// its own. The counters are changed atomically, so a pool's budget holds however many
+// keys and service instances draw from it.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Periods after which a budget starts over, in UTC
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Resources a budget limits
+const (
+	ResourceTokens   = "tokens"
+	ResourceRequests = "requests"
+)
+
+// Scopes of a budget
+const (
+	ScopePool = "pool" // shared by every key of the pool
+	ScopeKey  = "key"  // sub-limit of one key
+)
+
+// counterRetention how long counters are kept past the end of their period
+const counterRetention = 24 * time.Hour
+
+// admitLuaScript fails with the 1-based index of the first counter at its limit and
+// its value, otherwise counts the request on the pool and the key.
+// KEYS: pool tokens, pool requests, key tokens, key requests; ARGV: the limit of each
+// counter, 0 for none, and the ttl in ms
+const admitLuaScript = `
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[i])
+	if limit > 0 then
+		local used = tonumber(redis.call('GET', key) or '0')
+		if used >= limit then
+			return {i, used}
+		end
+	end
+end
+for _, i in ipairs({2, 4}) do
+	redis.call('INCR', KEYS[i])
+	redis.call('PEXPIRE', KEYS[i], ARGV[5])
+end
+return {0, 0}
+`
+
+// Limits a budget per period, 0 means unlimited
+type Limits struct {
+	Tokens   int64
+	Requests int64
+}
+
+// Usage what was drawn from a budget in the current period
+type Usage struct {
+	Tokens   int64 `json:"tokens"`
+	Requests int64 `json:"requests"`
+}
+
+// ExceededError a budget of the pool is used up
+type ExceededError struct {
+	Pool     string    `json:"pool"`
+	Scope    string    `json:"scope"`
+	Resource string    `json:"resource"`
+	Limit    int64     `json:"limit"`
+	Used     int64     `json:"used"`
+	ResetAt  time.Time `json:"reset_at"`
+}
+
+// Error implements error
+func (e *ExceededError) Error() string {
+	if e.Scope == ScopeKey {
+		return fmt.Sprintf("%s quota of this key in pool %s is used up (%d of %d)", e.Resource, e.Pool, e.Used, e.Limit)
+	}
+	return fmt.Sprintf("%s quota of pool %s is used up (%d of %d)", e.Resource, e.Pool, e.Used, e.Limit)
+}
+
+// ValidPeriod whether period is day or month
+func ValidPeriod(period string) bool {
+	return period == PeriodDay || period == PeriodMonth
+}
+
+// PeriodBounds the start and end of the period containing t, in UTC; unknown periods
+// are months
+func PeriodBounds(period string, t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	if period == PeriodDay {
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+	start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Store the budget counters of the pools
+type Store struct {
+	client redis.Cmdable
+	admit  *redis.Script
+	prefix string
+}
+
+// NewStore create a store keeping its counters under prefix
+func NewStore(client redis.Cmdable, prefix string) *Store {
+	return &Store{
+		client: client,
+		admit:  redis.NewScript(admitLuaScript),
+		prefix: prefix,
+	}
+}
+
+// counterKeys the token and request counters of the pool and of each key in the
+// period starting at start, pool first
+func (s *Store) counterKeys(pool string, start time.Time, keys ...string) []string {
+	base := s.prefix + pool + ":" + start.Format("20060102") + ":"
+	counters := []string{base + ResourceTokens, base + ResourceRequests}
+	for _, key := range keys {
+		counters = append(counters, base+"key:"+key+":"+ResourceTokens, base+"key:"+key+":"+ResourceRequests)
+	}
+	return counters
+}
+
+// Admit count a request of key on the pool, an *ExceededError when a budget of the
+// pool or of the key is used up. Tokens are only known afterwards and are added with
+// Charge, so a request is admitted while any tokens are left.
+func (s *Store) Admit(ctx context.Context, pool, key, period string, poolLimits, keyLimits Limits, now time.Time) error {
+	start, end := PeriodBounds(period, now)
+	counters := s.counterKeys(pool, start, key)
+	limits := []int64{poolLimits.Tokens, poolLimits.Requests, keyLimits.Tokens, keyLimits.Requests}
+	ttl := end.Add(counterRetention).Sub(now).Milliseconds()
+
+	result, err := s.admit.Run(ctx, s.client, counters, limits[0], limits[1], limits[2], limits[3], ttl).Int64Slice()
+	if err != nil {
+		return fmt.Errorf("failed to check quota pool %s: %w", pool, err)
+	}
+	if len(result) != 2 || result[0] == 0 {
+		return nil
+	}
+
+	index := result[0] - 1
+	exceeded := &ExceededError{
+		Pool:     pool,
+		Scope:    ScopePool,
+		Resource: ResourceTokens,
+		Limit:    limits[index],
+		Used:     result[1],
+		ResetAt:  end,
+	}
+	if index >= 2 {
+		exceeded.Scope = ScopeKey
+	}
+	if index%2 == 1 {
+		exceeded.Resource = ResourceRequests
+	}
+	return exceeded
+}
+
+// Charge add the tokens of a finished request of key to the pool and the key
+func (s *Store) Charge(ctx context.Context, pool, key, period string, tokens int64, now time.Time) error {
+	if tokens <= 0 {
+		return nil
+	}
+	start, end := PeriodBounds(period, now)
+	counters := s.counterKeys(pool, start, key)
+	ttl := end.Add(counterRetention).Sub(now)
+
+	pipe := s.client.Pipeline()
+	for _, counter := range []string{counters[0], counters[2]} {
+		pipe.IncrBy(ctx, counter, tokens)
+		pipe.PExpire(ctx, counter, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to charge quota pool %s: %w", pool, err)
+	}
+	return nil
+}
+
+// Usage what the pool and each of keys drew in the current period
+func (s *Store) Usage(ctx context.Context, pool, period string, now time.Time, keys ...string) (Usage, []Usage, error) {
+	start, _ := PeriodBounds(period, now)
+	values, err := s.client.MGet(ctx, s.counterKeys(pool, start, keys...)...).Result()
+	if err != nil {
+		return Usage{}, nil, fmt.Errorf("failed to read quota pool %s: %w", pool, err)
+	}
+
+	usages := make([]Usage, len(values)/2)
+	for i := range usages {
+		usages[i] = Usage{Tokens: counterValue(values[2*i]), Requests: counterValue(values[2*i+1])}
+	}
+	return usages[0], usages[1:], nil
+}
+
+// counterValue the number of an MGET value, 0 for a missing counter
+func counterValue(value interface{}) int64 {
+	text, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(text, 10, 64)
+	return n
+}
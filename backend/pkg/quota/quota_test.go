@@ -0,0 +1,65 @@
+package quota
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPeriodBounds(t *testing.T) {
+	at := time.Date(2026, 12, 31, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		period     string
+		start, end time.Time
+	}{
+		{PeriodDay, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"", time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		start, end := PeriodBounds(tt.period, at)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%q: PeriodBounds = %v - %v, want %v - %v", tt.period, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestStore_CounterKeys(t *testing.T) {
+	store := NewStore(nil, "quota:")
+	got := store.counterKeys("team-a", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), "agent-1")
+	want := []string{
+		"quota:team-a:20261001:tokens",
+		"quota:team-a:20261001:requests",
+		"quota:team-a:20261001:key:agent-1:tokens",
+		"quota:team-a:20261001:key:agent-1:requests",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("counterKeys = %q, want %q", got, want)
+	}
+}
+
+func TestExceededError(t *testing.T) {
+	err := &ExceededError{Pool: "team-a", Scope: ScopePool, Resource: ResourceTokens, Limit: 1000, Used: 1200}
+	if got := err.Error(); got != "tokens quota of pool team-a is used up (1200 of 1000)" {
+		t.Errorf("Error = %q", got)
+	}
+	err.Scope, err.Resource = ScopeKey, ResourceRequests
+	if got := err.Error(); got != "requests quota of this key in pool team-a is used up (1200 of 1000)" {
+		t.Errorf("Error = %q", got)
+	}
+}
+
+func TestCounterValue(t *testing.T) {
+	if got := counterValue("42"); got != 42 {
+		t.Errorf("counterValue = %d, want 42", got)
+	}
+	if got := counterValue(nil); got != 0 {
+		t.Errorf("Expected 0 for a missing counter, got %d", got)
+	}
+}
+
+func TestValidPeriod(t *testing.T) {
+	if !ValidPeriod(PeriodDay) || !ValidPeriod(PeriodMonth) || ValidPeriod("week") {
+		t.Error("Expected only day and month to be valid")
+	}
+}
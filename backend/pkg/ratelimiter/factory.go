@@ -10,6 +10,9 @@ type RateLimiterType string
 const (
 	// RedisType uses Redis for distributed rate limiting
 	RedisType RateLimiterType = "redis"
+
+	// MemoryType keeps the buckets in process memory, limits hold per process only
+	MemoryType RateLimiterType = "memory"
 )
 
 // NewRateLimiter creates a new rate limiter based on the configuration
@@ -30,6 +33,9 @@ func NewRateLimiter(limiterType RateLimiterType, config *Config) (RateLimiter, e
 	case RedisType:
 		return NewRedisRateLimiter(config)
 
+	case MemoryType:
+		return NewLocalRateLimiter(config)
+
 	default:
 		return nil, fmt.Errorf("unsupported rate limiter type: %s", limiterType)
 	}
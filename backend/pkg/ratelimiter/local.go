@@ -0,0 +1,163 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// localBucketIdleTTL how long an untouched bucket is kept, like the Redis keys
+const localBucketIdleTTL = time.Hour
+
+// LocalRateLimiter implements RateLimiter with token buckets in process memory. Limits
+// only hold per process, so it serves as a fallback while Redis is unreachable.
+type LocalRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*localBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// localBucket tokens of one key
+type localBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// NewLocalRateLimiter creates an in-memory rate limiter, Redis configuration is ignored
+func NewLocalRateLimiter(config *Config) (*LocalRateLimiter, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if config.Rate <= 0 || config.Burst <= 0 {
+		return nil, fmt.Errorf("rate and burst must be positive, got: %f, %d", config.Rate, config.Burst)
+	}
+	return &LocalRateLimiter{
+		rate:    config.Rate,
+		burst:   config.Burst,
+		buckets: make(map[string]*localBucket),
+		now:     time.Now,
+	}, nil
+}
+
+// Allow checks if the request is allowed under the rate limit
+func (l *LocalRateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN checks if n requests are allowed under the rate limit
+func (l *LocalRateLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return l.AllowRate(ctx, key, l.rate, l.burst, n)
+}
+
+// AllowRate checks if n requests are allowed under a rate and burst given with the
+// call instead of the configured ones
+func (l *LocalRateLimiter) AllowRate(ctx context.Context, key string, rate float64, burst, n int) (bool, error) {
+	if rate <= 0 || burst <= 0 {
+		return false, fmt.Errorf("rate and burst must be positive, got: %f, %d", rate, burst)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	allowed, _ := l.take(key, rate, burst, n)
+	return allowed, nil
+}
+
+// Wait blocks until the request can be processed under the rate limit
+func (l *LocalRateLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until n requests can be processed under the rate limit
+func (l *LocalRateLimiter) WaitN(ctx context.Context, key string, n int) error {
+	for {
+		reservation, err := l.ReserveN(ctx, key, n)
+		if err != nil {
+			return err
+		}
+		if reservation.OK {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reservation.Delay):
+		}
+	}
+}
+
+// Reserve reserves a token and returns a reservation
+func (l *LocalRateLimiter) Reserve(ctx context.Context, key string) (*Reservation, error) {
+	return l.ReserveN(ctx, key, 1)
+}
+
+// ReserveN reserves n tokens and returns a reservation; when they are not available
+// the reservation is not OK and Delay tells how long until they are
+func (l *LocalRateLimiter) ReserveN(ctx context.Context, key string, n int) (*Reservation, error) {
+	if n > l.burst {
+		return nil, fmt.Errorf("requested %d tokens exceeds burst size %d", n, l.burst)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	allowed, tokens := l.take(key, l.rate, l.burst, n)
+	if !allowed {
+		missing := float64(n) - tokens
+		return &Reservation{OK: false, Delay: time.Duration(missing / l.rate * float64(time.Second))}, nil
+	}
+	return &Reservation{OK: true, cancel: func() error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if bucket, ok := l.buckets[key]; ok {
+			bucket.tokens = min(bucket.tokens+float64(n), float64(l.burst))
+		}
+		return nil
+	}}, nil
+}
+
+// Close drops the buckets
+func (l *LocalRateLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets = make(map[string]*localBucket)
+	return nil
+}
+
+// take refill the bucket of key and take n tokens when there are enough, returning
+// whether it did and the tokens left
+func (l *LocalRateLimiter) take(key string, rate float64, burst, n int) (bool, float64) {
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &localBucket{tokens: float64(burst), lastRefill: now}
+		l.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.lastRefill); elapsed > 0 {
+		bucket.tokens = min(float64(burst), bucket.tokens+elapsed.Seconds()*rate)
+	}
+	bucket.tokens = min(bucket.tokens, float64(burst))
+	bucket.lastRefill = now
+
+	if bucket.tokens < float64(n) {
+		return false, bucket.tokens
+	}
+	bucket.tokens -= float64(n)
+	return true, bucket.tokens
+}
+
+// sweep drop buckets untouched for localBucketIdleTTL, at most once per TTL
+func (l *LocalRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < localBucketIdleTTL {
+		return
+	}
+	l.swept = now
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastRefill) > localBucketIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLocalLimiter(t *testing.T, rate float64, burst int) (*LocalRateLimiter, func(time.Duration)) {
+	limiter, err := NewLocalRateLimiter(&Config{Rate: rate, Burst: burst})
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLocalRateLimiter_Burst(t *testing.T) {
+	limiter, advance := newTestLocalLimiter(t, 2, 4)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		allowed, err := limiter.Allow(ctx, "agent:a")
+		require.NoError(t, err)
+		assert.True(t, allowed, "request %d within the burst", i+1)
+	}
+	allowed, _ := limiter.Allow(ctx, "agent:a")
+	assert.False(t, allowed, "request over the burst")
+
+	// another key has its own bucket
+	allowed, _ = limiter.Allow(ctx, "agent:b")
+	assert.True(t, allowed)
+
+	// two tokens per second refill
+	advance(time.Second)
+	allowed, _ = limiter.AllowN(ctx, "agent:a", 2)
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow(ctx, "agent:a")
+	assert.False(t, allowed)
+}
+
+func TestLocalRateLimiter_AllowRate(t *testing.T) {
+	limiter, advance := newTestLocalLimiter(t, 100, 200)
+	ctx := context.Background()
+
+	allowed, err := limiter.AllowRate(ctx, "user:a", 1, 1, 1)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, _ = limiter.AllowRate(ctx, "user:a", 1, 1, 1)
+	assert.False(t, allowed, "the rate given with the call applies, not the configured one")
+
+	advance(time.Second)
+	allowed, _ = limiter.AllowRate(ctx, "user:a", 1, 1, 1)
+	assert.True(t, allowed)
+
+	_, err = limiter.AllowRate(ctx, "user:a", 0, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestLocalRateLimiter_Reserve(t *testing.T) {
+	limiter, _ := newTestLocalLimiter(t, 2, 2)
+	ctx := context.Background()
+
+	reservation, err := limiter.ReserveN(ctx, "k", 2)
+	require.NoError(t, err)
+	assert.True(t, reservation.OK)
+
+	reservation, err = limiter.Reserve(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, reservation.OK)
+	assert.Equal(t, 500*time.Millisecond, reservation.Delay)
+
+	_, err = limiter.ReserveN(ctx, "k", 3)
+	assert.Error(t, err, "more tokens than the burst can never be reserved")
+}
+
+func TestLocalRateLimiter_ReservationCancel(t *testing.T) {
+	limiter, _ := newTestLocalLimiter(t, 1, 1)
+	ctx := context.Background()
+
+	reservation, err := limiter.Reserve(ctx, "k")
+	require.NoError(t, err)
+	require.True(t, reservation.OK)
+	require.NoError(t, reservation.Cancel())
+
+	allowed, _ := limiter.Allow(ctx, "k")
+	assert.True(t, allowed, "a cancelled reservation returns its token")
+}
+
+func TestLocalRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	limiter, advance := newTestLocalLimiter(t, 1, 1)
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "idle")
+	advance(2 * localBucketIdleTTL)
+	limiter.Allow(ctx, "busy")
+
+	assert.NotContains(t, limiter.buckets, "idle")
+	assert.Contains(t, limiter.buckets, "busy")
+}
+
+func TestNewRateLimiter_Memory(t *testing.T) {
+	limiter, err := NewRateLimiter(MemoryType, &Config{Rate: 10, Burst: 20})
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	allowed, err := limiter.Allow(context.Background(), "key")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
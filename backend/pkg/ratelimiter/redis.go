@@ -17,6 +17,9 @@ type RedisRateLimiter struct {
 
 	// Lua script for atomic token bucket operations
 	tokenBucketScript *redis.Script
+
+	// Lua script sharing a capacity among consumers by weight
+	weightedShareScript *redis.Script
 }
 
 // Lua script for token bucket algorithm
@@ -55,6 +58,25 @@ end
 
 // NewRedisRateLimiter creates a new Redis-based rate limiter
 func NewRedisRateLimiter(config *Config) (*RedisRateLimiter, error) {
+	limiter, err := OpenRedisRateLimiter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := limiter.Ping(ctx); err != nil {
+		limiter.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return limiter, nil
+}
+
+// OpenRedisRateLimiter creates a Redis-based rate limiter without checking the
+// connection; checks fail until Redis is reachable
+func OpenRedisRateLimiter(config *Config) (*RedisRateLimiter, error) {
 	if config.Redis == nil {
 		return nil, fmt.Errorf("Redis configuration is required")
 	}
@@ -69,22 +91,20 @@ func NewRedisRateLimiter(config *Config) (*RedisRateLimiter, error) {
 		ConnMaxIdleTime: config.Redis.ConnMaxIdleTime,
 	})
 
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
-	}
-
 	return &RedisRateLimiter{
-		client:            client,
-		rate:              config.Rate,
-		burst:             config.Burst,
-		tokenBucketScript: redis.NewScript(tokenBucketLuaScript),
+		client:              client,
+		rate:                config.Rate,
+		burst:               config.Burst,
+		tokenBucketScript:   redis.NewScript(tokenBucketLuaScript),
+		weightedShareScript: redis.NewScript(weightedShareLuaScript),
 	}, nil
 }
 
+// Ping checks that Redis is reachable
+func (r *RedisRateLimiter) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 // Allow checks if the request is allowed under the rate limit
 func (r *RedisRateLimiter) Allow(ctx context.Context, key string) (bool, error) {
 	return r.AllowN(ctx, key, 1)
@@ -92,10 +112,19 @@ func (r *RedisRateLimiter) Allow(ctx context.Context, key string) (bool, error)
 
 // AllowN checks if n requests are allowed under the rate limit
 func (r *RedisRateLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	return r.AllowRate(ctx, key, r.rate, r.burst, n)
+}
+
+// AllowRate checks if n requests are allowed under a rate and burst given with the
+// call instead of the configured ones, for keys whose limit changes at runtime
+func (r *RedisRateLimiter) AllowRate(ctx context.Context, key string, rate float64, burst, n int) (bool, error) {
+	if rate <= 0 || burst <= 0 {
+		return false, fmt.Errorf("rate and burst must be positive, got: %f, %d", rate, burst)
+	}
 	now := time.Now().UnixMilli()
 
 	result, err := r.tokenBucketScript.Run(ctx, r.client, []string{key},
-		r.rate, r.burst, n, now).Result()
+		rate, burst, n, now).Result()
 
 	if err != nil {
 		return false, fmt.Errorf("failed to execute rate limit check: %w", err)
@@ -0,0 +1,172 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultIdleAfter how long a consumer keeps its share without sending requests
+const DefaultIdleAfter = 2 * time.Second
+
+// weightedBurstFactor each consumer may burst to twice its share
+const weightedBurstFactor = 2
+
+// WeightedRateLimiter shares a capacity among the consumers of a key in proportion to
+// their weights; consumers that went idle give their share to the active ones
+type WeightedRateLimiter interface {
+	// AllowWeighted checks if the consumer's request fits its current share of the capacity
+	AllowWeighted(ctx context.Context, key string, req WeightedRequest) (*WeightedResult, error)
+}
+
+// WeightedRequest a request against a capacity shared by weight
+type WeightedRequest struct {
+	// Consumer identifies who is asking, e.g. a user name
+	Consumer string
+
+	// Weight is the consumer's relative claim on the capacity
+	Weight float64
+
+	// Capacity is the number of requests per second shared by all active consumers
+	Capacity float64
+
+	// N is the number of tokens requested, 0 means 1
+	N int
+
+	// IdleAfter is how long a consumer without requests keeps its share, 0 means DefaultIdleAfter
+	IdleAfter time.Duration
+}
+
+// WeightedResult outcome of a weighted check
+type WeightedResult struct {
+	// Allowed indicates whether the request fits the consumer's share
+	Allowed bool
+
+	// Share is the number of requests per second currently granted to the consumer
+	Share float64
+
+	// Remaining is the number of tokens left in the consumer's bucket
+	Remaining float64
+}
+
+// normalize validates the request and fills in the defaults
+func (r WeightedRequest) normalize() (WeightedRequest, error) {
+	if r.Consumer == "" {
+		return r, fmt.Errorf("consumer is required")
+	}
+	if r.Weight <= 0 {
+		return r, fmt.Errorf("weight must be positive, got: %f", r.Weight)
+	}
+	if r.Capacity <= 0 {
+		return r, fmt.Errorf("capacity must be positive, got: %f", r.Capacity)
+	}
+	if r.N < 0 {
+		return r, fmt.Errorf("n cannot be negative, got: %d", r.N)
+	}
+	if r.N == 0 {
+		r.N = 1
+	}
+	if r.IdleAfter <= 0 {
+		r.IdleAfter = DefaultIdleAfter
+	}
+	return r, nil
+}
+
+// Lua script for weighted sharing: every consumer seen within the idle window holds a
+// weight, each gets capacity * weight / sum of the active weights as the refill rate of
+// its own token bucket. Consumers leaving the window drop out of the sum, so their
+// share flows to the remaining ones.
+const weightedShareLuaScript = `
+local consumers_key = KEYS[1]
+local weights_key = KEYS[2]
+local bucket_key = KEYS[3]
+local consumer = ARGV[1]
+local weight = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+local now = tonumber(ARGV[5])
+local idle = tonumber(ARGV[6])
+local burst_factor = tonumber(ARGV[7])
+
+-- Forget idle consumers
+local idle_consumers = redis.call('ZRANGEBYSCORE', consumers_key, '-inf', now - idle)
+if #idle_consumers > 0 then
+    redis.call('HDEL', weights_key, unpack(idle_consumers))
+    redis.call('ZREMRANGEBYSCORE', consumers_key, '-inf', now - idle)
+end
+
+-- Mark this consumer active
+redis.call('ZADD', consumers_key, now, consumer)
+redis.call('HSET', weights_key, consumer, weight)
+redis.call('PEXPIRE', consumers_key, idle * 2)
+redis.call('PEXPIRE', weights_key, idle * 2)
+
+-- Share of the capacity
+local total = 0
+for _, w in ipairs(redis.call('HVALS', weights_key)) do
+    total = total + tonumber(w)
+end
+local share = capacity * weight / total
+local burst = math.max(1, share * burst_factor)
+
+-- Token bucket of the consumer, refilled at its share
+local bucket = redis.call('HMGET', bucket_key, 'tokens', 'last_refill')
+local tokens = tonumber(bucket[1]) or burst
+local last_refill = tonumber(bucket[2]) or now
+local elapsed = math.max(0, now - last_refill)
+tokens = math.min(burst, tokens + elapsed * share / 1000)
+
+local allowed = 0
+if tokens >= requested then
+    tokens = tokens - requested
+    allowed = 1
+end
+redis.call('HMSET', bucket_key, 'tokens', tokens, 'last_refill', now)
+redis.call('EXPIRE', bucket_key, 3600)
+return {allowed, tostring(tokens), tostring(share)}
+`
+
+// AllowWeighted checks if the consumer's request fits its current share of the capacity
+func (r *RedisRateLimiter) AllowWeighted(ctx context.Context, key string, req WeightedRequest) (*WeightedResult, error) {
+	req, err := req.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{key + ":consumers", key + ":weights", key + ":share:" + req.Consumer}
+	result, err := r.weightedShareScript.Run(ctx, r.client, keys,
+		req.Consumer, req.Weight, req.Capacity, req.N, time.Now().UnixMilli(),
+		req.IdleAfter.Milliseconds(), weightedBurstFactor).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute weighted rate limit check: %w", err)
+	}
+
+	results, ok := result.([]interface{})
+	if !ok || len(results) != 3 {
+		return nil, fmt.Errorf("unexpected result format from Redis script")
+	}
+	allowed, ok := results[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected allowed value type")
+	}
+	remaining, err := parseScriptFloat(results[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tokens value: %w", err)
+	}
+	share, err := parseScriptFloat(results[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse share value: %w", err)
+	}
+
+	return &WeightedResult{Allowed: allowed == 1, Share: share, Remaining: remaining}, nil
+}
+
+// parseScriptFloat a number the script returned as string
+func parseScriptFloat(value interface{}) (float64, error) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected value type %T", value)
+	}
+	return strconv.ParseFloat(text, 64)
+}
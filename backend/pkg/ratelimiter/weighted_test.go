@@ -0,0 +1,62 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightedRequestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  WeightedRequest
+		expected WeightedRequest
+		errorMsg string
+	}{
+		{
+			name:     "defaults",
+			request:  WeightedRequest{Consumer: "alice", Weight: 50, Capacity: 10},
+			expected: WeightedRequest{Consumer: "alice", Weight: 50, Capacity: 10, N: 1, IdleAfter: DefaultIdleAfter},
+		},
+		{
+			name:     "explicit values kept",
+			request:  WeightedRequest{Consumer: "bob", Weight: 1, Capacity: 0.5, N: 3, IdleAfter: 5 * time.Second},
+			expected: WeightedRequest{Consumer: "bob", Weight: 1, Capacity: 0.5, N: 3, IdleAfter: 5 * time.Second},
+		},
+		{
+			name:     "missing consumer",
+			request:  WeightedRequest{Weight: 1, Capacity: 10},
+			errorMsg: "consumer is required",
+		},
+		{
+			name:     "zero weight",
+			request:  WeightedRequest{Consumer: "alice", Capacity: 10},
+			errorMsg: "weight must be positive",
+		},
+		{
+			name:     "negative capacity",
+			request:  WeightedRequest{Consumer: "alice", Weight: 1, Capacity: -1},
+			errorMsg: "capacity must be positive",
+		},
+		{
+			name:     "negative n",
+			request:  WeightedRequest{Consumer: "alice", Weight: 1, Capacity: 10, N: -1},
+			errorMsg: "n cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := tt.request.normalize()
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, normalized)
+		})
+	}
+}
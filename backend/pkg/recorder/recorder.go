@@ -0,0 +1,271 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Mode what the transport does with the requests of a session
+type Mode string
+
+const (
+	// ModeOff sends requests upstream untouched
+	ModeOff Mode = ""
+
+	// ModeRecord sends requests upstream and saves each complete exchange as a fixture
+	ModeRecord Mode = "record"
+
+	// ModeReplay answers from the fixtures, nothing is sent upstream
+	ModeReplay Mode = "replay"
+)
+
+// ParseMode validate a mode name, empty means off
+func ParseMode(value string) (Mode, error) {
+	switch Mode(value) {
+	case ModeOff, ModeRecord, ModeReplay:
+		return Mode(value), nil
+	default:
+		return ModeOff, fmt.Errorf("invalid record mode %q, expected record or replay", value)
+	}
+}
+
+// ErrFixtureNotFound replay found no fixture for the request
+var ErrFixtureNotFound = errors.New("no recorded fixture for this request")
+
+// Fixture one recorded request and its response
+type Fixture struct {
+	Key        string          `json:"key"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Request    FixtureRequest  `json:"request"`
+	Response   FixtureResponse `json:"response"`
+}
+
+// FixtureRequest the recorded request, headers are left out so credentials never reach disk
+type FixtureRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// FixtureResponse the recorded response, streamed bodies are kept whole
+type FixtureResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// session the fixture set and mode a request belongs to
+type session struct {
+	name string
+	mode Mode
+}
+
+type sessionKey struct{}
+
+// WithSession mark requests made with ctx for recording or replay under the fixture
+// set name, ModeOff leaves ctx unchanged
+func WithSession(ctx context.Context, name string, mode Mode) context.Context {
+	if mode == ModeOff {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionKey{}, session{name: name, mode: mode})
+}
+
+// Transport records or replays the requests whose context carries a session, all
+// other requests go through the wrapped transport
+type Transport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// NewTransport creates a recording transport storing fixtures below dir
+func NewTransport(next http.RoundTripper, dir string) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{next: next, dir: dir}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s, ok := req.Context().Value(sessionKey{}).(session)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key := Key(req.Method, req.URL.String(), body)
+	path := t.fixturePath(s.name, key)
+
+	if s.mode == ModeReplay {
+		fixture, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return fixture.response(req), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &Fixture{
+		Key:     key,
+		Request: FixtureRequest{Method: req.Method, URL: req.URL.String(), Body: normalizeBody(body)},
+		Response: FixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+		},
+	}
+	fixture.Response.Header.Del("Set-Cookie")
+	resp.Body = &recordingBody{body: resp.Body, fixture: fixture, path: path}
+	return resp, nil
+}
+
+// fixturePath file of the fixture, names are reduced to safe characters
+func (t *Transport) fixturePath(name, key string) string {
+	return filepath.Join(t.dir, unsafeName.ReplaceAllString(name, "_"), key+".json")
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Key identify a request by method, URL and body; JSON bodies are compared by content,
+// so field order does not matter
+func Key(method, url string, body []byte) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s %s\n", method, url)
+	sum.Write(normalizeBody(body))
+	return hex.EncodeToString(sum.Sum(nil))[:24]
+}
+
+// normalizeBody JSON bodies re-encoded with sorted keys, other bodies as a JSON string
+func normalizeBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		if normalized, err := json.Marshal(value); err == nil {
+			return normalized
+		}
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// Load read a fixture file
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrFixtureNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// save write the fixture, through a temporary file so readers never see half of it
+func (f *Fixture) save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// response the recorded response for req
+func (f *Fixture) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.StatusCode, http.StatusText(f.Response.StatusCode)),
+		StatusCode:    f.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Response.Body))),
+		ContentLength: int64(len(f.Response.Body)),
+		Request:       req,
+	}
+}
+
+// recordingBody passes the response through to the caller and saves the fixture once
+// the body was read to the end; exchanges cut short are not recorded
+type recordingBody struct {
+	body    io.ReadCloser
+	fixture *Fixture
+	path    string
+	buf     bytes.Buffer
+	done    bool
+}
+
+// Read implements io.Reader
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) && !b.done {
+		if saveErr := b.finish(); saveErr != nil {
+			return n, saveErr
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer; a caller that stopped before the end, e.g. a JSON
+// decoder, still gets the fixture saved when the rest of the body can be read
+func (b *recordingBody) Close() error {
+	var saveErr error
+	if !b.done {
+		if _, err := io.Copy(&b.buf, b.body); err == nil {
+			saveErr = b.finish()
+		}
+		b.done = true
+	}
+	if err := b.body.Close(); err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// finish store the complete body in the fixture and save it
+func (b *recordingBody) finish() error {
+	b.done = true
+	b.fixture.RecordedAt = time.Now()
+	b.fixture.Response.Body = b.buf.String()
+	if err := b.fixture.save(b.path); err != nil {
+		return fmt.Errorf("failed to save fixture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Mode
+		wantErr bool
+	}{
+		{value: "", want: ModeOff},
+		{value: "record", want: ModeRecord},
+		{value: "replay", want: ModeReplay},
+		{value: "Replay", wantErr: true},
+		{value: "live", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseMode(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseMode(%q) = %q, %v, want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	base := Key("POST", "https://api.example.com/v1/chat", []byte(`{"model":"a","stream":false}`))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		same   bool
+	}{
+		{name: "Field order ignored", method: "POST", url: "https://api.example.com/v1/chat", body: `{"stream":false, "model":"a"}`, same: true},
+		{name: "Different body", method: "POST", url: "https://api.example.com/v1/chat", body: `{"model":"b","stream":false}`},
+		{name: "Different URL", method: "POST", url: "https://api.example.com/v1/other", body: `{"model":"a","stream":false}`},
+		{name: "Different method", method: "PUT", url: "https://api.example.com/v1/chat", body: `{"model":"a","stream":false}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Key(tt.method, tt.url, []byte(tt.body))
+			if (got == base) != tt.same {
+				t.Errorf("Key() = %s, base %s, want same = %v", got, base, tt.same)
+			}
+		})
+	}
+}
+
+// upstream a server answering with a fixed body that counts its requests
+func upstream(t *testing.T, contentType, body string) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func send(t *testing.T, client *http.Client, ctx context.Context, url, body string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	return client.Do(req)
+}
+
+func TestTransport_RecordThenReplay(t *testing.T) {
+	server, calls := upstream(t, "text/event-stream", "data: {\"n\":1}\n\ndata: [DONE]\n\n")
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(nil, dir)}
+
+	recordCtx := WithSession(context.Background(), "agent/1", ModeRecord)
+	resp, err := send(t, client, recordCtx, server.URL+"/v1/chat", `{"model":"a"}`)
+	if err != nil {
+		t.Fatalf("record request error = %v", err)
+	}
+	recorded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "agent_1", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("fixtures = %v, want one file below agent_1", files)
+	}
+	raw, _ := os.ReadFile(files[0])
+	if strings.Contains(string(raw), "sk-secret") || strings.Contains(string(raw), "session=secret") {
+		t.Error("fixture contains credentials")
+	}
+
+	replayCtx := WithSession(context.Background(), "agent/1", ModeReplay)
+	resp, err = send(t, client, replayCtx, server.URL+"/v1/chat", `{ "model": "a" }`)
+	if err != nil {
+		t.Fatalf("replay request error = %v", err)
+	}
+	replayed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(replayed) != string(recorded) {
+		t.Errorf("replayed body = %q, want %q", replayed, recorded)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("replayed Content-Type = %q, want text/event-stream", got)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
+
+func TestTransport_RecordsPartiallyReadBody(t *testing.T) {
+	server, _ := upstream(t, "application/json", `{"answer":"hi"}`+"\n")
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(nil, dir)}
+
+	resp, err := send(t, client, WithSession(context.Background(), "agent", ModeRecord), server.URL, `{}`)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	var answer map[string]string
+	json.NewDecoder(resp.Body).Decode(&answer)
+	if err := resp.Body.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "agent", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("fixtures = %v, want one", files)
+	}
+	fixture, err := Load(files[0])
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if fixture.Response.Body != `{"answer":"hi"}`+"\n" || fixture.Response.StatusCode != http.StatusOK {
+		t.Errorf("fixture response = %+v", fixture.Response)
+	}
+}
+
+func TestTransport_ReplayMissingFixture(t *testing.T) {
+	server, calls := upstream(t, "application/json", `{}`)
+	client := &http.Client{Transport: NewTransport(nil, t.TempDir())}
+
+	_, err := send(t, client, WithSession(context.Background(), "agent", ModeReplay), server.URL, `{"model":"a"}`)
+	if !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("error = %v, want %v", err, ErrFixtureNotFound)
+	}
+	if got := atomic.LoadInt32(calls); got != 0 {
+		t.Errorf("upstream calls = %d, want 0", got)
+	}
+}
+
+func TestTransport_PassThroughWithoutSession(t *testing.T) {
+	server, calls := upstream(t, "application/json", `{}`)
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(nil, dir)}
+
+	resp, err := send(t, client, context.Background(), server.URL, `{}`)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("fixtures written without a session: %v", entries)
+	}
+}
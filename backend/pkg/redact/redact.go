@@ -0,0 +1,268 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule masks every match of a pattern; Validate, when set, must accept a match
+// before it is masked, e.g. the Luhn check for card numbers
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+	Validate    func(match string) bool
+}
+
+// Built-in rule names
+const (
+	RuleEmail      = "email"
+	RulePhone      = "phone"
+	RuleAPIKey     = "api_key"
+	RuleCreditCard = "credit_card"
+)
+
+// builtinRules built-in rules by name; api keys come before phone numbers so the
+// digits of a key are not reported as a phone number
+var builtinRules = map[string]Rule{
+	RuleEmail: {
+		Name:        RuleEmail,
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[EMAIL]",
+	},
+	RuleAPIKey: {
+		Name: RuleAPIKey,
+		Pattern: regexp.MustCompile(`(?i)\b(?:sk|pk|rk|ak|app|ac|sess)[-_][A-Za-z0-9_-]{16,}\b` +
+			`|\bBearer\s+[A-Za-z0-9._~+/-]{16,}=*` +
+			`|\bAKIA[0-9A-Z]{16}\b` +
+			`|\bgh[pousr]_[A-Za-z0-9]{30,}\b`),
+		Replacement: "[API_KEY]",
+	},
+	RuleCreditCard: {
+		Name:        RuleCreditCard,
+		Pattern:     regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Replacement: "[CARD]",
+		Validate:    Luhn,
+	},
+	RulePhone: {
+		Name:        RulePhone,
+		Pattern:     regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}[ .-]\d{3,4}[ .-]?\d{3,4}\b|\+\d{8,15}\b`),
+		Replacement: "[PHONE]",
+	},
+}
+
+// builtinOrder the order the built-in rules are applied in
+var builtinOrder = []string{RuleEmail, RuleAPIKey, RuleCreditCard, RulePhone}
+
+// BuiltinRuleNames names of the built-in rules, in the order they are applied
+func BuiltinRuleNames() []string {
+	return append([]string{}, builtinOrder...)
+}
+
+// Builtin the built-in rule of the name, false for unknown names
+func Builtin(name string) (Rule, bool) {
+	rule, ok := builtinRules[name]
+	return rule, ok
+}
+
+// Redactor masks sensitive values in text before it is persisted
+type Redactor struct {
+	rules []Rule
+}
+
+// New creates a redactor applying the rules in order
+func New(rules ...Rule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// Config selects the redaction rules
+type Config struct {
+	// Rules built-in rule names, all built-in rules when empty
+	Rules []string
+	// Patterns additional regular expressions masked as [REDACTED]
+	Patterns []string
+	// Words masked case-insensitively as whole words, e.g. a profanity list
+	Words []string
+}
+
+// NewFromConfig creates a redactor from the configured rule names, patterns and words
+func NewFromConfig(config Config) (*Redactor, error) {
+	names := config.Rules
+	if len(names) == 0 {
+		names = builtinOrder
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := builtinRules[name]; !ok {
+			return nil, fmt.Errorf("unknown redaction rule %q, expected one of %s", name, strings.Join(builtinOrder, ", "))
+		}
+		selected[name] = true
+	}
+
+	var rules []Rule
+	for _, name := range builtinOrder {
+		if selected[name] {
+			rules = append(rules, builtinRules[name])
+		}
+	}
+
+	for i, pattern := range config.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, Rule{Name: fmt.Sprintf("pattern_%d", i+1), Pattern: compiled, Replacement: "[REDACTED]"})
+	}
+
+	if rule, ok := WordsRule(config.Words); ok {
+		rules = append(rules, rule)
+	}
+
+	return New(rules...), nil
+}
+
+// WordsRule masks the words case-insensitively, false when there are no words
+func WordsRule(words []string) (Rule, bool) {
+	var quoted []string
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return Rule{}, false
+	}
+
+	// Longest first so a word is not masked only partially by a shorter one
+	sort.Slice(quoted, func(i, j int) bool {
+		return len(quoted[i]) > len(quoted[j])
+	})
+	return Rule{
+		Name:        "words",
+		Pattern:     regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`),
+		Replacement: "[REDACTED]",
+	}, true
+}
+
+// Redact mask every sensitive value in text; a nil redactor returns text unchanged
+func (r *Redactor) Redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+
+	for _, rule := range r.rules {
+		if rule.Validate == nil {
+			text = rule.Pattern.ReplaceAllLiteralString(text, rule.Replacement)
+			continue
+		}
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.Validate(match) {
+				return rule.Replacement
+			}
+			return match
+		})
+	}
+	return text
+}
+
+// Span a masked value in redacted text, Start and End count the characters (runes) of
+// the redacted text up to the replacement and past it
+type Span struct {
+	Rule  string `json:"rule"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// RedactSpans mask like Redact and report where each replacement ends up. Values of a
+// later rule overlapping an earlier replacement are left alone, so replacements are
+// never masked again.
+func (r *Redactor) RedactSpans(text string) (string, []Span) {
+	if r == nil || text == "" {
+		return text, nil
+	}
+
+	// byte offsets into the current text while the rules are applied
+	var spans []Span
+	for _, rule := range r.rules {
+		var out strings.Builder
+		var next []Span
+		last, shift, kept, masked := 0, 0, 0, false
+		for _, match := range rule.Pattern.FindAllStringIndex(text, -1) {
+			start, end := match[0], match[1]
+			if start == end || overlapsSpan(spans, start, end) || (rule.Validate != nil && !rule.Validate(text[start:end])) {
+				continue
+			}
+			// earlier replacements before this match move by the shift so far
+			for ; kept < len(spans) && spans[kept].Start < start; kept++ {
+				next = append(next, Span{Rule: spans[kept].Rule, Start: spans[kept].Start + shift, End: spans[kept].End + shift})
+			}
+			out.WriteString(text[last:start])
+			next = append(next, Span{Rule: rule.Name, Start: start + shift, End: start + shift + len(rule.Replacement)})
+			out.WriteString(rule.Replacement)
+			shift += len(rule.Replacement) - (end - start)
+			last, masked = end, true
+		}
+		if !masked {
+			continue
+		}
+		for ; kept < len(spans); kept++ {
+			next = append(next, Span{Rule: spans[kept].Rule, Start: spans[kept].Start + shift, End: spans[kept].End + shift})
+		}
+		out.WriteString(text[last:])
+		text, spans = out.String(), next
+	}
+
+	for i, span := range spans {
+		spans[i].Start = utf8.RuneCountInString(text[:span.Start])
+		spans[i].End = spans[i].Start + utf8.RuneCountInString(text[span.Start:span.End])
+	}
+	return text, spans
+}
+
+// overlapsSpan whether the byte range overlaps one of the spans
+func overlapsSpan(spans []Span, start, end int) bool {
+	for _, span := range spans {
+		if start < span.End && span.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Luhn report whether the digits of number, ignoring spaces and dashes, pass the
+// Luhn checksum used by payment card numbers
+func Luhn(number string) bool {
+	sum := 0
+	digits := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
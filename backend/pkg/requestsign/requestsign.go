@@ -0,0 +1,121 @@
+// Package requestsign signs HTTP requests with an HMAC-SHA256 over a timestamp, the
+// method, the request target and the body hash, and verifies such signatures within a
+// replay window.
+//
+// The signed string is
+//
+//	timestamp "\n" METHOD "\n" request target "\n" hex SHA-256 of the body
+//
+// where the timestamp is in Unix seconds and the request target is the path with the
+// raw query, e.g. /api/v1/openai/chat/completions?agent_id=a1.
+package requestsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimestampHeader Unix seconds the request was signed at
+	TimestampHeader = "X-Signature-Timestamp"
+
+	// SignatureHeader "v1=" followed by the hex HMAC
+	SignatureHeader = "X-Signature"
+
+	// ContentHashHeader hex SHA-256 of the body, optional; when sent it must match
+	ContentHashHeader = "X-Content-SHA256"
+
+	signatureVersion = "v1"
+)
+
+var (
+	// ErrMissingSignature the request carries no signature headers
+	ErrMissingSignature = errors.New("request is not signed")
+
+	// ErrInvalidTimestamp the timestamp header is not Unix seconds
+	ErrInvalidTimestamp = errors.New("invalid signature timestamp")
+
+	// ErrExpired the request was signed outside the replay window
+	ErrExpired = errors.New("signature timestamp is outside the replay window")
+
+	// ErrContentMismatch the body does not match the content hash header
+	ErrContentMismatch = errors.New("body does not match " + ContentHashHeader)
+
+	// ErrInvalidSignature the signature does not match the request
+	ErrInvalidSignature = errors.New("invalid request signature")
+)
+
+// ContentHash hex SHA-256 of a body
+func ContentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign the signature header value of a request
+func Sign(secret []byte, timestamp int64, method, target string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s", timestamp, strings.ToUpper(method), target, ContentHash(body))
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest set the signature headers of req for body, signed at now
+func SignRequest(req *http.Request, secret, body []byte, now time.Time) {
+	timestamp := now.Unix()
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(ContentHashHeader, ContentHash(body))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, req.Method, req.URL.RequestURI(), body))
+}
+
+// Signed whether the headers carry a signature
+func Signed(header http.Header) bool {
+	return header.Get(SignatureHeader) != "" || header.Get(TimestampHeader) != ""
+}
+
+// Verifier checks signatures signed at most Window before or after now
+type Verifier struct {
+	Window time.Duration
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewVerifier create a verifier with the given replay window
+func NewVerifier(window time.Duration) *Verifier {
+	return &Verifier{Window: window, now: time.Now}
+}
+
+// Verify check the signature headers against the request, returns the signing time
+func (v *Verifier) Verify(header http.Header, method, target string, body, secret []byte) (time.Time, error) {
+	signature := header.Get(SignatureHeader)
+	rawTimestamp := header.Get(TimestampHeader)
+	if signature == "" || rawTimestamp == "" {
+		return time.Time{}, ErrMissingSignature
+	}
+
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidTimestamp
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if skew := v.now().Sub(signedAt); skew > v.Window || skew < -v.Window {
+		return signedAt, ErrExpired
+	}
+
+	if contentHash := header.Get(ContentHashHeader); contentHash != "" &&
+		!hmac.Equal([]byte(strings.ToLower(contentHash)), []byte(ContentHash(body))) {
+		return signedAt, ErrContentMismatch
+	}
+
+	expected := Sign(secret, timestamp, method, target, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return signedAt, ErrInvalidSignature
+	}
+	return signedAt, nil
+}
@@ -0,0 +1,109 @@
+package requestsign
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newSignedRequest a request signed at signedAt
+func newSignedRequest(t *testing.T, body string, signedAt time.Time) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://gateway/api/v1/openai/chat/completions?agent_id=a1", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	SignRequest(req, testSecret, []byte(body), signedAt)
+	return req
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	body := `{"messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		name    string
+		modify  func(req *http.Request) (target string, body string, secret []byte)
+		signed  time.Time
+		wantErr error
+	}{
+		{
+			name:   "Valid",
+			signed: now.Add(-time.Minute),
+		},
+		{
+			name:    "Outside the window",
+			signed:  now.Add(-6 * time.Minute),
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "Signed in the future",
+			signed:  now.Add(6 * time.Minute),
+			wantErr: ErrExpired,
+		},
+		{
+			name:   "Tampered body",
+			signed: now,
+			modify: func(req *http.Request) (string, string, []byte) {
+				return req.URL.RequestURI(), `{"messages":[]}`, testSecret
+			},
+			wantErr: ErrContentMismatch,
+		},
+		{
+			name:   "Tampered body without content hash",
+			signed: now,
+			modify: func(req *http.Request) (string, string, []byte) {
+				req.Header.Del(ContentHashHeader)
+				return req.URL.RequestURI(), `{"messages":[]}`, testSecret
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "Other target",
+			signed: now,
+			modify: func(req *http.Request) (string, string, []byte) {
+				return "/api/v1/openai/chat/completions?agent_id=a2", body, testSecret
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "Wrong secret",
+			signed: now,
+			modify: func(req *http.Request) (string, string, []byte) {
+				return req.URL.RequestURI(), body, []byte("another secret of thirty-two bytes")
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "Unsigned",
+			signed: now,
+			modify: func(req *http.Request) (string, string, []byte) {
+				req.Header = http.Header{}
+				return req.URL.RequestURI(), body, testSecret
+			},
+			wantErr: ErrMissingSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier(5 * time.Minute)
+			verifier.now = func() time.Time { return now }
+
+			req := newSignedRequest(t, body, tt.signed)
+			target, received, secret := req.URL.RequestURI(), body, testSecret
+			if tt.modify != nil {
+				target, received, secret = tt.modify(req)
+			}
+
+			_, err := verifier.Verify(req.Header, req.Method, target, []byte(received), secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
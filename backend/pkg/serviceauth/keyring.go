@@ -0,0 +1,160 @@
+package serviceauth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minKeyLength is the minimum accepted length of a signing secret in bytes
+const minKeyLength = 32
+
+// KeyRing holds the signing keys shared by the services, identified by key ID.
+// Tokens are always signed with the active key and verified with any known key,
+// so a new key can be rolled out before the old one is retired.
+type KeyRing struct {
+	keys     map[string][]byte
+	activeID string
+	mutex    sync.RWMutex
+}
+
+// NewKeyRing creates a key ring from key ID to secret, activeID selects the signing key
+func NewKeyRing(keys map[string][]byte, activeID string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	ring := &KeyRing{keys: make(map[string][]byte, len(keys))}
+	for id, secret := range keys {
+		if err := ring.AddKey(id, secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if activeID == "" && len(keys) == 1 {
+		for id := range keys {
+			activeID = id
+		}
+	}
+
+	if err := ring.Activate(activeID); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// ParseKeyRing parses keys in the "kid1:secret1,kid2:secret2" format used by the configuration
+func ParseKeyRing(spec, activeID string) (*KeyRing, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid key entry %q, expected kid:secret", entry)
+		}
+
+		id := strings.TrimSpace(parts[0])
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate key ID: %s", id)
+		}
+		keys[id] = []byte(strings.TrimSpace(parts[1]))
+	}
+
+	return NewKeyRing(keys, activeID)
+}
+
+// AddKey adds a verification key, it is not used for signing until activated
+func (r *KeyRing) AddKey(id string, secret []byte) error {
+	if id == "" {
+		return fmt.Errorf("key ID cannot be empty")
+	}
+
+	if len(secret) < minKeyLength {
+		return fmt.Errorf("key %s is too short: %d bytes, need at least %d", id, len(secret), minKeyLength)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.keys[id] = append([]byte(nil), secret...)
+	return nil
+}
+
+// Activate selects the key used to sign new tokens
+func (r *KeyRing) Activate(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.keys[id]; !exists {
+		return fmt.Errorf("unknown key ID: %s", id)
+	}
+
+	r.activeID = id
+	return nil
+}
+
+// Rotate adds a new key and makes it the signing key, previous keys stay valid for verification
+func (r *KeyRing) Rotate(id string, secret []byte) error {
+	if err := r.AddKey(id, secret); err != nil {
+		return err
+	}
+	return r.Activate(id)
+}
+
+// RemoveKey retires a key, tokens signed with it are rejected afterwards
+func (r *KeyRing) RemoveKey(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if id == r.activeID {
+		return fmt.Errorf("cannot remove the active key %s, activate another key first", id)
+	}
+
+	if _, exists := r.keys[id]; !exists {
+		return fmt.Errorf("unknown key ID: %s", id)
+	}
+
+	delete(r.keys, id)
+	return nil
+}
+
+// ActiveKeyID returns the ID of the signing key
+func (r *KeyRing) ActiveKeyID() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.activeID
+}
+
+// KeyIDs returns all known key IDs in sorted order
+func (r *KeyRing) KeyIDs() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// signingKey returns the active key ID and secret
+func (r *KeyRing) signingKey() (string, []byte) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.activeID, r.keys[r.activeID]
+}
+
+// key returns the secret of a key ID
+func (r *KeyRing) key(id string) ([]byte, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	secret, ok := r.keys[id]
+	return secret, ok
+}
@@ -0,0 +1,42 @@
+package serviceauth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsContextKey is the gin context key holding the verified *Claims
+const ClaimsContextKey = "serviceClaims"
+
+// GinMiddleware rejects requests without a valid service token for the verifier's audience
+func GinMiddleware(verifier *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := verifier.VerifyRequest(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    http.StatusUnauthorized,
+				"message": "Service authentication failed",
+				"error": gin.H{
+					"type":    "service_auth_error",
+					"code":    "401",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+
+		c.Set(ClaimsContextKey, claims)
+		c.Next()
+	}
+}
+
+// GetClaims returns the service claims stored by GinMiddleware
+func GetClaims(c *gin.Context) *Claims {
+	if value, exists := c.Get(ClaimsContextKey); exists {
+		if claims, ok := value.(*Claims); ok {
+			return claims
+		}
+	}
+	return nil
+}
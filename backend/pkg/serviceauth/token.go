@@ -0,0 +1,219 @@
+package serviceauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HeaderName is the HTTP header carrying the service token
+const HeaderName = "X-Service-Token"
+
+// Service names used as issuer and audience
+const (
+	ServiceAuthAPI        = "auth-api"
+	ServiceControlFlowAPI = "control-flow-api"
+	ServiceDataFlowAPI    = "dataflow-api"
+)
+
+var (
+	// ErrMissingToken is returned when a request carries no service token
+	ErrMissingToken = errors.New("service token is required")
+
+	// ErrInvalidToken is returned for malformed tokens or bad signatures
+	ErrInvalidToken = errors.New("invalid service token")
+
+	// ErrExpiredToken is returned for tokens past their expiry
+	ErrExpiredToken = errors.New("service token expired")
+
+	// ErrWrongAudience is returned when the token was issued for another service
+	ErrWrongAudience = errors.New("service token audience mismatch")
+)
+
+// header is the token header, compatible with JWT HS256
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Claims represents the claims of a service token
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+// Issuer signs tokens on behalf of a service
+type Issuer struct {
+	keyRing *KeyRing
+	service string
+	ttl     time.Duration
+}
+
+// NewIssuer creates a token issuer for the named service, ttl defaults to one minute
+func NewIssuer(keyRing *KeyRing, service string, ttl time.Duration) (*Issuer, error) {
+	if keyRing == nil {
+		return nil, fmt.Errorf("key ring cannot be nil")
+	}
+
+	if service == "" {
+		return nil, fmt.Errorf("service name cannot be empty")
+	}
+
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	return &Issuer{keyRing: keyRing, service: service, ttl: ttl}, nil
+}
+
+// Issue creates a token for calling the audience service
+func (i *Issuer) Issue(audience string) (string, error) {
+	if audience == "" {
+		return "", fmt.Errorf("audience cannot be empty")
+	}
+
+	keyID, secret := i.keyRing.signingKey()
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Issuer:    i.service,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.ttl).Unix(),
+		ID:        hex.EncodeToString(nonce),
+	}
+
+	headerJSON, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: keyID})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token header: %w", err)
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	return signingInput + "." + encodeSegment(sign(secret, signingInput)), nil
+}
+
+// Verifier validates tokens addressed to a service
+type Verifier struct {
+	keyRing  *KeyRing
+	audience string
+	leeway   time.Duration
+	allowed  map[string]bool
+}
+
+// NewVerifier creates a verifier for tokens addressed to audience,
+// allowedIssuers restricts the calling services (empty means any)
+func NewVerifier(keyRing *KeyRing, audience string, allowedIssuers ...string) (*Verifier, error) {
+	if keyRing == nil {
+		return nil, fmt.Errorf("key ring cannot be nil")
+	}
+
+	if audience == "" {
+		return nil, fmt.Errorf("audience cannot be empty")
+	}
+
+	allowed := make(map[string]bool, len(allowedIssuers))
+	for _, issuer := range allowedIssuers {
+		allowed[issuer] = true
+	}
+
+	return &Verifier{
+		keyRing:  keyRing,
+		audience: audience,
+		leeway:   5 * time.Second,
+		allowed:  allowed,
+	}, nil
+}
+
+// Verify checks the signature, expiry, audience and issuer of a token
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil || h.Algorithm != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	secret, ok := v.keyRing.key(h.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key ID %s", ErrInvalidToken, h.KeyID)
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	claimsJSON, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Add(-v.leeway).Unix() > claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	if claims.Audience != v.audience {
+		return nil, ErrWrongAudience
+	}
+
+	if len(v.allowed) > 0 && !v.allowed[claims.Issuer] {
+		return nil, fmt.Errorf("%w: issuer %s is not allowed", ErrInvalidToken, claims.Issuer)
+	}
+
+	return &claims, nil
+}
+
+// sign computes the HMAC-SHA256 of the signing input
+func sign(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// encodeSegment encodes a token segment as unpadded base64url
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSegment decodes an unpadded base64url token segment
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
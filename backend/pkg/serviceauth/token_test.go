@@ -0,0 +1,225 @@
+package serviceauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecretA = []byte("0123456789abcdef0123456789abcdef")
+	testSecretB = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func newTestKeyRing(t *testing.T) *KeyRing {
+	ring, err := NewKeyRing(map[string][]byte{"k1": testSecretA}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeyRing() error = %v", err)
+	}
+	return ring
+}
+
+func TestParseKeyRing(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		activeID string
+		wantErr  bool
+		errorMsg string
+	}{
+		{
+			name:     "Single key becomes active",
+			spec:     "k1:" + string(testSecretA),
+			activeID: "",
+			wantErr:  false,
+		},
+		{
+			name:     "Multiple keys with active",
+			spec:     "k1:" + string(testSecretA) + ", k2:" + string(testSecretB),
+			activeID: "k2",
+			wantErr:  false,
+		},
+		{
+			name:     "Empty spec",
+			spec:     "",
+			wantErr:  true,
+			errorMsg: "at least one key is required",
+		},
+		{
+			name:     "Missing separator",
+			spec:     "k1" + string(testSecretA),
+			wantErr:  true,
+			errorMsg: "expected kid:secret",
+		},
+		{
+			name:     "Short secret",
+			spec:     "k1:short",
+			wantErr:  true,
+			errorMsg: "too short",
+		},
+		{
+			name:     "Unknown active key",
+			spec:     "k1:" + string(testSecretA) + ",k2:" + string(testSecretB),
+			activeID: "k3",
+			wantErr:  true,
+			errorMsg: "unknown key ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring, err := ParseKeyRing(tt.spec, tt.activeID)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("ParseKeyRing() error = %v, want error containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKeyRing() unexpected error = %v", err)
+			}
+			if tt.activeID != "" && ring.ActiveKeyID() != tt.activeID {
+				t.Errorf("ActiveKeyID() = %s, want %s", ring.ActiveKeyID(), tt.activeID)
+			}
+		})
+	}
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	ring := newTestKeyRing(t)
+
+	issuer, err := NewIssuer(ring, ServiceDataFlowAPI, time.Minute)
+	if err != nil {
+		t.Fatalf("NewIssuer() error = %v", err)
+	}
+
+	verifier, err := NewVerifier(ring, ServiceControlFlowAPI, ServiceDataFlowAPI)
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		token, err := issuer.Issue(ServiceControlFlowAPI)
+		if err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if claims.Issuer != ServiceDataFlowAPI || claims.Audience != ServiceControlFlowAPI {
+			t.Errorf("Verify() claims = %+v", claims)
+		}
+	})
+
+	t.Run("Wrong audience", func(t *testing.T) {
+		token, _ := issuer.Issue(ServiceAuthAPI)
+		if _, err := verifier.Verify(token); !errors.Is(err, ErrWrongAudience) {
+			t.Errorf("Verify() error = %v, want ErrWrongAudience", err)
+		}
+	})
+
+	t.Run("Issuer not allowed", func(t *testing.T) {
+		otherIssuer, _ := NewIssuer(ring, ServiceAuthAPI, time.Minute)
+		token, _ := otherIssuer.Issue(ServiceControlFlowAPI)
+		if _, err := verifier.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("Tampered claims", func(t *testing.T) {
+		token, _ := issuer.Issue(ServiceControlFlowAPI)
+		parts := strings.Split(token, ".")
+		forged := encodeSegment([]byte(`{"iss":"dataflow-api","aud":"control-flow-api","exp":9999999999}`))
+		if _, err := verifier.Verify(parts[0] + "." + forged + "." + parts[2]); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		shortIssuer := &Issuer{keyRing: ring, service: ServiceDataFlowAPI, ttl: -time.Minute}
+		token, _ := shortIssuer.Issue(ServiceControlFlowAPI)
+		if _, err := verifier.Verify(token); !errors.Is(err, ErrExpiredToken) {
+			t.Errorf("Verify() error = %v, want ErrExpiredToken", err)
+		}
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		if _, err := verifier.Verify(""); !errors.Is(err, ErrMissingToken) {
+			t.Errorf("Verify() error = %v, want ErrMissingToken", err)
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	ring := newTestKeyRing(t)
+	issuer, _ := NewIssuer(ring, ServiceDataFlowAPI, time.Minute)
+	verifier, _ := NewVerifier(ring, ServiceControlFlowAPI)
+
+	oldToken, _ := issuer.Issue(ServiceControlFlowAPI)
+
+	if err := ring.Rotate("k2", testSecretB); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	newToken, _ := issuer.Issue(ServiceControlFlowAPI)
+
+	// both keys are valid during the rollout
+	if _, err := verifier.Verify(oldToken); err != nil {
+		t.Errorf("Verify(old) error = %v during rollout", err)
+	}
+	if _, err := verifier.Verify(newToken); err != nil {
+		t.Errorf("Verify(new) error = %v", err)
+	}
+
+	if err := ring.RemoveKey("k2"); err == nil {
+		t.Errorf("RemoveKey() of the active key should fail")
+	}
+
+	if err := ring.RemoveKey("k1"); err != nil {
+		t.Fatalf("RemoveKey() error = %v", err)
+	}
+	if _, err := verifier.Verify(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(old) error = %v after retirement, want ErrInvalidToken", err)
+	}
+	if _, err := verifier.Verify(newToken); err != nil {
+		t.Errorf("Verify(new) error = %v after retirement", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	ring := newTestKeyRing(t)
+	issuer, _ := NewIssuer(ring, ServiceDataFlowAPI, time.Minute)
+	verifier, _ := NewVerifier(ring, ServiceControlFlowAPI)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := verifier.VerifyRequest(r); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(issuer, ServiceControlFlowAPI, 5*time.Second)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status without token = %d, want 401", resp.StatusCode)
+	}
+}
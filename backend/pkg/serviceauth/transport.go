@@ -0,0 +1,53 @@
+package serviceauth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Transport is an http.RoundTripper that attaches a fresh service token to each request
+type Transport struct {
+	// Issuer signs the tokens
+	Issuer *Issuer
+
+	// Audience is the service being called
+	Audience string
+
+	// Base is the underlying transport (defaults to http.DefaultTransport)
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Issuer.Issue(t.Audience)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	// RoundTrippers must not modify the original request
+	clone := req.Clone(req.Context())
+	clone.Header.Set(HeaderName, token)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(clone)
+}
+
+// NewHTTPClient returns an HTTP client that authenticates as the issuer's service towards audience
+func NewHTTPClient(issuer *Issuer, audience string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &Transport{
+			Issuer:   issuer,
+			Audience: audience,
+		},
+	}
+}
+
+// VerifyRequest verifies the service token carried by an incoming request
+func (v *Verifier) VerifyRequest(req *http.Request) (*Claims, error) {
+	return v.Verify(req.Header.Get(HeaderName))
+}
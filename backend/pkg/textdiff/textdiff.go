@@ -0,0 +1,138 @@
+package textdiff
+
+import "strings"
+
+// Line operations
+const (
+	OpEqual  = " "
+	OpDelete = "-"
+	OpInsert = "+"
+)
+
+// maxCells bounds the comparison table, longer texts are compared as a whole
+// after their common prefix and suffix
+const maxCells = 4_000_000
+
+// Line one line of a diff, Op tells whether it is in both texts, only the old
+// one or only the new one
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines diffs two texts line by line, keeping the lines of the longest common
+// subsequence and marking the rest as deleted or inserted
+func Lines(old, new string) []Line {
+	return compare(split(old), split(new))
+}
+
+// Similarity scores how alike two texts are from 0 to 1: twice the words they have
+// in common, in order, over the words of both. Two empty texts are identical.
+func Similarity(old, new string) float64 {
+	a, b := strings.Fields(old), strings.Fields(new)
+	if len(a)+len(b) == 0 {
+		return 1
+	}
+
+	common := 0
+	for _, word := range compare(a, b) {
+		if word.Op == OpEqual {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+// compare diffs two token lists, keeping their common prefix and suffix and the
+// longest common subsequence in between
+func compare(a, b []string) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := make([]Line, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		diff = append(diff, Line{Op: OpEqual, Text: text})
+	}
+	diff = append(diff, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		diff = append(diff, Line{Op: OpEqual, Text: text})
+	}
+	return diff
+}
+
+// Changed reports whether the diff has any deleted or inserted line
+func Changed(diff []Line) bool {
+	for _, line := range diff {
+		if line.Op != OpEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// split the text into lines, an empty text has none
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// middle diffs the differing part of both texts through a longest common
+// subsequence table
+func middle(a, b []string) []Line {
+	var diff []Line
+	if len(a)*len(b) > maxCells {
+		for _, text := range a {
+			diff = append(diff, Line{Op: OpDelete, Text: text})
+		}
+		for _, text := range b {
+			diff = append(diff, Line{Op: OpInsert, Text: text})
+		}
+		return diff
+	}
+
+	// lcs[i][j] length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, Line{Op: OpEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, Line{Op: OpDelete, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, Line{Op: OpInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, Line{Op: OpDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, Line{Op: OpInsert, Text: b[j]})
+	}
+	return diff
+}
@@ -0,0 +1,86 @@
+package textdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// format renders a diff as one "op text" entry per line
+func format(diff []Line) []string {
+	lines := make([]string, 0, len(diff))
+	for _, line := range diff {
+		lines = append(lines, line.Op+line.Text)
+	}
+	return lines
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		want    []string
+		changed bool
+	}{
+		{name: "Identical", old: "a\nb", new: "a\nb", want: []string{" a", " b"}, changed: false},
+		{name: "Both empty", old: "", new: "", want: []string{}, changed: false},
+		{name: "Trailing newline ignored", old: "a\n", new: "a", want: []string{" a"}, changed: false},
+		{name: "Line changed", old: "a\nb\nc", new: "a\nx\nc", want: []string{" a", "-b", "+x", " c"}, changed: true},
+		{name: "Line inserted", old: "a\nc", new: "a\nb\nc", want: []string{" a", "+b", " c"}, changed: true},
+		{name: "Line deleted", old: "a\nb\nc", new: "a\nc", want: []string{" a", "-b", " c"}, changed: true},
+		{name: "Old empty", old: "", new: "a\nb", want: []string{"+a", "+b"}, changed: true},
+		{name: "New empty", old: "a", new: "", want: []string{"-a"}, changed: true},
+		{name: "Common lines kept", old: "x\na\ny\nb", new: "a\nz\nb", want: []string{"-x", " a", "-y", "+z", " b"}, changed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := Lines(tt.old, tt.new)
+			if got := format(diff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+			}
+			if got := Changed(diff); got != tt.changed {
+				t.Errorf("Changed = %v, want %v", got, tt.changed)
+			}
+		})
+	}
+}
+
+func TestLines_LargeTextsFallBack(t *testing.T) {
+	old := strings.Repeat("a\n", 3000) + "end"
+	new := "start\n" + strings.Repeat("b\n", 3000)
+
+	diff := Lines(old, new)
+	if len(diff) != 6002 {
+		t.Fatalf("Expected every line deleted and inserted, got %d lines", len(diff))
+	}
+	if diff[0].Op != OpDelete || diff[len(diff)-1].Op != OpInsert {
+		t.Errorf("Expected deletions before insertions, got %q first and %q last", diff[0].Op, diff[len(diff)-1].Op)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want float64
+	}{
+		{name: "Identical", old: "the cat sat", new: "the cat sat", want: 1},
+		{name: "Both empty", old: "", new: "", want: 1},
+		{name: "Whitespace ignored", old: "the  cat\nsat", new: "the cat sat", want: 1},
+		{name: "One empty", old: "the cat", new: "", want: 0},
+		{name: "Nothing in common", old: "a b", new: "c d", want: 0},
+		{name: "One word changed", old: "the cat sat", new: "the dog sat", want: 4.0 / 6},
+		{name: "Words appended", old: "the cat", new: "the cat sat down", want: 4.0 / 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Similarity(tt.old, tt.new); got != tt.want {
+				t.Errorf("Similarity(%q, %q) = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Package textlimit measures and cuts text without splitting characters. Cuts fall on
+// rune boundaries and, where possible, between grapheme clusters, so an emoji with its
+// skin tone or joined family members, a flag, a letter with its combining accents or a
+// decomposed Hangul syllable is kept or dropped as a whole.
+package textlimit
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxClusterBytes how far a cut moves to reach a grapheme cluster boundary; clusters
+// longer than this, e.g. long chains of combining marks, are cut between runes. A cut
+// text is therefore at most MaxClusterBytes shorter than the limit allows.
+const MaxClusterBytes = 64
+
+// Ellipsis appended by Ellipsize
+const Ellipsis = "…"
+
+// zeroWidthJoiner joins emoji into one cluster, e.g. the members of a family
+const zeroWidthJoiner = '\u200d'
+
+// TruncateBytes cut text to at most limit bytes, reporting whether it was cut
+func TruncateBytes(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	if limit <= 0 {
+		return "", true
+	}
+
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:clusterEnd(text, cut)], true
+}
+
+// TailBytes keep the last limit bytes of text at most, reporting whether the
+// beginning was cut
+func TailBytes(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	if limit <= 0 {
+		return "", true
+	}
+
+	start := len(text) - limit
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return text[clusterStart(text, start):], true
+}
+
+// TruncateRunes cut text to at most limit characters (runes), reporting whether it was cut
+func TruncateRunes(text string, limit int) (string, bool) {
+	if limit <= 0 {
+		return "", text != ""
+	}
+
+	count := 0
+	for i := range text {
+		if count == limit {
+			return text[:clusterEnd(text, i)], true
+		}
+		count++
+	}
+	return text, false
+}
+
+// Ellipsize shorten text to at most limit characters for display, ending a cut text
+// with Ellipsis, which counts towards the limit
+func Ellipsize(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	cut, _ := TruncateRunes(text, limit-utf8.RuneCountInString(Ellipsis))
+	return cut + Ellipsis
+}
+
+// TailTokens keep the end of text that estimates to at most limit tokens, reporting
+// whether the beginning was cut
+func TailTokens(text string, limit int) (string, bool) {
+	if EstimateTokens(text) <= limit {
+		return text, false
+	}
+	if limit <= 0 {
+		return "", true
+	}
+
+	var wide, other int
+	start := len(text)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+		if estimate(wide, other) > limit {
+			break
+		}
+		start -= size
+	}
+	return text[clusterStart(text, start):], true
+}
+
+// EstimateTokens rough token count of text: a token per CJK character, as tokenizers
+// rarely merge them, and about four characters per token for everything else
+func EstimateTokens(text string) int {
+	var wide, other int
+	for _, r := range text {
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return estimate(wide, other)
+}
+
+// estimate tokens of wide CJK characters and other characters
+func estimate(wide, other int) int {
+	return wide + (other+3)/4
+}
+
+// isWide whether r is a Han, kana or Hangul character
+func isWide(r rune) bool {
+	return r >= 0x1100 && unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// clusterEnd the nearest cluster boundary at or before the rune boundary i, i itself
+// when there is none within MaxClusterBytes
+func clusterEnd(text string, i int) int {
+	for at := i; at >= 0 && i-at <= MaxClusterBytes; {
+		if IsClusterBoundary(text, at) {
+			return at
+		}
+		_, size := utf8.DecodeLastRuneInString(text[:at])
+		at -= size
+	}
+	return i
+}
+
+// clusterStart the nearest cluster boundary at or after the rune boundary i, i itself
+// when there is none within MaxClusterBytes
+func clusterStart(text string, i int) int {
+	for at := i; at <= len(text) && at-i <= MaxClusterBytes; {
+		if IsClusterBoundary(text, at) {
+			return at
+		}
+		_, size := utf8.DecodeRuneInString(text[at:])
+		at += size
+	}
+	return i
+}
+
+// IsClusterBoundary whether byte offset i of text lies between two grapheme clusters.
+// Covers the cases that matter for cutting text: CR LF, combining marks, variation
+// selectors, emoji modifiers, tags and zero width joiner sequences, flag pairs and
+// Hangul jamo.
+func IsClusterBoundary(text string, i int) bool {
+	if i <= 0 || i >= len(text) {
+		return true
+	}
+	if !utf8.RuneStart(text[i]) {
+		return false
+	}
+
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	switch {
+	case prev == '\r' && r == '\n':
+		return false
+	case prev == zeroWidthJoiner, isExtend(r):
+		return false
+	case isHangulLeading(prev) && isHangulJamo(r):
+		return false
+	case isRegionalIndicator(r) && isRegionalIndicator(prev):
+		// flags are pairs of regional indicators, a boundary follows every second one
+		count := 0
+		for at := i; at > 0; {
+			before, size := utf8.DecodeLastRuneInString(text[:at])
+			if !isRegionalIndicator(before) {
+				break
+			}
+			count++
+			at -= size
+		}
+		return count%2 == 0
+	}
+	return true
+}
+
+// isExtend whether r attaches to the rune before it
+func isExtend(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case r == zeroWidthJoiner:
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF: // variation selectors
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // emoji skin tones
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // tags of subdivision flags
+		return true
+	case r >= 0x1160 && r <= 0x11FF, r >= 0xD7B0 && r <= 0xD7FF: // Hangul vowel and trailing jamo
+		return true
+	}
+	return false
+}
+
+// isHangulLeading whether r is a leading consonant jamo, which joins the next jamo
+func isHangulLeading(r rune) bool {
+	return r >= 0x1100 && r <= 0x115F || r >= 0xA960 && r <= 0xA97F
+}
+
+// isHangulJamo whether r is a conjoining Hangul jamo
+func isHangulJamo(r rune) bool {
+	return isHangulLeading(r) || r >= 0x1160 && r <= 0x11FF || r >= 0xD7B0 && r <= 0xD7FF
+}
+
+// isRegionalIndicator whether r is one of the letters flags are written with
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
@@ -0,0 +1,197 @@
+package textlimit
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const (
+	family   = "\U0001F468\u200d\U0001F469\u200d\U0001F467" // three emoji joined into one
+	thumbsUp = "\U0001F44D\U0001F3FD"                       // emoji with a skin tone
+	flagJP   = "\U0001F1EF\U0001F1F5"                       // two regional indicators
+	eAcute   = "e\u0301"                                    // e with a combining acute accent
+	hangul   = "\u1112\u1161\u11ab"                         // 한 written as jamo
+)
+
+func TestTruncateBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+		cut   bool
+	}{
+		{name: "Fits", text: "hello", limit: 5, want: "hello", cut: false},
+		{name: "ASCII", text: "hello", limit: 3, want: "hel", cut: true},
+		{name: "Zero limit", text: "hello", limit: 0, want: "", cut: true},
+		{name: "CJK not split", text: "你好世界", limit: 7, want: "你好", cut: true},
+		{name: "CJK on boundary", text: "你好世界", limit: 6, want: "你好", cut: true},
+		{name: "Joined emoji kept whole", text: "a" + family + "b", limit: len(family), want: "a", cut: true},
+		{name: "Skin tone kept with emoji", text: "ok " + thumbsUp, limit: 3 + len("\U0001F44D"), want: "ok ", cut: true},
+		{name: "Flag not split", text: flagJP + flagJP, limit: len(flagJP) + 4, want: flagJP, cut: true},
+		{name: "Combining accent kept", text: "caf" + eAcute + "s", limit: 4, want: "caf", cut: true},
+		{name: "Hangul jamo kept", text: hangul + hangul, limit: len(hangul) + 3, want: hangul, cut: true},
+		{name: "CR LF kept", text: "a\r\nb", limit: 2, want: "a", cut: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := TruncateBytes(tt.text, tt.limit)
+			if got != tt.want || cut != tt.cut {
+				t.Errorf("TruncateBytes(%q, %d) = %q, %v, want %q, %v", tt.text, tt.limit, got, cut, tt.want, tt.cut)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("TruncateBytes(%q, %d) returned invalid UTF-8 %q", tt.text, tt.limit, got)
+			}
+		})
+	}
+}
+
+func TestTruncateBytes_LongClusterCutBetweenRunes(t *testing.T) {
+	text := "a" + strings.Repeat("\u0301", 100)
+
+	got, cut := TruncateBytes(text, 101)
+	if !cut || len(got) != 101 || !utf8.ValidString(got) {
+		t.Errorf("Expected a valid 101 byte cut inside the overlong cluster, got %d bytes, cut %v", len(got), cut)
+	}
+}
+
+func TestTailBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+		cut   bool
+	}{
+		{name: "Fits", text: "hello", limit: 5, want: "hello", cut: false},
+		{name: "ASCII", text: "hello", limit: 3, want: "llo", cut: true},
+		{name: "CJK not split", text: "你好世界", limit: 7, want: "世界", cut: true},
+		{name: "Joined emoji kept whole", text: family + "ok", limit: len(family), want: "ok", cut: true},
+		{name: "Combining accent not orphaned", text: "a" + eAcute, limit: 2, want: "", cut: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := TailBytes(tt.text, tt.limit)
+			if got != tt.want || cut != tt.cut {
+				t.Errorf("TailBytes(%q, %d) = %q, %v, want %q, %v", tt.text, tt.limit, got, cut, tt.want, tt.cut)
+			}
+		})
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+		cut   bool
+	}{
+		{name: "Fits", text: "你好", limit: 2, want: "你好", cut: false},
+		{name: "CJK", text: "你好世界", limit: 3, want: "你好世", cut: true},
+		{name: "Joined emoji kept whole", text: "hi" + family, limit: 4, want: "hi", cut: true},
+		{name: "Skin tone kept with emoji", text: thumbsUp + thumbsUp, limit: 3, want: thumbsUp, cut: true},
+		{name: "Combining accent kept", text: eAcute + eAcute, limit: 3, want: eAcute, cut: true},
+		{name: "Zero limit", text: "abc", limit: 0, want: "", cut: true},
+		{name: "Empty", text: "", limit: 0, want: "", cut: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := TruncateRunes(tt.text, tt.limit)
+			if got != tt.want || cut != tt.cut {
+				t.Errorf("TruncateRunes(%q, %d) = %q, %v, want %q, %v", tt.text, tt.limit, got, cut, tt.want, tt.cut)
+			}
+		})
+	}
+}
+
+func TestEllipsize(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{text: "short", limit: 10, want: "short"},
+		{text: "hello world", limit: 6, want: "hello…"},
+		{text: "こんにちは世界", limit: 4, want: "こんに…"},
+		{text: "ok" + family, limit: 4, want: "ok…"},
+	}
+
+	for _, tt := range tests {
+		if got := Ellipsize(tt.text, tt.limit); got != tt.want {
+			t.Errorf("Ellipsize(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "abcd", want: 1},
+		{text: "abcde", want: 2},
+		{text: "你好世界", want: 4},
+		{text: "こんにちは", want: 5},
+		{text: "안녕하세요", want: 5},
+		{text: "hi 你好", want: 3},
+	}
+
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTailTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+		cut   bool
+	}{
+		{name: "Fits", text: "abcdefgh", limit: 2, want: "abcdefgh", cut: false},
+		{name: "ASCII", text: "abcdefghijkl", limit: 2, want: "efghijkl", cut: true},
+		{name: "CJK", text: "一二三四五", limit: 2, want: "四五", cut: true},
+		{name: "Combining accent not orphaned", text: "abcd" + eAcute + "fgh", limit: 1, want: "fgh", cut: true},
+		{name: "Joined emoji not split", text: "x" + family, limit: 1, want: "", cut: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := TailTokens(tt.text, tt.limit)
+			if got != tt.want || cut != tt.cut {
+				t.Errorf("TailTokens(%q, %d) = %q, %v, want %q, %v", tt.text, tt.limit, got, cut, tt.want, tt.cut)
+			}
+		})
+	}
+}
+
+func TestIsClusterBoundary(t *testing.T) {
+	text := "a" + family + flagJP + flagJP + eAcute
+
+	var boundaries []int
+	for i := 0; i <= len(text); i++ {
+		if IsClusterBoundary(text, i) {
+			boundaries = append(boundaries, i)
+		}
+	}
+
+	a, f, j := 1, len(family), len(flagJP)
+	want := []int{0, a, a + f, a + f + j, a + f + 2*j, len(text)}
+	if len(boundaries) != len(want) {
+		t.Fatalf("Expected boundaries %v, got %v", want, boundaries)
+	}
+	for i := range want {
+		if boundaries[i] != want[i] {
+			t.Fatalf("Expected boundaries %v, got %v", want, boundaries)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package ttlcache provides a small in-process cache whose entries expire after a
+// fixed time to live, with hit and miss counters for monitoring.
+package ttlcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counters of a cache
+type Stats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	Entries int     `json:"entries"`
+	HitRate float64 `json:"hit_rate"`
+
+	// StaleHits expired values handed out by GetStale
+	StaleHits int64 `json:"stale_hits"`
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// Cache map of entries expiring ttl after they were set; when maxEntries is reached
+// expired entries are dropped first, then arbitrary ones. With a stale period expired
+// entries are kept that much longer for GetStale.
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	entries    map[K]entry[V]
+	ttl        time.Duration
+	stale      time.Duration
+	maxEntries int
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	staleHits atomic.Int64
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New create a cache, maxEntries <= 0 means unbounded
+func New[K comparable, V any](ttl time.Duration, maxEntries int) *Cache[K, V] {
+	return &Cache[K, V]{
+		entries:    make(map[K]entry[V]),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// WithStale keep expired entries for another stale period, to be read with GetStale;
+// set it before the cache is used
+func (c *Cache[K, V]) WithStale(stale time.Duration) *Cache[K, V] {
+	c.stale = stale
+	return c
+}
+
+// Get the value of key when it is present and not expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	now := c.now()
+	e, ok := c.entries[key]
+	if ok && !now.Before(e.expiresAt) {
+		if !now.Before(e.expiresAt.Add(c.stale)) {
+			delete(c.entries, key)
+		}
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.hits.Add(1)
+	return e.value, true
+}
+
+// GetStale the value of key even when it expired less than the stale period ago, with
+// how long ago it was set; for callers that cannot refresh it right now
+func (c *Cache[K, V]) GetStale(key K) (V, time.Duration, bool) {
+	c.mu.Lock()
+	now := c.now()
+	e, ok := c.entries[key]
+	if ok && !now.Before(e.expiresAt.Add(c.stale)) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		var zero V
+		return zero, 0, false
+	}
+	if !now.Before(e.expiresAt) {
+		c.staleHits.Add(1)
+	}
+	return e.value, now.Sub(e.expiresAt.Add(-c.ttl)), true
+}
+
+// Set store value under key for the cache's time to live
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, exists := c.entries[key]; !exists && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// evict make room for one entry, called with mu held
+func (c *Cache[K, V]) evict(now time.Time) {
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			return
+		}
+		delete(c.entries, key)
+	}
+}
+
+// Delete remove key
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// DeleteFunc remove every entry for which match returns true, returning how many were removed
+func (c *Cache[K, V]) DeleteFunc(match func(key K, value V) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, e := range c.entries {
+		if match(key, e.value) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Clear remove every entry, the counters are kept
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	c.entries = make(map[K]entry[V])
+	c.mu.Unlock()
+}
+
+// Stats current counters, expired entries not yet dropped are included in Entries
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries, StaleHits: c.staleHits.Load()}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,150 @@
+package ttlcache
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestCache a cache with a controllable clock, advance moves it forward
+func newTestCache(ttl time.Duration, maxEntries int) (*Cache[string, int], func(time.Duration)) {
+	cache := New[string, int](ttl, maxEntries)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCache_Expiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		wantHit bool
+	}{
+		{name: "Fresh", elapsed: 0, wantHit: true},
+		{name: "Before expiry", elapsed: 59 * time.Second, wantHit: true},
+		{name: "At expiry", elapsed: time.Minute, wantHit: false},
+		{name: "After expiry", elapsed: time.Hour, wantHit: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, advance := newTestCache(time.Minute, 0)
+			cache.Set("a", 1)
+			advance(tt.elapsed)
+
+			value, ok := cache.Get("a")
+			if ok != tt.wantHit {
+				t.Fatalf("Get hit = %v, want %v", ok, tt.wantHit)
+			}
+			if ok && value != 1 {
+				t.Errorf("Get = %d, want 1", value)
+			}
+		})
+	}
+}
+
+func TestCache_GetStale(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		wantGet bool
+		wantOK  bool
+	}{
+		{name: "Fresh", elapsed: 30 * time.Second, wantGet: true, wantOK: true},
+		{name: "Stale", elapsed: 3 * time.Minute, wantGet: false, wantOK: true},
+		{name: "Past the stale period", elapsed: 6 * time.Minute, wantGet: false, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, advance := newTestCache(time.Minute, 0)
+			cache.WithStale(5 * time.Minute)
+			cache.Set("a", 1)
+			advance(tt.elapsed)
+
+			if _, ok := cache.Get("a"); ok != tt.wantGet {
+				t.Fatalf("Get hit = %v, want %v", ok, tt.wantGet)
+			}
+			value, age, ok := cache.GetStale("a")
+			if ok != tt.wantOK {
+				t.Fatalf("GetStale hit = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (value != 1 || age != tt.elapsed) {
+				t.Errorf("GetStale = %d, %s, want 1, %s", value, age, tt.elapsed)
+			}
+		})
+	}
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	cache, advance := newTestCache(time.Minute, 2)
+	cache.Set("a", 1)
+	advance(2 * time.Minute)
+	cache.Set("b", 2)
+	cache.Set("c", 3)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expected the expired entry to be evicted first")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+
+	cache.Set("d", 4)
+	if entries := cache.Stats().Entries; entries != 2 {
+		t.Errorf("Entries = %d, want 2", entries)
+	}
+	if _, ok := cache.Get("d"); !ok {
+		t.Error("Expected the new entry to be stored")
+	}
+}
+
+func TestCache_DeleteFunc(t *testing.T) {
+	cache, _ := newTestCache(time.Minute, 0)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Set("c", 1)
+
+	if removed := cache.DeleteFunc(func(_ string, value int) bool { return value == 1 }); removed != 2 {
+		t.Errorf("DeleteFunc removed %d, want 2", removed)
+	}
+	if _, ok := cache.Get("b"); !ok {
+		t.Error("Expected b to be kept")
+	}
+
+	cache.Delete("b")
+	cache.Set("d", 4)
+	cache.Clear()
+	if entries := cache.Stats().Entries; entries != 0 {
+		t.Errorf("Entries after Clear = %d, want 0", entries)
+	}
+}
+
+func TestCache_Stats(t *testing.T) {
+	cache, advance := newTestCache(time.Minute, 0)
+	if stats := cache.Stats(); stats.HitRate != 0 {
+		t.Errorf("HitRate of an unused cache = %v, want 0", stats.HitRate)
+	}
+
+	cache.Set("a", 1)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("missing")
+
+	stats := cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("Hits, Misses = %d, %d, want 3, 1", stats.Hits, stats.Misses)
+	}
+	if stats.HitRate != 0.75 {
+		t.Errorf("HitRate = %v, want 0.75", stats.HitRate)
+	}
+
+	cache.WithStale(time.Minute)
+	advance(90 * time.Second)
+	cache.GetStale("a")
+	if staleHits := cache.Stats().StaleHits; staleHits != 1 {
+		t.Errorf("StaleHits = %d, want 1", staleHits)
+	}
+}
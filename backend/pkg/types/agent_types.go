@@ -11,6 +11,9 @@ const (
 	// Dify agents
 	AgentTypeDifyChat     AgentType = "dify-chat"
 	AgentTypeDifyWorkflow AgentType = "dify-workflow"
+
+	// Mock agents answer in process with canned responses, for development and testing
+	AgentTypeMock AgentType = "mock"
 )
 
 // Response format constants
@@ -25,6 +28,7 @@ func GetAllAgentTypes() []AgentType {
 		AgentTypeOpenAI,
 		AgentTypeDifyChat,
 		AgentTypeDifyWorkflow,
+		AgentTypeMock,
 	}
 }
 
@@ -160,9 +160,10 @@ const Agents: React.FC = () => {
         await controlFlowApi_endpoints.updateAgent(editingAgent.id, values);
         message.success('Agent updated successfully');
       } else {
-        // Create Agent
-        await controlFlowApi_endpoints.createAgent(values);
+        // Create Agent, the connector API key is only returned once
+        const response = await controlFlowApi_endpoints.createAgent(values);
         message.success('Agent created successfully');
+        showConnectorKey(response.data.data);
       }
       setIsModalVisible(false);
       loadAgents(pagination.current, pagination.pageSize, searchText);
@@ -172,6 +173,34 @@ const Agents: React.FC = () => {
     }
   };
 
+  // Show a newly generated connector API key, it cannot be retrieved later
+  const showConnectorKey = (agent?: Agent) => {
+    if (!agent?.connector_api_key) {
+      return;
+    }
+    Modal.success({
+      title: 'Connector API Key',
+      content: (
+        <div>
+          <p>Store this key now, it will not be shown again:</p>
+          <Text code copyable>{agent.connector_api_key}</Text>
+        </div>
+      ),
+    });
+  };
+
+  // Rotate connector API key
+  const handleRotateKey = async (agent: Agent) => {
+    try {
+      const response = await controlFlowApi_endpoints.rotateAgentKey(agent.id);
+      message.success('Connector API key rotated');
+      showConnectorKey(response.data.data);
+    } catch (error: any) {
+      console.error('Rotate key failed:', error);
+      message.error('Connector API key rotation failed');
+    }
+  };
+
   // Delete Agent
   const handleDeleteAgent = async (agentId: number) => {
     try {
@@ -574,7 +603,17 @@ const Agents: React.FC = () => {
                 <Text code>{hideApiKey(selectedAgent.source_api_key)}</Text>
               </Descriptions.Item>
               <Descriptions.Item label="Connector API Key">
-                <Text code copyable>{selectedAgent.connector_api_key}</Text>
+                <Space>
+                  <Text code>{selectedAgent.connector_key_prefix}…</Text>
+                  <PermissionGuard permission="agent_management">
+                    <Popconfirm
+                      title="The current key stops working immediately. Continue?"
+                      onConfirm={() => handleRotateKey(selectedAgent)}
+                    >
+                      <Button size="small">Rotate</Button>
+                    </Popconfirm>
+                  </PermissionGuard>
+                </Space>
               </Descriptions.Item>
               <Descriptions.Item label="Streaming">
                 {selectedAgent.support_streaming ? 
@@ -608,7 +647,7 @@ const Agents: React.FC = () => {
               description={
                 <div>
                   <p>Use the connector API key to access this Agent:</p>
-                  <Text code>Authorization: Bearer {selectedAgent.connector_api_key}</Text>
+                  <Text code>Authorization: Bearer {selectedAgent.connector_key_prefix}…</Text>
                   <p style={{ marginTop: '8px' }}>
                     Data flow API endpoint: <Text code>http://localhost:8082/api/v1/dataflow/chat/{selectedAgent.agent_id}</Text>
                   </p>
@@ -135,7 +135,8 @@ export interface Agent {
   type: 'openai' | 'dify-chat' | 'dify-workflow';
   url: string;
   source_api_key: string;
-  connector_api_key: string;
+  connector_api_key?: string; // only returned once, when the key is generated
+  connector_key_prefix: string;
   agent_id: string;
   qps: number;
   enabled: boolean;
@@ -188,6 +189,16 @@ export interface PaginationResponse<T> {
   };
 }
 
+// 列表查询参数
+export interface ListParams {
+  search?: string;
+  status?: string;
+  type?: string;
+  sort_by?: string;
+  order?: 'asc' | 'desc';
+  created_after?: string;
+}
+
 // 认证API
 export const authApi = {
   // 用户登录
@@ -222,8 +233,8 @@ export const authApi = {
 // 用户管理API（管理员功能）
 export const userApi = {
   // 获取用户列表
-  getUsers: (page = 1, pageSize = 10, search = ''): Promise<AxiosResponse<PaginationResponse<User>>> =>
-    api.get(`/api/v1/users?page=${page}&page_size=${pageSize}&search=${search}`),
+  getUsers: (page = 1, pageSize = 10, search = '', params: ListParams = {}): Promise<AxiosResponse<PaginationResponse<User>>> =>
+    api.get('/api/v1/users', { params: { page, page_size: pageSize, search: search || undefined, ...params } }),
 
   // 创建用户
   createUser: (data: CreateUserRequest): Promise<AxiosResponse<ApiResponse<User>>> =>
@@ -271,8 +282,8 @@ export const controlFlowApi_endpoints = {
     controlFlowApi.put('/api/v1/controlflow/system-config', data),
 
   // Agent管理
-  getAgents: (page = 1, pageSize = 10): Promise<AxiosResponse<PaginationResponse<Agent>>> =>
-    controlFlowApi.get(`/api/v1/controlflow/agents?page=${page}&page_size=${pageSize}`),
+  getAgents: (page = 1, pageSize = 10, params: ListParams = {}): Promise<AxiosResponse<PaginationResponse<Agent>>> =>
+    controlFlowApi.get('/api/v1/controlflow/agents', { params: { page, page_size: pageSize, ...params } }),
 
   createAgent: (data: CreateAgentRequest): Promise<AxiosResponse<ApiResponse<Agent>>> =>
     controlFlowApi.post('/api/v1/controlflow/agents', data),
@@ -280,6 +291,9 @@ export const controlFlowApi_endpoints = {
   getAgent: (id: number): Promise<AxiosResponse<ApiResponse<Agent>>> =>
     controlFlowApi.get(`/api/v1/controlflow/agents/${id}`),
 
+  rotateAgentKey: (id: number): Promise<AxiosResponse<ApiResponse<Agent>>> =>
+    controlFlowApi.post(`/api/v1/controlflow/agents/${id}/rotate-key`),
+
   updateAgent: (id: number, data: Partial<CreateAgentRequest>): Promise<AxiosResponse<ApiResponse<Agent>>> =>
     controlFlowApi.put(`/api/v1/controlflow/agents/${id}`, data),
 